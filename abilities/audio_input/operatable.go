@@ -15,7 +15,7 @@ func newBaseOperatable(l astikit.SeverityLogger) (o *astibob.BaseOperatable) {
 
 	// Add static
 	o.AddRoute("/static/index.css", http.MethodGet, astibob.ContentHandle("/static/index.css", []byte{ 0x23,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2d,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0x20,0x74,0x72,0x20,0x74,0x64,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x77,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x62,0x6f,0x6c,0x64,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6c,0x65,0x66,0x74,0x3b,0xa,0x7d,0xa,0xa,0x23,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2d,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0x20,0x74,0x72,0x20,0x74,0x64,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x72,0x69,0x67,0x68,0x74,0x3b,0xa,0x7d, }, l))
-	o.AddRoute("/static/index.js", http.MethodGet, astibob.ContentHandle("/static/index.js", []byte{ 0x6c,0x65,0x74,0x20,0x69,0x6e,0x64,0x65,0x78,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x62,0x74,0x6e,0x2d,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x68,0x61,0x6e,0x64,0x6c,0x65,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x65,0x78,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x20,0x3d,0x20,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x22,0x53,0x61,0x79,0x20,0x73,0x6f,0x6d,0x65,0x74,0x68,0x69,0x6e,0x67,0x2e,0x2e,0x2e,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x65,0x74,0x57,0x69,0x64,0x74,0x68,0x28,0x22,0x33,0x30,0x30,0x70,0x78,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x28,0x63,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x6e,0x64,0x20,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x20,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2e,0x2e,0x2f,0x72,0x6f,0x75,0x74,0x65,0x73,0x2f,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x20,0x65,0x72,0x72,0x6f,0x72,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x52,0x65,0x73,0x75,0x6c,0x74,0x73,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x52,0x65,0x73,0x75,0x6c,0x74,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x74,0x20,0x68,0x74,0x6d,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2d,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0x22,0x29,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x60,0x3c,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x4d,0x61,0x78,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x60,0x20,0x2b,0x20,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x61,0x78,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x2b,0x20,0x60,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x43,0x75,0x72,0x72,0x65,0x6e,0x74,0x20,0x6d,0x61,0x78,0x20,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x60,0x20,0x2b,0x20,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x5f,0x6d,0x61,0x78,0x5f,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x2b,0x20,0x60,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x53,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x20,0x6d,0x61,0x78,0x20,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x60,0x20,0x2b,0x20,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x5f,0x6d,0x61,0x78,0x5f,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x2b,0x20,0x60,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x3c,0x2f,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x3c,0x63,0x61,0x6e,0x76,0x61,0x73,0x20,0x69,0x64,0x3d,0x27,0x63,0x68,0x61,0x72,0x74,0x27,0x3e,0x3c,0x2f,0x63,0x61,0x6e,0x76,0x61,0x73,0x3e,0x60,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x68,0x61,0x72,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x20,0x43,0x68,0x61,0x72,0x74,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x63,0x68,0x61,0x72,0x74,0x22,0x29,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x63,0x68,0x61,0x72,0x74,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l))
+	o.AddRoute("/static/index.js", http.MethodGet, astibob.ContentHandle("/static/index.js", []byte{ 0x6c,0x65,0x74,0x20,0x69,0x6e,0x64,0x65,0x78,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x62,0x74,0x6e,0x2d,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x68,0x61,0x6e,0x64,0x6c,0x65,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x65,0x78,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x20,0x3d,0x20,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x22,0x53,0x61,0x79,0x20,0x73,0x6f,0x6d,0x65,0x74,0x68,0x69,0x6e,0x67,0x2e,0x2e,0x2e,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x65,0x74,0x57,0x69,0x64,0x74,0x68,0x28,0x22,0x33,0x30,0x30,0x70,0x78,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x28,0x63,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x6e,0x64,0x20,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x20,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2e,0x2e,0x2f,0x72,0x6f,0x75,0x74,0x65,0x73,0x2f,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x20,0x65,0x72,0x72,0x6f,0x72,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x52,0x65,0x73,0x75,0x6c,0x74,0x73,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x43,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x52,0x65,0x73,0x75,0x6c,0x74,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x74,0x20,0x68,0x74,0x6d,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x63,0x61,0x6c,0x69,0x62,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2d,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0x22,0x29,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x60,0x3c,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x4d,0x61,0x78,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x60,0x20,0x2b,0x20,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x61,0x78,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x2b,0x20,0x60,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x43,0x75,0x72,0x72,0x65,0x6e,0x74,0x20,0x6d,0x61,0x78,0x20,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x60,0x20,0x2b,0x20,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x5f,0x6d,0x61,0x78,0x5f,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x2b,0x20,0x60,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x53,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x20,0x6d,0x61,0x78,0x20,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x64,0x3e,0x60,0x20,0x2b,0x20,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x5f,0x6d,0x61,0x78,0x5f,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x2b,0x20,0x60,0x3c,0x2f,0x74,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x3c,0x2f,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x62,0x74,0x6e,0x2d,0x75,0x73,0x65,0x2d,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x22,0x3e,0x55,0x73,0x65,0x20,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x20,0x6d,0x61,0x78,0x20,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x20,0x6c,0x65,0x76,0x65,0x6c,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x3c,0x63,0x61,0x6e,0x76,0x61,0x73,0x20,0x69,0x64,0x3d,0x27,0x63,0x68,0x61,0x72,0x74,0x27,0x3e,0x3c,0x2f,0x63,0x61,0x6e,0x76,0x61,0x73,0x3e,0x60,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x75,0x73,0x65,0x20,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x62,0x74,0x6e,0x2d,0x75,0x73,0x65,0x2d,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x4d,0x61,0x78,0x53,0x69,0x6c,0x65,0x6e,0x63,0x65,0x4c,0x65,0x76,0x65,0x6c,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x5f,0x6d,0x61,0x78,0x5f,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x68,0x61,0x72,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x20,0x43,0x68,0x61,0x72,0x74,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x63,0x68,0x61,0x72,0x74,0x22,0x29,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x63,0x68,0x61,0x72,0x74,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x4d,0x61,0x78,0x53,0x69,0x6c,0x65,0x6e,0x63,0x65,0x4c,0x65,0x76,0x65,0x6c,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6c,0x65,0x76,0x65,0x6c,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x50,0x41,0x54,0x43,0x48,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x7b,0x6d,0x61,0x78,0x5f,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x5f,0x6c,0x65,0x76,0x65,0x6c,0x3a,0x20,0x6c,0x65,0x76,0x65,0x6c,0x7d,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2e,0x2e,0x2f,0x63,0x6f,0x6e,0x66,0x69,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4e,0x6f,0x74,0x69,0x66,0x79,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x28,0x22,0x4d,0x61,0x78,0x20,0x73,0x69,0x6c,0x65,0x6e,0x63,0x65,0x20,0x6c,0x65,0x76,0x65,0x6c,0x20,0x68,0x61,0x73,0x20,0x62,0x65,0x65,0x6e,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x64,0x22,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l))
 	o.AddRoute("/static/lib/chart.js-2.7.1/chart.js.min.js", http.MethodGet, astibob.ContentHandle("/static/lib/chart.js-2.7.1/chart.js.min.js", []byte{ 0x2f,0x2a,0x21,0xa,0x20,0x2a,0x20,0x43,0x68,0x61,0x72,0x74,0x2e,0x6a,0x73,0xa,0x20,0x2a,0x20,0x68,0x74,0x74,0x70,0x3a,0x2f,0x2f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x2e,0x6f,0x72,0x67,0x2f,0xa,0x20,0x2a,0x20,0x56,0x65,0x72,0x73,0x69,0x6f,0x6e,0x3a,0x20,0x32,0x2e,0x37,0x2e,0x31,0xa,0x20,0x2a,0xa,0x20,0x2a,0x20,0x43,0x6f,0x70,0x79,0x72,0x69,0x67,0x68,0x74,0x20,0x32,0x30,0x31,0x37,0x20,0x4e,0x69,0x63,0x6b,0x20,0x44,0x6f,0x77,0x6e,0x69,0x65,0xa,0x20,0x2a,0x20,0x52,0x65,0x6c,0x65,0x61,0x73,0x65,0x64,0x20,0x75,0x6e,0x64,0x65,0x72,0x20,0x74,0x68,0x65,0x20,0x4d,0x49,0x54,0x20,0x6c,0x69,0x63,0x65,0x6e,0x73,0x65,0xa,0x20,0x2a,0x20,0x68,0x74,0x74,0x70,0x73,0x3a,0x2f,0x2f,0x67,0x69,0x74,0x68,0x75,0x62,0x2e,0x63,0x6f,0x6d,0x2f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x2f,0x43,0x68,0x61,0x72,0x74,0x2e,0x6a,0x73,0x2f,0x62,0x6c,0x6f,0x62,0x2f,0x6d,0x61,0x73,0x74,0x65,0x72,0x2f,0x4c,0x49,0x43,0x45,0x4e,0x53,0x45,0x2e,0x6d,0x64,0xa,0x20,0x2a,0x2f,0xa,0x21,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x26,0x26,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6d,0x6f,0x64,0x75,0x6c,0x65,0x29,0x6d,0x6f,0x64,0x75,0x6c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x74,0x28,0x29,0x3b,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x26,0x26,0x64,0x65,0x66,0x69,0x6e,0x65,0x2e,0x61,0x6d,0x64,0x29,0x64,0x65,0x66,0x69,0x6e,0x65,0x28,0x5b,0x5d,0x2c,0x74,0x29,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x28,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x3f,0x77,0x69,0x6e,0x64,0x6f,0x77,0x3a,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x3f,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x3a,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x73,0x65,0x6c,0x66,0x3f,0x73,0x65,0x6c,0x66,0x3a,0x74,0x68,0x69,0x73,0x29,0x2e,0x43,0x68,0x61,0x72,0x74,0x3d,0x74,0x28,0x29,0x7d,0x7d,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x74,0x28,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x72,0x2c,0x6c,0x29,0x7b,0x69,0x66,0x28,0x21,0x6e,0x5b,0x72,0x5d,0x29,0x7b,0x69,0x66,0x28,0x21,0x65,0x5b,0x72,0x5d,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x65,0x71,0x75,0x69,0x72,0x65,0x26,0x26,0x72,0x65,0x71,0x75,0x69,0x72,0x65,0x3b,0x69,0x66,0x28,0x21,0x6c,0x26,0x26,0x73,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x28,0x72,0x2c,0x21,0x30,0x29,0x3b,0x69,0x66,0x28,0x6f,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x72,0x2c,0x21,0x30,0x29,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x6e,0x65,0x77,0x20,0x45,0x72,0x72,0x6f,0x72,0x28,0x22,0x43,0x61,0x6e,0x6e,0x6f,0x74,0x20,0x66,0x69,0x6e,0x64,0x20,0x6d,0x6f,0x64,0x75,0x6c,0x65,0x20,0x27,0x22,0x2b,0x72,0x2b,0x22,0x27,0x22,0x29,0x3b,0x74,0x68,0x72,0x6f,0x77,0x20,0x75,0x2e,0x63,0x6f,0x64,0x65,0x3d,0x22,0x4d,0x4f,0x44,0x55,0x4c,0x45,0x5f,0x4e,0x4f,0x54,0x5f,0x46,0x4f,0x55,0x4e,0x44,0x22,0x2c,0x75,0x7d,0x76,0x61,0x72,0x20,0x64,0x3d,0x6e,0x5b,0x72,0x5d,0x3d,0x7b,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3a,0x7b,0x7d,0x7d,0x3b,0x65,0x5b,0x72,0x5d,0x5b,0x30,0x5d,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x64,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x5b,0x72,0x5d,0x5b,0x31,0x5d,0x5b,0x74,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x6e,0x7c,0x7c,0x74,0x29,0x7d,0x2c,0x64,0x2c,0x64,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2c,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x5b,0x72,0x5d,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x7d,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6f,0x3d,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x65,0x71,0x75,0x69,0x72,0x65,0x26,0x26,0x72,0x65,0x71,0x75,0x69,0x72,0x65,0x2c,0x72,0x3d,0x30,0x3b,0x72,0x3c,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x72,0x2b,0x2b,0x29,0x61,0x28,0x69,0x5b,0x72,0x5d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x7d,0x28,0x7b,0x31,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x32,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x6e,0x3d,0x31,0x2c,0x69,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x23,0x28,0x5b,0x61,0x2d,0x66,0x41,0x2d,0x46,0x30,0x2d,0x39,0x5d,0x7b,0x33,0x7d,0x29,0x24,0x2f,0x69,0x29,0x3b,0x69,0x66,0x28,0x69,0x29,0x7b,0x69,0x3d,0x69,0x5b,0x31,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x2b,0x2b,0x29,0x65,0x5b,0x61,0x5d,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x69,0x5b,0x61,0x5d,0x2b,0x69,0x5b,0x61,0x5d,0x2c,0x31,0x36,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x69,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x23,0x28,0x5b,0x61,0x2d,0x66,0x41,0x2d,0x46,0x30,0x2d,0x39,0x5d,0x7b,0x36,0x7d,0x29,0x24,0x2f,0x69,0x29,0x29,0x7b,0x69,0x3d,0x69,0x5b,0x31,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x2b,0x2b,0x29,0x65,0x5b,0x61,0x5d,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x69,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x32,0x2a,0x61,0x2c,0x32,0x2a,0x61,0x2b,0x32,0x29,0x2c,0x31,0x36,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x69,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x72,0x67,0x62,0x61,0x3f,0x5c,0x28,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5c,0x64,0x2b,0x29,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5c,0x64,0x2b,0x29,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5c,0x64,0x2b,0x29,0x5c,0x73,0x2a,0x28,0x3f,0x3a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x73,0x2a,0x29,0x3f,0x5c,0x29,0x24,0x2f,0x69,0x29,0x29,0x7b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x2b,0x2b,0x29,0x65,0x5b,0x61,0x5d,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x69,0x5b,0x61,0x2b,0x31,0x5d,0x29,0x3b,0x6e,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x69,0x5b,0x34,0x5d,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x69,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x72,0x67,0x62,0x61,0x3f,0x5c,0x28,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x25,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x25,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x25,0x5c,0x73,0x2a,0x28,0x3f,0x3a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x73,0x2a,0x29,0x3f,0x5c,0x29,0x24,0x2f,0x69,0x29,0x29,0x7b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x2b,0x2b,0x29,0x65,0x5b,0x61,0x5d,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x32,0x2e,0x35,0x35,0x2a,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x69,0x5b,0x61,0x2b,0x31,0x5d,0x29,0x29,0x3b,0x6e,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x69,0x5b,0x34,0x5d,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x69,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x28,0x5c,0x77,0x2b,0x29,0x2f,0x29,0x29,0x7b,0x69,0x66,0x28,0x22,0x74,0x72,0x61,0x6e,0x73,0x70,0x61,0x72,0x65,0x6e,0x74,0x22,0x3d,0x3d,0x69,0x5b,0x31,0x5d,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x3b,0x69,0x66,0x28,0x21,0x28,0x65,0x3d,0x63,0x5b,0x69,0x5b,0x31,0x5d,0x5d,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x7d,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x2b,0x2b,0x29,0x65,0x5b,0x61,0x5d,0x3d,0x75,0x28,0x65,0x5b,0x61,0x5d,0x2c,0x30,0x2c,0x32,0x35,0x35,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3d,0x6e,0x7c,0x7c,0x30,0x3d,0x3d,0x6e,0x3f,0x75,0x28,0x6e,0x2c,0x30,0x2c,0x31,0x29,0x3a,0x31,0x2c,0x65,0x5b,0x33,0x5d,0x3d,0x6e,0x2c,0x65,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x68,0x73,0x6c,0x61,0x3f,0x5c,0x28,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5c,0x64,0x2b,0x29,0x28,0x3f,0x3a,0x64,0x65,0x67,0x29,0x3f,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x25,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x25,0x5c,0x73,0x2a,0x28,0x3f,0x3a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x73,0x2a,0x29,0x3f,0x5c,0x29,0x2f,0x29,0x3b,0x69,0x66,0x28,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x65,0x5b,0x34,0x5d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x75,0x28,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x65,0x5b,0x31,0x5d,0x29,0x2c,0x30,0x2c,0x33,0x36,0x30,0x29,0x2c,0x75,0x28,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x65,0x5b,0x32,0x5d,0x29,0x2c,0x30,0x2c,0x31,0x30,0x30,0x29,0x2c,0x75,0x28,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x65,0x5b,0x33,0x5d,0x29,0x2c,0x30,0x2c,0x31,0x30,0x30,0x29,0x2c,0x75,0x28,0x69,0x73,0x4e,0x61,0x4e,0x28,0x6e,0x29,0x3f,0x31,0x3a,0x6e,0x2c,0x30,0x2c,0x31,0x29,0x5d,0x7d,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6f,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x68,0x77,0x62,0x5c,0x28,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5c,0x64,0x2b,0x29,0x28,0x3f,0x3a,0x64,0x65,0x67,0x29,0x3f,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x25,0x5c,0x73,0x2a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x25,0x5c,0x73,0x2a,0x28,0x3f,0x3a,0x2c,0x5c,0x73,0x2a,0x28,0x5b,0x2b,0x2d,0x5d,0x3f,0x5b,0x5c,0x64,0x5c,0x2e,0x5d,0x2b,0x29,0x5c,0x73,0x2a,0x29,0x3f,0x5c,0x29,0x2f,0x29,0x3b,0x69,0x66,0x28,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x65,0x5b,0x34,0x5d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x75,0x28,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x65,0x5b,0x31,0x5d,0x29,0x2c,0x30,0x2c,0x33,0x36,0x30,0x29,0x2c,0x75,0x28,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x65,0x5b,0x32,0x5d,0x29,0x2c,0x30,0x2c,0x31,0x30,0x30,0x29,0x2c,0x75,0x28,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x65,0x5b,0x33,0x5d,0x29,0x2c,0x30,0x2c,0x31,0x30,0x30,0x29,0x2c,0x75,0x28,0x69,0x73,0x4e,0x61,0x4e,0x28,0x6e,0x29,0x3f,0x31,0x3a,0x6e,0x2c,0x30,0x2c,0x31,0x29,0x5d,0x7d,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x26,0x26,0x28,0x65,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x5b,0x33,0x5d,0x3f,0x74,0x5b,0x33,0x5d,0x3a,0x31,0x29,0x2c,0x22,0x72,0x67,0x62,0x61,0x28,0x22,0x2b,0x74,0x5b,0x30,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x31,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x32,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x65,0x2b,0x22,0x29,0x22,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x72,0x67,0x62,0x61,0x28,0x22,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x5b,0x30,0x5d,0x2f,0x32,0x35,0x35,0x2a,0x31,0x30,0x30,0x29,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x5b,0x31,0x5d,0x2f,0x32,0x35,0x35,0x2a,0x31,0x30,0x30,0x29,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x5b,0x32,0x5d,0x2f,0x32,0x35,0x35,0x2a,0x31,0x30,0x30,0x29,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x28,0x65,0x7c,0x7c,0x74,0x5b,0x33,0x5d,0x7c,0x7c,0x31,0x29,0x2b,0x22,0x29,0x22,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x26,0x26,0x28,0x65,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x5b,0x33,0x5d,0x3f,0x74,0x5b,0x33,0x5d,0x3a,0x31,0x29,0x2c,0x22,0x68,0x73,0x6c,0x61,0x28,0x22,0x2b,0x74,0x5b,0x30,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x31,0x5d,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x32,0x5d,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x65,0x2b,0x22,0x29,0x22,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2c,0x74,0x29,0x2c,0x6e,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x64,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x74,0x6f,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x31,0x36,0x29,0x2e,0x74,0x6f,0x55,0x70,0x70,0x65,0x72,0x43,0x61,0x73,0x65,0x28,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3c,0x32,0x3f,0x22,0x30,0x22,0x2b,0x65,0x3a,0x65,0x7d,0x76,0x61,0x72,0x20,0x63,0x3d,0x74,0x28,0x36,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x67,0x65,0x74,0x52,0x67,0x62,0x61,0x3a,0x69,0x2c,0x67,0x65,0x74,0x48,0x73,0x6c,0x61,0x3a,0x61,0x2c,0x67,0x65,0x74,0x52,0x67,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x69,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x26,0x26,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x33,0x29,0x7d,0x2c,0x67,0x65,0x74,0x48,0x73,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x61,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x26,0x26,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x33,0x29,0x7d,0x2c,0x67,0x65,0x74,0x48,0x77,0x62,0x3a,0x6f,0x2c,0x67,0x65,0x74,0x41,0x6c,0x70,0x68,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x69,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3f,0x65,0x5b,0x33,0x5d,0x3a,0x28,0x65,0x3d,0x61,0x28,0x74,0x29,0x29,0x3f,0x65,0x5b,0x33,0x5d,0x3a,0x28,0x65,0x3d,0x6f,0x28,0x74,0x29,0x29,0x3f,0x65,0x5b,0x33,0x5d,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x7d,0x2c,0x68,0x65,0x78,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x23,0x22,0x2b,0x64,0x28,0x74,0x5b,0x30,0x5d,0x29,0x2b,0x64,0x28,0x74,0x5b,0x31,0x5d,0x29,0x2b,0x64,0x28,0x74,0x5b,0x32,0x5d,0x29,0x7d,0x2c,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3c,0x31,0x7c,0x7c,0x74,0x5b,0x33,0x5d,0x26,0x26,0x74,0x5b,0x33,0x5d,0x3c,0x31,0x3f,0x72,0x28,0x74,0x2c,0x65,0x29,0x3a,0x22,0x72,0x67,0x62,0x28,0x22,0x2b,0x74,0x5b,0x30,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x31,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x32,0x5d,0x2b,0x22,0x29,0x22,0x7d,0x2c,0x72,0x67,0x62,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x72,0x2c,0x70,0x65,0x72,0x63,0x65,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3c,0x31,0x7c,0x7c,0x74,0x5b,0x33,0x5d,0x26,0x26,0x74,0x5b,0x33,0x5d,0x3c,0x31,0x3f,0x6c,0x28,0x74,0x2c,0x65,0x29,0x3a,0x22,0x72,0x67,0x62,0x28,0x22,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x5b,0x30,0x5d,0x2f,0x32,0x35,0x35,0x2a,0x31,0x30,0x30,0x29,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x5b,0x31,0x5d,0x2f,0x32,0x35,0x35,0x2a,0x31,0x30,0x30,0x29,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x5b,0x32,0x5d,0x2f,0x32,0x35,0x35,0x2a,0x31,0x30,0x30,0x29,0x2b,0x22,0x25,0x29,0x22,0x7d,0x2c,0x70,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x6c,0x2c,0x68,0x73,0x6c,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3c,0x31,0x7c,0x7c,0x74,0x5b,0x33,0x5d,0x26,0x26,0x74,0x5b,0x33,0x5d,0x3c,0x31,0x3f,0x73,0x28,0x74,0x2c,0x65,0x29,0x3a,0x22,0x68,0x73,0x6c,0x28,0x22,0x2b,0x74,0x5b,0x30,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x31,0x5d,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x32,0x5d,0x2b,0x22,0x25,0x29,0x22,0x7d,0x2c,0x68,0x73,0x6c,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x73,0x2c,0x68,0x77,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x26,0x26,0x28,0x65,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x5b,0x33,0x5d,0x3f,0x74,0x5b,0x33,0x5d,0x3a,0x31,0x29,0x2c,0x22,0x68,0x77,0x62,0x28,0x22,0x2b,0x74,0x5b,0x30,0x5d,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x31,0x5d,0x2b,0x22,0x25,0x2c,0x20,0x22,0x2b,0x74,0x5b,0x32,0x5d,0x2b,0x22,0x25,0x22,0x2b,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x26,0x26,0x31,0x21,0x3d,0x3d,0x65,0x3f,0x22,0x2c,0x20,0x22,0x2b,0x65,0x3a,0x22,0x22,0x29,0x2b,0x22,0x29,0x22,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x68,0x5b,0x74,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x33,0x29,0x5d,0x7d,0x7d,0x3b,0x76,0x61,0x72,0x20,0x68,0x3d,0x7b,0x7d,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x66,0x20,0x69,0x6e,0x20,0x63,0x29,0x68,0x5b,0x63,0x5b,0x66,0x5d,0x5d,0x3d,0x66,0x7d,0x2c,0x7b,0x36,0x3a,0x36,0x7d,0x5d,0x2c,0x33,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x29,0x2c,0x6f,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x6f,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3b,0x69,0x66,0x28,0x21,0x28,0x74,0x68,0x69,0x73,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x6f,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x65,0x77,0x20,0x6f,0x28,0x74,0x29,0x3b,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x69,0x64,0x3d,0x21,0x31,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x3d,0x7b,0x72,0x67,0x62,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x68,0x73,0x6c,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x68,0x73,0x76,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x68,0x77,0x62,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x63,0x6d,0x79,0x6b,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x61,0x6c,0x70,0x68,0x61,0x3a,0x31,0x7d,0x3b,0x76,0x61,0x72,0x20,0x65,0x3b,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x3f,0x28,0x65,0x3d,0x61,0x2e,0x67,0x65,0x74,0x52,0x67,0x62,0x61,0x28,0x74,0x29,0x29,0x3f,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x65,0x29,0x3a,0x28,0x65,0x3d,0x61,0x2e,0x67,0x65,0x74,0x48,0x73,0x6c,0x61,0x28,0x74,0x29,0x29,0x3f,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x3a,0x28,0x65,0x3d,0x61,0x2e,0x67,0x65,0x74,0x48,0x77,0x62,0x28,0x74,0x29,0x29,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x65,0x29,0x3a,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x26,0x26,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x28,0x65,0x3d,0x74,0x29,0x2e,0x72,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x72,0x65,0x64,0x3f,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x65,0x29,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6c,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6c,0x69,0x67,0x68,0x74,0x6e,0x65,0x73,0x73,0x3f,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x76,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x76,0x61,0x6c,0x75,0x65,0x3f,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x76,0x22,0x2c,0x65,0x29,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x77,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x77,0x68,0x69,0x74,0x65,0x6e,0x65,0x73,0x73,0x3f,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x65,0x29,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x2e,0x63,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x2e,0x63,0x79,0x61,0x6e,0x7c,0x7c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x65,0x29,0x29,0x7d,0x3b,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x3d,0x7b,0x69,0x73,0x56,0x61,0x6c,0x69,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x69,0x64,0x7d,0x2c,0x72,0x67,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x53,0x70,0x61,0x63,0x65,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x53,0x70,0x61,0x63,0x65,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x68,0x73,0x76,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x53,0x70,0x61,0x63,0x65,0x28,0x22,0x68,0x73,0x76,0x22,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x68,0x77,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x53,0x70,0x61,0x63,0x65,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x63,0x6d,0x79,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x53,0x70,0x61,0x63,0x65,0x28,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x72,0x67,0x62,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x7d,0x2c,0x68,0x73,0x6c,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x7d,0x2c,0x68,0x73,0x76,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x76,0x7d,0x2c,0x68,0x77,0x62,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x21,0x3d,0x3d,0x74,0x2e,0x61,0x6c,0x70,0x68,0x61,0x3f,0x74,0x2e,0x68,0x77,0x62,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x5b,0x74,0x2e,0x61,0x6c,0x70,0x68,0x61,0x5d,0x29,0x3a,0x74,0x2e,0x68,0x77,0x62,0x7d,0x2c,0x63,0x6d,0x79,0x6b,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x63,0x6d,0x79,0x6b,0x7d,0x2c,0x72,0x67,0x62,0x61,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x72,0x67,0x62,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x5b,0x74,0x2e,0x61,0x6c,0x70,0x68,0x61,0x5d,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x61,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x68,0x73,0x6c,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x5b,0x74,0x2e,0x61,0x6c,0x70,0x68,0x61,0x5d,0x29,0x7d,0x2c,0x61,0x6c,0x70,0x68,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x3a,0x28,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x61,0x6c,0x70,0x68,0x61,0x22,0x2c,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x72,0x65,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x30,0x2c,0x74,0x29,0x7d,0x2c,0x67,0x72,0x65,0x65,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x31,0x2c,0x74,0x29,0x7d,0x2c,0x62,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x32,0x2c,0x74,0x29,0x7d,0x2c,0x68,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x26,0x26,0x28,0x74,0x3d,0x28,0x74,0x25,0x3d,0x33,0x36,0x30,0x29,0x3c,0x30,0x3f,0x33,0x36,0x30,0x2b,0x74,0x3a,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x30,0x2c,0x74,0x29,0x7d,0x2c,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x31,0x2c,0x74,0x29,0x7d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x6e,0x65,0x73,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x32,0x2c,0x74,0x29,0x7d,0x2c,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x76,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x73,0x76,0x22,0x2c,0x31,0x2c,0x74,0x29,0x7d,0x2c,0x77,0x68,0x69,0x74,0x65,0x6e,0x65,0x73,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x31,0x2c,0x74,0x29,0x7d,0x2c,0x62,0x6c,0x61,0x63,0x6b,0x6e,0x65,0x73,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x32,0x2c,0x74,0x29,0x7d,0x2c,0x76,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x68,0x73,0x76,0x22,0x2c,0x32,0x2c,0x74,0x29,0x7d,0x2c,0x63,0x79,0x61,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x30,0x2c,0x74,0x29,0x7d,0x2c,0x6d,0x61,0x67,0x65,0x6e,0x74,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x31,0x2c,0x74,0x29,0x7d,0x2c,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x32,0x2c,0x74,0x29,0x7d,0x2c,0x62,0x6c,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x28,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x33,0x2c,0x74,0x29,0x7d,0x2c,0x68,0x65,0x78,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x68,0x65,0x78,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x29,0x7d,0x2c,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x72,0x67,0x62,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x72,0x67,0x62,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x70,0x65,0x72,0x63,0x65,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x70,0x65,0x72,0x63,0x65,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x68,0x73,0x6c,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x68,0x73,0x6c,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x68,0x77,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x68,0x77,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x77,0x62,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x2c,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x7d,0x2c,0x72,0x67,0x62,0x4e,0x75,0x6d,0x62,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x5b,0x30,0x5d,0x3c,0x3c,0x31,0x36,0x7c,0x74,0x5b,0x31,0x5d,0x3c,0x3c,0x38,0x7c,0x74,0x5b,0x32,0x5d,0x7d,0x2c,0x6c,0x75,0x6d,0x69,0x6e,0x6f,0x73,0x69,0x74,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x2c,0x65,0x3d,0x5b,0x5d,0x2c,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x2b,0x2b,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x5b,0x6e,0x5d,0x2f,0x32,0x35,0x35,0x3b,0x65,0x5b,0x6e,0x5d,0x3d,0x69,0x3c,0x3d,0x2e,0x30,0x33,0x39,0x32,0x38,0x3f,0x69,0x2f,0x31,0x32,0x2e,0x39,0x32,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x28,0x69,0x2b,0x2e,0x30,0x35,0x35,0x29,0x2f,0x31,0x2e,0x30,0x35,0x35,0x2c,0x32,0x2e,0x34,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x2e,0x32,0x31,0x32,0x36,0x2a,0x65,0x5b,0x30,0x5d,0x2b,0x2e,0x37,0x31,0x35,0x32,0x2a,0x65,0x5b,0x31,0x5d,0x2b,0x2e,0x30,0x37,0x32,0x32,0x2a,0x65,0x5b,0x32,0x5d,0x7d,0x2c,0x63,0x6f,0x6e,0x74,0x72,0x61,0x73,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6c,0x75,0x6d,0x69,0x6e,0x6f,0x73,0x69,0x74,0x79,0x28,0x29,0x2c,0x6e,0x3d,0x74,0x2e,0x6c,0x75,0x6d,0x69,0x6e,0x6f,0x73,0x69,0x74,0x79,0x28,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3e,0x6e,0x3f,0x28,0x65,0x2b,0x2e,0x30,0x35,0x29,0x2f,0x28,0x6e,0x2b,0x2e,0x30,0x35,0x29,0x3a,0x28,0x6e,0x2b,0x2e,0x30,0x35,0x29,0x2f,0x28,0x65,0x2b,0x2e,0x30,0x35,0x29,0x7d,0x2c,0x6c,0x65,0x76,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x61,0x73,0x74,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3e,0x3d,0x37,0x2e,0x31,0x3f,0x22,0x41,0x41,0x41,0x22,0x3a,0x65,0x3e,0x3d,0x34,0x2e,0x35,0x3f,0x22,0x41,0x41,0x22,0x3a,0x22,0x22,0x7d,0x2c,0x64,0x61,0x72,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x32,0x39,0x39,0x2a,0x74,0x5b,0x30,0x5d,0x2b,0x35,0x38,0x37,0x2a,0x74,0x5b,0x31,0x5d,0x2b,0x31,0x31,0x34,0x2a,0x74,0x5b,0x32,0x5d,0x29,0x2f,0x31,0x65,0x33,0x3c,0x31,0x32,0x38,0x7d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x74,0x68,0x69,0x73,0x2e,0x64,0x61,0x72,0x6b,0x28,0x29,0x7d,0x2c,0x6e,0x65,0x67,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x74,0x3d,0x5b,0x5d,0x2c,0x65,0x3d,0x30,0x3b,0x65,0x3c,0x33,0x3b,0x65,0x2b,0x2b,0x29,0x74,0x5b,0x65,0x5d,0x3d,0x32,0x35,0x35,0x2d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x5b,0x65,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x65,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x32,0x5d,0x2b,0x3d,0x65,0x5b,0x32,0x5d,0x2a,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x64,0x61,0x72,0x6b,0x65,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x32,0x5d,0x2d,0x3d,0x65,0x5b,0x32,0x5d,0x2a,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x31,0x5d,0x2b,0x3d,0x65,0x5b,0x31,0x5d,0x2a,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x64,0x65,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x31,0x5d,0x2d,0x3d,0x65,0x5b,0x31,0x5d,0x2a,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x77,0x68,0x69,0x74,0x65,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x77,0x62,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x31,0x5d,0x2b,0x3d,0x65,0x5b,0x31,0x5d,0x2a,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x62,0x6c,0x61,0x63,0x6b,0x65,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x77,0x62,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x32,0x5d,0x2b,0x3d,0x65,0x5b,0x32,0x5d,0x2a,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x77,0x62,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x67,0x72,0x65,0x79,0x73,0x63,0x61,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x72,0x67,0x62,0x2c,0x65,0x3d,0x2e,0x33,0x2a,0x74,0x5b,0x30,0x5d,0x2b,0x2e,0x35,0x39,0x2a,0x74,0x5b,0x31,0x5d,0x2b,0x2e,0x31,0x31,0x2a,0x74,0x5b,0x32,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x72,0x67,0x62,0x22,0x2c,0x5b,0x65,0x2c,0x65,0x2c,0x65,0x5d,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x63,0x6c,0x65,0x61,0x72,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x61,0x6c,0x70,0x68,0x61,0x22,0x2c,0x65,0x2d,0x65,0x2a,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x6f,0x70,0x61,0x71,0x75,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x61,0x6c,0x70,0x68,0x61,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x61,0x6c,0x70,0x68,0x61,0x22,0x2c,0x65,0x2b,0x65,0x2a,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x72,0x6f,0x74,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2e,0x68,0x73,0x6c,0x2c,0x6e,0x3d,0x28,0x65,0x5b,0x30,0x5d,0x2b,0x74,0x29,0x25,0x33,0x36,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x5b,0x30,0x5d,0x3d,0x6e,0x3c,0x30,0x3f,0x33,0x36,0x30,0x2b,0x6e,0x3a,0x6e,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x22,0x68,0x73,0x6c,0x22,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x6d,0x69,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x74,0x2c,0x61,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x3f,0x2e,0x35,0x3a,0x65,0x2c,0x6f,0x3d,0x32,0x2a,0x61,0x2d,0x31,0x2c,0x72,0x3d,0x6e,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x29,0x2d,0x69,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x29,0x2c,0x6c,0x3d,0x28,0x28,0x6f,0x2a,0x72,0x3d,0x3d,0x2d,0x31,0x3f,0x6f,0x3a,0x28,0x6f,0x2b,0x72,0x29,0x2f,0x28,0x31,0x2b,0x6f,0x2a,0x72,0x29,0x29,0x2b,0x31,0x29,0x2f,0x32,0x2c,0x73,0x3d,0x31,0x2d,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x72,0x67,0x62,0x28,0x6c,0x2a,0x6e,0x2e,0x72,0x65,0x64,0x28,0x29,0x2b,0x73,0x2a,0x69,0x2e,0x72,0x65,0x64,0x28,0x29,0x2c,0x6c,0x2a,0x6e,0x2e,0x67,0x72,0x65,0x65,0x6e,0x28,0x29,0x2b,0x73,0x2a,0x69,0x2e,0x67,0x72,0x65,0x65,0x6e,0x28,0x29,0x2c,0x6c,0x2a,0x6e,0x2e,0x62,0x6c,0x75,0x65,0x28,0x29,0x2b,0x73,0x2a,0x69,0x2e,0x62,0x6c,0x75,0x65,0x28,0x29,0x29,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x6e,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x29,0x2a,0x61,0x2b,0x69,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x29,0x2a,0x28,0x31,0x2d,0x61,0x29,0x29,0x7d,0x2c,0x74,0x6f,0x4a,0x53,0x4f,0x4e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x72,0x67,0x62,0x28,0x29,0x7d,0x2c,0x63,0x6c,0x6f,0x6e,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x3d,0x6e,0x65,0x77,0x20,0x6f,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x72,0x20,0x69,0x6e,0x20,0x69,0x29,0x69,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x72,0x29,0x26,0x26,0x28,0x74,0x3d,0x69,0x5b,0x72,0x5d,0x2c,0x22,0x5b,0x6f,0x62,0x6a,0x65,0x63,0x74,0x20,0x41,0x72,0x72,0x61,0x79,0x5d,0x22,0x3d,0x3d,0x3d,0x28,0x65,0x3d,0x7b,0x7d,0x2e,0x74,0x6f,0x53,0x74,0x72,0x69,0x6e,0x67,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x29,0x29,0x3f,0x61,0x5b,0x72,0x5d,0x3d,0x74,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x29,0x3a,0x22,0x5b,0x6f,0x62,0x6a,0x65,0x63,0x74,0x20,0x4e,0x75,0x6d,0x62,0x65,0x72,0x5d,0x22,0x3d,0x3d,0x3d,0x65,0x3f,0x61,0x5b,0x72,0x5d,0x3d,0x74,0x3a,0x63,0x6f,0x6e,0x73,0x6f,0x6c,0x65,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x75,0x6e,0x65,0x78,0x70,0x65,0x63,0x74,0x65,0x64,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x20,0x76,0x61,0x6c,0x75,0x65,0x3a,0x22,0x2c,0x74,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x7d,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x70,0x61,0x63,0x65,0x73,0x3d,0x7b,0x72,0x67,0x62,0x3a,0x5b,0x22,0x72,0x65,0x64,0x22,0x2c,0x22,0x67,0x72,0x65,0x65,0x6e,0x22,0x2c,0x22,0x62,0x6c,0x75,0x65,0x22,0x5d,0x2c,0x68,0x73,0x6c,0x3a,0x5b,0x22,0x68,0x75,0x65,0x22,0x2c,0x22,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x22,0x2c,0x22,0x6c,0x69,0x67,0x68,0x74,0x6e,0x65,0x73,0x73,0x22,0x5d,0x2c,0x68,0x73,0x76,0x3a,0x5b,0x22,0x68,0x75,0x65,0x22,0x2c,0x22,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x22,0x2c,0x22,0x76,0x61,0x6c,0x75,0x65,0x22,0x5d,0x2c,0x68,0x77,0x62,0x3a,0x5b,0x22,0x68,0x75,0x65,0x22,0x2c,0x22,0x77,0x68,0x69,0x74,0x65,0x6e,0x65,0x73,0x73,0x22,0x2c,0x22,0x62,0x6c,0x61,0x63,0x6b,0x6e,0x65,0x73,0x73,0x22,0x5d,0x2c,0x63,0x6d,0x79,0x6b,0x3a,0x5b,0x22,0x63,0x79,0x61,0x6e,0x22,0x2c,0x22,0x6d,0x61,0x67,0x65,0x6e,0x74,0x61,0x22,0x2c,0x22,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x22,0x2c,0x22,0x62,0x6c,0x61,0x63,0x6b,0x22,0x5d,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x6d,0x61,0x78,0x65,0x73,0x3d,0x7b,0x72,0x67,0x62,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x68,0x73,0x6c,0x3a,0x5b,0x33,0x36,0x30,0x2c,0x31,0x30,0x30,0x2c,0x31,0x30,0x30,0x5d,0x2c,0x68,0x73,0x76,0x3a,0x5b,0x33,0x36,0x30,0x2c,0x31,0x30,0x30,0x2c,0x31,0x30,0x30,0x5d,0x2c,0x68,0x77,0x62,0x3a,0x5b,0x33,0x36,0x30,0x2c,0x31,0x30,0x30,0x2c,0x31,0x30,0x30,0x5d,0x2c,0x63,0x6d,0x79,0x6b,0x3a,0x5b,0x31,0x30,0x30,0x2c,0x31,0x30,0x30,0x2c,0x31,0x30,0x30,0x2c,0x31,0x30,0x30,0x5d,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2c,0x6e,0x3d,0x7b,0x7d,0x2c,0x69,0x3d,0x30,0x3b,0x69,0x3c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x2b,0x2b,0x29,0x6e,0x5b,0x74,0x2e,0x63,0x68,0x61,0x72,0x41,0x74,0x28,0x69,0x29,0x5d,0x3d,0x65,0x5b,0x74,0x5d,0x5b,0x69,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x21,0x3d,0x3d,0x65,0x2e,0x61,0x6c,0x70,0x68,0x61,0x26,0x26,0x28,0x6e,0x2e,0x61,0x3d,0x65,0x2e,0x61,0x6c,0x70,0x68,0x61,0x29,0x2c,0x6e,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x61,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2c,0x6f,0x3d,0x74,0x68,0x69,0x73,0x2e,0x73,0x70,0x61,0x63,0x65,0x73,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6d,0x61,0x78,0x65,0x73,0x2c,0x6c,0x3d,0x31,0x3b,0x69,0x66,0x28,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x69,0x64,0x3d,0x21,0x30,0x2c,0x22,0x61,0x6c,0x70,0x68,0x61,0x22,0x3d,0x3d,0x3d,0x74,0x29,0x6c,0x3d,0x65,0x3b,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x61,0x5b,0x74,0x5d,0x3d,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x2c,0x6c,0x3d,0x65,0x5b,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x5d,0x3b,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x5b,0x74,0x2e,0x63,0x68,0x61,0x72,0x41,0x74,0x28,0x30,0x29,0x5d,0x29,0x7b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x2b,0x2b,0x29,0x61,0x5b,0x74,0x5d,0x5b,0x6e,0x5d,0x3d,0x65,0x5b,0x74,0x2e,0x63,0x68,0x61,0x72,0x41,0x74,0x28,0x6e,0x29,0x5d,0x3b,0x6c,0x3d,0x65,0x2e,0x61,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x5b,0x6f,0x5b,0x74,0x5d,0x5b,0x30,0x5d,0x5d,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x6f,0x5b,0x74,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x2b,0x2b,0x29,0x61,0x5b,0x74,0x5d,0x5b,0x6e,0x5d,0x3d,0x65,0x5b,0x73,0x5b,0x6e,0x5d,0x5d,0x3b,0x6c,0x3d,0x65,0x2e,0x61,0x6c,0x70,0x68,0x61,0x7d,0x69,0x66,0x28,0x61,0x2e,0x61,0x6c,0x70,0x68,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x31,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6c,0x3f,0x61,0x2e,0x61,0x6c,0x70,0x68,0x61,0x3a,0x6c,0x29,0x29,0x2c,0x22,0x61,0x6c,0x70,0x68,0x61,0x22,0x3d,0x3d,0x3d,0x74,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x76,0x61,0x72,0x20,0x75,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x2b,0x2b,0x29,0x75,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x5b,0x74,0x5d,0x5b,0x6e,0x5d,0x2c,0x61,0x5b,0x74,0x5d,0x5b,0x6e,0x5d,0x29,0x29,0x2c,0x61,0x5b,0x74,0x5d,0x5b,0x6e,0x5d,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x75,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x64,0x20,0x69,0x6e,0x20,0x6f,0x29,0x64,0x21,0x3d,0x3d,0x74,0x26,0x26,0x28,0x61,0x5b,0x64,0x5d,0x3d,0x69,0x5b,0x74,0x5d,0x5b,0x64,0x5d,0x28,0x61,0x5b,0x74,0x5d,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x30,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x65,0x74,0x53,0x70,0x61,0x63,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x5b,0x30,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x3f,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x74,0x29,0x3a,0x28,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6e,0x26,0x26,0x28,0x6e,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x29,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x74,0x2c,0x6e,0x29,0x2c,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x65,0x74,0x43,0x68,0x61,0x6e,0x6e,0x65,0x6c,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x5b,0x74,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x3f,0x69,0x5b,0x65,0x5d,0x3a,0x6e,0x3d,0x3d,0x3d,0x69,0x5b,0x65,0x5d,0x3f,0x74,0x68,0x69,0x73,0x3a,0x28,0x69,0x5b,0x65,0x5d,0x3d,0x6e,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x74,0x2c,0x69,0x29,0x2c,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x26,0x26,0x28,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6f,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x6f,0x7d,0x2c,0x7b,0x32,0x3a,0x32,0x2c,0x35,0x3a,0x35,0x7d,0x5d,0x2c,0x34,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x72,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x61,0x2c,0x6f,0x2c,0x72,0x29,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x61,0x2c,0x6f,0x2c,0x72,0x29,0x2c,0x75,0x3d,0x73,0x2d,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x3d,0x3d,0x6c,0x3f,0x65,0x3d,0x30,0x3a,0x61,0x3d,0x3d,0x73,0x3f,0x65,0x3d,0x28,0x6f,0x2d,0x72,0x29,0x2f,0x75,0x3a,0x6f,0x3d,0x3d,0x73,0x3f,0x65,0x3d,0x32,0x2b,0x28,0x72,0x2d,0x61,0x29,0x2f,0x75,0x3a,0x72,0x3d,0x3d,0x73,0x26,0x26,0x28,0x65,0x3d,0x34,0x2b,0x28,0x61,0x2d,0x6f,0x29,0x2f,0x75,0x29,0x2c,0x28,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x36,0x30,0x2a,0x65,0x2c,0x33,0x36,0x30,0x29,0x29,0x3c,0x30,0x26,0x26,0x28,0x65,0x2b,0x3d,0x33,0x36,0x30,0x29,0x2c,0x69,0x3d,0x28,0x6c,0x2b,0x73,0x29,0x2f,0x32,0x2c,0x6e,0x3d,0x73,0x3d,0x3d,0x6c,0x3f,0x30,0x3a,0x69,0x3c,0x3d,0x2e,0x35,0x3f,0x75,0x2f,0x28,0x73,0x2b,0x6c,0x29,0x3a,0x75,0x2f,0x28,0x32,0x2d,0x73,0x2d,0x6c,0x29,0x2c,0x5b,0x65,0x2c,0x31,0x30,0x30,0x2a,0x6e,0x2c,0x31,0x30,0x30,0x2a,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x2c,0x72,0x3d,0x74,0x5b,0x32,0x5d,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x61,0x2c,0x6f,0x2c,0x72,0x29,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x61,0x2c,0x6f,0x2c,0x72,0x29,0x2c,0x75,0x3d,0x73,0x2d,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3d,0x30,0x3d,0x3d,0x73,0x3f,0x30,0x3a,0x75,0x2f,0x73,0x2a,0x31,0x65,0x33,0x2f,0x31,0x30,0x2c,0x73,0x3d,0x3d,0x6c,0x3f,0x65,0x3d,0x30,0x3a,0x61,0x3d,0x3d,0x73,0x3f,0x65,0x3d,0x28,0x6f,0x2d,0x72,0x29,0x2f,0x75,0x3a,0x6f,0x3d,0x3d,0x73,0x3f,0x65,0x3d,0x32,0x2b,0x28,0x72,0x2d,0x61,0x29,0x2f,0x75,0x3a,0x72,0x3d,0x3d,0x73,0x26,0x26,0x28,0x65,0x3d,0x34,0x2b,0x28,0x61,0x2d,0x6f,0x29,0x2f,0x75,0x29,0x2c,0x28,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x36,0x30,0x2a,0x65,0x2c,0x33,0x36,0x30,0x29,0x29,0x3c,0x30,0x26,0x26,0x28,0x65,0x2b,0x3d,0x33,0x36,0x30,0x29,0x2c,0x69,0x3d,0x73,0x2f,0x32,0x35,0x35,0x2a,0x31,0x65,0x33,0x2f,0x31,0x30,0x2c,0x5b,0x65,0x2c,0x6e,0x2c,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6f,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x6e,0x3d,0x74,0x5b,0x31,0x5d,0x2c,0x61,0x3d,0x74,0x5b,0x32,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x69,0x28,0x74,0x29,0x5b,0x30,0x5d,0x2c,0x31,0x30,0x30,0x2a,0x28,0x31,0x2f,0x32,0x35,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x65,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6e,0x2c,0x61,0x29,0x29,0x29,0x2c,0x31,0x30,0x30,0x2a,0x28,0x61,0x3d,0x31,0x2d,0x31,0x2f,0x32,0x35,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x6e,0x2c,0x61,0x29,0x29,0x29,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x72,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x6c,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x32,0x35,0x35,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x31,0x2d,0x6f,0x2c,0x31,0x2d,0x72,0x2c,0x31,0x2d,0x6c,0x29,0x2c,0x65,0x3d,0x28,0x31,0x2d,0x6f,0x2d,0x61,0x29,0x2f,0x28,0x31,0x2d,0x61,0x29,0x7c,0x7c,0x30,0x2c,0x6e,0x3d,0x28,0x31,0x2d,0x72,0x2d,0x61,0x29,0x2f,0x28,0x31,0x2d,0x61,0x29,0x7c,0x7c,0x30,0x2c,0x69,0x3d,0x28,0x31,0x2d,0x6c,0x2d,0x61,0x29,0x2f,0x28,0x31,0x2d,0x61,0x29,0x7c,0x7c,0x30,0x2c,0x5b,0x31,0x30,0x30,0x2a,0x65,0x2c,0x31,0x30,0x30,0x2a,0x6e,0x2c,0x31,0x30,0x30,0x2a,0x69,0x2c,0x31,0x30,0x30,0x2a,0x61,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x43,0x5b,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x74,0x29,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x6e,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x32,0x35,0x35,0x2c,0x69,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x32,0x35,0x35,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x31,0x30,0x30,0x2a,0x28,0x2e,0x34,0x31,0x32,0x34,0x2a,0x28,0x65,0x3d,0x65,0x3e,0x2e,0x30,0x34,0x30,0x34,0x35,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x28,0x65,0x2b,0x2e,0x30,0x35,0x35,0x29,0x2f,0x31,0x2e,0x30,0x35,0x35,0x2c,0x32,0x2e,0x34,0x29,0x3a,0x65,0x2f,0x31,0x32,0x2e,0x39,0x32,0x29,0x2b,0x2e,0x33,0x35,0x37,0x36,0x2a,0x28,0x6e,0x3d,0x6e,0x3e,0x2e,0x30,0x34,0x30,0x34,0x35,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x28,0x6e,0x2b,0x2e,0x30,0x35,0x35,0x29,0x2f,0x31,0x2e,0x30,0x35,0x35,0x2c,0x32,0x2e,0x34,0x29,0x3a,0x6e,0x2f,0x31,0x32,0x2e,0x39,0x32,0x29,0x2b,0x2e,0x31,0x38,0x30,0x35,0x2a,0x28,0x69,0x3d,0x69,0x3e,0x2e,0x30,0x34,0x30,0x34,0x35,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x28,0x69,0x2b,0x2e,0x30,0x35,0x35,0x29,0x2f,0x31,0x2e,0x30,0x35,0x35,0x2c,0x32,0x2e,0x34,0x29,0x3a,0x69,0x2f,0x31,0x32,0x2e,0x39,0x32,0x29,0x29,0x2c,0x31,0x30,0x30,0x2a,0x28,0x2e,0x32,0x31,0x32,0x36,0x2a,0x65,0x2b,0x2e,0x37,0x31,0x35,0x32,0x2a,0x6e,0x2b,0x2e,0x30,0x37,0x32,0x32,0x2a,0x69,0x29,0x2c,0x31,0x30,0x30,0x2a,0x28,0x2e,0x30,0x31,0x39,0x33,0x2a,0x65,0x2b,0x2e,0x31,0x31,0x39,0x32,0x2a,0x6e,0x2b,0x2e,0x39,0x35,0x30,0x35,0x2a,0x69,0x29,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x64,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x75,0x28,0x74,0x29,0x2c,0x6f,0x3d,0x61,0x5b,0x30,0x5d,0x2c,0x72,0x3d,0x61,0x5b,0x31,0x5d,0x2c,0x6c,0x3d,0x61,0x5b,0x32,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2f,0x3d,0x39,0x35,0x2e,0x30,0x34,0x37,0x2c,0x72,0x2f,0x3d,0x31,0x30,0x30,0x2c,0x6c,0x2f,0x3d,0x31,0x30,0x38,0x2e,0x38,0x38,0x33,0x2c,0x6f,0x3d,0x6f,0x3e,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6f,0x2c,0x31,0x2f,0x33,0x29,0x3a,0x37,0x2e,0x37,0x38,0x37,0x2a,0x6f,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x2c,0x72,0x3d,0x72,0x3e,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x72,0x2c,0x31,0x2f,0x33,0x29,0x3a,0x37,0x2e,0x37,0x38,0x37,0x2a,0x72,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x2c,0x6c,0x3d,0x6c,0x3e,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6c,0x2c,0x31,0x2f,0x33,0x29,0x3a,0x37,0x2e,0x37,0x38,0x37,0x2a,0x6c,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x2c,0x65,0x3d,0x31,0x31,0x36,0x2a,0x72,0x2d,0x31,0x36,0x2c,0x6e,0x3d,0x35,0x30,0x30,0x2a,0x28,0x6f,0x2d,0x72,0x29,0x2c,0x69,0x3d,0x32,0x30,0x30,0x2a,0x28,0x72,0x2d,0x6c,0x29,0x2c,0x5b,0x65,0x2c,0x6e,0x2c,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x63,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x33,0x36,0x30,0x2c,0x6c,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x73,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x3b,0x69,0x66,0x28,0x30,0x3d,0x3d,0x6c,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3d,0x32,0x35,0x35,0x2a,0x73,0x2c,0x5b,0x6f,0x2c,0x6f,0x2c,0x6f,0x5d,0x3b,0x65,0x3d,0x32,0x2a,0x73,0x2d,0x28,0x6e,0x3d,0x73,0x3c,0x2e,0x35,0x3f,0x73,0x2a,0x28,0x31,0x2b,0x6c,0x29,0x3a,0x73,0x2b,0x6c,0x2d,0x73,0x2a,0x6c,0x29,0x2c,0x61,0x3d,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x75,0x3d,0x30,0x3b,0x75,0x3c,0x33,0x3b,0x75,0x2b,0x2b,0x29,0x28,0x69,0x3d,0x72,0x2b,0x31,0x2f,0x33,0x2a,0x2d,0x28,0x75,0x2d,0x31,0x29,0x29,0x3c,0x30,0x26,0x26,0x69,0x2b,0x2b,0x2c,0x69,0x3e,0x31,0x26,0x26,0x69,0x2d,0x2d,0x2c,0x6f,0x3d,0x36,0x2a,0x69,0x3c,0x31,0x3f,0x65,0x2b,0x36,0x2a,0x28,0x6e,0x2d,0x65,0x29,0x2a,0x69,0x3a,0x32,0x2a,0x69,0x3c,0x31,0x3f,0x6e,0x3a,0x33,0x2a,0x69,0x3c,0x32,0x3f,0x65,0x2b,0x28,0x6e,0x2d,0x65,0x29,0x2a,0x28,0x32,0x2f,0x33,0x2d,0x69,0x29,0x2a,0x36,0x3a,0x65,0x2c,0x61,0x5b,0x75,0x5d,0x3d,0x32,0x35,0x35,0x2a,0x6f,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x68,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x36,0x30,0x2c,0x6e,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x69,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x65,0x29,0x25,0x36,0x2c,0x6f,0x3d,0x65,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x65,0x29,0x2c,0x72,0x3d,0x32,0x35,0x35,0x2a,0x69,0x2a,0x28,0x31,0x2d,0x6e,0x29,0x2c,0x6c,0x3d,0x32,0x35,0x35,0x2a,0x69,0x2a,0x28,0x31,0x2d,0x6e,0x2a,0x6f,0x29,0x2c,0x73,0x3d,0x32,0x35,0x35,0x2a,0x69,0x2a,0x28,0x31,0x2d,0x6e,0x2a,0x28,0x31,0x2d,0x6f,0x29,0x29,0x2c,0x69,0x3d,0x32,0x35,0x35,0x2a,0x69,0x3b,0x73,0x77,0x69,0x74,0x63,0x68,0x28,0x61,0x29,0x7b,0x63,0x61,0x73,0x65,0x20,0x30,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x69,0x2c,0x73,0x2c,0x72,0x5d,0x3b,0x63,0x61,0x73,0x65,0x20,0x31,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x6c,0x2c,0x69,0x2c,0x72,0x5d,0x3b,0x63,0x61,0x73,0x65,0x20,0x32,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x72,0x2c,0x69,0x2c,0x73,0x5d,0x3b,0x63,0x61,0x73,0x65,0x20,0x33,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x72,0x2c,0x6c,0x2c,0x69,0x5d,0x3b,0x63,0x61,0x73,0x65,0x20,0x34,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x73,0x2c,0x72,0x2c,0x69,0x5d,0x3b,0x63,0x61,0x73,0x65,0x20,0x35,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x69,0x2c,0x72,0x2c,0x6c,0x5d,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x66,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x33,0x36,0x30,0x2c,0x6c,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x73,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x75,0x3d,0x6c,0x2b,0x73,0x3b,0x73,0x77,0x69,0x74,0x63,0x68,0x28,0x75,0x3e,0x31,0x26,0x26,0x28,0x6c,0x2f,0x3d,0x75,0x2c,0x73,0x2f,0x3d,0x75,0x29,0x2c,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x36,0x2a,0x6f,0x29,0x2c,0x6e,0x3d,0x31,0x2d,0x73,0x2c,0x69,0x3d,0x36,0x2a,0x6f,0x2d,0x65,0x2c,0x30,0x21,0x3d,0x28,0x31,0x26,0x65,0x29,0x26,0x26,0x28,0x69,0x3d,0x31,0x2d,0x69,0x29,0x2c,0x61,0x3d,0x6c,0x2b,0x69,0x2a,0x28,0x6e,0x2d,0x6c,0x29,0x2c,0x65,0x29,0x7b,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x63,0x61,0x73,0x65,0x20,0x36,0x3a,0x63,0x61,0x73,0x65,0x20,0x30,0x3a,0x72,0x3d,0x6e,0x2c,0x67,0x3d,0x61,0x2c,0x62,0x3d,0x6c,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x20,0x31,0x3a,0x72,0x3d,0x61,0x2c,0x67,0x3d,0x6e,0x2c,0x62,0x3d,0x6c,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x20,0x32,0x3a,0x72,0x3d,0x6c,0x2c,0x67,0x3d,0x6e,0x2c,0x62,0x3d,0x61,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x20,0x33,0x3a,0x72,0x3d,0x6c,0x2c,0x67,0x3d,0x61,0x2c,0x62,0x3d,0x6e,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x20,0x34,0x3a,0x72,0x3d,0x61,0x2c,0x67,0x3d,0x6c,0x2c,0x62,0x3d,0x6e,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x20,0x35,0x3a,0x72,0x3d,0x6e,0x2c,0x67,0x3d,0x6c,0x2c,0x62,0x3d,0x61,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x32,0x35,0x35,0x2a,0x72,0x2c,0x32,0x35,0x35,0x2a,0x67,0x2c,0x32,0x35,0x35,0x2a,0x62,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x70,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x72,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x6c,0x3d,0x74,0x5b,0x33,0x5d,0x2f,0x31,0x30,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3d,0x31,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x31,0x2c,0x61,0x2a,0x28,0x31,0x2d,0x6c,0x29,0x2b,0x6c,0x29,0x2c,0x6e,0x3d,0x31,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x31,0x2c,0x6f,0x2a,0x28,0x31,0x2d,0x6c,0x29,0x2b,0x6c,0x29,0x2c,0x69,0x3d,0x31,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x31,0x2c,0x72,0x2a,0x28,0x31,0x2d,0x6c,0x29,0x2b,0x6c,0x29,0x2c,0x5b,0x32,0x35,0x35,0x2a,0x65,0x2c,0x32,0x35,0x35,0x2a,0x6e,0x2c,0x32,0x35,0x35,0x2a,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x76,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x72,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3d,0x33,0x2e,0x32,0x34,0x30,0x36,0x2a,0x61,0x2b,0x2d,0x31,0x2e,0x35,0x33,0x37,0x32,0x2a,0x6f,0x2b,0x2d,0x2e,0x34,0x39,0x38,0x36,0x2a,0x72,0x2c,0x6e,0x3d,0x2d,0x2e,0x39,0x36,0x38,0x39,0x2a,0x61,0x2b,0x31,0x2e,0x38,0x37,0x35,0x38,0x2a,0x6f,0x2b,0x2e,0x30,0x34,0x31,0x35,0x2a,0x72,0x2c,0x69,0x3d,0x2e,0x30,0x35,0x35,0x37,0x2a,0x61,0x2b,0x2d,0x2e,0x32,0x30,0x34,0x2a,0x6f,0x2b,0x31,0x2e,0x30,0x35,0x37,0x2a,0x72,0x2c,0x65,0x3d,0x65,0x3e,0x2e,0x30,0x30,0x33,0x31,0x33,0x30,0x38,0x3f,0x31,0x2e,0x30,0x35,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2c,0x31,0x2f,0x32,0x2e,0x34,0x29,0x2d,0x2e,0x30,0x35,0x35,0x3a,0x65,0x2a,0x3d,0x31,0x32,0x2e,0x39,0x32,0x2c,0x6e,0x3d,0x6e,0x3e,0x2e,0x30,0x30,0x33,0x31,0x33,0x30,0x38,0x3f,0x31,0x2e,0x30,0x35,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6e,0x2c,0x31,0x2f,0x32,0x2e,0x34,0x29,0x2d,0x2e,0x30,0x35,0x35,0x3a,0x6e,0x2a,0x3d,0x31,0x32,0x2e,0x39,0x32,0x2c,0x69,0x3d,0x69,0x3e,0x2e,0x30,0x30,0x33,0x31,0x33,0x30,0x38,0x3f,0x31,0x2e,0x30,0x35,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x69,0x2c,0x31,0x2f,0x32,0x2e,0x34,0x29,0x2d,0x2e,0x30,0x35,0x35,0x3a,0x69,0x2a,0x3d,0x31,0x32,0x2e,0x39,0x32,0x2c,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x65,0x29,0x2c,0x31,0x29,0x2c,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x6e,0x29,0x2c,0x31,0x29,0x2c,0x69,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x69,0x29,0x2c,0x31,0x29,0x2c,0x5b,0x32,0x35,0x35,0x2a,0x65,0x2c,0x32,0x35,0x35,0x2a,0x6e,0x2c,0x32,0x35,0x35,0x2a,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6d,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x2c,0x72,0x3d,0x74,0x5b,0x32,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2f,0x3d,0x39,0x35,0x2e,0x30,0x34,0x37,0x2c,0x6f,0x2f,0x3d,0x31,0x30,0x30,0x2c,0x72,0x2f,0x3d,0x31,0x30,0x38,0x2e,0x38,0x38,0x33,0x2c,0x61,0x3d,0x61,0x3e,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x61,0x2c,0x31,0x2f,0x33,0x29,0x3a,0x37,0x2e,0x37,0x38,0x37,0x2a,0x61,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x2c,0x6f,0x3d,0x6f,0x3e,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6f,0x2c,0x31,0x2f,0x33,0x29,0x3a,0x37,0x2e,0x37,0x38,0x37,0x2a,0x6f,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x2c,0x72,0x3d,0x72,0x3e,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x72,0x2c,0x31,0x2f,0x33,0x29,0x3a,0x37,0x2e,0x37,0x38,0x37,0x2a,0x72,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x2c,0x65,0x3d,0x31,0x31,0x36,0x2a,0x6f,0x2d,0x31,0x36,0x2c,0x6e,0x3d,0x35,0x30,0x30,0x2a,0x28,0x61,0x2d,0x6f,0x29,0x2c,0x69,0x3d,0x32,0x30,0x30,0x2a,0x28,0x6f,0x2d,0x72,0x29,0x2c,0x5b,0x65,0x2c,0x6e,0x2c,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x78,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x72,0x3d,0x74,0x5b,0x31,0x5d,0x2c,0x6c,0x3d,0x74,0x5b,0x32,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3c,0x3d,0x38,0x3f,0x61,0x3d,0x28,0x6e,0x3d,0x31,0x30,0x30,0x2a,0x6f,0x2f,0x39,0x30,0x33,0x2e,0x33,0x29,0x2f,0x31,0x30,0x30,0x2a,0x37,0x2e,0x37,0x38,0x37,0x2b,0x31,0x36,0x2f,0x31,0x31,0x36,0x3a,0x28,0x6e,0x3d,0x31,0x30,0x30,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x28,0x6f,0x2b,0x31,0x36,0x29,0x2f,0x31,0x31,0x36,0x2c,0x33,0x29,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6e,0x2f,0x31,0x30,0x30,0x2c,0x31,0x2f,0x33,0x29,0x29,0x2c,0x65,0x3d,0x65,0x2f,0x39,0x35,0x2e,0x30,0x34,0x37,0x3c,0x3d,0x2e,0x30,0x30,0x38,0x38,0x35,0x36,0x3f,0x65,0x3d,0x39,0x35,0x2e,0x30,0x34,0x37,0x2a,0x28,0x72,0x2f,0x35,0x30,0x30,0x2b,0x61,0x2d,0x31,0x36,0x2f,0x31,0x31,0x36,0x29,0x2f,0x37,0x2e,0x37,0x38,0x37,0x3a,0x39,0x35,0x2e,0x30,0x34,0x37,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x72,0x2f,0x35,0x30,0x30,0x2b,0x61,0x2c,0x33,0x29,0x2c,0x69,0x3d,0x69,0x2f,0x31,0x30,0x38,0x2e,0x38,0x38,0x33,0x3c,0x3d,0x2e,0x30,0x30,0x38,0x38,0x35,0x39,0x3f,0x69,0x3d,0x31,0x30,0x38,0x2e,0x38,0x38,0x33,0x2a,0x28,0x61,0x2d,0x6c,0x2f,0x32,0x30,0x30,0x2d,0x31,0x36,0x2f,0x31,0x31,0x36,0x29,0x2f,0x37,0x2e,0x37,0x38,0x37,0x3a,0x31,0x30,0x38,0x2e,0x38,0x38,0x33,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x61,0x2d,0x6c,0x2f,0x32,0x30,0x30,0x2c,0x33,0x29,0x2c,0x5b,0x65,0x2c,0x6e,0x2c,0x69,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x79,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x2c,0x72,0x3d,0x74,0x5b,0x32,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x61,0x74,0x61,0x6e,0x32,0x28,0x72,0x2c,0x6f,0x29,0x2c,0x28,0x6e,0x3d,0x33,0x36,0x30,0x2a,0x65,0x2f,0x32,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x3c,0x30,0x26,0x26,0x28,0x6e,0x2b,0x3d,0x33,0x36,0x30,0x29,0x2c,0x69,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x6f,0x2a,0x6f,0x2b,0x72,0x2a,0x72,0x29,0x2c,0x5b,0x61,0x2c,0x69,0x2c,0x6e,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6b,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x28,0x78,0x28,0x74,0x29,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x77,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x6f,0x3d,0x74,0x5b,0x31,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x33,0x36,0x30,0x2a,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2c,0x65,0x3d,0x6f,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x69,0x29,0x2c,0x6e,0x3d,0x6f,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x69,0x29,0x2c,0x5b,0x61,0x2c,0x65,0x2c,0x6e,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x4d,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x53,0x5b,0x74,0x5d,0x7d,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x72,0x67,0x62,0x32,0x68,0x73,0x6c,0x3a,0x69,0x2c,0x72,0x67,0x62,0x32,0x68,0x73,0x76,0x3a,0x61,0x2c,0x72,0x67,0x62,0x32,0x68,0x77,0x62,0x3a,0x6f,0x2c,0x72,0x67,0x62,0x32,0x63,0x6d,0x79,0x6b,0x3a,0x6c,0x2c,0x72,0x67,0x62,0x32,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x73,0x2c,0x72,0x67,0x62,0x32,0x78,0x79,0x7a,0x3a,0x75,0x2c,0x72,0x67,0x62,0x32,0x6c,0x61,0x62,0x3a,0x64,0x2c,0x72,0x67,0x62,0x32,0x6c,0x63,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x79,0x28,0x64,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x32,0x72,0x67,0x62,0x3a,0x63,0x2c,0x68,0x73,0x6c,0x32,0x68,0x73,0x76,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x61,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x6f,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x6f,0x3f,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x3a,0x28,0x6f,0x2a,0x3d,0x32,0x2c,0x61,0x2a,0x3d,0x6f,0x3c,0x3d,0x31,0x3f,0x6f,0x3a,0x32,0x2d,0x6f,0x2c,0x6e,0x3d,0x28,0x6f,0x2b,0x61,0x29,0x2f,0x32,0x2c,0x65,0x3d,0x32,0x2a,0x61,0x2f,0x28,0x6f,0x2b,0x61,0x29,0x2c,0x5b,0x69,0x2c,0x31,0x30,0x30,0x2a,0x65,0x2c,0x31,0x30,0x30,0x2a,0x6e,0x5d,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x32,0x68,0x77,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x63,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x32,0x63,0x6d,0x79,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x28,0x63,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x73,0x6c,0x32,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x28,0x63,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x73,0x76,0x32,0x72,0x67,0x62,0x3a,0x68,0x2c,0x68,0x73,0x76,0x32,0x68,0x73,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x5b,0x30,0x5d,0x2c,0x61,0x3d,0x74,0x5b,0x31,0x5d,0x2f,0x31,0x30,0x30,0x2c,0x6f,0x3d,0x74,0x5b,0x32,0x5d,0x2f,0x31,0x30,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3d,0x28,0x32,0x2d,0x61,0x29,0x2a,0x6f,0x2c,0x65,0x3d,0x61,0x2a,0x6f,0x2c,0x65,0x2f,0x3d,0x6e,0x3c,0x3d,0x31,0x3f,0x6e,0x3a,0x32,0x2d,0x6e,0x2c,0x65,0x3d,0x65,0x7c,0x7c,0x30,0x2c,0x6e,0x2f,0x3d,0x32,0x2c,0x5b,0x69,0x2c,0x31,0x30,0x30,0x2a,0x65,0x2c,0x31,0x30,0x30,0x2a,0x6e,0x5d,0x7d,0x2c,0x68,0x73,0x76,0x32,0x68,0x77,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x68,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x73,0x76,0x32,0x63,0x6d,0x79,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x28,0x68,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x73,0x76,0x32,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x28,0x68,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x77,0x62,0x32,0x72,0x67,0x62,0x3a,0x66,0x2c,0x68,0x77,0x62,0x32,0x68,0x73,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x28,0x66,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x77,0x62,0x32,0x68,0x73,0x76,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x66,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x77,0x62,0x32,0x63,0x6d,0x79,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x28,0x66,0x28,0x74,0x29,0x29,0x7d,0x2c,0x68,0x77,0x62,0x32,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x28,0x66,0x28,0x74,0x29,0x29,0x7d,0x2c,0x63,0x6d,0x79,0x6b,0x32,0x72,0x67,0x62,0x3a,0x70,0x2c,0x63,0x6d,0x79,0x6b,0x32,0x68,0x73,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x28,0x70,0x28,0x74,0x29,0x29,0x7d,0x2c,0x63,0x6d,0x79,0x6b,0x32,0x68,0x73,0x76,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x70,0x28,0x74,0x29,0x29,0x7d,0x2c,0x63,0x6d,0x79,0x6b,0x32,0x68,0x77,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x70,0x28,0x74,0x29,0x29,0x7d,0x2c,0x63,0x6d,0x79,0x6b,0x32,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x28,0x70,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x72,0x67,0x62,0x3a,0x4d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x68,0x73,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x28,0x4d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x68,0x73,0x76,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x4d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x68,0x77,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x4d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x63,0x6d,0x79,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x28,0x4d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x6c,0x61,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x64,0x28,0x4d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x32,0x78,0x79,0x7a,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x28,0x4d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x78,0x79,0x7a,0x32,0x72,0x67,0x62,0x3a,0x76,0x2c,0x78,0x79,0x7a,0x32,0x6c,0x61,0x62,0x3a,0x6d,0x2c,0x78,0x79,0x7a,0x32,0x6c,0x63,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x79,0x28,0x6d,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6c,0x61,0x62,0x32,0x78,0x79,0x7a,0x3a,0x78,0x2c,0x6c,0x61,0x62,0x32,0x72,0x67,0x62,0x3a,0x6b,0x2c,0x6c,0x61,0x62,0x32,0x6c,0x63,0x68,0x3a,0x79,0x2c,0x6c,0x63,0x68,0x32,0x6c,0x61,0x62,0x3a,0x77,0x2c,0x6c,0x63,0x68,0x32,0x78,0x79,0x7a,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x78,0x28,0x77,0x28,0x74,0x29,0x29,0x7d,0x2c,0x6c,0x63,0x68,0x32,0x72,0x67,0x62,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6b,0x28,0x77,0x28,0x74,0x29,0x29,0x7d,0x7d,0x3b,0x76,0x61,0x72,0x20,0x53,0x3d,0x7b,0x61,0x6c,0x69,0x63,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x34,0x38,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x61,0x6e,0x74,0x69,0x71,0x75,0x65,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x32,0x33,0x35,0x2c,0x32,0x31,0x35,0x5d,0x2c,0x61,0x71,0x75,0x61,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x61,0x71,0x75,0x61,0x6d,0x61,0x72,0x69,0x6e,0x65,0x3a,0x5b,0x31,0x32,0x37,0x2c,0x32,0x35,0x35,0x2c,0x32,0x31,0x32,0x5d,0x2c,0x61,0x7a,0x75,0x72,0x65,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x62,0x65,0x69,0x67,0x65,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x34,0x35,0x2c,0x32,0x32,0x30,0x5d,0x2c,0x62,0x69,0x73,0x71,0x75,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x38,0x2c,0x31,0x39,0x36,0x5d,0x2c,0x62,0x6c,0x61,0x63,0x6b,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x62,0x6c,0x61,0x6e,0x63,0x68,0x65,0x64,0x61,0x6c,0x6d,0x6f,0x6e,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x33,0x35,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x62,0x6c,0x75,0x65,0x76,0x69,0x6f,0x6c,0x65,0x74,0x3a,0x5b,0x31,0x33,0x38,0x2c,0x34,0x33,0x2c,0x32,0x32,0x36,0x5d,0x2c,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x31,0x36,0x35,0x2c,0x34,0x32,0x2c,0x34,0x32,0x5d,0x2c,0x62,0x75,0x72,0x6c,0x79,0x77,0x6f,0x6f,0x64,0x3a,0x5b,0x32,0x32,0x32,0x2c,0x31,0x38,0x34,0x2c,0x31,0x33,0x35,0x5d,0x2c,0x63,0x61,0x64,0x65,0x74,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x39,0x35,0x2c,0x31,0x35,0x38,0x2c,0x31,0x36,0x30,0x5d,0x2c,0x63,0x68,0x61,0x72,0x74,0x72,0x65,0x75,0x73,0x65,0x3a,0x5b,0x31,0x32,0x37,0x2c,0x32,0x35,0x35,0x2c,0x30,0x5d,0x2c,0x63,0x68,0x6f,0x63,0x6f,0x6c,0x61,0x74,0x65,0x3a,0x5b,0x32,0x31,0x30,0x2c,0x31,0x30,0x35,0x2c,0x33,0x30,0x5d,0x2c,0x63,0x6f,0x72,0x61,0x6c,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x32,0x37,0x2c,0x38,0x30,0x5d,0x2c,0x63,0x6f,0x72,0x6e,0x66,0x6c,0x6f,0x77,0x65,0x72,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x30,0x30,0x2c,0x31,0x34,0x39,0x2c,0x32,0x33,0x37,0x5d,0x2c,0x63,0x6f,0x72,0x6e,0x73,0x69,0x6c,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x34,0x38,0x2c,0x32,0x32,0x30,0x5d,0x2c,0x63,0x72,0x69,0x6d,0x73,0x6f,0x6e,0x3a,0x5b,0x32,0x32,0x30,0x2c,0x32,0x30,0x2c,0x36,0x30,0x5d,0x2c,0x63,0x79,0x61,0x6e,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x63,0x79,0x61,0x6e,0x3a,0x5b,0x30,0x2c,0x31,0x33,0x39,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x3a,0x5b,0x31,0x38,0x34,0x2c,0x31,0x33,0x34,0x2c,0x31,0x31,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x31,0x30,0x30,0x2c,0x30,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6b,0x68,0x61,0x6b,0x69,0x3a,0x5b,0x31,0x38,0x39,0x2c,0x31,0x38,0x33,0x2c,0x31,0x30,0x37,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6d,0x61,0x67,0x65,0x6e,0x74,0x61,0x3a,0x5b,0x31,0x33,0x39,0x2c,0x30,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6f,0x6c,0x69,0x76,0x65,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x38,0x35,0x2c,0x31,0x30,0x37,0x2c,0x34,0x37,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6f,0x72,0x61,0x6e,0x67,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x34,0x30,0x2c,0x30,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6f,0x72,0x63,0x68,0x69,0x64,0x3a,0x5b,0x31,0x35,0x33,0x2c,0x35,0x30,0x2c,0x32,0x30,0x34,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x72,0x65,0x64,0x3a,0x5b,0x31,0x33,0x39,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x61,0x6c,0x6d,0x6f,0x6e,0x3a,0x5b,0x32,0x33,0x33,0x2c,0x31,0x35,0x30,0x2c,0x31,0x32,0x32,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x34,0x33,0x2c,0x31,0x38,0x38,0x2c,0x31,0x34,0x33,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x6c,0x61,0x74,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x37,0x32,0x2c,0x36,0x31,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x61,0x79,0x3a,0x5b,0x34,0x37,0x2c,0x37,0x39,0x2c,0x37,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x65,0x79,0x3a,0x5b,0x34,0x37,0x2c,0x37,0x39,0x2c,0x37,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x30,0x2c,0x32,0x30,0x36,0x2c,0x32,0x30,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x76,0x69,0x6f,0x6c,0x65,0x74,0x3a,0x5b,0x31,0x34,0x38,0x2c,0x30,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x64,0x65,0x65,0x70,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x30,0x2c,0x31,0x34,0x37,0x5d,0x2c,0x64,0x65,0x65,0x70,0x73,0x6b,0x79,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x31,0x39,0x31,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x64,0x69,0x6d,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x5d,0x2c,0x64,0x69,0x6d,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x5d,0x2c,0x64,0x6f,0x64,0x67,0x65,0x72,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x33,0x30,0x2c,0x31,0x34,0x34,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x66,0x69,0x72,0x65,0x62,0x72,0x69,0x63,0x6b,0x3a,0x5b,0x31,0x37,0x38,0x2c,0x33,0x34,0x2c,0x33,0x34,0x5d,0x2c,0x66,0x6c,0x6f,0x72,0x61,0x6c,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x2c,0x32,0x34,0x30,0x5d,0x2c,0x66,0x6f,0x72,0x65,0x73,0x74,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x33,0x34,0x2c,0x31,0x33,0x39,0x2c,0x33,0x34,0x5d,0x2c,0x66,0x75,0x63,0x68,0x73,0x69,0x61,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x30,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x67,0x61,0x69,0x6e,0x73,0x62,0x6f,0x72,0x6f,0x3a,0x5b,0x32,0x32,0x30,0x2c,0x32,0x32,0x30,0x2c,0x32,0x32,0x30,0x5d,0x2c,0x67,0x68,0x6f,0x73,0x74,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x34,0x38,0x2c,0x32,0x34,0x38,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x67,0x6f,0x6c,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x31,0x35,0x2c,0x30,0x5d,0x2c,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x3a,0x5b,0x32,0x31,0x38,0x2c,0x31,0x36,0x35,0x2c,0x33,0x32,0x5d,0x2c,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x31,0x32,0x38,0x2c,0x30,0x5d,0x2c,0x67,0x72,0x65,0x65,0x6e,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x31,0x37,0x33,0x2c,0x32,0x35,0x35,0x2c,0x34,0x37,0x5d,0x2c,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x68,0x6f,0x6e,0x65,0x79,0x64,0x65,0x77,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x34,0x30,0x5d,0x2c,0x68,0x6f,0x74,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x30,0x35,0x2c,0x31,0x38,0x30,0x5d,0x2c,0x69,0x6e,0x64,0x69,0x61,0x6e,0x72,0x65,0x64,0x3a,0x5b,0x32,0x30,0x35,0x2c,0x39,0x32,0x2c,0x39,0x32,0x5d,0x2c,0x69,0x6e,0x64,0x69,0x67,0x6f,0x3a,0x5b,0x37,0x35,0x2c,0x30,0x2c,0x31,0x33,0x30,0x5d,0x2c,0x69,0x76,0x6f,0x72,0x79,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x34,0x30,0x5d,0x2c,0x6b,0x68,0x61,0x6b,0x69,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x33,0x30,0x2c,0x31,0x34,0x30,0x5d,0x2c,0x6c,0x61,0x76,0x65,0x6e,0x64,0x65,0x72,0x3a,0x5b,0x32,0x33,0x30,0x2c,0x32,0x33,0x30,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x6c,0x61,0x76,0x65,0x6e,0x64,0x65,0x72,0x62,0x6c,0x75,0x73,0x68,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x34,0x30,0x2c,0x32,0x34,0x35,0x5d,0x2c,0x6c,0x61,0x77,0x6e,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x32,0x34,0x2c,0x32,0x35,0x32,0x2c,0x30,0x5d,0x2c,0x6c,0x65,0x6d,0x6f,0x6e,0x63,0x68,0x69,0x66,0x66,0x6f,0x6e,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x37,0x33,0x2c,0x32,0x31,0x36,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x63,0x6f,0x72,0x61,0x6c,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x63,0x79,0x61,0x6e,0x3a,0x5b,0x32,0x32,0x34,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x32,0x35,0x30,0x2c,0x32,0x31,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x72,0x61,0x79,0x3a,0x5b,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x34,0x34,0x2c,0x32,0x33,0x38,0x2c,0x31,0x34,0x34,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x72,0x65,0x79,0x3a,0x5b,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x38,0x32,0x2c,0x31,0x39,0x33,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x61,0x6c,0x6d,0x6f,0x6e,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x36,0x30,0x2c,0x31,0x32,0x32,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x33,0x32,0x2c,0x31,0x37,0x38,0x2c,0x31,0x37,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x6b,0x79,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x33,0x35,0x2c,0x32,0x30,0x36,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x31,0x39,0x2c,0x31,0x33,0x36,0x2c,0x31,0x35,0x33,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x31,0x39,0x2c,0x31,0x33,0x36,0x2c,0x31,0x35,0x33,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x74,0x65,0x65,0x6c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x37,0x36,0x2c,0x31,0x39,0x36,0x2c,0x32,0x32,0x32,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x32,0x34,0x5d,0x2c,0x6c,0x69,0x6d,0x65,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x30,0x5d,0x2c,0x6c,0x69,0x6d,0x65,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x35,0x30,0x2c,0x32,0x30,0x35,0x2c,0x35,0x30,0x5d,0x2c,0x6c,0x69,0x6e,0x65,0x6e,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x32,0x34,0x30,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x6d,0x61,0x67,0x65,0x6e,0x74,0x61,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x30,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x6d,0x61,0x72,0x6f,0x6f,0x6e,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x61,0x71,0x75,0x61,0x6d,0x61,0x72,0x69,0x6e,0x65,0x3a,0x5b,0x31,0x30,0x32,0x2c,0x32,0x30,0x35,0x2c,0x31,0x37,0x30,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x6f,0x72,0x63,0x68,0x69,0x64,0x3a,0x5b,0x31,0x38,0x36,0x2c,0x38,0x35,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x70,0x75,0x72,0x70,0x6c,0x65,0x3a,0x5b,0x31,0x34,0x37,0x2c,0x31,0x31,0x32,0x2c,0x32,0x31,0x39,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x36,0x30,0x2c,0x31,0x37,0x39,0x2c,0x31,0x31,0x33,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x73,0x6c,0x61,0x74,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x32,0x33,0x2c,0x31,0x30,0x34,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x73,0x70,0x72,0x69,0x6e,0x67,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x30,0x2c,0x31,0x35,0x34,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x37,0x32,0x2c,0x32,0x30,0x39,0x2c,0x32,0x30,0x34,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x76,0x69,0x6f,0x6c,0x65,0x74,0x72,0x65,0x64,0x3a,0x5b,0x31,0x39,0x39,0x2c,0x32,0x31,0x2c,0x31,0x33,0x33,0x5d,0x2c,0x6d,0x69,0x64,0x6e,0x69,0x67,0x68,0x74,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x32,0x35,0x2c,0x32,0x35,0x2c,0x31,0x31,0x32,0x5d,0x2c,0x6d,0x69,0x6e,0x74,0x63,0x72,0x65,0x61,0x6d,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x6d,0x69,0x73,0x74,0x79,0x72,0x6f,0x73,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x38,0x2c,0x32,0x32,0x35,0x5d,0x2c,0x6d,0x6f,0x63,0x63,0x61,0x73,0x69,0x6e,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x38,0x2c,0x31,0x38,0x31,0x5d,0x2c,0x6e,0x61,0x76,0x61,0x6a,0x6f,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x32,0x2c,0x31,0x37,0x33,0x5d,0x2c,0x6e,0x61,0x76,0x79,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x6f,0x6c,0x64,0x6c,0x61,0x63,0x65,0x3a,0x5b,0x32,0x35,0x33,0x2c,0x32,0x34,0x35,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x6f,0x6c,0x69,0x76,0x65,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x2c,0x30,0x5d,0x2c,0x6f,0x6c,0x69,0x76,0x65,0x64,0x72,0x61,0x62,0x3a,0x5b,0x31,0x30,0x37,0x2c,0x31,0x34,0x32,0x2c,0x33,0x35,0x5d,0x2c,0x6f,0x72,0x61,0x6e,0x67,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x36,0x35,0x2c,0x30,0x5d,0x2c,0x6f,0x72,0x61,0x6e,0x67,0x65,0x72,0x65,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x36,0x39,0x2c,0x30,0x5d,0x2c,0x6f,0x72,0x63,0x68,0x69,0x64,0x3a,0x5b,0x32,0x31,0x38,0x2c,0x31,0x31,0x32,0x2c,0x32,0x31,0x34,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x3a,0x5b,0x32,0x33,0x38,0x2c,0x32,0x33,0x32,0x2c,0x31,0x37,0x30,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x35,0x32,0x2c,0x32,0x35,0x31,0x2c,0x31,0x35,0x32,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x31,0x37,0x35,0x2c,0x32,0x33,0x38,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x76,0x69,0x6f,0x6c,0x65,0x74,0x72,0x65,0x64,0x3a,0x5b,0x32,0x31,0x39,0x2c,0x31,0x31,0x32,0x2c,0x31,0x34,0x37,0x5d,0x2c,0x70,0x61,0x70,0x61,0x79,0x61,0x77,0x68,0x69,0x70,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x33,0x39,0x2c,0x32,0x31,0x33,0x5d,0x2c,0x70,0x65,0x61,0x63,0x68,0x70,0x75,0x66,0x66,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x31,0x38,0x2c,0x31,0x38,0x35,0x5d,0x2c,0x70,0x65,0x72,0x75,0x3a,0x5b,0x32,0x30,0x35,0x2c,0x31,0x33,0x33,0x2c,0x36,0x33,0x5d,0x2c,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x39,0x32,0x2c,0x32,0x30,0x33,0x5d,0x2c,0x70,0x6c,0x75,0x6d,0x3a,0x5b,0x32,0x32,0x31,0x2c,0x31,0x36,0x30,0x2c,0x32,0x32,0x31,0x5d,0x2c,0x70,0x6f,0x77,0x64,0x65,0x72,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x37,0x36,0x2c,0x32,0x32,0x34,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x70,0x75,0x72,0x70,0x6c,0x65,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x30,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x72,0x65,0x62,0x65,0x63,0x63,0x61,0x70,0x75,0x72,0x70,0x6c,0x65,0x3a,0x5b,0x31,0x30,0x32,0x2c,0x35,0x31,0x2c,0x31,0x35,0x33,0x5d,0x2c,0x72,0x65,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x72,0x6f,0x73,0x79,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x31,0x38,0x38,0x2c,0x31,0x34,0x33,0x2c,0x31,0x34,0x33,0x5d,0x2c,0x72,0x6f,0x79,0x61,0x6c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x36,0x35,0x2c,0x31,0x30,0x35,0x2c,0x32,0x32,0x35,0x5d,0x2c,0x73,0x61,0x64,0x64,0x6c,0x65,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x31,0x33,0x39,0x2c,0x36,0x39,0x2c,0x31,0x39,0x5d,0x2c,0x73,0x61,0x6c,0x6d,0x6f,0x6e,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x31,0x32,0x38,0x2c,0x31,0x31,0x34,0x5d,0x2c,0x73,0x61,0x6e,0x64,0x79,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x32,0x34,0x34,0x2c,0x31,0x36,0x34,0x2c,0x39,0x36,0x5d,0x2c,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x34,0x36,0x2c,0x31,0x33,0x39,0x2c,0x38,0x37,0x5d,0x2c,0x73,0x65,0x61,0x73,0x68,0x65,0x6c,0x6c,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x34,0x35,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x73,0x69,0x65,0x6e,0x6e,0x61,0x3a,0x5b,0x31,0x36,0x30,0x2c,0x38,0x32,0x2c,0x34,0x35,0x5d,0x2c,0x73,0x69,0x6c,0x76,0x65,0x72,0x3a,0x5b,0x31,0x39,0x32,0x2c,0x31,0x39,0x32,0x2c,0x31,0x39,0x32,0x5d,0x2c,0x73,0x6b,0x79,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x33,0x35,0x2c,0x32,0x30,0x36,0x2c,0x32,0x33,0x35,0x5d,0x2c,0x73,0x6c,0x61,0x74,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x30,0x36,0x2c,0x39,0x30,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x31,0x32,0x2c,0x31,0x32,0x38,0x2c,0x31,0x34,0x34,0x5d,0x2c,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x31,0x32,0x2c,0x31,0x32,0x38,0x2c,0x31,0x34,0x34,0x5d,0x2c,0x73,0x6e,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x73,0x70,0x72,0x69,0x6e,0x67,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x31,0x32,0x37,0x5d,0x2c,0x73,0x74,0x65,0x65,0x6c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x37,0x30,0x2c,0x31,0x33,0x30,0x2c,0x31,0x38,0x30,0x5d,0x2c,0x74,0x61,0x6e,0x3a,0x5b,0x32,0x31,0x30,0x2c,0x31,0x38,0x30,0x2c,0x31,0x34,0x30,0x5d,0x2c,0x74,0x65,0x61,0x6c,0x3a,0x5b,0x30,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x74,0x68,0x69,0x73,0x74,0x6c,0x65,0x3a,0x5b,0x32,0x31,0x36,0x2c,0x31,0x39,0x31,0x2c,0x32,0x31,0x36,0x5d,0x2c,0x74,0x6f,0x6d,0x61,0x74,0x6f,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x39,0x39,0x2c,0x37,0x31,0x5d,0x2c,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x36,0x34,0x2c,0x32,0x32,0x34,0x2c,0x32,0x30,0x38,0x5d,0x2c,0x76,0x69,0x6f,0x6c,0x65,0x74,0x3a,0x5b,0x32,0x33,0x38,0x2c,0x31,0x33,0x30,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x77,0x68,0x65,0x61,0x74,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x32,0x32,0x2c,0x31,0x37,0x39,0x5d,0x2c,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x77,0x68,0x69,0x74,0x65,0x73,0x6d,0x6f,0x6b,0x65,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x34,0x35,0x2c,0x32,0x34,0x35,0x5d,0x2c,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x30,0x5d,0x2c,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x35,0x34,0x2c,0x32,0x30,0x35,0x2c,0x35,0x30,0x5d,0x7d,0x2c,0x43,0x3d,0x7b,0x7d,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x5f,0x20,0x69,0x6e,0x20,0x53,0x29,0x43,0x5b,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x53,0x5b,0x5f,0x5d,0x29,0x5d,0x3d,0x5f,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x35,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x29,0x2c,0x61,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x65,0x77,0x20,0x75,0x7d,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6f,0x20,0x69,0x6e,0x20,0x69,0x29,0x7b,0x61,0x5b,0x6f,0x2b,0x22,0x52,0x61,0x77,0x22,0x5d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x26,0x26,0x28,0x65,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x29,0x2c,0x69,0x5b,0x74,0x5d,0x28,0x65,0x29,0x7d,0x7d,0x28,0x6f,0x29,0x3b,0x76,0x61,0x72,0x20,0x72,0x3d,0x2f,0x28,0x5c,0x77,0x2b,0x29,0x32,0x28,0x5c,0x77,0x2b,0x29,0x2f,0x2e,0x65,0x78,0x65,0x63,0x28,0x6f,0x29,0x2c,0x6c,0x3d,0x72,0x5b,0x31,0x5d,0x2c,0x73,0x3d,0x72,0x5b,0x32,0x5d,0x3b,0x28,0x61,0x5b,0x6c,0x5d,0x3d,0x61,0x5b,0x6c,0x5d,0x7c,0x7c,0x7b,0x7d,0x29,0x5b,0x73,0x5d,0x3d,0x61,0x5b,0x6f,0x5d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x26,0x26,0x28,0x65,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x29,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x69,0x5b,0x74,0x5d,0x28,0x65,0x29,0x3b,0x69,0x66,0x28,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6e,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x2b,0x2b,0x29,0x6e,0x5b,0x61,0x5d,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x6e,0x5b,0x61,0x5d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x7d,0x7d,0x28,0x6f,0x29,0x7d,0x76,0x61,0x72,0x20,0x75,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x76,0x73,0x3d,0x7b,0x7d,0x7d,0x3b,0x75,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x72,0x6f,0x75,0x74,0x65,0x53,0x70,0x61,0x63,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x5b,0x30,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x3f,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x74,0x29,0x3a,0x28,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6e,0x26,0x26,0x28,0x6e,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x29,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x74,0x2c,0x6e,0x29,0x29,0x7d,0x2c,0x75,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x70,0x61,0x63,0x65,0x3d,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x76,0x73,0x3d,0x7b,0x7d,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x76,0x73,0x5b,0x74,0x5d,0x3d,0x65,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x75,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x76,0x73,0x5b,0x74,0x5d,0x3b,0x69,0x66,0x28,0x21,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x73,0x70,0x61,0x63,0x65,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x76,0x73,0x5b,0x6e,0x5d,0x3b,0x65,0x3d,0x61,0x5b,0x6e,0x5d,0x5b,0x74,0x5d,0x28,0x69,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x76,0x73,0x5b,0x74,0x5d,0x3d,0x65,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x7d,0x2c,0x5b,0x22,0x72,0x67,0x62,0x22,0x2c,0x22,0x68,0x73,0x6c,0x22,0x2c,0x22,0x68,0x73,0x76,0x22,0x2c,0x22,0x63,0x6d,0x79,0x6b,0x22,0x2c,0x22,0x6b,0x65,0x79,0x77,0x6f,0x72,0x64,0x22,0x5d,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x75,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x5b,0x74,0x5d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x72,0x6f,0x75,0x74,0x65,0x53,0x70,0x61,0x63,0x65,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x61,0x7d,0x2c,0x7b,0x34,0x3a,0x34,0x7d,0x5d,0x2c,0x36,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x61,0x6c,0x69,0x63,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x34,0x38,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x61,0x6e,0x74,0x69,0x71,0x75,0x65,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x32,0x33,0x35,0x2c,0x32,0x31,0x35,0x5d,0x2c,0x61,0x71,0x75,0x61,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x61,0x71,0x75,0x61,0x6d,0x61,0x72,0x69,0x6e,0x65,0x3a,0x5b,0x31,0x32,0x37,0x2c,0x32,0x35,0x35,0x2c,0x32,0x31,0x32,0x5d,0x2c,0x61,0x7a,0x75,0x72,0x65,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x62,0x65,0x69,0x67,0x65,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x34,0x35,0x2c,0x32,0x32,0x30,0x5d,0x2c,0x62,0x69,0x73,0x71,0x75,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x38,0x2c,0x31,0x39,0x36,0x5d,0x2c,0x62,0x6c,0x61,0x63,0x6b,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x62,0x6c,0x61,0x6e,0x63,0x68,0x65,0x64,0x61,0x6c,0x6d,0x6f,0x6e,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x33,0x35,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x62,0x6c,0x75,0x65,0x76,0x69,0x6f,0x6c,0x65,0x74,0x3a,0x5b,0x31,0x33,0x38,0x2c,0x34,0x33,0x2c,0x32,0x32,0x36,0x5d,0x2c,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x31,0x36,0x35,0x2c,0x34,0x32,0x2c,0x34,0x32,0x5d,0x2c,0x62,0x75,0x72,0x6c,0x79,0x77,0x6f,0x6f,0x64,0x3a,0x5b,0x32,0x32,0x32,0x2c,0x31,0x38,0x34,0x2c,0x31,0x33,0x35,0x5d,0x2c,0x63,0x61,0x64,0x65,0x74,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x39,0x35,0x2c,0x31,0x35,0x38,0x2c,0x31,0x36,0x30,0x5d,0x2c,0x63,0x68,0x61,0x72,0x74,0x72,0x65,0x75,0x73,0x65,0x3a,0x5b,0x31,0x32,0x37,0x2c,0x32,0x35,0x35,0x2c,0x30,0x5d,0x2c,0x63,0x68,0x6f,0x63,0x6f,0x6c,0x61,0x74,0x65,0x3a,0x5b,0x32,0x31,0x30,0x2c,0x31,0x30,0x35,0x2c,0x33,0x30,0x5d,0x2c,0x63,0x6f,0x72,0x61,0x6c,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x32,0x37,0x2c,0x38,0x30,0x5d,0x2c,0x63,0x6f,0x72,0x6e,0x66,0x6c,0x6f,0x77,0x65,0x72,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x30,0x30,0x2c,0x31,0x34,0x39,0x2c,0x32,0x33,0x37,0x5d,0x2c,0x63,0x6f,0x72,0x6e,0x73,0x69,0x6c,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x34,0x38,0x2c,0x32,0x32,0x30,0x5d,0x2c,0x63,0x72,0x69,0x6d,0x73,0x6f,0x6e,0x3a,0x5b,0x32,0x32,0x30,0x2c,0x32,0x30,0x2c,0x36,0x30,0x5d,0x2c,0x63,0x79,0x61,0x6e,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x63,0x79,0x61,0x6e,0x3a,0x5b,0x30,0x2c,0x31,0x33,0x39,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x3a,0x5b,0x31,0x38,0x34,0x2c,0x31,0x33,0x34,0x2c,0x31,0x31,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x31,0x30,0x30,0x2c,0x30,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x2c,0x31,0x36,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6b,0x68,0x61,0x6b,0x69,0x3a,0x5b,0x31,0x38,0x39,0x2c,0x31,0x38,0x33,0x2c,0x31,0x30,0x37,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6d,0x61,0x67,0x65,0x6e,0x74,0x61,0x3a,0x5b,0x31,0x33,0x39,0x2c,0x30,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6f,0x6c,0x69,0x76,0x65,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x38,0x35,0x2c,0x31,0x30,0x37,0x2c,0x34,0x37,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6f,0x72,0x61,0x6e,0x67,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x34,0x30,0x2c,0x30,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x6f,0x72,0x63,0x68,0x69,0x64,0x3a,0x5b,0x31,0x35,0x33,0x2c,0x35,0x30,0x2c,0x32,0x30,0x34,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x72,0x65,0x64,0x3a,0x5b,0x31,0x33,0x39,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x61,0x6c,0x6d,0x6f,0x6e,0x3a,0x5b,0x32,0x33,0x33,0x2c,0x31,0x35,0x30,0x2c,0x31,0x32,0x32,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x34,0x33,0x2c,0x31,0x38,0x38,0x2c,0x31,0x34,0x33,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x6c,0x61,0x74,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x37,0x32,0x2c,0x36,0x31,0x2c,0x31,0x33,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x61,0x79,0x3a,0x5b,0x34,0x37,0x2c,0x37,0x39,0x2c,0x37,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x65,0x79,0x3a,0x5b,0x34,0x37,0x2c,0x37,0x39,0x2c,0x37,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x30,0x2c,0x32,0x30,0x36,0x2c,0x32,0x30,0x39,0x5d,0x2c,0x64,0x61,0x72,0x6b,0x76,0x69,0x6f,0x6c,0x65,0x74,0x3a,0x5b,0x31,0x34,0x38,0x2c,0x30,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x64,0x65,0x65,0x70,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x30,0x2c,0x31,0x34,0x37,0x5d,0x2c,0x64,0x65,0x65,0x70,0x73,0x6b,0x79,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x31,0x39,0x31,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x64,0x69,0x6d,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x5d,0x2c,0x64,0x69,0x6d,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x2c,0x31,0x30,0x35,0x5d,0x2c,0x64,0x6f,0x64,0x67,0x65,0x72,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x33,0x30,0x2c,0x31,0x34,0x34,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x66,0x69,0x72,0x65,0x62,0x72,0x69,0x63,0x6b,0x3a,0x5b,0x31,0x37,0x38,0x2c,0x33,0x34,0x2c,0x33,0x34,0x5d,0x2c,0x66,0x6c,0x6f,0x72,0x61,0x6c,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x2c,0x32,0x34,0x30,0x5d,0x2c,0x66,0x6f,0x72,0x65,0x73,0x74,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x33,0x34,0x2c,0x31,0x33,0x39,0x2c,0x33,0x34,0x5d,0x2c,0x66,0x75,0x63,0x68,0x73,0x69,0x61,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x30,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x67,0x61,0x69,0x6e,0x73,0x62,0x6f,0x72,0x6f,0x3a,0x5b,0x32,0x32,0x30,0x2c,0x32,0x32,0x30,0x2c,0x32,0x32,0x30,0x5d,0x2c,0x67,0x68,0x6f,0x73,0x74,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x34,0x38,0x2c,0x32,0x34,0x38,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x67,0x6f,0x6c,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x31,0x35,0x2c,0x30,0x5d,0x2c,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x3a,0x5b,0x32,0x31,0x38,0x2c,0x31,0x36,0x35,0x2c,0x33,0x32,0x5d,0x2c,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x31,0x32,0x38,0x2c,0x30,0x5d,0x2c,0x67,0x72,0x65,0x65,0x6e,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x31,0x37,0x33,0x2c,0x32,0x35,0x35,0x2c,0x34,0x37,0x5d,0x2c,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x68,0x6f,0x6e,0x65,0x79,0x64,0x65,0x77,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x35,0x35,0x2c,0x32,0x34,0x30,0x5d,0x2c,0x68,0x6f,0x74,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x30,0x35,0x2c,0x31,0x38,0x30,0x5d,0x2c,0x69,0x6e,0x64,0x69,0x61,0x6e,0x72,0x65,0x64,0x3a,0x5b,0x32,0x30,0x35,0x2c,0x39,0x32,0x2c,0x39,0x32,0x5d,0x2c,0x69,0x6e,0x64,0x69,0x67,0x6f,0x3a,0x5b,0x37,0x35,0x2c,0x30,0x2c,0x31,0x33,0x30,0x5d,0x2c,0x69,0x76,0x6f,0x72,0x79,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x34,0x30,0x5d,0x2c,0x6b,0x68,0x61,0x6b,0x69,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x32,0x33,0x30,0x2c,0x31,0x34,0x30,0x5d,0x2c,0x6c,0x61,0x76,0x65,0x6e,0x64,0x65,0x72,0x3a,0x5b,0x32,0x33,0x30,0x2c,0x32,0x33,0x30,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x6c,0x61,0x76,0x65,0x6e,0x64,0x65,0x72,0x62,0x6c,0x75,0x73,0x68,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x34,0x30,0x2c,0x32,0x34,0x35,0x5d,0x2c,0x6c,0x61,0x77,0x6e,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x32,0x34,0x2c,0x32,0x35,0x32,0x2c,0x30,0x5d,0x2c,0x6c,0x65,0x6d,0x6f,0x6e,0x63,0x68,0x69,0x66,0x66,0x6f,0x6e,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x37,0x33,0x2c,0x32,0x31,0x36,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x63,0x6f,0x72,0x61,0x6c,0x3a,0x5b,0x32,0x34,0x30,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x63,0x79,0x61,0x6e,0x3a,0x5b,0x32,0x32,0x34,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x32,0x35,0x30,0x2c,0x32,0x31,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x72,0x61,0x79,0x3a,0x5b,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x34,0x34,0x2c,0x32,0x33,0x38,0x2c,0x31,0x34,0x34,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x67,0x72,0x65,0x79,0x3a,0x5b,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x38,0x32,0x2c,0x31,0x39,0x33,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x61,0x6c,0x6d,0x6f,0x6e,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x36,0x30,0x2c,0x31,0x32,0x32,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x33,0x32,0x2c,0x31,0x37,0x38,0x2c,0x31,0x37,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x6b,0x79,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x33,0x35,0x2c,0x32,0x30,0x36,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x31,0x39,0x2c,0x31,0x33,0x36,0x2c,0x31,0x35,0x33,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x31,0x39,0x2c,0x31,0x33,0x36,0x2c,0x31,0x35,0x33,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x73,0x74,0x65,0x65,0x6c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x37,0x36,0x2c,0x31,0x39,0x36,0x2c,0x32,0x32,0x32,0x5d,0x2c,0x6c,0x69,0x67,0x68,0x74,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x32,0x34,0x5d,0x2c,0x6c,0x69,0x6d,0x65,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x30,0x5d,0x2c,0x6c,0x69,0x6d,0x65,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x35,0x30,0x2c,0x32,0x30,0x35,0x2c,0x35,0x30,0x5d,0x2c,0x6c,0x69,0x6e,0x65,0x6e,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x32,0x34,0x30,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x6d,0x61,0x67,0x65,0x6e,0x74,0x61,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x30,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x6d,0x61,0x72,0x6f,0x6f,0x6e,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x61,0x71,0x75,0x61,0x6d,0x61,0x72,0x69,0x6e,0x65,0x3a,0x5b,0x31,0x30,0x32,0x2c,0x32,0x30,0x35,0x2c,0x31,0x37,0x30,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x6f,0x72,0x63,0x68,0x69,0x64,0x3a,0x5b,0x31,0x38,0x36,0x2c,0x38,0x35,0x2c,0x32,0x31,0x31,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x70,0x75,0x72,0x70,0x6c,0x65,0x3a,0x5b,0x31,0x34,0x37,0x2c,0x31,0x31,0x32,0x2c,0x32,0x31,0x39,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x36,0x30,0x2c,0x31,0x37,0x39,0x2c,0x31,0x31,0x33,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x73,0x6c,0x61,0x74,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x32,0x33,0x2c,0x31,0x30,0x34,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x73,0x70,0x72,0x69,0x6e,0x67,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x30,0x2c,0x31,0x35,0x34,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x37,0x32,0x2c,0x32,0x30,0x39,0x2c,0x32,0x30,0x34,0x5d,0x2c,0x6d,0x65,0x64,0x69,0x75,0x6d,0x76,0x69,0x6f,0x6c,0x65,0x74,0x72,0x65,0x64,0x3a,0x5b,0x31,0x39,0x39,0x2c,0x32,0x31,0x2c,0x31,0x33,0x33,0x5d,0x2c,0x6d,0x69,0x64,0x6e,0x69,0x67,0x68,0x74,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x32,0x35,0x2c,0x32,0x35,0x2c,0x31,0x31,0x32,0x5d,0x2c,0x6d,0x69,0x6e,0x74,0x63,0x72,0x65,0x61,0x6d,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x6d,0x69,0x73,0x74,0x79,0x72,0x6f,0x73,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x38,0x2c,0x32,0x32,0x35,0x5d,0x2c,0x6d,0x6f,0x63,0x63,0x61,0x73,0x69,0x6e,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x38,0x2c,0x31,0x38,0x31,0x5d,0x2c,0x6e,0x61,0x76,0x61,0x6a,0x6f,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x32,0x32,0x2c,0x31,0x37,0x33,0x5d,0x2c,0x6e,0x61,0x76,0x79,0x3a,0x5b,0x30,0x2c,0x30,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x6f,0x6c,0x64,0x6c,0x61,0x63,0x65,0x3a,0x5b,0x32,0x35,0x33,0x2c,0x32,0x34,0x35,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x6f,0x6c,0x69,0x76,0x65,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x2c,0x30,0x5d,0x2c,0x6f,0x6c,0x69,0x76,0x65,0x64,0x72,0x61,0x62,0x3a,0x5b,0x31,0x30,0x37,0x2c,0x31,0x34,0x32,0x2c,0x33,0x35,0x5d,0x2c,0x6f,0x72,0x61,0x6e,0x67,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x36,0x35,0x2c,0x30,0x5d,0x2c,0x6f,0x72,0x61,0x6e,0x67,0x65,0x72,0x65,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x36,0x39,0x2c,0x30,0x5d,0x2c,0x6f,0x72,0x63,0x68,0x69,0x64,0x3a,0x5b,0x32,0x31,0x38,0x2c,0x31,0x31,0x32,0x2c,0x32,0x31,0x34,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x67,0x6f,0x6c,0x64,0x65,0x6e,0x72,0x6f,0x64,0x3a,0x5b,0x32,0x33,0x38,0x2c,0x32,0x33,0x32,0x2c,0x31,0x37,0x30,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x35,0x32,0x2c,0x32,0x35,0x31,0x2c,0x31,0x35,0x32,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x31,0x37,0x35,0x2c,0x32,0x33,0x38,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x70,0x61,0x6c,0x65,0x76,0x69,0x6f,0x6c,0x65,0x74,0x72,0x65,0x64,0x3a,0x5b,0x32,0x31,0x39,0x2c,0x31,0x31,0x32,0x2c,0x31,0x34,0x37,0x5d,0x2c,0x70,0x61,0x70,0x61,0x79,0x61,0x77,0x68,0x69,0x70,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x33,0x39,0x2c,0x32,0x31,0x33,0x5d,0x2c,0x70,0x65,0x61,0x63,0x68,0x70,0x75,0x66,0x66,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x31,0x38,0x2c,0x31,0x38,0x35,0x5d,0x2c,0x70,0x65,0x72,0x75,0x3a,0x5b,0x32,0x30,0x35,0x2c,0x31,0x33,0x33,0x2c,0x36,0x33,0x5d,0x2c,0x70,0x69,0x6e,0x6b,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x31,0x39,0x32,0x2c,0x32,0x30,0x33,0x5d,0x2c,0x70,0x6c,0x75,0x6d,0x3a,0x5b,0x32,0x32,0x31,0x2c,0x31,0x36,0x30,0x2c,0x32,0x32,0x31,0x5d,0x2c,0x70,0x6f,0x77,0x64,0x65,0x72,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x37,0x36,0x2c,0x32,0x32,0x34,0x2c,0x32,0x33,0x30,0x5d,0x2c,0x70,0x75,0x72,0x70,0x6c,0x65,0x3a,0x5b,0x31,0x32,0x38,0x2c,0x30,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x72,0x65,0x62,0x65,0x63,0x63,0x61,0x70,0x75,0x72,0x70,0x6c,0x65,0x3a,0x5b,0x31,0x30,0x32,0x2c,0x35,0x31,0x2c,0x31,0x35,0x33,0x5d,0x2c,0x72,0x65,0x64,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x30,0x2c,0x30,0x5d,0x2c,0x72,0x6f,0x73,0x79,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x31,0x38,0x38,0x2c,0x31,0x34,0x33,0x2c,0x31,0x34,0x33,0x5d,0x2c,0x72,0x6f,0x79,0x61,0x6c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x36,0x35,0x2c,0x31,0x30,0x35,0x2c,0x32,0x32,0x35,0x5d,0x2c,0x73,0x61,0x64,0x64,0x6c,0x65,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x31,0x33,0x39,0x2c,0x36,0x39,0x2c,0x31,0x39,0x5d,0x2c,0x73,0x61,0x6c,0x6d,0x6f,0x6e,0x3a,0x5b,0x32,0x35,0x30,0x2c,0x31,0x32,0x38,0x2c,0x31,0x31,0x34,0x5d,0x2c,0x73,0x61,0x6e,0x64,0x79,0x62,0x72,0x6f,0x77,0x6e,0x3a,0x5b,0x32,0x34,0x34,0x2c,0x31,0x36,0x34,0x2c,0x39,0x36,0x5d,0x2c,0x73,0x65,0x61,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x34,0x36,0x2c,0x31,0x33,0x39,0x2c,0x38,0x37,0x5d,0x2c,0x73,0x65,0x61,0x73,0x68,0x65,0x6c,0x6c,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x34,0x35,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x73,0x69,0x65,0x6e,0x6e,0x61,0x3a,0x5b,0x31,0x36,0x30,0x2c,0x38,0x32,0x2c,0x34,0x35,0x5d,0x2c,0x73,0x69,0x6c,0x76,0x65,0x72,0x3a,0x5b,0x31,0x39,0x32,0x2c,0x31,0x39,0x32,0x2c,0x31,0x39,0x32,0x5d,0x2c,0x73,0x6b,0x79,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x33,0x35,0x2c,0x32,0x30,0x36,0x2c,0x32,0x33,0x35,0x5d,0x2c,0x73,0x6c,0x61,0x74,0x65,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x31,0x30,0x36,0x2c,0x39,0x30,0x2c,0x32,0x30,0x35,0x5d,0x2c,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x61,0x79,0x3a,0x5b,0x31,0x31,0x32,0x2c,0x31,0x32,0x38,0x2c,0x31,0x34,0x34,0x5d,0x2c,0x73,0x6c,0x61,0x74,0x65,0x67,0x72,0x65,0x79,0x3a,0x5b,0x31,0x31,0x32,0x2c,0x31,0x32,0x38,0x2c,0x31,0x34,0x34,0x5d,0x2c,0x73,0x6e,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x30,0x2c,0x32,0x35,0x30,0x5d,0x2c,0x73,0x70,0x72,0x69,0x6e,0x67,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x30,0x2c,0x32,0x35,0x35,0x2c,0x31,0x32,0x37,0x5d,0x2c,0x73,0x74,0x65,0x65,0x6c,0x62,0x6c,0x75,0x65,0x3a,0x5b,0x37,0x30,0x2c,0x31,0x33,0x30,0x2c,0x31,0x38,0x30,0x5d,0x2c,0x74,0x61,0x6e,0x3a,0x5b,0x32,0x31,0x30,0x2c,0x31,0x38,0x30,0x2c,0x31,0x34,0x30,0x5d,0x2c,0x74,0x65,0x61,0x6c,0x3a,0x5b,0x30,0x2c,0x31,0x32,0x38,0x2c,0x31,0x32,0x38,0x5d,0x2c,0x74,0x68,0x69,0x73,0x74,0x6c,0x65,0x3a,0x5b,0x32,0x31,0x36,0x2c,0x31,0x39,0x31,0x2c,0x32,0x31,0x36,0x5d,0x2c,0x74,0x6f,0x6d,0x61,0x74,0x6f,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x39,0x39,0x2c,0x37,0x31,0x5d,0x2c,0x74,0x75,0x72,0x71,0x75,0x6f,0x69,0x73,0x65,0x3a,0x5b,0x36,0x34,0x2c,0x32,0x32,0x34,0x2c,0x32,0x30,0x38,0x5d,0x2c,0x76,0x69,0x6f,0x6c,0x65,0x74,0x3a,0x5b,0x32,0x33,0x38,0x2c,0x31,0x33,0x30,0x2c,0x32,0x33,0x38,0x5d,0x2c,0x77,0x68,0x65,0x61,0x74,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x32,0x32,0x2c,0x31,0x37,0x39,0x5d,0x2c,0x77,0x68,0x69,0x74,0x65,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x5d,0x2c,0x77,0x68,0x69,0x74,0x65,0x73,0x6d,0x6f,0x6b,0x65,0x3a,0x5b,0x32,0x34,0x35,0x2c,0x32,0x34,0x35,0x2c,0x32,0x34,0x35,0x5d,0x2c,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x3a,0x5b,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x30,0x5d,0x2c,0x79,0x65,0x6c,0x6c,0x6f,0x77,0x67,0x72,0x65,0x65,0x6e,0x3a,0x5b,0x31,0x35,0x34,0x2c,0x32,0x30,0x35,0x2c,0x35,0x30,0x5d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x37,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x39,0x29,0x28,0x29,0x3b,0x69,0x2e,0x68,0x65,0x6c,0x70,0x65,0x72,0x73,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x74,0x28,0x32,0x37,0x29,0x28,0x69,0x29,0x2c,0x69,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x69,0x2e,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x69,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x69,0x2e,0x49,0x6e,0x74,0x65,0x72,0x61,0x63,0x74,0x69,0x6f,0x6e,0x3d,0x74,0x28,0x32,0x38,0x29,0x2c,0x69,0x2e,0x70,0x6c,0x61,0x74,0x66,0x6f,0x72,0x6d,0x3d,0x74,0x28,0x34,0x38,0x29,0x2c,0x74,0x28,0x33,0x31,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x32,0x32,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x32,0x33,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x32,0x34,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x33,0x30,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x33,0x33,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x33,0x32,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x33,0x35,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x34,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x32,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x33,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x35,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x36,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x37,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x35,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x36,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x37,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x38,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x39,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x32,0x30,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x32,0x31,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x38,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x39,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x30,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x31,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x32,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x33,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x31,0x34,0x29,0x28,0x69,0x29,0x3b,0x76,0x61,0x72,0x20,0x61,0x3d,0x5b,0x5d,0x3b,0x61,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x28,0x34,0x39,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x30,0x29,0x28,0x69,0x29,0x2c,0x74,0x28,0x35,0x31,0x29,0x28,0x69,0x29,0x29,0x2c,0x69,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x28,0x61,0x29,0x2c,0x69,0x2e,0x70,0x6c,0x61,0x74,0x66,0x6f,0x72,0x6d,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x28,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x69,0x2c,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x26,0x26,0x28,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x43,0x68,0x61,0x72,0x74,0x3d,0x69,0x29,0x2c,0x69,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x48,0x65,0x6c,0x70,0x65,0x72,0x73,0x3d,0x69,0x2e,0x68,0x65,0x6c,0x70,0x65,0x72,0x73,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x7d,0x2c,0x7b,0x31,0x30,0x3a,0x31,0x30,0x2c,0x31,0x31,0x3a,0x31,0x31,0x2c,0x31,0x32,0x3a,0x31,0x32,0x2c,0x31,0x33,0x3a,0x31,0x33,0x2c,0x31,0x34,0x3a,0x31,0x34,0x2c,0x31,0x35,0x3a,0x31,0x35,0x2c,0x31,0x36,0x3a,0x31,0x36,0x2c,0x31,0x37,0x3a,0x31,0x37,0x2c,0x31,0x38,0x3a,0x31,0x38,0x2c,0x31,0x39,0x3a,0x31,0x39,0x2c,0x32,0x30,0x3a,0x32,0x30,0x2c,0x32,0x31,0x3a,0x32,0x31,0x2c,0x32,0x32,0x3a,0x32,0x32,0x2c,0x32,0x33,0x3a,0x32,0x33,0x2c,0x32,0x34,0x3a,0x32,0x34,0x2c,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x32,0x37,0x3a,0x32,0x37,0x2c,0x32,0x38,0x3a,0x32,0x38,0x2c,0x32,0x39,0x3a,0x32,0x39,0x2c,0x33,0x30,0x3a,0x33,0x30,0x2c,0x33,0x31,0x3a,0x33,0x31,0x2c,0x33,0x32,0x3a,0x33,0x32,0x2c,0x33,0x33,0x3a,0x33,0x33,0x2c,0x33,0x35,0x3a,0x33,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x2c,0x34,0x38,0x3a,0x34,0x38,0x2c,0x34,0x39,0x3a,0x34,0x39,0x2c,0x35,0x30,0x3a,0x35,0x30,0x2c,0x35,0x31,0x3a,0x35,0x31,0x2c,0x35,0x32,0x3a,0x35,0x32,0x2c,0x35,0x33,0x3a,0x35,0x33,0x2c,0x35,0x34,0x3a,0x35,0x34,0x2c,0x35,0x35,0x3a,0x35,0x35,0x2c,0x35,0x36,0x3a,0x35,0x36,0x2c,0x35,0x37,0x3a,0x35,0x37,0x2c,0x38,0x3a,0x38,0x2c,0x39,0x3a,0x39,0x7d,0x5d,0x2c,0x38,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x42,0x61,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x62,0x61,0x72,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x39,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x42,0x75,0x62,0x62,0x6c,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x62,0x75,0x62,0x62,0x6c,0x65,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x31,0x30,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x44,0x6f,0x75,0x67,0x68,0x6e,0x75,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x64,0x6f,0x75,0x67,0x68,0x6e,0x75,0x74,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x31,0x31,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x4c,0x69,0x6e,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x6c,0x69,0x6e,0x65,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x31,0x32,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x50,0x6f,0x6c,0x61,0x72,0x41,0x72,0x65,0x61,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x70,0x6f,0x6c,0x61,0x72,0x41,0x72,0x65,0x61,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x31,0x33,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x52,0x61,0x64,0x61,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x72,0x61,0x64,0x61,0x72,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x31,0x34,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x53,0x63,0x61,0x74,0x74,0x65,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x79,0x70,0x65,0x3d,0x22,0x73,0x63,0x61,0x74,0x74,0x65,0x72,0x22,0x2c,0x6e,0x65,0x77,0x20,0x74,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x31,0x35,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x62,0x61,0x72,0x22,0x2c,0x7b,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x6c,0x61,0x62,0x65,0x6c,0x22,0x7d,0x2c,0x73,0x63,0x61,0x6c,0x65,0x73,0x3a,0x7b,0x78,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x22,0x2c,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x2e,0x38,0x2c,0x62,0x61,0x72,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x2e,0x39,0x2c,0x6f,0x66,0x66,0x73,0x65,0x74,0x3a,0x21,0x30,0x2c,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x6f,0x66,0x66,0x73,0x65,0x74,0x47,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x21,0x30,0x7d,0x7d,0x5d,0x2c,0x79,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x7d,0x5d,0x7d,0x7d,0x29,0x2c,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x42,0x61,0x72,0x22,0x2c,0x7b,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x69,0x6e,0x64,0x65,0x78,0x22,0x2c,0x61,0x78,0x69,0x73,0x3a,0x22,0x79,0x22,0x7d,0x2c,0x73,0x63,0x61,0x6c,0x65,0x73,0x3a,0x7b,0x78,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x7d,0x5d,0x2c,0x79,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x74,0x79,0x70,0x65,0x3a,0x22,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x22,0x2c,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x2e,0x38,0x2c,0x62,0x61,0x72,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x2e,0x39,0x2c,0x6f,0x66,0x66,0x73,0x65,0x74,0x3a,0x21,0x30,0x2c,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x6f,0x66,0x66,0x73,0x65,0x74,0x47,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x21,0x30,0x7d,0x7d,0x5d,0x7d,0x2c,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x72,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x3a,0x7b,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x7d,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x3a,0x7b,0x74,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x22,0x22,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x26,0x26,0x28,0x74,0x5b,0x30,0x5d,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x3f,0x6e,0x3d,0x74,0x5b,0x30,0x5d,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x26,0x26,0x74,0x5b,0x30,0x5d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x3c,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x6e,0x3d,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x74,0x5b,0x30,0x5d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x29,0x29,0x2c,0x6e,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x7c,0x7c,0x22,0x22,0x29,0x2b,0x22,0x3a,0x20,0x22,0x2b,0x74,0x2e,0x78,0x4c,0x61,0x62,0x65,0x6c,0x7d,0x7d,0x2c,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x69,0x6e,0x64,0x65,0x78,0x22,0x2c,0x61,0x78,0x69,0x73,0x3a,0x22,0x79,0x22,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x62,0x61,0x72,0x3d,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x52,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x2c,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x3b,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x6e,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x28,0x65,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x29,0x2e,0x73,0x74,0x61,0x63,0x6b,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2e,0x73,0x74,0x61,0x63,0x6b,0x2c,0x65,0x2e,0x62,0x61,0x72,0x3d,0x21,0x30,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x3b,0x66,0x6f,0x72,0x28,0x69,0x2e,0x5f,0x72,0x75,0x6c,0x65,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x52,0x75,0x6c,0x65,0x72,0x28,0x29,0x2c,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x61,0x5b,0x65,0x5d,0x2c,0x65,0x2c,0x74,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x6c,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x73,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x75,0x3d,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x72,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x3b,0x74,0x2e,0x5f,0x78,0x53,0x63,0x61,0x6c,0x65,0x3d,0x69,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x72,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x74,0x2e,0x5f,0x79,0x53,0x63,0x61,0x6c,0x65,0x3d,0x69,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x72,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3d,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3d,0x65,0x2c,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x7b,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x6c,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x61,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x65,0x5d,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x3f,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x3a,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2c,0x75,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2c,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x65,0x2c,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x2c,0x69,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x47,0x65,0x6f,0x6d,0x65,0x74,0x72,0x79,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x2c,0x74,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x47,0x65,0x6f,0x6d,0x65,0x74,0x72,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x6f,0x3d,0x69,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x28,0x29,0x2c,0x72,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x28,0x29,0x2c,0x6c,0x3d,0x6f,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x73,0x3d,0x69,0x2e,0x5f,0x72,0x75,0x6c,0x65,0x72,0x7c,0x7c,0x69,0x2e,0x67,0x65,0x74,0x52,0x75,0x6c,0x65,0x72,0x28,0x29,0x2c,0x75,0x3d,0x69,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x42,0x61,0x72,0x56,0x61,0x6c,0x75,0x65,0x50,0x69,0x78,0x65,0x6c,0x73,0x28,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x65,0x29,0x2c,0x64,0x3d,0x69,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x42,0x61,0x72,0x49,0x6e,0x64,0x65,0x78,0x50,0x69,0x78,0x65,0x6c,0x73,0x28,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x65,0x2c,0x73,0x29,0x3b,0x61,0x2e,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3d,0x6c,0x2c,0x61,0x2e,0x62,0x61,0x73,0x65,0x3d,0x6e,0x3f,0x72,0x3a,0x75,0x2e,0x62,0x61,0x73,0x65,0x2c,0x61,0x2e,0x78,0x3d,0x6c,0x3f,0x6e,0x3f,0x72,0x3a,0x75,0x2e,0x68,0x65,0x61,0x64,0x3a,0x64,0x2e,0x63,0x65,0x6e,0x74,0x65,0x72,0x2c,0x61,0x2e,0x79,0x3d,0x6c,0x3f,0x64,0x2e,0x63,0x65,0x6e,0x74,0x65,0x72,0x3a,0x6e,0x3f,0x72,0x3a,0x75,0x2e,0x68,0x65,0x61,0x64,0x2c,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x6c,0x3f,0x64,0x2e,0x73,0x69,0x7a,0x65,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x2c,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x6c,0x3f,0x76,0x6f,0x69,0x64,0x20,0x30,0x3a,0x64,0x2e,0x73,0x69,0x7a,0x65,0x7d,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x7d,0x2c,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x7d,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x28,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x53,0x63,0x61,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x28,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x53,0x74,0x61,0x63,0x6b,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x6f,0x3d,0x69,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x53,0x63,0x61,0x6c,0x65,0x28,0x29,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x2c,0x72,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x61,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3a,0x74,0x2b,0x31,0x2c,0x6c,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x3b,0x65,0x3c,0x72,0x3b,0x2b,0x2b,0x65,0x29,0x28,0x6e,0x3d,0x61,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x65,0x29,0x29,0x2e,0x62,0x61,0x72,0x26,0x26,0x61,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x65,0x29,0x26,0x26,0x28,0x21,0x31,0x3d,0x3d,0x3d,0x6f,0x7c,0x7c,0x21,0x30,0x3d,0x3d,0x3d,0x6f,0x26,0x26,0x2d,0x31,0x3d,0x3d,0x3d,0x6c,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x29,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6f,0x26,0x26,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x7c,0x7c,0x2d,0x31,0x3d,0x3d,0x3d,0x6c,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x29,0x29,0x29,0x26,0x26,0x6c,0x2e,0x70,0x75,0x73,0x68,0x28,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7d,0x2c,0x67,0x65,0x74,0x53,0x74,0x61,0x63,0x6b,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x53,0x74,0x61,0x63,0x6b,0x43,0x6f,0x75,0x6e,0x74,0x28,0x74,0x29,0x2d,0x31,0x7d,0x2c,0x67,0x65,0x74,0x52,0x75,0x6c,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x53,0x63,0x61,0x6c,0x65,0x28,0x29,0x2c,0x61,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x53,0x74,0x61,0x63,0x6b,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0x2c,0x6f,0x3d,0x6e,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x72,0x3d,0x5b,0x5d,0x2c,0x6c,0x3d,0x69,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x73,0x3d,0x6c,0x3f,0x69,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x69,0x2e,0x74,0x6f,0x70,0x2c,0x75,0x3d,0x73,0x2b,0x28,0x6c,0x3f,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x69,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x3b,0x66,0x6f,0x72,0x28,0x74,0x3d,0x30,0x2c,0x65,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x74,0x3c,0x65,0x3b,0x2b,0x2b,0x74,0x29,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x69,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x6e,0x75,0x6c,0x6c,0x2c,0x74,0x2c,0x6f,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x70,0x69,0x78,0x65,0x6c,0x73,0x3a,0x72,0x2c,0x73,0x74,0x61,0x72,0x74,0x3a,0x73,0x2c,0x65,0x6e,0x64,0x3a,0x75,0x2c,0x73,0x74,0x61,0x63,0x6b,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x61,0x2c,0x73,0x63,0x61,0x6c,0x65,0x3a,0x69,0x7d,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x42,0x61,0x72,0x56,0x61,0x6c,0x75,0x65,0x50,0x69,0x78,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x3d,0x74,0x68,0x69,0x73,0x2c,0x75,0x3d,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x64,0x3d,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x63,0x3d,0x73,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x28,0x29,0x2c,0x68,0x3d,0x75,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x66,0x3d,0x63,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x68,0x5b,0x74,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x2c,0x67,0x3d,0x63,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x2c,0x70,0x3d,0x64,0x2e,0x73,0x74,0x61,0x63,0x6b,0x2c,0x76,0x3d,0x30,0x3b,0x69,0x66,0x28,0x67,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x67,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x70,0x29,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x3b,0x2b,0x2b,0x6e,0x29,0x28,0x69,0x3d,0x75,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x29,0x2e,0x62,0x61,0x72,0x26,0x26,0x69,0x2e,0x73,0x74,0x61,0x63,0x6b,0x3d,0x3d,0x3d,0x70,0x26,0x26,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x28,0x29,0x3d,0x3d,0x3d,0x63,0x2e,0x69,0x64,0x26,0x26,0x75,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x26,0x26,0x28,0x61,0x3d,0x63,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x68,0x5b,0x6e,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x2c,0x28,0x66,0x3c,0x30,0x26,0x26,0x61,0x3c,0x30,0x7c,0x7c,0x66,0x3e,0x3d,0x30,0x26,0x26,0x61,0x3e,0x30,0x29,0x26,0x26,0x28,0x76,0x2b,0x3d,0x61,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3d,0x63,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x76,0x29,0x2c,0x72,0x3d,0x63,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x76,0x2b,0x66,0x29,0x2c,0x6c,0x3d,0x28,0x72,0x2d,0x6f,0x29,0x2f,0x32,0x2c,0x7b,0x73,0x69,0x7a,0x65,0x3a,0x6c,0x2c,0x62,0x61,0x73,0x65,0x3a,0x6f,0x2c,0x68,0x65,0x61,0x64,0x3a,0x72,0x2c,0x63,0x65,0x6e,0x74,0x65,0x72,0x3a,0x72,0x2b,0x6c,0x2f,0x32,0x7d,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x42,0x61,0x72,0x49,0x6e,0x64,0x65,0x78,0x50,0x69,0x78,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x3d,0x74,0x68,0x69,0x73,0x2c,0x63,0x3d,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x68,0x3d,0x64,0x2e,0x67,0x65,0x74,0x53,0x74,0x61,0x63,0x6b,0x49,0x6e,0x64,0x65,0x78,0x28,0x74,0x29,0x2c,0x66,0x3d,0x6e,0x2e,0x70,0x69,0x78,0x65,0x6c,0x73,0x2c,0x67,0x3d,0x66,0x5b,0x65,0x5d,0x2c,0x70,0x3d,0x66,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x76,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x72,0x74,0x2c,0x6d,0x3d,0x6e,0x2e,0x65,0x6e,0x64,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x3d,0x3d,0x3d,0x70,0x3f,0x28,0x69,0x3d,0x67,0x3e,0x76,0x3f,0x67,0x2d,0x76,0x3a,0x6d,0x2d,0x67,0x2c,0x61,0x3d,0x67,0x3c,0x6d,0x3f,0x6d,0x2d,0x67,0x3a,0x67,0x2d,0x76,0x29,0x3a,0x28,0x65,0x3e,0x30,0x26,0x26,0x28,0x69,0x3d,0x28,0x67,0x2d,0x66,0x5b,0x65,0x2d,0x31,0x5d,0x29,0x2f,0x32,0x2c,0x65,0x3d,0x3d,0x3d,0x70,0x2d,0x31,0x26,0x26,0x28,0x61,0x3d,0x69,0x29,0x29,0x2c,0x65,0x3c,0x70,0x2d,0x31,0x26,0x26,0x28,0x61,0x3d,0x28,0x66,0x5b,0x65,0x2b,0x31,0x5d,0x2d,0x67,0x29,0x2f,0x32,0x2c,0x30,0x3d,0x3d,0x3d,0x65,0x26,0x26,0x28,0x69,0x3d,0x61,0x29,0x29,0x29,0x2c,0x72,0x3d,0x69,0x2a,0x63,0x2e,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x2c,0x6c,0x3d,0x61,0x2a,0x63,0x2e,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x2c,0x73,0x3d,0x28,0x72,0x2b,0x6c,0x29,0x2f,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x43,0x6f,0x75,0x6e,0x74,0x2c,0x75,0x3d,0x73,0x2a,0x63,0x2e,0x62,0x61,0x72,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x2c,0x75,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x63,0x2e,0x62,0x61,0x72,0x54,0x68,0x69,0x63,0x6b,0x6e,0x65,0x73,0x73,0x2c,0x75,0x29,0x2c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x63,0x2e,0x6d,0x61,0x78,0x42,0x61,0x72,0x54,0x68,0x69,0x63,0x6b,0x6e,0x65,0x73,0x73,0x2c,0x31,0x2f,0x30,0x29,0x29,0x2c,0x67,0x2d,0x3d,0x72,0x2c,0x67,0x2b,0x3d,0x73,0x2a,0x68,0x2c,0x67,0x2b,0x3d,0x28,0x73,0x2d,0x75,0x29,0x2f,0x32,0x2c,0x7b,0x73,0x69,0x7a,0x65,0x3a,0x75,0x2c,0x62,0x61,0x73,0x65,0x3a,0x67,0x2c,0x68,0x65,0x61,0x64,0x3a,0x67,0x2b,0x75,0x2c,0x63,0x65,0x6e,0x74,0x65,0x72,0x3a,0x67,0x2b,0x75,0x2f,0x32,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x6e,0x3d,0x74,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x28,0x29,0x2c,0x69,0x3d,0x74,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2c,0x61,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x72,0x3d,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x6c,0x3d,0x30,0x3b,0x66,0x6f,0x72,0x28,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x28,0x65,0x2e,0x63,0x74,0x78,0x2c,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x29,0x3b,0x6c,0x3c,0x72,0x3b,0x2b,0x2b,0x6c,0x29,0x69,0x73,0x4e,0x61,0x4e,0x28,0x6e,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6c,0x5d,0x29,0x29,0x7c,0x7c,0x69,0x5b,0x6c,0x5d,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x3b,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x75,0x6e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x28,0x65,0x2e,0x63,0x74,0x78,0x29,0x7d,0x2c,0x73,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x69,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x69,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x72,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x3b,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x69,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2c,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x42,0x61,0x72,0x3d,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x62,0x61,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x7d,0x2c,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x53,0x63,0x61,0x6c,0x65,0x49,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x31,0x36,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x62,0x75,0x62,0x62,0x6c,0x65,0x22,0x2c,0x7b,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x73,0x69,0x6e,0x67,0x6c,0x65,0x22,0x7d,0x2c,0x73,0x63,0x61,0x6c,0x65,0x73,0x3a,0x7b,0x78,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x2c,0x69,0x64,0x3a,0x22,0x78,0x2d,0x61,0x78,0x69,0x73,0x2d,0x30,0x22,0x7d,0x5d,0x2c,0x79,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x69,0x64,0x3a,0x22,0x79,0x2d,0x61,0x78,0x69,0x73,0x2d,0x30,0x22,0x7d,0x5d,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x3a,0x7b,0x74,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x22,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x7c,0x7c,0x22,0x22,0x2c,0x69,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2b,0x22,0x3a,0x20,0x28,0x22,0x2b,0x74,0x2e,0x78,0x4c,0x61,0x62,0x65,0x6c,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x69,0x2e,0x72,0x2b,0x22,0x29,0x22,0x7d,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x62,0x75,0x62,0x62,0x6c,0x65,0x3d,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x50,0x6f,0x69,0x6e,0x74,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x3b,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x6e,0x2c,0x69,0x2c,0x74,0x29,0x7d,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x6f,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x61,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x6c,0x3d,0x69,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x61,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x73,0x3d,0x69,0x2e,0x5f,0x72,0x65,0x73,0x6f,0x6c,0x76,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x28,0x74,0x2c,0x65,0x29,0x2c,0x75,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x2c,0x64,0x3d,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x63,0x3d,0x6e,0x3f,0x72,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x44,0x65,0x63,0x69,0x6d,0x61,0x6c,0x28,0x2e,0x35,0x29,0x3a,0x72,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x75,0x3f,0x75,0x3a,0x4e,0x61,0x4e,0x2c,0x65,0x2c,0x64,0x29,0x2c,0x68,0x3d,0x6e,0x3f,0x6c,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x28,0x29,0x3a,0x6c,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x75,0x2c,0x65,0x2c,0x64,0x29,0x3b,0x74,0x2e,0x5f,0x78,0x53,0x63,0x61,0x6c,0x65,0x3d,0x72,0x2c,0x74,0x2e,0x5f,0x79,0x53,0x63,0x61,0x6c,0x65,0x3d,0x6c,0x2c,0x74,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x73,0x2c,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3d,0x64,0x2c,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3d,0x65,0x2c,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x7b,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x73,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x6e,0x3f,0x30,0x3a,0x73,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2c,0x73,0x6b,0x69,0x70,0x3a,0x6f,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x63,0x29,0x7c,0x7c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x68,0x29,0x2c,0x78,0x3a,0x63,0x2c,0x79,0x3a,0x68,0x7d,0x2c,0x74,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x7d,0x2c,0x73,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2c,0x65,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2b,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x65,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x7d,0x2c,0x5f,0x72,0x65,0x73,0x6f,0x6c,0x76,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x73,0x3d,0x6c,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x72,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x75,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x64,0x3d,0x6c,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2c,0x63,0x3d,0x6f,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x72,0x65,0x73,0x6f,0x6c,0x76,0x65,0x2c,0x68,0x3d,0x73,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x2c,0x66,0x3d,0x7b,0x7d,0x2c,0x67,0x3d,0x7b,0x63,0x68,0x61,0x72,0x74,0x3a,0x6c,0x2c,0x64,0x61,0x74,0x61,0x49,0x6e,0x64,0x65,0x78,0x3a,0x65,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x73,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x72,0x2e,0x69,0x6e,0x64,0x65,0x78,0x7d,0x2c,0x70,0x3d,0x5b,0x22,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x22,0x2c,0x22,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x22,0x2c,0x22,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x22,0x2c,0x22,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x22,0x2c,0x22,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x22,0x2c,0x22,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x22,0x2c,0x22,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x22,0x2c,0x22,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x22,0x2c,0x22,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x22,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x70,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x66,0x5b,0x61,0x3d,0x70,0x5b,0x6e,0x5d,0x5d,0x3d,0x63,0x28,0x5b,0x75,0x5b,0x61,0x5d,0x2c,0x73,0x5b,0x61,0x5d,0x2c,0x64,0x5b,0x61,0x5d,0x5d,0x2c,0x67,0x2c,0x65,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x63,0x28,0x5b,0x75,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2c,0x68,0x3f,0x68,0x2e,0x72,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x2c,0x73,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2c,0x64,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x5d,0x2c,0x67,0x2c,0x65,0x29,0x2c,0x66,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x31,0x37,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x64,0x6f,0x75,0x67,0x68,0x6e,0x75,0x74,0x22,0x2c,0x7b,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x7b,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x52,0x6f,0x74,0x61,0x74,0x65,0x3a,0x21,0x30,0x2c,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x53,0x63,0x61,0x6c,0x65,0x3a,0x21,0x31,0x7d,0x2c,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x73,0x69,0x6e,0x67,0x6c,0x65,0x22,0x7d,0x2c,0x6c,0x65,0x67,0x65,0x6e,0x64,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x5b,0x5d,0x3b,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x27,0x3c,0x75,0x6c,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x27,0x2b,0x74,0x2e,0x69,0x64,0x2b,0x27,0x2d,0x6c,0x65,0x67,0x65,0x6e,0x64,0x22,0x3e,0x27,0x29,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x2c,0x69,0x3d,0x6e,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3b,0x69,0x66,0x28,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6f,0x3d,0x30,0x3b,0x6f,0x3c,0x69,0x5b,0x30,0x5d,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x6f,0x29,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x27,0x3c,0x6c,0x69,0x3e,0x3c,0x73,0x70,0x61,0x6e,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x27,0x2b,0x69,0x5b,0x30,0x5d,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x5b,0x6f,0x5d,0x2b,0x27,0x22,0x3e,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0x27,0x29,0x2c,0x61,0x5b,0x6f,0x5d,0x26,0x26,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x61,0x5b,0x6f,0x5d,0x29,0x2c,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x22,0x3c,0x2f,0x6c,0x69,0x3e,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x22,0x3c,0x2f,0x75,0x6c,0x3e,0x22,0x29,0x2c,0x65,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x22,0x29,0x7d,0x2c,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3a,0x7b,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x7b,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x65,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3f,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x30,0x29,0x2c,0x72,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x30,0x5d,0x2c,0x6c,0x3d,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x2c,0x73,0x3d,0x6c,0x26,0x26,0x6c,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x75,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x64,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x61,0x72,0x63,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x74,0x65,0x78,0x74,0x3a,0x6e,0x2c,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3a,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x75,0x28,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x64,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x75,0x28,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x64,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3a,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x75,0x28,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x69,0x2c,0x64,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2c,0x68,0x69,0x64,0x64,0x65,0x6e,0x3a,0x69,0x73,0x4e,0x61,0x4e,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x29,0x7c,0x7c,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x2c,0x69,0x6e,0x64,0x65,0x78,0x3a,0x69,0x7d,0x7d,0x29,0x3a,0x5b,0x5d,0x7d,0x7d,0x2c,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x3d,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x28,0x61,0x3d,0x72,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x29,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6f,0x5d,0x26,0x26,0x28,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6f,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3d,0x21,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6f,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x29,0x3b,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x7d,0x7d,0x2c,0x63,0x75,0x74,0x6f,0x75,0x74,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x35,0x30,0x2c,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x2d,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2c,0x63,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x3a,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x3a,0x7b,0x74,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x22,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x69,0x3d,0x22,0x3a,0x20,0x22,0x2b,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x6e,0x29,0x3f,0x28,0x6e,0x3d,0x6e,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x29,0x29,0x5b,0x30,0x5d,0x2b,0x3d,0x69,0x3a,0x6e,0x2b,0x3d,0x69,0x2c,0x6e,0x7d,0x7d,0x7d,0x7d,0x29,0x2c,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x70,0x69,0x65,0x22,0x2c,0x6f,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x69,0x2e,0x64,0x6f,0x75,0x67,0x68,0x6e,0x75,0x74,0x29,0x29,0x2c,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x70,0x69,0x65,0x22,0x2c,0x7b,0x63,0x75,0x74,0x6f,0x75,0x74,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x30,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x64,0x6f,0x75,0x67,0x68,0x6e,0x75,0x74,0x3d,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x70,0x69,0x65,0x3d,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x41,0x72,0x63,0x2c,0x6c,0x69,0x6e,0x6b,0x53,0x63,0x61,0x6c,0x65,0x73,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x67,0x65,0x74,0x52,0x69,0x6e,0x67,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x3b,0x2b,0x2b,0x6e,0x29,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x26,0x26,0x2b,0x2b,0x65,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x69,0x3d,0x6e,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x61,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x72,0x3d,0x61,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x61,0x72,0x63,0x2c,0x6c,0x3d,0x69,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x69,0x2e,0x6c,0x65,0x66,0x74,0x2d,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x73,0x3d,0x69,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x69,0x2e,0x74,0x6f,0x70,0x2d,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x75,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6c,0x2c,0x73,0x29,0x2c,0x64,0x3d,0x7b,0x78,0x3a,0x30,0x2c,0x79,0x3a,0x30,0x7d,0x2c,0x63,0x3d,0x65,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x68,0x3d,0x61,0x2e,0x63,0x75,0x74,0x6f,0x75,0x74,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x2c,0x66,0x3d,0x61,0x2e,0x63,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x3b,0x69,0x66,0x28,0x66,0x3c,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x7b,0x76,0x61,0x72,0x20,0x67,0x3d,0x61,0x2e,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x25,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2c,0x70,0x3d,0x28,0x67,0x2b,0x3d,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x28,0x67,0x3e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3f,0x2d,0x31,0x3a,0x67,0x3c,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3f,0x31,0x3a,0x30,0x29,0x29,0x2b,0x66,0x2c,0x76,0x3d,0x7b,0x78,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x67,0x29,0x2c,0x79,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x67,0x29,0x7d,0x2c,0x6d,0x3d,0x7b,0x78,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x70,0x29,0x2c,0x79,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x70,0x29,0x7d,0x2c,0x62,0x3d,0x67,0x3c,0x3d,0x30,0x26,0x26,0x70,0x3e,0x3d,0x30,0x7c,0x7c,0x67,0x3c,0x3d,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x2c,0x78,0x3d,0x67,0x3c,0x3d,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x7c,0x7c,0x67,0x3c,0x3d,0x32,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x32,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x2c,0x79,0x3d,0x67,0x3c,0x3d,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x7c,0x7c,0x67,0x3c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x2c,0x6b,0x3d,0x67,0x3c,0x3d,0x2e,0x35,0x2a,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x2e,0x35,0x2a,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x7c,0x7c,0x67,0x3c,0x3d,0x31,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x31,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3c,0x3d,0x70,0x2c,0x77,0x3d,0x68,0x2f,0x31,0x30,0x30,0x2c,0x4d,0x3d,0x7b,0x78,0x3a,0x79,0x3f,0x2d,0x31,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x76,0x2e,0x78,0x2a,0x28,0x76,0x2e,0x78,0x3c,0x30,0x3f,0x31,0x3a,0x77,0x29,0x2c,0x6d,0x2e,0x78,0x2a,0x28,0x6d,0x2e,0x78,0x3c,0x30,0x3f,0x31,0x3a,0x77,0x29,0x29,0x2c,0x79,0x3a,0x6b,0x3f,0x2d,0x31,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x76,0x2e,0x79,0x2a,0x28,0x76,0x2e,0x79,0x3c,0x30,0x3f,0x31,0x3a,0x77,0x29,0x2c,0x6d,0x2e,0x79,0x2a,0x28,0x6d,0x2e,0x79,0x3c,0x30,0x3f,0x31,0x3a,0x77,0x29,0x29,0x7d,0x2c,0x53,0x3d,0x7b,0x78,0x3a,0x62,0x3f,0x31,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x76,0x2e,0x78,0x2a,0x28,0x76,0x2e,0x78,0x3e,0x30,0x3f,0x31,0x3a,0x77,0x29,0x2c,0x6d,0x2e,0x78,0x2a,0x28,0x6d,0x2e,0x78,0x3e,0x30,0x3f,0x31,0x3a,0x77,0x29,0x29,0x2c,0x79,0x3a,0x78,0x3f,0x31,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x76,0x2e,0x79,0x2a,0x28,0x76,0x2e,0x79,0x3e,0x30,0x3f,0x31,0x3a,0x77,0x29,0x2c,0x6d,0x2e,0x79,0x2a,0x28,0x6d,0x2e,0x79,0x3e,0x30,0x3f,0x31,0x3a,0x77,0x29,0x29,0x7d,0x2c,0x43,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x2e,0x35,0x2a,0x28,0x53,0x2e,0x78,0x2d,0x4d,0x2e,0x78,0x29,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x2e,0x35,0x2a,0x28,0x53,0x2e,0x79,0x2d,0x4d,0x2e,0x79,0x29,0x7d,0x3b,0x75,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6c,0x2f,0x43,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x73,0x2f,0x43,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x64,0x3d,0x7b,0x78,0x3a,0x2d,0x2e,0x35,0x2a,0x28,0x53,0x2e,0x78,0x2b,0x4d,0x2e,0x78,0x29,0x2c,0x79,0x3a,0x2d,0x2e,0x35,0x2a,0x28,0x53,0x2e,0x79,0x2b,0x4d,0x2e,0x79,0x29,0x7d,0x7d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x65,0x2e,0x67,0x65,0x74,0x4d,0x61,0x78,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x28,0x63,0x2e,0x64,0x61,0x74,0x61,0x29,0x2c,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x28,0x75,0x2d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2f,0x32,0x2c,0x30,0x29,0x2c,0x6e,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x68,0x3f,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2f,0x31,0x30,0x30,0x2a,0x68,0x3a,0x30,0x2c,0x30,0x29,0x2c,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x4c,0x65,0x6e,0x67,0x74,0x68,0x3d,0x28,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x6e,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2f,0x6e,0x2e,0x67,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0x2c,0x6e,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x58,0x3d,0x64,0x2e,0x78,0x2a,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x6e,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x59,0x3d,0x64,0x2e,0x79,0x2a,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x63,0x2e,0x74,0x6f,0x74,0x61,0x6c,0x3d,0x65,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x6f,0x74,0x61,0x6c,0x28,0x29,0x2c,0x65,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x4c,0x65,0x6e,0x67,0x74,0x68,0x2a,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x6e,0x67,0x49,0x6e,0x64,0x65,0x78,0x28,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x29,0x2c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x4c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x30,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x63,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x6e,0x2c,0x69,0x2c,0x74,0x29,0x7d,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x72,0x3d,0x61,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x6c,0x3d,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x73,0x3d,0x6c,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x75,0x3d,0x28,0x72,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x72,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x2f,0x32,0x2c,0x64,0x3d,0x28,0x72,0x2e,0x74,0x6f,0x70,0x2b,0x72,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x2f,0x32,0x2c,0x63,0x3d,0x6c,0x2e,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x68,0x3d,0x6c,0x2e,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x66,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x67,0x3d,0x6e,0x26,0x26,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x52,0x6f,0x74,0x61,0x74,0x65,0x3f,0x30,0x3a,0x74,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3f,0x30,0x3a,0x69,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x43,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x28,0x66,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x2a,0x28,0x6c,0x2e,0x63,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x2f,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x29,0x2c,0x70,0x3d,0x6e,0x26,0x26,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x53,0x63,0x61,0x6c,0x65,0x3f,0x30,0x3a,0x69,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x76,0x3d,0x6e,0x26,0x26,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x53,0x63,0x61,0x6c,0x65,0x3f,0x30,0x3a,0x69,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x6d,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3b,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x2c,0x7b,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3a,0x65,0x2c,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3a,0x7b,0x78,0x3a,0x75,0x2b,0x61,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x58,0x2c,0x79,0x3a,0x64,0x2b,0x61,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x59,0x2c,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x63,0x2c,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x68,0x2c,0x63,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x3a,0x67,0x2c,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x76,0x2c,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x70,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x6d,0x28,0x66,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x2c,0x65,0x2c,0x61,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x65,0x5d,0x29,0x7d,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x62,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x74,0x68,0x69,0x73,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x28,0x74,0x29,0x2c,0x6e,0x26,0x26,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x52,0x6f,0x74,0x61,0x74,0x65,0x7c,0x7c,0x28,0x62,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x3d,0x30,0x3d,0x3d,0x3d,0x65,0x3f,0x6c,0x2e,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x69,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x2d,0x31,0x5d,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x2c,0x62,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x3d,0x62,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x2b,0x62,0x2e,0x63,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x29,0x2c,0x74,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x68,0x69,0x73,0x2c,0x65,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x61,0x72,0x63,0x29,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x6f,0x74,0x61,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x69,0x3d,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x61,0x29,0x7b,0x74,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x5b,0x61,0x5d,0x2c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x29,0x7c,0x7c,0x6e,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x28,0x69,0x2b,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x74,0x29,0x29,0x7d,0x29,0x2c,0x69,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x43,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x74,0x6f,0x74,0x61,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3e,0x30,0x26,0x26,0x21,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x29,0x3f,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x28,0x74,0x2f,0x65,0x29,0x3a,0x30,0x7d,0x2c,0x67,0x65,0x74,0x4d,0x61,0x78,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x30,0x2c,0x61,0x3d,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x6f,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x72,0x3d,0x30,0x3b,0x72,0x3c,0x6f,0x3b,0x72,0x2b,0x2b,0x29,0x65,0x3d,0x74,0x5b,0x72,0x5d,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3f,0x74,0x5b,0x72,0x5d,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x30,0x2c,0x69,0x3d,0x28,0x6e,0x3d,0x74,0x5b,0x72,0x5d,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x3f,0x74,0x5b,0x72,0x5d,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x61,0x5d,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x30,0x29,0x3e,0x28,0x69,0x3d,0x65,0x3e,0x69,0x3f,0x65,0x3a,0x69,0x29,0x3f,0x6e,0x3a,0x69,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x31,0x38,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x6c,0x69,0x6e,0x65,0x22,0x2c,0x7b,0x73,0x68,0x6f,0x77,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x21,0x30,0x2c,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x3a,0x21,0x31,0x2c,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x6c,0x61,0x62,0x65,0x6c,0x22,0x7d,0x2c,0x73,0x63,0x61,0x6c,0x65,0x73,0x3a,0x7b,0x78,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x22,0x2c,0x69,0x64,0x3a,0x22,0x78,0x2d,0x61,0x78,0x69,0x73,0x2d,0x30,0x22,0x7d,0x5d,0x2c,0x79,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x69,0x64,0x3a,0x22,0x79,0x2d,0x61,0x78,0x69,0x73,0x2d,0x30,0x22,0x7d,0x5d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x74,0x2e,0x73,0x68,0x6f,0x77,0x4c,0x69,0x6e,0x65,0x2c,0x65,0x2e,0x73,0x68,0x6f,0x77,0x4c,0x69,0x6e,0x65,0x73,0x29,0x7d,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x3d,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x4c,0x69,0x6e,0x65,0x2c,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x50,0x6f,0x69,0x6e,0x74,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x73,0x3d,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2c,0x75,0x3d,0x6c,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x5b,0x5d,0x2c,0x64,0x3d,0x72,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x63,0x3d,0x64,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x2c,0x68,0x3d,0x72,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x6c,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x66,0x3d,0x72,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x67,0x3d,0x65,0x28,0x66,0x2c,0x64,0x29,0x3b,0x66,0x6f,0x72,0x28,0x67,0x26,0x26,0x28,0x61,0x3d,0x73,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x66,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x66,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x26,0x26,0x28,0x66,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3d,0x66,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x2c,0x73,0x2e,0x5f,0x73,0x63,0x61,0x6c,0x65,0x3d,0x68,0x2c,0x73,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3d,0x72,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x73,0x2e,0x5f,0x63,0x68,0x69,0x6c,0x64,0x72,0x65,0x6e,0x3d,0x75,0x2c,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x7b,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x3a,0x66,0x2e,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x3f,0x66,0x2e,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x3a,0x64,0x2e,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x2c,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x61,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3f,0x61,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x66,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x2c,0x63,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x66,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x63,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x66,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x66,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x66,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x66,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x2c,0x66,0x69,0x6c,0x6c,0x3a,0x61,0x2e,0x66,0x69,0x6c,0x6c,0x3f,0x61,0x2e,0x66,0x69,0x6c,0x6c,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x66,0x2e,0x66,0x69,0x6c,0x6c,0x3f,0x66,0x2e,0x66,0x69,0x6c,0x6c,0x3a,0x63,0x2e,0x66,0x69,0x6c,0x6c,0x2c,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x3a,0x61,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x3f,0x61,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x66,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x2c,0x63,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x29,0x2c,0x63,0x75,0x62,0x69,0x63,0x49,0x6e,0x74,0x65,0x72,0x70,0x6f,0x6c,0x61,0x74,0x69,0x6f,0x6e,0x4d,0x6f,0x64,0x65,0x3a,0x61,0x2e,0x63,0x75,0x62,0x69,0x63,0x49,0x6e,0x74,0x65,0x72,0x70,0x6f,0x6c,0x61,0x74,0x69,0x6f,0x6e,0x4d,0x6f,0x64,0x65,0x3f,0x61,0x2e,0x63,0x75,0x62,0x69,0x63,0x49,0x6e,0x74,0x65,0x72,0x70,0x6f,0x6c,0x61,0x74,0x69,0x6f,0x6e,0x4d,0x6f,0x64,0x65,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x66,0x2e,0x63,0x75,0x62,0x69,0x63,0x49,0x6e,0x74,0x65,0x72,0x70,0x6f,0x6c,0x61,0x74,0x69,0x6f,0x6e,0x4d,0x6f,0x64,0x65,0x2c,0x63,0x2e,0x63,0x75,0x62,0x69,0x63,0x49,0x6e,0x74,0x65,0x72,0x70,0x6f,0x6c,0x61,0x74,0x69,0x6f,0x6e,0x4d,0x6f,0x64,0x65,0x29,0x7d,0x2c,0x73,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x29,0x2c,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x75,0x5b,0x6e,0x5d,0x2c,0x6e,0x2c,0x74,0x29,0x3b,0x66,0x6f,0x72,0x28,0x67,0x26,0x26,0x30,0x21,0x3d,0x3d,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x26,0x26,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x42,0x65,0x7a,0x69,0x65,0x72,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x73,0x28,0x29,0x2c,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x75,0x5b,0x6e,0x5d,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x61,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x3d,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2c,0x6e,0x29,0x3a,0x69,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x26,0x26,0x28,0x6e,0x3d,0x69,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x6e,0x7d,0x2c,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x61,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x3d,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2c,0x6e,0x29,0x3a,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x26,0x26,0x28,0x6e,0x3d,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x6e,0x7d,0x2c,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x61,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x73,0x4e,0x61,0x4e,0x28,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x3f,0x21,0x69,0x73,0x4e,0x61,0x4e,0x28,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7c,0x7c,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x3f,0x6e,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x65,0x2c,0x6e,0x29,0x3a,0x69,0x73,0x4e,0x61,0x4e,0x28,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7c,0x7c,0x28,0x6e,0x3d,0x69,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x3a,0x6e,0x3d,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x73,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x75,0x3d,0x72,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x64,0x3d,0x72,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x63,0x3d,0x75,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x2c,0x68,0x3d,0x72,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x6c,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x66,0x3d,0x72,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x6c,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x67,0x3d,0x72,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x75,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x28,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x75,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x75,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x28,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x75,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x69,0x3d,0x66,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x63,0x3f,0x63,0x3a,0x4e,0x61,0x4e,0x2c,0x65,0x2c,0x64,0x29,0x2c,0x61,0x3d,0x6e,0x3f,0x68,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x28,0x29,0x3a,0x72,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x50,0x6f,0x69,0x6e,0x74,0x59,0x28,0x63,0x2c,0x65,0x2c,0x64,0x29,0x2c,0x74,0x2e,0x5f,0x78,0x53,0x63,0x61,0x6c,0x65,0x3d,0x66,0x2c,0x74,0x2e,0x5f,0x79,0x53,0x63,0x61,0x6c,0x65,0x3d,0x68,0x2c,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3d,0x64,0x2c,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3d,0x65,0x2c,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x7b,0x78,0x3a,0x69,0x2c,0x79,0x3a,0x61,0x2c,0x73,0x6b,0x69,0x70,0x3a,0x73,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x69,0x29,0x7c,0x7c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x61,0x29,0x2c,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x73,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x65,0x2c,0x67,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2c,0x67,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x74,0x2c,0x65,0x29,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x74,0x2c,0x65,0x29,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x72,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x28,0x74,0x2c,0x65,0x29,0x2c,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3f,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x30,0x2c,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x3a,0x21,0x21,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x26,0x26,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x2c,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x73,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x75,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x65,0x2c,0x67,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x7d,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x50,0x6f,0x69,0x6e,0x74,0x59,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x73,0x3d,0x72,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x75,0x3d,0x72,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x28,0x73,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x29,0x2c,0x64,0x3d,0x30,0x2c,0x63,0x3d,0x30,0x3b,0x69,0x66,0x28,0x75,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x29,0x7b,0x66,0x6f,0x72,0x28,0x69,0x3d,0x30,0x3b,0x69,0x3c,0x6e,0x3b,0x69,0x2b,0x2b,0x29,0x69,0x66,0x28,0x61,0x3d,0x6c,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x69,0x5d,0x2c,0x22,0x6c,0x69,0x6e,0x65,0x22,0x3d,0x3d,0x3d,0x28,0x6f,0x3d,0x6c,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x69,0x29,0x29,0x2e,0x74,0x79,0x70,0x65,0x26,0x26,0x6f,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x3d,0x3d,0x75,0x2e,0x69,0x64,0x26,0x26,0x6c,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x69,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x68,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x28,0x75,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x29,0x3b,0x68,0x3c,0x30,0x3f,0x63,0x2b,0x3d,0x68,0x7c,0x7c,0x30,0x3a,0x64,0x2b,0x3d,0x68,0x7c,0x7c,0x30,0x7d,0x76,0x61,0x72,0x20,0x66,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x28,0x75,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x3c,0x30,0x3f,0x75,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x63,0x2b,0x66,0x29,0x3a,0x75,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x64,0x2b,0x66,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x42,0x65,0x7a,0x69,0x65,0x72,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x74,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x2c,0x65,0x29,0x7d,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x73,0x3d,0x72,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x75,0x3d,0x6c,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x5b,0x5d,0x3b,0x69,0x66,0x28,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x26,0x26,0x28,0x75,0x3d,0x75,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x7d,0x29,0x29,0x2c,0x22,0x6d,0x6f,0x6e,0x6f,0x74,0x6f,0x6e,0x65,0x22,0x3d,0x3d,0x3d,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x63,0x75,0x62,0x69,0x63,0x49,0x6e,0x74,0x65,0x72,0x70,0x6f,0x6c,0x61,0x74,0x69,0x6f,0x6e,0x4d,0x6f,0x64,0x65,0x29,0x6f,0x2e,0x73,0x70,0x6c,0x69,0x6e,0x65,0x43,0x75,0x72,0x76,0x65,0x4d,0x6f,0x6e,0x6f,0x74,0x6f,0x6e,0x65,0x28,0x75,0x29,0x3b,0x65,0x6c,0x73,0x65,0x20,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x3d,0x75,0x5b,0x65,0x5d,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x61,0x3d,0x6f,0x2e,0x73,0x70,0x6c,0x69,0x6e,0x65,0x43,0x75,0x72,0x76,0x65,0x28,0x6f,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x49,0x74,0x65,0x6d,0x28,0x75,0x2c,0x65,0x29,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x69,0x2c,0x6f,0x2e,0x6e,0x65,0x78,0x74,0x49,0x74,0x65,0x6d,0x28,0x75,0x2c,0x65,0x29,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x6c,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x3d,0x61,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x2e,0x78,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x3d,0x61,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x2e,0x79,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x3d,0x61,0x2e,0x6e,0x65,0x78,0x74,0x2e,0x78,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x3d,0x61,0x2e,0x6e,0x65,0x78,0x74,0x2e,0x79,0x3b,0x69,0x66,0x28,0x72,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x2e,0x63,0x61,0x70,0x42,0x65,0x7a,0x69,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x73,0x29,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x28,0x69,0x3d,0x75,0x5b,0x65,0x5d,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x29,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x3d,0x74,0x28,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x2c,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x73,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x3d,0x74,0x28,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x2c,0x73,0x2e,0x74,0x6f,0x70,0x2c,0x73,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x3d,0x74,0x28,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x2c,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x73,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x2c,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x3d,0x74,0x28,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x2c,0x73,0x2e,0x74,0x6f,0x70,0x2c,0x73,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x69,0x3d,0x74,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x5b,0x5d,0x2c,0x72,0x3d,0x6e,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x6c,0x3d,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x73,0x3d,0x30,0x3b,0x66,0x6f,0x72,0x28,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x28,0x6e,0x2e,0x63,0x74,0x78,0x2c,0x72,0x29,0x2c,0x65,0x28,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0x26,0x26,0x69,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x2c,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x75,0x6e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x28,0x6e,0x2e,0x63,0x74,0x78,0x29,0x3b,0x73,0x3c,0x6c,0x3b,0x2b,0x2b,0x73,0x29,0x61,0x5b,0x73,0x5d,0x2e,0x64,0x72,0x61,0x77,0x28,0x72,0x29,0x7d,0x2c,0x73,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x69,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x61,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x6e,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x69,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x69,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x72,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x28,0x6e,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x72,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x61,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x7c,0x7c,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x69,0x2c,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x65,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x74,0x2c,0x69,0x29,0x2c,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x65,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x74,0x2c,0x69,0x29,0x2c,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x65,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x28,0x74,0x2c,0x69,0x29,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x31,0x39,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x70,0x6f,0x6c,0x61,0x72,0x41,0x72,0x65,0x61,0x22,0x2c,0x7b,0x73,0x63,0x61,0x6c,0x65,0x3a,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x72,0x61,0x64,0x69,0x61,0x6c,0x4c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x61,0x6e,0x67,0x6c,0x65,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x31,0x7d,0x2c,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x63,0x69,0x72,0x63,0x75,0x6c,0x61,0x72,0x3a,0x21,0x30,0x7d,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x31,0x7d,0x2c,0x74,0x69,0x63,0x6b,0x73,0x3a,0x7b,0x62,0x65,0x67,0x69,0x6e,0x41,0x74,0x5a,0x65,0x72,0x6f,0x3a,0x21,0x30,0x7d,0x7d,0x2c,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x7b,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x52,0x6f,0x74,0x61,0x74,0x65,0x3a,0x21,0x30,0x2c,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x53,0x63,0x61,0x6c,0x65,0x3a,0x21,0x30,0x7d,0x2c,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x2d,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2c,0x6c,0x65,0x67,0x65,0x6e,0x64,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x5b,0x5d,0x3b,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x27,0x3c,0x75,0x6c,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x27,0x2b,0x74,0x2e,0x69,0x64,0x2b,0x27,0x2d,0x6c,0x65,0x67,0x65,0x6e,0x64,0x22,0x3e,0x27,0x29,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x2c,0x69,0x3d,0x6e,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3b,0x69,0x66,0x28,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6f,0x3d,0x30,0x3b,0x6f,0x3c,0x69,0x5b,0x30,0x5d,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x6f,0x29,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x27,0x3c,0x6c,0x69,0x3e,0x3c,0x73,0x70,0x61,0x6e,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x27,0x2b,0x69,0x5b,0x30,0x5d,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x5b,0x6f,0x5d,0x2b,0x27,0x22,0x3e,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0x27,0x29,0x2c,0x61,0x5b,0x6f,0x5d,0x26,0x26,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x61,0x5b,0x6f,0x5d,0x29,0x2c,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x22,0x3c,0x2f,0x6c,0x69,0x3e,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x22,0x3c,0x2f,0x75,0x6c,0x3e,0x22,0x29,0x2c,0x65,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x22,0x29,0x7d,0x2c,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3a,0x7b,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x7b,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x65,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3f,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x30,0x29,0x2c,0x72,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x30,0x5d,0x2c,0x6c,0x3d,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x73,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x75,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x61,0x72,0x63,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x74,0x65,0x78,0x74,0x3a,0x6e,0x2c,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x28,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x75,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x28,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x73,0x28,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x69,0x2c,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2c,0x68,0x69,0x64,0x64,0x65,0x6e,0x3a,0x69,0x73,0x4e,0x61,0x4e,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x29,0x7c,0x7c,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x2c,0x69,0x6e,0x64,0x65,0x78,0x3a,0x69,0x7d,0x7d,0x29,0x3a,0x5b,0x5d,0x7d,0x7d,0x2c,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x3d,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x28,0x61,0x3d,0x72,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x29,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6f,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3d,0x21,0x61,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6f,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3b,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x7d,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x3a,0x7b,0x74,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x22,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x2b,0x22,0x3a,0x20,0x22,0x2b,0x74,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x7d,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x70,0x6f,0x6c,0x61,0x72,0x41,0x72,0x65,0x61,0x3d,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x41,0x72,0x63,0x2c,0x6c,0x69,0x6e,0x6b,0x53,0x63,0x61,0x6c,0x65,0x73,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x69,0x3d,0x6e,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x61,0x3d,0x65,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x72,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x61,0x72,0x63,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x69,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x69,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x69,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x69,0x2e,0x74,0x6f,0x70,0x29,0x3b,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x28,0x73,0x2d,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2f,0x32,0x29,0x2f,0x32,0x2c,0x30,0x29,0x2c,0x6e,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x72,0x2e,0x63,0x75,0x74,0x6f,0x75,0x74,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3f,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2f,0x31,0x30,0x30,0x2a,0x72,0x2e,0x63,0x75,0x74,0x6f,0x75,0x74,0x50,0x65,0x72,0x63,0x65,0x6e,0x74,0x61,0x67,0x65,0x3a,0x31,0x2c,0x30,0x29,0x2c,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x4c,0x65,0x6e,0x67,0x74,0x68,0x3d,0x28,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x6e,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2f,0x6e,0x2e,0x67,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0x2c,0x65,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x4c,0x65,0x6e,0x67,0x74,0x68,0x2a,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x65,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x4c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x61,0x2e,0x63,0x6f,0x75,0x6e,0x74,0x3d,0x65,0x2e,0x63,0x6f,0x75,0x6e,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x61,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x6e,0x2c,0x69,0x2c,0x74,0x29,0x7d,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x6c,0x3d,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x73,0x3d,0x6c,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x75,0x3d,0x61,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2c,0x64,0x3d,0x61,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2c,0x63,0x3d,0x69,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x43,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x2c,0x68,0x3d,0x75,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x66,0x3d,0x75,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x67,0x3d,0x30,0x2c,0x70,0x3d,0x69,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x76,0x3d,0x30,0x3b,0x76,0x3c,0x65,0x3b,0x2b,0x2b,0x76,0x29,0x69,0x73,0x4e,0x61,0x4e,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x76,0x5d,0x29,0x7c,0x7c,0x70,0x2e,0x64,0x61,0x74,0x61,0x5b,0x76,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x2b,0x2b,0x67,0x3b,0x76,0x61,0x72,0x20,0x6d,0x3d,0x6c,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x2c,0x62,0x3d,0x74,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3f,0x30,0x3a,0x75,0x2e,0x67,0x65,0x74,0x44,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x46,0x72,0x6f,0x6d,0x43,0x65,0x6e,0x74,0x65,0x72,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x2c,0x78,0x3d,0x6d,0x2b,0x63,0x2a,0x67,0x2c,0x79,0x3d,0x78,0x2b,0x28,0x74,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3f,0x30,0x3a,0x63,0x29,0x2c,0x6b,0x3d,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x53,0x63,0x61,0x6c,0x65,0x3f,0x30,0x3a,0x75,0x2e,0x67,0x65,0x74,0x44,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x46,0x72,0x6f,0x6d,0x43,0x65,0x6e,0x74,0x65,0x72,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x3b,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x2c,0x7b,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3a,0x65,0x2c,0x5f,0x73,0x63,0x61,0x6c,0x65,0x3a,0x75,0x2c,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3a,0x7b,0x78,0x3a,0x68,0x2c,0x79,0x3a,0x66,0x2c,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x30,0x2c,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x6e,0x3f,0x6b,0x3a,0x62,0x2c,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x6e,0x26,0x26,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x52,0x6f,0x74,0x61,0x74,0x65,0x3f,0x6d,0x3a,0x78,0x2c,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x6e,0x26,0x26,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x52,0x6f,0x74,0x61,0x74,0x65,0x3f,0x6d,0x3a,0x79,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x64,0x2c,0x65,0x2c,0x64,0x5b,0x65,0x5d,0x29,0x7d,0x7d,0x29,0x2c,0x69,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x28,0x74,0x29,0x2c,0x74,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x68,0x69,0x73,0x2c,0x65,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x61,0x72,0x63,0x29,0x7d,0x2c,0x63,0x6f,0x75,0x6e,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x6e,0x3d,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x69,0x29,0x7b,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x29,0x7c,0x7c,0x65,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x6e,0x2b,0x2b,0x7d,0x29,0x2c,0x6e,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x43,0x69,0x72,0x63,0x75,0x6d,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x63,0x6f,0x75,0x6e,0x74,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3e,0x30,0x26,0x26,0x21,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x29,0x3f,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x65,0x3a,0x30,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x30,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x72,0x61,0x64,0x61,0x72,0x22,0x2c,0x7b,0x73,0x63,0x61,0x6c,0x65,0x3a,0x7b,0x74,0x79,0x70,0x65,0x3a,0x22,0x72,0x61,0x64,0x69,0x61,0x6c,0x4c,0x69,0x6e,0x65,0x61,0x72,0x22,0x7d,0x2c,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x6c,0x69,0x6e,0x65,0x3a,0x7b,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x30,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x72,0x61,0x64,0x61,0x72,0x3d,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x4c,0x69,0x6e,0x65,0x2c,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x61,0x2e,0x50,0x6f,0x69,0x6e,0x74,0x2c,0x6c,0x69,0x6e,0x6b,0x53,0x63,0x61,0x6c,0x65,0x73,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x69,0x3d,0x6e,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2c,0x61,0x3d,0x6e,0x2e,0x64,0x61,0x74,0x61,0x2c,0x72,0x3d,0x69,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x6c,0x3d,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x73,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x2c,0x75,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6c,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6c,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x26,0x26,0x28,0x6c,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3d,0x6c,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x2c,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x6e,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2c,0x7b,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x5f,0x73,0x63,0x61,0x6c,0x65,0x3a,0x75,0x2c,0x5f,0x63,0x68,0x69,0x6c,0x64,0x72,0x65,0x6e,0x3a,0x61,0x2c,0x5f,0x6c,0x6f,0x6f,0x70,0x3a,0x21,0x30,0x2c,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3a,0x7b,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x72,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3f,0x72,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6c,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x2c,0x73,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x66,0x69,0x6c,0x6c,0x3a,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x3f,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6c,0x2e,0x66,0x69,0x6c,0x6c,0x3f,0x6c,0x2e,0x66,0x69,0x6c,0x6c,0x3a,0x73,0x2e,0x66,0x69,0x6c,0x6c,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3a,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3f,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3f,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x7c,0x7c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3f,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x7c,0x7c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3a,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3f,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x7d,0x7d,0x29,0x2c,0x6e,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x6e,0x2c,0x69,0x2c,0x74,0x29,0x7d,0x2c,0x65,0x29,0x2c,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x42,0x65,0x7a,0x69,0x65,0x72,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x73,0x28,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x6c,0x3d,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2c,0x73,0x3d,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2c,0x75,0x3d,0x6c,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x65,0x2c,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x65,0x5d,0x29,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x72,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x72,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x72,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3d,0x72,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x2c,0x7b,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3a,0x65,0x2c,0x5f,0x73,0x63,0x61,0x6c,0x65,0x3a,0x6c,0x2c,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3a,0x7b,0x78,0x3a,0x6e,0x3f,0x6c,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x3a,0x75,0x2e,0x78,0x2c,0x79,0x3a,0x6e,0x3f,0x6c,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x3a,0x75,0x2e,0x79,0x2c,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x61,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3f,0x61,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x2c,0x69,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x2c,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x61,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3f,0x61,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x65,0x2c,0x73,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2c,0x73,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x65,0x2c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x65,0x2c,0x73,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x61,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3f,0x61,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2c,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x61,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3f,0x61,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x65,0x2c,0x73,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x3d,0x61,0x2e,0x73,0x6b,0x69,0x70,0x3f,0x61,0x2e,0x73,0x6b,0x69,0x70,0x3a,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x29,0x7c,0x7c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x42,0x65,0x7a,0x69,0x65,0x72,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x3b,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x6e,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x72,0x3d,0x6f,0x2e,0x73,0x70,0x6c,0x69,0x6e,0x65,0x43,0x75,0x72,0x76,0x65,0x28,0x6f,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x49,0x74,0x65,0x6d,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2c,0x69,0x2c,0x21,0x30,0x29,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x61,0x2c,0x6f,0x2e,0x6e,0x65,0x78,0x74,0x49,0x74,0x65,0x6d,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2c,0x69,0x2c,0x21,0x30,0x29,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x61,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x29,0x3b,0x61,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x2e,0x78,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x2c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2c,0x61,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x2e,0x79,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x29,0x2c,0x61,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x2e,0x6e,0x65,0x78,0x74,0x2e,0x78,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x2c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2c,0x61,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x2e,0x6e,0x65,0x78,0x74,0x2e,0x79,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x29,0x2c,0x6e,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x7d,0x29,0x7d,0x2c,0x73,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x6e,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x69,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x61,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3f,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x69,0x2c,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x28,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x48,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x69,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x6e,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x69,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x3b,0x61,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3d,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3f,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x69,0x2c,0x72,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x29,0x2c,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x72,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x69,0x2c,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x61,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x69,0x2c,0x72,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x31,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x74,0x28,0x32,0x35,0x29,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x73,0x63,0x61,0x74,0x74,0x65,0x72,0x22,0x2c,0x7b,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x73,0x69,0x6e,0x67,0x6c,0x65,0x22,0x7d,0x2c,0x73,0x63,0x61,0x6c,0x65,0x73,0x3a,0x7b,0x78,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x69,0x64,0x3a,0x22,0x78,0x2d,0x61,0x78,0x69,0x73,0x2d,0x31,0x22,0x2c,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x7d,0x5d,0x2c,0x79,0x41,0x78,0x65,0x73,0x3a,0x5b,0x7b,0x69,0x64,0x3a,0x22,0x79,0x2d,0x61,0x78,0x69,0x73,0x2d,0x31,0x22,0x2c,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x7d,0x5d,0x7d,0x2c,0x73,0x68,0x6f,0x77,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x21,0x31,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x3a,0x7b,0x74,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x22,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x28,0x22,0x2b,0x74,0x2e,0x78,0x4c,0x61,0x62,0x65,0x6c,0x2b,0x22,0x2c,0x20,0x22,0x2b,0x74,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x2b,0x22,0x29,0x22,0x7d,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x73,0x63,0x61,0x74,0x74,0x65,0x72,0x3d,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x7d,0x5d,0x2c,0x32,0x32,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x7b,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x31,0x65,0x33,0x2c,0x65,0x61,0x73,0x69,0x6e,0x67,0x3a,0x22,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x51,0x75,0x61,0x72,0x74,0x22,0x2c,0x6f,0x6e,0x50,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x6f,0x6e,0x43,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x63,0x68,0x61,0x72,0x74,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x3a,0x30,0x2c,0x6e,0x75,0x6d,0x53,0x74,0x65,0x70,0x73,0x3a,0x36,0x30,0x2c,0x65,0x61,0x73,0x69,0x6e,0x67,0x3a,0x22,0x22,0x2c,0x72,0x65,0x6e,0x64,0x65,0x72,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6f,0x6e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x50,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6f,0x6e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x43,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x29,0x2c,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x3d,0x7b,0x66,0x72,0x61,0x6d,0x65,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x31,0x37,0x2c,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x5b,0x5d,0x2c,0x64,0x72,0x6f,0x70,0x46,0x72,0x61,0x6d,0x65,0x73,0x3a,0x30,0x2c,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x61,0x64,0x64,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x74,0x68,0x69,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x66,0x6f,0x72,0x28,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x3d,0x74,0x2c,0x69,0x7c,0x7c,0x28,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6e,0x67,0x3d,0x21,0x30,0x29,0x2c,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x6f,0x3b,0x2b,0x2b,0x61,0x29,0x69,0x66,0x28,0x72,0x5b,0x61,0x5d,0x2e,0x63,0x68,0x61,0x72,0x74,0x3d,0x3d,0x3d,0x74,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x28,0x72,0x5b,0x61,0x5d,0x3d,0x65,0x29,0x3b,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x65,0x29,0x2c,0x31,0x3d,0x3d,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x28,0x29,0x7d,0x2c,0x63,0x61,0x6e,0x63,0x65,0x6c,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x6f,0x2e,0x66,0x69,0x6e,0x64,0x49,0x6e,0x64,0x65,0x78,0x28,0x74,0x68,0x69,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x3d,0x3d,0x3d,0x74,0x7d,0x29,0x3b,0x2d,0x31,0x21,0x3d,0x3d,0x65,0x26,0x26,0x28,0x74,0x68,0x69,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x65,0x2c,0x31,0x29,0x2c,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6e,0x67,0x3d,0x21,0x31,0x29,0x7d,0x2c,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x74,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x26,0x26,0x28,0x74,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x3d,0x6f,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x46,0x72,0x61,0x6d,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x44,0x69,0x67,0x65,0x73,0x74,0x28,0x29,0x7d,0x29,0x29,0x7d,0x2c,0x73,0x74,0x61,0x72,0x74,0x44,0x69,0x67,0x65,0x73,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x44,0x61,0x74,0x65,0x2e,0x6e,0x6f,0x77,0x28,0x29,0x2c,0x6e,0x3d,0x30,0x3b,0x74,0x2e,0x64,0x72,0x6f,0x70,0x46,0x72,0x61,0x6d,0x65,0x73,0x3e,0x31,0x26,0x26,0x28,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x74,0x2e,0x64,0x72,0x6f,0x70,0x46,0x72,0x61,0x6d,0x65,0x73,0x29,0x2c,0x74,0x2e,0x64,0x72,0x6f,0x70,0x46,0x72,0x61,0x6d,0x65,0x73,0x3d,0x74,0x2e,0x64,0x72,0x6f,0x70,0x46,0x72,0x61,0x6d,0x65,0x73,0x25,0x31,0x29,0x2c,0x74,0x2e,0x61,0x64,0x76,0x61,0x6e,0x63,0x65,0x28,0x31,0x2b,0x6e,0x29,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x44,0x61,0x74,0x65,0x2e,0x6e,0x6f,0x77,0x28,0x29,0x3b,0x74,0x2e,0x64,0x72,0x6f,0x70,0x46,0x72,0x61,0x6d,0x65,0x73,0x2b,0x3d,0x28,0x69,0x2d,0x65,0x29,0x2f,0x74,0x2e,0x66,0x72,0x61,0x6d,0x65,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x26,0x26,0x74,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x28,0x29,0x7d,0x2c,0x61,0x64,0x76,0x61,0x6e,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x29,0x6e,0x3d,0x28,0x65,0x3d,0x69,0x5b,0x61,0x5d,0x29,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x3d,0x28,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x7c,0x7c,0x30,0x29,0x2b,0x74,0x2c,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x2c,0x65,0x2e,0x6e,0x75,0x6d,0x53,0x74,0x65,0x70,0x73,0x29,0x2c,0x6f,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x65,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x2c,0x5b,0x6e,0x2c,0x65,0x5d,0x2c,0x6e,0x29,0x2c,0x6f,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x65,0x2e,0x6f,0x6e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x50,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x2c,0x5b,0x65,0x5d,0x2c,0x6e,0x29,0x2c,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x3e,0x3d,0x65,0x2e,0x6e,0x75,0x6d,0x53,0x74,0x65,0x70,0x73,0x3f,0x28,0x6f,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x65,0x2e,0x6f,0x6e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x43,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x2c,0x5b,0x65,0x5d,0x2c,0x6e,0x29,0x2c,0x6e,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6e,0x67,0x3d,0x21,0x31,0x2c,0x69,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x61,0x2c,0x31,0x29,0x29,0x3a,0x2b,0x2b,0x61,0x7d,0x7d,0x2c,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x64,0x65,0x66,0x69,0x6e,0x65,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x2e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x22,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x4f,0x62,0x6a,0x65,0x63,0x74,0x22,0x2c,0x7b,0x67,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x7d,0x7d,0x29,0x2c,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x64,0x65,0x66,0x69,0x6e,0x65,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x2e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x22,0x63,0x68,0x61,0x72,0x74,0x49,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x22,0x2c,0x7b,0x67,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x7d,0x2c,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x3d,0x74,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x33,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x32,0x38,0x29,0x2c,0x72,0x3d,0x74,0x28,0x34,0x38,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x28,0x74,0x3d,0x74,0x7c,0x7c,0x7b,0x7d,0x29,0x2e,0x64,0x61,0x74,0x61,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x7b,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x2c,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3d,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x7c,0x7c,0x5b,0x5d,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x61,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x4d,0x65,0x72,0x67,0x65,0x28,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x69,0x5b,0x74,0x2e,0x74,0x79,0x70,0x65,0x5d,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x7c,0x7c,0x7b,0x7d,0x29,0x2c,0x74,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x3f,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x3a,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x26,0x26,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2e,0x78,0x41,0x78,0x65,0x73,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2e,0x79,0x41,0x78,0x65,0x73,0x29,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x5b,0x65,0x2e,0x69,0x64,0x5d,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x65,0x7d,0x29,0x2c,0x74,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x74,0x7c,0x7c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x74,0x7d,0x76,0x61,0x72,0x20,0x73,0x3d,0x74,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3b,0x74,0x2e,0x74,0x79,0x70,0x65,0x73,0x3d,0x7b,0x7d,0x2c,0x74,0x2e,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x73,0x3d,0x7b,0x7d,0x2c,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x3d,0x7b,0x7d,0x2c,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x7b,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x3d,0x65,0x28,0x69,0x29,0x3b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x72,0x2e,0x61,0x63,0x71,0x75,0x69,0x72,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x28,0x6e,0x2c,0x69,0x29,0x2c,0x73,0x3d,0x6c,0x26,0x26,0x6c,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2c,0x75,0x3d,0x73,0x26,0x26,0x73,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x64,0x3d,0x73,0x26,0x26,0x73,0x2e,0x77,0x69,0x64,0x74,0x68,0x3b,0x6f,0x2e,0x69,0x64,0x3d,0x61,0x2e,0x75,0x69,0x64,0x28,0x29,0x2c,0x6f,0x2e,0x63,0x74,0x78,0x3d,0x6c,0x2c,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3d,0x73,0x2c,0x6f,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x3d,0x69,0x2c,0x6f,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x64,0x2c,0x6f,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x75,0x2c,0x6f,0x2e,0x61,0x73,0x70,0x65,0x63,0x74,0x52,0x61,0x74,0x69,0x6f,0x3d,0x75,0x3f,0x64,0x2f,0x75,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6f,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x69,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x6f,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x6e,0x64,0x65,0x72,0x3d,0x21,0x31,0x2c,0x6f,0x2e,0x63,0x68,0x61,0x72,0x74,0x3d,0x6f,0x2c,0x6f,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x3d,0x6f,0x2c,0x74,0x2e,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x73,0x5b,0x6f,0x2e,0x69,0x64,0x5d,0x3d,0x6f,0x2c,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x64,0x65,0x66,0x69,0x6e,0x65,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x6f,0x2c,0x22,0x64,0x61,0x74,0x61,0x22,0x2c,0x7b,0x67,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x64,0x61,0x74,0x61,0x7d,0x2c,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x6f,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x64,0x61,0x74,0x61,0x3d,0x74,0x7d,0x7d,0x29,0x2c,0x6c,0x26,0x26,0x73,0x3f,0x28,0x6f,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x28,0x29,0x2c,0x6f,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x29,0x3a,0x63,0x6f,0x6e,0x73,0x6f,0x6c,0x65,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x46,0x61,0x69,0x6c,0x65,0x64,0x20,0x74,0x6f,0x20,0x63,0x72,0x65,0x61,0x74,0x65,0x20,0x63,0x68,0x61,0x72,0x74,0x3a,0x20,0x63,0x61,0x6e,0x27,0x74,0x20,0x61,0x63,0x71,0x75,0x69,0x72,0x65,0x20,0x63,0x6f,0x6e,0x74,0x65,0x78,0x74,0x20,0x66,0x72,0x6f,0x6d,0x20,0x74,0x68,0x65,0x20,0x67,0x69,0x76,0x65,0x6e,0x20,0x69,0x74,0x65,0x6d,0x22,0x29,0x7d,0x2c,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x74,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x49,0x6e,0x69,0x74,0x22,0x29,0x2c,0x61,0x2e,0x72,0x65,0x74,0x69,0x6e,0x61,0x53,0x63,0x61,0x6c,0x65,0x28,0x74,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x64,0x65,0x76,0x69,0x63,0x65,0x50,0x69,0x78,0x65,0x6c,0x52,0x61,0x74,0x69,0x6f,0x29,0x2c,0x74,0x2e,0x62,0x69,0x6e,0x64,0x45,0x76,0x65,0x6e,0x74,0x73,0x28,0x29,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x26,0x26,0x74,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x28,0x21,0x30,0x29,0x2c,0x74,0x2e,0x65,0x6e,0x73,0x75,0x72,0x65,0x53,0x63,0x61,0x6c,0x65,0x73,0x48,0x61,0x76,0x65,0x49,0x44,0x73,0x28,0x29,0x2c,0x74,0x2e,0x62,0x75,0x69,0x6c,0x64,0x53,0x63,0x61,0x6c,0x65,0x73,0x28,0x29,0x2c,0x74,0x2e,0x69,0x6e,0x69,0x74,0x54,0x6f,0x6f,0x6c,0x54,0x69,0x70,0x28,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x74,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x49,0x6e,0x69,0x74,0x22,0x29,0x2c,0x74,0x7d,0x2c,0x63,0x6c,0x65,0x61,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x63,0x6c,0x65,0x61,0x72,0x28,0x74,0x68,0x69,0x73,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x73,0x74,0x6f,0x70,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x63,0x61,0x6e,0x63,0x65,0x6c,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x28,0x74,0x68,0x69,0x73,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x2c,0x72,0x65,0x73,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2c,0x6f,0x3d,0x6e,0x2e,0x6d,0x61,0x69,0x6e,0x74,0x61,0x69,0x6e,0x41,0x73,0x70,0x65,0x63,0x74,0x52,0x61,0x74,0x69,0x6f,0x26,0x26,0x65,0x2e,0x61,0x73,0x70,0x65,0x63,0x74,0x52,0x61,0x74,0x69,0x6f,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x2c,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x61,0x2e,0x67,0x65,0x74,0x4d,0x61,0x78,0x69,0x6d,0x75,0x6d,0x57,0x69,0x64,0x74,0x68,0x28,0x69,0x29,0x29,0x29,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x6f,0x3f,0x72,0x2f,0x6f,0x3a,0x61,0x2e,0x67,0x65,0x74,0x4d,0x61,0x78,0x69,0x6d,0x75,0x6d,0x48,0x65,0x69,0x67,0x68,0x74,0x28,0x69,0x29,0x29,0x29,0x3b,0x69,0x66,0x28,0x28,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x21,0x3d,0x3d,0x72,0x7c,0x7c,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x21,0x3d,0x3d,0x6c,0x29,0x26,0x26,0x28,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x72,0x2c,0x69,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x6c,0x2c,0x69,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x72,0x2b,0x22,0x70,0x78,0x22,0x2c,0x69,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x6c,0x2b,0x22,0x70,0x78,0x22,0x2c,0x61,0x2e,0x72,0x65,0x74,0x69,0x6e,0x61,0x53,0x63,0x61,0x6c,0x65,0x28,0x65,0x2c,0x6e,0x2e,0x64,0x65,0x76,0x69,0x63,0x65,0x50,0x69,0x78,0x65,0x6c,0x52,0x61,0x74,0x69,0x6f,0x29,0x2c,0x21,0x74,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x75,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x72,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x6c,0x7d,0x3b,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x72,0x65,0x73,0x69,0x7a,0x65,0x22,0x2c,0x5b,0x75,0x5d,0x29,0x2c,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x52,0x65,0x73,0x69,0x7a,0x65,0x26,0x26,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x52,0x65,0x73,0x69,0x7a,0x65,0x28,0x65,0x2c,0x75,0x29,0x2c,0x65,0x2e,0x73,0x74,0x6f,0x70,0x28,0x29,0x2c,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x29,0x7d,0x7d,0x2c,0x65,0x6e,0x73,0x75,0x72,0x65,0x53,0x63,0x61,0x6c,0x65,0x73,0x48,0x61,0x76,0x65,0x49,0x44,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x7c,0x7c,0x7b,0x7d,0x2c,0x6e,0x3d,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x78,0x41,0x78,0x65,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x2e,0x69,0x64,0x3d,0x74,0x2e,0x69,0x64,0x7c,0x7c,0x22,0x78,0x2d,0x61,0x78,0x69,0x73,0x2d,0x22,0x2b,0x65,0x7d,0x29,0x2c,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x79,0x41,0x78,0x65,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x2e,0x69,0x64,0x3d,0x74,0x2e,0x69,0x64,0x7c,0x7c,0x22,0x79,0x2d,0x61,0x78,0x69,0x73,0x2d,0x22,0x2b,0x65,0x7d,0x29,0x2c,0x6e,0x26,0x26,0x28,0x6e,0x2e,0x69,0x64,0x3d,0x6e,0x2e,0x69,0x64,0x7c,0x7c,0x22,0x73,0x63,0x61,0x6c,0x65,0x22,0x29,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x53,0x63,0x61,0x6c,0x65,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x3d,0x7b,0x7d,0x2c,0x6f,0x3d,0x5b,0x5d,0x3b,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x26,0x26,0x28,0x6f,0x3d,0x6f,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x28,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2e,0x78,0x41,0x78,0x65,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x74,0x2c,0x64,0x74,0x79,0x70,0x65,0x3a,0x22,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x22,0x2c,0x64,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x7d,0x7d,0x29,0x2c,0x28,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2e,0x79,0x41,0x78,0x65,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x74,0x2c,0x64,0x74,0x79,0x70,0x65,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x64,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x7d,0x7d,0x29,0x29,0x29,0x2c,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x26,0x26,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2c,0x64,0x74,0x79,0x70,0x65,0x3a,0x22,0x72,0x61,0x64,0x69,0x61,0x6c,0x4c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x69,0x73,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x21,0x30,0x2c,0x64,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x22,0x7d,0x29,0x2c,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x72,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6f,0x2e,0x74,0x79,0x70,0x65,0x2c,0x6e,0x2e,0x64,0x74,0x79,0x70,0x65,0x29,0x2c,0x73,0x3d,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x43,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x28,0x72,0x29,0x3b,0x69,0x66,0x28,0x73,0x29,0x7b,0x6c,0x28,0x6f,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x29,0x21,0x3d,0x3d,0x6c,0x28,0x6e,0x2e,0x64,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x29,0x26,0x26,0x28,0x6f,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3d,0x6e,0x2e,0x64,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x29,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x6e,0x65,0x77,0x20,0x73,0x28,0x7b,0x69,0x64,0x3a,0x6f,0x2e,0x69,0x64,0x2c,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x6f,0x2c,0x63,0x74,0x78,0x3a,0x65,0x2e,0x63,0x74,0x78,0x2c,0x63,0x68,0x61,0x72,0x74,0x3a,0x65,0x7d,0x29,0x3b,0x69,0x5b,0x75,0x2e,0x69,0x64,0x5d,0x3d,0x75,0x2c,0x75,0x2e,0x6d,0x65,0x72,0x67,0x65,0x54,0x69,0x63,0x6b,0x73,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x6e,0x2e,0x69,0x73,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x26,0x26,0x28,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x3d,0x75,0x29,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x61,0x64,0x64,0x53,0x63,0x61,0x6c,0x65,0x73,0x54,0x6f,0x4c,0x61,0x79,0x6f,0x75,0x74,0x28,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x4f,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x5b,0x5d,0x2c,0x69,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x61,0x2c,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6f,0x29,0x2c,0x6c,0x3d,0x61,0x2e,0x74,0x79,0x70,0x65,0x7c,0x7c,0x65,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x74,0x79,0x70,0x65,0x3b,0x69,0x66,0x28,0x72,0x2e,0x74,0x79,0x70,0x65,0x26,0x26,0x72,0x2e,0x74,0x79,0x70,0x65,0x21,0x3d,0x3d,0x6c,0x26,0x26,0x28,0x65,0x2e,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6f,0x29,0x2c,0x72,0x3d,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6f,0x29,0x29,0x2c,0x72,0x2e,0x74,0x79,0x70,0x65,0x3d,0x6c,0x2c,0x6e,0x2e,0x70,0x75,0x73,0x68,0x28,0x72,0x2e,0x74,0x79,0x70,0x65,0x29,0x2c,0x72,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x29,0x72,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x49,0x6e,0x64,0x65,0x78,0x28,0x6f,0x29,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x74,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x5b,0x72,0x2e,0x74,0x79,0x70,0x65,0x5d,0x3b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x73,0x29,0x74,0x68,0x72,0x6f,0x77,0x20,0x6e,0x65,0x77,0x20,0x45,0x72,0x72,0x6f,0x72,0x28,0x27,0x22,0x27,0x2b,0x72,0x2e,0x74,0x79,0x70,0x65,0x2b,0x27,0x22,0x20,0x69,0x73,0x20,0x6e,0x6f,0x74,0x20,0x61,0x20,0x63,0x68,0x61,0x72,0x74,0x20,0x74,0x79,0x70,0x65,0x2e,0x27,0x29,0x3b,0x72,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x3d,0x6e,0x65,0x77,0x20,0x73,0x28,0x65,0x2c,0x6f,0x29,0x2c,0x69,0x2e,0x70,0x75,0x73,0x68,0x28,0x72,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x29,0x7d,0x7d,0x2c,0x65,0x29,0x2c,0x69,0x7d,0x2c,0x72,0x65,0x73,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x72,0x65,0x73,0x65,0x74,0x28,0x29,0x7d,0x2c,0x74,0x29,0x7d,0x2c,0x72,0x65,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x72,0x65,0x73,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x28,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x66,0x28,0x74,0x26,0x26,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x7c,0x7c,0x28,0x74,0x3d,0x7b,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x74,0x2c,0x6c,0x61,0x7a,0x79,0x3a,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x5b,0x31,0x5d,0x7d,0x29,0x2c,0x6e,0x28,0x65,0x29,0x2c,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x29,0x29,0x7b,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x5f,0x64,0x61,0x74,0x61,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x65,0x2e,0x62,0x75,0x69,0x6c,0x64,0x4f,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x73,0x28,0x29,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x7b,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x62,0x75,0x69,0x6c,0x64,0x4f,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x29,0x7d,0x2c,0x65,0x29,0x2c,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x4c,0x61,0x79,0x6f,0x75,0x74,0x28,0x29,0x2c,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x69,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x72,0x65,0x73,0x65,0x74,0x28,0x29,0x7d,0x29,0x2c,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x28,0x29,0x2c,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x28,0x29,0x2c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x3d,0x5b,0x5d,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x29,0x2c,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x6e,0x64,0x65,0x72,0x3f,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x3d,0x7b,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x74,0x2e,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x65,0x61,0x73,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x2c,0x6c,0x61,0x7a,0x79,0x3a,0x74,0x2e,0x6c,0x61,0x7a,0x79,0x7d,0x3a,0x65,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x28,0x74,0x29,0x7d,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x4c,0x61,0x79,0x6f,0x75,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x4c,0x61,0x79,0x6f,0x75,0x74,0x22,0x29,0x26,0x26,0x28,0x74,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x68,0x69,0x73,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x74,0x68,0x69,0x73,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x4c,0x61,0x79,0x6f,0x75,0x74,0x22,0x29,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x66,0x28,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x74,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x29,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x74,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x65,0x29,0x3b,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x74,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x29,0x7d,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x74,0x29,0x2c,0x69,0x3d,0x7b,0x6d,0x65,0x74,0x61,0x3a,0x6e,0x2c,0x69,0x6e,0x64,0x65,0x78,0x3a,0x74,0x7d,0x3b,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x2c,0x5b,0x69,0x5d,0x29,0x26,0x26,0x28,0x6e,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x55,0x70,0x64,0x61,0x74,0x65,0x22,0x2c,0x5b,0x69,0x5d,0x29,0x29,0x7d,0x2c,0x72,0x65,0x6e,0x64,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x3b,0x65,0x26,0x26,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x7c,0x7c,0x28,0x65,0x3d,0x7b,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x65,0x2c,0x6c,0x61,0x7a,0x79,0x3a,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x5b,0x31,0x5d,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x65,0x2e,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x6f,0x3d,0x65,0x2e,0x6c,0x61,0x7a,0x79,0x3b,0x69,0x66,0x28,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x6e,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x52,0x65,0x6e,0x64,0x65,0x72,0x22,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x6c,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x6e,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x52,0x65,0x6e,0x64,0x65,0x72,0x22,0x29,0x2c,0x61,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x72,0x26,0x26,0x72,0x2e,0x6f,0x6e,0x43,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x2c,0x5b,0x74,0x5d,0x2c,0x6e,0x29,0x7d,0x3b,0x69,0x66,0x28,0x72,0x26,0x26,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x69,0x26,0x26,0x30,0x21,0x3d,0x3d,0x69,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x69,0x26,0x26,0x30,0x21,0x3d,0x3d,0x72,0x2e,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x75,0x3d,0x6e,0x65,0x77,0x20,0x74,0x2e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x28,0x7b,0x6e,0x75,0x6d,0x53,0x74,0x65,0x70,0x73,0x3a,0x28,0x69,0x7c,0x7c,0x72,0x2e,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x29,0x2f,0x31,0x36,0x2e,0x36,0x36,0x2c,0x65,0x61,0x73,0x69,0x6e,0x67,0x3a,0x65,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x7c,0x7c,0x72,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x2c,0x72,0x65,0x6e,0x64,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x61,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x2e,0x65,0x66,0x66,0x65,0x63,0x74,0x73,0x5b,0x65,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x5d,0x2c,0x69,0x3d,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x65,0x70,0x2c,0x6f,0x3d,0x69,0x2f,0x65,0x2e,0x6e,0x75,0x6d,0x53,0x74,0x65,0x70,0x73,0x3b,0x74,0x2e,0x64,0x72,0x61,0x77,0x28,0x6e,0x28,0x6f,0x29,0x2c,0x6f,0x2c,0x69,0x29,0x7d,0x2c,0x6f,0x6e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x50,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x3a,0x72,0x2e,0x6f,0x6e,0x50,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x2c,0x6f,0x6e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x43,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x3a,0x6c,0x7d,0x29,0x3b,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x61,0x64,0x64,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x75,0x2c,0x69,0x2c,0x6f,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x6e,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x2c,0x6c,0x28,0x6e,0x65,0x77,0x20,0x74,0x2e,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x28,0x7b,0x6e,0x75,0x6d,0x53,0x74,0x65,0x70,0x73,0x3a,0x30,0x2c,0x63,0x68,0x61,0x72,0x74,0x3a,0x6e,0x7d,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x65,0x2e,0x63,0x6c,0x65,0x61,0x72,0x28,0x29,0x2c,0x61,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x74,0x29,0x26,0x26,0x28,0x74,0x3d,0x31,0x29,0x2c,0x65,0x2e,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x2c,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x74,0x5d,0x29,0x26,0x26,0x28,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x64,0x72,0x61,0x77,0x28,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x29,0x7d,0x2c,0x65,0x29,0x2c,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x26,0x26,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x2c,0x65,0x2e,0x64,0x72,0x61,0x77,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x28,0x74,0x29,0x2c,0x65,0x2e,0x5f,0x64,0x72,0x61,0x77,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x28,0x74,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x74,0x5d,0x29,0x29,0x7d,0x2c,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x65,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x26,0x26,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x3b,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x66,0x28,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x74,0x5d,0x29,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6e,0x3d,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3b,0x6e,0x3e,0x3d,0x30,0x3b,0x2d,0x2d,0x6e,0x29,0x65,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x26,0x26,0x65,0x2e,0x64,0x72,0x61,0x77,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x6e,0x2c,0x74,0x29,0x3b,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x74,0x5d,0x29,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x74,0x29,0x2c,0x61,0x3d,0x7b,0x6d,0x65,0x74,0x61,0x3a,0x69,0x2c,0x69,0x6e,0x64,0x65,0x78,0x3a,0x74,0x2c,0x65,0x61,0x73,0x69,0x6e,0x67,0x56,0x61,0x6c,0x75,0x65,0x3a,0x65,0x7d,0x3b,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x6e,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x61,0x5d,0x29,0x26,0x26,0x28,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x64,0x72,0x61,0x77,0x28,0x65,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x6e,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x61,0x5d,0x29,0x29,0x7d,0x2c,0x5f,0x64,0x72,0x61,0x77,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2c,0x69,0x3d,0x7b,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x3a,0x6e,0x2c,0x65,0x61,0x73,0x69,0x6e,0x67,0x56,0x61,0x6c,0x75,0x65,0x3a,0x74,0x7d,0x3b,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x69,0x5d,0x29,0x26,0x26,0x28,0x6e,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x44,0x72,0x61,0x77,0x22,0x2c,0x5b,0x69,0x5d,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x41,0x74,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x6d,0x6f,0x64,0x65,0x73,0x2e,0x73,0x69,0x6e,0x67,0x6c,0x65,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x29,0x7d,0x2c,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x41,0x74,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x6d,0x6f,0x64,0x65,0x73,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x2c,0x7b,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3a,0x21,0x30,0x7d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x41,0x74,0x58,0x41,0x78,0x69,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x6d,0x6f,0x64,0x65,0x73,0x5b,0x22,0x78,0x2d,0x61,0x78,0x69,0x73,0x22,0x5d,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x2c,0x7b,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3a,0x21,0x30,0x7d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x41,0x74,0x45,0x76,0x65,0x6e,0x74,0x46,0x6f,0x72,0x4d,0x6f,0x64,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x6f,0x2e,0x6d,0x6f,0x64,0x65,0x73,0x5b,0x65,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x3f,0x69,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x2c,0x6e,0x29,0x3a,0x5b,0x5d,0x7d,0x2c,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x41,0x74,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x6d,0x6f,0x64,0x65,0x73,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x2c,0x7b,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3a,0x21,0x30,0x7d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x5d,0x3b,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x7c,0x7c,0x28,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x3d,0x7b,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x5b,0x65,0x2e,0x69,0x64,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x7c,0x7c,0x28,0x69,0x3d,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x5b,0x65,0x2e,0x69,0x64,0x5d,0x3d,0x7b,0x74,0x79,0x70,0x65,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x64,0x61,0x74,0x61,0x3a,0x5b,0x5d,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x68,0x69,0x64,0x64,0x65,0x6e,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x29,0x2c,0x69,0x7d,0x2c,0x67,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x74,0x3d,0x30,0x2c,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x74,0x68,0x69,0x73,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x65,0x29,0x26,0x26,0x74,0x2b,0x2b,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x62,0x6f,0x6f,0x6c,0x65,0x61,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3f,0x21,0x65,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3a,0x21,0x74,0x68,0x69,0x73,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7d,0x2c,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x65,0x4c,0x65,0x67,0x65,0x6e,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x69,0x64,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x5d,0x2c,0x69,0x3d,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x26,0x26,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x5b,0x65,0x5d,0x3b,0x69,0x26,0x26,0x28,0x69,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x28,0x29,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x6e,0x2e,0x5f,0x6d,0x65,0x74,0x61,0x5b,0x65,0x5d,0x29,0x7d,0x2c,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6f,0x3d,0x69,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3b,0x66,0x6f,0x72,0x28,0x69,0x2e,0x73,0x74,0x6f,0x70,0x28,0x29,0x2c,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x2e,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x65,0x29,0x3b,0x6f,0x26,0x26,0x28,0x69,0x2e,0x75,0x6e,0x62,0x69,0x6e,0x64,0x45,0x76,0x65,0x6e,0x74,0x73,0x28,0x29,0x2c,0x61,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x63,0x6c,0x65,0x61,0x72,0x28,0x69,0x29,0x2c,0x72,0x2e,0x72,0x65,0x6c,0x65,0x61,0x73,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x28,0x69,0x2e,0x63,0x74,0x78,0x29,0x2c,0x69,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x69,0x2e,0x63,0x74,0x78,0x3d,0x6e,0x75,0x6c,0x6c,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x69,0x2c,0x22,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x22,0x29,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x74,0x2e,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x73,0x5b,0x69,0x2e,0x69,0x64,0x5d,0x7d,0x2c,0x74,0x6f,0x42,0x61,0x73,0x65,0x36,0x34,0x49,0x6d,0x61,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x74,0x6f,0x44,0x61,0x74,0x61,0x55,0x52,0x4c,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x68,0x69,0x73,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x69,0x6e,0x69,0x74,0x54,0x6f,0x6f,0x6c,0x54,0x69,0x70,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x3d,0x6e,0x65,0x77,0x20,0x74,0x2e,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x28,0x7b,0x5f,0x63,0x68,0x61,0x72,0x74,0x3a,0x65,0x2c,0x5f,0x63,0x68,0x61,0x72,0x74,0x49,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x3a,0x65,0x2c,0x5f,0x64,0x61,0x74,0x61,0x3a,0x65,0x2e,0x64,0x61,0x74,0x61,0x2c,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x7d,0x2c,0x65,0x29,0x7d,0x2c,0x62,0x69,0x6e,0x64,0x45,0x76,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x5f,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x3d,0x7b,0x7d,0x2c,0x6e,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x2e,0x65,0x76,0x65,0x6e,0x74,0x48,0x61,0x6e,0x64,0x6c,0x65,0x72,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x76,0x65,0x6e,0x74,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x29,0x7b,0x72,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x74,0x2c,0x69,0x2c,0x6e,0x29,0x2c,0x65,0x5b,0x69,0x5d,0x3d,0x6e,0x7d,0x29,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x26,0x26,0x28,0x6e,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x28,0x29,0x7d,0x2c,0x72,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x74,0x2c,0x22,0x72,0x65,0x73,0x69,0x7a,0x65,0x22,0x2c,0x6e,0x29,0x2c,0x65,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x3d,0x6e,0x29,0x7d,0x2c,0x75,0x6e,0x62,0x69,0x6e,0x64,0x45,0x76,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x5f,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x3b,0x65,0x26,0x26,0x28,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x74,0x2e,0x5f,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x2c,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x74,0x2c,0x6e,0x2c,0x65,0x29,0x7d,0x29,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x6e,0x3f,0x22,0x73,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x22,0x3a,0x22,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x22,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x6f,0x3b,0x2b,0x2b,0x61,0x29,0x28,0x69,0x3d,0x74,0x5b,0x61,0x5d,0x29,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x69,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x29,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x5b,0x72,0x5d,0x28,0x69,0x29,0x7d,0x2c,0x65,0x76,0x65,0x6e,0x74,0x48,0x61,0x6e,0x64,0x6c,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x3b,0x69,0x66,0x28,0x21,0x31,0x21,0x3d,0x3d,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x62,0x65,0x66,0x6f,0x72,0x65,0x45,0x76,0x65,0x6e,0x74,0x22,0x2c,0x5b,0x74,0x5d,0x29,0x29,0x7b,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x6e,0x64,0x65,0x72,0x3d,0x21,0x30,0x2c,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x3d,0x6e,0x75,0x6c,0x6c,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x65,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x45,0x76,0x65,0x6e,0x74,0x28,0x74,0x29,0x3b,0x69,0x7c,0x3d,0x6e,0x26,0x26,0x6e,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x45,0x76,0x65,0x6e,0x74,0x28,0x74,0x29,0x2c,0x73,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x79,0x28,0x65,0x2c,0x22,0x61,0x66,0x74,0x65,0x72,0x45,0x76,0x65,0x6e,0x74,0x22,0x2c,0x5b,0x74,0x5d,0x29,0x3b,0x76,0x61,0x72,0x20,0x61,0x3d,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x3f,0x65,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x28,0x61,0x29,0x3a,0x69,0x26,0x26,0x21,0x65,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6e,0x67,0x26,0x26,0x28,0x65,0x2e,0x73,0x74,0x6f,0x70,0x28,0x29,0x2c,0x65,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x28,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x68,0x6f,0x76,0x65,0x72,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x21,0x30,0x29,0x29,0x2c,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x6e,0x64,0x65,0x72,0x3d,0x21,0x31,0x2c,0x65,0x2e,0x5f,0x62,0x75,0x66,0x66,0x65,0x72,0x65,0x64,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x65,0x7d,0x7d,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x7c,0x7c,0x7b,0x7d,0x2c,0x69,0x3d,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x2c,0x6f,0x3d,0x21,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x3d,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x7c,0x7c,0x5b,0x5d,0x2c,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6f,0x75,0x74,0x22,0x3d,0x3d,0x3d,0x74,0x2e,0x74,0x79,0x70,0x65,0x3f,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x3d,0x5b,0x5d,0x3a,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x3d,0x65,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x41,0x74,0x45,0x76,0x65,0x6e,0x74,0x46,0x6f,0x72,0x4d,0x6f,0x64,0x65,0x28,0x74,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x2c,0x69,0x29,0x2c,0x61,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x6e,0x2e,0x6f,0x6e,0x48,0x6f,0x76,0x65,0x72,0x7c,0x7c,0x6e,0x2e,0x68,0x6f,0x76,0x65,0x72,0x2e,0x6f,0x6e,0x48,0x6f,0x76,0x65,0x72,0x2c,0x5b,0x74,0x2e,0x6e,0x61,0x74,0x69,0x76,0x65,0x2c,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x5d,0x2c,0x65,0x29,0x2c,0x22,0x6d,0x6f,0x75,0x73,0x65,0x75,0x70,0x22,0x21,0x3d,0x3d,0x74,0x2e,0x74,0x79,0x70,0x65,0x26,0x26,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x21,0x3d,0x3d,0x74,0x2e,0x74,0x79,0x70,0x65,0x7c,0x7c,0x6e,0x2e,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x26,0x26,0x6e,0x2e,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x2c,0x74,0x2e,0x6e,0x61,0x74,0x69,0x76,0x65,0x2c,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x29,0x2c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x28,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x2c,0x21,0x31,0x29,0x2c,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x26,0x26,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x28,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x2c,0x21,0x30,0x29,0x2c,0x6f,0x3d,0x21,0x61,0x2e,0x61,0x72,0x72,0x61,0x79,0x45,0x71,0x75,0x61,0x6c,0x73,0x28,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x2c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x29,0x2c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x3d,0x65,0x2e,0x61,0x63,0x74,0x69,0x76,0x65,0x2c,0x6f,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x3d,0x74,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x38,0x3a,0x32,0x38,0x2c,0x34,0x35,0x3a,0x34,0x35,0x2c,0x34,0x38,0x3a,0x34,0x38,0x7d,0x5d,0x2c,0x32,0x34,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x3f,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x2e,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x65,0x29,0x3a,0x28,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x64,0x65,0x66,0x69,0x6e,0x65,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x2c,0x22,0x5f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x22,0x2c,0x7b,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x61,0x62,0x6c,0x65,0x3a,0x21,0x30,0x2c,0x65,0x6e,0x75,0x6d,0x65,0x72,0x61,0x62,0x6c,0x65,0x3a,0x21,0x31,0x2c,0x76,0x61,0x6c,0x75,0x65,0x3a,0x7b,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x3a,0x5b,0x65,0x5d,0x7d,0x7d,0x29,0x2c,0x61,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x22,0x6f,0x6e,0x44,0x61,0x74,0x61,0x22,0x2b,0x65,0x2e,0x63,0x68,0x61,0x72,0x41,0x74,0x28,0x30,0x29,0x2e,0x74,0x6f,0x55,0x70,0x70,0x65,0x72,0x43,0x61,0x73,0x65,0x28,0x29,0x2b,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x31,0x29,0x2c,0x61,0x3d,0x74,0x5b,0x65,0x5d,0x3b,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x64,0x65,0x66,0x69,0x6e,0x65,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x2c,0x65,0x2c,0x7b,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x61,0x62,0x6c,0x65,0x3a,0x21,0x30,0x2c,0x65,0x6e,0x75,0x6d,0x65,0x72,0x61,0x62,0x6c,0x65,0x3a,0x21,0x31,0x2c,0x76,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x6f,0x3d,0x61,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x68,0x69,0x73,0x2c,0x65,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x2e,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x5b,0x6e,0x5d,0x26,0x26,0x74,0x5b,0x6e,0x5d,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x65,0x29,0x7d,0x29,0x2c,0x6f,0x7d,0x7d,0x29,0x7d,0x29,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x3b,0x69,0x66,0x28,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x6e,0x2e,0x6c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x73,0x2c,0x6f,0x3d,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x65,0x29,0x3b,0x2d,0x31,0x21,0x3d,0x3d,0x6f,0x26,0x26,0x69,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x6f,0x2c,0x31,0x29,0x2c,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x7c,0x7c,0x28,0x61,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x74,0x5b,0x65,0x5d,0x7d,0x29,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x29,0x7d,0x7d,0x76,0x61,0x72,0x20,0x61,0x3d,0x5b,0x22,0x70,0x75,0x73,0x68,0x22,0x2c,0x22,0x70,0x6f,0x70,0x22,0x2c,0x22,0x73,0x68,0x69,0x66,0x74,0x22,0x2c,0x22,0x73,0x70,0x6c,0x69,0x63,0x65,0x22,0x2c,0x22,0x75,0x6e,0x73,0x68,0x69,0x66,0x74,0x22,0x5d,0x3b,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x28,0x74,0x2c,0x65,0x29,0x7d,0x2c,0x69,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x7b,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x3b,0x6e,0x2e,0x63,0x68,0x61,0x72,0x74,0x3d,0x74,0x2c,0x6e,0x2e,0x69,0x6e,0x64,0x65,0x78,0x3d,0x65,0x2c,0x6e,0x2e,0x6c,0x69,0x6e,0x6b,0x53,0x63,0x61,0x6c,0x65,0x73,0x28,0x29,0x2c,0x6e,0x2e,0x61,0x64,0x64,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x3d,0x74,0x7d,0x2c,0x6c,0x69,0x6e,0x6b,0x53,0x63,0x61,0x6c,0x65,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x6e,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x3b,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x26,0x26,0x28,0x65,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x6e,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x7c,0x7c,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2e,0x78,0x41,0x78,0x65,0x73,0x5b,0x30,0x5d,0x2e,0x69,0x64,0x29,0x2c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x26,0x26,0x28,0x65,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x6e,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x7c,0x7c,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2e,0x79,0x41,0x78,0x65,0x73,0x5b,0x30,0x5d,0x2e,0x69,0x64,0x29,0x7d,0x2c,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x7d,0x2c,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x29,0x7d,0x2c,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x46,0x6f,0x72,0x49,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x5b,0x74,0x5d,0x7d,0x2c,0x72,0x65,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x21,0x30,0x29,0x7d,0x2c,0x64,0x65,0x73,0x74,0x72,0x6f,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x5f,0x64,0x61,0x74,0x61,0x26,0x26,0x6e,0x28,0x74,0x68,0x69,0x73,0x2e,0x5f,0x64,0x61,0x74,0x61,0x2c,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x63,0x72,0x65,0x61,0x74,0x65,0x4d,0x65,0x74,0x61,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x26,0x26,0x6e,0x65,0x77,0x20,0x65,0x28,0x7b,0x5f,0x63,0x68,0x61,0x72,0x74,0x3a,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x7d,0x29,0x7d,0x2c,0x63,0x72,0x65,0x61,0x74,0x65,0x4d,0x65,0x74,0x61,0x44,0x61,0x74,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x54,0x79,0x70,0x65,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x26,0x26,0x6e,0x65,0x77,0x20,0x6e,0x28,0x7b,0x5f,0x63,0x68,0x61,0x72,0x74,0x3a,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2c,0x5f,0x69,0x6e,0x64,0x65,0x78,0x3a,0x74,0x7d,0x29,0x7d,0x2c,0x61,0x64,0x64,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x61,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x5b,0x5d,0x2c,0x6f,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x3b,0x66,0x6f,0x72,0x28,0x74,0x3d,0x30,0x2c,0x65,0x3d,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x74,0x3c,0x65,0x3b,0x2b,0x2b,0x74,0x29,0x6f,0x5b,0x74,0x5d,0x3d,0x6f,0x5b,0x74,0x5d,0x7c,0x7c,0x6e,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x4d,0x65,0x74,0x61,0x44,0x61,0x74,0x61,0x28,0x74,0x29,0x3b,0x69,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x7c,0x7c,0x6e,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x4d,0x65,0x74,0x61,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x7d,0x2c,0x61,0x64,0x64,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x41,0x6e,0x64,0x52,0x65,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x4d,0x65,0x74,0x61,0x44,0x61,0x74,0x61,0x28,0x74,0x29,0x3b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x74,0x2c,0x30,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x65,0x2c,0x74,0x2c,0x21,0x30,0x29,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x4f,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x28,0x69,0x2e,0x64,0x61,0x74,0x61,0x3d,0x5b,0x5d,0x29,0x3b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x21,0x3d,0x3d,0x61,0x26,0x26,0x28,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x26,0x26,0x6e,0x28,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x2c,0x74,0x29,0x2c,0x65,0x28,0x61,0x2c,0x74,0x29,0x2c,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x3d,0x61,0x29,0x2c,0x74,0x2e,0x72,0x65,0x73,0x79,0x6e,0x63,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x69,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x6e,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x5b,0x5d,0x2c,0x69,0x3d,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x61,0x3d,0x30,0x3b,0x61,0x3c,0x69,0x3b,0x2b,0x2b,0x61,0x29,0x6e,0x5b,0x61,0x5d,0x2e,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x3b,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x26,0x26,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x65,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x5b,0x5d,0x2c,0x6e,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x69,0x3d,0x30,0x3b,0x66,0x6f,0x72,0x28,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x26,0x26,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x3b,0x69,0x3c,0x6e,0x3b,0x2b,0x2b,0x69,0x29,0x65,0x5b,0x69,0x5d,0x2e,0x64,0x72,0x61,0x77,0x28,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x6f,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x72,0x3d,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x6c,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6f,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6f,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x28,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x2c,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x6f,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x6f,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x28,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x6f,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x6f,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x72,0x28,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x61,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x2c,0x73,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x53,0x74,0x79,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x7c,0x7c,0x7b,0x7d,0x2c,0x6f,0x3d,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6c,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x61,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x61,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x28,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x72,0x28,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x61,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3f,0x61,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x28,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6e,0x2c,0x72,0x28,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x29,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3d,0x61,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3f,0x61,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x6f,0x28,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x7d,0x2c,0x72,0x65,0x73,0x79,0x6e,0x63,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2c,0x6e,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2c,0x69,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x61,0x3d,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x69,0x3f,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x61,0x2c,0x69,0x2d,0x61,0x29,0x3a,0x61,0x3e,0x69,0x26,0x26,0x74,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x69,0x2c,0x61,0x2d,0x69,0x29,0x7d,0x2c,0x69,0x6e,0x73,0x65,0x72,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x65,0x3b,0x2b,0x2b,0x6e,0x29,0x74,0x68,0x69,0x73,0x2e,0x61,0x64,0x64,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x41,0x6e,0x64,0x52,0x65,0x73,0x65,0x74,0x28,0x74,0x2b,0x6e,0x29,0x7d,0x2c,0x6f,0x6e,0x44,0x61,0x74,0x61,0x50,0x75,0x73,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x7d,0x2c,0x6f,0x6e,0x44,0x61,0x74,0x61,0x50,0x6f,0x70,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x70,0x6f,0x70,0x28,0x29,0x7d,0x2c,0x6f,0x6e,0x44,0x61,0x74,0x61,0x53,0x68,0x69,0x66,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x73,0x68,0x69,0x66,0x74,0x28,0x29,0x7d,0x2c,0x6f,0x6e,0x44,0x61,0x74,0x61,0x53,0x70,0x6c,0x69,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x74,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x32,0x29,0x7d,0x2c,0x6f,0x6e,0x44,0x61,0x74,0x61,0x55,0x6e,0x73,0x68,0x69,0x66,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x28,0x30,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x6c,0x65,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x3d,0x69,0x2e,0x69,0x6e,0x68,0x65,0x72,0x69,0x74,0x73,0x7d,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x35,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x5f,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x74,0x68,0x69,0x73,0x5b,0x74,0x5d,0x7c,0x7c,0x28,0x74,0x68,0x69,0x73,0x5b,0x74,0x5d,0x3d,0x7b,0x7d,0x29,0x2c,0x65,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x36,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x2c,0x63,0x2c,0x68,0x2c,0x66,0x2c,0x67,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x6b,0x65,0x79,0x73,0x28,0x6e,0x29,0x3b,0x66,0x6f,0x72,0x28,0x6f,0x3d,0x30,0x2c,0x72,0x3d,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6f,0x3c,0x72,0x3b,0x2b,0x2b,0x6f,0x29,0x69,0x66,0x28,0x6c,0x3d,0x67,0x5b,0x6f,0x5d,0x2c,0x64,0x3d,0x6e,0x5b,0x6c,0x5d,0x2c,0x65,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x6c,0x29,0x7c,0x7c,0x28,0x65,0x5b,0x6c,0x5d,0x3d,0x64,0x29,0x2c,0x28,0x73,0x3d,0x65,0x5b,0x6c,0x5d,0x29,0x21,0x3d,0x3d,0x64,0x26,0x26,0x22,0x5f,0x22,0x21,0x3d,0x3d,0x6c,0x5b,0x30,0x5d,0x29,0x7b,0x69,0x66,0x28,0x74,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x6c,0x29,0x7c,0x7c,0x28,0x74,0x5b,0x6c,0x5d,0x3d,0x73,0x29,0x2c,0x75,0x3d,0x74,0x5b,0x6c,0x5d,0x2c,0x28,0x63,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x29,0x3d,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x75,0x29,0x69,0x66,0x28,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x3d,0x63,0x29,0x7b,0x69,0x66,0x28,0x28,0x68,0x3d,0x61,0x28,0x75,0x29,0x29,0x2e,0x76,0x61,0x6c,0x69,0x64,0x26,0x26,0x28,0x66,0x3d,0x61,0x28,0x64,0x29,0x29,0x2e,0x76,0x61,0x6c,0x69,0x64,0x29,0x7b,0x65,0x5b,0x6c,0x5d,0x3d,0x66,0x2e,0x6d,0x69,0x78,0x28,0x68,0x2c,0x69,0x29,0x2e,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x3b,0x63,0x6f,0x6e,0x74,0x69,0x6e,0x75,0x65,0x7d,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x63,0x26,0x26,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x75,0x29,0x26,0x26,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x64,0x29,0x29,0x7b,0x65,0x5b,0x6c,0x5d,0x3d,0x75,0x2b,0x28,0x64,0x2d,0x75,0x29,0x2a,0x69,0x3b,0x63,0x6f,0x6e,0x74,0x69,0x6e,0x75,0x65,0x7d,0x65,0x5b,0x6c,0x5d,0x3d,0x64,0x7d,0x7d,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x28,0x33,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x68,0x69,0x73,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x3b,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x72,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3d,0x21,0x31,0x7d,0x2c,0x70,0x69,0x76,0x6f,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x5f,0x76,0x69,0x65,0x77,0x7c,0x7c,0x28,0x74,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3d,0x6f,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x29,0x29,0x2c,0x74,0x2e,0x5f,0x73,0x74,0x61,0x72,0x74,0x3d,0x7b,0x7d,0x2c,0x74,0x7d,0x2c,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x61,0x3d,0x65,0x2e,0x5f,0x73,0x74,0x61,0x72,0x74,0x2c,0x6f,0x3d,0x65,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x26,0x26,0x31,0x21,0x3d,0x3d,0x74,0x3f,0x28,0x6f,0x7c,0x7c,0x28,0x6f,0x3d,0x65,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3d,0x7b,0x7d,0x29,0x2c,0x61,0x7c,0x7c,0x28,0x61,0x3d,0x65,0x2e,0x5f,0x73,0x74,0x61,0x72,0x74,0x3d,0x7b,0x7d,0x29,0x2c,0x69,0x28,0x61,0x2c,0x6f,0x2c,0x6e,0x2c,0x74,0x29,0x2c,0x65,0x29,0x3a,0x28,0x65,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3d,0x6e,0x2c,0x65,0x2e,0x5f,0x73,0x74,0x61,0x72,0x74,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x65,0x29,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x7d,0x7d,0x2c,0x68,0x61,0x73,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x69,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x28,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x29,0x26,0x26,0x6f,0x2e,0x69,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x28,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x29,0x7d,0x7d,0x29,0x2c,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x3d,0x6f,0x2e,0x69,0x6e,0x68,0x65,0x72,0x69,0x74,0x73,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x72,0x7d,0x2c,0x7b,0x33,0x3a,0x33,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x37,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x33,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x3f,0x28,0x69,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x74,0x2c,0x31,0x30,0x29,0x2c,0x2d,0x31,0x21,0x3d,0x3d,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x22,0x25,0x22,0x29,0x26,0x26,0x28,0x69,0x3d,0x69,0x2f,0x31,0x30,0x30,0x2a,0x65,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x5b,0x6e,0x5d,0x29,0x29,0x3a,0x69,0x3d,0x74,0x2c,0x69,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x26,0x26,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x74,0x26,0x26,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x21,0x3d,0x3d,0x74,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x56,0x69,0x65,0x77,0x2c,0x72,0x3d,0x74,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x2c,0x6c,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6d,0x70,0x75,0x74,0x65,0x64,0x53,0x74,0x79,0x6c,0x65,0x28,0x74,0x29,0x5b,0x69,0x5d,0x2c,0x73,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6d,0x70,0x75,0x74,0x65,0x64,0x53,0x74,0x79,0x6c,0x65,0x28,0x72,0x29,0x5b,0x69,0x5d,0x2c,0x75,0x3d,0x6e,0x28,0x6c,0x29,0x2c,0x64,0x3d,0x6e,0x28,0x73,0x29,0x2c,0x63,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x50,0x4f,0x53,0x49,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x7c,0x7c,0x64,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x75,0x3f,0x65,0x28,0x6c,0x2c,0x74,0x2c,0x61,0x29,0x3a,0x63,0x2c,0x64,0x3f,0x65,0x28,0x73,0x2c,0x72,0x2c,0x61,0x29,0x3a,0x63,0x29,0x3a,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x7d,0x6f,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x4d,0x65,0x72,0x67,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x6f,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x5b,0x30,0x5d,0x29,0x2c,0x5b,0x5d,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x2c,0x31,0x29,0x2c,0x7b,0x6d,0x65,0x72,0x67,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6e,0x5b,0x65,0x5d,0x7c,0x7c,0x7b,0x7d,0x2c,0x6c,0x3d,0x69,0x5b,0x65,0x5d,0x3b,0x22,0x73,0x63,0x61,0x6c,0x65,0x73,0x22,0x3d,0x3d,0x3d,0x65,0x3f,0x6e,0x5b,0x65,0x5d,0x3d,0x6f,0x2e,0x73,0x63,0x61,0x6c,0x65,0x4d,0x65,0x72,0x67,0x65,0x28,0x72,0x2c,0x6c,0x29,0x3a,0x22,0x73,0x63,0x61,0x6c,0x65,0x22,0x3d,0x3d,0x3d,0x65,0x3f,0x6e,0x5b,0x65,0x5d,0x3d,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x72,0x2c,0x5b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x28,0x6c,0x2e,0x74,0x79,0x70,0x65,0x29,0x2c,0x6c,0x5d,0x29,0x3a,0x6f,0x2e,0x5f,0x6d,0x65,0x72,0x67,0x65,0x72,0x28,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7d,0x7d,0x29,0x7d,0x2c,0x6f,0x2e,0x73,0x63,0x61,0x6c,0x65,0x4d,0x65,0x72,0x67,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x6f,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x5b,0x30,0x5d,0x29,0x2c,0x5b,0x5d,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x2c,0x31,0x29,0x2c,0x7b,0x6d,0x65,0x72,0x67,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x69,0x66,0x28,0x22,0x78,0x41,0x78,0x65,0x73,0x22,0x3d,0x3d,0x3d,0x65,0x7c,0x7c,0x22,0x79,0x41,0x78,0x65,0x73,0x22,0x3d,0x3d,0x3d,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x3d,0x69,0x5b,0x65,0x5d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x5b,0x65,0x5d,0x7c,0x7c,0x28,0x6e,0x5b,0x65,0x5d,0x3d,0x5b,0x5d,0x29,0x2c,0x72,0x3d,0x30,0x3b,0x72,0x3c,0x75,0x3b,0x2b,0x2b,0x72,0x29,0x73,0x3d,0x69,0x5b,0x65,0x5d,0x5b,0x72,0x5d,0x2c,0x6c,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x73,0x2e,0x74,0x79,0x70,0x65,0x2c,0x22,0x78,0x41,0x78,0x65,0x73,0x22,0x3d,0x3d,0x3d,0x65,0x3f,0x22,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x22,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x29,0x2c,0x72,0x3e,0x3d,0x6e,0x5b,0x65,0x5d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x6e,0x5b,0x65,0x5d,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x7d,0x29,0x2c,0x21,0x6e,0x5b,0x65,0x5d,0x5b,0x72,0x5d,0x2e,0x74,0x79,0x70,0x65,0x7c,0x7c,0x73,0x2e,0x74,0x79,0x70,0x65,0x26,0x26,0x73,0x2e,0x74,0x79,0x70,0x65,0x21,0x3d,0x3d,0x6e,0x5b,0x65,0x5d,0x5b,0x72,0x5d,0x2e,0x74,0x79,0x70,0x65,0x3f,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x6e,0x5b,0x65,0x5d,0x5b,0x72,0x5d,0x2c,0x5b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x28,0x6c,0x29,0x2c,0x73,0x5d,0x29,0x3a,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x6e,0x5b,0x65,0x5d,0x5b,0x72,0x5d,0x2c,0x73,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x6f,0x2e,0x5f,0x6d,0x65,0x72,0x67,0x65,0x72,0x28,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7d,0x7d,0x29,0x7d,0x2c,0x6f,0x2e,0x77,0x68,0x65,0x72,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x69,0x66,0x28,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x26,0x26,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x65,0x29,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x65,0x28,0x74,0x29,0x26,0x26,0x6e,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x7d,0x29,0x2c,0x6e,0x7d,0x2c,0x6f,0x2e,0x66,0x69,0x6e,0x64,0x49,0x6e,0x64,0x65,0x78,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x66,0x69,0x6e,0x64,0x49,0x6e,0x64,0x65,0x78,0x3f,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x66,0x69,0x6e,0x64,0x49,0x6e,0x64,0x65,0x78,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x6e,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x3f,0x74,0x3a,0x6e,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x3d,0x30,0x2c,0x61,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x3c,0x61,0x3b,0x2b,0x2b,0x69,0x29,0x69,0x66,0x28,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x6e,0x2c,0x74,0x5b,0x69,0x5d,0x2c,0x69,0x2c,0x74,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2d,0x31,0x7d,0x2c,0x6f,0x2e,0x66,0x69,0x6e,0x64,0x4e,0x65,0x78,0x74,0x57,0x68,0x65,0x72,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x6f,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x6e,0x29,0x26,0x26,0x28,0x6e,0x3d,0x2d,0x31,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x3d,0x6e,0x2b,0x31,0x3b,0x69,0x3c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x2b,0x2b,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x5b,0x69,0x5d,0x3b,0x69,0x66,0x28,0x65,0x28,0x61,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x7d,0x7d,0x2c,0x6f,0x2e,0x66,0x69,0x6e,0x64,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x57,0x68,0x65,0x72,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x6f,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x6e,0x29,0x26,0x26,0x28,0x6e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x3d,0x6e,0x2d,0x31,0x3b,0x69,0x3e,0x3d,0x30,0x3b,0x69,0x2d,0x2d,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x5b,0x69,0x5d,0x3b,0x69,0x66,0x28,0x65,0x28,0x61,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x7d,0x7d,0x2c,0x6f,0x2e,0x69,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x69,0x73,0x4e,0x61,0x4e,0x28,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x74,0x29,0x29,0x26,0x26,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x74,0x29,0x7d,0x2c,0x6f,0x2e,0x61,0x6c,0x6d,0x6f,0x73,0x74,0x45,0x71,0x75,0x61,0x6c,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x74,0x2d,0x65,0x29,0x3c,0x6e,0x7d,0x2c,0x6f,0x2e,0x61,0x6c,0x6d,0x6f,0x73,0x74,0x57,0x68,0x6f,0x6c,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2d,0x65,0x3c,0x74,0x26,0x26,0x6e,0x2b,0x65,0x3e,0x74,0x7d,0x2c,0x6f,0x2e,0x6d,0x61,0x78,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x72,0x65,0x64,0x75,0x63,0x65,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x73,0x4e,0x61,0x4e,0x28,0x65,0x29,0x3f,0x74,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x74,0x2c,0x65,0x29,0x7d,0x2c,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x4e,0x45,0x47,0x41,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x29,0x7d,0x2c,0x6f,0x2e,0x6d,0x69,0x6e,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x72,0x65,0x64,0x75,0x63,0x65,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x73,0x4e,0x61,0x4e,0x28,0x65,0x29,0x3f,0x74,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7d,0x2c,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x50,0x4f,0x53,0x49,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x29,0x7d,0x2c,0x6f,0x2e,0x73,0x69,0x67,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x67,0x6e,0x3f,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x67,0x6e,0x28,0x74,0x29,0x7d,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x28,0x74,0x3d,0x2b,0x74,0x29,0x7c,0x7c,0x69,0x73,0x4e,0x61,0x4e,0x28,0x74,0x29,0x3f,0x74,0x3a,0x74,0x3e,0x30,0x3f,0x31,0x3a,0x2d,0x31,0x7d,0x2c,0x6f,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x3f,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x74,0x29,0x7d,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x6c,0x6f,0x67,0x28,0x74,0x29,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x4c,0x4e,0x31,0x30,0x7d,0x2c,0x6f,0x2e,0x74,0x6f,0x52,0x61,0x64,0x69,0x61,0x6e,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x31,0x38,0x30,0x29,0x7d,0x2c,0x6f,0x2e,0x74,0x6f,0x44,0x65,0x67,0x72,0x65,0x65,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x28,0x31,0x38,0x30,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x41,0x6e,0x67,0x6c,0x65,0x46,0x72,0x6f,0x6d,0x50,0x6f,0x69,0x6e,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x78,0x2d,0x74,0x2e,0x78,0x2c,0x69,0x3d,0x65,0x2e,0x79,0x2d,0x74,0x2e,0x79,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x6e,0x2a,0x6e,0x2b,0x69,0x2a,0x69,0x29,0x2c,0x6f,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x61,0x74,0x61,0x6e,0x32,0x28,0x69,0x2c,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3c,0x2d,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x26,0x26,0x28,0x6f,0x2b,0x3d,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2c,0x7b,0x61,0x6e,0x67,0x6c,0x65,0x3a,0x6f,0x2c,0x64,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x3a,0x61,0x7d,0x7d,0x2c,0x6f,0x2e,0x64,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x42,0x65,0x74,0x77,0x65,0x65,0x6e,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2e,0x78,0x2d,0x74,0x2e,0x78,0x2c,0x32,0x29,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2e,0x79,0x2d,0x74,0x2e,0x79,0x2c,0x32,0x29,0x29,0x7d,0x2c,0x6f,0x2e,0x61,0x6c,0x69,0x61,0x73,0x50,0x69,0x78,0x65,0x6c,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x25,0x32,0x3d,0x3d,0x30,0x3f,0x30,0x3a,0x2e,0x35,0x7d,0x2c,0x6f,0x2e,0x73,0x70,0x6c,0x69,0x6e,0x65,0x43,0x75,0x72,0x76,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x2e,0x73,0x6b,0x69,0x70,0x3f,0x65,0x3a,0x74,0x2c,0x6f,0x3d,0x65,0x2c,0x72,0x3d,0x6e,0x2e,0x73,0x6b,0x69,0x70,0x3f,0x65,0x3a,0x6e,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6f,0x2e,0x78,0x2d,0x61,0x2e,0x78,0x2c,0x32,0x29,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6f,0x2e,0x79,0x2d,0x61,0x2e,0x79,0x2c,0x32,0x29,0x29,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x72,0x2e,0x78,0x2d,0x6f,0x2e,0x78,0x2c,0x32,0x29,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x72,0x2e,0x79,0x2d,0x6f,0x2e,0x79,0x2c,0x32,0x29,0x29,0x2c,0x75,0x3d,0x6c,0x2f,0x28,0x6c,0x2b,0x73,0x29,0x2c,0x64,0x3d,0x73,0x2f,0x28,0x6c,0x2b,0x73,0x29,0x2c,0x63,0x3d,0x69,0x2a,0x28,0x75,0x3d,0x69,0x73,0x4e,0x61,0x4e,0x28,0x75,0x29,0x3f,0x30,0x3a,0x75,0x29,0x2c,0x68,0x3d,0x69,0x2a,0x28,0x64,0x3d,0x69,0x73,0x4e,0x61,0x4e,0x28,0x64,0x29,0x3f,0x30,0x3a,0x64,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x3a,0x7b,0x78,0x3a,0x6f,0x2e,0x78,0x2d,0x63,0x2a,0x28,0x72,0x2e,0x78,0x2d,0x61,0x2e,0x78,0x29,0x2c,0x79,0x3a,0x6f,0x2e,0x79,0x2d,0x63,0x2a,0x28,0x72,0x2e,0x79,0x2d,0x61,0x2e,0x79,0x29,0x7d,0x2c,0x6e,0x65,0x78,0x74,0x3a,0x7b,0x78,0x3a,0x6f,0x2e,0x78,0x2b,0x68,0x2a,0x28,0x72,0x2e,0x78,0x2d,0x61,0x2e,0x78,0x29,0x2c,0x79,0x3a,0x6f,0x2e,0x79,0x2b,0x68,0x2a,0x28,0x72,0x2e,0x79,0x2d,0x61,0x2e,0x79,0x29,0x7d,0x7d,0x7d,0x2c,0x6f,0x2e,0x45,0x50,0x53,0x49,0x4c,0x4f,0x4e,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x45,0x50,0x53,0x49,0x4c,0x4f,0x4e,0x7c,0x7c,0x31,0x65,0x2d,0x31,0x34,0x2c,0x6f,0x2e,0x73,0x70,0x6c,0x69,0x6e,0x65,0x43,0x75,0x72,0x76,0x65,0x4d,0x6f,0x6e,0x6f,0x74,0x6f,0x6e,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x72,0x3d,0x28,0x74,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6d,0x6f,0x64,0x65,0x6c,0x3a,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x64,0x65,0x6c,0x74,0x61,0x4b,0x3a,0x30,0x2c,0x6d,0x4b,0x3a,0x30,0x7d,0x7d,0x29,0x2c,0x6c,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x3b,0x65,0x3c,0x6c,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x66,0x28,0x21,0x28,0x69,0x3d,0x72,0x5b,0x65,0x5d,0x29,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x29,0x7b,0x69,0x66,0x28,0x6e,0x3d,0x65,0x3e,0x30,0x3f,0x72,0x5b,0x65,0x2d,0x31,0x5d,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x28,0x61,0x3d,0x65,0x3c,0x6c,0x2d,0x31,0x3f,0x72,0x5b,0x65,0x2b,0x31,0x5d,0x3a,0x6e,0x75,0x6c,0x6c,0x29,0x26,0x26,0x21,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x3b,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x3d,0x30,0x21,0x3d,0x3d,0x73,0x3f,0x28,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x2d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x29,0x2f,0x73,0x3a,0x30,0x7d,0x21,0x6e,0x7c,0x7c,0x6e,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x3f,0x69,0x2e,0x6d,0x4b,0x3d,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x3a,0x21,0x61,0x7c,0x7c,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x3f,0x69,0x2e,0x6d,0x4b,0x3d,0x6e,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x3a,0x74,0x68,0x69,0x73,0x2e,0x73,0x69,0x67,0x6e,0x28,0x6e,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x29,0x21,0x3d,0x3d,0x74,0x68,0x69,0x73,0x2e,0x73,0x69,0x67,0x6e,0x28,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x29,0x3f,0x69,0x2e,0x6d,0x4b,0x3d,0x30,0x3a,0x69,0x2e,0x6d,0x4b,0x3d,0x28,0x6e,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x2b,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x29,0x2f,0x32,0x7d,0x76,0x61,0x72,0x20,0x75,0x2c,0x64,0x2c,0x63,0x2c,0x68,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x3b,0x65,0x3c,0x6c,0x2d,0x31,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x3d,0x72,0x5b,0x65,0x5d,0x2c,0x61,0x3d,0x72,0x5b,0x65,0x2b,0x31,0x5d,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x28,0x6f,0x2e,0x61,0x6c,0x6d,0x6f,0x73,0x74,0x45,0x71,0x75,0x61,0x6c,0x73,0x28,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x2c,0x30,0x2c,0x74,0x68,0x69,0x73,0x2e,0x45,0x50,0x53,0x49,0x4c,0x4f,0x4e,0x29,0x3f,0x69,0x2e,0x6d,0x4b,0x3d,0x61,0x2e,0x6d,0x4b,0x3d,0x30,0x3a,0x28,0x75,0x3d,0x69,0x2e,0x6d,0x4b,0x2f,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x2c,0x64,0x3d,0x61,0x2e,0x6d,0x4b,0x2f,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x2c,0x28,0x68,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x75,0x2c,0x32,0x29,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x64,0x2c,0x32,0x29,0x29,0x3c,0x3d,0x39,0x7c,0x7c,0x28,0x63,0x3d,0x33,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x68,0x29,0x2c,0x69,0x2e,0x6d,0x4b,0x3d,0x75,0x2a,0x63,0x2a,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x2c,0x61,0x2e,0x6d,0x4b,0x3d,0x64,0x2a,0x63,0x2a,0x69,0x2e,0x64,0x65,0x6c,0x74,0x61,0x4b,0x29,0x29,0x29,0x3b,0x76,0x61,0x72,0x20,0x66,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x3b,0x65,0x3c,0x6c,0x3b,0x2b,0x2b,0x65,0x29,0x28,0x69,0x3d,0x72,0x5b,0x65,0x5d,0x29,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x28,0x6e,0x3d,0x65,0x3e,0x30,0x3f,0x72,0x5b,0x65,0x2d,0x31,0x5d,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x61,0x3d,0x65,0x3c,0x6c,0x2d,0x31,0x3f,0x72,0x5b,0x65,0x2b,0x31,0x5d,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6e,0x26,0x26,0x21,0x6e,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x26,0x26,0x28,0x66,0x3d,0x28,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2d,0x6e,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x29,0x2f,0x33,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x3d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2d,0x66,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x3d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x2d,0x66,0x2a,0x69,0x2e,0x6d,0x4b,0x29,0x2c,0x61,0x26,0x26,0x21,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x73,0x6b,0x69,0x70,0x26,0x26,0x28,0x66,0x3d,0x28,0x61,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x29,0x2f,0x33,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x3d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2b,0x66,0x2c,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x3d,0x69,0x2e,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x2b,0x66,0x2a,0x69,0x2e,0x6d,0x4b,0x29,0x29,0x7d,0x2c,0x6f,0x2e,0x6e,0x65,0x78,0x74,0x49,0x74,0x65,0x6d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3f,0x65,0x3e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3f,0x74,0x5b,0x30,0x5d,0x3a,0x74,0x5b,0x65,0x2b,0x31,0x5d,0x3a,0x65,0x3e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3f,0x74,0x5b,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x3a,0x74,0x5b,0x65,0x2b,0x31,0x5d,0x7d,0x2c,0x6f,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x49,0x74,0x65,0x6d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3f,0x65,0x3c,0x3d,0x30,0x3f,0x74,0x5b,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x3a,0x74,0x5b,0x65,0x2d,0x31,0x5d,0x3a,0x65,0x3c,0x3d,0x30,0x3f,0x74,0x5b,0x30,0x5d,0x3a,0x74,0x5b,0x65,0x2d,0x31,0x5d,0x7d,0x2c,0x6f,0x2e,0x6e,0x69,0x63,0x65,0x4e,0x75,0x6d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x6f,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x74,0x29,0x29,0x2c,0x69,0x3d,0x74,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x65,0x3f,0x69,0x3c,0x31,0x2e,0x35,0x3f,0x31,0x3a,0x69,0x3c,0x33,0x3f,0x32,0x3a,0x69,0x3c,0x37,0x3f,0x35,0x3a,0x31,0x30,0x3a,0x69,0x3c,0x3d,0x31,0x3f,0x31,0x3a,0x69,0x3c,0x3d,0x32,0x3f,0x32,0x3a,0x69,0x3c,0x3d,0x35,0x3f,0x35,0x3a,0x31,0x30,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x6e,0x29,0x7d,0x2c,0x6f,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x46,0x72,0x61,0x6d,0x65,0x3d,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x3f,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x28,0x29,0x7d,0x3a,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x7c,0x7c,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x77,0x65,0x62,0x6b,0x69,0x74,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x7c,0x7c,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6d,0x6f,0x7a,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x7c,0x7c,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6f,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x7c,0x7c,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6d,0x73,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x46,0x72,0x61,0x6d,0x65,0x7c,0x7c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x73,0x65,0x74,0x54,0x69,0x6d,0x65,0x6f,0x75,0x74,0x28,0x74,0x2c,0x31,0x65,0x33,0x2f,0x36,0x30,0x29,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x52,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x2e,0x6f,0x72,0x69,0x67,0x69,0x6e,0x61,0x6c,0x45,0x76,0x65,0x6e,0x74,0x7c,0x7c,0x74,0x2c,0x72,0x3d,0x74,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x54,0x61,0x72,0x67,0x65,0x74,0x7c,0x7c,0x74,0x2e,0x73,0x72,0x63,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x2c,0x6c,0x3d,0x72,0x2e,0x67,0x65,0x74,0x42,0x6f,0x75,0x6e,0x64,0x69,0x6e,0x67,0x43,0x6c,0x69,0x65,0x6e,0x74,0x52,0x65,0x63,0x74,0x28,0x29,0x2c,0x73,0x3d,0x61,0x2e,0x74,0x6f,0x75,0x63,0x68,0x65,0x73,0x3b,0x73,0x26,0x26,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x3f,0x28,0x6e,0x3d,0x73,0x5b,0x30,0x5d,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x58,0x2c,0x69,0x3d,0x73,0x5b,0x30,0x5d,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x59,0x29,0x3a,0x28,0x6e,0x3d,0x61,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x58,0x2c,0x69,0x3d,0x61,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x59,0x29,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x72,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x6c,0x65,0x66,0x74,0x22,0x29,0x29,0x2c,0x64,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x72,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x74,0x6f,0x70,0x22,0x29,0x29,0x2c,0x63,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x72,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x72,0x69,0x67,0x68,0x74,0x22,0x29,0x29,0x2c,0x68,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x72,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x29,0x29,0x2c,0x66,0x3d,0x6c,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x6c,0x2e,0x6c,0x65,0x66,0x74,0x2d,0x75,0x2d,0x63,0x2c,0x67,0x3d,0x6c,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x6c,0x2e,0x74,0x6f,0x70,0x2d,0x64,0x2d,0x68,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x28,0x6e,0x2d,0x6c,0x2e,0x6c,0x65,0x66,0x74,0x2d,0x75,0x29,0x2f,0x66,0x2a,0x72,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x44,0x65,0x76,0x69,0x63,0x65,0x50,0x69,0x78,0x65,0x6c,0x52,0x61,0x74,0x69,0x6f,0x29,0x2c,0x69,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x28,0x69,0x2d,0x6c,0x2e,0x74,0x6f,0x70,0x2d,0x64,0x29,0x2f,0x67,0x2a,0x72,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x65,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x44,0x65,0x76,0x69,0x63,0x65,0x50,0x69,0x78,0x65,0x6c,0x52,0x61,0x74,0x69,0x6f,0x29,0x2c,0x7b,0x78,0x3a,0x6e,0x2c,0x79,0x3a,0x69,0x7d,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x73,0x74,0x72,0x61,0x69,0x6e,0x74,0x57,0x69,0x64,0x74,0x68,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x28,0x74,0x2c,0x22,0x6d,0x61,0x78,0x2d,0x77,0x69,0x64,0x74,0x68,0x22,0x2c,0x22,0x63,0x6c,0x69,0x65,0x6e,0x74,0x57,0x69,0x64,0x74,0x68,0x22,0x29,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x73,0x74,0x72,0x61,0x69,0x6e,0x74,0x48,0x65,0x69,0x67,0x68,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x28,0x74,0x2c,0x22,0x6d,0x61,0x78,0x2d,0x68,0x65,0x69,0x67,0x68,0x74,0x22,0x2c,0x22,0x63,0x6c,0x69,0x65,0x6e,0x74,0x48,0x65,0x69,0x67,0x68,0x74,0x22,0x29,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x4d,0x61,0x78,0x69,0x6d,0x75,0x6d,0x57,0x69,0x64,0x74,0x68,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x3b,0x69,0x66,0x28,0x21,0x65,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x57,0x69,0x64,0x74,0x68,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x65,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x6c,0x65,0x66,0x74,0x22,0x29,0x2c,0x31,0x30,0x29,0x2c,0x69,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x65,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x72,0x69,0x67,0x68,0x74,0x22,0x29,0x2c,0x31,0x30,0x29,0x2c,0x61,0x3d,0x65,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x57,0x69,0x64,0x74,0x68,0x2d,0x6e,0x2d,0x69,0x2c,0x72,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x73,0x74,0x72,0x61,0x69,0x6e,0x74,0x57,0x69,0x64,0x74,0x68,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x73,0x4e,0x61,0x4e,0x28,0x72,0x29,0x3f,0x61,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x61,0x2c,0x72,0x29,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x4d,0x61,0x78,0x69,0x6d,0x75,0x6d,0x48,0x65,0x69,0x67,0x68,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x3b,0x69,0x66,0x28,0x21,0x65,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x48,0x65,0x69,0x67,0x68,0x74,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x65,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x74,0x6f,0x70,0x22,0x29,0x2c,0x31,0x30,0x29,0x2c,0x69,0x3d,0x70,0x61,0x72,0x73,0x65,0x49,0x6e,0x74,0x28,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x65,0x2c,0x22,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x29,0x2c,0x31,0x30,0x29,0x2c,0x61,0x3d,0x65,0x2e,0x63,0x6c,0x69,0x65,0x6e,0x74,0x48,0x65,0x69,0x67,0x68,0x74,0x2d,0x6e,0x2d,0x69,0x2c,0x72,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x73,0x74,0x72,0x61,0x69,0x6e,0x74,0x48,0x65,0x69,0x67,0x68,0x74,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x73,0x4e,0x61,0x4e,0x28,0x72,0x29,0x3f,0x61,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x61,0x2c,0x72,0x29,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3f,0x74,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x5b,0x65,0x5d,0x3a,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x56,0x69,0x65,0x77,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6d,0x70,0x75,0x74,0x65,0x64,0x53,0x74,0x79,0x6c,0x65,0x28,0x74,0x2c,0x6e,0x75,0x6c,0x6c,0x29,0x2e,0x67,0x65,0x74,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x56,0x61,0x6c,0x75,0x65,0x28,0x65,0x29,0x7d,0x2c,0x6f,0x2e,0x72,0x65,0x74,0x69,0x6e,0x61,0x53,0x63,0x61,0x6c,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x44,0x65,0x76,0x69,0x63,0x65,0x50,0x69,0x78,0x65,0x6c,0x52,0x61,0x74,0x69,0x6f,0x3d,0x65,0x7c,0x7c,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x64,0x65,0x76,0x69,0x63,0x65,0x50,0x69,0x78,0x65,0x6c,0x52,0x61,0x74,0x69,0x6f,0x7c,0x7c,0x31,0x3b,0x69,0x66,0x28,0x31,0x21,0x3d,0x3d,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2c,0x61,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x6f,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3b,0x69,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x61,0x2a,0x6e,0x2c,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x6f,0x2a,0x6e,0x2c,0x74,0x2e,0x63,0x74,0x78,0x2e,0x73,0x63,0x61,0x6c,0x65,0x28,0x6e,0x2c,0x6e,0x29,0x2c,0x69,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x61,0x2b,0x22,0x70,0x78,0x22,0x2c,0x69,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x6f,0x2b,0x22,0x70,0x78,0x22,0x7d,0x7d,0x2c,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2b,0x22,0x20,0x22,0x2b,0x74,0x2b,0x22,0x70,0x78,0x20,0x22,0x2b,0x6e,0x7d,0x2c,0x6f,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x28,0x69,0x3d,0x69,0x7c,0x7c,0x7b,0x7d,0x29,0x2e,0x64,0x61,0x74,0x61,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x7c,0x7c,0x7b,0x7d,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x61,0x72,0x62,0x61,0x67,0x65,0x43,0x6f,0x6c,0x6c,0x65,0x63,0x74,0x3d,0x69,0x2e,0x67,0x61,0x72,0x62,0x61,0x67,0x65,0x43,0x6f,0x6c,0x6c,0x65,0x63,0x74,0x7c,0x7c,0x5b,0x5d,0x3b,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x21,0x3d,0x3d,0x65,0x26,0x26,0x28,0x61,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x3d,0x7b,0x7d,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x61,0x72,0x62,0x61,0x67,0x65,0x43,0x6f,0x6c,0x6c,0x65,0x63,0x74,0x3d,0x5b,0x5d,0x2c,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x65,0x29,0x2c,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x65,0x3b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x30,0x3b,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x26,0x26,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x65,0x26,0x26,0x21,0x30,0x21,0x3d,0x3d,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x3f,0x6c,0x3d,0x6f,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x74,0x2c,0x61,0x2c,0x72,0x2c,0x6c,0x2c,0x65,0x29,0x3a,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x26,0x26,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x65,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x7c,0x7c,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x7c,0x7c,0x28,0x6c,0x3d,0x6f,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x74,0x2c,0x61,0x2c,0x72,0x2c,0x6c,0x2c,0x65,0x29,0x29,0x7d,0x29,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2f,0x32,0x3b,0x69,0x66,0x28,0x73,0x3e,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x75,0x3d,0x30,0x3b,0x75,0x3c,0x73,0x3b,0x75,0x2b,0x2b,0x29,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x61,0x5b,0x72,0x5b,0x75,0x5d,0x5d,0x3b,0x72,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x73,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x7d,0x2c,0x6f,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x65,0x5b,0x61,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x7c,0x7c,0x28,0x6f,0x3d,0x65,0x5b,0x61,0x5d,0x3d,0x74,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x61,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2e,0x70,0x75,0x73,0x68,0x28,0x61,0x29,0x29,0x2c,0x6f,0x3e,0x69,0x26,0x26,0x28,0x69,0x3d,0x6f,0x29,0x2c,0x69,0x7d,0x2c,0x6f,0x2e,0x6e,0x75,0x6d,0x62,0x65,0x72,0x4f,0x66,0x4c,0x61,0x62,0x65,0x6c,0x4c,0x69,0x6e,0x65,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x26,0x26,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x65,0x26,0x26,0x28,0x65,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x7d,0x29,0x2c,0x65,0x7d,0x2c,0x6f,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x3d,0x69,0x3f,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x43,0x61,0x6e,0x76,0x61,0x73,0x47,0x72,0x61,0x64,0x69,0x65,0x6e,0x74,0x26,0x26,0x28,0x74,0x3d,0x61,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x69,0x28,0x74,0x29,0x7d,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x63,0x6f,0x6e,0x73,0x6f,0x6c,0x65,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x43,0x6f,0x6c,0x6f,0x72,0x2e,0x6a,0x73,0x20,0x6e,0x6f,0x74,0x20,0x66,0x6f,0x75,0x6e,0x64,0x21,0x22,0x29,0x2c,0x74,0x7d,0x2c,0x6f,0x2e,0x67,0x65,0x74,0x48,0x6f,0x76,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x43,0x61,0x6e,0x76,0x61,0x73,0x50,0x61,0x74,0x74,0x65,0x72,0x6e,0x3f,0x74,0x3a,0x6f,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x28,0x74,0x29,0x2e,0x73,0x61,0x74,0x75,0x72,0x61,0x74,0x65,0x28,0x2e,0x35,0x29,0x2e,0x64,0x61,0x72,0x6b,0x65,0x6e,0x28,0x2e,0x31,0x29,0x2e,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x7d,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x33,0x3a,0x33,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x38,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x6e,0x61,0x74,0x69,0x76,0x65,0x3f,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x7d,0x3a,0x75,0x2e,0x67,0x65,0x74,0x52,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3b,0x66,0x6f,0x72,0x28,0x69,0x3d,0x30,0x2c,0x6f,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x3c,0x6f,0x3b,0x2b,0x2b,0x69,0x29,0x69,0x66,0x28,0x74,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x69,0x29,0x29,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x2c,0x72,0x3d,0x28,0x6e,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x69,0x29,0x29,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x72,0x3b,0x2b,0x2b,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x6e,0x2e,0x64,0x61,0x74,0x61,0x5b,0x61,0x5d,0x3b,0x6c,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x65,0x28,0x6c,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6f,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x28,0x65,0x2e,0x78,0x2c,0x65,0x2e,0x79,0x29,0x26,0x26,0x6e,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x7d,0x29,0x2c,0x6e,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x50,0x4f,0x53,0x49,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x2c,0x72,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x21,0x6e,0x7c,0x7c,0x74,0x2e,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x28,0x65,0x2e,0x78,0x2c,0x65,0x2e,0x79,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x2e,0x67,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x28,0x29,0x2c,0x6c,0x3d,0x69,0x28,0x65,0x2c,0x61,0x29,0x3b,0x6c,0x3c,0x6f,0x3f,0x28,0x72,0x3d,0x5b,0x74,0x5d,0x2c,0x6f,0x3d,0x6c,0x29,0x3a,0x6c,0x3d,0x3d,0x3d,0x6f,0x26,0x26,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x7d,0x7d,0x29,0x2c,0x72,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x2d,0x31,0x21,0x3d,0x3d,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x22,0x78,0x22,0x29,0x2c,0x6e,0x3d,0x2d,0x31,0x21,0x3d,0x3d,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x22,0x79,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x65,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x74,0x2e,0x78,0x2d,0x69,0x2e,0x78,0x29,0x3a,0x30,0x2c,0x6f,0x3d,0x6e,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x74,0x2e,0x79,0x2d,0x69,0x2e,0x79,0x29,0x3a,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x61,0x2c,0x32,0x29,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6f,0x2c,0x32,0x29,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x69,0x28,0x65,0x2c,0x74,0x29,0x3b,0x6e,0x2e,0x61,0x78,0x69,0x73,0x3d,0x6e,0x2e,0x61,0x78,0x69,0x73,0x7c,0x7c,0x22,0x78,0x22,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x6c,0x28,0x6e,0x2e,0x61,0x78,0x69,0x73,0x29,0x2c,0x75,0x3d,0x6e,0x2e,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3f,0x6f,0x28,0x74,0x2c,0x61,0x29,0x3a,0x72,0x28,0x74,0x2c,0x61,0x2c,0x21,0x31,0x2c,0x73,0x29,0x2c,0x64,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3f,0x28,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x69,0x66,0x28,0x74,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x2e,0x64,0x61,0x74,0x61,0x5b,0x75,0x5b,0x30,0x5d,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x5d,0x3b,0x69,0x26,0x26,0x21,0x69,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2e,0x73,0x6b,0x69,0x70,0x26,0x26,0x64,0x2e,0x70,0x75,0x73,0x68,0x28,0x69,0x29,0x7d,0x7d,0x29,0x2c,0x64,0x29,0x3a,0x5b,0x5d,0x7d,0x76,0x61,0x72,0x20,0x75,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x6d,0x6f,0x64,0x65,0x73,0x3a,0x7b,0x73,0x69,0x6e,0x67,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x69,0x28,0x65,0x2c,0x74,0x29,0x2c,0x6f,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x2e,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x28,0x6e,0x2e,0x78,0x2c,0x6e,0x2e,0x79,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x2c,0x6f,0x7d,0x29,0x2c,0x6f,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x31,0x29,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x73,0x2c,0x69,0x6e,0x64,0x65,0x78,0x3a,0x73,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x69,0x28,0x65,0x2c,0x74,0x29,0x3b,0x6e,0x2e,0x61,0x78,0x69,0x73,0x3d,0x6e,0x2e,0x61,0x78,0x69,0x73,0x7c,0x7c,0x22,0x78,0x79,0x22,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x6c,0x28,0x6e,0x2e,0x61,0x78,0x69,0x73,0x29,0x2c,0x75,0x3d,0x6e,0x2e,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3f,0x6f,0x28,0x74,0x2c,0x61,0x29,0x3a,0x72,0x28,0x74,0x2c,0x61,0x2c,0x21,0x31,0x2c,0x73,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x26,0x26,0x28,0x75,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x75,0x5b,0x30,0x5d,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x29,0x2e,0x64,0x61,0x74,0x61,0x29,0x2c,0x75,0x7d,0x2c,0x22,0x78,0x2d,0x61,0x78,0x69,0x73,0x22,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x2c,0x7b,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3a,0x21,0x31,0x7d,0x29,0x7d,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x74,0x2c,0x69,0x28,0x65,0x2c,0x74,0x29,0x29,0x7d,0x2c,0x6e,0x65,0x61,0x72,0x65,0x73,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x69,0x28,0x65,0x2c,0x74,0x29,0x3b,0x6e,0x2e,0x61,0x78,0x69,0x73,0x3d,0x6e,0x2e,0x61,0x78,0x69,0x73,0x7c,0x7c,0x22,0x78,0x79,0x22,0x3b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x6c,0x28,0x6e,0x2e,0x61,0x78,0x69,0x73,0x29,0x2c,0x73,0x3d,0x72,0x28,0x74,0x2c,0x61,0x2c,0x6e,0x2e,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x2c,0x6f,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x31,0x26,0x26,0x73,0x2e,0x73,0x6f,0x72,0x74,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x67,0x65,0x74,0x41,0x72,0x65,0x61,0x28,0x29,0x2d,0x65,0x2e,0x67,0x65,0x74,0x41,0x72,0x65,0x61,0x28,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x26,0x26,0x28,0x6e,0x3d,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x2d,0x65,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x29,0x2c,0x6e,0x7d,0x29,0x2c,0x73,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x2c,0x31,0x29,0x7d,0x2c,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x69,0x28,0x65,0x2c,0x74,0x29,0x2c,0x72,0x3d,0x5b,0x5d,0x2c,0x6c,0x3d,0x21,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x69,0x6e,0x58,0x52,0x61,0x6e,0x67,0x65,0x28,0x6f,0x2e,0x78,0x29,0x26,0x26,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x2c,0x74,0x2e,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x28,0x6f,0x2e,0x78,0x2c,0x6f,0x2e,0x79,0x29,0x26,0x26,0x28,0x6c,0x3d,0x21,0x30,0x29,0x7d,0x29,0x2c,0x6e,0x2e,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x26,0x26,0x21,0x6c,0x26,0x26,0x28,0x72,0x3d,0x5b,0x5d,0x29,0x2c,0x72,0x7d,0x2c,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x69,0x28,0x65,0x2c,0x74,0x29,0x2c,0x72,0x3d,0x5b,0x5d,0x2c,0x6c,0x3d,0x21,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x69,0x6e,0x59,0x52,0x61,0x6e,0x67,0x65,0x28,0x6f,0x2e,0x79,0x29,0x26,0x26,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x2c,0x74,0x2e,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x28,0x6f,0x2e,0x78,0x2c,0x6f,0x2e,0x79,0x29,0x26,0x26,0x28,0x6c,0x3d,0x21,0x30,0x29,0x7d,0x29,0x2c,0x6e,0x2e,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x26,0x26,0x21,0x6c,0x26,0x26,0x28,0x72,0x3d,0x5b,0x5d,0x29,0x2c,0x72,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x32,0x39,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x74,0x28,0x32,0x35,0x29,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x3a,0x21,0x30,0x2c,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x30,0x2c,0x6d,0x61,0x69,0x6e,0x74,0x61,0x69,0x6e,0x41,0x73,0x70,0x65,0x63,0x74,0x52,0x61,0x74,0x69,0x6f,0x3a,0x21,0x30,0x2c,0x65,0x76,0x65,0x6e,0x74,0x73,0x3a,0x5b,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6d,0x6f,0x76,0x65,0x22,0x2c,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6f,0x75,0x74,0x22,0x2c,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x22,0x74,0x6f,0x75,0x63,0x68,0x73,0x74,0x61,0x72,0x74,0x22,0x2c,0x22,0x74,0x6f,0x75,0x63,0x68,0x6d,0x6f,0x76,0x65,0x22,0x5d,0x2c,0x68,0x6f,0x76,0x65,0x72,0x3a,0x7b,0x6f,0x6e,0x48,0x6f,0x76,0x65,0x72,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x6e,0x65,0x61,0x72,0x65,0x73,0x74,0x22,0x2c,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3a,0x21,0x30,0x2c,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x34,0x30,0x30,0x7d,0x2c,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x2e,0x31,0x29,0x22,0x2c,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x23,0x36,0x36,0x36,0x22,0x2c,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x22,0x27,0x48,0x65,0x6c,0x76,0x65,0x74,0x69,0x63,0x61,0x20,0x4e,0x65,0x75,0x65,0x27,0x2c,0x20,0x27,0x48,0x65,0x6c,0x76,0x65,0x74,0x69,0x63,0x61,0x27,0x2c,0x20,0x27,0x41,0x72,0x69,0x61,0x6c,0x27,0x2c,0x20,0x73,0x61,0x6e,0x73,0x2d,0x73,0x65,0x72,0x69,0x66,0x22,0x2c,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x3a,0x31,0x32,0x2c,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x6e,0x6f,0x72,0x6d,0x61,0x6c,0x22,0x2c,0x73,0x68,0x6f,0x77,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x21,0x30,0x2c,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x7d,0x2c,0x6c,0x61,0x79,0x6f,0x75,0x74,0x3a,0x7b,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x7b,0x74,0x6f,0x70,0x3a,0x30,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x30,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x30,0x2c,0x6c,0x65,0x66,0x74,0x3a,0x30,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x28,0x74,0x2c,0x65,0x29,0x2c,0x74,0x68,0x69,0x73,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x43,0x68,0x61,0x72,0x74,0x3d,0x74,0x2c,0x74,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x7d,0x5d,0x2c,0x33,0x30,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x77,0x68,0x65,0x72,0x65,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3d,0x3d,0x3d,0x65,0x7d,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x5f,0x74,0x6d,0x70,0x49,0x6e,0x64,0x65,0x78,0x5f,0x3d,0x65,0x2c,0x74,0x7d,0x29,0x2c,0x74,0x2e,0x73,0x6f,0x72,0x74,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x65,0x3f,0x6e,0x3a,0x74,0x2c,0x61,0x3d,0x65,0x3f,0x74,0x3a,0x6e,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x3d,0x3d,0x3d,0x61,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x3f,0x69,0x2e,0x5f,0x74,0x6d,0x70,0x49,0x6e,0x64,0x65,0x78,0x5f,0x2d,0x61,0x2e,0x5f,0x74,0x6d,0x70,0x49,0x6e,0x64,0x65,0x78,0x5f,0x3a,0x69,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x2d,0x61,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x7d,0x29,0x2c,0x74,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x74,0x2e,0x5f,0x74,0x6d,0x70,0x49,0x6e,0x64,0x65,0x78,0x5f,0x7d,0x29,0x7d,0x74,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x3d,0x7b,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x3a,0x7b,0x7d,0x2c,0x61,0x64,0x64,0x42,0x6f,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x7c,0x7c,0x28,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x3d,0x5b,0x5d,0x29,0x2c,0x65,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3d,0x65,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x21,0x31,0x2c,0x65,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3d,0x65,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x7c,0x7c,0x22,0x74,0x6f,0x70,0x22,0x2c,0x65,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x3d,0x65,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x7c,0x7c,0x30,0x2c,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x65,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x42,0x6f,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x3f,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x65,0x29,0x3a,0x2d,0x31,0x3b,0x2d,0x31,0x21,0x3d,0x3d,0x6e,0x26,0x26,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x6e,0x2c,0x31,0x29,0x7d,0x2c,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x3d,0x5b,0x22,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x22,0x2c,0x22,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x22,0x2c,0x22,0x77,0x65,0x69,0x67,0x68,0x74,0x22,0x5d,0x2c,0x6f,0x3d,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x72,0x3d,0x30,0x3b,0x72,0x3c,0x6f,0x3b,0x2b,0x2b,0x72,0x29,0x69,0x3d,0x61,0x5b,0x72,0x5d,0x2c,0x6e,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x69,0x29,0x26,0x26,0x28,0x65,0x5b,0x69,0x5d,0x3d,0x6e,0x5b,0x69,0x5d,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x61,0x2c,0x6f,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x69,0x2e,0x66,0x69,0x6e,0x64,0x4e,0x65,0x78,0x74,0x57,0x68,0x65,0x72,0x65,0x28,0x5f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x62,0x6f,0x78,0x3d,0x3d,0x3d,0x74,0x7d,0x29,0x3b,0x69,0x66,0x28,0x65,0x29,0x69,0x66,0x28,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x54,0x2c,0x44,0x29,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x46,0x2c,0x49,0x29,0x2c,0x74,0x6f,0x70,0x3a,0x30,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x30,0x7d,0x3b,0x74,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x74,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3f,0x78,0x3a,0x53,0x2c,0x79,0x2f,0x32,0x2c,0x6e,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x74,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x43,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x29,0x7b,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x74,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x74,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3f,0x64,0x3a,0x54,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3f,0x61,0x2d,0x63,0x3a,0x54,0x2b,0x53,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x3d,0x56,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x56,0x2b,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x56,0x3d,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x3a,0x28,0x74,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x4e,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3d,0x4e,0x2b,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x3d,0x4f,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x4f,0x2b,0x43,0x2c,0x4e,0x3d,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x7d,0x69,0x66,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x7c,0x7c,0x7b,0x7d,0x2c,0x75,0x3d,0x69,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x28,0x73,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x2c,0x64,0x3d,0x75,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x63,0x3d,0x75,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x68,0x3d,0x75,0x2e,0x74,0x6f,0x70,0x2c,0x66,0x3d,0x75,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2c,0x67,0x3d,0x65,0x28,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2c,0x22,0x6c,0x65,0x66,0x74,0x22,0x29,0x2c,0x70,0x3d,0x65,0x28,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2c,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x29,0x2c,0x76,0x3d,0x65,0x28,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2c,0x22,0x74,0x6f,0x70,0x22,0x29,0x2c,0x6d,0x3d,0x65,0x28,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x29,0x2c,0x62,0x3d,0x65,0x28,0x74,0x2e,0x62,0x6f,0x78,0x65,0x73,0x2c,0x22,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x22,0x29,0x3b,0x6e,0x28,0x67,0x2c,0x21,0x30,0x29,0x2c,0x6e,0x28,0x70,0x2c,0x21,0x31,0x29,0x2c,0x6e,0x28,0x76,0x2c,0x21,0x30,0x29,0x2c,0x6e,0x28,0x6d,0x2c,0x21,0x31,0x29,0x3b,0x76,0x61,0x72,0x20,0x78,0x3d,0x61,0x2d,0x64,0x2d,0x63,0x2c,0x79,0x3d,0x6f,0x2d,0x68,0x2d,0x66,0x2c,0x6b,0x3d,0x79,0x2f,0x32,0x2c,0x77,0x3d,0x28,0x61,0x2d,0x78,0x2f,0x32,0x29,0x2f,0x28,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2b,0x70,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x2c,0x4d,0x3d,0x28,0x6f,0x2d,0x6b,0x29,0x2f,0x28,0x76,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2b,0x6d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x2c,0x53,0x3d,0x78,0x2c,0x43,0x3d,0x79,0x2c,0x5f,0x3d,0x5b,0x5d,0x3b,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x70,0x2c,0x76,0x2c,0x6d,0x29,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x3d,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3b,0x6e,0x3f,0x28,0x65,0x3d,0x74,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x74,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3f,0x78,0x3a,0x53,0x2c,0x4d,0x29,0x2c,0x43,0x2d,0x3d,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x3a,0x28,0x65,0x3d,0x74,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x77,0x2c,0x6b,0x29,0x2c,0x53,0x2d,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x29,0x2c,0x5f,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3a,0x6e,0x2c,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x3a,0x65,0x2c,0x62,0x6f,0x78,0x3a,0x74,0x7d,0x29,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x44,0x3d,0x30,0x2c,0x49,0x3d,0x30,0x2c,0x50,0x3d,0x30,0x2c,0x41,0x3d,0x30,0x3b,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x76,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x6d,0x29,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x2e,0x67,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x28,0x29,0x3b,0x44,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x44,0x2c,0x65,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2c,0x49,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x49,0x2c,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x7d,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x70,0x29,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x74,0x2e,0x67,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x28,0x29,0x3b,0x50,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x50,0x2c,0x65,0x2e,0x74,0x6f,0x70,0x29,0x2c,0x41,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x41,0x2c,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x7d,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x54,0x3d,0x64,0x2c,0x46,0x3d,0x63,0x2c,0x4f,0x3d,0x68,0x2c,0x52,0x3d,0x66,0x3b,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x70,0x29,0x2c,0x72,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x54,0x2b,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x70,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x46,0x2b,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x76,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x6d,0x29,0x2c,0x72,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x76,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x4f,0x2b,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x6d,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x52,0x2b,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x70,0x29,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x69,0x2e,0x66,0x69,0x6e,0x64,0x4e,0x65,0x78,0x74,0x57,0x68,0x65,0x72,0x65,0x28,0x5f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x62,0x6f,0x78,0x3d,0x3d,0x3d,0x74,0x7d,0x29,0x2c,0x6e,0x3d,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x30,0x2c,0x74,0x6f,0x70,0x3a,0x4f,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x52,0x7d,0x3b,0x65,0x26,0x26,0x74,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x43,0x2c,0x6e,0x29,0x7d,0x29,0x2c,0x54,0x3d,0x64,0x2c,0x46,0x3d,0x63,0x2c,0x4f,0x3d,0x68,0x2c,0x52,0x3d,0x66,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x54,0x2b,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x70,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x46,0x2b,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x76,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x4f,0x2b,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x6d,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x52,0x2b,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x4c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x44,0x2d,0x54,0x2c,0x30,0x29,0x3b,0x54,0x2b,0x3d,0x4c,0x2c,0x46,0x2b,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x49,0x2d,0x46,0x2c,0x30,0x29,0x3b,0x76,0x61,0x72,0x20,0x7a,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x50,0x2d,0x4f,0x2c,0x30,0x29,0x3b,0x4f,0x2b,0x3d,0x7a,0x2c,0x52,0x2b,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x41,0x2d,0x52,0x2c,0x30,0x29,0x3b,0x76,0x61,0x72,0x20,0x42,0x3d,0x6f,0x2d,0x4f,0x2d,0x52,0x2c,0x57,0x3d,0x61,0x2d,0x54,0x2d,0x46,0x3b,0x57,0x3d,0x3d,0x3d,0x53,0x26,0x26,0x42,0x3d,0x3d,0x3d,0x43,0x7c,0x7c,0x28,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x42,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x70,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x42,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x76,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x57,0x29,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x6d,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x57,0x29,0x7d,0x29,0x2c,0x43,0x3d,0x42,0x2c,0x53,0x3d,0x57,0x29,0x3b,0x76,0x61,0x72,0x20,0x4e,0x3d,0x64,0x2b,0x4c,0x2c,0x56,0x3d,0x68,0x2b,0x7a,0x3b,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x67,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x76,0x29,0x2c,0x6c,0x29,0x2c,0x4e,0x2b,0x3d,0x53,0x2c,0x56,0x2b,0x3d,0x43,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x70,0x2c,0x6c,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x6d,0x2c,0x6c,0x29,0x2c,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x3d,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x54,0x2c,0x74,0x6f,0x70,0x3a,0x4f,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x54,0x2b,0x53,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x4f,0x2b,0x43,0x7d,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x62,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x65,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x65,0x2e,0x74,0x6f,0x70,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2e,0x74,0x6f,0x70,0x2c,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2c,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x53,0x2c,0x43,0x29,0x7d,0x29,0x7d,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x31,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3a,0x7b,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3d,0x7b,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3a,0x5b,0x5d,0x2c,0x5f,0x63,0x61,0x63,0x68,0x65,0x49,0x64,0x3a,0x30,0x2c,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3b,0x5b,0x5d,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x74,0x29,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x2d,0x31,0x3d,0x3d,0x3d,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x29,0x26,0x26,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x7d,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x61,0x63,0x68,0x65,0x49,0x64,0x2b,0x2b,0x7d,0x2c,0x75,0x6e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3b,0x5b,0x5d,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x74,0x29,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x29,0x3b,0x2d,0x31,0x21,0x3d,0x3d,0x6e,0x26,0x26,0x65,0x2e,0x73,0x70,0x6c,0x69,0x63,0x65,0x28,0x6e,0x2c,0x31,0x29,0x7d,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x61,0x63,0x68,0x65,0x49,0x64,0x2b,0x2b,0x7d,0x2c,0x63,0x6c,0x65,0x61,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3d,0x5b,0x5d,0x2c,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x61,0x63,0x68,0x65,0x49,0x64,0x2b,0x2b,0x7d,0x2c,0x63,0x6f,0x75,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7d,0x2c,0x67,0x65,0x74,0x41,0x6c,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x7d,0x2c,0x6e,0x6f,0x74,0x69,0x66,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x3d,0x74,0x68,0x69,0x73,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x6f,0x72,0x73,0x28,0x74,0x29,0x2c,0x75,0x3d,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x66,0x6f,0x72,0x28,0x69,0x3d,0x30,0x3b,0x69,0x3c,0x75,0x3b,0x2b,0x2b,0x69,0x29,0x69,0x66,0x28,0x61,0x3d,0x73,0x5b,0x69,0x5d,0x2c,0x6f,0x3d,0x61,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x2c,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x28,0x6c,0x3d,0x6f,0x5b,0x65,0x5d,0x29,0x26,0x26,0x28,0x28,0x72,0x3d,0x5b,0x74,0x5d,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x6e,0x7c,0x7c,0x5b,0x5d,0x29,0x29,0x2e,0x70,0x75,0x73,0x68,0x28,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0x2c,0x21,0x31,0x3d,0x3d,0x3d,0x6c,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x6f,0x2c,0x72,0x29,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x30,0x7d,0x2c,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x6f,0x72,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x7c,0x7c,0x28,0x74,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3d,0x7b,0x7d,0x29,0x3b,0x69,0x66,0x28,0x65,0x2e,0x69,0x64,0x3d,0x3d,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x61,0x63,0x68,0x65,0x49,0x64,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x6f,0x72,0x73,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x5b,0x5d,0x2c,0x61,0x3d,0x5b,0x5d,0x2c,0x72,0x3d,0x74,0x26,0x26,0x74,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x7c,0x7c,0x7b,0x7d,0x2c,0x6c,0x3d,0x72,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x26,0x26,0x72,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x7c,0x7c,0x7b,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x5f,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x72,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x2d,0x31,0x3d,0x3d,0x3d,0x6e,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x69,0x64,0x2c,0x72,0x3d,0x6c,0x5b,0x65,0x5d,0x3b,0x21,0x31,0x21,0x3d,0x3d,0x72,0x26,0x26,0x28,0x21,0x30,0x3d,0x3d,0x3d,0x72,0x26,0x26,0x28,0x72,0x3d,0x6f,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x5b,0x65,0x5d,0x29,0x29,0x2c,0x6e,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x29,0x2c,0x61,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x70,0x6c,0x75,0x67,0x69,0x6e,0x3a,0x74,0x2c,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x72,0x7c,0x7c,0x7b,0x7d,0x7d,0x29,0x29,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x6f,0x72,0x73,0x3d,0x61,0x2c,0x65,0x2e,0x69,0x64,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x61,0x63,0x68,0x65,0x49,0x64,0x2c,0x61,0x7d,0x7d,0x2c,0x74,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x3d,0x74,0x2e,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x2c,0x74,0x2e,0x50,0x6c,0x75,0x67,0x69,0x6e,0x42,0x61,0x73,0x65,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x32,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x5b,0x65,0x5d,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x65,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x26,0x26,0x28,0x69,0x2d,0x3d,0x30,0x3d,0x3d,0x3d,0x65,0x3f,0x28,0x74,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x31,0x29,0x2d,0x69,0x29,0x2f,0x32,0x3a,0x28,0x69,0x2d,0x74,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x65,0x2d,0x31,0x29,0x29,0x2f,0x32,0x29,0x2c,0x69,0x7d,0x76,0x61,0x72,0x20,0x6f,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x72,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6c,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x73,0x3d,0x74,0x28,0x33,0x34,0x29,0x3b,0x6f,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x73,0x63,0x61,0x6c,0x65,0x22,0x2c,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x6f,0x66,0x66,0x73,0x65,0x74,0x3a,0x21,0x31,0x2c,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2e,0x31,0x29,0x22,0x2c,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3a,0x31,0x2c,0x64,0x72,0x61,0x77,0x42,0x6f,0x72,0x64,0x65,0x72,0x3a,0x21,0x30,0x2c,0x64,0x72,0x61,0x77,0x4f,0x6e,0x43,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x3a,0x21,0x30,0x2c,0x64,0x72,0x61,0x77,0x54,0x69,0x63,0x6b,0x73,0x3a,0x21,0x30,0x2c,0x74,0x69,0x63,0x6b,0x4d,0x61,0x72,0x6b,0x4c,0x65,0x6e,0x67,0x74,0x68,0x3a,0x31,0x30,0x2c,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3a,0x31,0x2c,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x2e,0x32,0x35,0x29,0x22,0x2c,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x5b,0x5d,0x2c,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x30,0x2c,0x6f,0x66,0x66,0x73,0x65,0x74,0x47,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x21,0x31,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x5b,0x5d,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x30,0x7d,0x2c,0x73,0x63,0x61,0x6c,0x65,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x31,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x53,0x74,0x72,0x69,0x6e,0x67,0x3a,0x22,0x22,0x2c,0x6c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x3a,0x31,0x2e,0x32,0x2c,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x7b,0x74,0x6f,0x70,0x3a,0x34,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x34,0x7d,0x7d,0x2c,0x74,0x69,0x63,0x6b,0x73,0x3a,0x7b,0x62,0x65,0x67,0x69,0x6e,0x41,0x74,0x5a,0x65,0x72,0x6f,0x3a,0x21,0x31,0x2c,0x6d,0x69,0x6e,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x30,0x2c,0x6d,0x61,0x78,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x35,0x30,0x2c,0x6d,0x69,0x72,0x72,0x6f,0x72,0x3a,0x21,0x31,0x2c,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x30,0x2c,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3a,0x21,0x31,0x2c,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x3a,0x21,0x30,0x2c,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x30,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x30,0x2c,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x73,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x74,0x65,0x72,0x73,0x2e,0x76,0x61,0x6c,0x75,0x65,0x73,0x2c,0x6d,0x69,0x6e,0x6f,0x72,0x3a,0x7b,0x7d,0x2c,0x6d,0x61,0x6a,0x6f,0x72,0x3a,0x7b,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x3f,0x6c,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x28,0x74,0x2c,0x6e,0x2c,0x65,0x29,0x3a,0x74,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x65,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x6e,0x3d,0x6f,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x69,0x3d,0x65,0x28,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x6e,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x61,0x3d,0x65,0x28,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x6e,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x72,0x3d,0x65,0x28,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x6e,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x73,0x69,0x7a,0x65,0x3a,0x69,0x2c,0x73,0x74,0x79,0x6c,0x65,0x3a,0x61,0x2c,0x66,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x72,0x2c,0x66,0x6f,0x6e,0x74,0x3a,0x6c,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x69,0x2c,0x61,0x2c,0x72,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x4c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x28,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x31,0x2e,0x32,0x29,0x2c,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x6f,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x29,0x7d,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x3d,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x67,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x7c,0x7c,0x30,0x2c,0x74,0x6f,0x70,0x3a,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x7c,0x7c,0x30,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x7c,0x7c,0x30,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x7c,0x7c,0x30,0x7d,0x7d,0x2c,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x7d,0x2c,0x6d,0x65,0x72,0x67,0x65,0x54,0x69,0x63,0x6b,0x73,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3b,0x21,0x31,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x26,0x26,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x3d,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x31,0x7d,0x29,0x2c,0x21,0x31,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x26,0x26,0x28,0x74,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x3d,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x31,0x7d,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x20,0x69,0x6e,0x20,0x74,0x29,0x22,0x6d,0x61,0x6a,0x6f,0x72,0x22,0x21,0x3d,0x3d,0x65,0x26,0x26,0x22,0x6d,0x69,0x6e,0x6f,0x72,0x22,0x21,0x3d,0x3d,0x65,0x26,0x26,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x5b,0x65,0x5d,0x26,0x26,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x5b,0x65,0x5d,0x3d,0x74,0x5b,0x65,0x5d,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x5b,0x65,0x5d,0x26,0x26,0x28,0x74,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x5b,0x65,0x5d,0x3d,0x74,0x5b,0x65,0x5d,0x29,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x3d,0x74,0x68,0x69,0x73,0x3b,0x66,0x6f,0x72,0x28,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x64,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x3d,0x74,0x2c,0x64,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x3d,0x65,0x2c,0x64,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x3d,0x6c,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x30,0x2c,0x74,0x6f,0x70,0x3a,0x30,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x30,0x7d,0x2c,0x6e,0x29,0x2c,0x64,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x43,0x61,0x63,0x68,0x65,0x3d,0x64,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x43,0x61,0x63,0x68,0x65,0x7c,0x7c,0x7b,0x7d,0x2c,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x64,0x2e,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x28,0x29,0x2c,0x64,0x2e,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x28,0x29,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x28,0x29,0x2c,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x28,0x29,0x2c,0x73,0x3d,0x64,0x2e,0x62,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x28,0x29,0x7c,0x7c,0x5b,0x5d,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x28,0x29,0x2c,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x54,0x69,0x63,0x6b,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6e,0x76,0x65,0x72,0x73,0x69,0x6f,0x6e,0x28,0x29,0x2c,0x6f,0x3d,0x64,0x2e,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x73,0x29,0x7c,0x7c,0x64,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x54,0x69,0x63,0x6b,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6e,0x76,0x65,0x72,0x73,0x69,0x6f,0x6e,0x28,0x29,0x2c,0x64,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3d,0x6f,0x2c,0x69,0x3d,0x30,0x2c,0x61,0x3d,0x6f,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x3c,0x61,0x3b,0x2b,0x2b,0x69,0x29,0x72,0x3d,0x6f,0x5b,0x69,0x5d,0x2c,0x28,0x75,0x3d,0x73,0x5b,0x69,0x5d,0x29,0x3f,0x75,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x3d,0x72,0x3a,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x75,0x3d,0x7b,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x72,0x2c,0x6d,0x61,0x6a,0x6f,0x72,0x3a,0x21,0x31,0x7d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x64,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x3d,0x73,0x2c,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x43,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x28,0x29,0x2c,0x64,0x2e,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x28,0x29,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x43,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x28,0x29,0x2c,0x64,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x28,0x29,0x2c,0x64,0x2e,0x66,0x69,0x74,0x28,0x29,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x28,0x29,0x2c,0x64,0x2e,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x64,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x29,0x3a,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x3d,0x30,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x30,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x6c,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x6c,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x54,0x69,0x63,0x6b,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6e,0x76,0x65,0x72,0x73,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x54,0x69,0x63,0x6b,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6e,0x76,0x65,0x72,0x73,0x69,0x6f,0x6e,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3b,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3d,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x61,0x70,0x28,0x65,0x2e,0x75,0x73,0x65,0x72,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x7c,0x7c,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x2c,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x54,0x69,0x63,0x6b,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6e,0x76,0x65,0x72,0x73,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x54,0x69,0x63,0x6b,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6e,0x76,0x65,0x72,0x73,0x69,0x6f,0x6e,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x43,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x43,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x63,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x6f,0x3d,0x69,0x28,0x74,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x29,0x2c,0x72,0x3d,0x6e,0x28,0x61,0x29,0x3b,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x72,0x2e,0x66,0x6f,0x6e,0x74,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x61,0x2e,0x6d,0x69,0x6e,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x7c,0x7c,0x30,0x3b,0x69,0x66,0x28,0x6f,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x26,0x26,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x75,0x2c,0x64,0x3d,0x6c,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x28,0x65,0x2c,0x72,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x6f,0x2c,0x74,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x43,0x61,0x63,0x68,0x65,0x29,0x2c,0x63,0x3d,0x64,0x2c,0x68,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x31,0x29,0x2d,0x74,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x30,0x29,0x2d,0x36,0x3b,0x63,0x3e,0x68,0x26,0x26,0x73,0x3c,0x61,0x2e,0x6d,0x61,0x78,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3b,0x29,0x7b,0x76,0x61,0x72,0x20,0x66,0x3d,0x6c,0x2e,0x74,0x6f,0x52,0x61,0x64,0x69,0x61,0x6e,0x73,0x28,0x73,0x29,0x3b,0x69,0x66,0x28,0x75,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x66,0x29,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x66,0x29,0x2a,0x64,0x3e,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x29,0x7b,0x73,0x2d,0x2d,0x3b,0x62,0x72,0x65,0x61,0x6b,0x7d,0x73,0x2b,0x2b,0x2c,0x63,0x3d,0x75,0x2a,0x64,0x7d,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3d,0x73,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x43,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x43,0x61,0x6c,0x63,0x75,0x6c,0x61,0x74,0x65,0x54,0x69,0x63,0x6b,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x66,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x30,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x30,0x7d,0x2c,0x6f,0x3d,0x69,0x28,0x74,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x29,0x2c,0x72,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x75,0x3d,0x72,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x64,0x3d,0x72,0x2e,0x73,0x63,0x61,0x6c,0x65,0x4c,0x61,0x62,0x65,0x6c,0x2c,0x63,0x3d,0x72,0x2e,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x2c,0x68,0x3d,0x72,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x2c,0x66,0x3d,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x67,0x3d,0x6e,0x28,0x75,0x29,0x2c,0x70,0x3d,0x72,0x2e,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x2e,0x74,0x69,0x63,0x6b,0x4d,0x61,0x72,0x6b,0x4c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x66,0x28,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x66,0x3f,0x74,0x2e,0x69,0x73,0x46,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x28,0x29,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2d,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2d,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x72,0x69,0x67,0x68,0x74,0x3a,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x3a,0x68,0x26,0x26,0x63,0x2e,0x64,0x72,0x61,0x77,0x54,0x69,0x63,0x6b,0x73,0x3f,0x70,0x3a,0x30,0x2c,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x66,0x3f,0x68,0x26,0x26,0x63,0x2e,0x64,0x72,0x61,0x77,0x54,0x69,0x63,0x6b,0x73,0x3f,0x70,0x3a,0x30,0x3a,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x64,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x26,0x26,0x68,0x29,0x7b,0x76,0x61,0x72,0x20,0x76,0x3d,0x73,0x28,0x64,0x29,0x2b,0x6c,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x28,0x64,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3b,0x66,0x3f,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2b,0x3d,0x76,0x3a,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x2b,0x3d,0x76,0x7d,0x69,0x66,0x28,0x75,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x26,0x26,0x68,0x29,0x7b,0x76,0x61,0x72,0x20,0x6d,0x3d,0x6c,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x28,0x74,0x2e,0x63,0x74,0x78,0x2c,0x67,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x6f,0x2c,0x74,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x43,0x61,0x63,0x68,0x65,0x29,0x2c,0x62,0x3d,0x6c,0x2e,0x6e,0x75,0x6d,0x62,0x65,0x72,0x4f,0x66,0x4c,0x61,0x62,0x65,0x6c,0x4c,0x69,0x6e,0x65,0x73,0x28,0x6f,0x29,0x2c,0x78,0x3d,0x2e,0x35,0x2a,0x67,0x2e,0x73,0x69,0x7a,0x65,0x2c,0x79,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3b,0x69,0x66,0x28,0x66,0x29,0x7b,0x74,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x4c,0x61,0x62,0x65,0x6c,0x57,0x69,0x64,0x74,0x68,0x3d,0x6d,0x3b,0x76,0x61,0x72,0x20,0x6b,0x3d,0x6c,0x2e,0x74,0x6f,0x52,0x61,0x64,0x69,0x61,0x6e,0x73,0x28,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x29,0x2c,0x77,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x6b,0x29,0x2c,0x4d,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x6b,0x29,0x2a,0x6d,0x2b,0x67,0x2e,0x73,0x69,0x7a,0x65,0x2a,0x62,0x2b,0x78,0x2a,0x28,0x62,0x2d,0x31,0x29,0x2b,0x78,0x3b,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2b,0x4d,0x2b,0x79,0x29,0x2c,0x74,0x2e,0x63,0x74,0x78,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x67,0x2e,0x66,0x6f,0x6e,0x74,0x3b,0x76,0x61,0x72,0x20,0x53,0x3d,0x65,0x28,0x74,0x2e,0x63,0x74,0x78,0x2c,0x6f,0x5b,0x30,0x5d,0x2c,0x67,0x2e,0x66,0x6f,0x6e,0x74,0x29,0x2c,0x43,0x3d,0x65,0x28,0x74,0x2e,0x63,0x74,0x78,0x2c,0x6f,0x5b,0x6f,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x2c,0x67,0x2e,0x66,0x6f,0x6e,0x74,0x29,0x3b,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3f,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x72,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x77,0x2a,0x53,0x2b,0x33,0x3a,0x77,0x2a,0x78,0x2b,0x33,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x72,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x77,0x2a,0x78,0x2b,0x33,0x3a,0x77,0x2a,0x43,0x2b,0x33,0x29,0x3a,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3d,0x53,0x2f,0x32,0x2b,0x33,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x3d,0x43,0x2f,0x32,0x2b,0x33,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x75,0x2e,0x6d,0x69,0x72,0x72,0x6f,0x72,0x3f,0x6d,0x3d,0x30,0x3a,0x6d,0x2b,0x3d,0x79,0x2b,0x78,0x2c,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x2b,0x6d,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x3d,0x67,0x2e,0x73,0x69,0x7a,0x65,0x2f,0x32,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x67,0x2e,0x73,0x69,0x7a,0x65,0x2f,0x32,0x7d,0x74,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x73,0x28,0x29,0x2c,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x26,0x26,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x2d,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x30,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x2d,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x74,0x6f,0x70,0x2c,0x30,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x2d,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x30,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x74,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2c,0x30,0x29,0x29,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x2c,0x5b,0x74,0x68,0x69,0x73,0x5d,0x29,0x7d,0x2c,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x7c,0x7c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x7d,0x2c,0x69,0x73,0x46,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x7d,0x2c,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x6c,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x74,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4e,0x61,0x4e,0x3b,0x69,0x66,0x28,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x26,0x26,0x21,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x74,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4e,0x61,0x4e,0x3b,0x69,0x66,0x28,0x74,0x29,0x69,0x66,0x28,0x74,0x68,0x69,0x73,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x7b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x78,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x2e,0x78,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x79,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x2e,0x79,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x3a,0x6c,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x6c,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x46,0x6f,0x72,0x50,0x69,0x78,0x65,0x6c,0x3a,0x6c,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x3b,0x69,0x66,0x28,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x28,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2d,0x28,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x2b,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x29,0x29,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x28,0x6e,0x3f,0x30,0x3a,0x31,0x29,0x2c,0x31,0x29,0x2c,0x61,0x3d,0x69,0x2a,0x74,0x2b,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3b,0x6e,0x26,0x26,0x28,0x61,0x2b,0x3d,0x69,0x2f,0x32,0x29,0x3b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x61,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2b,0x3d,0x65,0x2e,0x69,0x73,0x46,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x28,0x29,0x3f,0x65,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x30,0x7d,0x76,0x61,0x72,0x20,0x72,0x3d,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2d,0x28,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x2b,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x74,0x6f,0x70,0x2b,0x74,0x2a,0x28,0x72,0x2f,0x28,0x65,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x44,0x65,0x63,0x69,0x6d,0x61,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x66,0x28,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x28,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2d,0x28,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x2b,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x29,0x29,0x2a,0x74,0x2b,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x2c,0x69,0x3d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2b,0x3d,0x65,0x2e,0x69,0x73,0x46,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x28,0x29,0x3f,0x65,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x30,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x74,0x6f,0x70,0x2b,0x74,0x2a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x2c,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x56,0x61,0x6c,0x75,0x65,0x28,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x6e,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x41,0x74,0x5a,0x65,0x72,0x6f,0x3f,0x30,0x3a,0x65,0x3c,0x30,0x26,0x26,0x6e,0x3c,0x30,0x3f,0x6e,0x3a,0x65,0x3e,0x30,0x26,0x26,0x6e,0x3e,0x30,0x3f,0x65,0x3a,0x30,0x7d,0x2c,0x5f,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x3d,0x74,0x68,0x69,0x73,0x2c,0x72,0x3d,0x6f,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x73,0x3d,0x6f,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x2c,0x75,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x64,0x3d,0x6c,0x2e,0x74,0x6f,0x52,0x61,0x64,0x69,0x61,0x6e,0x73,0x28,0x6f,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x29,0x2c,0x63,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x64,0x29,0x2c,0x68,0x3d,0x6f,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x4c,0x61,0x62,0x65,0x6c,0x57,0x69,0x64,0x74,0x68,0x2a,0x63,0x2c,0x66,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x73,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x26,0x26,0x28,0x61,0x3d,0x73,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x29,0x2c,0x72,0x26,0x26,0x28,0x65,0x3d,0x21,0x31,0x2c,0x28,0x68,0x2b,0x73,0x2e,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x2a,0x75,0x3e,0x6f,0x2e,0x77,0x69,0x64,0x74,0x68,0x2d,0x28,0x6f,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x2b,0x6f,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x29,0x26,0x26,0x28,0x65,0x3d,0x31,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x28,0x68,0x2b,0x73,0x2e,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x2a,0x75,0x2f,0x28,0x6f,0x2e,0x77,0x69,0x64,0x74,0x68,0x2d,0x28,0x6f,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x2b,0x6f,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x29,0x29,0x29,0x29,0x2c,0x61,0x26,0x26,0x75,0x3e,0x61,0x26,0x26,0x28,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x75,0x2f,0x61,0x29,0x29,0x29,0x29,0x2c,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x75,0x3b,0x6e,0x2b,0x2b,0x29,0x69,0x3d,0x74,0x5b,0x6e,0x5d,0x2c,0x28,0x65,0x3e,0x31,0x26,0x26,0x6e,0x25,0x65,0x3e,0x30,0x7c,0x7c,0x6e,0x25,0x65,0x3d,0x3d,0x30,0x26,0x26,0x6e,0x2b,0x65,0x3e,0x3d,0x75,0x29,0x26,0x26,0x6e,0x21,0x3d,0x3d,0x75,0x2d,0x31,0x26,0x26,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x69,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x2c,0x66,0x2e,0x70,0x75,0x73,0x68,0x28,0x69,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x69,0x66,0x28,0x69,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x65,0x2e,0x63,0x74,0x78,0x2c,0x75,0x3d,0x6f,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x64,0x3d,0x69,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x2c,0x63,0x3d,0x69,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x7c,0x7c,0x64,0x2c,0x68,0x3d,0x69,0x2e,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x2c,0x66,0x3d,0x69,0x2e,0x73,0x63,0x61,0x6c,0x65,0x4c,0x61,0x62,0x65,0x6c,0x2c,0x67,0x3d,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x2c,0x70,0x3d,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x76,0x3d,0x64,0x2e,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x3f,0x65,0x2e,0x5f,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x28,0x65,0x2e,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x73,0x28,0x29,0x29,0x3a,0x65,0x2e,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x73,0x28,0x29,0x2c,0x6d,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x64,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x75,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x62,0x3d,0x6e,0x28,0x64,0x29,0x2c,0x78,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x63,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x75,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x79,0x3d,0x6e,0x28,0x63,0x29,0x2c,0x6b,0x3d,0x68,0x2e,0x64,0x72,0x61,0x77,0x54,0x69,0x63,0x6b,0x73,0x3f,0x68,0x2e,0x74,0x69,0x63,0x6b,0x4d,0x61,0x72,0x6b,0x4c,0x65,0x6e,0x67,0x74,0x68,0x3a,0x30,0x2c,0x77,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x66,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x75,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x4d,0x3d,0x6e,0x28,0x66,0x29,0x2c,0x53,0x3d,0x6c,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x28,0x66,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x29,0x2c,0x43,0x3d,0x6c,0x2e,0x74,0x6f,0x52,0x61,0x64,0x69,0x61,0x6e,0x73,0x28,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x29,0x2c,0x5f,0x3d,0x5b,0x5d,0x2c,0x44,0x3d,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x6b,0x2c,0x49,0x3d,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x6b,0x3a,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x50,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x74,0x6f,0x70,0x3a,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x6b,0x2c,0x41,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x74,0x6f,0x70,0x2b,0x6b,0x3a,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3b,0x69,0x66,0x28,0x6c,0x2e,0x65,0x61,0x63,0x68,0x28,0x76,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x6f,0x29,0x7b,0x69,0x66,0x28,0x21,0x6c,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x2c,0x73,0x2c,0x63,0x2c,0x66,0x2c,0x6d,0x3d,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x3b,0x6f,0x3d,0x3d,0x3d,0x65,0x2e,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x49,0x6e,0x64,0x65,0x78,0x26,0x26,0x69,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x3d,0x3d,0x3d,0x68,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x47,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3f,0x28,0x72,0x3d,0x68,0x2e,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x73,0x3d,0x68,0x2e,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x63,0x3d,0x68,0x2e,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x2c,0x66,0x3d,0x68,0x2e,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x29,0x3a,0x28,0x72,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x68,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x6f,0x29,0x2c,0x73,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x68,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x29,0x2c,0x63,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x68,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x2c,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x29,0x2c,0x66,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x68,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x29,0x29,0x3b,0x76,0x61,0x72,0x20,0x62,0x2c,0x78,0x2c,0x79,0x2c,0x77,0x2c,0x4d,0x2c,0x53,0x2c,0x54,0x2c,0x46,0x2c,0x4f,0x2c,0x52,0x2c,0x4c,0x3d,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x2c,0x7a,0x3d,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x2c,0x42,0x3d,0x64,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3b,0x69,0x66,0x28,0x70,0x29,0x7b,0x76,0x61,0x72,0x20,0x57,0x3d,0x6b,0x2b,0x42,0x3b,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x28,0x7a,0x3d,0x67,0x3f,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x3a,0x22,0x74,0x6f,0x70,0x22,0x2c,0x4c,0x3d,0x67,0x3f,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3a,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x52,0x3d,0x65,0x2e,0x74,0x6f,0x70,0x2b,0x57,0x29,0x3a,0x28,0x7a,0x3d,0x67,0x3f,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x2c,0x4c,0x3d,0x67,0x3f,0x22,0x6c,0x65,0x66,0x74,0x22,0x3a,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x52,0x3d,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x57,0x29,0x3b,0x76,0x61,0x72,0x20,0x4e,0x3d,0x61,0x28,0x65,0x2c,0x6f,0x2c,0x68,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x47,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x26,0x26,0x76,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x31,0x29,0x3b,0x4e,0x3c,0x65,0x2e,0x6c,0x65,0x66,0x74,0x26,0x26,0x28,0x73,0x3d,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x29,0x22,0x29,0x2c,0x4e,0x2b,0x3d,0x6c,0x2e,0x61,0x6c,0x69,0x61,0x73,0x50,0x69,0x78,0x65,0x6c,0x28,0x72,0x29,0x2c,0x4f,0x3d,0x65,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x6f,0x29,0x2b,0x64,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x62,0x3d,0x79,0x3d,0x4d,0x3d,0x54,0x3d,0x4e,0x2c,0x78,0x3d,0x50,0x2c,0x77,0x3d,0x41,0x2c,0x53,0x3d,0x74,0x2e,0x74,0x6f,0x70,0x2c,0x46,0x3d,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x7d,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x56,0x2c,0x45,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3b,0x64,0x2e,0x6d,0x69,0x72,0x72,0x6f,0x72,0x3f,0x28,0x4c,0x3d,0x45,0x3f,0x22,0x6c,0x65,0x66,0x74,0x22,0x3a,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x2c,0x56,0x3d,0x42,0x29,0x3a,0x28,0x4c,0x3d,0x45,0x3f,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x56,0x3d,0x6b,0x2b,0x42,0x29,0x2c,0x4f,0x3d,0x45,0x3f,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x56,0x3a,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x56,0x3b,0x76,0x61,0x72,0x20,0x48,0x3d,0x61,0x28,0x65,0x2c,0x6f,0x2c,0x68,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x47,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x26,0x26,0x76,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x31,0x29,0x3b,0x48,0x3c,0x65,0x2e,0x74,0x6f,0x70,0x26,0x26,0x28,0x73,0x3d,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x29,0x22,0x29,0x2c,0x48,0x2b,0x3d,0x6c,0x2e,0x61,0x6c,0x69,0x61,0x73,0x50,0x69,0x78,0x65,0x6c,0x28,0x72,0x29,0x2c,0x52,0x3d,0x65,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x28,0x6f,0x29,0x2b,0x64,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x62,0x3d,0x44,0x2c,0x79,0x3d,0x49,0x2c,0x4d,0x3d,0x74,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x54,0x3d,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x78,0x3d,0x77,0x3d,0x53,0x3d,0x46,0x3d,0x48,0x7d,0x5f,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x74,0x78,0x31,0x3a,0x62,0x2c,0x74,0x79,0x31,0x3a,0x78,0x2c,0x74,0x78,0x32,0x3a,0x79,0x2c,0x74,0x79,0x32,0x3a,0x77,0x2c,0x78,0x31,0x3a,0x4d,0x2c,0x79,0x31,0x3a,0x53,0x2c,0x78,0x32,0x3a,0x54,0x2c,0x79,0x32,0x3a,0x46,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x58,0x3a,0x4f,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x59,0x3a,0x52,0x2c,0x67,0x6c,0x57,0x69,0x64,0x74,0x68,0x3a,0x72,0x2c,0x67,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x73,0x2c,0x67,0x6c,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x63,0x2c,0x67,0x6c,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x66,0x2c,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x2d,0x31,0x2a,0x43,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x6d,0x2c,0x6d,0x61,0x6a,0x6f,0x72,0x3a,0x6e,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x2c,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3a,0x7a,0x2c,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x4c,0x7d,0x29,0x7d,0x7d,0x29,0x2c,0x6c,0x2e,0x65,0x61,0x63,0x68,0x28,0x5f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x68,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x26,0x26,0x28,0x72,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x67,0x6c,0x57,0x69,0x64,0x74,0x68,0x2c,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x74,0x2e,0x67,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x72,0x2e,0x73,0x65,0x74,0x4c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x26,0x26,0x28,0x72,0x2e,0x73,0x65,0x74,0x4c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x28,0x74,0x2e,0x67,0x6c,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3d,0x74,0x2e,0x67,0x6c,0x42,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x29,0x2c,0x72,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x68,0x2e,0x64,0x72,0x61,0x77,0x54,0x69,0x63,0x6b,0x73,0x26,0x26,0x28,0x72,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x74,0x2e,0x74,0x78,0x31,0x2c,0x74,0x2e,0x74,0x79,0x31,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x74,0x2e,0x74,0x78,0x32,0x2c,0x74,0x2e,0x74,0x79,0x32,0x29,0x29,0x2c,0x68,0x2e,0x64,0x72,0x61,0x77,0x4f,0x6e,0x43,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x26,0x26,0x28,0x72,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x74,0x2e,0x78,0x31,0x2c,0x74,0x2e,0x79,0x31,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x74,0x2e,0x78,0x32,0x2c,0x74,0x2e,0x79,0x32,0x29,0x29,0x2c,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x2c,0x72,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x29,0x2c,0x64,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x72,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x72,0x2e,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x28,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x58,0x2c,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x59,0x29,0x2c,0x72,0x2e,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x74,0x2e,0x72,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x29,0x2c,0x72,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x3f,0x79,0x2e,0x66,0x6f,0x6e,0x74,0x3a,0x62,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x74,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x3f,0x78,0x3a,0x6d,0x2c,0x72,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x74,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x2c,0x72,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x74,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x3b,0x69,0x66,0x28,0x6c,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x30,0x3b,0x6e,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x6e,0x29,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x22,0x22,0x2b,0x65,0x5b,0x6e,0x5d,0x2c,0x30,0x2c,0x69,0x29,0x2c,0x69,0x2b,0x3d,0x31,0x2e,0x35,0x2a,0x62,0x2e,0x73,0x69,0x7a,0x65,0x3b,0x65,0x6c,0x73,0x65,0x20,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x65,0x2c,0x30,0x2c,0x30,0x29,0x3b,0x72,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x7d,0x29,0x2c,0x66,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x54,0x2c,0x46,0x2c,0x4f,0x3d,0x30,0x2c,0x52,0x3d,0x73,0x28,0x66,0x29,0x2f,0x32,0x3b,0x69,0x66,0x28,0x70,0x29,0x54,0x3d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x28,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2f,0x32,0x2c,0x46,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x52,0x2d,0x53,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x65,0x2e,0x74,0x6f,0x70,0x2b,0x52,0x2b,0x53,0x2e,0x74,0x6f,0x70,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x4c,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3b,0x54,0x3d,0x4c,0x3f,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x52,0x2b,0x53,0x2e,0x74,0x6f,0x70,0x3a,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x52,0x2d,0x53,0x2e,0x74,0x6f,0x70,0x2c,0x46,0x3d,0x65,0x2e,0x74,0x6f,0x70,0x2b,0x28,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x65,0x2e,0x74,0x6f,0x70,0x29,0x2f,0x32,0x2c,0x4f,0x3d,0x4c,0x3f,0x2d,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3a,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x7d,0x72,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x72,0x2e,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x28,0x54,0x2c,0x46,0x29,0x2c,0x72,0x2e,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x4f,0x29,0x2c,0x72,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x72,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x2c,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x77,0x2c,0x72,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x4d,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x66,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x53,0x74,0x72,0x69,0x6e,0x67,0x2c,0x30,0x2c,0x30,0x29,0x2c,0x72,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x69,0x66,0x28,0x68,0x2e,0x64,0x72,0x61,0x77,0x42,0x6f,0x72,0x64,0x65,0x72,0x29,0x7b,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x68,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x30,0x29,0x2c,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x6c,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x68,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2c,0x30,0x29,0x3b,0x76,0x61,0x72,0x20,0x7a,0x3d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x42,0x3d,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x57,0x3d,0x65,0x2e,0x74,0x6f,0x70,0x2c,0x4e,0x3d,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2c,0x56,0x3d,0x6c,0x2e,0x61,0x6c,0x69,0x61,0x73,0x50,0x69,0x78,0x65,0x6c,0x28,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x29,0x3b,0x70,0x3f,0x28,0x57,0x3d,0x4e,0x3d,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x65,0x2e,0x74,0x6f,0x70,0x2c,0x57,0x2b,0x3d,0x56,0x2c,0x4e,0x2b,0x3d,0x56,0x29,0x3a,0x28,0x7a,0x3d,0x42,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x69,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x3a,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x7a,0x2b,0x3d,0x56,0x2c,0x42,0x2b,0x3d,0x56,0x29,0x2c,0x72,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x72,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x7a,0x2c,0x57,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x42,0x2c,0x4e,0x29,0x2c,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x7d,0x7d,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x33,0x34,0x3a,0x33,0x34,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x33,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x3d,0x7b,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x73,0x3a,0x7b,0x7d,0x2c,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x3a,0x7b,0x7d,0x2c,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x54,0x79,0x70,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x73,0x5b,0x74,0x5d,0x3d,0x65,0x2c,0x74,0x68,0x69,0x73,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x5b,0x74,0x5d,0x3d,0x61,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x6e,0x29,0x7d,0x2c,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x43,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x73,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x29,0x3f,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x73,0x5b,0x74,0x5d,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x7d,0x2c,0x67,0x65,0x74,0x53,0x63,0x61,0x6c,0x65,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x29,0x3f,0x61,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x7b,0x7d,0x2c,0x5b,0x69,0x2e,0x73,0x63,0x61,0x6c,0x65,0x2c,0x74,0x68,0x69,0x73,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x5b,0x74,0x5d,0x5d,0x29,0x3a,0x7b,0x7d,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x53,0x63,0x61,0x6c,0x65,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x3b,0x6e,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x29,0x26,0x26,0x28,0x6e,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x5b,0x74,0x5d,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x6e,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x73,0x5b,0x74,0x5d,0x2c,0x65,0x29,0x29,0x7d,0x2c,0x61,0x64,0x64,0x53,0x63,0x61,0x6c,0x65,0x73,0x54,0x6f,0x4c,0x61,0x79,0x6f,0x75,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x73,0x63,0x61,0x6c,0x65,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x29,0x7b,0x6e,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x2c,0x6e,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x2c,0x6e,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x77,0x65,0x69,0x67,0x68,0x74,0x2c,0x74,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x61,0x64,0x64,0x42,0x6f,0x78,0x28,0x65,0x2c,0x6e,0x29,0x7d,0x29,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x34,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x6f,0x72,0x73,0x3a,0x7b,0x6c,0x69,0x6e,0x65,0x61,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x61,0x3d,0x5b,0x5d,0x3b,0x69,0x66,0x28,0x74,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x26,0x26,0x74,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x3e,0x30,0x29,0x6e,0x3d,0x74,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x69,0x2e,0x6e,0x69,0x63,0x65,0x4e,0x75,0x6d,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2d,0x65,0x2e,0x6d,0x69,0x6e,0x2c,0x21,0x31,0x29,0x3b,0x6e,0x3d,0x69,0x2e,0x6e,0x69,0x63,0x65,0x4e,0x75,0x6d,0x28,0x6f,0x2f,0x28,0x74,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x2d,0x31,0x29,0x2c,0x21,0x30,0x29,0x7d,0x76,0x61,0x72,0x20,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x2f,0x6e,0x29,0x2a,0x6e,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2f,0x6e,0x29,0x2a,0x6e,0x3b,0x74,0x2e,0x6d,0x69,0x6e,0x26,0x26,0x74,0x2e,0x6d,0x61,0x78,0x26,0x26,0x74,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x26,0x26,0x69,0x2e,0x61,0x6c,0x6d,0x6f,0x73,0x74,0x57,0x68,0x6f,0x6c,0x65,0x28,0x28,0x74,0x2e,0x6d,0x61,0x78,0x2d,0x74,0x2e,0x6d,0x69,0x6e,0x29,0x2f,0x74,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x2c,0x6e,0x2f,0x31,0x65,0x33,0x29,0x26,0x26,0x28,0x72,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x6c,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x29,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x28,0x6c,0x2d,0x72,0x29,0x2f,0x6e,0x3b,0x73,0x3d,0x69,0x2e,0x61,0x6c,0x6d,0x6f,0x73,0x74,0x45,0x71,0x75,0x61,0x6c,0x73,0x28,0x73,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x73,0x29,0x2c,0x6e,0x2f,0x31,0x65,0x33,0x29,0x3f,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x73,0x29,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x73,0x29,0x2c,0x61,0x2e,0x70,0x75,0x73,0x68,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x3f,0x74,0x2e,0x6d,0x69,0x6e,0x3a,0x72,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x75,0x3d,0x31,0x3b,0x75,0x3c,0x73,0x3b,0x2b,0x2b,0x75,0x29,0x61,0x2e,0x70,0x75,0x73,0x68,0x28,0x72,0x2b,0x75,0x2a,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x70,0x75,0x73,0x68,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x3a,0x6c,0x29,0x2c,0x61,0x7d,0x2c,0x6c,0x6f,0x67,0x61,0x72,0x69,0x74,0x68,0x6d,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x61,0x2c,0x6f,0x3d,0x5b,0x5d,0x2c,0x72,0x3d,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x6c,0x3d,0x72,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x29,0x29,0x29,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x65,0x2e,0x6d,0x61,0x78,0x29,0x29,0x2c,0x75,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x73,0x29,0x29,0x3b,0x30,0x3d,0x3d,0x3d,0x6c,0x3f,0x28,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x29,0x29,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x6e,0x29,0x29,0x2c,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x6c,0x29,0x2c,0x6c,0x3d,0x61,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x6e,0x29,0x29,0x3a,0x28,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6c,0x29,0x29,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x6c,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x6e,0x29,0x29,0x29,0x3b,0x64,0x6f,0x7b,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x6c,0x29,0x2c,0x31,0x30,0x3d,0x3d,0x3d,0x2b,0x2b,0x61,0x26,0x26,0x28,0x61,0x3d,0x31,0x2c,0x2b,0x2b,0x6e,0x29,0x2c,0x6c,0x3d,0x61,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x6e,0x29,0x7d,0x77,0x68,0x69,0x6c,0x65,0x28,0x6e,0x3c,0x73,0x7c,0x7c,0x6e,0x3d,0x3d,0x3d,0x73,0x26,0x26,0x61,0x3c,0x75,0x29,0x3b,0x76,0x61,0x72,0x20,0x64,0x3d,0x72,0x28,0x74,0x2e,0x6d,0x61,0x78,0x2c,0x6c,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x64,0x29,0x2c,0x6f,0x7d,0x7d,0x2c,0x66,0x6f,0x72,0x6d,0x61,0x74,0x74,0x65,0x72,0x73,0x3a,0x7b,0x76,0x61,0x6c,0x75,0x65,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x3f,0x74,0x3a,0x22,0x22,0x2b,0x74,0x7d,0x2c,0x6c,0x69,0x6e,0x65,0x61,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x33,0x3f,0x6e,0x5b,0x32,0x5d,0x2d,0x6e,0x5b,0x31,0x5d,0x3a,0x6e,0x5b,0x31,0x5d,0x2d,0x6e,0x5b,0x30,0x5d,0x3b,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x61,0x29,0x3e,0x31,0x26,0x26,0x74,0x21,0x3d,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x74,0x29,0x26,0x26,0x28,0x61,0x3d,0x74,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x74,0x29,0x29,0x3b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x61,0x29,0x29,0x2c,0x72,0x3d,0x22,0x22,0x3b,0x69,0x66,0x28,0x30,0x21,0x3d,0x3d,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x2d,0x31,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x6f,0x29,0x3b,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6c,0x2c,0x32,0x30,0x29,0x2c,0x30,0x29,0x2c,0x72,0x3d,0x74,0x2e,0x74,0x6f,0x46,0x69,0x78,0x65,0x64,0x28,0x6c,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x72,0x3d,0x22,0x30,0x22,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x7d,0x2c,0x6c,0x6f,0x67,0x61,0x72,0x69,0x74,0x68,0x6d,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x74,0x29,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x22,0x30,0x22,0x3a,0x31,0x3d,0x3d,0x3d,0x61,0x7c,0x7c,0x32,0x3d,0x3d,0x3d,0x61,0x7c,0x7c,0x35,0x3d,0x3d,0x3d,0x61,0x7c,0x7c,0x30,0x3d,0x3d,0x3d,0x65,0x7c,0x7c,0x65,0x3d,0x3d,0x3d,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3f,0x74,0x2e,0x74,0x6f,0x45,0x78,0x70,0x6f,0x6e,0x65,0x6e,0x74,0x69,0x61,0x6c,0x28,0x29,0x3a,0x22,0x22,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x35,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x73,0x3a,0x7b,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x3a,0x21,0x30,0x2c,0x63,0x75,0x73,0x74,0x6f,0x6d,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6d,0x6f,0x64,0x65,0x3a,0x22,0x6e,0x65,0x61,0x72,0x65,0x73,0x74,0x22,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x61,0x76,0x65,0x72,0x61,0x67,0x65,0x22,0x2c,0x69,0x6e,0x74,0x65,0x72,0x73,0x65,0x63,0x74,0x3a,0x21,0x30,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x2e,0x38,0x29,0x22,0x2c,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x62,0x6f,0x6c,0x64,0x22,0x2c,0x74,0x69,0x74,0x6c,0x65,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x32,0x2c,0x74,0x69,0x74,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x36,0x2c,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x23,0x66,0x66,0x66,0x22,0x2c,0x74,0x69,0x74,0x6c,0x65,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x62,0x6f,0x64,0x79,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x32,0x2c,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x23,0x66,0x66,0x66,0x22,0x2c,0x62,0x6f,0x64,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x62,0x6f,0x6c,0x64,0x22,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x32,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x4d,0x61,0x72,0x67,0x69,0x6e,0x54,0x6f,0x70,0x3a,0x36,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x23,0x66,0x66,0x66,0x22,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x79,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x36,0x2c,0x78,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x36,0x2c,0x63,0x61,0x72,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x32,0x2c,0x63,0x61,0x72,0x65,0x74,0x53,0x69,0x7a,0x65,0x3a,0x35,0x2c,0x63,0x6f,0x72,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x36,0x2c,0x6d,0x75,0x6c,0x74,0x69,0x4b,0x65,0x79,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x3a,0x22,0x23,0x66,0x66,0x66,0x22,0x2c,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x3a,0x21,0x30,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x29,0x22,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x30,0x2c,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x3a,0x7b,0x62,0x65,0x66,0x6f,0x72,0x65,0x54,0x69,0x74,0x6c,0x65,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x74,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x22,0x22,0x2c,0x69,0x3d,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2c,0x61,0x3d,0x69,0x3f,0x69,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3a,0x30,0x3b,0x69,0x66,0x28,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x30,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x74,0x5b,0x30,0x5d,0x3b,0x6f,0x2e,0x78,0x4c,0x61,0x62,0x65,0x6c,0x3f,0x6e,0x3d,0x6f,0x2e,0x78,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x61,0x3e,0x30,0x26,0x26,0x6f,0x2e,0x69,0x6e,0x64,0x65,0x78,0x3c,0x61,0x26,0x26,0x28,0x6e,0x3d,0x69,0x5b,0x6f,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x54,0x69,0x74,0x6c,0x65,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x7c,0x7c,0x22,0x22,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x26,0x26,0x28,0x6e,0x2b,0x3d,0x22,0x3a,0x20,0x22,0x29,0x2c,0x6e,0x2b,0x3d,0x74,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x74,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x29,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x2e,0x69,0x6e,0x64,0x65,0x78,0x5d,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x7d,0x7d,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x54,0x65,0x78,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x6f,0x6f,0x74,0x65,0x72,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x2c,0x61,0x66,0x74,0x65,0x72,0x46,0x6f,0x6f,0x74,0x65,0x72,0x3a,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x6f,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x28,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x65,0x2a,0x6e,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x29,0x29,0x2e,0x72,0x67,0x62,0x61,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x26,0x26,0x28,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x3f,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x70,0x75,0x73,0x68,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x65,0x29,0x3a,0x74,0x2e,0x70,0x75,0x73,0x68,0x28,0x65,0x29,0x29,0x2c,0x74,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x5f,0x78,0x53,0x63,0x61,0x6c,0x65,0x2c,0x6e,0x3d,0x74,0x2e,0x5f,0x79,0x53,0x63,0x61,0x6c,0x65,0x7c,0x7c,0x74,0x2e,0x5f,0x73,0x63,0x61,0x6c,0x65,0x2c,0x69,0x3d,0x74,0x2e,0x5f,0x69,0x6e,0x64,0x65,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x65,0x3f,0x65,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x28,0x69,0x2c,0x61,0x29,0x3a,0x22,0x22,0x2c,0x79,0x4c,0x61,0x62,0x65,0x6c,0x3a,0x6e,0x3f,0x6e,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x28,0x69,0x2c,0x61,0x29,0x3a,0x22,0x22,0x2c,0x69,0x6e,0x64,0x65,0x78,0x3a,0x69,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x61,0x2c,0x78,0x3a,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x6e,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x78,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x79,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x79,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x78,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x74,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x74,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x74,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x5f,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x6e,0x28,0x74,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x5f,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6e,0x28,0x74,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x5f,0x62,0x6f,0x64,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x74,0x2e,0x62,0x6f,0x64,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x3a,0x6e,0x28,0x74,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x62,0x6f,0x64,0x79,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x62,0x6f,0x64,0x79,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x2c,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x5f,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x6e,0x28,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x5f,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6e,0x28,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x3a,0x6e,0x28,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x5f,0x74,0x69,0x74,0x6c,0x65,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x74,0x69,0x74,0x6c,0x65,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x2c,0x74,0x69,0x74,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x74,0x2e,0x74,0x69,0x74,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x6e,0x28,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6e,0x28,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x3a,0x6e,0x28,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x65,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x2c,0x66,0x6f,0x6f,0x74,0x65,0x72,0x4d,0x61,0x72,0x67,0x69,0x6e,0x54,0x6f,0x70,0x3a,0x74,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x4d,0x61,0x72,0x67,0x69,0x6e,0x54,0x6f,0x70,0x2c,0x63,0x61,0x72,0x65,0x74,0x53,0x69,0x7a,0x65,0x3a,0x74,0x2e,0x63,0x61,0x72,0x65,0x74,0x53,0x69,0x7a,0x65,0x2c,0x63,0x6f,0x72,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x74,0x2e,0x63,0x6f,0x72,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x74,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x30,0x2c,0x6c,0x65,0x67,0x65,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x3a,0x74,0x2e,0x6d,0x75,0x6c,0x74,0x69,0x4b,0x65,0x79,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2c,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x3a,0x74,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x74,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x74,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x69,0x3d,0x32,0x2a,0x65,0x2e,0x79,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x61,0x3d,0x30,0x2c,0x72,0x3d,0x65,0x2e,0x62,0x6f,0x64,0x79,0x2c,0x6c,0x3d,0x72,0x2e,0x72,0x65,0x64,0x75,0x63,0x65,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2b,0x65,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2b,0x65,0x2e,0x6c,0x69,0x6e,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2b,0x65,0x2e,0x61,0x66,0x74,0x65,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7d,0x2c,0x30,0x29,0x3b,0x6c,0x2b,0x3d,0x65,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2b,0x65,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x75,0x3d,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x64,0x3d,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x63,0x3d,0x65,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x68,0x3d,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x3b,0x69,0x2b,0x3d,0x73,0x2a,0x64,0x2c,0x69,0x2b,0x3d,0x73,0x3f,0x28,0x73,0x2d,0x31,0x29,0x2a,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x30,0x2c,0x69,0x2b,0x3d,0x73,0x3f,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x30,0x2c,0x69,0x2b,0x3d,0x6c,0x2a,0x63,0x2c,0x69,0x2b,0x3d,0x6c,0x3f,0x28,0x6c,0x2d,0x31,0x29,0x2a,0x65,0x2e,0x62,0x6f,0x64,0x79,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x30,0x2c,0x69,0x2b,0x3d,0x75,0x3f,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x4d,0x61,0x72,0x67,0x69,0x6e,0x54,0x6f,0x70,0x3a,0x30,0x2c,0x69,0x2b,0x3d,0x75,0x2a,0x68,0x2c,0x69,0x2b,0x3d,0x75,0x3f,0x28,0x75,0x2d,0x31,0x29,0x2a,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3a,0x30,0x3b,0x76,0x61,0x72,0x20,0x66,0x3d,0x30,0x2c,0x67,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x61,0x2c,0x6e,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x74,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x2b,0x66,0x29,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x64,0x2c,0x65,0x2e,0x5f,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2e,0x5f,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x2c,0x67,0x29,0x2c,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x63,0x2c,0x65,0x2e,0x5f,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2e,0x5f,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x65,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x29,0x2c,0x67,0x29,0x2c,0x66,0x3d,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x3f,0x63,0x2b,0x32,0x3a,0x30,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x72,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x2c,0x67,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x73,0x2c,0x67,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x61,0x66,0x74,0x65,0x72,0x2c,0x67,0x29,0x7d,0x29,0x2c,0x66,0x3d,0x30,0x2c,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x68,0x2c,0x65,0x2e,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x65,0x2e,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x2c,0x67,0x29,0x2c,0x61,0x2b,0x3d,0x32,0x2a,0x65,0x2e,0x78,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x61,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x69,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x69,0x3d,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x2c,0x6f,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x72,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3b,0x6e,0x2e,0x79,0x3c,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3f,0x72,0x3d,0x22,0x74,0x6f,0x70,0x22,0x3a,0x6e,0x2e,0x79,0x3e,0x69,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2d,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x26,0x26,0x28,0x72,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x29,0x3b,0x76,0x61,0x72,0x20,0x6c,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x2c,0x63,0x2c,0x68,0x3d,0x28,0x61,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x61,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x2f,0x32,0x2c,0x66,0x3d,0x28,0x61,0x2e,0x74,0x6f,0x70,0x2b,0x61,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x2f,0x32,0x3b,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x72,0x3f,0x28,0x6c,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3c,0x3d,0x68,0x7d,0x2c,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3e,0x68,0x7d,0x29,0x3a,0x28,0x6c,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3c,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x7d,0x2c,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3e,0x3d,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x2d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x7d,0x29,0x2c,0x75,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2b,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3e,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x2c,0x64,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3c,0x30,0x7d,0x2c,0x63,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3c,0x3d,0x66,0x3f,0x22,0x74,0x6f,0x70,0x22,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x7d,0x2c,0x6c,0x28,0x6e,0x2e,0x78,0x29,0x3f,0x28,0x6f,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x75,0x28,0x6e,0x2e,0x78,0x29,0x26,0x26,0x28,0x6f,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x72,0x3d,0x63,0x28,0x6e,0x2e,0x79,0x29,0x29,0x29,0x3a,0x73,0x28,0x6e,0x2e,0x78,0x29,0x26,0x26,0x28,0x6f,0x3d,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x2c,0x64,0x28,0x6e,0x2e,0x78,0x29,0x26,0x26,0x28,0x6f,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x72,0x3d,0x63,0x28,0x6e,0x2e,0x79,0x29,0x29,0x29,0x3b,0x76,0x61,0x72,0x20,0x67,0x3d,0x74,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x67,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x3f,0x67,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x6f,0x2c,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x67,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3f,0x67,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x72,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x64,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x78,0x2c,0x61,0x3d,0x74,0x2e,0x79,0x2c,0x6f,0x3d,0x74,0x2e,0x63,0x61,0x72,0x65,0x74,0x53,0x69,0x7a,0x65,0x2c,0x72,0x3d,0x74,0x2e,0x63,0x61,0x72,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x6c,0x3d,0x74,0x2e,0x63,0x6f,0x72,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x73,0x3d,0x6e,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x75,0x3d,0x6e,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x64,0x3d,0x6f,0x2b,0x72,0x2c,0x63,0x3d,0x6c,0x2b,0x72,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x73,0x3f,0x69,0x2d,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x73,0x26,0x26,0x28,0x69,0x2d,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x29,0x2c,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x75,0x3f,0x61,0x2b,0x3d,0x64,0x3a,0x61,0x2d,0x3d,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x75,0x3f,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2b,0x64,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x2c,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x75,0x3f,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x73,0x3f,0x69,0x2b,0x3d,0x64,0x3a,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x73,0x26,0x26,0x28,0x69,0x2d,0x3d,0x64,0x29,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x73,0x3f,0x69,0x2d,0x3d,0x63,0x3a,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x73,0x26,0x26,0x28,0x69,0x2b,0x3d,0x63,0x29,0x2c,0x7b,0x78,0x3a,0x69,0x2c,0x79,0x3a,0x61,0x7d,0x7d,0x74,0x2e,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x6c,0x28,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x3d,0x5b,0x5d,0x7d,0x2c,0x67,0x65,0x74,0x54,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x54,0x69,0x74,0x6c,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x61,0x3d,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x6f,0x3d,0x65,0x2e,0x61,0x66,0x74,0x65,0x72,0x54,0x69,0x74,0x6c,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x72,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x3d,0x6e,0x28,0x72,0x2c,0x69,0x29,0x2c,0x72,0x3d,0x6e,0x28,0x72,0x2c,0x61,0x29,0x2c,0x72,0x3d,0x6e,0x28,0x72,0x2c,0x6f,0x29,0x7d,0x2c,0x67,0x65,0x74,0x42,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x68,0x69,0x73,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x3f,0x74,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x3f,0x5b,0x74,0x5d,0x3a,0x5b,0x5d,0x7d,0x2c,0x67,0x65,0x74,0x42,0x6f,0x64,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2c,0x72,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x7b,0x62,0x65,0x66,0x6f,0x72,0x65,0x3a,0x5b,0x5d,0x2c,0x6c,0x69,0x6e,0x65,0x73,0x3a,0x5b,0x5d,0x2c,0x61,0x66,0x74,0x65,0x72,0x3a,0x5b,0x5d,0x7d,0x3b,0x6e,0x28,0x6f,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x2c,0x61,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x4c,0x61,0x62,0x65,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x69,0x2c,0x74,0x2c,0x65,0x29,0x29,0x2c,0x6e,0x28,0x6f,0x2e,0x6c,0x69,0x6e,0x65,0x73,0x2c,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x69,0x2c,0x74,0x2c,0x65,0x29,0x29,0x2c,0x6e,0x28,0x6f,0x2e,0x61,0x66,0x74,0x65,0x72,0x2c,0x61,0x2e,0x61,0x66,0x74,0x65,0x72,0x4c,0x61,0x62,0x65,0x6c,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x69,0x2c,0x74,0x2c,0x65,0x29,0x29,0x2c,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x6f,0x29,0x7d,0x29,0x2c,0x72,0x7d,0x2c,0x67,0x65,0x74,0x41,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x68,0x69,0x73,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x3f,0x74,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x3f,0x5b,0x74,0x5d,0x3a,0x5b,0x5d,0x7d,0x2c,0x67,0x65,0x74,0x46,0x6f,0x6f,0x74,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x6f,0x6f,0x74,0x65,0x72,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x61,0x3d,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x6f,0x3d,0x65,0x2e,0x61,0x66,0x74,0x65,0x72,0x46,0x6f,0x6f,0x74,0x65,0x72,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x72,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x3d,0x6e,0x28,0x72,0x2c,0x69,0x29,0x2c,0x72,0x3d,0x6e,0x28,0x72,0x2c,0x61,0x29,0x2c,0x72,0x3d,0x6e,0x28,0x72,0x2c,0x6f,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x68,0x69,0x73,0x2c,0x63,0x3d,0x61,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x68,0x3d,0x61,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x66,0x3d,0x61,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x6c,0x28,0x63,0x29,0x2c,0x67,0x3d,0x61,0x2e,0x5f,0x61,0x63,0x74,0x69,0x76,0x65,0x2c,0x70,0x3d,0x61,0x2e,0x5f,0x64,0x61,0x74,0x61,0x2c,0x76,0x3d,0x7b,0x78,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x68,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3a,0x68,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x7d,0x2c,0x6d,0x3d,0x7b,0x78,0x3a,0x68,0x2e,0x78,0x2c,0x79,0x3a,0x68,0x2e,0x79,0x7d,0x2c,0x62,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x68,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x68,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x2c,0x78,0x3d,0x7b,0x78,0x3a,0x68,0x2e,0x63,0x61,0x72,0x65,0x74,0x58,0x2c,0x79,0x3a,0x68,0x2e,0x63,0x61,0x72,0x65,0x74,0x59,0x7d,0x3b,0x69,0x66,0x28,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x7b,0x66,0x2e,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3d,0x31,0x3b,0x76,0x61,0x72,0x20,0x79,0x3d,0x5b,0x5d,0x2c,0x6b,0x3d,0x5b,0x5d,0x3b,0x78,0x3d,0x74,0x2e,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x65,0x72,0x73,0x5b,0x63,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x5d,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x2c,0x67,0x2c,0x61,0x2e,0x5f,0x65,0x76,0x65,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x29,0x3b,0x76,0x61,0x72,0x20,0x77,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x77,0x2e,0x70,0x75,0x73,0x68,0x28,0x72,0x28,0x67,0x5b,0x6e,0x5d,0x29,0x29,0x3b,0x63,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x26,0x26,0x28,0x77,0x3d,0x77,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x63,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x74,0x2c,0x70,0x29,0x7d,0x29,0x29,0x2c,0x63,0x2e,0x69,0x74,0x65,0x6d,0x53,0x6f,0x72,0x74,0x26,0x26,0x28,0x77,0x3d,0x77,0x2e,0x73,0x6f,0x72,0x74,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x63,0x2e,0x69,0x74,0x65,0x6d,0x53,0x6f,0x72,0x74,0x28,0x74,0x2c,0x65,0x2c,0x70,0x29,0x7d,0x29,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x77,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x79,0x2e,0x70,0x75,0x73,0x68,0x28,0x63,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x2c,0x74,0x2c,0x61,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x29,0x29,0x2c,0x6b,0x2e,0x70,0x75,0x73,0x68,0x28,0x63,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x73,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x54,0x65,0x78,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x2c,0x74,0x2c,0x61,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x29,0x29,0x7d,0x29,0x2c,0x66,0x2e,0x74,0x69,0x74,0x6c,0x65,0x3d,0x61,0x2e,0x67,0x65,0x74,0x54,0x69,0x74,0x6c,0x65,0x28,0x77,0x2c,0x70,0x29,0x2c,0x66,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x3d,0x61,0x2e,0x67,0x65,0x74,0x42,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x28,0x77,0x2c,0x70,0x29,0x2c,0x66,0x2e,0x62,0x6f,0x64,0x79,0x3d,0x61,0x2e,0x67,0x65,0x74,0x42,0x6f,0x64,0x79,0x28,0x77,0x2c,0x70,0x29,0x2c,0x66,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x3d,0x61,0x2e,0x67,0x65,0x74,0x41,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x28,0x77,0x2c,0x70,0x29,0x2c,0x66,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x3d,0x61,0x2e,0x67,0x65,0x74,0x46,0x6f,0x6f,0x74,0x65,0x72,0x28,0x77,0x2c,0x70,0x29,0x2c,0x66,0x2e,0x78,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x78,0x2e,0x78,0x29,0x2c,0x66,0x2e,0x79,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x78,0x2e,0x79,0x29,0x2c,0x66,0x2e,0x63,0x61,0x72,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3d,0x63,0x2e,0x63,0x61,0x72,0x65,0x74,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x66,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x3d,0x79,0x2c,0x66,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x54,0x65,0x78,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x3d,0x6b,0x2c,0x66,0x2e,0x64,0x61,0x74,0x61,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3d,0x77,0x2c,0x6d,0x3d,0x64,0x28,0x66,0x2c,0x62,0x3d,0x73,0x28,0x74,0x68,0x69,0x73,0x2c,0x66,0x29,0x2c,0x76,0x3d,0x75,0x28,0x74,0x68,0x69,0x73,0x2c,0x62,0x29,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x66,0x2e,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3d,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x76,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x66,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x76,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x66,0x2e,0x78,0x3d,0x6d,0x2e,0x78,0x2c,0x66,0x2e,0x79,0x3d,0x6d,0x2e,0x79,0x2c,0x66,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x62,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x66,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x62,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x66,0x2e,0x63,0x61,0x72,0x65,0x74,0x58,0x3d,0x78,0x2e,0x78,0x2c,0x66,0x2e,0x63,0x61,0x72,0x65,0x74,0x59,0x3d,0x78,0x2e,0x79,0x2c,0x61,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3d,0x66,0x2c,0x65,0x26,0x26,0x63,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x26,0x26,0x63,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x2c,0x66,0x29,0x2c,0x61,0x7d,0x2c,0x64,0x72,0x61,0x77,0x43,0x61,0x72,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x61,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x43,0x61,0x72,0x65,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x69,0x29,0x3b,0x6e,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x61,0x2e,0x78,0x31,0x2c,0x61,0x2e,0x79,0x31,0x29,0x2c,0x6e,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x61,0x2e,0x78,0x32,0x2c,0x61,0x2e,0x79,0x32,0x29,0x2c,0x6e,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x61,0x2e,0x78,0x33,0x2c,0x61,0x2e,0x79,0x33,0x29,0x7d,0x2c,0x67,0x65,0x74,0x43,0x61,0x72,0x65,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x3d,0x6e,0x2e,0x63,0x61,0x72,0x65,0x74,0x53,0x69,0x7a,0x65,0x2c,0x64,0x3d,0x6e,0x2e,0x63,0x6f,0x72,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x63,0x3d,0x6e,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x68,0x3d,0x6e,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x66,0x3d,0x74,0x2e,0x78,0x2c,0x67,0x3d,0x74,0x2e,0x79,0x2c,0x70,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x76,0x3d,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3b,0x69,0x66,0x28,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x68,0x29,0x6c,0x3d,0x67,0x2b,0x76,0x2f,0x32,0x2c,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x63,0x3f,0x28,0x61,0x3d,0x28,0x69,0x3d,0x66,0x29,0x2d,0x75,0x2c,0x6f,0x3d,0x69,0x2c,0x72,0x3d,0x6c,0x2b,0x75,0x2c,0x73,0x3d,0x6c,0x2d,0x75,0x29,0x3a,0x28,0x61,0x3d,0x28,0x69,0x3d,0x66,0x2b,0x70,0x29,0x2b,0x75,0x2c,0x6f,0x3d,0x69,0x2c,0x72,0x3d,0x6c,0x2d,0x75,0x2c,0x73,0x3d,0x6c,0x2b,0x75,0x29,0x3b,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x63,0x3f,0x28,0x69,0x3d,0x28,0x61,0x3d,0x66,0x2b,0x64,0x2b,0x75,0x29,0x2d,0x75,0x2c,0x6f,0x3d,0x61,0x2b,0x75,0x29,0x3a,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x63,0x3f,0x28,0x69,0x3d,0x28,0x61,0x3d,0x66,0x2b,0x70,0x2d,0x64,0x2d,0x75,0x29,0x2d,0x75,0x2c,0x6f,0x3d,0x61,0x2b,0x75,0x29,0x3a,0x28,0x69,0x3d,0x28,0x61,0x3d,0x66,0x2b,0x70,0x2f,0x32,0x29,0x2d,0x75,0x2c,0x6f,0x3d,0x61,0x2b,0x75,0x29,0x2c,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x68,0x29,0x6c,0x3d,0x28,0x72,0x3d,0x67,0x29,0x2d,0x75,0x2c,0x73,0x3d,0x72,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x6c,0x3d,0x28,0x72,0x3d,0x67,0x2b,0x76,0x29,0x2b,0x75,0x2c,0x73,0x3d,0x72,0x3b,0x76,0x61,0x72,0x20,0x6d,0x3d,0x6f,0x3b,0x6f,0x3d,0x69,0x2c,0x69,0x3d,0x6d,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x31,0x3a,0x69,0x2c,0x78,0x32,0x3a,0x61,0x2c,0x78,0x33,0x3a,0x6f,0x2c,0x79,0x31,0x3a,0x72,0x2c,0x79,0x32,0x3a,0x6c,0x2c,0x79,0x33,0x3a,0x73,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x54,0x69,0x74,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6e,0x2e,0x74,0x69,0x74,0x6c,0x65,0x3b,0x69,0x66,0x28,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x7b,0x69,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x6e,0x2e,0x5f,0x74,0x69,0x74,0x6c,0x65,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x69,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x74,0x6f,0x70,0x22,0x3b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x6e,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x73,0x3d,0x6e,0x2e,0x74,0x69,0x74,0x6c,0x65,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x3b,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x6c,0x2c,0x6e,0x2e,0x5f,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x6e,0x2e,0x5f,0x74,0x69,0x74,0x6c,0x65,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x3b,0x76,0x61,0x72,0x20,0x75,0x2c,0x64,0x3b,0x66,0x6f,0x72,0x28,0x75,0x3d,0x30,0x2c,0x64,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x75,0x3c,0x64,0x3b,0x2b,0x2b,0x75,0x29,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x72,0x5b,0x75,0x5d,0x2c,0x74,0x2e,0x78,0x2c,0x74,0x2e,0x79,0x29,0x2c,0x74,0x2e,0x79,0x2b,0x3d,0x6c,0x2b,0x73,0x2c,0x75,0x2b,0x31,0x3d,0x3d,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x74,0x2e,0x79,0x2b,0x3d,0x6e,0x2e,0x74,0x69,0x74,0x6c,0x65,0x4d,0x61,0x72,0x67,0x69,0x6e,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x73,0x29,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x42,0x6f,0x64,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6e,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x6c,0x3d,0x6e,0x2e,0x62,0x6f,0x64,0x79,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x2c,0x73,0x3d,0x6e,0x2e,0x62,0x6f,0x64,0x79,0x3b,0x69,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x6e,0x2e,0x5f,0x62,0x6f,0x64,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x69,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x74,0x6f,0x70,0x22,0x2c,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x72,0x2c,0x6e,0x2e,0x5f,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x6e,0x2e,0x5f,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x30,0x2c,0x64,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x65,0x2c,0x74,0x2e,0x78,0x2b,0x75,0x2c,0x74,0x2e,0x79,0x29,0x2c,0x74,0x2e,0x79,0x2b,0x3d,0x72,0x2b,0x6c,0x7d,0x3b,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x62,0x6f,0x64,0x79,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x2c,0x64,0x29,0x3b,0x76,0x61,0x72,0x20,0x63,0x3d,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x3b,0x75,0x3d,0x63,0x3f,0x72,0x2b,0x32,0x3a,0x30,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6c,0x2c,0x73,0x29,0x7b,0x76,0x61,0x72,0x20,0x75,0x3d,0x65,0x28,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x54,0x65,0x78,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x5b,0x73,0x5d,0x2c,0x61,0x29,0x3b,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x75,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6c,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x2c,0x64,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6c,0x2e,0x6c,0x69,0x6e,0x65,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x29,0x7b,0x63,0x26,0x26,0x28,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x52,0x65,0x63,0x74,0x28,0x74,0x2e,0x78,0x2c,0x74,0x2e,0x79,0x2c,0x72,0x2c,0x72,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x31,0x2c,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x5b,0x73,0x5d,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x52,0x65,0x63,0x74,0x28,0x74,0x2e,0x78,0x2c,0x74,0x2e,0x79,0x2c,0x72,0x2c,0x72,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x43,0x6f,0x6c,0x6f,0x72,0x73,0x5b,0x73,0x5d,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x52,0x65,0x63,0x74,0x28,0x74,0x2e,0x78,0x2b,0x31,0x2c,0x74,0x2e,0x79,0x2b,0x31,0x2c,0x72,0x2d,0x32,0x2c,0x72,0x2d,0x32,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x75,0x29,0x2c,0x64,0x28,0x6f,0x29,0x7d,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6c,0x2e,0x61,0x66,0x74,0x65,0x72,0x2c,0x64,0x29,0x7d,0x29,0x2c,0x75,0x3d,0x30,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x2c,0x64,0x29,0x2c,0x74,0x2e,0x79,0x2d,0x3d,0x6c,0x7d,0x2c,0x64,0x72,0x61,0x77,0x46,0x6f,0x6f,0x74,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6e,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x3b,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x74,0x2e,0x79,0x2b,0x3d,0x6e,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x4d,0x61,0x72,0x67,0x69,0x6e,0x54,0x6f,0x70,0x2c,0x69,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x6e,0x2e,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x69,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x74,0x6f,0x70,0x22,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x6e,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x6e,0x2e,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x6e,0x2e,0x5f,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x72,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x65,0x2c,0x74,0x2e,0x78,0x2c,0x74,0x2e,0x79,0x29,0x2c,0x74,0x2e,0x79,0x2b,0x3d,0x6e,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2b,0x6e,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x53,0x70,0x61,0x63,0x69,0x6e,0x67,0x7d,0x29,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x29,0x7b,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x29,0x2c,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x28,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6e,0x2e,0x78,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x6c,0x3d,0x6e,0x2e,0x79,0x41,0x6c,0x69,0x67,0x6e,0x2c,0x73,0x3d,0x74,0x2e,0x78,0x2c,0x75,0x3d,0x74,0x2e,0x79,0x2c,0x64,0x3d,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x63,0x3d,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x68,0x3d,0x6e,0x2e,0x63,0x6f,0x72,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3b,0x69,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x69,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x73,0x2b,0x68,0x2c,0x75,0x29,0x2c,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x6c,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x43,0x61,0x72,0x65,0x74,0x28,0x74,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x73,0x2b,0x64,0x2d,0x68,0x2c,0x75,0x29,0x2c,0x69,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x73,0x2b,0x64,0x2c,0x75,0x2c,0x73,0x2b,0x64,0x2c,0x75,0x2b,0x68,0x29,0x2c,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x6c,0x26,0x26,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x3d,0x3d,0x3d,0x72,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x43,0x61,0x72,0x65,0x74,0x28,0x74,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x73,0x2b,0x64,0x2c,0x75,0x2b,0x63,0x2d,0x68,0x29,0x2c,0x69,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x73,0x2b,0x64,0x2c,0x75,0x2b,0x63,0x2c,0x73,0x2b,0x64,0x2d,0x68,0x2c,0x75,0x2b,0x63,0x29,0x2c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x6c,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x43,0x61,0x72,0x65,0x74,0x28,0x74,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x73,0x2b,0x68,0x2c,0x75,0x2b,0x63,0x29,0x2c,0x69,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x73,0x2c,0x75,0x2b,0x63,0x2c,0x73,0x2c,0x75,0x2b,0x63,0x2d,0x68,0x29,0x2c,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x6c,0x26,0x26,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x72,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x43,0x61,0x72,0x65,0x74,0x28,0x74,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x73,0x2c,0x75,0x2b,0x68,0x29,0x2c,0x69,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x73,0x2c,0x75,0x2c,0x73,0x2b,0x68,0x2c,0x75,0x29,0x2c,0x69,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x2c,0x6e,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3e,0x30,0x26,0x26,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x69,0x66,0x28,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x2c,0x69,0x3d,0x7b,0x78,0x3a,0x65,0x2e,0x78,0x2c,0x79,0x3a,0x65,0x2e,0x79,0x7d,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x65,0x2e,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3c,0x2e,0x30,0x30,0x31,0x29,0x3f,0x30,0x3a,0x65,0x2e,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x2c,0x6f,0x3d,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7c,0x7c,0x65,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x6f,0x64,0x79,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7c,0x7c,0x65,0x2e,0x62,0x6f,0x64,0x79,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7c,0x7c,0x65,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x6f,0x64,0x79,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7c,0x7c,0x65,0x2e,0x66,0x6f,0x6f,0x74,0x65,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x26,0x26,0x6f,0x26,0x26,0x28,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x42,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x28,0x69,0x2c,0x65,0x2c,0x74,0x2c,0x6e,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x78,0x2b,0x3d,0x65,0x2e,0x78,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x69,0x2e,0x79,0x2b,0x3d,0x65,0x2e,0x79,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x54,0x69,0x74,0x6c,0x65,0x28,0x69,0x2c,0x65,0x2c,0x74,0x2c,0x61,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x42,0x6f,0x64,0x79,0x28,0x69,0x2c,0x65,0x2c,0x74,0x2c,0x61,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x46,0x6f,0x6f,0x74,0x65,0x72,0x28,0x69,0x2c,0x65,0x2c,0x74,0x2c,0x61,0x29,0x29,0x7d,0x7d,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x5f,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x69,0x3d,0x21,0x31,0x3b,0x69,0x66,0x28,0x65,0x2e,0x5f,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x3d,0x65,0x2e,0x5f,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x7c,0x7c,0x5b,0x5d,0x2c,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6f,0x75,0x74,0x22,0x3d,0x3d,0x3d,0x74,0x2e,0x74,0x79,0x70,0x65,0x3f,0x65,0x2e,0x5f,0x61,0x63,0x74,0x69,0x76,0x65,0x3d,0x5b,0x5d,0x3a,0x65,0x2e,0x5f,0x61,0x63,0x74,0x69,0x76,0x65,0x3d,0x65,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x41,0x74,0x45,0x76,0x65,0x6e,0x74,0x46,0x6f,0x72,0x4d,0x6f,0x64,0x65,0x28,0x74,0x2c,0x6e,0x2e,0x6d,0x6f,0x64,0x65,0x2c,0x6e,0x29,0x2c,0x21,0x28,0x69,0x3d,0x21,0x6f,0x2e,0x61,0x72,0x72,0x61,0x79,0x45,0x71,0x75,0x61,0x6c,0x73,0x28,0x65,0x2e,0x5f,0x61,0x63,0x74,0x69,0x76,0x65,0x2c,0x65,0x2e,0x5f,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x29,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x69,0x66,0x28,0x65,0x2e,0x5f,0x6c,0x61,0x73,0x74,0x41,0x63,0x74,0x69,0x76,0x65,0x3d,0x65,0x2e,0x5f,0x61,0x63,0x74,0x69,0x76,0x65,0x2c,0x6e,0x2e,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x7c,0x7c,0x6e,0x2e,0x63,0x75,0x73,0x74,0x6f,0x6d,0x29,0x7b,0x65,0x2e,0x5f,0x65,0x76,0x65,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3d,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x7d,0x3b,0x76,0x61,0x72,0x20,0x61,0x3d,0x65,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x3b,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x21,0x30,0x29,0x2c,0x65,0x2e,0x70,0x69,0x76,0x6f,0x74,0x28,0x29,0x2c,0x69,0x7c,0x3d,0x61,0x2e,0x78,0x21,0x3d,0x3d,0x65,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x78,0x7c,0x7c,0x61,0x2e,0x79,0x21,0x3d,0x3d,0x65,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2e,0x79,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x54,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x65,0x72,0x73,0x3d,0x7b,0x61,0x76,0x65,0x72,0x61,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x21,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x30,0x2c,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x30,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x74,0x5b,0x65,0x5d,0x3b,0x69,0x66,0x28,0x72,0x26,0x26,0x72,0x2e,0x68,0x61,0x73,0x56,0x61,0x6c,0x75,0x65,0x28,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x72,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x29,0x3b,0x69,0x2b,0x3d,0x6c,0x2e,0x78,0x2c,0x61,0x2b,0x3d,0x6c,0x2e,0x79,0x2c,0x2b,0x2b,0x6f,0x7d,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x69,0x2f,0x6f,0x29,0x2c,0x79,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x61,0x2f,0x6f,0x29,0x7d,0x7d,0x2c,0x6e,0x65,0x61,0x72,0x65,0x73,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x72,0x3d,0x65,0x2e,0x78,0x2c,0x6c,0x3d,0x65,0x2e,0x79,0x2c,0x73,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x50,0x4f,0x53,0x49,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x75,0x3d,0x74,0x5b,0x6e,0x5d,0x3b,0x69,0x66,0x28,0x75,0x26,0x26,0x75,0x2e,0x68,0x61,0x73,0x56,0x61,0x6c,0x75,0x65,0x28,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x64,0x3d,0x75,0x2e,0x67,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x28,0x29,0x2c,0x63,0x3d,0x6f,0x2e,0x64,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x42,0x65,0x74,0x77,0x65,0x65,0x6e,0x50,0x6f,0x69,0x6e,0x74,0x73,0x28,0x65,0x2c,0x64,0x29,0x3b,0x63,0x3c,0x73,0x26,0x26,0x28,0x73,0x3d,0x63,0x2c,0x61,0x3d,0x75,0x29,0x7d,0x7d,0x69,0x66,0x28,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x68,0x3d,0x61,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x29,0x3b,0x72,0x3d,0x68,0x2e,0x78,0x2c,0x6c,0x3d,0x68,0x2e,0x79,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x72,0x2c,0x79,0x3a,0x6c,0x7d,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x36,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x61,0x72,0x63,0x3a,0x7b,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x23,0x66,0x66,0x66,0x22,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x32,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x4c,0x61,0x62,0x65,0x6c,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x21,0x65,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x2d,0x65,0x2e,0x78,0x2c,0x32,0x29,0x3c,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2b,0x65,0x2e,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x7d,0x2c,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x69,0x66,0x28,0x6e,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x41,0x6e,0x67,0x6c,0x65,0x46,0x72,0x6f,0x6d,0x50,0x6f,0x69,0x6e,0x74,0x28,0x6e,0x2c,0x7b,0x78,0x3a,0x74,0x2c,0x79,0x3a,0x65,0x7d,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x61,0x6e,0x67,0x6c,0x65,0x2c,0x72,0x3d,0x69,0x2e,0x64,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x2c,0x6c,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x2c,0x73,0x3d,0x6e,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x3b,0x73,0x3c,0x6c,0x3b,0x29,0x73,0x2b,0x3d,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3b,0x66,0x6f,0x72,0x28,0x3b,0x61,0x3e,0x73,0x3b,0x29,0x61,0x2d,0x3d,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3b,0x66,0x6f,0x72,0x28,0x3b,0x61,0x3c,0x6c,0x3b,0x29,0x61,0x2b,0x3d,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x61,0x3e,0x3d,0x6c,0x26,0x26,0x61,0x3c,0x3d,0x73,0x2c,0x64,0x3d,0x72,0x3e,0x3d,0x6e,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x26,0x26,0x72,0x3c,0x3d,0x6e,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x26,0x26,0x64,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x7d,0x2c,0x67,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x65,0x3d,0x28,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x2b,0x74,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x29,0x2f,0x32,0x2c,0x6e,0x3d,0x28,0x74,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2b,0x74,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2f,0x32,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x65,0x29,0x2a,0x6e,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x65,0x29,0x2a,0x6e,0x7d,0x7d,0x2c,0x67,0x65,0x74,0x41,0x72,0x65,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x28,0x28,0x74,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x2d,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x29,0x2f,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x29,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x29,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x65,0x3d,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x2b,0x28,0x74,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x2d,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x29,0x2f,0x32,0x2c,0x6e,0x3d,0x28,0x74,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2d,0x74,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x29,0x2f,0x32,0x2b,0x74,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x65,0x29,0x2a,0x6e,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x65,0x29,0x2a,0x6e,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x6e,0x3d,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x2c,0x69,0x3d,0x65,0x2e,0x65,0x6e,0x64,0x41,0x6e,0x67,0x6c,0x65,0x3b,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x61,0x72,0x63,0x28,0x65,0x2e,0x78,0x2c,0x65,0x2e,0x79,0x2c,0x65,0x2e,0x6f,0x75,0x74,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x6e,0x2c,0x69,0x29,0x2c,0x74,0x2e,0x61,0x72,0x63,0x28,0x65,0x2e,0x78,0x2c,0x65,0x2e,0x79,0x2c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x69,0x2c,0x6e,0x2c,0x21,0x30,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x4a,0x6f,0x69,0x6e,0x3d,0x22,0x62,0x65,0x76,0x65,0x6c,0x22,0x2c,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x26,0x26,0x74,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x7d,0x7d,0x29,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x37,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x6c,0x69,0x6e,0x65,0x3a,0x7b,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3a,0x2e,0x34,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x33,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x62,0x75,0x74,0x74,0x22,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x3a,0x5b,0x5d,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x30,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x6d,0x69,0x74,0x65,0x72,0x22,0x2c,0x63,0x61,0x70,0x42,0x65,0x7a,0x69,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3a,0x21,0x30,0x2c,0x66,0x69,0x6c,0x6c,0x3a,0x21,0x30,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6c,0x3d,0x61,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x73,0x3d,0x61,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x75,0x3d,0x6c,0x2e,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x2c,0x64,0x3d,0x61,0x2e,0x5f,0x63,0x68,0x69,0x6c,0x64,0x72,0x65,0x6e,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x29,0x2c,0x63,0x3d,0x72,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x2c,0x68,0x3d,0x2d,0x31,0x3b,0x66,0x6f,0x72,0x28,0x61,0x2e,0x5f,0x6c,0x6f,0x6f,0x70,0x26,0x26,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x64,0x2e,0x70,0x75,0x73,0x68,0x28,0x64,0x5b,0x30,0x5d,0x29,0x2c,0x73,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x43,0x61,0x70,0x3d,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x2c,0x73,0x2e,0x73,0x65,0x74,0x4c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x26,0x26,0x73,0x2e,0x73,0x65,0x74,0x4c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x28,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x29,0x2c,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3d,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x4a,0x6f,0x69,0x6e,0x3d,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x2c,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x7c,0x7c,0x63,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x73,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x73,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x68,0x3d,0x2d,0x31,0x2c,0x74,0x3d,0x30,0x3b,0x74,0x3c,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x74,0x29,0x65,0x3d,0x64,0x5b,0x74,0x5d,0x2c,0x6e,0x3d,0x6f,0x2e,0x70,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x49,0x74,0x65,0x6d,0x28,0x64,0x2c,0x74,0x29,0x2c,0x69,0x3d,0x65,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x69,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x28,0x73,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2e,0x78,0x2c,0x69,0x2e,0x79,0x29,0x2c,0x68,0x3d,0x74,0x29,0x3a,0x28,0x6e,0x3d,0x2d,0x31,0x3d,0x3d,0x3d,0x68,0x3f,0x6e,0x3a,0x64,0x5b,0x68,0x5d,0x2c,0x69,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x28,0x68,0x21,0x3d,0x3d,0x74,0x2d,0x31,0x26,0x26,0x21,0x75,0x7c,0x7c,0x2d,0x31,0x3d,0x3d,0x3d,0x68,0x3f,0x73,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2e,0x78,0x2c,0x69,0x2e,0x79,0x29,0x3a,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x73,0x2c,0x6e,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x65,0x2e,0x5f,0x76,0x69,0x65,0x77,0x29,0x2c,0x68,0x3d,0x74,0x29,0x29,0x3b,0x73,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x2c,0x73,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x7d,0x29,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x38,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x21,0x65,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x2d,0x65,0x2e,0x78,0x2c,0x32,0x29,0x3c,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2b,0x65,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x7d,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x72,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x6c,0x3d,0x61,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3b,0x61,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x70,0x6f,0x69,0x6e,0x74,0x3a,0x7b,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x33,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x63,0x69,0x72,0x63,0x6c,0x65,0x22,0x2c,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6c,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6c,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x31,0x2c,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x31,0x2c,0x68,0x6f,0x76,0x65,0x72,0x52,0x61,0x64,0x69,0x75,0x73,0x3a,0x34,0x2c,0x68,0x6f,0x76,0x65,0x72,0x42,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x31,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x21,0x6e,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x2d,0x6e,0x2e,0x78,0x2c,0x32,0x29,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2d,0x6e,0x2e,0x79,0x2c,0x32,0x29,0x3c,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x6e,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2b,0x6e,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x7d,0x2c,0x69,0x6e,0x4c,0x61,0x62,0x65,0x6c,0x52,0x61,0x6e,0x67,0x65,0x3a,0x69,0x2c,0x69,0x6e,0x58,0x52,0x61,0x6e,0x67,0x65,0x3a,0x69,0x2c,0x69,0x6e,0x59,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x21,0x65,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x2d,0x65,0x2e,0x79,0x2c,0x32,0x29,0x3c,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x65,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2b,0x65,0x2e,0x68,0x69,0x74,0x52,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x7d,0x2c,0x67,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x7d,0x7d,0x2c,0x67,0x65,0x74,0x41,0x72,0x65,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2c,0x32,0x29,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x2c,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x74,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2b,0x74,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x7d,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x6f,0x3d,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x73,0x3d,0x65,0x2e,0x72,0x61,0x64,0x69,0x75,0x73,0x2c,0x75,0x3d,0x65,0x2e,0x78,0x2c,0x64,0x3d,0x65,0x2e,0x79,0x2c,0x63,0x3d,0x72,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2c,0x68,0x3d,0x30,0x3b,0x65,0x2e,0x73,0x6b,0x69,0x70,0x7c,0x7c,0x28,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x6c,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x72,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x61,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x6c,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x26,0x26,0x28,0x6e,0x2e,0x78,0x3c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x7c,0x7c,0x31,0x2e,0x30,0x31,0x2a,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3c,0x6e,0x2e,0x78,0x7c,0x7c,0x6e,0x2e,0x79,0x3c,0x74,0x2e,0x74,0x6f,0x70,0x7c,0x7c,0x31,0x2e,0x30,0x31,0x2a,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3c,0x6e,0x2e,0x79,0x29,0x26,0x26,0x28,0x6e,0x2e,0x78,0x3c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x3f,0x68,0x3d,0x28,0x75,0x2d,0x6e,0x2e,0x78,0x29,0x2f,0x28,0x74,0x2e,0x6c,0x65,0x66,0x74,0x2d,0x6e,0x2e,0x78,0x29,0x3a,0x31,0x2e,0x30,0x31,0x2a,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3c,0x6e,0x2e,0x78,0x3f,0x68,0x3d,0x28,0x6e,0x2e,0x78,0x2d,0x75,0x29,0x2f,0x28,0x6e,0x2e,0x78,0x2d,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x3a,0x6e,0x2e,0x79,0x3c,0x74,0x2e,0x74,0x6f,0x70,0x3f,0x68,0x3d,0x28,0x64,0x2d,0x6e,0x2e,0x79,0x29,0x2f,0x28,0x74,0x2e,0x74,0x6f,0x70,0x2d,0x6e,0x2e,0x79,0x29,0x3a,0x31,0x2e,0x30,0x31,0x2a,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3c,0x6e,0x2e,0x79,0x26,0x26,0x28,0x68,0x3d,0x28,0x6e,0x2e,0x79,0x2d,0x64,0x29,0x2f,0x28,0x6e,0x2e,0x79,0x2d,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x29,0x2c,0x68,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x31,0x30,0x30,0x2a,0x68,0x29,0x2f,0x31,0x30,0x30,0x2c,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x63,0x28,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x29,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x68,0x29,0x2e,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x63,0x28,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x29,0x2e,0x61,0x6c,0x70,0x68,0x61,0x28,0x68,0x29,0x2e,0x72,0x67,0x62,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x29,0x2c,0x72,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x64,0x72,0x61,0x77,0x50,0x6f,0x69,0x6e,0x74,0x28,0x69,0x2c,0x6f,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x29,0x29,0x7d,0x7d,0x29,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x33,0x39,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x74,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x69,0x66,0x28,0x69,0x28,0x74,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x72,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x3b,0x65,0x3d,0x72,0x2e,0x78,0x2d,0x6c,0x2c,0x6e,0x3d,0x72,0x2e,0x78,0x2b,0x6c,0x2c,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x2e,0x79,0x2c,0x72,0x2e,0x62,0x61,0x73,0x65,0x29,0x2c,0x6f,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x72,0x2e,0x79,0x2c,0x72,0x2e,0x62,0x61,0x73,0x65,0x29,0x7d,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x72,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x3b,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x2e,0x78,0x2c,0x72,0x2e,0x62,0x61,0x73,0x65,0x29,0x2c,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x72,0x2e,0x78,0x2c,0x72,0x2e,0x62,0x61,0x73,0x65,0x29,0x2c,0x61,0x3d,0x72,0x2e,0x79,0x2d,0x73,0x2c,0x6f,0x3d,0x72,0x2e,0x79,0x2b,0x73,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x65,0x2c,0x74,0x6f,0x70,0x3a,0x61,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x6e,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x6f,0x7d,0x7d,0x76,0x61,0x72,0x20,0x6f,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x72,0x3d,0x74,0x28,0x32,0x36,0x29,0x3b,0x6f,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x3a,0x7b,0x72,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x3a,0x7b,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x6f,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x2c,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3a,0x30,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x72,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x74,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6d,0x5b,0x28,0x62,0x2b,0x74,0x29,0x25,0x34,0x5d,0x7d,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x63,0x68,0x61,0x72,0x74,0x2e,0x63,0x74,0x78,0x2c,0x75,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x64,0x3d,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x3b,0x69,0x66,0x28,0x75,0x2e,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3f,0x28,0x65,0x3d,0x75,0x2e,0x62,0x61,0x73,0x65,0x2c,0x6e,0x3d,0x75,0x2e,0x78,0x2c,0x69,0x3d,0x75,0x2e,0x79,0x2d,0x75,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x2c,0x61,0x3d,0x75,0x2e,0x79,0x2b,0x75,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x2c,0x6f,0x3d,0x6e,0x3e,0x65,0x3f,0x31,0x3a,0x2d,0x31,0x2c,0x72,0x3d,0x31,0x2c,0x6c,0x3d,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x7c,0x7c,0x22,0x6c,0x65,0x66,0x74,0x22,0x29,0x3a,0x28,0x65,0x3d,0x75,0x2e,0x78,0x2d,0x75,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x2c,0x6e,0x3d,0x75,0x2e,0x78,0x2b,0x75,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x2c,0x69,0x3d,0x75,0x2e,0x79,0x2c,0x6f,0x3d,0x31,0x2c,0x72,0x3d,0x28,0x61,0x3d,0x75,0x2e,0x62,0x61,0x73,0x65,0x29,0x3e,0x69,0x3f,0x31,0x3a,0x2d,0x31,0x2c,0x6c,0x3d,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x53,0x6b,0x69,0x70,0x70,0x65,0x64,0x7c,0x7c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x29,0x2c,0x64,0x29,0x7b,0x76,0x61,0x72,0x20,0x63,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x65,0x2d,0x6e,0x29,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x69,0x2d,0x61,0x29,0x29,0x2c,0x68,0x3d,0x28,0x64,0x3d,0x64,0x3e,0x63,0x3f,0x63,0x3a,0x64,0x29,0x2f,0x32,0x2c,0x66,0x3d,0x65,0x2b,0x28,0x22,0x6c,0x65,0x66,0x74,0x22,0x21,0x3d,0x3d,0x6c,0x3f,0x68,0x2a,0x6f,0x3a,0x30,0x29,0x2c,0x67,0x3d,0x6e,0x2b,0x28,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x21,0x3d,0x3d,0x6c,0x3f,0x2d,0x68,0x2a,0x6f,0x3a,0x30,0x29,0x2c,0x70,0x3d,0x69,0x2b,0x28,0x22,0x74,0x6f,0x70,0x22,0x21,0x3d,0x3d,0x6c,0x3f,0x68,0x2a,0x72,0x3a,0x30,0x29,0x2c,0x76,0x3d,0x61,0x2b,0x28,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x21,0x3d,0x3d,0x6c,0x3f,0x2d,0x68,0x2a,0x72,0x3a,0x30,0x29,0x3b,0x66,0x21,0x3d,0x3d,0x67,0x26,0x26,0x28,0x69,0x3d,0x70,0x2c,0x61,0x3d,0x76,0x29,0x2c,0x70,0x21,0x3d,0x3d,0x76,0x26,0x26,0x28,0x65,0x3d,0x66,0x2c,0x6e,0x3d,0x67,0x29,0x7d,0x73,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x73,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x75,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x73,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x75,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x64,0x3b,0x76,0x61,0x72,0x20,0x6d,0x3d,0x5b,0x5b,0x65,0x2c,0x61,0x5d,0x2c,0x5b,0x65,0x2c,0x69,0x5d,0x2c,0x5b,0x6e,0x2c,0x69,0x5d,0x2c,0x5b,0x6e,0x2c,0x61,0x5d,0x5d,0x2c,0x62,0x3d,0x5b,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x2c,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x22,0x74,0x6f,0x70,0x22,0x2c,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x5d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x6c,0x2c,0x30,0x29,0x3b,0x2d,0x31,0x3d,0x3d,0x3d,0x62,0x26,0x26,0x28,0x62,0x3d,0x30,0x29,0x3b,0x76,0x61,0x72,0x20,0x78,0x3d,0x74,0x28,0x30,0x29,0x3b,0x73,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x78,0x5b,0x30,0x5d,0x2c,0x78,0x5b,0x31,0x5d,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x79,0x3d,0x31,0x3b,0x79,0x3c,0x34,0x3b,0x79,0x2b,0x2b,0x29,0x78,0x3d,0x74,0x28,0x79,0x29,0x2c,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x78,0x5b,0x30,0x5d,0x2c,0x78,0x5b,0x31,0x5d,0x29,0x3b,0x73,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x2c,0x64,0x26,0x26,0x73,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x7d,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x62,0x61,0x73,0x65,0x2d,0x74,0x2e,0x79,0x7d,0x2c,0x69,0x6e,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x21,0x31,0x3b,0x69,0x66,0x28,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x61,0x28,0x74,0x68,0x69,0x73,0x29,0x3b,0x6e,0x3d,0x74,0x3e,0x3d,0x69,0x2e,0x6c,0x65,0x66,0x74,0x26,0x26,0x74,0x3c,0x3d,0x69,0x2e,0x72,0x69,0x67,0x68,0x74,0x26,0x26,0x65,0x3e,0x3d,0x69,0x2e,0x74,0x6f,0x70,0x26,0x26,0x65,0x3c,0x3d,0x69,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x7d,0x2c,0x69,0x6e,0x4c,0x61,0x62,0x65,0x6c,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x66,0x28,0x21,0x6e,0x2e,0x5f,0x76,0x69,0x65,0x77,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x61,0x28,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x28,0x6e,0x29,0x3f,0x74,0x3e,0x3d,0x6f,0x2e,0x6c,0x65,0x66,0x74,0x26,0x26,0x74,0x3c,0x3d,0x6f,0x2e,0x72,0x69,0x67,0x68,0x74,0x3a,0x65,0x3e,0x3d,0x6f,0x2e,0x74,0x6f,0x70,0x26,0x26,0x65,0x3c,0x3d,0x6f,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x7d,0x2c,0x69,0x6e,0x58,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x61,0x28,0x74,0x68,0x69,0x73,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3e,0x3d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x26,0x26,0x74,0x3c,0x3d,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x7d,0x2c,0x69,0x6e,0x59,0x52,0x61,0x6e,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x61,0x28,0x74,0x68,0x69,0x73,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3e,0x3d,0x65,0x2e,0x74,0x6f,0x70,0x26,0x26,0x74,0x3c,0x3d,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x7d,0x2c,0x67,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x28,0x74,0x68,0x69,0x73,0x29,0x3f,0x28,0x74,0x3d,0x6e,0x2e,0x78,0x2c,0x65,0x3d,0x28,0x6e,0x2e,0x79,0x2b,0x6e,0x2e,0x62,0x61,0x73,0x65,0x29,0x2f,0x32,0x29,0x3a,0x28,0x74,0x3d,0x28,0x6e,0x2e,0x78,0x2b,0x6e,0x2e,0x62,0x61,0x73,0x65,0x29,0x2f,0x32,0x2c,0x65,0x3d,0x6e,0x2e,0x79,0x29,0x2c,0x7b,0x78,0x3a,0x74,0x2c,0x79,0x3a,0x65,0x7d,0x7d,0x2c,0x67,0x65,0x74,0x41,0x72,0x65,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x61,0x62,0x73,0x28,0x74,0x2e,0x79,0x2d,0x74,0x2e,0x62,0x61,0x73,0x65,0x29,0x7d,0x2c,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x5f,0x76,0x69,0x65,0x77,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x74,0x2e,0x78,0x2c,0x79,0x3a,0x74,0x2e,0x79,0x7d,0x7d,0x7d,0x29,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x7d,0x5d,0x2c,0x34,0x30,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x7d,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x41,0x72,0x63,0x3d,0x74,0x28,0x33,0x36,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x4c,0x69,0x6e,0x65,0x3d,0x74,0x28,0x33,0x37,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x50,0x6f,0x69,0x6e,0x74,0x3d,0x74,0x28,0x33,0x38,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x52,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x3d,0x74,0x28,0x33,0x39,0x29,0x7d,0x2c,0x7b,0x33,0x36,0x3a,0x33,0x36,0x2c,0x33,0x37,0x3a,0x33,0x37,0x2c,0x33,0x38,0x3a,0x33,0x38,0x2c,0x33,0x39,0x3a,0x33,0x39,0x7d,0x5d,0x2c,0x34,0x31,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x32,0x29,0x2c,0x6e,0x3d,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x63,0x6c,0x65,0x61,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x63,0x74,0x78,0x2e,0x63,0x6c,0x65,0x61,0x72,0x52,0x65,0x63,0x74,0x28,0x30,0x2c,0x30,0x2c,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x7d,0x2c,0x72,0x6f,0x75,0x6e,0x64,0x65,0x64,0x52,0x65,0x63,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x29,0x7b,0x69,0x66,0x28,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6f,0x2c,0x69,0x2f,0x32,0x29,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6f,0x2c,0x61,0x2f,0x32,0x29,0x3b,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x65,0x2b,0x72,0x2c,0x6e,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x65,0x2b,0x69,0x2d,0x72,0x2c,0x6e,0x29,0x2c,0x74,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x65,0x2b,0x69,0x2c,0x6e,0x2c,0x65,0x2b,0x69,0x2c,0x6e,0x2b,0x6c,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x65,0x2b,0x69,0x2c,0x6e,0x2b,0x61,0x2d,0x6c,0x29,0x2c,0x74,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x65,0x2b,0x69,0x2c,0x6e,0x2b,0x61,0x2c,0x65,0x2b,0x69,0x2d,0x72,0x2c,0x6e,0x2b,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x65,0x2b,0x72,0x2c,0x6e,0x2b,0x61,0x29,0x2c,0x74,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x65,0x2c,0x6e,0x2b,0x61,0x2c,0x65,0x2c,0x6e,0x2b,0x61,0x2d,0x6c,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x65,0x2c,0x6e,0x2b,0x6c,0x29,0x2c,0x74,0x2e,0x71,0x75,0x61,0x64,0x72,0x61,0x74,0x69,0x63,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x65,0x2c,0x6e,0x2c,0x65,0x2b,0x72,0x2c,0x6e,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x74,0x2e,0x72,0x65,0x63,0x74,0x28,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x50,0x6f,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x3b,0x69,0x66,0x28,0x21,0x65,0x7c,0x7c,0x22,0x6f,0x62,0x6a,0x65,0x63,0x74,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x7c,0x7c,0x22,0x5b,0x6f,0x62,0x6a,0x65,0x63,0x74,0x20,0x48,0x54,0x4d,0x4c,0x49,0x6d,0x61,0x67,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x5d,0x22,0x21,0x3d,0x3d,0x28,0x6f,0x3d,0x65,0x2e,0x74,0x6f,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x29,0x26,0x26,0x22,0x5b,0x6f,0x62,0x6a,0x65,0x63,0x74,0x20,0x48,0x54,0x4d,0x4c,0x43,0x61,0x6e,0x76,0x61,0x73,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x5d,0x22,0x21,0x3d,0x3d,0x6f,0x29,0x7b,0x69,0x66,0x28,0x21,0x28,0x69,0x73,0x4e,0x61,0x4e,0x28,0x6e,0x29,0x7c,0x7c,0x6e,0x3c,0x3d,0x30,0x29,0x29,0x7b,0x73,0x77,0x69,0x74,0x63,0x68,0x28,0x65,0x29,0x7b,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x61,0x72,0x63,0x28,0x69,0x2c,0x61,0x2c,0x6e,0x2c,0x30,0x2c,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x74,0x72,0x69,0x61,0x6e,0x67,0x6c,0x65,0x22,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x75,0x3d,0x28,0x72,0x3d,0x33,0x2a,0x6e,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x33,0x29,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x33,0x29,0x2f,0x32,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x72,0x2f,0x32,0x2c,0x61,0x2b,0x75,0x2f,0x33,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x72,0x2f,0x32,0x2c,0x61,0x2b,0x75,0x2f,0x33,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2d,0x32,0x2a,0x75,0x2f,0x33,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x72,0x65,0x63,0x74,0x22,0x3a,0x64,0x3d,0x31,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x2a,0x6e,0x2c,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x52,0x65,0x63,0x74,0x28,0x69,0x2d,0x64,0x2c,0x61,0x2d,0x64,0x2c,0x32,0x2a,0x64,0x2c,0x32,0x2a,0x64,0x29,0x2c,0x74,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x52,0x65,0x63,0x74,0x28,0x69,0x2d,0x64,0x2c,0x61,0x2d,0x64,0x2c,0x32,0x2a,0x64,0x2c,0x32,0x2a,0x64,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x72,0x65,0x63,0x74,0x52,0x6f,0x75,0x6e,0x64,0x65,0x64,0x22,0x3a,0x76,0x61,0x72,0x20,0x63,0x3d,0x6e,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x2c,0x68,0x3d,0x69,0x2d,0x63,0x2c,0x66,0x3d,0x61,0x2d,0x63,0x2c,0x67,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x2a,0x6e,0x3b,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x65,0x64,0x52,0x65,0x63,0x74,0x28,0x74,0x2c,0x68,0x2c,0x66,0x2c,0x67,0x2c,0x67,0x2c,0x6e,0x2f,0x32,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x72,0x65,0x63,0x74,0x52,0x6f,0x74,0x22,0x3a,0x64,0x3d,0x31,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x2a,0x6e,0x2c,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x64,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2b,0x64,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x64,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2d,0x64,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x63,0x72,0x6f,0x73,0x73,0x22,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2b,0x6e,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2d,0x6e,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6e,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6e,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x63,0x72,0x6f,0x73,0x73,0x52,0x6f,0x74,0x22,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x34,0x29,0x2a,0x6e,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x34,0x29,0x2a,0x6e,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6c,0x2c,0x61,0x2d,0x73,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6c,0x2c,0x61,0x2b,0x73,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6c,0x2c,0x61,0x2b,0x73,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6c,0x2c,0x61,0x2d,0x73,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x73,0x74,0x61,0x72,0x22,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2b,0x6e,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x2d,0x6e,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6e,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6e,0x2c,0x61,0x29,0x2c,0x6c,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x34,0x29,0x2a,0x6e,0x2c,0x73,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x34,0x29,0x2a,0x6e,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6c,0x2c,0x61,0x2d,0x73,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6c,0x2c,0x61,0x2b,0x73,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6c,0x2c,0x61,0x2b,0x73,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6c,0x2c,0x61,0x2d,0x73,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x6c,0x69,0x6e,0x65,0x22,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2d,0x6e,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6e,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x64,0x61,0x73,0x68,0x22,0x3a,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x69,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x69,0x2b,0x6e,0x2c,0x61,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x7d,0x74,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x7d,0x7d,0x65,0x6c,0x73,0x65,0x20,0x74,0x2e,0x64,0x72,0x61,0x77,0x49,0x6d,0x61,0x67,0x65,0x28,0x65,0x2c,0x69,0x2d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x2c,0x61,0x2d,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x2c,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x7d,0x2c,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x74,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x72,0x65,0x63,0x74,0x28,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x65,0x2e,0x74,0x6f,0x70,0x2c,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x2d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x65,0x2e,0x74,0x6f,0x70,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x69,0x70,0x28,0x29,0x7d,0x2c,0x75,0x6e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x2c,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x69,0x66,0x28,0x6e,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x61,0x66,0x74,0x65,0x72,0x22,0x3d,0x3d,0x3d,0x6e,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x26,0x26,0x21,0x69,0x7c,0x7c,0x22,0x61,0x66,0x74,0x65,0x72,0x22,0x21,0x3d,0x3d,0x6e,0x2e,0x73,0x74,0x65,0x70,0x70,0x65,0x64,0x4c,0x69,0x6e,0x65,0x26,0x26,0x69,0x3f,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x65,0x2e,0x78,0x2c,0x6e,0x2e,0x79,0x29,0x3a,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x6e,0x2e,0x78,0x2c,0x65,0x2e,0x79,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x6e,0x2e,0x78,0x2c,0x6e,0x2e,0x79,0x29,0x3b,0x6e,0x2e,0x74,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x3f,0x74,0x2e,0x62,0x65,0x7a,0x69,0x65,0x72,0x43,0x75,0x72,0x76,0x65,0x54,0x6f,0x28,0x69,0x3f,0x65,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x3a,0x65,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x2c,0x69,0x3f,0x65,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x3a,0x65,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x2c,0x69,0x3f,0x6e,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x58,0x3a,0x6e,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x58,0x2c,0x69,0x3f,0x6e,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x4e,0x65,0x78,0x74,0x59,0x3a,0x6e,0x2e,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x50,0x6f,0x69,0x6e,0x74,0x50,0x72,0x65,0x76,0x69,0x6f,0x75,0x73,0x59,0x2c,0x6e,0x2e,0x78,0x2c,0x6e,0x2e,0x79,0x29,0x3a,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x6e,0x2e,0x78,0x2c,0x6e,0x2e,0x79,0x29,0x7d,0x7d,0x3b,0x69,0x2e,0x63,0x6c,0x65,0x61,0x72,0x3d,0x6e,0x2e,0x63,0x6c,0x65,0x61,0x72,0x2c,0x69,0x2e,0x64,0x72,0x61,0x77,0x52,0x6f,0x75,0x6e,0x64,0x65,0x64,0x52,0x65,0x63,0x74,0x61,0x6e,0x67,0x6c,0x65,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x6e,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x65,0x64,0x52,0x65,0x63,0x74,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x6e,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x7d,0x7d,0x2c,0x7b,0x34,0x32,0x3a,0x34,0x32,0x7d,0x5d,0x2c,0x34,0x32,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x7b,0x6e,0x6f,0x6f,0x70,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x7d,0x2c,0x75,0x69,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2b,0x2b,0x7d,0x7d,0x28,0x29,0x2c,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x74,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x7d,0x2c,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x3a,0x41,0x72,0x72,0x61,0x79,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x3f,0x41,0x72,0x72,0x61,0x79,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x5b,0x6f,0x62,0x6a,0x65,0x63,0x74,0x20,0x41,0x72,0x72,0x61,0x79,0x5d,0x22,0x3d,0x3d,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x74,0x6f,0x53,0x74,0x72,0x69,0x6e,0x67,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x29,0x7d,0x2c,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x74,0x26,0x26,0x22,0x5b,0x6f,0x62,0x6a,0x65,0x63,0x74,0x20,0x4f,0x62,0x6a,0x65,0x63,0x74,0x5d,0x22,0x3d,0x3d,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x74,0x6f,0x53,0x74,0x72,0x69,0x6e,0x67,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x29,0x7d,0x2c,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x65,0x3a,0x74,0x7d,0x2c,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x69,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x3f,0x74,0x5b,0x65,0x5d,0x3a,0x74,0x2c,0x6e,0x29,0x7d,0x2c,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x69,0x66,0x28,0x74,0x26,0x26,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x2e,0x63,0x61,0x6c,0x6c,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x6e,0x2c,0x65,0x29,0x7d,0x2c,0x65,0x61,0x63,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x2c,0x72,0x2c,0x6c,0x3b,0x69,0x66,0x28,0x69,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x29,0x69,0x66,0x28,0x72,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x61,0x29,0x66,0x6f,0x72,0x28,0x6f,0x3d,0x72,0x2d,0x31,0x3b,0x6f,0x3e,0x3d,0x30,0x3b,0x6f,0x2d,0x2d,0x29,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x6e,0x2c,0x74,0x5b,0x6f,0x5d,0x2c,0x6f,0x29,0x3b,0x65,0x6c,0x73,0x65,0x20,0x66,0x6f,0x72,0x28,0x6f,0x3d,0x30,0x3b,0x6f,0x3c,0x72,0x3b,0x6f,0x2b,0x2b,0x29,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x6e,0x2c,0x74,0x5b,0x6f,0x5d,0x2c,0x6f,0x29,0x3b,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x74,0x29,0x29,0x66,0x6f,0x72,0x28,0x72,0x3d,0x28,0x6c,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x6b,0x65,0x79,0x73,0x28,0x74,0x29,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x6f,0x3d,0x30,0x3b,0x6f,0x3c,0x72,0x3b,0x6f,0x2b,0x2b,0x29,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x6e,0x2c,0x74,0x5b,0x6c,0x5b,0x6f,0x5d,0x5d,0x2c,0x6c,0x5b,0x6f,0x5d,0x29,0x7d,0x2c,0x61,0x72,0x72,0x61,0x79,0x45,0x71,0x75,0x61,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3b,0x69,0x66,0x28,0x21,0x74,0x7c,0x7c,0x21,0x65,0x7c,0x7c,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x21,0x3d,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x61,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x61,0x3b,0x2b,0x2b,0x6e,0x29,0x69,0x66,0x28,0x6f,0x3d,0x74,0x5b,0x6e,0x5d,0x2c,0x72,0x3d,0x65,0x5b,0x6e,0x5d,0x2c,0x6f,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x41,0x72,0x72,0x61,0x79,0x26,0x26,0x72,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x41,0x72,0x72,0x61,0x79,0x29,0x7b,0x69,0x66,0x28,0x21,0x69,0x2e,0x61,0x72,0x72,0x61,0x79,0x45,0x71,0x75,0x61,0x6c,0x73,0x28,0x6f,0x2c,0x72,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x28,0x6f,0x21,0x3d,0x3d,0x72,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x30,0x7d,0x2c,0x63,0x6c,0x6f,0x6e,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x69,0x66,0x28,0x69,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x74,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x6d,0x61,0x70,0x28,0x69,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x29,0x3b,0x69,0x66,0x28,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x74,0x29,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x7b,0x7d,0x2c,0x6e,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x6b,0x65,0x79,0x73,0x28,0x74,0x29,0x2c,0x61,0x3d,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x6f,0x3d,0x30,0x3b,0x6f,0x3c,0x61,0x3b,0x2b,0x2b,0x6f,0x29,0x65,0x5b,0x6e,0x5b,0x6f,0x5d,0x5d,0x3d,0x69,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x74,0x5b,0x6e,0x5b,0x6f,0x5d,0x5d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x5f,0x6d,0x65,0x72,0x67,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x65,0x5b,0x74,0x5d,0x2c,0x72,0x3d,0x6e,0x5b,0x74,0x5d,0x3b,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x6f,0x29,0x26,0x26,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x72,0x29,0x3f,0x69,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x6f,0x2c,0x72,0x2c,0x61,0x29,0x3a,0x65,0x5b,0x74,0x5d,0x3d,0x69,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x72,0x29,0x7d,0x2c,0x5f,0x6d,0x65,0x72,0x67,0x65,0x72,0x49,0x66,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x65,0x5b,0x74,0x5d,0x2c,0x6f,0x3d,0x6e,0x5b,0x74,0x5d,0x3b,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x61,0x29,0x26,0x26,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x6f,0x29,0x3f,0x69,0x2e,0x6d,0x65,0x72,0x67,0x65,0x49,0x66,0x28,0x61,0x2c,0x6f,0x29,0x3a,0x65,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x74,0x29,0x7c,0x7c,0x28,0x65,0x5b,0x74,0x5d,0x3d,0x69,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x6f,0x29,0x29,0x7d,0x2c,0x6d,0x65,0x72,0x67,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x3d,0x69,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x3f,0x65,0x3a,0x5b,0x65,0x5d,0x2c,0x64,0x3d,0x75,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x69,0x66,0x28,0x21,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x74,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x28,0x6e,0x3d,0x6e,0x7c,0x7c,0x7b,0x7d,0x29,0x2e,0x6d,0x65,0x72,0x67,0x65,0x72,0x7c,0x7c,0x69,0x2e,0x5f,0x6d,0x65,0x72,0x67,0x65,0x72,0x2c,0x6f,0x3d,0x30,0x3b,0x6f,0x3c,0x64,0x3b,0x2b,0x2b,0x6f,0x29,0x69,0x66,0x28,0x65,0x3d,0x75,0x5b,0x6f,0x5d,0x2c,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x65,0x29,0x29,0x66,0x6f,0x72,0x28,0x73,0x3d,0x30,0x2c,0x6c,0x3d,0x28,0x72,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x6b,0x65,0x79,0x73,0x28,0x65,0x29,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x73,0x3c,0x6c,0x3b,0x2b,0x2b,0x73,0x29,0x61,0x28,0x72,0x5b,0x73,0x5d,0x2c,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x6d,0x65,0x72,0x67,0x65,0x49,0x66,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x6d,0x65,0x72,0x67,0x65,0x28,0x74,0x2c,0x65,0x2c,0x7b,0x6d,0x65,0x72,0x67,0x65,0x72,0x3a,0x69,0x2e,0x5f,0x6d,0x65,0x72,0x67,0x65,0x72,0x49,0x66,0x7d,0x29,0x7d,0x2c,0x65,0x78,0x74,0x65,0x6e,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2c,0x6e,0x3d,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x5b,0x65,0x5d,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x74,0x5b,0x6e,0x5d,0x3d,0x65,0x7d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x69,0x6e,0x68,0x65,0x72,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x74,0x26,0x26,0x74,0x2e,0x68,0x61,0x73,0x4f,0x77,0x6e,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x22,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x22,0x29,0x3f,0x74,0x2e,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x74,0x68,0x69,0x73,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x61,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x63,0x6f,0x6e,0x73,0x74,0x72,0x75,0x63,0x74,0x6f,0x72,0x3d,0x6e,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x3d,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x6e,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x3d,0x6e,0x65,0x77,0x20,0x61,0x2c,0x6e,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x3d,0x69,0x2e,0x69,0x6e,0x68,0x65,0x72,0x69,0x74,0x73,0x2c,0x74,0x26,0x26,0x69,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x6e,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x74,0x29,0x2c,0x6e,0x2e,0x5f,0x5f,0x73,0x75,0x70,0x65,0x72,0x5f,0x5f,0x3d,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2c,0x6e,0x7d,0x7d,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x69,0x2c,0x69,0x2e,0x63,0x61,0x6c,0x6c,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3d,0x69,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x2c,0x69,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7d,0x2c,0x69,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3d,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x69,0x2e,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3d,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x34,0x33,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x32,0x29,0x2c,0x61,0x3d,0x7b,0x6c,0x69,0x6e,0x65,0x61,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x51,0x75,0x61,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x74,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x51,0x75,0x61,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2d,0x74,0x2a,0x28,0x74,0x2d,0x32,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x51,0x75,0x61,0x64,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x2e,0x35,0x2a,0x74,0x2a,0x74,0x3a,0x2d,0x2e,0x35,0x2a,0x28,0x2d,0x2d,0x74,0x2a,0x28,0x74,0x2d,0x32,0x29,0x2d,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x43,0x75,0x62,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x74,0x2a,0x74,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x43,0x75,0x62,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2d,0x3d,0x31,0x29,0x2a,0x74,0x2a,0x74,0x2b,0x31,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x43,0x75,0x62,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x2e,0x35,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x3a,0x2e,0x35,0x2a,0x28,0x28,0x74,0x2d,0x3d,0x32,0x29,0x2a,0x74,0x2a,0x74,0x2b,0x32,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x51,0x75,0x61,0x72,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x51,0x75,0x61,0x72,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2d,0x28,0x28,0x74,0x2d,0x3d,0x31,0x29,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2d,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x51,0x75,0x61,0x72,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x2e,0x35,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x3a,0x2d,0x2e,0x35,0x2a,0x28,0x28,0x74,0x2d,0x3d,0x32,0x29,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2d,0x32,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x51,0x75,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x51,0x75,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2d,0x3d,0x31,0x29,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2b,0x31,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x51,0x75,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x2e,0x35,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x3a,0x2e,0x35,0x2a,0x28,0x28,0x74,0x2d,0x3d,0x32,0x29,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2a,0x74,0x2b,0x32,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x53,0x69,0x6e,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x74,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x32,0x29,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x53,0x69,0x6e,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x74,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x32,0x29,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x53,0x69,0x6e,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2d,0x2e,0x35,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x74,0x29,0x2d,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x45,0x78,0x70,0x6f,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x30,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x31,0x30,0x2a,0x28,0x74,0x2d,0x31,0x29,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x45,0x78,0x70,0x6f,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x3d,0x3d,0x3d,0x74,0x3f,0x31,0x3a,0x31,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x2d,0x31,0x30,0x2a,0x74,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x45,0x78,0x70,0x6f,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x30,0x3a,0x31,0x3d,0x3d,0x3d,0x74,0x3f,0x31,0x3a,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x2e,0x35,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x31,0x30,0x2a,0x28,0x74,0x2d,0x31,0x29,0x29,0x3a,0x2e,0x35,0x2a,0x28,0x32,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x2d,0x31,0x30,0x2a,0x2d,0x2d,0x74,0x29,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x43,0x69,0x72,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3e,0x3d,0x31,0x3f,0x74,0x3a,0x2d,0x28,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x31,0x2d,0x74,0x2a,0x74,0x29,0x2d,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x43,0x69,0x72,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x31,0x2d,0x28,0x74,0x2d,0x3d,0x31,0x29,0x2a,0x74,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x43,0x69,0x72,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x2d,0x2e,0x35,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x31,0x2d,0x74,0x2a,0x74,0x29,0x2d,0x31,0x29,0x3a,0x2e,0x35,0x2a,0x28,0x4d,0x61,0x74,0x68,0x2e,0x73,0x71,0x72,0x74,0x28,0x31,0x2d,0x28,0x74,0x2d,0x3d,0x32,0x29,0x2a,0x74,0x29,0x2b,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x45,0x6c,0x61,0x73,0x74,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2e,0x37,0x30,0x31,0x35,0x38,0x2c,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x30,0x3a,0x31,0x3d,0x3d,0x3d,0x74,0x3f,0x31,0x3a,0x28,0x6e,0x7c,0x7c,0x28,0x6e,0x3d,0x2e,0x33,0x29,0x2c,0x69,0x3c,0x31,0x3f,0x28,0x69,0x3d,0x31,0x2c,0x65,0x3d,0x6e,0x2f,0x34,0x29,0x3a,0x65,0x3d,0x6e,0x2f,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x61,0x73,0x69,0x6e,0x28,0x31,0x2f,0x69,0x29,0x2c,0x2d,0x69,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x31,0x30,0x2a,0x28,0x74,0x2d,0x3d,0x31,0x29,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x28,0x74,0x2d,0x65,0x29,0x2a,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2f,0x6e,0x29,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x45,0x6c,0x61,0x73,0x74,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2e,0x37,0x30,0x31,0x35,0x38,0x2c,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x30,0x3a,0x31,0x3d,0x3d,0x3d,0x74,0x3f,0x31,0x3a,0x28,0x6e,0x7c,0x7c,0x28,0x6e,0x3d,0x2e,0x33,0x29,0x2c,0x69,0x3c,0x31,0x3f,0x28,0x69,0x3d,0x31,0x2c,0x65,0x3d,0x6e,0x2f,0x34,0x29,0x3a,0x65,0x3d,0x6e,0x2f,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x61,0x73,0x69,0x6e,0x28,0x31,0x2f,0x69,0x29,0x2c,0x69,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x2d,0x31,0x30,0x2a,0x74,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x28,0x74,0x2d,0x65,0x29,0x2a,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2f,0x6e,0x29,0x2b,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x45,0x6c,0x61,0x73,0x74,0x69,0x63,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2e,0x37,0x30,0x31,0x35,0x38,0x2c,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x31,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x30,0x3a,0x32,0x3d,0x3d,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3f,0x31,0x3a,0x28,0x6e,0x7c,0x7c,0x28,0x6e,0x3d,0x2e,0x34,0x35,0x29,0x2c,0x69,0x3c,0x31,0x3f,0x28,0x69,0x3d,0x31,0x2c,0x65,0x3d,0x6e,0x2f,0x34,0x29,0x3a,0x65,0x3d,0x6e,0x2f,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x61,0x73,0x69,0x6e,0x28,0x31,0x2f,0x69,0x29,0x2c,0x74,0x3c,0x31,0x3f,0x69,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x31,0x30,0x2a,0x28,0x74,0x2d,0x3d,0x31,0x29,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x28,0x74,0x2d,0x65,0x29,0x2a,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2f,0x6e,0x29,0x2a,0x2d,0x2e,0x35,0x3a,0x69,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x32,0x2c,0x2d,0x31,0x30,0x2a,0x28,0x74,0x2d,0x3d,0x31,0x29,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x28,0x74,0x2d,0x65,0x29,0x2a,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2f,0x6e,0x29,0x2a,0x2e,0x35,0x2b,0x31,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x42,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2e,0x37,0x30,0x31,0x35,0x38,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x74,0x2a,0x28,0x28,0x65,0x2b,0x31,0x29,0x2a,0x74,0x2d,0x65,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x42,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2e,0x37,0x30,0x31,0x35,0x38,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2d,0x3d,0x31,0x29,0x2a,0x74,0x2a,0x28,0x28,0x65,0x2b,0x31,0x29,0x2a,0x74,0x2b,0x65,0x29,0x2b,0x31,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x42,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x31,0x2e,0x37,0x30,0x31,0x35,0x38,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x28,0x74,0x2f,0x3d,0x2e,0x35,0x29,0x3c,0x31,0x3f,0x74,0x2a,0x74,0x2a,0x28,0x28,0x31,0x2b,0x28,0x65,0x2a,0x3d,0x31,0x2e,0x35,0x32,0x35,0x29,0x29,0x2a,0x74,0x2d,0x65,0x29,0x2a,0x2e,0x35,0x3a,0x2e,0x35,0x2a,0x28,0x28,0x74,0x2d,0x3d,0x32,0x29,0x2a,0x74,0x2a,0x28,0x28,0x31,0x2b,0x28,0x65,0x2a,0x3d,0x31,0x2e,0x35,0x32,0x35,0x29,0x29,0x2a,0x74,0x2b,0x65,0x29,0x2b,0x32,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x42,0x6f,0x75,0x6e,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x2d,0x61,0x2e,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x42,0x6f,0x75,0x6e,0x63,0x65,0x28,0x31,0x2d,0x74,0x29,0x7d,0x2c,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x42,0x6f,0x75,0x6e,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3c,0x31,0x2f,0x32,0x2e,0x37,0x35,0x3f,0x37,0x2e,0x35,0x36,0x32,0x35,0x2a,0x74,0x2a,0x74,0x3a,0x74,0x3c,0x32,0x2f,0x32,0x2e,0x37,0x35,0x3f,0x37,0x2e,0x35,0x36,0x32,0x35,0x2a,0x28,0x74,0x2d,0x3d,0x31,0x2e,0x35,0x2f,0x32,0x2e,0x37,0x35,0x29,0x2a,0x74,0x2b,0x2e,0x37,0x35,0x3a,0x74,0x3c,0x32,0x2e,0x35,0x2f,0x32,0x2e,0x37,0x35,0x3f,0x37,0x2e,0x35,0x36,0x32,0x35,0x2a,0x28,0x74,0x2d,0x3d,0x32,0x2e,0x32,0x35,0x2f,0x32,0x2e,0x37,0x35,0x29,0x2a,0x74,0x2b,0x2e,0x39,0x33,0x37,0x35,0x3a,0x37,0x2e,0x35,0x36,0x32,0x35,0x2a,0x28,0x74,0x2d,0x3d,0x32,0x2e,0x36,0x32,0x35,0x2f,0x32,0x2e,0x37,0x35,0x29,0x2a,0x74,0x2b,0x2e,0x39,0x38,0x34,0x33,0x37,0x35,0x7d,0x2c,0x65,0x61,0x73,0x65,0x49,0x6e,0x4f,0x75,0x74,0x42,0x6f,0x75,0x6e,0x63,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3c,0x2e,0x35,0x3f,0x2e,0x35,0x2a,0x61,0x2e,0x65,0x61,0x73,0x65,0x49,0x6e,0x42,0x6f,0x75,0x6e,0x63,0x65,0x28,0x32,0x2a,0x74,0x29,0x3a,0x2e,0x35,0x2a,0x61,0x2e,0x65,0x61,0x73,0x65,0x4f,0x75,0x74,0x42,0x6f,0x75,0x6e,0x63,0x65,0x28,0x32,0x2a,0x74,0x2d,0x31,0x29,0x2b,0x2e,0x35,0x7d,0x7d,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x65,0x66,0x66,0x65,0x63,0x74,0x73,0x3a,0x61,0x7d,0x2c,0x69,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x45,0x66,0x66,0x65,0x63,0x74,0x73,0x3d,0x61,0x7d,0x2c,0x7b,0x34,0x32,0x3a,0x34,0x32,0x7d,0x5d,0x2c,0x34,0x34,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x32,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x74,0x6f,0x4c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x28,0x22,0x22,0x2b,0x74,0x29,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x28,0x6e,0x6f,0x72,0x6d,0x61,0x6c,0x7c,0x28,0x5c,0x64,0x2b,0x28,0x3f,0x3a,0x5c,0x2e,0x5c,0x64,0x2b,0x29,0x3f,0x29,0x28,0x70,0x78,0x7c,0x65,0x6d,0x7c,0x25,0x29,0x3f,0x29,0x24,0x2f,0x29,0x3b,0x69,0x66,0x28,0x21,0x6e,0x7c,0x7c,0x22,0x6e,0x6f,0x72,0x6d,0x61,0x6c,0x22,0x3d,0x3d,0x3d,0x6e,0x5b,0x31,0x5d,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x31,0x2e,0x32,0x2a,0x65,0x3b,0x73,0x77,0x69,0x74,0x63,0x68,0x28,0x74,0x3d,0x2b,0x6e,0x5b,0x32,0x5d,0x2c,0x6e,0x5b,0x33,0x5d,0x29,0x7b,0x63,0x61,0x73,0x65,0x22,0x70,0x78,0x22,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3b,0x63,0x61,0x73,0x65,0x22,0x25,0x22,0x3a,0x74,0x2f,0x3d,0x31,0x30,0x30,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2a,0x74,0x7d,0x2c,0x74,0x6f,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x61,0x2c,0x6f,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x74,0x29,0x3f,0x28,0x65,0x3d,0x2b,0x74,0x2e,0x74,0x6f,0x70,0x7c,0x7c,0x30,0x2c,0x6e,0x3d,0x2b,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x7c,0x7c,0x30,0x2c,0x61,0x3d,0x2b,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x7c,0x7c,0x30,0x2c,0x6f,0x3d,0x2b,0x74,0x2e,0x6c,0x65,0x66,0x74,0x7c,0x7c,0x30,0x29,0x3a,0x65,0x3d,0x6e,0x3d,0x61,0x3d,0x6f,0x3d,0x2b,0x74,0x7c,0x7c,0x30,0x2c,0x7b,0x74,0x6f,0x70,0x3a,0x65,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x6e,0x2c,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x61,0x2c,0x6c,0x65,0x66,0x74,0x3a,0x6f,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x65,0x2b,0x61,0x2c,0x77,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2b,0x6e,0x7d,0x7d,0x2c,0x72,0x65,0x73,0x6f,0x6c,0x76,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x6f,0x3b,0x2b,0x2b,0x61,0x29,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x28,0x72,0x3d,0x74,0x5b,0x61,0x5d,0x29,0x26,0x26,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x26,0x26,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x26,0x26,0x28,0x72,0x3d,0x72,0x28,0x65,0x29,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6e,0x26,0x26,0x69,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x72,0x29,0x26,0x26,0x28,0x72,0x3d,0x72,0x5b,0x6e,0x5d,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x72,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x7d,0x7d,0x7d,0x2c,0x7b,0x34,0x32,0x3a,0x34,0x32,0x7d,0x5d,0x2c,0x34,0x35,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x74,0x28,0x34,0x32,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x65,0x61,0x73,0x69,0x6e,0x67,0x3d,0x74,0x28,0x34,0x33,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3d,0x74,0x28,0x34,0x31,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x74,0x28,0x34,0x34,0x29,0x7d,0x2c,0x7b,0x34,0x31,0x3a,0x34,0x31,0x2c,0x34,0x32,0x3a,0x34,0x32,0x2c,0x34,0x33,0x3a,0x34,0x33,0x2c,0x34,0x34,0x3a,0x34,0x34,0x7d,0x5d,0x2c,0x34,0x36,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x61,0x63,0x71,0x75,0x69,0x72,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x26,0x26,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x26,0x26,0x28,0x74,0x3d,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x29,0x2c,0x74,0x26,0x26,0x74,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x28,0x22,0x32,0x64,0x22,0x29,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x7d,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x34,0x37,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x76,0x2e,0x67,0x65,0x74,0x53,0x74,0x79,0x6c,0x65,0x28,0x74,0x2c,0x65,0x29,0x2c,0x69,0x3d,0x6e,0x26,0x26,0x6e,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x5e,0x28,0x5c,0x64,0x2b,0x29,0x28,0x5c,0x2e,0x5c,0x64,0x2b,0x29,0x3f,0x70,0x78,0x24,0x2f,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x3f,0x4e,0x75,0x6d,0x62,0x65,0x72,0x28,0x69,0x5b,0x31,0x5d,0x29,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2c,0x61,0x3d,0x74,0x2e,0x67,0x65,0x74,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x28,0x22,0x68,0x65,0x69,0x67,0x68,0x74,0x22,0x29,0x2c,0x6f,0x3d,0x74,0x2e,0x67,0x65,0x74,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x28,0x22,0x77,0x69,0x64,0x74,0x68,0x22,0x29,0x3b,0x69,0x66,0x28,0x74,0x5b,0x6d,0x5d,0x3d,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x3a,0x7b,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x61,0x2c,0x77,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2c,0x73,0x74,0x79,0x6c,0x65,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x6e,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x77,0x69,0x64,0x74,0x68,0x3a,0x6e,0x2e,0x77,0x69,0x64,0x74,0x68,0x7d,0x7d,0x7d,0x2c,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3d,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x7c,0x7c,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0x2c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x6f,0x7c,0x7c,0x22,0x22,0x3d,0x3d,0x3d,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x69,0x28,0x74,0x2c,0x22,0x77,0x69,0x64,0x74,0x68,0x22,0x29,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x72,0x26,0x26,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x72,0x29,0x7d,0x69,0x66,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x61,0x7c,0x7c,0x22,0x22,0x3d,0x3d,0x3d,0x61,0x29,0x69,0x66,0x28,0x22,0x22,0x3d,0x3d,0x3d,0x74,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x28,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x61,0x73,0x70,0x65,0x63,0x74,0x52,0x61,0x74,0x69,0x6f,0x7c,0x7c,0x32,0x29,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x69,0x28,0x74,0x2c,0x22,0x68,0x65,0x69,0x67,0x68,0x74,0x22,0x29,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x72,0x26,0x26,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x6c,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6f,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x74,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x65,0x2c,0x6e,0x2c,0x4d,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x74,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x65,0x2c,0x6e,0x2c,0x4d,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x74,0x79,0x70,0x65,0x3a,0x74,0x2c,0x63,0x68,0x61,0x72,0x74,0x3a,0x65,0x2c,0x6e,0x61,0x74,0x69,0x76,0x65,0x3a,0x61,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x2c,0x78,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6e,0x3f,0x6e,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x79,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x69,0x3f,0x69,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x77,0x5b,0x74,0x2e,0x74,0x79,0x70,0x65,0x5d,0x7c,0x7c,0x74,0x2e,0x74,0x79,0x70,0x65,0x2c,0x69,0x3d,0x76,0x2e,0x67,0x65,0x74,0x52,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6c,0x28,0x6e,0x2c,0x65,0x2c,0x69,0x2e,0x78,0x2c,0x69,0x2e,0x79,0x2c,0x74,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x21,0x31,0x2c,0x69,0x3d,0x5b,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x69,0x3d,0x41,0x72,0x72,0x61,0x79,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x2c,0x65,0x3d,0x65,0x7c,0x7c,0x74,0x68,0x69,0x73,0x2c,0x6e,0x7c,0x7c,0x28,0x6e,0x3d,0x21,0x30,0x2c,0x76,0x2e,0x72,0x65,0x71,0x75,0x65,0x73,0x74,0x41,0x6e,0x69,0x6d,0x46,0x72,0x61,0x6d,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x6e,0x3d,0x21,0x31,0x2c,0x74,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x65,0x2c,0x69,0x29,0x7d,0x29,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x64,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0x2c,0x6e,0x3d,0x62,0x2b,0x22,0x73,0x69,0x7a,0x65,0x2d,0x6d,0x6f,0x6e,0x69,0x74,0x6f,0x72,0x22,0x2c,0x69,0x3d,0x22,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x3b,0x74,0x6f,0x70,0x3a,0x30,0x3b,0x72,0x69,0x67,0x68,0x74,0x3a,0x30,0x3b,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x30,0x3b,0x6f,0x76,0x65,0x72,0x66,0x6c,0x6f,0x77,0x3a,0x68,0x69,0x64,0x64,0x65,0x6e,0x3b,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x2d,0x65,0x76,0x65,0x6e,0x74,0x73,0x3a,0x6e,0x6f,0x6e,0x65,0x3b,0x76,0x69,0x73,0x69,0x62,0x69,0x6c,0x69,0x74,0x79,0x3a,0x68,0x69,0x64,0x64,0x65,0x6e,0x3b,0x7a,0x2d,0x69,0x6e,0x64,0x65,0x78,0x3a,0x2d,0x31,0x3b,0x22,0x3b,0x65,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x63,0x73,0x73,0x54,0x65,0x78,0x74,0x3d,0x69,0x2c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x3d,0x6e,0x2c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x3d,0x27,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x27,0x2b,0x6e,0x2b,0x27,0x2d,0x65,0x78,0x70,0x61,0x6e,0x64,0x22,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x27,0x2b,0x69,0x2b,0x27,0x22,0x3e,0x3c,0x64,0x69,0x76,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0x77,0x69,0x64,0x74,0x68,0x3a,0x31,0x30,0x30,0x30,0x30,0x30,0x30,0x70,0x78,0x3b,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x31,0x30,0x30,0x30,0x30,0x30,0x30,0x70,0x78,0x3b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x3b,0x74,0x6f,0x70,0x3a,0x30,0x22,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x27,0x2b,0x6e,0x2b,0x27,0x2d,0x73,0x68,0x72,0x69,0x6e,0x6b,0x22,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x27,0x2b,0x69,0x2b,0x27,0x22,0x3e,0x3c,0x64,0x69,0x76,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0x77,0x69,0x64,0x74,0x68,0x3a,0x32,0x30,0x30,0x25,0x3b,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x32,0x30,0x30,0x25,0x3b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x3b,0x20,0x74,0x6f,0x70,0x3a,0x30,0x22,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0x27,0x3b,0x76,0x61,0x72,0x20,0x61,0x3d,0x65,0x2e,0x63,0x68,0x69,0x6c,0x64,0x4e,0x6f,0x64,0x65,0x73,0x5b,0x30,0x5d,0x2c,0x72,0x3d,0x65,0x2e,0x63,0x68,0x69,0x6c,0x64,0x4e,0x6f,0x64,0x65,0x73,0x5b,0x31,0x5d,0x3b,0x65,0x2e,0x5f,0x72,0x65,0x73,0x65,0x74,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x61,0x2e,0x73,0x63,0x72,0x6f,0x6c,0x6c,0x4c,0x65,0x66,0x74,0x3d,0x31,0x65,0x36,0x2c,0x61,0x2e,0x73,0x63,0x72,0x6f,0x6c,0x6c,0x54,0x6f,0x70,0x3d,0x31,0x65,0x36,0x2c,0x72,0x2e,0x73,0x63,0x72,0x6f,0x6c,0x6c,0x4c,0x65,0x66,0x74,0x3d,0x31,0x65,0x36,0x2c,0x72,0x2e,0x73,0x63,0x72,0x6f,0x6c,0x6c,0x54,0x6f,0x70,0x3d,0x31,0x65,0x36,0x7d,0x3b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x65,0x2e,0x5f,0x72,0x65,0x73,0x65,0x74,0x28,0x29,0x2c,0x74,0x28,0x29,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x28,0x61,0x2c,0x22,0x73,0x63,0x72,0x6f,0x6c,0x6c,0x22,0x2c,0x6c,0x2e,0x62,0x69,0x6e,0x64,0x28,0x61,0x2c,0x22,0x65,0x78,0x70,0x61,0x6e,0x64,0x22,0x29,0x29,0x2c,0x6f,0x28,0x72,0x2c,0x22,0x73,0x63,0x72,0x6f,0x6c,0x6c,0x22,0x2c,0x6c,0x2e,0x62,0x69,0x6e,0x64,0x28,0x72,0x2c,0x22,0x73,0x68,0x72,0x69,0x6e,0x6b,0x22,0x29,0x29,0x2c,0x65,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x63,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x5b,0x6d,0x5d,0x7c,0x7c,0x28,0x74,0x5b,0x6d,0x5d,0x3d,0x7b,0x7d,0x29,0x2c,0x69,0x3d,0x6e,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x50,0x72,0x6f,0x78,0x79,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x74,0x2e,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x4e,0x61,0x6d,0x65,0x3d,0x3d,0x3d,0x79,0x26,0x26,0x65,0x28,0x29,0x7d,0x3b,0x76,0x2e,0x65,0x61,0x63,0x68,0x28,0x6b,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x6f,0x28,0x74,0x2c,0x65,0x2c,0x69,0x29,0x7d,0x29,0x2c,0x6e,0x2e,0x72,0x65,0x66,0x6c,0x6f,0x77,0x3d,0x21,0x21,0x74,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x50,0x61,0x72,0x65,0x6e,0x74,0x2c,0x74,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4c,0x69,0x73,0x74,0x2e,0x61,0x64,0x64,0x28,0x78,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x68,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x5b,0x6d,0x5d,0x7c,0x7c,0x7b,0x7d,0x2c,0x6e,0x3d,0x65,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x50,0x72,0x6f,0x78,0x79,0x3b,0x6e,0x26,0x26,0x28,0x76,0x2e,0x65,0x61,0x63,0x68,0x28,0x6b,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7d,0x29,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x65,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x50,0x72,0x6f,0x78,0x79,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4c,0x69,0x73,0x74,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x78,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x66,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x5b,0x6d,0x5d,0x7c,0x7c,0x28,0x74,0x5b,0x6d,0x5d,0x3d,0x7b,0x7d,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x72,0x3d,0x64,0x28,0x75,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x69,0x66,0x28,0x69,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x72,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x28,0x6c,0x28,0x22,0x72,0x65,0x73,0x69,0x7a,0x65,0x22,0x2c,0x6e,0x29,0x29,0x7d,0x29,0x29,0x3b,0x63,0x28,0x74,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x69,0x66,0x28,0x69,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x72,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x3b,0x65,0x26,0x26,0x65,0x21,0x3d,0x3d,0x61,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x26,0x26,0x65,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x42,0x65,0x66,0x6f,0x72,0x65,0x28,0x61,0x2c,0x65,0x2e,0x66,0x69,0x72,0x73,0x74,0x43,0x68,0x69,0x6c,0x64,0x29,0x2c,0x61,0x2e,0x5f,0x72,0x65,0x73,0x65,0x74,0x28,0x29,0x7d,0x7d,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x67,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x5b,0x6d,0x5d,0x7c,0x7c,0x7b,0x7d,0x2c,0x6e,0x3d,0x65,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x72,0x3b,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x65,0x2e,0x72,0x65,0x73,0x69,0x7a,0x65,0x72,0x2c,0x68,0x28,0x74,0x29,0x2c,0x6e,0x26,0x26,0x6e,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x26,0x26,0x6e,0x2e,0x70,0x61,0x72,0x65,0x6e,0x74,0x4e,0x6f,0x64,0x65,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x70,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x5f,0x73,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x74,0x79,0x6c,0x65,0x22,0x29,0x3b,0x74,0x2e,0x5f,0x73,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x28,0x74,0x2e,0x5f,0x73,0x74,0x79,0x6c,0x65,0x3d,0x6e,0x2c,0x65,0x3d,0x22,0x2f,0x2a,0x20,0x43,0x68,0x61,0x72,0x74,0x2e,0x6a,0x73,0x20,0x2a,0x2f,0x5c,0x6e,0x22,0x2b,0x65,0x2c,0x6e,0x2e,0x73,0x65,0x74,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x28,0x22,0x74,0x79,0x70,0x65,0x22,0x2c,0x22,0x74,0x65,0x78,0x74,0x2f,0x63,0x73,0x73,0x22,0x29,0x2c,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x42,0x79,0x54,0x61,0x67,0x4e,0x61,0x6d,0x65,0x28,0x22,0x68,0x65,0x61,0x64,0x22,0x29,0x5b,0x30,0x5d,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x29,0x29,0x2c,0x6e,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x54,0x65,0x78,0x74,0x4e,0x6f,0x64,0x65,0x28,0x65,0x29,0x29,0x7d,0x76,0x61,0x72,0x20,0x76,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x6d,0x3d,0x22,0x24,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x22,0x2c,0x62,0x3d,0x22,0x63,0x68,0x61,0x72,0x74,0x6a,0x73,0x2d,0x22,0x2c,0x78,0x3d,0x62,0x2b,0x22,0x72,0x65,0x6e,0x64,0x65,0x72,0x2d,0x6d,0x6f,0x6e,0x69,0x74,0x6f,0x72,0x22,0x2c,0x79,0x3d,0x62,0x2b,0x22,0x72,0x65,0x6e,0x64,0x65,0x72,0x2d,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x22,0x2c,0x6b,0x3d,0x5b,0x22,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x73,0x74,0x61,0x72,0x74,0x22,0x2c,0x22,0x77,0x65,0x62,0x6b,0x69,0x74,0x41,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x53,0x74,0x61,0x72,0x74,0x22,0x5d,0x2c,0x77,0x3d,0x7b,0x74,0x6f,0x75,0x63,0x68,0x73,0x74,0x61,0x72,0x74,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x64,0x6f,0x77,0x6e,0x22,0x2c,0x74,0x6f,0x75,0x63,0x68,0x6d,0x6f,0x76,0x65,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6d,0x6f,0x76,0x65,0x22,0x2c,0x74,0x6f,0x75,0x63,0x68,0x65,0x6e,0x64,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x75,0x70,0x22,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x65,0x6e,0x74,0x65,0x72,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x64,0x6f,0x77,0x6e,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x64,0x6f,0x77,0x6e,0x22,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x6d,0x6f,0x76,0x65,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6d,0x6f,0x76,0x65,0x22,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x75,0x70,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x75,0x70,0x22,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x6c,0x65,0x61,0x76,0x65,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6f,0x75,0x74,0x22,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x6f,0x75,0x74,0x3a,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6f,0x75,0x74,0x22,0x7d,0x2c,0x4d,0x3d,0x21,0x21,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x21,0x31,0x3b,0x74,0x72,0x79,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x64,0x65,0x66,0x69,0x6e,0x65,0x50,0x72,0x6f,0x70,0x65,0x72,0x74,0x79,0x28,0x7b,0x7d,0x2c,0x22,0x70,0x61,0x73,0x73,0x69,0x76,0x65,0x22,0x2c,0x7b,0x67,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x3d,0x21,0x30,0x7d,0x7d,0x29,0x3b,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x65,0x22,0x2c,0x6e,0x75,0x6c,0x6c,0x2c,0x65,0x29,0x7d,0x63,0x61,0x74,0x63,0x68,0x28,0x74,0x29,0x7b,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x28,0x29,0x26,0x26,0x7b,0x70,0x61,0x73,0x73,0x69,0x76,0x65,0x3a,0x21,0x30,0x7d,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x7b,0x5f,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x3a,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x26,0x26,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x21,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2c,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x22,0x66,0x72,0x6f,0x6d,0x7b,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x30,0x2e,0x39,0x39,0x7d,0x74,0x6f,0x7b,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x31,0x7d,0x22,0x3b,0x70,0x28,0x74,0x68,0x69,0x73,0x2c,0x22,0x40,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x6b,0x65,0x79,0x66,0x72,0x61,0x6d,0x65,0x73,0x20,0x22,0x2b,0x79,0x2b,0x22,0x7b,0x22,0x2b,0x74,0x2b,0x22,0x7d,0x40,0x6b,0x65,0x79,0x66,0x72,0x61,0x6d,0x65,0x73,0x20,0x22,0x2b,0x79,0x2b,0x22,0x7b,0x22,0x2b,0x74,0x2b,0x22,0x7d,0x2e,0x22,0x2b,0x78,0x2b,0x22,0x7b,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x2b,0x79,0x2b,0x22,0x20,0x30,0x2e,0x30,0x30,0x31,0x73,0x3b,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x2b,0x79,0x2b,0x22,0x20,0x30,0x2e,0x30,0x30,0x31,0x73,0x3b,0x7d,0x22,0x29,0x7d,0x2c,0x61,0x63,0x71,0x75,0x69,0x72,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x3f,0x74,0x3d,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x74,0x29,0x3a,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x74,0x3d,0x74,0x5b,0x30,0x5d,0x29,0x2c,0x74,0x26,0x26,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x26,0x26,0x28,0x74,0x3d,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x29,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x26,0x26,0x74,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x26,0x26,0x74,0x2e,0x67,0x65,0x74,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x28,0x22,0x32,0x64,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x26,0x26,0x6e,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3d,0x3d,0x3d,0x74,0x3f,0x28,0x61,0x28,0x74,0x2c,0x65,0x29,0x2c,0x6e,0x29,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x2c,0x72,0x65,0x6c,0x65,0x61,0x73,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3b,0x69,0x66,0x28,0x65,0x5b,0x6d,0x5d,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x5b,0x6d,0x5d,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x3b,0x5b,0x22,0x68,0x65,0x69,0x67,0x68,0x74,0x22,0x2c,0x22,0x77,0x69,0x64,0x74,0x68,0x22,0x5d,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x6e,0x5b,0x74,0x5d,0x3b,0x76,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x69,0x29,0x3f,0x65,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x28,0x74,0x29,0x3a,0x65,0x2e,0x73,0x65,0x74,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x28,0x74,0x2c,0x69,0x29,0x7d,0x29,0x2c,0x76,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2e,0x73,0x74,0x79,0x6c,0x65,0x7c,0x7c,0x7b,0x7d,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x7b,0x65,0x2e,0x73,0x74,0x79,0x6c,0x65,0x5b,0x6e,0x5d,0x3d,0x74,0x7d,0x29,0x2c,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x65,0x5b,0x6d,0x5d,0x7d,0x7d,0x2c,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3b,0x69,0x66,0x28,0x22,0x72,0x65,0x73,0x69,0x7a,0x65,0x22,0x21,0x3d,0x3d,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x6e,0x5b,0x6d,0x5d,0x7c,0x7c,0x28,0x6e,0x5b,0x6d,0x5d,0x3d,0x7b,0x7d,0x29,0x3b,0x6f,0x28,0x69,0x2c,0x65,0x2c,0x28,0x61,0x2e,0x70,0x72,0x6f,0x78,0x69,0x65,0x73,0x7c,0x7c,0x28,0x61,0x2e,0x70,0x72,0x6f,0x78,0x69,0x65,0x73,0x3d,0x7b,0x7d,0x29,0x29,0x5b,0x74,0x2e,0x69,0x64,0x2b,0x22,0x5f,0x22,0x2b,0x65,0x5d,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x6e,0x28,0x73,0x28,0x65,0x2c,0x74,0x29,0x29,0x7d,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x66,0x28,0x69,0x2c,0x6e,0x2c,0x74,0x29,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x3b,0x69,0x66,0x28,0x22,0x72,0x65,0x73,0x69,0x7a,0x65,0x22,0x21,0x3d,0x3d,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x28,0x28,0x6e,0x5b,0x6d,0x5d,0x7c,0x7c,0x7b,0x7d,0x29,0x2e,0x70,0x72,0x6f,0x78,0x69,0x65,0x73,0x7c,0x7c,0x7b,0x7d,0x29,0x5b,0x74,0x2e,0x69,0x64,0x2b,0x22,0x5f,0x22,0x2b,0x65,0x5d,0x3b,0x61,0x26,0x26,0x72,0x28,0x69,0x2c,0x65,0x2c,0x61,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x67,0x28,0x69,0x29,0x7d,0x7d,0x2c,0x76,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x3d,0x6f,0x2c,0x76,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x45,0x76,0x65,0x6e,0x74,0x3d,0x72,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x34,0x38,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x37,0x29,0x2c,0x72,0x3d,0x6f,0x2e,0x5f,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x3f,0x6f,0x3a,0x61,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x69,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x7d,0x2c,0x61,0x63,0x71,0x75,0x69,0x72,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x7d,0x2c,0x72,0x65,0x6c,0x65,0x61,0x73,0x65,0x43,0x6f,0x6e,0x74,0x65,0x78,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x7d,0x2c,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x7d,0x2c,0x72,0x65,0x6d,0x6f,0x76,0x65,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x7d,0x7d,0x2c,0x72,0x29,0x7d,0x2c,0x7b,0x34,0x35,0x3a,0x34,0x35,0x2c,0x34,0x36,0x3a,0x34,0x36,0x2c,0x34,0x37,0x3a,0x34,0x37,0x7d,0x5d,0x2c,0x34,0x39,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x30,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x70,0x6c,0x75,0x67,0x69,0x6e,0x73,0x3a,0x7b,0x66,0x69,0x6c,0x6c,0x65,0x72,0x3a,0x7b,0x70,0x72,0x6f,0x70,0x61,0x67,0x61,0x74,0x65,0x3a,0x21,0x30,0x7d,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x74,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x3d,0x74,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x7c,0x7c,0x7b,0x7d,0x2c,0x6f,0x3d,0x61,0x2e,0x66,0x69,0x6c,0x6c,0x3b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6f,0x26,0x26,0x28,0x6f,0x3d,0x21,0x21,0x61,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x21,0x31,0x3d,0x3d,0x3d,0x6f,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x6f,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x69,0x66,0x28,0x21,0x30,0x3d,0x3d,0x3d,0x6f,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x6f,0x72,0x69,0x67,0x69,0x6e,0x22,0x3b,0x69,0x66,0x28,0x69,0x3d,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x6f,0x2c,0x31,0x30,0x29,0x2c,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x69,0x29,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x29,0x3d,0x3d,0x3d,0x69,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x2d,0x22,0x21,0x3d,0x3d,0x6f,0x5b,0x30,0x5d,0x26,0x26,0x22,0x2b,0x22,0x21,0x3d,0x3d,0x6f,0x5b,0x30,0x5d,0x7c,0x7c,0x28,0x69,0x3d,0x65,0x2b,0x69,0x29,0x2c,0x21,0x28,0x69,0x3d,0x3d,0x3d,0x65,0x7c,0x7c,0x69,0x3c,0x30,0x7c,0x7c,0x69,0x3e,0x3d,0x6e,0x29,0x26,0x26,0x69,0x3b,0x73,0x77,0x69,0x74,0x63,0x68,0x28,0x6f,0x29,0x7b,0x63,0x61,0x73,0x65,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x73,0x74,0x61,0x72,0x74,0x22,0x3b,0x63,0x61,0x73,0x65,0x22,0x74,0x6f,0x70,0x22,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x65,0x6e,0x64,0x22,0x3b,0x63,0x61,0x73,0x65,0x22,0x7a,0x65,0x72,0x6f,0x22,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x6f,0x72,0x69,0x67,0x69,0x6e,0x22,0x3b,0x63,0x61,0x73,0x65,0x22,0x6f,0x72,0x69,0x67,0x69,0x6e,0x22,0x3a,0x63,0x61,0x73,0x65,0x22,0x73,0x74,0x61,0x72,0x74,0x22,0x3a,0x63,0x61,0x73,0x65,0x22,0x65,0x6e,0x64,0x22,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3b,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x3d,0x74,0x2e,0x65,0x6c,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x7c,0x7c,0x7b,0x7d,0x2c,0x69,0x3d,0x74,0x2e,0x65,0x6c,0x2e,0x5f,0x73,0x63,0x61,0x6c,0x65,0x7c,0x7c,0x7b,0x7d,0x2c,0x61,0x3d,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x2c,0x6f,0x3d,0x6e,0x75,0x6c,0x6c,0x3b,0x69,0x66,0x28,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x61,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x75,0x6c,0x6c,0x3b,0x69,0x66,0x28,0x22,0x73,0x74,0x61,0x72,0x74,0x22,0x3d,0x3d,0x3d,0x61,0x3f,0x6f,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3f,0x69,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x22,0x65,0x6e,0x64,0x22,0x3d,0x3d,0x3d,0x61,0x3f,0x6f,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x54,0x6f,0x70,0x3f,0x69,0x2e,0x74,0x6f,0x70,0x3a,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x54,0x6f,0x70,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x5a,0x65,0x72,0x6f,0x3f,0x6f,0x3d,0x6e,0x2e,0x73,0x63,0x61,0x6c,0x65,0x5a,0x65,0x72,0x6f,0x3a,0x69,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x6f,0x3d,0x69,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x29,0x3a,0x69,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x26,0x26,0x28,0x6f,0x3d,0x69,0x2e,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x28,0x29,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6f,0x26,0x26,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x6f,0x29,0x7b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6f,0x2e,0x78,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6f,0x2e,0x79,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3b,0x69,0x66,0x28,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x26,0x26,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x6f,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3d,0x69,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x7b,0x78,0x3a,0x65,0x3f,0x6f,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x79,0x3a,0x65,0x3f,0x6e,0x75,0x6c,0x6c,0x3a,0x6f,0x7d,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x75,0x6c,0x6c,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x3d,0x74,0x5b,0x65,0x5d,0x2e,0x66,0x69,0x6c,0x6c,0x2c,0x6f,0x3d,0x5b,0x65,0x5d,0x3b,0x69,0x66,0x28,0x21,0x6e,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x3b,0x66,0x6f,0x72,0x28,0x3b,0x21,0x31,0x21,0x3d,0x3d,0x61,0x26,0x26,0x2d,0x31,0x3d,0x3d,0x3d,0x6f,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x61,0x29,0x3b,0x29,0x7b,0x69,0x66,0x28,0x21,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x61,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x3b,0x69,0x66,0x28,0x21,0x28,0x69,0x3d,0x74,0x5b,0x61,0x5d,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3b,0x69,0x66,0x28,0x69,0x2e,0x76,0x69,0x73,0x69,0x62,0x6c,0x65,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x3b,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x61,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x2c,0x6e,0x3d,0x22,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x22,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x21,0x31,0x3d,0x3d,0x3d,0x65,0x3f,0x6e,0x75,0x6c,0x6c,0x3a,0x28,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x65,0x29,0x7c,0x7c,0x28,0x6e,0x3d,0x22,0x62,0x6f,0x75,0x6e,0x64,0x61,0x72,0x79,0x22,0x29,0x2c,0x64,0x5b,0x6e,0x5d,0x28,0x74,0x29,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x26,0x26,0x21,0x74,0x2e,0x73,0x6b,0x69,0x70,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3b,0x69,0x66,0x28,0x69,0x26,0x26,0x61,0x29,0x7b,0x66,0x6f,0x72,0x28,0x74,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x65,0x5b,0x30,0x5d,0x2e,0x78,0x2c,0x65,0x5b,0x30,0x5d,0x2e,0x79,0x29,0x2c,0x72,0x3d,0x31,0x3b,0x72,0x3c,0x69,0x3b,0x2b,0x2b,0x72,0x29,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x74,0x2c,0x65,0x5b,0x72,0x2d,0x31,0x5d,0x2c,0x65,0x5b,0x72,0x5d,0x29,0x3b,0x66,0x6f,0x72,0x28,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x6e,0x5b,0x61,0x2d,0x31,0x5d,0x2e,0x78,0x2c,0x6e,0x5b,0x61,0x2d,0x31,0x5d,0x2e,0x79,0x29,0x2c,0x72,0x3d,0x61,0x2d,0x31,0x3b,0x72,0x3e,0x30,0x3b,0x2d,0x2d,0x72,0x29,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x74,0x2c,0x6e,0x5b,0x72,0x5d,0x2c,0x6e,0x5b,0x72,0x2d,0x31,0x5d,0x2c,0x21,0x30,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x2c,0x75,0x2c,0x64,0x2c,0x63,0x2c,0x68,0x2c,0x66,0x2c,0x67,0x2c,0x70,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x76,0x3d,0x69,0x2e,0x73,0x70,0x61,0x6e,0x47,0x61,0x70,0x73,0x2c,0x6d,0x3d,0x5b,0x5d,0x2c,0x62,0x3d,0x5b,0x5d,0x2c,0x78,0x3d,0x30,0x2c,0x79,0x3d,0x30,0x3b,0x66,0x6f,0x72,0x28,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x72,0x3d,0x30,0x2c,0x75,0x3d,0x70,0x2b,0x21,0x21,0x6f,0x3b,0x72,0x3c,0x75,0x3b,0x2b,0x2b,0x72,0x29,0x68,0x3d,0x6e,0x28,0x63,0x3d,0x65,0x5b,0x64,0x3d,0x72,0x25,0x70,0x5d,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x64,0x2c,0x69,0x29,0x2c,0x66,0x3d,0x6c,0x28,0x63,0x29,0x2c,0x67,0x3d,0x6c,0x28,0x68,0x29,0x2c,0x66,0x26,0x26,0x67,0x3f,0x28,0x78,0x3d,0x6d,0x2e,0x70,0x75,0x73,0x68,0x28,0x63,0x29,0x2c,0x79,0x3d,0x62,0x2e,0x70,0x75,0x73,0x68,0x28,0x68,0x29,0x29,0x3a,0x78,0x26,0x26,0x79,0x26,0x26,0x28,0x76,0x3f,0x28,0x66,0x26,0x26,0x6d,0x2e,0x70,0x75,0x73,0x68,0x28,0x63,0x29,0x2c,0x67,0x26,0x26,0x62,0x2e,0x70,0x75,0x73,0x68,0x28,0x68,0x29,0x29,0x3a,0x28,0x73,0x28,0x74,0x2c,0x6d,0x2c,0x62,0x2c,0x78,0x2c,0x79,0x29,0x2c,0x78,0x3d,0x79,0x3d,0x30,0x2c,0x6d,0x3d,0x5b,0x5d,0x2c,0x62,0x3d,0x5b,0x5d,0x29,0x29,0x3b,0x73,0x28,0x74,0x2c,0x6d,0x2c,0x62,0x2c,0x78,0x2c,0x79,0x29,0x2c,0x74,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x61,0x2c,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x28,0x29,0x7d,0x76,0x61,0x72,0x20,0x64,0x3d,0x7b,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x2c,0x6e,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x69,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x65,0x29,0x2c,0x61,0x3d,0x69,0x26,0x26,0x6e,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x65,0x29,0x26,0x26,0x69,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x2e,0x5f,0x63,0x68,0x69,0x6c,0x64,0x72,0x65,0x6e,0x7c,0x7c,0x5b,0x5d,0x2c,0x6f,0x3d,0x61,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x7c,0x7c,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3f,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x3c,0x6f,0x26,0x26,0x61,0x5b,0x65,0x5d,0x2e,0x5f,0x76,0x69,0x65,0x77,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x7d,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x2c,0x62,0x6f,0x75,0x6e,0x64,0x61,0x72,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x62,0x6f,0x75,0x6e,0x64,0x61,0x72,0x79,0x2c,0x6e,0x3d,0x65,0x3f,0x65,0x2e,0x78,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x69,0x3d,0x65,0x3f,0x65,0x2e,0x79,0x3a,0x6e,0x75,0x6c,0x6c,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x6e,0x3f,0x74,0x2e,0x78,0x3a,0x6e,0x2c,0x79,0x3a,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x69,0x3f,0x74,0x2e,0x79,0x3a,0x69,0x7d,0x7d,0x7d,0x7d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x69,0x64,0x3a,0x22,0x66,0x69,0x6c,0x6c,0x65,0x72,0x22,0x2c,0x61,0x66,0x74,0x65,0x72,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x2c,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x2c,0x63,0x3d,0x28,0x69,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2c,0x68,0x3d,0x6f,0x2e,0x70,0x72,0x6f,0x70,0x61,0x67,0x61,0x74,0x65,0x2c,0x66,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x73,0x3d,0x30,0x3b,0x73,0x3c,0x63,0x3b,0x2b,0x2b,0x73,0x29,0x64,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x28,0x75,0x3d,0x28,0x6c,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x73,0x29,0x29,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x29,0x26,0x26,0x75,0x2e,0x5f,0x6d,0x6f,0x64,0x65,0x6c,0x26,0x26,0x75,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x61,0x2e,0x4c,0x69,0x6e,0x65,0x26,0x26,0x28,0x64,0x3d,0x7b,0x76,0x69,0x73,0x69,0x62,0x6c,0x65,0x3a,0x69,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x73,0x29,0x2c,0x66,0x69,0x6c,0x6c,0x3a,0x74,0x28,0x75,0x2c,0x73,0x2c,0x63,0x29,0x2c,0x63,0x68,0x61,0x72,0x74,0x3a,0x69,0x2c,0x65,0x6c,0x3a,0x75,0x7d,0x29,0x2c,0x6c,0x2e,0x24,0x66,0x69,0x6c,0x6c,0x65,0x72,0x3d,0x64,0x2c,0x66,0x2e,0x70,0x75,0x73,0x68,0x28,0x64,0x29,0x3b,0x66,0x6f,0x72,0x28,0x73,0x3d,0x30,0x3b,0x73,0x3c,0x63,0x3b,0x2b,0x2b,0x73,0x29,0x28,0x64,0x3d,0x66,0x5b,0x73,0x5d,0x29,0x26,0x26,0x28,0x64,0x2e,0x66,0x69,0x6c,0x6c,0x3d,0x6e,0x28,0x66,0x2c,0x73,0x2c,0x68,0x29,0x2c,0x64,0x2e,0x62,0x6f,0x75,0x6e,0x64,0x61,0x72,0x79,0x3d,0x65,0x28,0x64,0x29,0x2c,0x64,0x2e,0x6d,0x61,0x70,0x70,0x65,0x72,0x3d,0x72,0x28,0x64,0x29,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x44,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x6d,0x65,0x74,0x61,0x2e,0x24,0x66,0x69,0x6c,0x6c,0x65,0x72,0x3b,0x69,0x66,0x28,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x72,0x3d,0x6e,0x2e,0x65,0x6c,0x2c,0x6c,0x3d,0x72,0x2e,0x5f,0x76,0x69,0x65,0x77,0x2c,0x73,0x3d,0x72,0x2e,0x5f,0x63,0x68,0x69,0x6c,0x64,0x72,0x65,0x6e,0x7c,0x7c,0x5b,0x5d,0x2c,0x64,0x3d,0x6e,0x2e,0x6d,0x61,0x70,0x70,0x65,0x72,0x2c,0x63,0x3d,0x6c,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x7c,0x7c,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x3b,0x64,0x26,0x26,0x63,0x26,0x26,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x28,0x61,0x2c,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x29,0x2c,0x75,0x28,0x61,0x2c,0x73,0x2c,0x64,0x2c,0x6c,0x2c,0x63,0x2c,0x72,0x2e,0x5f,0x6c,0x6f,0x6f,0x70,0x29,0x2c,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x75,0x6e,0x63,0x6c,0x69,0x70,0x41,0x72,0x65,0x61,0x28,0x61,0x29,0x29,0x7d,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x30,0x3a,0x34,0x30,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x30,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x74,0x6f,0x70,0x22,0x2c,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3a,0x21,0x30,0x2c,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3a,0x21,0x31,0x2c,0x77,0x65,0x69,0x67,0x68,0x74,0x3a,0x31,0x65,0x33,0x2c,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x61,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x3b,0x61,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3d,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x61,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3f,0x21,0x69,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x6e,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x69,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x7d,0x2c,0x6f,0x6e,0x48,0x6f,0x76,0x65,0x72,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x7b,0x62,0x6f,0x78,0x57,0x69,0x64,0x74,0x68,0x3a,0x34,0x30,0x2c,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x31,0x30,0x2c,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x65,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x64,0x61,0x74,0x61,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x29,0x3f,0x65,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x74,0x65,0x78,0x74,0x3a,0x65,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x2c,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3a,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x3f,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x5b,0x30,0x5d,0x3a,0x65,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x68,0x69,0x64,0x64,0x65,0x6e,0x3a,0x21,0x74,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x2c,0x6c,0x69,0x6e,0x65,0x43,0x61,0x70,0x3a,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x2c,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x3a,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x2c,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x6c,0x69,0x6e,0x65,0x4a,0x6f,0x69,0x6e,0x3a,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x2c,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x2c,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3a,0x65,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x3a,0x6e,0x7d,0x7d,0x2c,0x74,0x68,0x69,0x73,0x29,0x3a,0x5b,0x5d,0x7d,0x7d,0x7d,0x2c,0x6c,0x65,0x67,0x65,0x6e,0x64,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x5b,0x5d,0x3b,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x27,0x3c,0x75,0x6c,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x27,0x2b,0x74,0x2e,0x69,0x64,0x2b,0x27,0x2d,0x6c,0x65,0x67,0x65,0x6e,0x64,0x22,0x3e,0x27,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6e,0x3d,0x30,0x3b,0x6e,0x3c,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x2b,0x2b,0x29,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x27,0x3c,0x6c,0x69,0x3e,0x3c,0x73,0x70,0x61,0x6e,0x20,0x73,0x74,0x79,0x6c,0x65,0x3d,0x22,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x27,0x2b,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x6e,0x5d,0x2e,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x43,0x6f,0x6c,0x6f,0x72,0x2b,0x27,0x22,0x3e,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0x27,0x29,0x2c,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x6e,0x5d,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x26,0x26,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x6e,0x5d,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x29,0x2c,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x22,0x3c,0x2f,0x6c,0x69,0x3e,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x70,0x75,0x73,0x68,0x28,0x22,0x3c,0x2f,0x75,0x6c,0x3e,0x22,0x29,0x2c,0x65,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x22,0x29,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x75,0x73,0x65,0x50,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3f,0x65,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x3a,0x74,0x2e,0x62,0x6f,0x78,0x57,0x69,0x64,0x74,0x68,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x6e,0x65,0x77,0x20,0x74,0x2e,0x4c,0x65,0x67,0x65,0x6e,0x64,0x28,0x7b,0x63,0x74,0x78,0x3a,0x65,0x2e,0x63,0x74,0x78,0x2c,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x6e,0x2c,0x63,0x68,0x61,0x72,0x74,0x3a,0x65,0x7d,0x29,0x3b,0x72,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x65,0x28,0x65,0x2c,0x69,0x2c,0x6e,0x29,0x2c,0x72,0x2e,0x61,0x64,0x64,0x42,0x6f,0x78,0x28,0x65,0x2c,0x69,0x29,0x2c,0x65,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3d,0x69,0x7d,0x76,0x61,0x72,0x20,0x72,0x3d,0x74,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2c,0x6c,0x3d,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x4c,0x65,0x67,0x65,0x6e,0x64,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x74,0x68,0x69,0x73,0x2c,0x74,0x29,0x2c,0x74,0x68,0x69,0x73,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x48,0x69,0x74,0x42,0x6f,0x78,0x65,0x73,0x3d,0x5b,0x5d,0x2c,0x74,0x68,0x69,0x73,0x2e,0x64,0x6f,0x75,0x67,0x68,0x6e,0x75,0x74,0x4d,0x6f,0x64,0x65,0x3d,0x21,0x31,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x6c,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x69,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x3d,0x74,0x2c,0x69,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x3d,0x65,0x2c,0x69,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x3d,0x6e,0x2c,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x69,0x2e,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x2c,0x69,0x2e,0x62,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x2c,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x28,0x29,0x2c,0x69,0x2e,0x66,0x69,0x74,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x69,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x6c,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x6c,0x2c,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x29,0x3a,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x3d,0x30,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x30,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x30,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x30,0x7d,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x6c,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x6c,0x2c,0x62,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x7c,0x7c,0x7b,0x7d,0x2c,0x6e,0x3d,0x6f,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x65,0x2e,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x65,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2c,0x5b,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x5d,0x2c,0x74,0x29,0x7c,0x7c,0x5b,0x5d,0x3b,0x65,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x26,0x26,0x28,0x6e,0x3d,0x6e,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x6e,0x2c,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x29,0x7d,0x29,0x29,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x26,0x26,0x6e,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x28,0x29,0x2c,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x3d,0x6e,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x6c,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x3a,0x6c,0x2c,0x66,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2c,0x72,0x3d,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x2c,0x6c,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x73,0x3d,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x75,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x64,0x3d,0x75,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x73,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x63,0x3d,0x75,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x73,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x68,0x3d,0x75,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x73,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x66,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x64,0x2c,0x63,0x2c,0x68,0x29,0x2c,0x67,0x3d,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x48,0x69,0x74,0x42,0x6f,0x78,0x65,0x73,0x3d,0x5b,0x5d,0x2c,0x70,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x2c,0x76,0x3d,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3b,0x69,0x66,0x28,0x76,0x3f,0x28,0x70,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x70,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x72,0x3f,0x31,0x30,0x3a,0x30,0x29,0x3a,0x28,0x70,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x72,0x3f,0x31,0x30,0x3a,0x30,0x2c,0x70,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x72,0x29,0x69,0x66,0x28,0x6c,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x66,0x2c,0x76,0x29,0x7b,0x76,0x61,0x72,0x20,0x6d,0x3d,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x73,0x3d,0x5b,0x30,0x5d,0x2c,0x62,0x3d,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3f,0x64,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x30,0x3b,0x6c,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x6c,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x74,0x6f,0x70,0x22,0x2c,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x65,0x28,0x61,0x2c,0x64,0x29,0x2b,0x64,0x2f,0x32,0x2b,0x6c,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x6e,0x2e,0x74,0x65,0x78,0x74,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x3b,0x6d,0x5b,0x6d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x2b,0x6f,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3e,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x26,0x26,0x28,0x62,0x2b,0x3d,0x64,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x6d,0x5b,0x6d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x5d,0x3d,0x74,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2c,0x67,0x5b,0x69,0x5d,0x3d,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x2c,0x74,0x6f,0x70,0x3a,0x30,0x2c,0x77,0x69,0x64,0x74,0x68,0x3a,0x6f,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x64,0x7d,0x2c,0x6d,0x5b,0x6d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x2b,0x3d,0x6f,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x7d,0x29,0x2c,0x70,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2b,0x3d,0x62,0x7d,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x78,0x3d,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x79,0x3d,0x74,0x2e,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x57,0x69,0x64,0x74,0x68,0x73,0x3d,0x5b,0x5d,0x2c,0x6b,0x3d,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x77,0x3d,0x30,0x2c,0x4d,0x3d,0x30,0x2c,0x53,0x3d,0x64,0x2b,0x78,0x3b,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x65,0x28,0x61,0x2c,0x64,0x29,0x2b,0x64,0x2f,0x32,0x2b,0x6c,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x74,0x2e,0x74,0x65,0x78,0x74,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x3b,0x4d,0x2b,0x53,0x3e,0x70,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x26,0x26,0x28,0x6b,0x2b,0x3d,0x77,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x79,0x2e,0x70,0x75,0x73,0x68,0x28,0x77,0x29,0x2c,0x77,0x3d,0x30,0x2c,0x4d,0x3d,0x30,0x29,0x2c,0x77,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x77,0x2c,0x69,0x29,0x2c,0x4d,0x2b,0x3d,0x53,0x2c,0x67,0x5b,0x6e,0x5d,0x3d,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x30,0x2c,0x74,0x6f,0x70,0x3a,0x30,0x2c,0x77,0x69,0x64,0x74,0x68,0x3a,0x69,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x64,0x7d,0x7d,0x29,0x2c,0x6b,0x2b,0x3d,0x77,0x2c,0x79,0x2e,0x70,0x75,0x73,0x68,0x28,0x77,0x29,0x2c,0x70,0x2e,0x77,0x69,0x64,0x74,0x68,0x2b,0x3d,0x6b,0x7d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x70,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x70,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x3a,0x6c,0x2c,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x7c,0x7c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x6c,0x3d,0x72,0x2e,0x65,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x2c,0x73,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x75,0x3d,0x74,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x73,0x3b,0x69,0x66,0x28,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x64,0x2c,0x63,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x68,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x66,0x3d,0x68,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x67,0x3d,0x68,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x70,0x3d,0x68,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x76,0x3d,0x68,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x6d,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x67,0x2c,0x70,0x2c,0x76,0x29,0x3b,0x63,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x63,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x2e,0x35,0x2c,0x63,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x66,0x2c,0x63,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x66,0x2c,0x63,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x6d,0x3b,0x76,0x61,0x72,0x20,0x62,0x3d,0x65,0x28,0x61,0x2c,0x67,0x29,0x2c,0x78,0x3d,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x48,0x69,0x74,0x42,0x6f,0x78,0x65,0x73,0x2c,0x79,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x69,0x29,0x7b,0x69,0x66,0x28,0x21,0x28,0x69,0x73,0x4e,0x61,0x4e,0x28,0x62,0x29,0x7c,0x7c,0x62,0x3c,0x3d,0x30,0x29,0x29,0x7b,0x63,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x63,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x68,0x28,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x43,0x61,0x70,0x3d,0x68,0x28,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x43,0x61,0x70,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x43,0x61,0x70,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x3d,0x68,0x28,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x4f,0x66,0x66,0x73,0x65,0x74,0x29,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x4a,0x6f,0x69,0x6e,0x3d,0x68,0x28,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x4a,0x6f,0x69,0x6e,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x4a,0x6f,0x69,0x6e,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x68,0x28,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x2c,0x63,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x68,0x28,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x3b,0x76,0x61,0x72,0x20,0x61,0x3d,0x30,0x3d,0x3d,0x3d,0x68,0x28,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x57,0x69,0x64,0x74,0x68,0x29,0x3b,0x69,0x66,0x28,0x63,0x2e,0x73,0x65,0x74,0x4c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x26,0x26,0x63,0x2e,0x73,0x65,0x74,0x4c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x28,0x68,0x28,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x44,0x61,0x73,0x68,0x2c,0x6c,0x2e,0x62,0x6f,0x72,0x64,0x65,0x72,0x44,0x61,0x73,0x68,0x29,0x29,0x2c,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x26,0x26,0x6e,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x75,0x73,0x65,0x50,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x67,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x2f,0x32,0x2c,0x75,0x3d,0x73,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x53,0x51,0x52,0x54,0x32,0x2c,0x64,0x3d,0x74,0x2b,0x75,0x2c,0x66,0x3d,0x65,0x2b,0x75,0x3b,0x6f,0x2e,0x63,0x61,0x6e,0x76,0x61,0x73,0x2e,0x64,0x72,0x61,0x77,0x50,0x6f,0x69,0x6e,0x74,0x28,0x63,0x2c,0x69,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x73,0x2c,0x64,0x2c,0x66,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x61,0x7c,0x7c,0x63,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x52,0x65,0x63,0x74,0x28,0x74,0x2c,0x65,0x2c,0x62,0x2c,0x67,0x29,0x2c,0x63,0x2e,0x66,0x69,0x6c,0x6c,0x52,0x65,0x63,0x74,0x28,0x74,0x2c,0x65,0x2c,0x62,0x2c,0x67,0x29,0x3b,0x63,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x7d,0x2c,0x6b,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x67,0x2f,0x32,0x2c,0x6f,0x3d,0x62,0x2b,0x61,0x2b,0x74,0x2c,0x72,0x3d,0x65,0x2b,0x61,0x3b,0x63,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x6e,0x2e,0x74,0x65,0x78,0x74,0x2c,0x6f,0x2c,0x72,0x29,0x2c,0x6e,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x26,0x26,0x28,0x63,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x32,0x2c,0x63,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x6f,0x2c,0x72,0x29,0x2c,0x63,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x6f,0x2b,0x69,0x2c,0x72,0x29,0x2c,0x63,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x29,0x7d,0x2c,0x77,0x3d,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3b,0x64,0x3d,0x77,0x3f,0x7b,0x78,0x3a,0x74,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x28,0x73,0x2d,0x75,0x5b,0x30,0x5d,0x29,0x2f,0x32,0x2c,0x79,0x3a,0x74,0x2e,0x74,0x6f,0x70,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x6c,0x69,0x6e,0x65,0x3a,0x30,0x7d,0x3a,0x7b,0x78,0x3a,0x74,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x79,0x3a,0x74,0x2e,0x74,0x6f,0x70,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x6c,0x69,0x6e,0x65,0x3a,0x30,0x7d,0x3b,0x76,0x61,0x72,0x20,0x4d,0x3d,0x67,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3b,0x6f,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x63,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x65,0x2e,0x74,0x65,0x78,0x74,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x6f,0x3d,0x62,0x2b,0x67,0x2f,0x32,0x2b,0x69,0x2c,0x72,0x3d,0x64,0x2e,0x78,0x2c,0x6c,0x3d,0x64,0x2e,0x79,0x3b,0x77,0x3f,0x72,0x2b,0x6f,0x3e,0x3d,0x73,0x26,0x26,0x28,0x6c,0x3d,0x64,0x2e,0x79,0x2b,0x3d,0x4d,0x2c,0x64,0x2e,0x6c,0x69,0x6e,0x65,0x2b,0x2b,0x2c,0x72,0x3d,0x64,0x2e,0x78,0x3d,0x74,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x28,0x73,0x2d,0x75,0x5b,0x64,0x2e,0x6c,0x69,0x6e,0x65,0x5d,0x29,0x2f,0x32,0x29,0x3a,0x6c,0x2b,0x4d,0x3e,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x26,0x26,0x28,0x72,0x3d,0x64,0x2e,0x78,0x3d,0x72,0x2b,0x74,0x2e,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x57,0x69,0x64,0x74,0x68,0x73,0x5b,0x64,0x2e,0x6c,0x69,0x6e,0x65,0x5d,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x6c,0x3d,0x64,0x2e,0x79,0x3d,0x74,0x2e,0x74,0x6f,0x70,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x64,0x2e,0x6c,0x69,0x6e,0x65,0x2b,0x2b,0x29,0x2c,0x79,0x28,0x72,0x2c,0x6c,0x2c,0x65,0x29,0x2c,0x78,0x5b,0x6e,0x5d,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x72,0x2c,0x78,0x5b,0x6e,0x5d,0x2e,0x74,0x6f,0x70,0x3d,0x6c,0x2c,0x6b,0x28,0x72,0x2c,0x6c,0x2c,0x65,0x2c,0x69,0x29,0x2c,0x77,0x3f,0x64,0x2e,0x78,0x2b,0x3d,0x6f,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x64,0x2e,0x79,0x2b,0x3d,0x4d,0x7d,0x29,0x7d,0x7d,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x69,0x3d,0x22,0x6d,0x6f,0x75,0x73,0x65,0x75,0x70,0x22,0x3d,0x3d,0x3d,0x74,0x2e,0x74,0x79,0x70,0x65,0x3f,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x3a,0x74,0x2e,0x74,0x79,0x70,0x65,0x2c,0x61,0x3d,0x21,0x31,0x3b,0x69,0x66,0x28,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6d,0x6f,0x76,0x65,0x22,0x3d,0x3d,0x3d,0x69,0x29,0x7b,0x69,0x66,0x28,0x21,0x6e,0x2e,0x6f,0x6e,0x48,0x6f,0x76,0x65,0x72,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x7d,0x65,0x6c,0x73,0x65,0x7b,0x69,0x66,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x21,0x3d,0x3d,0x69,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x3b,0x69,0x66,0x28,0x21,0x6e,0x2e,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x7d,0x76,0x61,0x72,0x20,0x6f,0x3d,0x74,0x2e,0x78,0x2c,0x72,0x3d,0x74,0x2e,0x79,0x3b,0x69,0x66,0x28,0x6f,0x3e,0x3d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x26,0x26,0x6f,0x3c,0x3d,0x65,0x2e,0x72,0x69,0x67,0x68,0x74,0x26,0x26,0x72,0x3e,0x3d,0x65,0x2e,0x74,0x6f,0x70,0x26,0x26,0x72,0x3c,0x3d,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6c,0x3d,0x65,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x48,0x69,0x74,0x42,0x6f,0x78,0x65,0x73,0x2c,0x73,0x3d,0x30,0x3b,0x73,0x3c,0x6c,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x73,0x29,0x7b,0x76,0x61,0x72,0x20,0x75,0x3d,0x6c,0x5b,0x73,0x5d,0x3b,0x69,0x66,0x28,0x6f,0x3e,0x3d,0x75,0x2e,0x6c,0x65,0x66,0x74,0x26,0x26,0x6f,0x3c,0x3d,0x75,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x75,0x2e,0x77,0x69,0x64,0x74,0x68,0x26,0x26,0x72,0x3e,0x3d,0x75,0x2e,0x74,0x6f,0x70,0x26,0x26,0x72,0x3c,0x3d,0x75,0x2e,0x74,0x6f,0x70,0x2b,0x75,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x7b,0x69,0x66,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x3d,0x3d,0x3d,0x69,0x29,0x7b,0x6e,0x2e,0x6f,0x6e,0x43,0x6c,0x69,0x63,0x6b,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x2c,0x74,0x2e,0x6e,0x61,0x74,0x69,0x76,0x65,0x2c,0x65,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x5b,0x73,0x5d,0x29,0x2c,0x61,0x3d,0x21,0x30,0x3b,0x62,0x72,0x65,0x61,0x6b,0x7d,0x69,0x66,0x28,0x22,0x6d,0x6f,0x75,0x73,0x65,0x6d,0x6f,0x76,0x65,0x22,0x3d,0x3d,0x3d,0x69,0x29,0x7b,0x6e,0x2e,0x6f,0x6e,0x48,0x6f,0x76,0x65,0x72,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x2c,0x74,0x2e,0x6e,0x61,0x74,0x69,0x76,0x65,0x2c,0x65,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x49,0x74,0x65,0x6d,0x73,0x5b,0x73,0x5d,0x29,0x2c,0x61,0x3d,0x21,0x30,0x3b,0x62,0x72,0x65,0x61,0x6b,0x7d,0x7d,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x7d,0x7d,0x29,0x2c,0x7b,0x69,0x64,0x3a,0x22,0x6c,0x65,0x67,0x65,0x6e,0x64,0x22,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x49,0x6e,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3b,0x65,0x26,0x26,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x2c,0x61,0x3d,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3b,0x65,0x3f,0x28,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x49,0x66,0x28,0x65,0x2c,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x29,0x2c,0x61,0x3f,0x28,0x72,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x65,0x28,0x74,0x2c,0x61,0x2c,0x65,0x29,0x2c,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x65,0x29,0x3a,0x6e,0x28,0x74,0x2c,0x65,0x29,0x29,0x3a,0x61,0x26,0x26,0x28,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x42,0x6f,0x78,0x28,0x74,0x2c,0x61,0x29,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x29,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x45,0x76,0x65,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x3b,0x6e,0x26,0x26,0x6e,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x45,0x76,0x65,0x6e,0x74,0x28,0x65,0x29,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x31,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x32,0x36,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x34,0x35,0x29,0x3b,0x69,0x2e,0x5f,0x73,0x65,0x74,0x28,0x22,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x22,0x2c,0x7b,0x74,0x69,0x74,0x6c,0x65,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x31,0x2c,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x3a,0x22,0x62,0x6f,0x6c,0x64,0x22,0x2c,0x66,0x75,0x6c,0x6c,0x57,0x69,0x64,0x74,0x68,0x3a,0x21,0x30,0x2c,0x6c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x3a,0x31,0x2e,0x32,0x2c,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x31,0x30,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x74,0x6f,0x70,0x22,0x2c,0x74,0x65,0x78,0x74,0x3a,0x22,0x22,0x2c,0x77,0x65,0x69,0x67,0x68,0x74,0x3a,0x32,0x65,0x33,0x7d,0x7d,0x29,0x2c,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x65,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x6e,0x65,0x77,0x20,0x74,0x2e,0x54,0x69,0x74,0x6c,0x65,0x28,0x7b,0x63,0x74,0x78,0x3a,0x65,0x2e,0x63,0x74,0x78,0x2c,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x69,0x2c,0x63,0x68,0x61,0x72,0x74,0x3a,0x65,0x7d,0x29,0x3b,0x6e,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x65,0x28,0x65,0x2c,0x61,0x2c,0x69,0x29,0x2c,0x6e,0x2e,0x61,0x64,0x64,0x42,0x6f,0x78,0x28,0x65,0x2c,0x61,0x29,0x2c,0x65,0x2e,0x74,0x69,0x74,0x6c,0x65,0x42,0x6c,0x6f,0x63,0x6b,0x3d,0x61,0x7d,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2c,0x72,0x3d,0x6f,0x2e,0x6e,0x6f,0x6f,0x70,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x54,0x69,0x74,0x6c,0x65,0x3d,0x61,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x6f,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x65,0x2c,0x74,0x29,0x2c,0x65,0x2e,0x6c,0x65,0x67,0x65,0x6e,0x64,0x48,0x69,0x74,0x42,0x6f,0x78,0x65,0x73,0x3d,0x5b,0x5d,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x72,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x69,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x3d,0x74,0x2c,0x69,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x3d,0x65,0x2c,0x69,0x2e,0x6d,0x61,0x72,0x67,0x69,0x6e,0x73,0x3d,0x6e,0x2c,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x69,0x2e,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x2c,0x69,0x2e,0x62,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x2c,0x69,0x2e,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x28,0x29,0x2c,0x69,0x2e,0x66,0x69,0x74,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x28,0x29,0x2c,0x69,0x2e,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x28,0x29,0x2c,0x69,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x72,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x72,0x2c,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x3b,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x6c,0x65,0x66,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x29,0x3a,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x74,0x2e,0x74,0x6f,0x70,0x3d,0x30,0x2c,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x4c,0x65,0x66,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x54,0x6f,0x70,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x3d,0x30,0x2c,0x74,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x42,0x6f,0x74,0x74,0x6f,0x6d,0x3d,0x30,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x3d,0x7b,0x77,0x69,0x64,0x74,0x68,0x3a,0x30,0x2c,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x30,0x7d,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x53,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x72,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x72,0x2c,0x62,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x72,0x2c,0x61,0x66,0x74,0x65,0x72,0x42,0x75,0x69,0x6c,0x64,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x72,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x46,0x69,0x74,0x3a,0x72,0x2c,0x66,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x6e,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x2c,0x72,0x3d,0x65,0x28,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x6c,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x53,0x69,0x7a,0x65,0x2c,0x73,0x3d,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x6e,0x2e,0x74,0x65,0x78,0x74,0x29,0x3f,0x6e,0x2e,0x74,0x65,0x78,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3a,0x31,0x2c,0x75,0x3d,0x6f,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x4c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x28,0x6e,0x2e,0x6c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x72,0x29,0x2c,0x64,0x3d,0x61,0x3f,0x73,0x2a,0x75,0x2b,0x32,0x2a,0x6e,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x30,0x3b,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x6c,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x6c,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x64,0x29,0x3a,0x28,0x6c,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x64,0x2c,0x6c,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x29,0x2c,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x6c,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x6c,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x7d,0x2c,0x61,0x66,0x74,0x65,0x72,0x46,0x69,0x74,0x3a,0x72,0x2c,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x74,0x6f,0x70,0x22,0x3d,0x3d,0x3d,0x74,0x7c,0x7c,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x3d,0x3d,0x3d,0x74,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x6e,0x3d,0x6f,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x61,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x72,0x3d,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x3b,0x69,0x66,0x28,0x61,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x2c,0x73,0x2c,0x75,0x2c,0x64,0x3d,0x6e,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x63,0x3d,0x6e,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x68,0x3d,0x6e,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x66,0x3d,0x6f,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x64,0x2c,0x63,0x2c,0x68,0x29,0x2c,0x67,0x3d,0x6f,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x6f,0x4c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x28,0x61,0x2e,0x6c,0x69,0x6e,0x65,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x64,0x29,0x2c,0x70,0x3d,0x67,0x2f,0x32,0x2b,0x61,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2c,0x76,0x3d,0x30,0x2c,0x6d,0x3d,0x74,0x2e,0x74,0x6f,0x70,0x2c,0x62,0x3d,0x74,0x2e,0x6c,0x65,0x66,0x74,0x2c,0x78,0x3d,0x74,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2c,0x79,0x3d,0x74,0x2e,0x72,0x69,0x67,0x68,0x74,0x3b,0x65,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x6e,0x28,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x72,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x2c,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x66,0x2c,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x73,0x3d,0x62,0x2b,0x28,0x79,0x2d,0x62,0x29,0x2f,0x32,0x2c,0x75,0x3d,0x6d,0x2b,0x70,0x2c,0x6c,0x3d,0x79,0x2d,0x62,0x29,0x3a,0x28,0x73,0x3d,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x61,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x62,0x2b,0x70,0x3a,0x79,0x2d,0x70,0x2c,0x75,0x3d,0x6d,0x2b,0x28,0x78,0x2d,0x6d,0x29,0x2f,0x32,0x2c,0x6c,0x3d,0x78,0x2d,0x6d,0x2c,0x76,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x28,0x22,0x6c,0x65,0x66,0x74,0x22,0x3d,0x3d,0x3d,0x61,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3f,0x2d,0x2e,0x35,0x3a,0x2e,0x35,0x29,0x29,0x2c,0x65,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x65,0x2e,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x28,0x73,0x2c,0x75,0x29,0x2c,0x65,0x2e,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x76,0x29,0x2c,0x65,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x65,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x3b,0x76,0x61,0x72,0x20,0x6b,0x3d,0x61,0x2e,0x74,0x65,0x78,0x74,0x3b,0x69,0x66,0x28,0x6f,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x6b,0x29,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x77,0x3d,0x30,0x2c,0x4d,0x3d,0x30,0x3b,0x4d,0x3c,0x6b,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x4d,0x29,0x65,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x6b,0x5b,0x4d,0x5d,0x2c,0x30,0x2c,0x77,0x2c,0x6c,0x29,0x2c,0x77,0x2b,0x3d,0x67,0x3b,0x65,0x6c,0x73,0x65,0x20,0x65,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x6b,0x2c,0x30,0x2c,0x30,0x2c,0x6c,0x29,0x3b,0x65,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x7d,0x7d,0x29,0x2c,0x7b,0x69,0x64,0x3a,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x49,0x6e,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x74,0x6c,0x65,0x3b,0x6e,0x26,0x26,0x65,0x28,0x74,0x2c,0x6e,0x29,0x7d,0x2c,0x62,0x65,0x66,0x6f,0x72,0x65,0x55,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x74,0x6c,0x65,0x2c,0x6c,0x3d,0x61,0x2e,0x74,0x69,0x74,0x6c,0x65,0x42,0x6c,0x6f,0x63,0x6b,0x3b,0x72,0x3f,0x28,0x6f,0x2e,0x6d,0x65,0x72,0x67,0x65,0x49,0x66,0x28,0x72,0x2c,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x74,0x69,0x74,0x6c,0x65,0x29,0x2c,0x6c,0x3f,0x28,0x6e,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x65,0x28,0x61,0x2c,0x6c,0x2c,0x72,0x29,0x2c,0x6c,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3d,0x72,0x29,0x3a,0x65,0x28,0x61,0x2c,0x72,0x29,0x29,0x3a,0x6c,0x26,0x26,0x28,0x74,0x2e,0x6c,0x61,0x79,0x6f,0x75,0x74,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x42,0x6f,0x78,0x28,0x61,0x2c,0x6c,0x29,0x2c,0x64,0x65,0x6c,0x65,0x74,0x65,0x20,0x61,0x2e,0x74,0x69,0x74,0x6c,0x65,0x42,0x6c,0x6f,0x63,0x6b,0x29,0x7d,0x7d,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x32,0x36,0x3a,0x32,0x36,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x32,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x7c,0x7c,0x28,0x74,0x68,0x69,0x73,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x74,0x2e,0x78,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x74,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x73,0x29,0x7c,0x7c,0x74,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x7d,0x2c,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x3b,0x74,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x3d,0x30,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x69,0x6e,0x26,0x26,0x28,0x6e,0x3d,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x69,0x6e,0x29,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x3d,0x2d,0x31,0x21,0x3d,0x3d,0x6e,0x3f,0x6e,0x3a,0x74,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x61,0x78,0x26,0x26,0x28,0x6e,0x3d,0x65,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x61,0x78,0x29,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x3d,0x2d,0x31,0x21,0x3d,0x3d,0x6e,0x3f,0x6e,0x3a,0x74,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x29,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x65,0x5b,0x74,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x5d,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x65,0x5b,0x74,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x5d,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x3b,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3d,0x30,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x26,0x26,0x74,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x3d,0x3d,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3f,0x65,0x3a,0x65,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x2b,0x31,0x29,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2c,0x61,0x3d,0x6e,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x79,0x4c,0x61,0x62,0x65,0x6c,0x73,0x26,0x26,0x21,0x61,0x3f,0x6e,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x69,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x65,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x5d,0x29,0x3a,0x6e,0x2e,0x74,0x69,0x63,0x6b,0x73,0x5b,0x74,0x2d,0x6e,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x5d,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x2c,0x6f,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x69,0x2e,0x6d,0x61,0x78,0x49,0x6e,0x64,0x65,0x78,0x2b,0x31,0x2d,0x69,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x2d,0x28,0x61,0x3f,0x30,0x3a,0x31,0x29,0x2c,0x31,0x29,0x3b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x26,0x26,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x74,0x26,0x26,0x28,0x6e,0x3d,0x69,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x74,0x2e,0x78,0x3a,0x74,0x2e,0x79,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6e,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x74,0x26,0x26,0x69,0x73,0x4e,0x61,0x4e,0x28,0x65,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x28,0x29,0x3b,0x74,0x3d,0x6e,0x7c,0x7c,0x74,0x3b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x72,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x29,0x3b,0x65,0x3d,0x2d,0x31,0x21,0x3d,0x3d,0x6c,0x3f,0x6c,0x3a,0x65,0x7d,0x69,0x66,0x28,0x69,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x6f,0x2c,0x75,0x3d,0x73,0x2a,0x28,0x65,0x2d,0x69,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x26,0x26,0x28,0x75,0x2b,0x3d,0x73,0x2f,0x32,0x29,0x2c,0x69,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x75,0x29,0x7d,0x76,0x61,0x72,0x20,0x64,0x3d,0x69,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x6f,0x2c,0x63,0x3d,0x64,0x2a,0x28,0x65,0x2d,0x69,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x26,0x26,0x28,0x63,0x2b,0x3d,0x64,0x2f,0x32,0x29,0x2c,0x69,0x2e,0x74,0x6f,0x70,0x2b,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x63,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x5b,0x74,0x5d,0x2c,0x74,0x2b,0x74,0x68,0x69,0x73,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x2c,0x6e,0x75,0x6c,0x6c,0x29,0x7d,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x46,0x6f,0x72,0x50,0x69,0x78,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x2c,0x69,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x5f,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x28,0x6e,0x3f,0x30,0x3a,0x31,0x29,0x2c,0x31,0x29,0x2c,0x61,0x3d,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x6f,0x3d,0x28,0x61,0x3f,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x29,0x2f,0x69,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2d,0x3d,0x61,0x3f,0x65,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x65,0x2e,0x74,0x6f,0x70,0x2c,0x6e,0x26,0x26,0x28,0x74,0x2d,0x3d,0x6f,0x2f,0x32,0x29,0x2c,0x28,0x74,0x3c,0x3d,0x30,0x3f,0x30,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x2f,0x6f,0x29,0x29,0x2b,0x65,0x2e,0x6d,0x69,0x6e,0x49,0x6e,0x64,0x65,0x78,0x7d,0x2c,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x69,0x78,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x7d,0x7d,0x29,0x3b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x54,0x79,0x70,0x65,0x28,0x22,0x63,0x61,0x74,0x65,0x67,0x6f,0x72,0x79,0x22,0x2c,0x65,0x2c,0x7b,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x7d,0x5d,0x2c,0x35,0x33,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x33,0x34,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x7b,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x74,0x69,0x63,0x6b,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x6f,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x74,0x65,0x72,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x61,0x72,0x7d,0x7d,0x2c,0x6e,0x3d,0x74,0x2e,0x4c,0x69,0x6e,0x65,0x61,0x72,0x53,0x63,0x61,0x6c,0x65,0x42,0x61,0x73,0x65,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x74,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x3f,0x74,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x3d,0x3d,0x65,0x2e,0x69,0x64,0x3a,0x74,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x3d,0x3d,0x65,0x2e,0x69,0x64,0x7d,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x6f,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x72,0x3d,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3b,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x6e,0x75,0x6c,0x6c,0x3b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x3b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6c,0x26,0x26,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x69,0x66,0x28,0x21,0x6c,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x3b,0x69,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x26,0x26,0x74,0x28,0x61,0x29,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x61,0x2e,0x73,0x74,0x61,0x63,0x6b,0x26,0x26,0x28,0x6c,0x3d,0x21,0x30,0x29,0x7d,0x7d,0x29,0x2c,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x7c,0x7c,0x6c,0x29,0x7b,0x76,0x61,0x72,0x20,0x73,0x3d,0x7b,0x7d,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x2c,0x72,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x72,0x29,0x2c,0x75,0x3d,0x5b,0x6c,0x2e,0x74,0x79,0x70,0x65,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6c,0x2e,0x73,0x74,0x61,0x63,0x6b,0x3f,0x72,0x3a,0x22,0x22,0x2c,0x6c,0x2e,0x73,0x74,0x61,0x63,0x6b,0x5d,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x2e,0x22,0x29,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x73,0x5b,0x75,0x5d,0x26,0x26,0x28,0x73,0x5b,0x75,0x5d,0x3d,0x7b,0x70,0x6f,0x73,0x69,0x74,0x69,0x76,0x65,0x56,0x61,0x6c,0x75,0x65,0x73,0x3a,0x5b,0x5d,0x2c,0x6e,0x65,0x67,0x61,0x74,0x69,0x76,0x65,0x56,0x61,0x6c,0x75,0x65,0x73,0x3a,0x5b,0x5d,0x7d,0x29,0x3b,0x76,0x61,0x72,0x20,0x64,0x3d,0x73,0x5b,0x75,0x5d,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x76,0x65,0x56,0x61,0x6c,0x75,0x65,0x73,0x2c,0x63,0x3d,0x73,0x5b,0x75,0x5d,0x2e,0x6e,0x65,0x67,0x61,0x74,0x69,0x76,0x65,0x56,0x61,0x6c,0x75,0x65,0x73,0x3b,0x69,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x72,0x29,0x26,0x26,0x74,0x28,0x6c,0x29,0x26,0x26,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6f,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x2b,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x3b,0x69,0x73,0x4e,0x61,0x4e,0x28,0x61,0x29,0x7c,0x7c,0x6c,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x28,0x64,0x5b,0x69,0x5d,0x3d,0x64,0x5b,0x69,0x5d,0x7c,0x7c,0x30,0x2c,0x63,0x5b,0x69,0x5d,0x3d,0x63,0x5b,0x69,0x5d,0x7c,0x7c,0x30,0x2c,0x6e,0x2e,0x72,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3f,0x64,0x5b,0x69,0x5d,0x3d,0x31,0x30,0x30,0x3a,0x61,0x3c,0x30,0x3f,0x63,0x5b,0x69,0x5d,0x2b,0x3d,0x61,0x3a,0x64,0x5b,0x69,0x5d,0x2b,0x3d,0x61,0x29,0x7d,0x29,0x7d,0x29,0x2c,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x2e,0x70,0x6f,0x73,0x69,0x74,0x69,0x76,0x65,0x56,0x61,0x6c,0x75,0x65,0x73,0x2e,0x63,0x6f,0x6e,0x63,0x61,0x74,0x28,0x74,0x2e,0x6e,0x65,0x67,0x61,0x74,0x69,0x76,0x65,0x56,0x61,0x6c,0x75,0x65,0x73,0x29,0x2c,0x69,0x3d,0x61,0x2e,0x6d,0x69,0x6e,0x28,0x6e,0x29,0x2c,0x6f,0x3d,0x61,0x2e,0x6d,0x61,0x78,0x28,0x6e,0x29,0x3b,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3f,0x69,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x2c,0x69,0x29,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x3f,0x6f,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2c,0x6f,0x29,0x7d,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6f,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x69,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6f,0x29,0x3b,0x69,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6f,0x29,0x26,0x26,0x74,0x28,0x72,0x29,0x26,0x26,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x2b,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x3b,0x69,0x73,0x4e,0x61,0x4e,0x28,0x69,0x29,0x7c,0x7c,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6e,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3f,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x3a,0x69,0x3c,0x65,0x2e,0x6d,0x69,0x6e,0x26,0x26,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x29,0x2c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x3f,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x3a,0x69,0x3e,0x65,0x2e,0x6d,0x61,0x78,0x26,0x26,0x28,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x29,0x29,0x7d,0x29,0x7d,0x29,0x3b,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x26,0x26,0x21,0x69,0x73,0x4e,0x61,0x4e,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x3f,0x65,0x2e,0x6d,0x69,0x6e,0x3a,0x30,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x73,0x46,0x69,0x6e,0x69,0x74,0x65,0x28,0x65,0x2e,0x6d,0x61,0x78,0x29,0x26,0x26,0x21,0x69,0x73,0x4e,0x61,0x4e,0x28,0x65,0x2e,0x6d,0x61,0x78,0x29,0x3f,0x65,0x2e,0x6d,0x61,0x78,0x3a,0x31,0x2c,0x74,0x68,0x69,0x73,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x54,0x69,0x63,0x6b,0x52,0x61,0x6e,0x67,0x65,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x28,0x29,0x7d,0x2c,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x4c,0x69,0x6d,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3b,0x69,0x66,0x28,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x29,0x74,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6e,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x3f,0x6e,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x3a,0x31,0x31,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x35,0x30,0x29,0x29,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x3b,0x74,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6e,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x3f,0x6e,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x3a,0x31,0x31,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x28,0x32,0x2a,0x6f,0x29,0x29,0x29,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x44,0x69,0x72,0x65,0x63,0x74,0x69,0x6f,0x6e,0x61,0x6c,0x43,0x68,0x61,0x6e,0x67,0x65,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x7c,0x7c,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x28,0x29,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x65,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x5d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x72,0x74,0x2c,0x61,0x3d,0x2b,0x6e,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x2c,0x6f,0x3d,0x6e,0x2e,0x65,0x6e,0x64,0x2d,0x69,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x65,0x3d,0x6e,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x6e,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x6f,0x2a,0x28,0x61,0x2d,0x69,0x29,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x65,0x29,0x29,0x3a,0x28,0x65,0x3d,0x6e,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x6e,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x6f,0x2a,0x28,0x61,0x2d,0x69,0x29,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x65,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x46,0x6f,0x72,0x50,0x69,0x78,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x69,0x3d,0x6e,0x3f,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x61,0x3d,0x28,0x6e,0x3f,0x74,0x2d,0x65,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x65,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x74,0x29,0x2f,0x69,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x2b,0x28,0x65,0x2e,0x65,0x6e,0x64,0x2d,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x29,0x2a,0x61,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x41,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x73,0x5b,0x74,0x5d,0x29,0x7d,0x7d,0x29,0x3b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x54,0x79,0x70,0x65,0x28,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x6e,0x2c,0x65,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x33,0x34,0x3a,0x33,0x34,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x34,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x33,0x34,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x69,0x2e,0x6e,0x6f,0x6f,0x70,0x3b,0x74,0x2e,0x4c,0x69,0x6e,0x65,0x61,0x72,0x53,0x63,0x61,0x6c,0x65,0x42,0x61,0x73,0x65,0x3d,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x65,0x3f,0x2b,0x65,0x3a,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x68,0x69,0x73,0x2c,0x65,0x29,0x7d,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x54,0x69,0x63,0x6b,0x52,0x61,0x6e,0x67,0x65,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3b,0x69,0x66,0x28,0x65,0x2e,0x62,0x65,0x67,0x69,0x6e,0x41,0x74,0x5a,0x65,0x72,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x69,0x2e,0x73,0x69,0x67,0x6e,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x73,0x69,0x67,0x6e,0x28,0x74,0x2e,0x6d,0x61,0x78,0x29,0x3b,0x6e,0x3c,0x30,0x26,0x26,0x61,0x3c,0x30,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x30,0x3a,0x6e,0x3e,0x30,0x26,0x26,0x61,0x3e,0x30,0x26,0x26,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x30,0x29,0x7d,0x76,0x61,0x72,0x20,0x6f,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x69,0x6e,0x2c,0x72,0x3d,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x7c,0x7c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x61,0x78,0x3b,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3f,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x69,0x6e,0x26,0x26,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x3f,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x69,0x6e,0x3a,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x69,0x6e,0x29,0x29,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x3a,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x61,0x78,0x26,0x26,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x61,0x78,0x3a,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x74,0x2e,0x6d,0x61,0x78,0x2c,0x65,0x2e,0x73,0x75,0x67,0x67,0x65,0x73,0x74,0x65,0x64,0x4d,0x61,0x78,0x29,0x29,0x2c,0x6f,0x21,0x3d,0x3d,0x72,0x26,0x26,0x74,0x2e,0x6d,0x69,0x6e,0x3e,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x26,0x26,0x28,0x6f,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x2b,0x31,0x3a,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x2d,0x31,0x29,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x3d,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x26,0x26,0x28,0x74,0x2e,0x6d,0x61,0x78,0x2b,0x2b,0x2c,0x65,0x2e,0x62,0x65,0x67,0x69,0x6e,0x41,0x74,0x5a,0x65,0x72,0x6f,0x7c,0x7c,0x74,0x2e,0x6d,0x69,0x6e,0x2d,0x2d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x4c,0x69,0x6d,0x69,0x74,0x3a,0x65,0x2c,0x68,0x61,0x6e,0x64,0x6c,0x65,0x44,0x69,0x72,0x65,0x63,0x74,0x69,0x6f,0x6e,0x61,0x6c,0x43,0x68,0x61,0x6e,0x67,0x65,0x73,0x3a,0x65,0x2c,0x62,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x6e,0x3d,0x74,0x2e,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x4c,0x69,0x6d,0x69,0x74,0x28,0x29,0x2c,0x6f,0x3d,0x7b,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x3a,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x32,0x2c,0x6e,0x29,0x2c,0x6d,0x69,0x6e,0x3a,0x65,0x2e,0x6d,0x69,0x6e,0x2c,0x6d,0x61,0x78,0x3a,0x65,0x2e,0x6d,0x61,0x78,0x2c,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x3a,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x66,0x69,0x78,0x65,0x64,0x53,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x2c,0x65,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x29,0x7d,0x2c,0x72,0x3d,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3d,0x61,0x2e,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x6f,0x72,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x61,0x72,0x28,0x6f,0x2c,0x74,0x29,0x3b,0x74,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x44,0x69,0x72,0x65,0x63,0x74,0x69,0x6f,0x6e,0x61,0x6c,0x43,0x68,0x61,0x6e,0x67,0x65,0x73,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x2e,0x6d,0x61,0x78,0x28,0x72,0x29,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x2e,0x6d,0x69,0x6e,0x28,0x72,0x29,0x2c,0x65,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x28,0x72,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x28,0x29,0x2c,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x2c,0x74,0x2e,0x65,0x6e,0x64,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x29,0x3a,0x28,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x74,0x2e,0x65,0x6e,0x64,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x29,0x7d,0x2c,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x65,0x2e,0x74,0x69,0x63,0x6b,0x73,0x41,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x73,0x3d,0x65,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x29,0x2c,0x65,0x2e,0x7a,0x65,0x72,0x6f,0x4c,0x69,0x6e,0x65,0x49,0x6e,0x64,0x65,0x78,0x3d,0x65,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x30,0x29,0x2c,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x29,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x33,0x34,0x3a,0x33,0x34,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x35,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x33,0x34,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x7b,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x65,0x66,0x74,0x22,0x2c,0x74,0x69,0x63,0x6b,0x73,0x3a,0x7b,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x61,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x74,0x65,0x72,0x73,0x2e,0x6c,0x6f,0x67,0x61,0x72,0x69,0x74,0x68,0x6d,0x69,0x63,0x7d,0x7d,0x2c,0x6e,0x3d,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x74,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x3f,0x74,0x2e,0x78,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x3d,0x3d,0x65,0x2e,0x69,0x64,0x3a,0x74,0x2e,0x79,0x41,0x78,0x69,0x73,0x49,0x44,0x3d,0x3d,0x3d,0x65,0x2e,0x69,0x64,0x7d,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x61,0x3d,0x6e,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x6f,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x72,0x3d,0x6f,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x6c,0x3d,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x73,0x3d,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3b,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x6e,0x75,0x6c,0x6c,0x2c,0x65,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x3d,0x6e,0x75,0x6c,0x6c,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x3b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x75,0x26,0x26,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x72,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x6e,0x29,0x7b,0x69,0x66,0x28,0x21,0x75,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x6e,0x29,0x3b,0x6f,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x6e,0x29,0x26,0x26,0x74,0x28,0x69,0x29,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x69,0x2e,0x73,0x74,0x61,0x63,0x6b,0x26,0x26,0x28,0x75,0x3d,0x21,0x30,0x29,0x7d,0x7d,0x29,0x2c,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x7c,0x7c,0x75,0x29,0x7b,0x76,0x61,0x72,0x20,0x64,0x3d,0x7b,0x7d,0x3b,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x72,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x61,0x2c,0x72,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x72,0x29,0x2c,0x73,0x3d,0x5b,0x6c,0x2e,0x74,0x79,0x70,0x65,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6e,0x2e,0x73,0x74,0x61,0x63,0x6b,0x65,0x64,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x6c,0x2e,0x73,0x74,0x61,0x63,0x6b,0x3f,0x72,0x3a,0x22,0x22,0x2c,0x6c,0x2e,0x73,0x74,0x61,0x63,0x6b,0x5d,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x2e,0x22,0x29,0x3b,0x6f,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x72,0x29,0x26,0x26,0x74,0x28,0x6c,0x29,0x26,0x26,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x3d,0x3d,0x3d,0x64,0x5b,0x73,0x5d,0x26,0x26,0x28,0x64,0x5b,0x73,0x5d,0x3d,0x5b,0x5d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x61,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x64,0x5b,0x73,0x5d,0x2c,0x6f,0x3d,0x2b,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x3b,0x69,0x73,0x4e,0x61,0x4e,0x28,0x6f,0x29,0x7c,0x7c,0x6c,0x2e,0x64,0x61,0x74,0x61,0x5b,0x69,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x28,0x61,0x5b,0x69,0x5d,0x3d,0x61,0x5b,0x69,0x5d,0x7c,0x7c,0x30,0x2c,0x6e,0x2e,0x72,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x50,0x6f,0x69,0x6e,0x74,0x73,0x3f,0x61,0x5b,0x69,0x5d,0x3d,0x31,0x30,0x30,0x3a,0x61,0x5b,0x69,0x5d,0x2b,0x3d,0x6f,0x29,0x7d,0x29,0x29,0x7d,0x29,0x2c,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x64,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x69,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x29,0x2c,0x61,0x3d,0x69,0x2e,0x6d,0x61,0x78,0x28,0x74,0x29,0x3b,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3f,0x6e,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x2c,0x6e,0x29,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x3f,0x61,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2c,0x61,0x29,0x7d,0x29,0x7d,0x65,0x6c,0x73,0x65,0x20,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x72,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x6f,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x61,0x29,0x3b,0x6f,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x61,0x29,0x26,0x26,0x74,0x28,0x72,0x29,0x26,0x26,0x69,0x2e,0x65,0x61,0x63,0x68,0x28,0x6e,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x2b,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x3b,0x69,0x73,0x4e,0x61,0x4e,0x28,0x69,0x29,0x7c,0x7c,0x72,0x2e,0x64,0x61,0x74,0x61,0x5b,0x6e,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3f,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x3a,0x69,0x3c,0x65,0x2e,0x6d,0x69,0x6e,0x26,0x26,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x29,0x2c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x3f,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x3a,0x69,0x3e,0x65,0x2e,0x6d,0x61,0x78,0x26,0x26,0x28,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x29,0x2c,0x30,0x21,0x3d,0x3d,0x69,0x26,0x26,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x7c,0x7c,0x69,0x3c,0x65,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x29,0x26,0x26,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x3d,0x69,0x29,0x29,0x7d,0x29,0x7d,0x29,0x3b,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x6c,0x28,0x61,0x2e,0x6d,0x69,0x6e,0x2c,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x6c,0x28,0x61,0x2e,0x6d,0x61,0x78,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x29,0x2c,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x3d,0x3d,0x65,0x2e,0x6d,0x61,0x78,0x26,0x26,0x28,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x26,0x26,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x65,0x2e,0x6d,0x69,0x6e,0x3f,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x29,0x2d,0x31,0x29,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x65,0x2e,0x6d,0x61,0x78,0x29,0x29,0x2b,0x31,0x29,0x29,0x3a,0x28,0x65,0x2e,0x6d,0x69,0x6e,0x3d,0x31,0x2c,0x65,0x2e,0x6d,0x61,0x78,0x3d,0x31,0x30,0x29,0x29,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x6e,0x3d,0x7b,0x6d,0x69,0x6e,0x3a,0x65,0x2e,0x6d,0x69,0x6e,0x2c,0x6d,0x61,0x78,0x3a,0x65,0x2e,0x6d,0x61,0x78,0x7d,0x2c,0x6f,0x3d,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3d,0x61,0x2e,0x67,0x65,0x6e,0x65,0x72,0x61,0x74,0x6f,0x72,0x73,0x2e,0x6c,0x6f,0x67,0x61,0x72,0x69,0x74,0x68,0x6d,0x69,0x63,0x28,0x6e,0x2c,0x74,0x29,0x3b,0x74,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x7c,0x7c,0x6f,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x28,0x29,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x2e,0x6d,0x61,0x78,0x28,0x6f,0x29,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x69,0x2e,0x6d,0x69,0x6e,0x28,0x6f,0x29,0x2c,0x65,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x28,0x6f,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x28,0x29,0x2c,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x2c,0x74,0x2e,0x65,0x6e,0x64,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x29,0x3a,0x28,0x74,0x2e,0x73,0x74,0x61,0x72,0x74,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x74,0x2e,0x65,0x6e,0x64,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x29,0x7d,0x2c,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x56,0x61,0x6c,0x75,0x65,0x73,0x3d,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x29,0x2c,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x65,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x5d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x56,0x61,0x6c,0x75,0x65,0x73,0x5b,0x74,0x5d,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x61,0x2c,0x6f,0x3d,0x74,0x68,0x69,0x73,0x2c,0x72,0x3d,0x6f,0x2e,0x73,0x74,0x61,0x72,0x74,0x2c,0x6c,0x3d,0x2b,0x6f,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x2c,0x73,0x3d,0x6f,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x61,0x3d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x65,0x6e,0x64,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x72,0x29,0x2c,0x30,0x3d,0x3d,0x3d,0x6c,0x3f,0x6e,0x3d,0x6f,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x28,0x65,0x3d,0x6f,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x6e,0x3d,0x6f,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x65,0x2f,0x61,0x2a,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6c,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x72,0x29,0x29,0x29,0x29,0x3a,0x28,0x65,0x3d,0x6f,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x30,0x21,0x3d,0x3d,0x72,0x7c,0x7c,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x30,0x3d,0x3d,0x3d,0x6f,0x2e,0x65,0x6e,0x64,0x26,0x26,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x28,0x61,0x3d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x73,0x74,0x61,0x72,0x74,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x29,0x2c,0x6e,0x3d,0x6c,0x3d,0x3d,0x3d,0x6f,0x2e,0x65,0x6e,0x64,0x3f,0x6f,0x2e,0x74,0x6f,0x70,0x3a,0x6c,0x3d,0x3d,0x3d,0x6f,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x3f,0x6f,0x2e,0x74,0x6f,0x70,0x2b,0x2e,0x30,0x32,0x2a,0x65,0x3a,0x6f,0x2e,0x74,0x6f,0x70,0x2b,0x2e,0x30,0x32,0x2a,0x65,0x2b,0x2e,0x39,0x38,0x2a,0x65,0x2f,0x61,0x2a,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6c,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x29,0x29,0x29,0x3a,0x30,0x3d,0x3d,0x3d,0x6c,0x3f,0x6e,0x3d,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x6f,0x2e,0x74,0x6f,0x70,0x3a,0x6f,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x28,0x61,0x3d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x65,0x6e,0x64,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x72,0x29,0x2c,0x65,0x3d,0x6f,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x6e,0x3d,0x6f,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x65,0x2f,0x61,0x2a,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6c,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x72,0x29,0x29,0x29,0x3a,0x28,0x61,0x3d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x65,0x6e,0x64,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x29,0x2c,0x6e,0x3d,0x6c,0x3d,0x3d,0x3d,0x72,0x3f,0x6f,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x6c,0x3d,0x3d,0x3d,0x6f,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x3f,0x6f,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x2e,0x30,0x32,0x2a,0x65,0x3a,0x6f,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x2e,0x30,0x32,0x2a,0x65,0x2d,0x2e,0x39,0x38,0x2a,0x65,0x2f,0x61,0x2a,0x28,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6c,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x6f,0x2e,0x6d,0x69,0x6e,0x4e,0x6f,0x74,0x5a,0x65,0x72,0x6f,0x29,0x29,0x29,0x29,0x2c,0x6e,0x7d,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x46,0x6f,0x72,0x50,0x69,0x78,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x61,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6f,0x3d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x61,0x2e,0x65,0x6e,0x64,0x29,0x2d,0x69,0x2e,0x6c,0x6f,0x67,0x31,0x30,0x28,0x61,0x2e,0x73,0x74,0x61,0x72,0x74,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x28,0x6e,0x3d,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x65,0x3d,0x61,0x2e,0x73,0x74,0x61,0x72,0x74,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x28,0x74,0x2d,0x61,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2a,0x6f,0x2f,0x6e,0x29,0x29,0x3a,0x28,0x6e,0x3d,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x70,0x6f,0x77,0x28,0x31,0x30,0x2c,0x28,0x61,0x2e,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x2d,0x74,0x29,0x2a,0x6f,0x2f,0x6e,0x29,0x2f,0x61,0x2e,0x73,0x74,0x61,0x72,0x74,0x29,0x2c,0x65,0x7d,0x7d,0x29,0x3b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x54,0x79,0x70,0x65,0x28,0x22,0x6c,0x6f,0x67,0x61,0x72,0x69,0x74,0x68,0x6d,0x69,0x63,0x22,0x2c,0x6e,0x2c,0x65,0x29,0x7d,0x7d,0x2c,0x7b,0x33,0x34,0x3a,0x33,0x34,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x36,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x61,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x6f,0x3d,0x74,0x28,0x33,0x34,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x65,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x61,0x6e,0x67,0x6c,0x65,0x4c,0x69,0x6e,0x65,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x7c,0x7c,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3f,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3a,0x30,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2c,0x6e,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x69,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x6f,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x73,0x69,0x7a,0x65,0x3a,0x6e,0x2c,0x73,0x74,0x79,0x6c,0x65,0x3a,0x69,0x2c,0x66,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x6f,0x2c,0x66,0x6f,0x6e,0x74,0x3a,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x6e,0x2c,0x69,0x2c,0x6f,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x6e,0x29,0x3f,0x7b,0x77,0x3a,0x61,0x2e,0x6c,0x6f,0x6e,0x67,0x65,0x73,0x74,0x54,0x65,0x78,0x74,0x28,0x74,0x2c,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x6e,0x29,0x2c,0x68,0x3a,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2a,0x65,0x2b,0x31,0x2e,0x35,0x2a,0x28,0x6e,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x29,0x2a,0x65,0x7d,0x3a,0x7b,0x77,0x3a,0x74,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x6e,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x68,0x3a,0x65,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3d,0x3d,0x3d,0x69,0x7c,0x7c,0x74,0x3d,0x3d,0x3d,0x61,0x3f,0x7b,0x73,0x74,0x61,0x72,0x74,0x3a,0x65,0x2d,0x6e,0x2f,0x32,0x2c,0x65,0x6e,0x64,0x3a,0x65,0x2b,0x6e,0x2f,0x32,0x7d,0x3a,0x74,0x3c,0x69,0x7c,0x7c,0x74,0x3e,0x61,0x3f,0x7b,0x73,0x74,0x61,0x72,0x74,0x3a,0x65,0x2d,0x6e,0x2d,0x35,0x2c,0x65,0x6e,0x64,0x3a,0x65,0x7d,0x3a,0x7b,0x73,0x74,0x61,0x72,0x74,0x3a,0x65,0x2c,0x65,0x6e,0x64,0x3a,0x65,0x2b,0x6e,0x2b,0x35,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x2c,0x6f,0x2c,0x73,0x2c,0x75,0x3d,0x6e,0x28,0x74,0x29,0x2c,0x64,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x2c,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x29,0x2c,0x63,0x3d,0x7b,0x72,0x3a,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x6c,0x3a,0x30,0x2c,0x74,0x3a,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x62,0x3a,0x30,0x7d,0x2c,0x68,0x3d,0x7b,0x7d,0x3b,0x74,0x2e,0x63,0x74,0x78,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x75,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x74,0x2e,0x5f,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x53,0x69,0x7a,0x65,0x73,0x3d,0x5b,0x5d,0x3b,0x76,0x61,0x72,0x20,0x66,0x3d,0x65,0x28,0x74,0x29,0x3b,0x66,0x6f,0x72,0x28,0x69,0x3d,0x30,0x3b,0x69,0x3c,0x66,0x3b,0x69,0x2b,0x2b,0x29,0x7b,0x73,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x69,0x2c,0x64,0x29,0x2c,0x6f,0x3d,0x72,0x28,0x74,0x2e,0x63,0x74,0x78,0x2c,0x75,0x2e,0x73,0x69,0x7a,0x65,0x2c,0x74,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x69,0x5d,0x7c,0x7c,0x22,0x22,0x29,0x2c,0x74,0x2e,0x5f,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x53,0x69,0x7a,0x65,0x73,0x5b,0x69,0x5d,0x3d,0x6f,0x3b,0x76,0x61,0x72,0x20,0x67,0x3d,0x74,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x41,0x6e,0x67,0x6c,0x65,0x28,0x69,0x29,0x2c,0x70,0x3d,0x61,0x2e,0x74,0x6f,0x44,0x65,0x67,0x72,0x65,0x65,0x73,0x28,0x67,0x29,0x25,0x33,0x36,0x30,0x2c,0x76,0x3d,0x6c,0x28,0x70,0x2c,0x73,0x2e,0x78,0x2c,0x6f,0x2e,0x77,0x2c,0x30,0x2c,0x31,0x38,0x30,0x29,0x2c,0x6d,0x3d,0x6c,0x28,0x70,0x2c,0x73,0x2e,0x79,0x2c,0x6f,0x2e,0x68,0x2c,0x39,0x30,0x2c,0x32,0x37,0x30,0x29,0x3b,0x76,0x2e,0x73,0x74,0x61,0x72,0x74,0x3c,0x63,0x2e,0x6c,0x26,0x26,0x28,0x63,0x2e,0x6c,0x3d,0x76,0x2e,0x73,0x74,0x61,0x72,0x74,0x2c,0x68,0x2e,0x6c,0x3d,0x67,0x29,0x2c,0x76,0x2e,0x65,0x6e,0x64,0x3e,0x63,0x2e,0x72,0x26,0x26,0x28,0x63,0x2e,0x72,0x3d,0x76,0x2e,0x65,0x6e,0x64,0x2c,0x68,0x2e,0x72,0x3d,0x67,0x29,0x2c,0x6d,0x2e,0x73,0x74,0x61,0x72,0x74,0x3c,0x63,0x2e,0x74,0x26,0x26,0x28,0x63,0x2e,0x74,0x3d,0x6d,0x2e,0x73,0x74,0x61,0x72,0x74,0x2c,0x68,0x2e,0x74,0x3d,0x67,0x29,0x2c,0x6d,0x2e,0x65,0x6e,0x64,0x3e,0x63,0x2e,0x62,0x26,0x26,0x28,0x63,0x2e,0x62,0x3d,0x6d,0x2e,0x65,0x6e,0x64,0x2c,0x68,0x2e,0x62,0x3d,0x67,0x29,0x7d,0x74,0x2e,0x73,0x65,0x74,0x52,0x65,0x64,0x75,0x63,0x74,0x69,0x6f,0x6e,0x73,0x28,0x64,0x2c,0x63,0x2c,0x68,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x2c,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x29,0x3b,0x74,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x65,0x29,0x2c,0x74,0x2e,0x73,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x28,0x30,0x2c,0x30,0x2c,0x30,0x2c,0x30,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x64,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3d,0x3d,0x3d,0x74,0x7c,0x7c,0x31,0x38,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x3a,0x74,0x3c,0x31,0x38,0x30,0x3f,0x22,0x6c,0x65,0x66,0x74,0x22,0x3a,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x63,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x69,0x66,0x28,0x61,0x2e,0x69,0x73,0x41,0x72,0x72,0x61,0x79,0x28,0x65,0x29,0x29,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x6f,0x3d,0x6e,0x2e,0x79,0x2c,0x72,0x3d,0x31,0x2e,0x35,0x2a,0x69,0x2c,0x6c,0x3d,0x30,0x3b,0x6c,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x2b,0x2b,0x6c,0x29,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x65,0x5b,0x6c,0x5d,0x2c,0x6e,0x2e,0x78,0x2c,0x6f,0x29,0x2c,0x6f,0x2b,0x3d,0x72,0x3b,0x65,0x6c,0x73,0x65,0x20,0x74,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x65,0x2c,0x6e,0x2e,0x78,0x2c,0x6e,0x2e,0x79,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x68,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x39,0x30,0x3d,0x3d,0x3d,0x74,0x7c,0x7c,0x32,0x37,0x30,0x3d,0x3d,0x3d,0x74,0x3f,0x6e,0x2e,0x79,0x2d,0x3d,0x65,0x2e,0x68,0x2f,0x32,0x3a,0x28,0x74,0x3e,0x32,0x37,0x30,0x7c,0x7c,0x74,0x3c,0x39,0x30,0x29,0x26,0x26,0x28,0x6e,0x2e,0x79,0x2d,0x3d,0x65,0x2e,0x68,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x66,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x6f,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x2c,0x72,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x6c,0x3d,0x72,0x2e,0x61,0x6e,0x67,0x6c,0x65,0x4c,0x69,0x6e,0x65,0x73,0x2c,0x73,0x3d,0x72,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3b,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x6c,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x6c,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x3b,0x76,0x61,0x72,0x20,0x75,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x46,0x72,0x6f,0x6d,0x43,0x65,0x6e,0x74,0x65,0x72,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x72,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x74,0x2e,0x6d,0x69,0x6e,0x3a,0x74,0x2e,0x6d,0x61,0x78,0x29,0x2c,0x66,0x3d,0x6e,0x28,0x74,0x29,0x3b,0x69,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x74,0x6f,0x70,0x22,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x67,0x3d,0x65,0x28,0x74,0x29,0x2d,0x31,0x3b,0x67,0x3e,0x3d,0x30,0x3b,0x67,0x2d,0x2d,0x29,0x7b,0x69,0x66,0x28,0x6c,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x70,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x67,0x2c,0x75,0x29,0x3b,0x69,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x69,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x74,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x74,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x29,0x2c,0x69,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x70,0x2e,0x78,0x2c,0x70,0x2e,0x79,0x29,0x2c,0x69,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x2c,0x69,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x7d,0x69,0x66,0x28,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x6d,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x67,0x2c,0x75,0x2b,0x35,0x29,0x2c,0x62,0x3d,0x6f,0x28,0x73,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x3b,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x66,0x2e,0x66,0x6f,0x6e,0x74,0x2c,0x69,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x62,0x3b,0x76,0x61,0x72,0x20,0x78,0x3d,0x74,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x41,0x6e,0x67,0x6c,0x65,0x28,0x67,0x29,0x2c,0x79,0x3d,0x61,0x2e,0x74,0x6f,0x44,0x65,0x67,0x72,0x65,0x65,0x73,0x28,0x78,0x29,0x3b,0x69,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x64,0x28,0x79,0x29,0x2c,0x68,0x28,0x79,0x2c,0x74,0x2e,0x5f,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x53,0x69,0x7a,0x65,0x73,0x5b,0x67,0x5d,0x2c,0x6d,0x29,0x2c,0x63,0x28,0x69,0x2c,0x74,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x67,0x5d,0x7c,0x7c,0x22,0x22,0x2c,0x6d,0x2c,0x66,0x2e,0x73,0x69,0x7a,0x65,0x29,0x7d,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x67,0x28,0x74,0x2c,0x6e,0x2c,0x69,0x2c,0x6f,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x74,0x2e,0x63,0x74,0x78,0x3b,0x69,0x66,0x28,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x53,0x74,0x79,0x6c,0x65,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2c,0x6f,0x2d,0x31,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x41,0x74,0x49,0x6e,0x64,0x65,0x78,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x2c,0x6f,0x2d,0x31,0x29,0x2c,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x2e,0x63,0x69,0x72,0x63,0x75,0x6c,0x61,0x72,0x29,0x72,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x72,0x2e,0x61,0x72,0x63,0x28,0x74,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x74,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x69,0x2c,0x30,0x2c,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x29,0x2c,0x72,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x65,0x28,0x74,0x29,0x3b,0x69,0x66,0x28,0x30,0x3d,0x3d,0x3d,0x6c,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x3b,0x72,0x2e,0x62,0x65,0x67,0x69,0x6e,0x50,0x61,0x74,0x68,0x28,0x29,0x3b,0x76,0x61,0x72,0x20,0x73,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x30,0x2c,0x69,0x29,0x3b,0x72,0x2e,0x6d,0x6f,0x76,0x65,0x54,0x6f,0x28,0x73,0x2e,0x78,0x2c,0x73,0x2e,0x79,0x29,0x3b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x75,0x3d,0x31,0x3b,0x75,0x3c,0x6c,0x3b,0x75,0x2b,0x2b,0x29,0x73,0x3d,0x74,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x75,0x2c,0x69,0x29,0x2c,0x72,0x2e,0x6c,0x69,0x6e,0x65,0x54,0x6f,0x28,0x73,0x2e,0x78,0x2c,0x73,0x2e,0x79,0x29,0x3b,0x72,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x50,0x61,0x74,0x68,0x28,0x29,0x2c,0x72,0x2e,0x73,0x74,0x72,0x6f,0x6b,0x65,0x28,0x29,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x70,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x69,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x28,0x74,0x29,0x3f,0x74,0x3a,0x30,0x7d,0x76,0x61,0x72,0x20,0x76,0x3d,0x69,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2c,0x6d,0x3d,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x61,0x6e,0x69,0x6d,0x61,0x74,0x65,0x3a,0x21,0x30,0x2c,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x63,0x68,0x61,0x72,0x74,0x41,0x72,0x65,0x61,0x22,0x2c,0x61,0x6e,0x67,0x6c,0x65,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2e,0x31,0x29,0x22,0x2c,0x6c,0x69,0x6e,0x65,0x57,0x69,0x64,0x74,0x68,0x3a,0x31,0x7d,0x2c,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x3a,0x7b,0x63,0x69,0x72,0x63,0x75,0x6c,0x61,0x72,0x3a,0x21,0x31,0x7d,0x2c,0x74,0x69,0x63,0x6b,0x73,0x3a,0x7b,0x73,0x68,0x6f,0x77,0x4c,0x61,0x62,0x65,0x6c,0x42,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x3a,0x21,0x30,0x2c,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x43,0x6f,0x6c,0x6f,0x72,0x3a,0x22,0x72,0x67,0x62,0x61,0x28,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x32,0x35,0x35,0x2c,0x30,0x2e,0x37,0x35,0x29,0x22,0x2c,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x59,0x3a,0x32,0x2c,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x58,0x3a,0x32,0x2c,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x6f,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x74,0x65,0x72,0x73,0x2e,0x6c,0x69,0x6e,0x65,0x61,0x72,0x7d,0x2c,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x7b,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x21,0x30,0x2c,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x3a,0x31,0x30,0x2c,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x7d,0x7d,0x7d,0x2c,0x62,0x3d,0x74,0x2e,0x4c,0x69,0x6e,0x65,0x61,0x72,0x53,0x63,0x61,0x6c,0x65,0x42,0x61,0x73,0x65,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x73,0x65,0x74,0x44,0x69,0x6d,0x65,0x6e,0x73,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x74,0x69,0x63,0x6b,0x73,0x3b,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x57,0x69,0x64,0x74,0x68,0x2c,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x48,0x65,0x69,0x67,0x68,0x74,0x2c,0x74,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x2f,0x32,0x29,0x2c,0x74,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2f,0x32,0x29,0x3b,0x76,0x61,0x72,0x20,0x69,0x3d,0x61,0x2e,0x6d,0x69,0x6e,0x28,0x5b,0x74,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x74,0x2e,0x77,0x69,0x64,0x74,0x68,0x5d,0x29,0x2c,0x6f,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x3b,0x74,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x3d,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3f,0x69,0x2f,0x32,0x2d,0x28,0x6f,0x2f,0x32,0x2b,0x6e,0x2e,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x59,0x29,0x3a,0x69,0x2f,0x32,0x7d,0x2c,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x6e,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x50,0x4f,0x53,0x49,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x2c,0x69,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x4e,0x45,0x47,0x41,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x65,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x2c,0x72,0x29,0x7b,0x69,0x66,0x28,0x65,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x72,0x29,0x29,0x7b,0x76,0x61,0x72,0x20,0x6c,0x3d,0x65,0x2e,0x67,0x65,0x74,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x4d,0x65,0x74,0x61,0x28,0x72,0x29,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x6f,0x2e,0x64,0x61,0x74,0x61,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x3d,0x2b,0x74,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x65,0x29,0x3b,0x69,0x73,0x4e,0x61,0x4e,0x28,0x6f,0x29,0x7c,0x7c,0x6c,0x2e,0x64,0x61,0x74,0x61,0x5b,0x61,0x5d,0x2e,0x68,0x69,0x64,0x64,0x65,0x6e,0x7c,0x7c,0x28,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x6f,0x2c,0x6e,0x29,0x2c,0x69,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x6f,0x2c,0x69,0x29,0x29,0x7d,0x29,0x7d,0x7d,0x29,0x2c,0x74,0x2e,0x6d,0x69,0x6e,0x3d,0x6e,0x3d,0x3d,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x50,0x4f,0x53,0x49,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x3f,0x30,0x3a,0x6e,0x2c,0x74,0x2e,0x6d,0x61,0x78,0x3d,0x69,0x3d,0x3d,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x4e,0x45,0x47,0x41,0x54,0x49,0x56,0x45,0x5f,0x49,0x4e,0x46,0x49,0x4e,0x49,0x54,0x59,0x3f,0x30,0x3a,0x69,0x2c,0x74,0x2e,0x68,0x61,0x6e,0x64,0x6c,0x65,0x54,0x69,0x63,0x6b,0x52,0x61,0x6e,0x67,0x65,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x28,0x29,0x7d,0x2c,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x4c,0x69,0x6d,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x65,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x74,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x74,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x3f,0x74,0x2e,0x6d,0x61,0x78,0x54,0x69,0x63,0x6b,0x73,0x4c,0x69,0x6d,0x69,0x74,0x3a,0x31,0x31,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x74,0x68,0x69,0x73,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x2f,0x28,0x31,0x2e,0x35,0x2a,0x65,0x29,0x29,0x29,0x7d,0x2c,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x74,0x2e,0x4c,0x69,0x6e,0x65,0x61,0x72,0x53,0x63,0x61,0x6c,0x65,0x42,0x61,0x73,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x65,0x29,0x2c,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3d,0x65,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6d,0x61,0x70,0x28,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x2c,0x65,0x29,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x2b,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x65,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x5d,0x29,0x7d,0x2c,0x66,0x69,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x74,0x68,0x69,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3f,0x73,0x28,0x74,0x68,0x69,0x73,0x29,0x3a,0x75,0x28,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x73,0x65,0x74,0x52,0x65,0x64,0x75,0x63,0x74,0x69,0x6f,0x6e,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x65,0x2e,0x6c,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x6e,0x2e,0x6c,0x29,0x2c,0x6f,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x72,0x2d,0x69,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x30,0x29,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x6e,0x2e,0x72,0x29,0x2c,0x72,0x3d,0x2d,0x65,0x2e,0x74,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x6e,0x2e,0x74,0x29,0x2c,0x6c,0x3d,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x65,0x2e,0x62,0x2d,0x69,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x30,0x29,0x2f,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x6e,0x2e,0x62,0x29,0x3b,0x61,0x3d,0x70,0x28,0x61,0x29,0x2c,0x6f,0x3d,0x70,0x28,0x6f,0x29,0x2c,0x72,0x3d,0x70,0x28,0x72,0x29,0x2c,0x6c,0x3d,0x70,0x28,0x6c,0x29,0x2c,0x69,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x2d,0x28,0x61,0x2b,0x6f,0x29,0x2f,0x32,0x29,0x2c,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x74,0x2d,0x28,0x72,0x2b,0x6c,0x29,0x2f,0x32,0x29,0x29,0x2c,0x69,0x2e,0x73,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x28,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x29,0x7d,0x2c,0x73,0x65,0x74,0x43,0x65,0x6e,0x74,0x65,0x72,0x50,0x6f,0x69,0x6e,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6f,0x3d,0x61,0x2e,0x77,0x69,0x64,0x74,0x68,0x2d,0x65,0x2d,0x61,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x2c,0x72,0x3d,0x74,0x2b,0x61,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x2c,0x6c,0x3d,0x6e,0x2b,0x61,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x2c,0x73,0x3d,0x61,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2d,0x69,0x2d,0x61,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x3b,0x61,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x28,0x72,0x2b,0x6f,0x29,0x2f,0x32,0x2b,0x61,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2c,0x61,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x28,0x6c,0x2b,0x73,0x29,0x2f,0x32,0x2b,0x61,0x2e,0x74,0x6f,0x70,0x29,0x7d,0x2c,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2a,0x28,0x32,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x65,0x28,0x74,0x68,0x69,0x73,0x29,0x29,0x2b,0x28,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x26,0x26,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x3f,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x73,0x74,0x61,0x72,0x74,0x41,0x6e,0x67,0x6c,0x65,0x3a,0x30,0x29,0x2a,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2a,0x32,0x2f,0x33,0x36,0x30,0x7d,0x2c,0x67,0x65,0x74,0x44,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x46,0x72,0x6f,0x6d,0x43,0x65,0x6e,0x74,0x65,0x72,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x3b,0x69,0x66,0x28,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x74,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x30,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x64,0x72,0x61,0x77,0x69,0x6e,0x67,0x41,0x72,0x65,0x61,0x2f,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2d,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x3f,0x28,0x65,0x2e,0x6d,0x61,0x78,0x2d,0x74,0x29,0x2a,0x6e,0x3a,0x28,0x74,0x2d,0x65,0x2e,0x6d,0x69,0x6e,0x29,0x2a,0x6e,0x7d,0x2c,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x41,0x6e,0x67,0x6c,0x65,0x28,0x74,0x29,0x2d,0x4d,0x61,0x74,0x68,0x2e,0x50,0x49,0x2f,0x32,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x78,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x69,0x29,0x2a,0x65,0x29,0x2b,0x6e,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x79,0x3a,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x69,0x29,0x2a,0x65,0x29,0x2b,0x6e,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x7d,0x7d,0x2c,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x44,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x46,0x72,0x6f,0x6d,0x43,0x65,0x6e,0x74,0x65,0x72,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x65,0x29,0x29,0x7d,0x2c,0x67,0x65,0x74,0x42,0x61,0x73,0x65,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6d,0x69,0x6e,0x2c,0x6e,0x3d,0x74,0x2e,0x6d,0x61,0x78,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2e,0x67,0x65,0x74,0x50,0x6f,0x69,0x6e,0x74,0x50,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x30,0x2c,0x74,0x2e,0x62,0x65,0x67,0x69,0x6e,0x41,0x74,0x5a,0x65,0x72,0x6f,0x3f,0x30,0x3a,0x65,0x3c,0x30,0x26,0x26,0x6e,0x3c,0x30,0x3f,0x6e,0x3a,0x65,0x3e,0x30,0x26,0x26,0x6e,0x3e,0x30,0x3f,0x65,0x3a,0x30,0x29,0x7d,0x2c,0x64,0x72,0x61,0x77,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x3d,0x74,0x68,0x69,0x73,0x2c,0x65,0x3d,0x74,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x67,0x72,0x69,0x64,0x4c,0x69,0x6e,0x65,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x6f,0x3d,0x61,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x3b,0x69,0x66,0x28,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x72,0x3d,0x74,0x2e,0x63,0x74,0x78,0x2c,0x6c,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x49,0x6e,0x64,0x65,0x78,0x41,0x6e,0x67,0x6c,0x65,0x28,0x30,0x29,0x2c,0x73,0x3d,0x6f,0x28,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2c,0x75,0x3d,0x6f,0x28,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x74,0x79,0x6c,0x65,0x29,0x2c,0x64,0x3d,0x6f,0x28,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x46,0x61,0x6d,0x69,0x6c,0x79,0x29,0x2c,0x63,0x3d,0x61,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x73,0x2c,0x75,0x2c,0x64,0x29,0x3b,0x61,0x2e,0x65,0x61,0x63,0x68,0x28,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x2c,0x61,0x29,0x7b,0x69,0x66,0x28,0x61,0x3e,0x30,0x7c,0x7c,0x69,0x2e,0x72,0x65,0x76,0x65,0x72,0x73,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x75,0x3d,0x74,0x2e,0x67,0x65,0x74,0x44,0x69,0x73,0x74,0x61,0x6e,0x63,0x65,0x46,0x72,0x6f,0x6d,0x43,0x65,0x6e,0x74,0x65,0x72,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x2e,0x74,0x69,0x63,0x6b,0x73,0x41,0x73,0x4e,0x75,0x6d,0x62,0x65,0x72,0x73,0x5b,0x61,0x5d,0x29,0x3b,0x69,0x66,0x28,0x6e,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x26,0x26,0x30,0x21,0x3d,0x3d,0x61,0x26,0x26,0x67,0x28,0x74,0x2c,0x6e,0x2c,0x75,0x2c,0x61,0x29,0x2c,0x69,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x7b,0x76,0x61,0x72,0x20,0x64,0x3d,0x6f,0x28,0x69,0x2e,0x66,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x76,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x43,0x6f,0x6c,0x6f,0x72,0x29,0x3b,0x69,0x66,0x28,0x72,0x2e,0x66,0x6f,0x6e,0x74,0x3d,0x63,0x2c,0x72,0x2e,0x73,0x61,0x76,0x65,0x28,0x29,0x2c,0x72,0x2e,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x28,0x74,0x2e,0x78,0x43,0x65,0x6e,0x74,0x65,0x72,0x2c,0x74,0x2e,0x79,0x43,0x65,0x6e,0x74,0x65,0x72,0x29,0x2c,0x72,0x2e,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x6c,0x29,0x2c,0x69,0x2e,0x73,0x68,0x6f,0x77,0x4c,0x61,0x62,0x65,0x6c,0x42,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x29,0x7b,0x76,0x61,0x72,0x20,0x68,0x3d,0x72,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x65,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x3b,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x69,0x2e,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x43,0x6f,0x6c,0x6f,0x72,0x2c,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x52,0x65,0x63,0x74,0x28,0x2d,0x68,0x2f,0x32,0x2d,0x69,0x2e,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x58,0x2c,0x2d,0x75,0x2d,0x73,0x2f,0x32,0x2d,0x69,0x2e,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x59,0x2c,0x68,0x2b,0x32,0x2a,0x69,0x2e,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x58,0x2c,0x73,0x2b,0x32,0x2a,0x69,0x2e,0x62,0x61,0x63,0x6b,0x64,0x72,0x6f,0x70,0x50,0x61,0x64,0x64,0x69,0x6e,0x67,0x59,0x29,0x7d,0x72,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x3d,0x22,0x63,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x72,0x2e,0x74,0x65,0x78,0x74,0x42,0x61,0x73,0x65,0x6c,0x69,0x6e,0x65,0x3d,0x22,0x6d,0x69,0x64,0x64,0x6c,0x65,0x22,0x2c,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x53,0x74,0x79,0x6c,0x65,0x3d,0x64,0x2c,0x72,0x2e,0x66,0x69,0x6c,0x6c,0x54,0x65,0x78,0x74,0x28,0x65,0x2c,0x30,0x2c,0x2d,0x75,0x29,0x2c,0x72,0x2e,0x72,0x65,0x73,0x74,0x6f,0x72,0x65,0x28,0x29,0x7d,0x7d,0x7d,0x29,0x2c,0x28,0x65,0x2e,0x61,0x6e,0x67,0x6c,0x65,0x4c,0x69,0x6e,0x65,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x7c,0x7c,0x65,0x2e,0x70,0x6f,0x69,0x6e,0x74,0x4c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x29,0x26,0x26,0x66,0x28,0x74,0x29,0x7d,0x7d,0x7d,0x29,0x3b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x54,0x79,0x70,0x65,0x28,0x22,0x72,0x61,0x64,0x69,0x61,0x6c,0x4c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x62,0x2c,0x6d,0x29,0x7d,0x7d,0x2c,0x7b,0x32,0x35,0x3a,0x32,0x35,0x2c,0x33,0x34,0x3a,0x33,0x34,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x2c,0x35,0x37,0x3a,0x5b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x22,0x75,0x73,0x65,0x20,0x73,0x74,0x72,0x69,0x63,0x74,0x22,0x3b,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x69,0x28,0x74,0x2c,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x2d,0x65,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x61,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x3d,0x7b,0x7d,0x2c,0x6f,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x61,0x5b,0x69,0x3d,0x74,0x5b,0x65,0x5d,0x5d,0x7c,0x7c,0x28,0x61,0x5b,0x69,0x5d,0x3d,0x21,0x30,0x2c,0x6f,0x2e,0x70,0x75,0x73,0x68,0x28,0x69,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6f,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x69,0x66,0x28,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x3d,0x3d,0x3d,0x69,0x7c,0x7c,0x21,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x5b,0x7b,0x74,0x69,0x6d,0x65,0x3a,0x65,0x2c,0x70,0x6f,0x73,0x3a,0x30,0x7d,0x2c,0x7b,0x74,0x69,0x6d,0x65,0x3a,0x6e,0x2c,0x70,0x6f,0x73,0x3a,0x31,0x7d,0x5d,0x3b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x2c,0x75,0x3d,0x5b,0x5d,0x2c,0x64,0x3d,0x5b,0x65,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x6f,0x3b,0x2b,0x2b,0x61,0x29,0x28,0x6c,0x3d,0x74,0x5b,0x61,0x5d,0x29,0x3e,0x65,0x26,0x26,0x6c,0x3c,0x6e,0x26,0x26,0x64,0x2e,0x70,0x75,0x73,0x68,0x28,0x6c,0x29,0x3b,0x66,0x6f,0x72,0x28,0x64,0x2e,0x70,0x75,0x73,0x68,0x28,0x6e,0x29,0x2c,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x6f,0x3b,0x2b,0x2b,0x61,0x29,0x73,0x3d,0x64,0x5b,0x61,0x2b,0x31,0x5d,0x2c,0x72,0x3d,0x64,0x5b,0x61,0x2d,0x31,0x5d,0x2c,0x6c,0x3d,0x64,0x5b,0x61,0x5d,0x2c,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x72,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x73,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x28,0x28,0x73,0x2b,0x72,0x29,0x2f,0x32,0x29,0x3d,0x3d,0x3d,0x6c,0x7c,0x7c,0x75,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x74,0x69,0x6d,0x65,0x3a,0x6c,0x2c,0x70,0x6f,0x73,0x3a,0x61,0x2f,0x28,0x6f,0x2d,0x31,0x29,0x7d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x72,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x30,0x2c,0x6c,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3b,0x72,0x3e,0x3d,0x30,0x26,0x26,0x72,0x3c,0x3d,0x6c,0x3b,0x29,0x7b,0x69,0x66,0x28,0x69,0x3d,0x72,0x2b,0x6c,0x3e,0x3e,0x31,0x2c,0x61,0x3d,0x74,0x5b,0x69,0x2d,0x31,0x5d,0x7c,0x7c,0x6e,0x75,0x6c,0x6c,0x2c,0x6f,0x3d,0x74,0x5b,0x69,0x5d,0x2c,0x21,0x61,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6c,0x6f,0x3a,0x6e,0x75,0x6c,0x6c,0x2c,0x68,0x69,0x3a,0x6f,0x7d,0x3b,0x69,0x66,0x28,0x6f,0x5b,0x65,0x5d,0x3c,0x6e,0x29,0x72,0x3d,0x69,0x2b,0x31,0x3b,0x65,0x6c,0x73,0x65,0x7b,0x69,0x66,0x28,0x21,0x28,0x61,0x5b,0x65,0x5d,0x3e,0x6e,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6c,0x6f,0x3a,0x61,0x2c,0x68,0x69,0x3a,0x6f,0x7d,0x3b,0x6c,0x3d,0x69,0x2d,0x31,0x7d,0x7d,0x72,0x65,0x74,0x75,0x72,0x6e,0x7b,0x6c,0x6f,0x3a,0x6f,0x2c,0x68,0x69,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x6c,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x72,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x2c,0x6f,0x3d,0x61,0x2e,0x6c,0x6f,0x3f,0x61,0x2e,0x68,0x69,0x3f,0x61,0x2e,0x6c,0x6f,0x3a,0x74,0x5b,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x32,0x5d,0x3a,0x74,0x5b,0x30,0x5d,0x2c,0x6c,0x3d,0x61,0x2e,0x6c,0x6f,0x3f,0x61,0x2e,0x68,0x69,0x3f,0x61,0x2e,0x68,0x69,0x3a,0x74,0x5b,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x3a,0x74,0x5b,0x31,0x5d,0x2c,0x73,0x3d,0x6c,0x5b,0x65,0x5d,0x2d,0x6f,0x5b,0x65,0x5d,0x2c,0x75,0x3d,0x73,0x3f,0x28,0x6e,0x2d,0x6f,0x5b,0x65,0x5d,0x29,0x2f,0x73,0x3a,0x30,0x2c,0x64,0x3d,0x28,0x6c,0x5b,0x69,0x5d,0x2d,0x6f,0x5b,0x69,0x5d,0x29,0x2a,0x75,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x5b,0x69,0x5d,0x2b,0x64,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x73,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x70,0x61,0x72,0x73,0x65,0x72,0x2c,0x69,0x3d,0x65,0x2e,0x70,0x61,0x72,0x73,0x65,0x72,0x7c,0x7c,0x65,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6e,0x3f,0x6e,0x28,0x74,0x29,0x3a,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x74,0x26,0x26,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x3f,0x6d,0x28,0x74,0x2c,0x69,0x29,0x3a,0x28,0x74,0x20,0x69,0x6e,0x73,0x74,0x61,0x6e,0x63,0x65,0x6f,0x66,0x20,0x6d,0x7c,0x7c,0x28,0x74,0x3d,0x6d,0x28,0x74,0x29,0x29,0x2c,0x74,0x2e,0x69,0x73,0x56,0x61,0x6c,0x69,0x64,0x28,0x29,0x3f,0x74,0x3a,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x3f,0x69,0x28,0x74,0x29,0x3a,0x74,0x29,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x75,0x28,0x74,0x2c,0x65,0x29,0x7b,0x69,0x66,0x28,0x78,0x2e,0x69,0x73,0x4e,0x75,0x6c,0x6c,0x4f,0x72,0x55,0x6e,0x64,0x65,0x66,0x28,0x74,0x29,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x75,0x6c,0x6c,0x3b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x6d,0x65,0x2c,0x69,0x3d,0x73,0x28,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x74,0x29,0x2c,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x69,0x73,0x56,0x61,0x6c,0x69,0x64,0x28,0x29,0x3f,0x28,0x6e,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x26,0x26,0x69,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x6e,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x29,0x2c,0x69,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x66,0x28,0x29,0x29,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x64,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x3d,0x65,0x2d,0x74,0x2c,0x73,0x3d,0x77,0x5b,0x6e,0x5d,0x2c,0x75,0x3d,0x73,0x2e,0x73,0x69,0x7a,0x65,0x2c,0x64,0x3d,0x73,0x2e,0x73,0x74,0x65,0x70,0x73,0x3b,0x69,0x66,0x28,0x21,0x64,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x6c,0x2f,0x28,0x28,0x69,0x7c,0x7c,0x31,0x29,0x2a,0x75,0x29,0x29,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x30,0x2c,0x6f,0x3d,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x61,0x3c,0x6f,0x26,0x26,0x28,0x72,0x3d,0x64,0x5b,0x61,0x5d,0x2c,0x21,0x28,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x6c,0x2f,0x28,0x75,0x2a,0x72,0x29,0x29,0x3c,0x3d,0x69,0x29,0x29,0x3b,0x2b,0x2b,0x61,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x63,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x3d,0x4d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x4d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x29,0x3b,0x61,0x3c,0x6c,0x2d,0x31,0x3b,0x2b,0x2b,0x61,0x29,0x69,0x66,0x28,0x6f,0x3d,0x77,0x5b,0x4d,0x5b,0x61,0x5d,0x5d,0x2c,0x72,0x3d,0x6f,0x2e,0x73,0x74,0x65,0x70,0x73,0x3f,0x6f,0x2e,0x73,0x74,0x65,0x70,0x73,0x5b,0x6f,0x2e,0x73,0x74,0x65,0x70,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x3a,0x6b,0x2c,0x6f,0x2e,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x26,0x26,0x4d,0x61,0x74,0x68,0x2e,0x63,0x65,0x69,0x6c,0x28,0x28,0x6e,0x2d,0x65,0x29,0x2f,0x28,0x72,0x2a,0x6f,0x2e,0x73,0x69,0x7a,0x65,0x29,0x29,0x3c,0x3d,0x69,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x5b,0x61,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x5b,0x6c,0x2d,0x31,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x68,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x6d,0x2e,0x64,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x28,0x69,0x29,0x2e,0x64,0x69,0x66,0x66,0x28,0x6d,0x28,0x6e,0x29,0x29,0x29,0x3b,0x66,0x6f,0x72,0x28,0x61,0x3d,0x4d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x3b,0x61,0x3e,0x3d,0x4d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x65,0x29,0x3b,0x61,0x2d,0x2d,0x29,0x69,0x66,0x28,0x6f,0x3d,0x4d,0x5b,0x61,0x5d,0x2c,0x77,0x5b,0x6f,0x5d,0x2e,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x26,0x26,0x72,0x2e,0x61,0x73,0x28,0x6f,0x29,0x3e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6f,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x5b,0x65,0x3f,0x4d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x65,0x29,0x3a,0x30,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x66,0x28,0x74,0x29,0x7b,0x66,0x6f,0x72,0x28,0x76,0x61,0x72,0x20,0x65,0x3d,0x4d,0x2e,0x69,0x6e,0x64,0x65,0x78,0x4f,0x66,0x28,0x74,0x29,0x2b,0x31,0x2c,0x6e,0x3d,0x4d,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x66,0x28,0x77,0x5b,0x4d,0x5b,0x65,0x5d,0x5d,0x2e,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x5b,0x65,0x5d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x67,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x2c,0x6f,0x3d,0x69,0x2e,0x74,0x69,0x6d,0x65,0x2c,0x72,0x3d,0x6f,0x2e,0x75,0x6e,0x69,0x74,0x7c,0x7c,0x63,0x28,0x6f,0x2e,0x6d,0x69,0x6e,0x55,0x6e,0x69,0x74,0x2c,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x2c,0x6c,0x3d,0x66,0x28,0x72,0x29,0x2c,0x73,0x3d,0x78,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6f,0x2e,0x73,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x2c,0x6f,0x2e,0x75,0x6e,0x69,0x74,0x53,0x74,0x65,0x70,0x53,0x69,0x7a,0x65,0x29,0x2c,0x75,0x3d,0x22,0x77,0x65,0x65,0x6b,0x22,0x3d,0x3d,0x3d,0x72,0x26,0x26,0x6f,0x2e,0x69,0x73,0x6f,0x57,0x65,0x65,0x6b,0x64,0x61,0x79,0x2c,0x68,0x3d,0x69,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x2e,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x2c,0x67,0x3d,0x77,0x5b,0x72,0x5d,0x2c,0x70,0x3d,0x6d,0x28,0x74,0x29,0x2c,0x76,0x3d,0x6d,0x28,0x65,0x29,0x2c,0x62,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x73,0x7c,0x7c,0x28,0x73,0x3d,0x64,0x28,0x74,0x2c,0x65,0x2c,0x72,0x2c,0x6e,0x29,0x29,0x2c,0x75,0x26,0x26,0x28,0x70,0x3d,0x70,0x2e,0x69,0x73,0x6f,0x57,0x65,0x65,0x6b,0x64,0x61,0x79,0x28,0x75,0x29,0x2c,0x76,0x3d,0x76,0x2e,0x69,0x73,0x6f,0x57,0x65,0x65,0x6b,0x64,0x61,0x79,0x28,0x75,0x29,0x29,0x2c,0x70,0x3d,0x70,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x75,0x3f,0x22,0x64,0x61,0x79,0x22,0x3a,0x72,0x29,0x2c,0x28,0x76,0x3d,0x76,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x75,0x3f,0x22,0x64,0x61,0x79,0x22,0x3a,0x72,0x29,0x29,0x3c,0x65,0x26,0x26,0x76,0x2e,0x61,0x64,0x64,0x28,0x31,0x2c,0x72,0x29,0x2c,0x61,0x3d,0x6d,0x28,0x70,0x29,0x2c,0x68,0x26,0x26,0x6c,0x26,0x26,0x21,0x75,0x26,0x26,0x21,0x6f,0x2e,0x72,0x6f,0x75,0x6e,0x64,0x26,0x26,0x28,0x61,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x6c,0x29,0x2c,0x61,0x2e,0x61,0x64,0x64,0x28,0x7e,0x7e,0x28,0x28,0x70,0x2d,0x61,0x29,0x2f,0x28,0x67,0x2e,0x73,0x69,0x7a,0x65,0x2a,0x73,0x29,0x29,0x2a,0x73,0x2c,0x72,0x29,0x29,0x3b,0x61,0x3c,0x76,0x3b,0x61,0x2e,0x61,0x64,0x64,0x28,0x73,0x2c,0x72,0x29,0x29,0x62,0x2e,0x70,0x75,0x73,0x68,0x28,0x2b,0x61,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x62,0x2e,0x70,0x75,0x73,0x68,0x28,0x2b,0x61,0x29,0x2c,0x62,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x70,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x2c,0x61,0x29,0x7b,0x76,0x61,0x72,0x20,0x6f,0x2c,0x72,0x2c,0x73,0x3d,0x30,0x2c,0x75,0x3d,0x30,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x61,0x2e,0x6f,0x66,0x66,0x73,0x65,0x74,0x26,0x26,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x61,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x6d,0x69,0x6e,0x7c,0x7c,0x28,0x6f,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x31,0x3f,0x65,0x5b,0x31,0x5d,0x3a,0x69,0x2c,0x72,0x3d,0x65,0x5b,0x30,0x5d,0x2c,0x73,0x3d,0x28,0x6c,0x28,0x74,0x2c,0x22,0x74,0x69,0x6d,0x65,0x22,0x2c,0x6f,0x2c,0x22,0x70,0x6f,0x73,0x22,0x29,0x2d,0x6c,0x28,0x74,0x2c,0x22,0x74,0x69,0x6d,0x65,0x22,0x2c,0x72,0x2c,0x22,0x70,0x6f,0x73,0x22,0x29,0x29,0x2f,0x32,0x29,0x2c,0x61,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x6d,0x61,0x78,0x7c,0x7c,0x28,0x6f,0x3d,0x65,0x5b,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x2c,0x72,0x3d,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3e,0x31,0x3f,0x65,0x5b,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x32,0x5d,0x3a,0x6e,0x2c,0x75,0x3d,0x28,0x6c,0x28,0x74,0x2c,0x22,0x74,0x69,0x6d,0x65,0x22,0x2c,0x6f,0x2c,0x22,0x70,0x6f,0x73,0x22,0x29,0x2d,0x6c,0x28,0x74,0x2c,0x22,0x74,0x69,0x6d,0x65,0x22,0x2c,0x72,0x2c,0x22,0x70,0x6f,0x73,0x22,0x29,0x29,0x2f,0x32,0x29,0x29,0x2c,0x7b,0x6c,0x65,0x66,0x74,0x3a,0x73,0x2c,0x72,0x69,0x67,0x68,0x74,0x3a,0x75,0x7d,0x7d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x76,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x2c,0x69,0x2c,0x61,0x2c,0x6f,0x2c,0x72,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x6e,0x3d,0x30,0x2c,0x69,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x6e,0x3c,0x69,0x3b,0x2b,0x2b,0x6e,0x29,0x61,0x3d,0x74,0x5b,0x6e,0x5d,0x2c,0x6f,0x3d,0x21,0x21,0x65,0x26,0x26,0x61,0x3d,0x3d,0x3d,0x2b,0x6d,0x28,0x61,0x29,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x65,0x29,0x2c,0x72,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0x76,0x61,0x6c,0x75,0x65,0x3a,0x61,0x2c,0x6d,0x61,0x6a,0x6f,0x72,0x3a,0x6f,0x7d,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0x7d,0x76,0x61,0x72,0x20,0x6d,0x3d,0x74,0x28,0x31,0x29,0x3b,0x6d,0x3d,0x22,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x22,0x3d,0x3d,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6d,0x3f,0x6d,0x3a,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6d,0x6f,0x6d,0x65,0x6e,0x74,0x3b,0x76,0x61,0x72,0x20,0x62,0x3d,0x74,0x28,0x32,0x35,0x29,0x2c,0x78,0x3d,0x74,0x28,0x34,0x35,0x29,0x2c,0x79,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x4d,0x49,0x4e,0x5f,0x53,0x41,0x46,0x45,0x5f,0x49,0x4e,0x54,0x45,0x47,0x45,0x52,0x7c,0x7c,0x2d,0x39,0x30,0x30,0x37,0x31,0x39,0x39,0x32,0x35,0x34,0x37,0x34,0x30,0x39,0x39,0x31,0x2c,0x6b,0x3d,0x4e,0x75,0x6d,0x62,0x65,0x72,0x2e,0x4d,0x41,0x58,0x5f,0x53,0x41,0x46,0x45,0x5f,0x49,0x4e,0x54,0x45,0x47,0x45,0x52,0x7c,0x7c,0x39,0x30,0x30,0x37,0x31,0x39,0x39,0x32,0x35,0x34,0x37,0x34,0x30,0x39,0x39,0x31,0x2c,0x77,0x3d,0x7b,0x6d,0x69,0x6c,0x6c,0x69,0x73,0x65,0x63,0x6f,0x6e,0x64,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x31,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x35,0x2c,0x31,0x30,0x2c,0x32,0x30,0x2c,0x35,0x30,0x2c,0x31,0x30,0x30,0x2c,0x32,0x35,0x30,0x2c,0x35,0x30,0x30,0x5d,0x7d,0x2c,0x73,0x65,0x63,0x6f,0x6e,0x64,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x31,0x65,0x33,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x35,0x2c,0x31,0x30,0x2c,0x33,0x30,0x5d,0x7d,0x2c,0x6d,0x69,0x6e,0x75,0x74,0x65,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x36,0x65,0x34,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x35,0x2c,0x31,0x30,0x2c,0x33,0x30,0x5d,0x7d,0x2c,0x68,0x6f,0x75,0x72,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x33,0x36,0x65,0x35,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x33,0x2c,0x36,0x2c,0x31,0x32,0x5d,0x7d,0x2c,0x64,0x61,0x79,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x38,0x36,0x34,0x65,0x35,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x35,0x5d,0x7d,0x2c,0x77,0x65,0x65,0x6b,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x31,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x36,0x30,0x34,0x38,0x65,0x35,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x33,0x2c,0x34,0x5d,0x7d,0x2c,0x6d,0x6f,0x6e,0x74,0x68,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x32,0x36,0x32,0x38,0x65,0x36,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x33,0x5d,0x7d,0x2c,0x71,0x75,0x61,0x72,0x74,0x65,0x72,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x31,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x37,0x38,0x38,0x34,0x65,0x36,0x2c,0x73,0x74,0x65,0x70,0x73,0x3a,0x5b,0x31,0x2c,0x32,0x2c,0x33,0x2c,0x34,0x5d,0x7d,0x2c,0x79,0x65,0x61,0x72,0x3a,0x7b,0x63,0x6f,0x6d,0x6d,0x6f,0x6e,0x3a,0x21,0x30,0x2c,0x73,0x69,0x7a,0x65,0x3a,0x33,0x31,0x35,0x34,0x65,0x37,0x7d,0x7d,0x2c,0x4d,0x3d,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x6b,0x65,0x79,0x73,0x28,0x77,0x29,0x3b,0x65,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x73,0x3d,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x65,0x78,0x74,0x65,0x6e,0x64,0x28,0x7b,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x69,0x66,0x28,0x21,0x6d,0x29,0x74,0x68,0x72,0x6f,0x77,0x20,0x6e,0x65,0x77,0x20,0x45,0x72,0x72,0x6f,0x72,0x28,0x22,0x43,0x68,0x61,0x72,0x74,0x2e,0x6a,0x73,0x20,0x2d,0x20,0x4d,0x6f,0x6d,0x65,0x6e,0x74,0x2e,0x6a,0x73,0x20,0x63,0x6f,0x75,0x6c,0x64,0x20,0x6e,0x6f,0x74,0x20,0x62,0x65,0x20,0x66,0x6f,0x75,0x6e,0x64,0x21,0x20,0x59,0x6f,0x75,0x20,0x6d,0x75,0x73,0x74,0x20,0x69,0x6e,0x63,0x6c,0x75,0x64,0x65,0x20,0x69,0x74,0x20,0x62,0x65,0x66,0x6f,0x72,0x65,0x20,0x43,0x68,0x61,0x72,0x74,0x2e,0x6a,0x73,0x20,0x74,0x6f,0x20,0x75,0x73,0x65,0x20,0x74,0x68,0x65,0x20,0x74,0x69,0x6d,0x65,0x20,0x73,0x63,0x61,0x6c,0x65,0x2e,0x20,0x44,0x6f,0x77,0x6e,0x6c,0x6f,0x61,0x64,0x20,0x61,0x74,0x20,0x68,0x74,0x74,0x70,0x73,0x3a,0x2f,0x2f,0x6d,0x6f,0x6d,0x65,0x6e,0x74,0x6a,0x73,0x2e,0x63,0x6f,0x6d,0x22,0x29,0x3b,0x74,0x68,0x69,0x73,0x2e,0x6d,0x65,0x72,0x67,0x65,0x54,0x69,0x63,0x6b,0x73,0x4f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x28,0x29,0x2c,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x69,0x6e,0x69,0x74,0x69,0x61,0x6c,0x69,0x7a,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x68,0x69,0x73,0x29,0x7d,0x2c,0x75,0x70,0x64,0x61,0x74,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x2e,0x74,0x69,0x6d,0x65,0x26,0x26,0x6e,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x26,0x26,0x63,0x6f,0x6e,0x73,0x6f,0x6c,0x65,0x2e,0x77,0x61,0x72,0x6e,0x28,0x22,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x20,0x69,0x73,0x20,0x64,0x65,0x70,0x72,0x65,0x63,0x61,0x74,0x65,0x64,0x20,0x61,0x6e,0x64,0x20,0x72,0x65,0x70,0x6c,0x61,0x63,0x65,0x64,0x20,0x62,0x79,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x70,0x61,0x72,0x73,0x65,0x72,0x2e,0x22,0x29,0x2c,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x65,0x2c,0x61,0x72,0x67,0x75,0x6d,0x65,0x6e,0x74,0x73,0x29,0x7d,0x2c,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x7b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x65,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x2e,0x74,0x26,0x26,0x28,0x65,0x3d,0x65,0x2e,0x74,0x29,0x2c,0x74,0x2e,0x53,0x63,0x61,0x6c,0x65,0x2e,0x70,0x72,0x6f,0x74,0x6f,0x74,0x79,0x70,0x65,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x2e,0x63,0x61,0x6c,0x6c,0x28,0x74,0x68,0x69,0x73,0x2c,0x65,0x29,0x7d,0x2c,0x64,0x65,0x74,0x65,0x72,0x6d,0x69,0x6e,0x65,0x44,0x61,0x74,0x61,0x4c,0x69,0x6d,0x69,0x74,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x6f,0x2c,0x72,0x2c,0x6c,0x2c,0x73,0x3d,0x74,0x68,0x69,0x73,0x2c,0x64,0x3d,0x73,0x2e,0x63,0x68,0x61,0x72,0x74,0x2c,0x63,0x3d,0x73,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x6d,0x65,0x2c,0x68,0x3d,0x6b,0x2c,0x66,0x3d,0x79,0x2c,0x67,0x3d,0x5b,0x5d,0x2c,0x70,0x3d,0x5b,0x5d,0x2c,0x76,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x74,0x3d,0x30,0x2c,0x6e,0x3d,0x64,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x74,0x3c,0x6e,0x3b,0x2b,0x2b,0x74,0x29,0x76,0x2e,0x70,0x75,0x73,0x68,0x28,0x75,0x28,0x64,0x2e,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x74,0x5d,0x2c,0x73,0x29,0x29,0x3b,0x66,0x6f,0x72,0x28,0x74,0x3d,0x30,0x2c,0x6e,0x3d,0x28,0x64,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x7c,0x7c,0x5b,0x5d,0x29,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x74,0x3c,0x6e,0x3b,0x2b,0x2b,0x74,0x29,0x69,0x66,0x28,0x64,0x2e,0x69,0x73,0x44,0x61,0x74,0x61,0x73,0x65,0x74,0x56,0x69,0x73,0x69,0x62,0x6c,0x65,0x28,0x74,0x29,0x29,0x69,0x66,0x28,0x72,0x3d,0x64,0x2e,0x64,0x61,0x74,0x61,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x74,0x5d,0x2e,0x64,0x61,0x74,0x61,0x2c,0x78,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x72,0x5b,0x30,0x5d,0x29,0x29,0x66,0x6f,0x72,0x28,0x70,0x5b,0x74,0x5d,0x3d,0x5b,0x5d,0x2c,0x65,0x3d,0x30,0x2c,0x6f,0x3d,0x72,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6f,0x3b,0x2b,0x2b,0x65,0x29,0x6c,0x3d,0x75,0x28,0x72,0x5b,0x65,0x5d,0x2c,0x73,0x29,0x2c,0x67,0x2e,0x70,0x75,0x73,0x68,0x28,0x6c,0x29,0x2c,0x70,0x5b,0x74,0x5d,0x5b,0x65,0x5d,0x3d,0x6c,0x3b,0x65,0x6c,0x73,0x65,0x20,0x67,0x2e,0x70,0x75,0x73,0x68,0x2e,0x61,0x70,0x70,0x6c,0x79,0x28,0x67,0x2c,0x76,0x29,0x2c,0x70,0x5b,0x74,0x5d,0x3d,0x76,0x2e,0x73,0x6c,0x69,0x63,0x65,0x28,0x30,0x29,0x3b,0x65,0x6c,0x73,0x65,0x20,0x70,0x5b,0x74,0x5d,0x3d,0x5b,0x5d,0x3b,0x76,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x76,0x3d,0x61,0x28,0x76,0x29,0x2e,0x73,0x6f,0x72,0x74,0x28,0x69,0x29,0x2c,0x68,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x68,0x2c,0x76,0x5b,0x30,0x5d,0x29,0x2c,0x66,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x66,0x2c,0x76,0x5b,0x76,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x29,0x29,0x2c,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x67,0x3d,0x61,0x28,0x67,0x29,0x2e,0x73,0x6f,0x72,0x74,0x28,0x69,0x29,0x2c,0x68,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x68,0x2c,0x67,0x5b,0x30,0x5d,0x29,0x2c,0x66,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x66,0x2c,0x67,0x5b,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x29,0x29,0x2c,0x68,0x3d,0x75,0x28,0x63,0x2e,0x6d,0x69,0x6e,0x2c,0x73,0x29,0x7c,0x7c,0x68,0x2c,0x66,0x3d,0x75,0x28,0x63,0x2e,0x6d,0x61,0x78,0x2c,0x73,0x29,0x7c,0x7c,0x66,0x2c,0x68,0x3d,0x68,0x3d,0x3d,0x3d,0x6b,0x3f,0x2b,0x6d,0x28,0x29,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x22,0x64,0x61,0x79,0x22,0x29,0x3a,0x68,0x2c,0x66,0x3d,0x66,0x3d,0x3d,0x3d,0x79,0x3f,0x2b,0x6d,0x28,0x29,0x2e,0x65,0x6e,0x64,0x4f,0x66,0x28,0x22,0x64,0x61,0x79,0x22,0x29,0x2b,0x31,0x3a,0x66,0x2c,0x73,0x2e,0x6d,0x69,0x6e,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x69,0x6e,0x28,0x68,0x2c,0x66,0x29,0x2c,0x73,0x2e,0x6d,0x61,0x78,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x68,0x2b,0x31,0x2c,0x66,0x29,0x2c,0x73,0x2e,0x5f,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3d,0x73,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x2c,0x73,0x2e,0x5f,0x74,0x61,0x62,0x6c,0x65,0x3d,0x5b,0x5d,0x2c,0x73,0x2e,0x5f,0x74,0x69,0x6d,0x65,0x73,0x74,0x61,0x6d,0x70,0x73,0x3d,0x7b,0x64,0x61,0x74,0x61,0x3a,0x67,0x2c,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x3a,0x70,0x2c,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x76,0x7d,0x7d,0x2c,0x62,0x75,0x69,0x6c,0x64,0x54,0x69,0x63,0x6b,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x7b,0x76,0x61,0x72,0x20,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x69,0x2e,0x6d,0x69,0x6e,0x2c,0x72,0x3d,0x69,0x2e,0x6d,0x61,0x78,0x2c,0x6c,0x3d,0x69,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x73,0x3d,0x6c,0x2e,0x74,0x69,0x6d,0x65,0x2c,0x64,0x3d,0x5b,0x5d,0x2c,0x63,0x3d,0x5b,0x5d,0x3b,0x73,0x77,0x69,0x74,0x63,0x68,0x28,0x6c,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x73,0x6f,0x75,0x72,0x63,0x65,0x29,0x7b,0x63,0x61,0x73,0x65,0x22,0x64,0x61,0x74,0x61,0x22,0x3a,0x64,0x3d,0x69,0x2e,0x5f,0x74,0x69,0x6d,0x65,0x73,0x74,0x61,0x6d,0x70,0x73,0x2e,0x64,0x61,0x74,0x61,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x6c,0x61,0x62,0x65,0x6c,0x73,0x22,0x3a,0x64,0x3d,0x69,0x2e,0x5f,0x74,0x69,0x6d,0x65,0x73,0x74,0x61,0x6d,0x70,0x73,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x3b,0x62,0x72,0x65,0x61,0x6b,0x3b,0x63,0x61,0x73,0x65,0x22,0x61,0x75,0x74,0x6f,0x22,0x3a,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0x64,0x3d,0x67,0x28,0x61,0x2c,0x72,0x2c,0x69,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x43,0x61,0x70,0x61,0x63,0x69,0x74,0x79,0x28,0x61,0x29,0x2c,0x6c,0x29,0x7d,0x66,0x6f,0x72,0x28,0x22,0x74,0x69,0x63,0x6b,0x73,0x22,0x3d,0x3d,0x3d,0x6c,0x2e,0x62,0x6f,0x75,0x6e,0x64,0x73,0x26,0x26,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x26,0x26,0x28,0x61,0x3d,0x64,0x5b,0x30,0x5d,0x2c,0x72,0x3d,0x64,0x5b,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x2d,0x31,0x5d,0x29,0x2c,0x61,0x3d,0x75,0x28,0x73,0x2e,0x6d,0x69,0x6e,0x2c,0x69,0x29,0x7c,0x7c,0x61,0x2c,0x72,0x3d,0x75,0x28,0x73,0x2e,0x6d,0x61,0x78,0x2c,0x69,0x29,0x7c,0x7c,0x72,0x2c,0x74,0x3d,0x30,0x2c,0x65,0x3d,0x64,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x74,0x3c,0x65,0x3b,0x2b,0x2b,0x74,0x29,0x28,0x6e,0x3d,0x64,0x5b,0x74,0x5d,0x29,0x3e,0x3d,0x61,0x26,0x26,0x6e,0x3c,0x3d,0x72,0x26,0x26,0x63,0x2e,0x70,0x75,0x73,0x68,0x28,0x6e,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x6d,0x69,0x6e,0x3d,0x61,0x2c,0x69,0x2e,0x6d,0x61,0x78,0x3d,0x72,0x2c,0x69,0x2e,0x5f,0x75,0x6e,0x69,0x74,0x3d,0x73,0x2e,0x75,0x6e,0x69,0x74,0x7c,0x7c,0x68,0x28,0x63,0x2c,0x73,0x2e,0x6d,0x69,0x6e,0x55,0x6e,0x69,0x74,0x2c,0x69,0x2e,0x6d,0x69,0x6e,0x2c,0x69,0x2e,0x6d,0x61,0x78,0x29,0x2c,0x69,0x2e,0x5f,0x6d,0x61,0x6a,0x6f,0x72,0x55,0x6e,0x69,0x74,0x3d,0x66,0x28,0x69,0x2e,0x5f,0x75,0x6e,0x69,0x74,0x29,0x2c,0x69,0x2e,0x5f,0x74,0x61,0x62,0x6c,0x65,0x3d,0x6f,0x28,0x69,0x2e,0x5f,0x74,0x69,0x6d,0x65,0x73,0x74,0x61,0x6d,0x70,0x73,0x2e,0x64,0x61,0x74,0x61,0x2c,0x61,0x2c,0x72,0x2c,0x6c,0x2e,0x64,0x69,0x73,0x74,0x72,0x69,0x62,0x75,0x74,0x69,0x6f,0x6e,0x29,0x2c,0x69,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x3d,0x70,0x28,0x69,0x2e,0x5f,0x74,0x61,0x62,0x6c,0x65,0x2c,0x63,0x2c,0x61,0x2c,0x72,0x2c,0x6c,0x29,0x2c,0x76,0x28,0x63,0x2c,0x69,0x2e,0x5f,0x6d,0x61,0x6a,0x6f,0x72,0x55,0x6e,0x69,0x74,0x29,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x46,0x6f,0x72,0x49,0x6e,0x64,0x65,0x78,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x29,0x7b,0x76,0x61,0x72,0x20,0x6e,0x3d,0x74,0x68,0x69,0x73,0x2c,0x69,0x3d,0x6e,0x2e,0x63,0x68,0x61,0x72,0x74,0x2e,0x64,0x61,0x74,0x61,0x2c,0x61,0x3d,0x6e,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x6d,0x65,0x2c,0x6f,0x3d,0x69,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x26,0x26,0x74,0x3c,0x69,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3f,0x69,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x73,0x5b,0x74,0x5d,0x3a,0x22,0x22,0x2c,0x72,0x3d,0x69,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x65,0x5d,0x2e,0x64,0x61,0x74,0x61,0x5b,0x74,0x5d,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x78,0x2e,0x69,0x73,0x4f,0x62,0x6a,0x65,0x63,0x74,0x28,0x72,0x29,0x26,0x26,0x28,0x6f,0x3d,0x6e,0x2e,0x67,0x65,0x74,0x52,0x69,0x67,0x68,0x74,0x56,0x61,0x6c,0x75,0x65,0x28,0x72,0x29,0x29,0x2c,0x61,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x46,0x6f,0x72,0x6d,0x61,0x74,0x26,0x26,0x28,0x6f,0x3d,0x73,0x28,0x6f,0x2c,0x61,0x29,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x28,0x61,0x2e,0x74,0x6f,0x6f,0x6c,0x74,0x69,0x70,0x46,0x6f,0x72,0x6d,0x61,0x74,0x29,0x29,0x2c,0x6f,0x7d,0x2c,0x74,0x69,0x63,0x6b,0x46,0x6f,0x72,0x6d,0x61,0x74,0x46,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x2c,0x69,0x29,0x7b,0x76,0x61,0x72,0x20,0x61,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6f,0x3d,0x61,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2c,0x72,0x3d,0x74,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x66,0x28,0x29,0x2c,0x6c,0x3d,0x6f,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x46,0x6f,0x72,0x6d,0x61,0x74,0x73,0x2c,0x73,0x3d,0x6c,0x5b,0x61,0x2e,0x5f,0x75,0x6e,0x69,0x74,0x5d,0x2c,0x75,0x3d,0x61,0x2e,0x5f,0x6d,0x61,0x6a,0x6f,0x72,0x55,0x6e,0x69,0x74,0x2c,0x64,0x3d,0x6c,0x5b,0x75,0x5d,0x2c,0x63,0x3d,0x74,0x2e,0x63,0x6c,0x6f,0x6e,0x65,0x28,0x29,0x2e,0x73,0x74,0x61,0x72,0x74,0x4f,0x66,0x28,0x75,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x66,0x28,0x29,0x2c,0x68,0x3d,0x6f,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x61,0x6a,0x6f,0x72,0x2c,0x66,0x3d,0x68,0x2e,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x26,0x26,0x75,0x26,0x26,0x64,0x26,0x26,0x72,0x3d,0x3d,0x3d,0x63,0x2c,0x67,0x3d,0x74,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x28,0x69,0x7c,0x7c,0x28,0x66,0x3f,0x64,0x3a,0x73,0x29,0x29,0x2c,0x70,0x3d,0x66,0x3f,0x68,0x3a,0x6f,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2e,0x6d,0x69,0x6e,0x6f,0x72,0x2c,0x76,0x3d,0x78,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x70,0x2e,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x2c,0x70,0x2e,0x75,0x73,0x65,0x72,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x76,0x3f,0x76,0x28,0x67,0x2c,0x65,0x2c,0x6e,0x29,0x3a,0x67,0x7d,0x2c,0x63,0x6f,0x6e,0x76,0x65,0x72,0x74,0x54,0x69,0x63,0x6b,0x73,0x54,0x6f,0x4c,0x61,0x62,0x65,0x6c,0x73,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x2c,0x6e,0x2c,0x69,0x3d,0x5b,0x5d,0x3b,0x66,0x6f,0x72,0x28,0x65,0x3d,0x30,0x2c,0x6e,0x3d,0x74,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x65,0x3c,0x6e,0x3b,0x2b,0x2b,0x65,0x29,0x69,0x2e,0x70,0x75,0x73,0x68,0x28,0x74,0x68,0x69,0x73,0x2e,0x74,0x69,0x63,0x6b,0x46,0x6f,0x72,0x6d,0x61,0x74,0x46,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x28,0x74,0x5b,0x65,0x5d,0x2e,0x76,0x61,0x6c,0x75,0x65,0x29,0x2c,0x65,0x2c,0x74,0x29,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x4f,0x66,0x66,0x73,0x65,0x74,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x5f,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3f,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x69,0x3d,0x65,0x2e,0x5f,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3f,0x65,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x65,0x2e,0x74,0x6f,0x70,0x2c,0x61,0x3d,0x6c,0x28,0x65,0x2e,0x5f,0x74,0x61,0x62,0x6c,0x65,0x2c,0x22,0x74,0x69,0x6d,0x65,0x22,0x2c,0x74,0x2c,0x22,0x70,0x6f,0x73,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2b,0x6e,0x2a,0x28,0x65,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x61,0x29,0x2f,0x28,0x65,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x31,0x2b,0x65,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x2e,0x72,0x69,0x67,0x68,0x74,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x56,0x61,0x6c,0x75,0x65,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x2c,0x65,0x2c,0x6e,0x29,0x7b,0x76,0x61,0x72,0x20,0x69,0x3d,0x74,0x68,0x69,0x73,0x2c,0x61,0x3d,0x6e,0x75,0x6c,0x6c,0x3b,0x69,0x66,0x28,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x65,0x26,0x26,0x76,0x6f,0x69,0x64,0x20,0x30,0x21,0x3d,0x3d,0x6e,0x26,0x26,0x28,0x61,0x3d,0x69,0x2e,0x5f,0x74,0x69,0x6d,0x65,0x73,0x74,0x61,0x6d,0x70,0x73,0x2e,0x64,0x61,0x74,0x61,0x73,0x65,0x74,0x73,0x5b,0x6e,0x5d,0x5b,0x65,0x5d,0x29,0x2c,0x6e,0x75,0x6c,0x6c,0x3d,0x3d,0x3d,0x61,0x26,0x26,0x28,0x61,0x3d,0x75,0x28,0x74,0x2c,0x69,0x29,0x29,0x2c,0x6e,0x75,0x6c,0x6c,0x21,0x3d,0x3d,0x61,0x29,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x4f,0x66,0x66,0x73,0x65,0x74,0x28,0x61,0x29,0x7d,0x2c,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x54,0x69,0x63,0x6b,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x54,0x69,0x63,0x6b,0x73,0x28,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x3e,0x3d,0x30,0x26,0x26,0x74,0x3c,0x65,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3f,0x74,0x68,0x69,0x73,0x2e,0x67,0x65,0x74,0x50,0x69,0x78,0x65,0x6c,0x46,0x6f,0x72,0x4f,0x66,0x66,0x73,0x65,0x74,0x28,0x65,0x5b,0x74,0x5d,0x2e,0x76,0x61,0x6c,0x75,0x65,0x29,0x3a,0x6e,0x75,0x6c,0x6c,0x7d,0x2c,0x67,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x46,0x6f,0x72,0x50,0x69,0x78,0x65,0x6c,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x5f,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3f,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x2c,0x69,0x3d,0x65,0x2e,0x5f,0x68,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x3f,0x65,0x2e,0x6c,0x65,0x66,0x74,0x3a,0x65,0x2e,0x74,0x6f,0x70,0x2c,0x61,0x3d,0x28,0x6e,0x3f,0x28,0x74,0x2d,0x69,0x29,0x2f,0x6e,0x3a,0x30,0x29,0x2a,0x28,0x65,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x66,0x74,0x2b,0x31,0x2b,0x65,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x2e,0x6c,0x65,0x66,0x74,0x29,0x2d,0x65,0x2e,0x5f,0x6f,0x66,0x66,0x73,0x65,0x74,0x73,0x2e,0x72,0x69,0x67,0x68,0x74,0x2c,0x6f,0x3d,0x6c,0x28,0x65,0x2e,0x5f,0x74,0x61,0x62,0x6c,0x65,0x2c,0x22,0x70,0x6f,0x73,0x22,0x2c,0x61,0x2c,0x22,0x74,0x69,0x6d,0x65,0x22,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6d,0x28,0x6f,0x29,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x57,0x69,0x64,0x74,0x68,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x63,0x6b,0x73,0x2c,0x69,0x3d,0x65,0x2e,0x63,0x74,0x78,0x2e,0x6d,0x65,0x61,0x73,0x75,0x72,0x65,0x54,0x65,0x78,0x74,0x28,0x74,0x29,0x2e,0x77,0x69,0x64,0x74,0x68,0x2c,0x61,0x3d,0x78,0x2e,0x74,0x6f,0x52,0x61,0x64,0x69,0x61,0x6e,0x73,0x28,0x6e,0x2e,0x6d,0x61,0x78,0x52,0x6f,0x74,0x61,0x74,0x69,0x6f,0x6e,0x29,0x2c,0x6f,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x63,0x6f,0x73,0x28,0x61,0x29,0x2c,0x72,0x3d,0x4d,0x61,0x74,0x68,0x2e,0x73,0x69,0x6e,0x28,0x61,0x29,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2a,0x6f,0x2b,0x78,0x2e,0x76,0x61,0x6c,0x75,0x65,0x4f,0x72,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x6e,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x2c,0x62,0x2e,0x67,0x6c,0x6f,0x62,0x61,0x6c,0x2e,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x46,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x29,0x2a,0x72,0x7d,0x2c,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x43,0x61,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x7b,0x76,0x61,0x72,0x20,0x65,0x3d,0x74,0x68,0x69,0x73,0x2c,0x6e,0x3d,0x65,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x74,0x69,0x6d,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x46,0x6f,0x72,0x6d,0x61,0x74,0x73,0x2e,0x6d,0x69,0x6c,0x6c,0x69,0x73,0x65,0x63,0x6f,0x6e,0x64,0x2c,0x69,0x3d,0x65,0x2e,0x74,0x69,0x63,0x6b,0x46,0x6f,0x72,0x6d,0x61,0x74,0x46,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x28,0x74,0x29,0x2c,0x30,0x2c,0x5b,0x5d,0x2c,0x6e,0x29,0x2c,0x61,0x3d,0x65,0x2e,0x67,0x65,0x74,0x4c,0x61,0x62,0x65,0x6c,0x57,0x69,0x64,0x74,0x68,0x28,0x69,0x29,0x2c,0x6f,0x3d,0x65,0x2e,0x69,0x73,0x48,0x6f,0x72,0x69,0x7a,0x6f,0x6e,0x74,0x61,0x6c,0x28,0x29,0x3f,0x65,0x2e,0x77,0x69,0x64,0x74,0x68,0x3a,0x65,0x2e,0x68,0x65,0x69,0x67,0x68,0x74,0x3b,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x6f,0x2f,0x61,0x29,0x7d,0x7d,0x29,0x3b,0x74,0x2e,0x73,0x63,0x61,0x6c,0x65,0x53,0x65,0x72,0x76,0x69,0x63,0x65,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x53,0x63,0x61,0x6c,0x65,0x54,0x79,0x70,0x65,0x28,0x22,0x74,0x69,0x6d,0x65,0x22,0x2c,0x65,0x2c,0x7b,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x22,0x2c,0x64,0x69,0x73,0x74,0x72,0x69,0x62,0x75,0x74,0x69,0x6f,0x6e,0x3a,0x22,0x6c,0x69,0x6e,0x65,0x61,0x72,0x22,0x2c,0x62,0x6f,0x75,0x6e,0x64,0x73,0x3a,0x22,0x64,0x61,0x74,0x61,0x22,0x2c,0x74,0x69,0x6d,0x65,0x3a,0x7b,0x70,0x61,0x72,0x73,0x65,0x72,0x3a,0x21,0x31,0x2c,0x66,0x6f,0x72,0x6d,0x61,0x74,0x3a,0x21,0x31,0x2c,0x75,0x6e,0x69,0x74,0x3a,0x21,0x31,0x2c,0x72,0x6f,0x75,0x6e,0x64,0x3a,0x21,0x31,0x2c,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x46,0x6f,0x72,0x6d,0x61,0x74,0x3a,0x21,0x31,0x2c,0x69,0x73,0x6f,0x57,0x65,0x65,0x6b,0x64,0x61,0x79,0x3a,0x21,0x31,0x2c,0x6d,0x69,0x6e,0x55,0x6e,0x69,0x74,0x3a,0x22,0x6d,0x69,0x6c,0x6c,0x69,0x73,0x65,0x63,0x6f,0x6e,0x64,0x22,0x2c,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x46,0x6f,0x72,0x6d,0x61,0x74,0x73,0x3a,0x7b,0x6d,0x69,0x6c,0x6c,0x69,0x73,0x65,0x63,0x6f,0x6e,0x64,0x3a,0x22,0x68,0x3a,0x6d,0x6d,0x3a,0x73,0x73,0x2e,0x53,0x53,0x53,0x20,0x61,0x22,0x2c,0x73,0x65,0x63,0x6f,0x6e,0x64,0x3a,0x22,0x68,0x3a,0x6d,0x6d,0x3a,0x73,0x73,0x20,0x61,0x22,0x2c,0x6d,0x69,0x6e,0x75,0x74,0x65,0x3a,0x22,0x68,0x3a,0x6d,0x6d,0x20,0x61,0x22,0x2c,0x68,0x6f,0x75,0x72,0x3a,0x22,0x68,0x41,0x22,0x2c,0x64,0x61,0x79,0x3a,0x22,0x4d,0x4d,0x4d,0x20,0x44,0x22,0x2c,0x77,0x65,0x65,0x6b,0x3a,0x22,0x6c,0x6c,0x22,0x2c,0x6d,0x6f,0x6e,0x74,0x68,0x3a,0x22,0x4d,0x4d,0x4d,0x20,0x59,0x59,0x59,0x59,0x22,0x2c,0x71,0x75,0x61,0x72,0x74,0x65,0x72,0x3a,0x22,0x5b,0x51,0x5d,0x51,0x20,0x2d,0x20,0x59,0x59,0x59,0x59,0x22,0x2c,0x79,0x65,0x61,0x72,0x3a,0x22,0x59,0x59,0x59,0x59,0x22,0x7d,0x7d,0x2c,0x74,0x69,0x63,0x6b,0x73,0x3a,0x7b,0x61,0x75,0x74,0x6f,0x53,0x6b,0x69,0x70,0x3a,0x21,0x31,0x2c,0x73,0x6f,0x75,0x72,0x63,0x65,0x3a,0x22,0x61,0x75,0x74,0x6f,0x22,0x2c,0x6d,0x61,0x6a,0x6f,0x72,0x3a,0x7b,0x65,0x6e,0x61,0x62,0x6c,0x65,0x64,0x3a,0x21,0x31,0x7d,0x7d,0x7d,0x29,0x7d,0x7d,0x2c,0x7b,0x31,0x3a,0x31,0x2c,0x32,0x35,0x3a,0x32,0x35,0x2c,0x34,0x35,0x3a,0x34,0x35,0x7d,0x5d,0x7d,0x2c,0x7b,0x7d,0x2c,0x5b,0x37,0x5d,0x29,0x28,0x37,0x29,0x7d,0x29,0x3b, }, l))
 	
 	// Add templates
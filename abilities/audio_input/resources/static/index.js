@@ -64,9 +64,31 @@ let index = {
         </tr>
     </tbody>
 </table>
+<button class="color-default-front" id="btn-use-suggested">Use suggested max silence level</button>
 <canvas id='chart'></canvas>`
 
+        // Handle use suggested
+        document.getElementById("btn-use-suggested").addEventListener("click", function() {
+            index.updateMaxSilenceLevel(data.suggested_max_silence_level)
+        })
+
         // Add chart
         new Chart(document.getElementById("chart"), data.chart);
+    },
+    updateMaxSilenceLevel: function(level) {
+        asticode.loader.show()
+        asticode.tools.sendHttp({
+            method: "PATCH",
+            payload: JSON.stringify({max_silence_level: level}),
+            url: "../config",
+            error: base.httpError,
+            success: function() {
+                // Notify
+                asticode.notifier.success("Max silence level has been updated")
+
+                // Finish
+                asticode.loader.hide()
+            },
+        })
     }
 }
\ No newline at end of file
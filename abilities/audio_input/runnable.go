@@ -2,7 +2,6 @@ package audio_input
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math"
 	"net/http"
@@ -36,14 +35,21 @@ type Stream interface {
 	Stop() error
 }
 
+// Config field names
+const (
+	maxSilenceLevelConfigField = "max_silence_level"
+)
+
 type Runnable struct {
 	*astibob.BaseOperatable
 	*astibob.BaseRunnable
-	cs []*calibration
-	l  *Listenable
-	lg astikit.SeverityLogger
-	mc *sync.Mutex // Locks cs
-	s  Stream
+	cs  []*calibration
+	l   *Listenable
+	lg  astikit.SeverityLogger
+	mc  *sync.Mutex // Locks cs
+	mm  *sync.Mutex // Locks msl
+	msl *float64    // Overrides the stream max silence level
+	s   Stream
 }
 
 func NewRunnable(name string, s Stream, l astikit.StdLogger) *Runnable {
@@ -51,6 +57,7 @@ func NewRunnable(name string, s Stream, l astikit.StdLogger) *Runnable {
 	r := &Runnable{
 		lg: astikit.AdaptStdLogger(l),
 		mc: &sync.Mutex{},
+		mm: &sync.Mutex{},
 		s:  s,
 	}
 
@@ -70,6 +77,7 @@ func NewRunnable(name string, s Stream, l astikit.StdLogger) *Runnable {
 			Description: "Reads an audio input and dispatches audio samples",
 			Name:        name,
 		},
+		OnInit:    r.onInit,
 		OnMessage: r.l.OnMessage,
 		OnStart:   r.onStart,
 	})
@@ -80,13 +88,54 @@ func (r *Runnable) MessageNames() []string {
 	return r.l.MessageNames()
 }
 
-func (r *Runnable) onStart(ctx context.Context) (err error) {
+func (r *Runnable) maxSilenceLevel() float64 {
+	r.mm.Lock()
+	defer r.mm.Unlock()
+	if r.msl != nil {
+		return *r.msl
+	}
+	return r.s.MaxSilenceLevel()
+}
+
+func (r *Runnable) Config() astibob.Config {
+	return astibob.Config{maxSilenceLevelConfigField: r.maxSilenceLevel()}
+}
+
+func (r *Runnable) ConfigSchema() astibob.ConfigSchema {
+	return astibob.ConfigSchema{Fields: []astibob.ConfigField{
+		{
+			Description: "Samples whose level is below this value are considered silent. Use calibration to find the proper value.",
+			Label:       "Max silence level",
+			Min:         astikit.Float64Ptr(0),
+			Name:        maxSilenceLevelConfigField,
+			Type:        astibob.ConfigFieldTypeNumber,
+		},
+	}}
+}
+
+func (r *Runnable) ValidateConfig(c astibob.Config) error { return nil }
+
+func (r *Runnable) ApplyConfig(c astibob.Config) error {
+	// Get max silence level
+	msl := c.Float64(maxSilenceLevelConfigField)
+
+	// Update
+	r.mm.Lock()
+	r.msl = &msl
+	r.mm.Unlock()
+	return nil
+}
+
+func (r *Runnable) onInit(ctx context.Context) (err error) {
 	// Start stream
 	if err = r.s.Start(); err != nil {
 		err = fmt.Errorf("audio_input: starting stream failed: %w", err)
 		return
 	}
+	return
+}
 
+func (r *Runnable) onStart(ctx context.Context) (err error) {
 	// Make sure to stop stream
 	defer func() {
 		if err := r.s.Stop(); err != nil {
@@ -122,11 +171,11 @@ func (r *Runnable) onStart(ctx context.Context) (err error) {
 }
 
 type Samples struct {
-	BitDepth        int     `json:"bit_depth"`
-	MaxSilenceLevel float64 `json:"max_silence_level"`
-	NumChannels     int     `json:"num_channels"`
-	SampleRate      int     `json:"sample_rate"`
-	Samples         []int   `json:"samples"`
+	BitDepth        int                `json:"bit_depth"`
+	MaxSilenceLevel float64            `json:"max_silence_level"`
+	NumChannels     int                `json:"num_channels"`
+	SampleRate      int                `json:"sample_rate"`
+	Samples         astibob.PCMSamples `json:"samples"`
 }
 
 func (r *Runnable) newSamplesMessage(b []int) (m *astibob.Message, err error) {
@@ -137,9 +186,10 @@ func (r *Runnable) newSamplesMessage(b []int) (m *astibob.Message, err error) {
 	m.Name = samplesMessage
 
 	// Marshal
-	if m.Payload, err = json.Marshal(Samples{
+	// Samples are sent often therefore we use a binary codec
+	if err = m.MarshalPayloadWithCodec(astibob.CBORCodec, Samples{
 		BitDepth:        r.s.BitDepth(),
-		MaxSilenceLevel: r.s.MaxSilenceLevel(),
+		MaxSilenceLevel: r.maxSilenceLevel(),
 		NumChannels:     r.s.NumChannels(),
 		Samples:         b,
 		SampleRate:      r.s.SampleRate(),
@@ -151,7 +201,7 @@ func (r *Runnable) newSamplesMessage(b []int) (m *astibob.Message, err error) {
 }
 
 func parseSamplesPayload(m *astibob.Message) (ss Samples, err error) {
-	if err = json.Unmarshal(m.Payload, &ss); err != nil {
+	if err = m.UnmarshalPayload(&ss); err != nil {
 		err = fmt.Errorf("audio_input: unmarshaling failed: %w", err)
 		return
 	}
@@ -214,15 +264,17 @@ type calibration struct {
 	cancel context.CancelFunc
 	ctx    context.Context
 	mb     *sync.Mutex // Locks b
+	msl    float64
 	s      Stream
 }
 
 func (r *Runnable) newCalibration() (c *calibration) {
 	// Create calibration
 	c = &calibration{
-		c:  sync.NewCond(&sync.Mutex{}),
-		mb: &sync.Mutex{},
-		s:  r.s,
+		c:   sync.NewCond(&sync.Mutex{}),
+		mb:  &sync.Mutex{},
+		msl: r.maxSilenceLevel(),
+		s:   r.s,
 	}
 
 	// Create context
@@ -369,7 +421,7 @@ func (c *calibration) results() (o Calibration) {
 	}
 
 	// Get current max silence level
-	o.CurrentMaxSilenceLevel = c.s.MaxSilenceLevel()
+	o.CurrentMaxSilenceLevel = c.msl
 
 	// Add current max silence level to chart
 	o.Chart.Data.Datasets = append(o.Chart.Data.Datasets, astichartjs.Dataset{
@@ -1,5 +1,62 @@
 let index = {
+    // Attributes
+    runnable: "",
+    worker: "",
+
+    // Init
+
     init: function() {
-        base.init({})
+        // Update attributes
+        // Path looks like /workers/<worker>/runnables/<runnable>/web/index
+        const items = window.location.pathname.split("/")
+        index.runnable = decodeURIComponent(items[4])
+        index.worker = decodeURIComponent(items[2])
+
+        // Init base
+        base.init({
+            messageNames: ["speech_to_text.text"],
+            onMessage: index.onMessage,
+        })
     },
-}
\ No newline at end of file
+
+    // Websocket
+
+    onMessage: function(data) {
+        switch (data.name) {
+            case "speech_to_text.text":
+                // Message comes from another runnable
+                if (data.from.name !== index.runnable || data.from.worker !== index.worker) return
+
+                // Add transcript
+                index.addTranscript(data)
+                break
+        }
+    },
+
+    // Transcripts
+
+    addTranscript: function(data) {
+        // Create row
+        let row = document.createElement("div")
+        row.className = "transcript"
+
+        // Add date
+        // Replayed transcripts hold the date they've been sent at
+        let date = document.createElement("span")
+        date.className = "transcript-date"
+        date.innerText = (typeof data.at !== "undefined" ? new Date(data.at) : new Date()).toLocaleString()
+        row.appendChild(date)
+
+        // Add text
+        let text = document.createElement("span")
+        text.innerText = data.payload.text
+        row.appendChild(text)
+
+        // Prepend
+        let transcripts = document.querySelector("#transcripts")
+        transcripts.insertBefore(row, transcripts.firstChild)
+
+        // Show
+        document.querySelector("#transcripts-empty").style.display = "none"
+    },
+}
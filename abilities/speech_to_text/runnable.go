@@ -20,6 +20,14 @@ import (
 	"github.com/go-audio/audio"
 	"github.com/go-audio/wav"
 	"github.com/julienschmidt/httprouter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Utterance outcomes
+const (
+	utteranceOutcomeEmpty  = "empty"
+	utteranceOutcomeFailed = "failed"
+	utteranceOutcomeParsed = "parsed"
 )
 
 // Audio formats
@@ -93,9 +101,11 @@ type Runnable struct {
 	msd    *sync.Mutex // Locks sds
 	o      RunnableOptions
 	p      Parser
+	pd     prometheus.Histogram // Parse durations
 	pg     *Progress
 	sds    map[string]*astikit.PCMSilenceDetector
 	ss     map[string]*Speech
+	uc     *prometheus.CounterVec // Utterances indexed by outcome
 }
 
 type RunnableOptions struct {
@@ -113,8 +123,19 @@ func NewRunnable(name string, p Parser, l astikit.StdLogger, o RunnableOptions)
 		msd: &sync.Mutex{},
 		o:   o,
 		p:   p,
+		pd: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Buckets:     prometheus.ExponentialBuckets(0.05, 2, 10),
+			ConstLabels: prometheus.Labels{"runnable": name},
+			Help:        "Duration of speech parsing in seconds.",
+			Name:        "astibob_speech_to_text_parse_duration_seconds",
+		}),
 		sds: make(map[string]*astikit.PCMSilenceDetector),
 		ss:  make(map[string]*Speech),
+		uc: prometheus.NewCounterVec(prometheus.CounterOpts{
+			ConstLabels: prometheus.Labels{"runnable": name},
+			Help:        "Number of utterances detected between silences.",
+			Name:        "astibob_speech_to_text_utterances_total",
+		}, []string{"outcome"}),
 	}
 
 	// Add base operatable
@@ -232,12 +253,14 @@ type Samples struct {
 	MaxSilenceLevel float64            `json:"max_silence_level"`
 	NumChannels     int                `json:"num_channels"`
 	SampleRate      int                `json:"sample_rate"`
-	Samples         []int              `json:"samples"`
+	Samples         astibob.PCMSamples `json:"samples"`
 }
 
 func NewSamplesMessage(from astibob.Identifier, samples []int, bitDepth, numChannels, sampleRate int, maxSilenceLevel float64) worker.Message {
 	return worker.Message{
-		Name: samplesMessage,
+		// Samples are sent often therefore we use a binary codec
+		Codec: astibob.CBORCodec,
+		Name:  samplesMessage,
 		Payload: Samples{
 			BitDepth:        bitDepth,
 			From:            from,
@@ -250,7 +273,7 @@ func NewSamplesMessage(from astibob.Identifier, samples []int, bitDepth, numChan
 }
 
 func parseSamplesPayload(m *astibob.Message) (s Samples, err error) {
-	if err = json.Unmarshal(m.Payload, &s); err != nil {
+	if err = m.UnmarshalPayload(&s); err != nil {
 		err = fmt.Errorf("speech_to_text: unmarshaling failed: %w", err)
 		return
 	}
@@ -339,6 +362,12 @@ func (r *Runnable) newTextMessage(from astibob.Identifier, text string) (m *asti
 	// Set name
 	m.Name = textMessage
 
+	// Make sure the message is sent to the UI as well as to workers listening to it
+	m.To = &astibob.Identifier{Types: map[string]bool{
+		astibob.UIIdentifierType:     true,
+		astibob.WorkerIdentifierType: true,
+	}}
+
 	// Marshal
 	if m.Payload, err = json.Marshal(Text{
 		From: from,
@@ -351,7 +380,7 @@ func (r *Runnable) newTextMessage(from astibob.Identifier, text string) (m *asti
 }
 
 func parseTextPayload(m *astibob.Message) (t Text, err error) {
-	if err = json.Unmarshal(m.Payload, &t); err != nil {
+	if err = m.UnmarshalPayload(&t); err != nil {
 		err = fmt.Errorf("speech_to_text: unmarshaling failed: %w", err)
 		return
 	}
@@ -367,27 +396,46 @@ func (r *Runnable) parseSpeech(from astibob.Identifier, ss []int, bitDepth, numC
 	// Parse
 	r.l.Debugf("speech_to_text: parsing %d samples from runnable %s on worker %s", len(ss), *from.Name, *from.Worker)
 	start := time.Now()
-	if text, err = r.p.Parse(ss, bitDepth, numChannels, sampleRate); err != nil {
+	text, err = r.p.Parse(ss, bitDepth, numChannels, sampleRate)
+	r.pd.Observe(time.Since(start).Seconds())
+	if err != nil {
+		r.uc.WithLabelValues(utteranceOutcomeFailed).Inc()
 		err = fmt.Errorf("speech_to_text: parsing speech failed: %w", err)
 		return
 	}
 	r.l.Debugf("speech_to_text: parsed %d samples from runnable %s on worker %s in %s", len(ss), *from.Name, *from.Worker, time.Since(start))
 
-	// Dispatch text
-	if text != "" {
-		// Create message
-		var m *astibob.Message
-		if m, err = r.newTextMessage(from, text); err != nil {
-			err = fmt.Errorf("speech_to_text: creating text message failed: %w", err)
-			return
-		}
+	// No text
+	if text == "" {
+		r.uc.WithLabelValues(utteranceOutcomeEmpty).Inc()
+		return
+	}
+	r.uc.WithLabelValues(utteranceOutcomeParsed).Inc()
 
-		// Dispatch
-		r.Dispatch(m)
+	// Create text message
+	var m *astibob.Message
+	if m, err = r.newTextMessage(from, text); err != nil {
+		err = fmt.Errorf("speech_to_text: creating text message failed: %w", err)
+		return
 	}
+
+	// Dispatch
+	r.Dispatch(m)
 	return
 }
 
+// Describe implements prometheus.Collector so that workers expose the runnable metrics
+func (r *Runnable) Describe(ch chan<- *prometheus.Desc) {
+	r.pd.Describe(ch)
+	r.uc.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (r *Runnable) Collect(ch chan<- prometheus.Metric) {
+	r.pd.Collect(ch)
+	r.uc.Collect(ch)
+}
+
 func (r *Runnable) newSpeechCreatedMessage(s Speech) (m *astibob.Message, err error) {
 	// Create message
 	m = astibob.NewMessage()
@@ -399,7 +447,7 @@ func (r *Runnable) newSpeechCreatedMessage(s Speech) (m *astibob.Message, err er
 	m.To = &astibob.Identifier{Type: astibob.UIIdentifierType}
 
 	// Marshal
-	if m.Payload, err = json.Marshal(s); err != nil {
+	if err = m.MarshalPayload(s); err != nil {
 		err = fmt.Errorf("speech_to_text: marshaling payload failed: %w", err)
 		return
 	}
@@ -596,7 +644,7 @@ func (r *Runnable) newBuildOptionsUpdatedMessage() (m *astibob.Message, err erro
 	m.To = &astibob.Identifier{Type: astibob.UIIdentifierType}
 
 	// Marshal
-	if m.Payload, err = json.Marshal(BuildOptions{StoreNewSpeeches: r.o.StoreNewSpeeches}); err != nil {
+	if err = m.MarshalPayload(BuildOptions{StoreNewSpeeches: r.o.StoreNewSpeeches}); err != nil {
 		err = fmt.Errorf("speech_to_text: marshaling payload failed: %w", err)
 		return
 	}
@@ -614,7 +662,7 @@ func (r *Runnable) newSpeechDeletedMessage(s Speech) (m *astibob.Message, err er
 	m.To = &astibob.Identifier{Type: astibob.UIIdentifierType}
 
 	// Marshal
-	if m.Payload, err = json.Marshal(s); err != nil {
+	if err = m.MarshalPayload(s); err != nil {
 		err = fmt.Errorf("speech_to_text: marshaling payload failed: %w", err)
 		return
 	}
@@ -676,7 +724,7 @@ func (r *Runnable) newSpeechUpdatedMessage(s Speech) (m *astibob.Message, err er
 	m.To = &astibob.Identifier{Type: astibob.UIIdentifierType}
 
 	// Marshal
-	if m.Payload, err = json.Marshal(s); err != nil {
+	if err = m.MarshalPayload(s); err != nil {
 		err = fmt.Errorf("speech_to_text: marshaling payload failed: %w", err)
 		return
 	}
@@ -759,7 +807,7 @@ func (r *Runnable) newProgressMessage(p Progress) (m *astibob.Message, err error
 	m.To = &astibob.Identifier{Type: astibob.UIIdentifierType}
 
 	// Marshal
-	if m.Payload, err = json.Marshal(newProgressJSON(p)); err != nil {
+	if err = m.MarshalPayload(newProgressJSON(p)); err != nil {
 		err = fmt.Errorf("speech_to_text: marshaling payload failed: %w", err)
 		return
 	}
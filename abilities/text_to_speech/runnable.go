@@ -2,7 +2,7 @@ package text_to_speech
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 
 	"github.com/asticode/go-astibob"
@@ -15,10 +15,21 @@ const (
 	sayMessage = "text_to_speech.say"
 )
 
+// Config field names
+const (
+	voiceConfigField = "voice"
+)
+
 type Speaker interface {
 	Say(s string) error
 }
 
+// VoiceSpeaker is implemented by speakers whose voice can be changed at runtime
+type VoiceSpeaker interface {
+	SetVoice(v string)
+	Voice() string
+}
+
 type Runnable struct {
 	*astibob.BaseRunnable
 	c *astikit.Chan
@@ -47,6 +58,41 @@ func NewRunnable(name string, s Speaker, l astikit.StdLogger) (r *Runnable) {
 	return
 }
 
+func (r *Runnable) Config() astibob.Config {
+	// Speaker doesn't support voices
+	vs, ok := r.s.(VoiceSpeaker)
+	if !ok {
+		return astibob.Config{}
+	}
+	return astibob.Config{voiceConfigField: vs.Voice()}
+}
+
+func (r *Runnable) ConfigSchema() astibob.ConfigSchema {
+	return astibob.ConfigSchema{Fields: []astibob.ConfigField{
+		{
+			Description: "Voice used by the speaker. Empty means the default voice.",
+			Label:       "Voice",
+			Name:        voiceConfigField,
+			Type:        astibob.ConfigFieldTypeString,
+		},
+	}}
+}
+
+func (r *Runnable) ValidateConfig(c astibob.Config) error {
+	// Speaker doesn't support voices
+	if _, ok := r.s.(VoiceSpeaker); !ok && c.String(voiceConfigField) != "" {
+		return errors.New("text_to_speech: speaker doesn't support voices")
+	}
+	return nil
+}
+
+func (r *Runnable) ApplyConfig(c astibob.Config) error {
+	if vs, ok := r.s.(VoiceSpeaker); ok {
+		vs.SetVoice(c.String(voiceConfigField))
+	}
+	return nil
+}
+
 func (r *Runnable) onStart(ctx context.Context) (err error) {
 	// Reset chan
 	r.c.Reset()
@@ -78,7 +124,7 @@ func NewSayMessage(s string) worker.Message {
 }
 
 func parseSayPayload(m *astibob.Message) (s string, err error) {
-	if err = json.Unmarshal(m.Payload, &s); err != nil {
+	if err = m.UnmarshalPayload(&s); err != nil {
 		err = fmt.Errorf("text_to_speech: unmarshaling failed: %w", err)
 		return
 	}
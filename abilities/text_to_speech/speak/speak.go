@@ -5,6 +5,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/asticode/go-astikit"
 	"github.com/go-ole/go-ole"
@@ -12,7 +13,9 @@ import (
 
 type Speaker struct {
 	l                astikit.SeverityLogger
+	mv               *sync.Mutex // Locks voice
 	o                Options
+	voice            string
 	windowsIDispatch *ole.IDispatch
 	windowsIUnknown  *ole.IUnknown
 }
@@ -24,18 +27,34 @@ type Options struct {
 
 func New(o Options, l astikit.StdLogger) *Speaker {
 	return &Speaker{
-		l: astikit.AdaptStdLogger(l),
-		o: o,
+		l:     astikit.AdaptStdLogger(l),
+		mv:    &sync.Mutex{},
+		o:     o,
+		voice: o.Voice,
 	}
 }
 
+// SetVoice updates the voice used by the next calls to Say
+func (s *Speaker) SetVoice(v string) {
+	s.mv.Lock()
+	defer s.mv.Unlock()
+	s.voice = v
+}
+
+// Voice returns the voice in use
+func (s *Speaker) Voice() string {
+	s.mv.Lock()
+	defer s.mv.Unlock()
+	return s.voice
+}
+
 func (s *Speaker) execute(name, i string) (err error) {
 	// Create args
 	args := []string{i}
 
 	// Add voice
-	if s.o.Voice != "" {
-		args = append([]string{"-v", s.o.Voice}, args...)
+	if v := s.Voice(); v != "" {
+		args = append([]string{"-v", v}, args...)
 	}
 
 	// Add binary dir path
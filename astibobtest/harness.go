@@ -0,0 +1,266 @@
+// Package astibobtest wires an index and workers over an in-memory network so that abilities and routing can be
+// tested without opening real sockets.
+package astibobtest
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astibob/index"
+	"github.com/asticode/go-astibob/worker"
+	"github.com/asticode/go-astikit"
+)
+
+// Harnesses are numbered so that their addresses are unique
+var harnessCount uint64
+
+type Options struct {
+	Index  index.Options
+	Logger astikit.StdLogger
+	// Maximum duration of waits. Defaults to 5s.
+	Timeout time.Duration
+}
+
+// Harness runs an index and workers connected through an in-memory network
+type Harness struct {
+	Index *index.Index
+	// Messages dispatched by the index
+	Messages *Recorder
+	id       uint64
+	l        *listener
+	m        *sync.Mutex // Locks ws
+	o        Options
+	ws       []*Worker
+}
+
+// New creates a harness and serves its index. Close it once you're done.
+func New(o Options) (h *Harness, err error) {
+	// Default options
+	if o.Timeout <= 0 {
+		o.Timeout = 5 * time.Second
+	}
+
+	// Tests shouldn't wait long for workers to be considered disconnected
+	if o.Index.Liveness.GracePeriod <= 0 {
+		o.Index.Liveness.GracePeriod = 100 * time.Millisecond
+	}
+
+	// Create harness
+	h = &Harness{
+		id: atomic.AddUint64(&harnessCount, 1),
+		m:  &sync.Mutex{},
+		o:  o,
+	}
+	h.Messages = newRecorder(o.Timeout)
+
+	// Listen
+	h.l = defaultNetwork.listen(h.addr("index"))
+
+	// Update options
+	o.Index.Dial = defaultNetwork.dial
+	o.Index.Server.Addr = string(h.l.addr)
+	o.Index.Server.Listener = h.l
+
+	// Create index
+	if h.Index, err = index.New(o.Index, o.Logger); err != nil {
+		h.l.Close()
+		err = fmt.Errorf("astibobtest: creating index failed: %w", err)
+		return
+	}
+
+	// Record messages
+	h.Index.On(astibob.DispatchConditions{}, h.Messages.record)
+
+	// Serve
+	h.Index.Serve()
+	return
+}
+
+func (h *Harness) addr(name string) string {
+	return fmt.Sprintf("%s.h%d.astibobtest:80", name, h.id)
+}
+
+// Close closes workers and the index
+func (h *Harness) Close() {
+	// Close workers
+	h.m.Lock()
+	ws := h.ws
+	h.m.Unlock()
+	for _, w := range ws {
+		w.close()
+	}
+
+	// Close index
+	h.Index.Stop()
+	h.Index.Close()
+	h.Index.Wait()
+	h.l.Close()
+}
+
+// Worker is a worker of the harness
+type Worker struct {
+	*worker.Worker
+	// Messages dispatched by the worker
+	Messages  *Recorder
+	connected bool // Locked by the harness mutex
+	h         *Harness
+	indexAddr string
+	l         *listener
+	name      string
+}
+
+// NewWorker creates a worker. Register runnables and listenables before connecting it.
+func (h *Harness) NewWorker(name string, o worker.Options) (w *Worker) {
+	// Lock
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	// Create worker
+	w = &Worker{
+		Messages:  newRecorder(h.o.Timeout),
+		h:         h,
+		indexAddr: h.addr(fmt.Sprintf("index-%d", len(h.ws))),
+		name:      name,
+	}
+
+	// Listen
+	w.l = defaultNetwork.listen(h.addr(fmt.Sprintf("worker-%d", len(h.ws))))
+
+	// The worker dials the index through its own alias so that it can be disconnected on its own
+	defaultNetwork.alias(w.indexAddr, string(h.l.addr))
+
+	// Update options
+	o.Dial = defaultNetwork.dial
+	o.Index.Addr = w.indexAddr
+	o.Index.Password = h.o.Index.Server.Password
+	o.Index.Username = h.o.Index.Server.Username
+	o.Server.Addr = string(w.l.addr)
+	o.Server.Listener = w.l
+
+	// Tests shouldn't wait long for workers to reconnect
+	if o.Reconnect.MinBackoff <= 0 {
+		o.Reconnect.MinBackoff = 10 * time.Millisecond
+	}
+	if o.Reconnect.MaxBackoff <= 0 {
+		o.Reconnect.MaxBackoff = 100 * time.Millisecond
+	}
+
+	// Create worker
+	w.Worker = worker.New(name, o, h.o.Logger)
+
+	// Record messages
+	w.On(astibob.DispatchConditions{}, w.Messages.record)
+
+	// Store worker
+	h.ws = append(h.ws, w)
+	return
+}
+
+// Connect serves the worker, registers it to the index and waits for the index to welcome it
+func (w *Worker) Connect() (err error) {
+	// Serve
+	w.Serve()
+
+	// Register to index
+	if err = w.register(); err != nil {
+		err = fmt.Errorf("astibobtest: registering worker failed: %w", err)
+		return
+	}
+	return
+}
+
+func (w *Worker) register() (err error) {
+	// Register
+	fn := w.peersRegistered()
+	idx := w.Messages.len()
+	w.RegisterToIndex()
+
+	// Wait for welcome
+	if _, err = w.Messages.wait(idx, []MessageFilter{Name(astibob.WorkerWelcomeMessage)}); err != nil {
+		return
+	}
+
+	// Wait for peers
+	if err = fn(); err != nil {
+		err = fmt.Errorf("astibobtest: waiting for peers failed: %w", err)
+		return
+	}
+
+	// Update connected
+	w.h.m.Lock()
+	w.connected = true
+	w.h.m.Unlock()
+	return
+}
+
+// peersRegistered returns a func waiting for the other connected workers to have handled the registration of the
+// worker so that they can send it messages. It must be called before the worker registers.
+func (w *Worker) peersRegistered() func() error {
+	// Get connected workers
+	type peer struct {
+		idx int
+		w   *Worker
+	}
+	var ps []peer
+	w.h.m.Lock()
+	for _, p := range w.h.ws {
+		if p != w && p.connected {
+			ps = append(ps, peer{
+				idx: p.Messages.len(),
+				w:   p,
+			})
+		}
+	}
+	w.h.m.Unlock()
+
+	return func() (err error) {
+		// Loop through peers
+		// Worker handlers are executed before the recorder, therefore once the recorder has received the message, the
+		// peer has handled it
+		for _, p := range ps {
+			if _, err = p.w.Messages.wait(p.idx, []MessageFilter{Name(astibob.WorkerRegisteredMessage), registeredWorker(w.name)}); err != nil {
+				err = fmt.Errorf("astibobtest: waiting for worker %s failed: %w", p.w.name, err)
+				return
+			}
+		}
+		return
+	}
+}
+
+// Disconnect abruptly closes the connection between the worker and the index and prevents the worker from
+// reconnecting until Reconnect is called
+func (w *Worker) Disconnect() {
+	defaultNetwork.disconnect(w.indexAddr)
+}
+
+// Reconnect lets the worker reconnect to the index and waits for the index to welcome it and for the other connected
+// workers to know about it again
+func (w *Worker) Reconnect() (err error) {
+	// Reconnect
+	fn := w.peersRegistered()
+	idx := w.Messages.len()
+	defaultNetwork.reconnect(w.indexAddr)
+
+	// Wait for welcome
+	if _, err = w.Messages.wait(idx, []MessageFilter{Name(astibob.WorkerWelcomeMessage)}); err != nil {
+		err = fmt.Errorf("astibobtest: waiting for welcome failed: %w", err)
+		return
+	}
+
+	// Wait for peers
+	if err = fn(); err != nil {
+		err = fmt.Errorf("astibobtest: waiting for peers failed: %w", err)
+		return
+	}
+	return
+}
+
+func (w *Worker) close() {
+	w.Stop()
+	w.Close()
+	w.Wait()
+	w.l.Close()
+}
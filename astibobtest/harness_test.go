@@ -0,0 +1,78 @@
+package astibobtest
+
+import (
+	"testing"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astibob/worker"
+)
+
+func newTestRunnable(name string) worker.Runnable {
+	return worker.Runnable{Runnable: astibob.NewBaseRunnable(astibob.BaseRunnableOptions{Metadata: astibob.Metadata{Name: name}})}
+}
+
+func sendTestMessage(t *testing.T, w2, w1 *Worker, payload string) {
+	t.Helper()
+
+	// Send
+	idx := w1.Messages.len()
+	if err := w2.SendMessage(worker.MessageOptions{
+		Message:  worker.Message{Name: "test.message", Payload: payload},
+		Runnable: "r1",
+		Worker:   "w1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Wait
+	m, err := w1.Messages.wait(idx, []MessageFilter{Name("test.message"), FromWorker("w2")})
+	if err != nil {
+		t.Fatalf("message has not been received: %s, recorded messages are %s", err, w1.Messages.names())
+	}
+
+	// Check payload
+	var p string
+	if err = m.UnmarshalPayload(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p != payload {
+		t.Fatalf("expected payload %q, got %q", payload, p)
+	}
+}
+
+func TestHarness(t *testing.T) {
+	// Create harness
+	h, err := New(Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+
+	// Create workers
+	w1 := h.NewWorker("w1", worker.Options{})
+	w1.RegisterRunnables(newTestRunnable("r1"))
+	if err = w1.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	w2 := h.NewWorker("w2", worker.Options{})
+	if err = w2.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Send message between workers
+	sendTestMessage(t, w2, w1, "before")
+
+	// Disconnect
+	h.Messages.Reset()
+	w1.Disconnect()
+	h.Messages.AssertDispatched(t, Name(astibob.WorkerDisconnectedMessage))
+
+	// Reconnect
+	if err = w1.Reconnect(); err != nil {
+		t.Fatal(err)
+	}
+	h.Messages.AssertDispatched(t, Name(astibob.WorkerRegisteredMessage))
+
+	// Messages still go through once the worker has reconnected
+	sendTestMessage(t, w2, w1, "after")
+}
@@ -0,0 +1,180 @@
+package astibobtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// All harnesses share the same network, therefore addresses are unique across harnesses
+var defaultNetwork = newNetwork()
+
+// network connects in-memory listeners and dialers with pipes
+type network struct {
+	as   map[string]string     // Listener addresses indexed by alias
+	cs   map[string][]net.Conn // Dialed connections indexed by dialed address
+	down map[string]bool       // Addresses that can't be dialed
+	ls   map[string]*listener  // Indexed by address
+	m    *sync.Mutex           // Locks as, cs, down and ls
+}
+
+func newNetwork() *network {
+	return &network{
+		as:   make(map[string]string),
+		cs:   make(map[string][]net.Conn),
+		down: make(map[string]bool),
+		ls:   make(map[string]*listener),
+		m:    &sync.Mutex{},
+	}
+}
+
+func (n *network) listen(addr string) (l *listener) {
+	// Lock
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	// Create listener
+	l = &listener{
+		addr: pipeAddr(addr),
+		cs:   make(chan net.Conn),
+		done: make(chan struct{}),
+		n:    n,
+	}
+
+	// Store listener
+	n.ls[addr] = l
+	return
+}
+
+// alias makes dialing the alias reach the listener. Each alias can then be disconnected on its own.
+func (n *network) alias(alias, addr string) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	n.as[alias] = addr
+}
+
+func (n *network) dial(ctx context.Context, network, addr string) (c net.Conn, err error) {
+	// Lock
+	n.m.Lock()
+
+	// Get listener
+	la := addr
+	if a, ok := n.as[addr]; ok {
+		la = a
+	}
+	l, ok := n.ls[la]
+
+	// Not an in-memory address
+	if !ok {
+		n.m.Unlock()
+		return (&net.Dialer{}).DialContext(ctx, network, addr)
+	}
+
+	// Address is down
+	if n.down[addr] {
+		n.m.Unlock()
+		err = fmt.Errorf("astibobtest: %s is down", addr)
+		return
+	}
+
+	// Create pipe
+	cc, sc := net.Pipe()
+
+	// Store connection
+	n.cs[addr] = append(n.cs[addr], cc)
+	n.m.Unlock()
+
+	// Accept
+	select {
+	case l.cs <- sc:
+		c = cc
+	case <-l.done:
+		cc.Close()
+		sc.Close()
+		err = fmt.Errorf("astibobtest: listener on %s is closed", la)
+	case <-ctx.Done():
+		cc.Close()
+		sc.Close()
+		err = ctx.Err()
+	}
+	return
+}
+
+// disconnect closes connections dialed to the address and prevents new ones until reconnect is called
+func (n *network) disconnect(addr string) {
+	// Lock
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	// Update status
+	n.down[addr] = true
+
+	// Close connections
+	for _, c := range n.cs[addr] {
+		c.Close()
+	}
+	delete(n.cs, addr)
+}
+
+func (n *network) reconnect(addr string) {
+	n.m.Lock()
+	defer n.m.Unlock()
+	delete(n.down, addr)
+}
+
+func (n *network) close(l *listener) {
+	// Lock
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	// Delete listener
+	if n.ls[string(l.addr)] == l {
+		delete(n.ls, string(l.addr))
+	}
+
+	// Delete aliases
+	for alias, addr := range n.as {
+		if addr == string(l.addr) {
+			delete(n.as, alias)
+			delete(n.cs, alias)
+			delete(n.down, alias)
+		}
+	}
+	delete(n.cs, string(l.addr))
+	delete(n.down, string(l.addr))
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string { return "pipe" }
+func (a pipeAddr) String() string  { return string(a) }
+
+// listener accepts connections dialed through the network
+type listener struct {
+	addr pipeAddr
+	cs   chan net.Conn
+	done chan struct{}
+	n    *network
+	o    sync.Once
+}
+
+func (l *listener) Accept() (c net.Conn, err error) {
+	select {
+	case c = <-l.cs:
+	case <-l.done:
+		err = errors.New("astibobtest: listener is closed")
+	}
+	return
+}
+
+func (l *listener) Addr() net.Addr { return l.addr }
+
+func (l *listener) Close() error {
+	l.o.Do(func() {
+		close(l.done)
+		l.n.close(l)
+	})
+	return nil
+}
@@ -0,0 +1,182 @@
+package astibobtest
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+// MessageFilter selects messages
+type MessageFilter func(m *astibob.Message) bool
+
+// Name selects messages whose name matches the pattern (e.g. "audio_input.*")
+func Name(pattern string) MessageFilter {
+	return func(m *astibob.Message) bool { return astibob.WildcardMatch(pattern, m.Name) }
+}
+
+// FromRunnable selects messages emitted by runnables whose name matches the pattern
+func FromRunnable(pattern string) MessageFilter {
+	return func(m *astibob.Message) bool {
+		return m.From.Type == astibob.RunnableIdentifierType && m.From.Name != nil && astibob.WildcardMatch(pattern, *m.From.Name)
+	}
+}
+
+// FromWorker selects messages emitted by workers, or their runnables, whose name matches the pattern
+func FromWorker(pattern string) MessageFilter {
+	return func(m *astibob.Message) bool { return astibob.WildcardMatch(pattern, m.From.WorkerName()) }
+}
+
+// registeredWorker selects worker.registered messages about a specific worker
+func registeredWorker(name string) MessageFilter {
+	return func(m *astibob.Message) bool {
+		w, err := astibob.ParseWorkerRegisteredPayload(m)
+		return err == nil && w.Name == name
+	}
+}
+
+func matchFilters(m *astibob.Message, fs []MessageFilter) bool {
+	for _, f := range fs {
+		if !f(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Recorder records messages dispatched by an index or a worker
+type Recorder struct {
+	c       *sync.Cond
+	m       *sync.Mutex // Locks ms
+	ms      []*astibob.Message
+	timeout time.Duration
+}
+
+func newRecorder(timeout time.Duration) (r *Recorder) {
+	r = &Recorder{
+		m:       &sync.Mutex{},
+		timeout: timeout,
+	}
+	r.c = sync.NewCond(r.m)
+	return
+}
+
+func (r *Recorder) record(m *astibob.Message) error {
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Append
+	// Handlers may modify messages afterwards
+	c := m.Clone()
+	c.ID = m.ID
+	r.ms = append(r.ms, c)
+
+	// Wake up waiters
+	r.c.Broadcast()
+	return nil
+}
+
+// Messages returns the recorded messages matching all filters
+func (r *Recorder) Messages(fs ...MessageFilter) (ms []*astibob.Message) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, m := range r.ms {
+		if matchFilters(m, fs) {
+			ms = append(ms, m)
+		}
+	}
+	return
+}
+
+// Reset forgets recorded messages
+func (r *Recorder) Reset() {
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.ms = []*astibob.Message{}
+}
+
+// Wait returns the first recorded message matching all filters, waiting for it if it hasn't been recorded yet
+func (r *Recorder) Wait(fs ...MessageFilter) (*astibob.Message, error) {
+	return r.wait(0, fs)
+}
+
+// WaitNext waits for a message matching all filters to be recorded, ignoring messages recorded so far
+func (r *Recorder) WaitNext(fs ...MessageFilter) (*astibob.Message, error) {
+	return r.wait(r.len(), fs)
+}
+
+func (r *Recorder) len() int {
+	r.m.Lock()
+	defer r.m.Unlock()
+	return len(r.ms)
+}
+
+func (r *Recorder) wait(idx int, fs []MessageFilter) (m *astibob.Message, err error) {
+	// Wake up once the timeout is reached
+	deadline := time.Now().Add(r.timeout)
+	t := time.AfterFunc(r.timeout, func() {
+		r.m.Lock()
+		r.c.Broadcast()
+		r.m.Unlock()
+	})
+	defer t.Stop()
+
+	// Lock
+	r.m.Lock()
+	defer r.m.Unlock()
+
+	// Loop
+	for {
+		// Messages have been reset
+		if idx > len(r.ms) {
+			idx = 0
+		}
+
+		// Loop through new messages
+		for ; idx < len(r.ms); idx++ {
+			if matchFilters(r.ms[idx], fs) {
+				m = r.ms[idx]
+				return
+			}
+		}
+
+		// Timeout has been reached
+		if !time.Now().Before(deadline) {
+			err = fmt.Errorf("astibobtest: no matching message after %s", r.timeout)
+			return
+		}
+
+		// Wait
+		r.c.Wait()
+	}
+}
+
+// AssertDispatched fails the test if no message matching all filters is recorded before the timeout
+func (r *Recorder) AssertDispatched(t testing.TB, fs ...MessageFilter) *astibob.Message {
+	t.Helper()
+	m, err := r.Wait(fs...)
+	if err != nil {
+		t.Fatalf("astibobtest: message has not been dispatched: %s, recorded messages are %s", err, r.names())
+	}
+	return m
+}
+
+// AssertNotDispatched fails the test if a message matching all filters has been recorded
+func (r *Recorder) AssertNotDispatched(t testing.TB, fs ...MessageFilter) {
+	t.Helper()
+	if ms := r.Messages(fs...); len(ms) > 0 {
+		t.Fatalf("astibobtest: %d matching message(s) have been dispatched", len(ms))
+	}
+}
+
+func (r *Recorder) names() string {
+	var ns []string
+	for _, m := range r.Messages() {
+		ns = append(ns, m.Name)
+	}
+	return "[" + strings.Join(ns, ", ") + "]"
+}
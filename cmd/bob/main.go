@@ -0,0 +1,421 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astibob/index"
+	"github.com/asticode/go-astiws"
+	"github.com/gorilla/websocket"
+)
+
+// Flags
+var (
+	addr     = flag.String("addr", "127.0.0.1:4000", "the index addr")
+	caCert   = flag.String("ca-cert", "", "the path to the CA used to verify the index")
+	cert     = flag.String("cert", "", "the path to the certificate presented to the index")
+	key      = flag.String("key", "", "the path to the key of the certificate presented to the index")
+	password = flag.String("password", "", "the index password")
+	useTLS   = flag.Bool("tls", false, "whether the index uses TLS")
+	username = flag.String("username", "", "the index username")
+)
+
+const usage = `Usage: bob [flags] <command> [args]
+
+Commands:
+  workers                                             lists workers and runnables
+  start <worker> <runnable>                           starts a runnable
+  stop <worker> <runnable>                            stops a runnable
+  send [-p payload] <worker> [<runnable>] <name>      sends a message with a JSON payload
+  tail [-n names] [-f from] [-t to] [-p]              prints live messages
+  call [-b body] <worker> <runnable> <method> <path>  calls a runnable route (e.g. GET /train)
+
+Flags:
+`
+
+type client struct {
+	c  *http.Client
+	o  astibob.ServerOptions
+	wd *websocket.Dialer
+}
+
+func main() {
+	// Set logger
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+
+	// No command
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Create client
+	c, err := newClient(astibob.ServerOptions{
+		Addr:     *addr,
+		CACert:   *caCert,
+		Cert:     *cert,
+		Key:      *key,
+		Password: *password,
+		TLS:      *useTLS,
+		Username: *username,
+	})
+	if err != nil {
+		log.Fatal(fmt.Errorf("main: creating client failed: %w", err))
+	}
+
+	// Switch on command
+	args := flag.Args()[1:]
+	switch cmd := flag.Arg(0); cmd {
+	case "call":
+		err = c.call(args)
+	case "send":
+		err = c.send(args)
+	case "start", "stop":
+		err = c.toggle(cmd, args)
+	case "tail":
+		err = c.tail(args)
+	case "workers":
+		err = c.workers()
+	default:
+		err = fmt.Errorf("main: unknown command %s", cmd)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func newClient(o astibob.ServerOptions) (c *client, err error) {
+	// Create client
+	c = &client{
+		c: &http.Client{},
+		o: o,
+	}
+
+	// Get TLS config
+	tc, err := astibob.ClientTLSConfig(o)
+	if err != nil {
+		err = fmt.Errorf("main: getting client tls config failed: %w", err)
+		return
+	}
+
+	// TLS is in use
+	if tc != nil {
+		// Configure http client
+		c.c.Transport = &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tc,
+		}
+	}
+
+	// Create websocket dialer
+	c.wd = astibob.NewWebsocketDialer(tc, nil)
+	return
+}
+
+func (c *client) header() (h http.Header) {
+	h = make(http.Header)
+	if c.o.Username != "" && c.o.Password != "" {
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(c.o.Username+":"+c.o.Password)))
+	}
+	return
+}
+
+func (c *client) do(method, path string, body io.Reader, data interface{}) (err error) {
+	// Create request
+	var r *http.Request
+	if r, err = http.NewRequest(method, c.o.HTTPScheme()+"://"+c.o.Addr+path, body); err != nil {
+		err = fmt.Errorf("main: creating request failed: %w", err)
+		return
+	}
+	r.Header = c.header()
+
+	// Send request
+	var resp *http.Response
+	if resp, err = c.c.Do(r); err != nil {
+		err = fmt.Errorf("main: sending %s request to %s failed: %w", method, path, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	// Invalid status code
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var e astibob.Error
+		if b, _ := ioutil.ReadAll(resp.Body); json.Unmarshal(b, &e) == nil && e.Message != "" {
+			err = fmt.Errorf("main: %s request to %s failed with status code %d: %s", method, path, resp.StatusCode, e.Message)
+		} else {
+			err = fmt.Errorf("main: %s request to %s failed with status code %d", method, path, resp.StatusCode)
+		}
+		return
+	}
+
+	// Write data
+	switch d := data.(type) {
+	case nil:
+	case io.Writer:
+		if _, err = io.Copy(d, resp.Body); err != nil {
+			err = fmt.Errorf("main: copying body failed: %w", err)
+			return
+		}
+	default:
+		if err = json.NewDecoder(resp.Body).Decode(d); err != nil {
+			err = fmt.Errorf("main: unmarshaling body failed: %w", err)
+			return
+		}
+	}
+	return
+}
+
+func (c *client) workers() (err error) {
+	// Get workers
+	var ws []astibob.Worker
+	if err = c.do(http.MethodGet, "/api/workers", nil, &ws); err != nil {
+		err = fmt.Errorf("main: getting workers failed: %w", err)
+		return
+	}
+
+	// Print
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "WORKER\tRUNNABLE\tSTATUS\tUPTIME\tRESTARTS\tLAST ERROR")
+	for _, w := range ws {
+		if len(w.Runnables) == 0 {
+			fmt.Fprintf(tw, "%s\t\t\t\t\t\n", w.Name)
+			continue
+		}
+		for _, r := range w.Runnables {
+			var uptime string
+			if r.Uptime > 0 {
+				uptime = r.Uptime.Round(time.Second).String()
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", w.Name, r.Name, r.Status, uptime, r.Restarts, r.LastError)
+		}
+	}
+	return tw.Flush()
+}
+
+func runnablePath(worker, runnable string) string {
+	return "/workers/" + url.PathEscape(worker) + "/runnables/" + url.PathEscape(runnable)
+}
+
+func (c *client) toggle(cmd string, args []string) (err error) {
+	// Invalid args
+	if len(args) != 2 {
+		err = fmt.Errorf("main: usage: bob %s <worker> <runnable>", cmd)
+		return
+	}
+
+	// Send request
+	if err = c.do(http.MethodPost, "/api"+runnablePath(args[0], args[1])+"/"+cmd, nil, nil); err != nil {
+		err = fmt.Errorf("main: %s failed: %w", cmd, err)
+		return
+	}
+	return
+}
+
+func (c *client) send(args []string) (err error) {
+	// Parse flags
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	payload := fs.String("p", "", "the JSON payload")
+	fs.Parse(args) //nolint:errcheck
+
+	// Create message
+	var m index.APIMessage
+	switch fs.NArg() {
+	case 2:
+		m.Worker, m.Name = fs.Arg(0), fs.Arg(1)
+	case 3:
+		m.Worker, m.Runnable, m.Name = fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	default:
+		err = errors.New("main: usage: bob send [-p payload] <worker> [<runnable>] <name>")
+		return
+	}
+
+	// Add payload
+	if *payload != "" {
+		if !json.Valid([]byte(*payload)) {
+			err = errors.New("main: payload is not valid JSON")
+			return
+		}
+		m.Payload = json.RawMessage(*payload)
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(m); err != nil {
+		err = fmt.Errorf("main: marshaling message failed: %w", err)
+		return
+	}
+
+	// Send request
+	if err = c.do(http.MethodPost, "/api/messages", bytes.NewReader(b), nil); err != nil {
+		err = fmt.Errorf("main: sending message failed: %w", err)
+		return
+	}
+	return
+}
+
+func (c *client) call(args []string) (err error) {
+	// Parse flags
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	body := fs.String("b", "", "the request body")
+	fs.Parse(args) //nolint:errcheck
+
+	// Invalid args
+	if fs.NArg() != 4 {
+		err = errors.New("main: usage: bob call [-b body] <worker> <runnable> <method> <path>")
+		return
+	}
+
+	// Create body
+	var r io.Reader
+	if *body != "" {
+		r = strings.NewReader(*body)
+	}
+
+	// Send request
+	p := runnablePath(fs.Arg(0), fs.Arg(1)) + "/routes/" + strings.TrimPrefix(fs.Arg(3), "/")
+	if err = c.do(strings.ToUpper(fs.Arg(2)), p, r, os.Stdout); err != nil {
+		err = fmt.Errorf("main: calling route failed: %w", err)
+		return
+	}
+	return
+}
+
+// identifier returns "<worker>/<runnable>" for runnables, the name for workers and the type otherwise
+func identifier(i *astibob.Identifier) string {
+	if i == nil {
+		return ""
+	}
+	switch {
+	case i.Type == astibob.RunnableIdentifierType && i.Name != nil:
+		return i.WorkerName() + "/" + *i.Name
+	case i.Type == astibob.WorkerIdentifierType && i.Name != nil:
+		return *i.Name
+	}
+	return i.Type
+}
+
+func (c *client) tail(args []string) (err error) {
+	// Parse flags
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	from := fs.String("f", "", "only print messages whose sender matches this pattern (e.g. \"kitchen/*\")")
+	names := fs.String("n", "*", "only print messages whose name matches one of these comma-separated patterns")
+	payload := fs.Bool("p", false, "print payloads")
+	to := fs.String("t", "", "only print messages whose recipient matches this pattern")
+	fs.Parse(args) //nolint:errcheck
+
+	// Create websocket client
+	ws := astibob.NewWebsocketClient(c.wd, nil)
+	ws.SetMessageHandler(func(p []byte) (err error) {
+		// Unmarshal
+		m := astibob.NewMessage()
+		if err = astibob.UnmarshalMessage(p, m); err != nil {
+			err = fmt.Errorf("main: unmarshaling message failed: %w", err)
+			return
+		}
+
+		// Welcome
+		if m.Name == astibob.UIWelcomeMessage {
+			// Parse payload
+			var w astibob.WelcomeUI
+			if err = m.UnmarshalPayload(&w); err != nil {
+				err = fmt.Errorf("main: parsing welcome payload failed: %w", err)
+				return
+			}
+			ui := *astibob.NewUIIdentifier(w.Name)
+
+			// Register
+			// The index only sends messages whose name has been requested
+			if err = ws.WriteJSON(uiMessage(ui, astibob.UIRegisterMessage, astibob.UI{
+				MessageNames: strings.Split(*names, ","),
+				Name:         w.Name,
+			})); err != nil {
+				err = fmt.Errorf("main: writing register message failed: %w", err)
+				return
+			}
+
+			// Ping
+			// The index closes connections that haven't been extended for too long
+			go func() {
+				for range time.Tick(astiws.PingPeriod) {
+					if err := ws.WriteJSON(uiMessage(ui, astibob.UIPingMessage, nil)); err != nil {
+						log.Println(fmt.Errorf("main: writing ping message failed: %w", err))
+					}
+				}
+			}()
+			return
+		}
+
+		// Check filters
+		if (*from != "" && !astibob.WildcardMatch(*from, identifier(&m.From))) ||
+			(*to != "" && !astibob.WildcardMatch(*to, identifier(m.To))) {
+			return
+		}
+
+		// Print
+		s := fmt.Sprintf("%s %s -> %s %s", time.Now().Format("15:04:05.000"), identifier(&m.From), identifier(m.To), m.Name)
+		if *payload && len(m.Payload) > 0 {
+			s += " " + string(m.Payload)
+		}
+		fmt.Println(s)
+		return
+	})
+
+	// Dial
+	if err = ws.DialWithHeaders(c.o.WebsocketScheme()+"://"+c.o.Addr+"/websockets/ui", c.header()); err != nil {
+		err = fmt.Errorf("main: dialing index failed: %w", err)
+		return
+	}
+	defer ws.Close()
+
+	// Handle signals
+	go func() {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, os.Interrupt)
+		<-ch
+		ws.Close()
+	}()
+
+	// Read
+	if err = ws.Read(); err != nil {
+		var e *websocket.CloseError
+		if errors.As(err, &e) && e.Code == websocket.CloseNormalClosure {
+			err = nil
+			return
+		}
+		err = fmt.Errorf("main: reading websocket failed: %w", err)
+		return
+	}
+	return
+}
+
+func uiMessage(from astibob.Identifier, name string, payload interface{}) (m map[string]interface{}) {
+	m = map[string]interface{}{
+		"from": from,
+		"name": name,
+		"to":   astibob.NewIndexIdentifier(),
+	}
+	if payload != nil {
+		m["payload"] = payload
+	}
+	return
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+	"github.com/gorilla/websocket"
+)
+
+type testRequest struct {
+	auth   string
+	body   string
+	method string
+	path   string
+}
+
+func newTestClient(t *testing.T, s *httptest.Server) *client {
+	c, err := newClient(astibob.ServerOptions{Addr: strings.TrimPrefix(s.URL, "http://"), Password: "p", Username: "u"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// captureStdout returns what fn has printed
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	// Create pipe
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// Swap stdout
+	stdout := os.Stdout
+	os.Stdout = w
+	err = fn()
+	os.Stdout = stdout
+	w.Close()
+
+	// Read
+	b, _ := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+func TestCommands(t *testing.T) {
+	// Create index
+	m := &sync.Mutex{}
+	var trs []testRequest
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Record request
+		b, _ := ioutil.ReadAll(r.Body)
+		m.Lock()
+		trs = append(trs, testRequest{auth: r.Header.Get("Authorization"), body: string(b), method: r.Method, path: r.URL.EscapedPath()})
+		m.Unlock()
+
+		// Write response
+		switch r.URL.Path {
+		case "/api/workers":
+			json.NewEncoder(rw).Encode([]astibob.Worker{{Name: "w", Runnables: []astibob.RunnableMessage{{Metadata: astibob.Metadata{Name: "r"}, Status: astibob.RunningStatus}}}}) //nolint:errcheck
+		case "/api/workers/w/runnables/unknown/start":
+			rw.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(rw).Encode(astibob.Error{Message: "no runnable"}) //nolint:errcheck
+		case "/workers/w/runnables/r/routes/train":
+			rw.Write([]byte("training")) //nolint:errcheck
+		}
+	}))
+	defer s.Close()
+	c := newTestClient(t, s)
+	last := func() testRequest {
+		m.Lock()
+		defer m.Unlock()
+		return trs[len(trs)-1]
+	}
+
+	// Loop through commands
+	for _, v := range []struct {
+		fn     func() error
+		name   string
+		output string
+		r      testRequest
+	}{
+		{fn: c.workers, name: "workers", output: "w       r         running", r: testRequest{method: http.MethodGet, path: "/api/workers"}},
+		{fn: func() error { return c.toggle("start", []string{"w", "r"}) }, name: "start", r: testRequest{method: http.MethodPost, path: "/api/workers/w/runnables/r/start"}},
+		{fn: func() error { return c.toggle("stop", []string{"w w", "r"}) }, name: "stop", r: testRequest{method: http.MethodPost, path: "/api/workers/w%20w/runnables/r/stop"}},
+		{fn: func() error { return c.send([]string{"-p", `{"k":"v"}`, "w", "r", "r.say"}) }, name: "send to runnable", r: testRequest{body: `{"name":"r.say","payload":{"k":"v"},"runnable":"r","worker":"w"}`, method: http.MethodPost, path: "/api/messages"}},
+		{fn: func() error { return c.send([]string{"w", "w.event"}) }, name: "send to worker", r: testRequest{body: `{"name":"w.event","worker":"w"}`, method: http.MethodPost, path: "/api/messages"}},
+		{fn: func() error { return c.call([]string{"-b", "body", "w", "r", "post", "/train"}) }, name: "call", output: "training", r: testRequest{body: "body", method: http.MethodPost, path: "/workers/w/runnables/r/routes/train"}},
+	} {
+		// Run
+		o, err := captureStdout(t, v.fn)
+		if err != nil {
+			t.Fatalf("%s: running command failed: %v", v.name, err)
+		}
+
+		// Check output
+		if !strings.Contains(o, v.output) {
+			t.Errorf("%s: expected output to contain %q, got %q", v.name, v.output, o)
+		}
+
+		// Check request
+		v.r.auth = "Basic dTpw"
+		if r := last(); r != v.r {
+			t.Errorf("%s: expected %+v, got %+v", v.name, v.r, r)
+		}
+	}
+
+	// Invalid commands
+	m.Lock()
+	n := len(trs)
+	m.Unlock()
+	for _, v := range []struct {
+		err  string
+		fn   func() error
+		name string
+	}{
+		{err: "usage", fn: func() error { return c.toggle("start", []string{"w"}) }, name: "start without runnable"},
+		{err: "usage", fn: func() error { return c.send([]string{"w"}) }, name: "send without name"},
+		{err: "not valid JSON", fn: func() error { return c.send([]string{"-p", "{", "w", "w.event"}) }, name: "send invalid payload"},
+		{err: "usage", fn: func() error { return c.call([]string{"w", "r", "GET"}) }, name: "call without path"},
+	} {
+		if err := v.fn(); err == nil || !strings.Contains(err.Error(), v.err) {
+			t.Errorf("%s: expected error containing %s, got %v", v.name, v.err, err)
+		}
+	}
+	m.Lock()
+	l := len(trs)
+	m.Unlock()
+	if l != n {
+		t.Fatalf("invalid commands shouldn't send requests, got %d", l-n)
+	}
+
+	// Index errors are reported
+	if err := c.toggle("start", []string{"w", "unknown"}); err == nil || !strings.Contains(err.Error(), "no runnable") {
+		t.Fatalf("expected index error, got %v", err)
+	}
+}
+
+func TestTail(t *testing.T) {
+	// Create index
+	var ui astibob.UI
+	u := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Upgrade
+		c, err := u.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+
+		// Welcome
+		c.WriteMessage(websocket.TextMessage, []byte(`{"from":{"type":"index"},"name":"ui.welcome","payload":{"name":"u"}}`)) //nolint:errcheck
+
+		// Read register
+		var m astibob.Message
+		if err = c.ReadJSON(&m); err != nil || m.Name != astibob.UIRegisterMessage {
+			return
+		}
+		m.UnmarshalPayload(&ui) //nolint:errcheck
+
+		// Write messages
+		for _, m := range []string{
+			`{"from":{"name":"r","type":"runnable","worker":"kitchen"},"name":"r.text","payload":"hello","to":{"type":"ui"}}`,
+			`{"from":{"name":"r","type":"runnable","worker":"garage"},"name":"r.text","payload":"ignored","to":{"type":"ui"}}`,
+		} {
+			c.WriteMessage(websocket.TextMessage, []byte(m)) //nolint:errcheck
+		}
+
+		// Close
+		c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")) //nolint:errcheck
+
+		// Wait for the client to close the connection
+		c.ReadMessage() //nolint:errcheck
+	}))
+	defer s.Close()
+	c := newTestClient(t, s)
+
+	// Tail
+	o, err := captureStdout(t, func() error { return c.tail([]string{"-n", "r.*,s.*", "-f", "kitchen/*", "-p"}) })
+	if err != nil {
+		t.Fatalf("tailing failed: %v", err)
+	}
+
+	// Names have been requested
+	if e := (astibob.UI{MessageNames: []string{"r.*", "s.*"}, Name: "u"}); !reflect.DeepEqual(e, ui) {
+		t.Fatalf("expected %+v, got %+v", e, ui)
+	}
+
+	// Messages have been filtered
+	if !strings.Contains(o, `kitchen/r -> ui r.text "hello"`) {
+		t.Errorf("expected output to contain hello, got %q", o)
+	}
+	if strings.Contains(o, "ignored") {
+		t.Errorf("expected output to be filtered, got %q", o)
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	for _, v := range []struct {
+		expected string
+		i        *astibob.Identifier
+	}{
+		{},
+		{expected: "w/r", i: astibob.NewRunnableIdentifier("r", "w")},
+		{expected: "w", i: astibob.NewWorkerIdentifier("w")},
+		{expected: astibob.UIIdentifierType, i: &astibob.Identifier{Type: astibob.UIIdentifierType}},
+	} {
+		if g := identifier(v.i); g != v.expected {
+			t.Errorf("expected %s, got %s", v.expected, g)
+		}
+	}
+}
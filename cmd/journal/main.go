@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+// Flags
+var (
+	direction = flag.String("d", "", "only show messages with this direction (in or out)")
+	from      = flag.String("f", "", "only show messages emitted by runnables matching this pattern")
+	names     = flag.String("n", "", "only show messages whose name matches one of these comma-separated patterns")
+	path      = flag.String("p", "", "the path to the journal")
+	payload   = flag.Bool("payload", false, "print payloads")
+	since     = flag.String("since", "", "only show messages recorded after this RFC3339 time")
+	stats     = flag.Bool("stats", false, "print the number of messages per name instead of the messages")
+	until     = flag.String("until", "", "only show messages recorded before this RFC3339 time")
+	worker    = flag.String("w", "", "only show messages emitted by workers matching this pattern")
+)
+
+func main() {
+	// Set logger
+	flag.Parse()
+	log.SetFlags(0)
+
+	// No path
+	if *path == "" {
+		log.Fatal("main: no journal path provided")
+	}
+
+	// Create filter
+	f := astibob.JournalFilter{
+		Direction: *direction,
+		From:      *from,
+		Worker:    *worker,
+	}
+	if *names != "" {
+		f.Names = strings.Split(*names, ",")
+	}
+	var err error
+	if *since != "" {
+		if f.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+			log.Fatal(fmt.Errorf("main: parsing since failed: %w", err))
+		}
+	}
+	if *until != "" {
+		if f.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+			log.Fatal(fmt.Errorf("main: parsing until failed: %w", err))
+		}
+	}
+
+	// Create reader
+	r, err := astibob.NewJournalReader(*path, f)
+	if err != nil {
+		log.Fatal(fmt.Errorf("main: creating journal reader failed: %w", err))
+	}
+	defer r.Close()
+
+	// Loop through entries
+	ns := make(map[string]int)
+	for {
+		// Next entry
+		e, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			log.Fatal(fmt.Errorf("main: getting next entry failed: %w", err))
+		}
+
+		// Stats
+		if *stats {
+			ns[e.Message.Name]++
+			continue
+		}
+
+		// Print entry
+		s := fmt.Sprintf("%s %-3s %s -> %s %s", e.At.Format(time.RFC3339Nano), e.Direction, identifier(&e.Message.From), identifier(e.Message.To), e.Message.Name)
+		if *payload && len(e.Message.Payload) > 0 {
+			s += " " + string(e.Message.Payload)
+		}
+		fmt.Println(s)
+	}
+
+	// Print stats
+	if *stats {
+		// Sort names
+		var ks []string
+		for k := range ns {
+			ks = append(ks, k)
+		}
+		sort.Strings(ks)
+
+		// Loop through names
+		for _, k := range ks {
+			fmt.Printf("%s: %d\n", k, ns[k])
+		}
+	}
+}
+
+func identifier(i *astibob.Identifier) string {
+	// No identifier
+	if i == nil {
+		return "*"
+	}
+
+	// Get type
+	t := i.Type
+	if len(i.Types) > 0 {
+		var ts []string
+		for k := range i.Types {
+			ts = append(ts, k)
+		}
+		sort.Strings(ts)
+		t = strings.Join(ts, "|")
+	}
+
+	// Add worker and name
+	if i.Worker != nil {
+		t += ":" + *i.Worker
+	}
+	if i.Name != nil {
+		t += "/" + *i.Name
+	}
+	return t
+}
@@ -0,0 +1,335 @@
+package astibob
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Codec names
+const (
+	CBORCodecName = "cbor"
+	JSONCodecName = "json"
+)
+
+// RFC 8746 typed array tags
+const (
+	sint16LETag = 77
+	sint32LETag = 78
+)
+
+// Codecs
+var (
+	CBORCodec Codec = cborCodec{}
+	JSONCodec Codec = jsonCodec{}
+)
+
+// Codecs supported by this package in order of preference
+var SupportedCodecs = []string{CBORCodecName, JSONCodecName}
+
+var cborDecMode cbor.DecMode
+
+func init() {
+	// Create cbor decoding mode used when transcoding payloads
+	var err error
+	o := cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}(nil))}
+	if cborDecMode, err = o.DecMode(); err != nil {
+		panic(fmt.Errorf("astibob: creating cbor decoding mode failed: %w", err))
+	}
+}
+
+type Codec interface {
+	ContentType() string
+	Marshal(v interface{}) ([]byte, error)
+	Name() string
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// CodecByName returns the codec with the provided name. An empty name is JSON.
+func CodecByName(name string) (c Codec, ok bool) {
+	switch name {
+	case CBORCodecName:
+		return CBORCodec, true
+	case "", JSONCodecName:
+		return JSONCodec, true
+	}
+	return
+}
+
+// NegotiateCodec returns the preferred codec shared with a peer supporting the provided codec names.
+// Peers that don't advertise any codec only understand JSON.
+func NegotiateCodec(names []string) Codec {
+	// Index names
+	ns := make(map[string]bool)
+	for _, n := range names {
+		ns[n] = true
+	}
+
+	// Loop through supported codecs
+	for _, n := range SupportedCodecs {
+		if _, ok := ns[n]; ok {
+			c, _ := CodecByName(n)
+			return c
+		}
+	}
+	return JSONCodec
+}
+
+// UnmarshalMessage unmarshals a message encoded with any supported codec
+func UnmarshalMessage(data []byte, m *Message) (err error) {
+	// Get codec
+	// JSON messages are always objects whereas CBOR messages are always maps
+	c := CBORCodec
+	if startsWithJSON(data, '{') {
+		c = JSONCodec
+	}
+
+	// Unmarshal
+	if err = c.Unmarshal(data, m); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling %s message failed: %w", c.Name(), err)
+		return
+	}
+	return
+}
+
+// UnmarshalMessages unmarshals a batch of messages encoded with any supported codec
+func UnmarshalMessages(data []byte) (ms []*Message, err error) {
+	// Get codec
+	// JSON batches always start with '[' whereas CBOR arrays start with a major type 4 byte
+	c := CBORCodec
+	if startsWithJSON(data, '[') {
+		c = JSONCodec
+	}
+
+	// Unmarshal
+	if err = c.Unmarshal(data, &ms); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling %s messages failed: %w", c.Name(), err)
+		return
+	}
+	return
+}
+
+// startsWithJSON checks whether data starts with a specific JSON delimiter once leading whitespace is skipped.
+// Whitespace bytes are CBOR integers which can't start a CBOR message or batch.
+func startsWithJSON(data []byte, delim byte) bool {
+	data = bytes.TrimLeft(data, " \t\r\n")
+	return len(data) > 0 && data[0] == delim
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Name() string { return JSONCodecName }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+type cborCodec struct{}
+
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) { return cbor.Marshal(v) }
+
+func (cborCodec) Name() string { return CBORCodecName }
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
+
+// transcodeToJSON converts a payload encoded with a binary codec into JSON so that it can be sent to peers that only
+// understand JSON such as the UI
+func transcodeToJSON(c Codec, data []byte) (o json.RawMessage, err error) {
+	// Nothing to transcode
+	if c.Name() == JSONCodecName || len(data) == 0 {
+		o = data
+		return
+	}
+
+	// Decode
+	var v interface{}
+	if err = cborDecMode.Unmarshal(data, &v); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling %s payload failed: %w", c.Name(), err)
+		return
+	}
+
+	// Normalize
+	if v, err = normalizeForJSON(v); err != nil {
+		err = fmt.Errorf("astibob: normalizing %s payload failed: %w", c.Name(), err)
+		return
+	}
+
+	// Encode
+	if o, err = json.Marshal(v); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func normalizeForJSON(i interface{}) (o interface{}, err error) {
+	switch v := i.(type) {
+	case []interface{}:
+		for idx := range v {
+			if v[idx], err = normalizeForJSON(v[idx]); err != nil {
+				return
+			}
+		}
+		o = v
+	case map[string]interface{}:
+		for k := range v {
+			if v[k], err = normalizeForJSON(v[k]); err != nil {
+				return
+			}
+		}
+		o = v
+	case cbor.Tag:
+		// Typed arrays are decoded as tags
+		var ss PCMSamples
+		if ss, err = unmarshalPCMSamplesTag(v); err != nil {
+			return
+		}
+		o = []int(ss)
+	default:
+		o = i
+	}
+	return
+}
+
+// PCMSamples are audio samples that binary codecs encode as a raw byte blob (RFC 8746 typed array) instead of an
+// array of numbers
+type PCMSamples []int
+
+func (ss PCMSamples) MarshalCBOR() ([]byte, error) {
+	// Get the smallest width that fits all samples
+	width := 2
+	for _, s := range ss {
+		if s < math.MinInt16 || s > math.MaxInt16 {
+			width = 4
+			break
+		}
+	}
+
+	// Create tag
+	t := cbor.Tag{Number: sint16LETag}
+	if width == 4 {
+		t.Number = sint32LETag
+	}
+
+	// Write samples
+	b := make([]byte, len(ss)*width)
+	for idx, s := range ss {
+		if width == 2 {
+			binary.LittleEndian.PutUint16(b[idx*width:], uint16(int16(s)))
+		} else {
+			binary.LittleEndian.PutUint32(b[idx*width:], uint32(int32(s)))
+		}
+	}
+	t.Content = b
+	return cbor.Marshal(t)
+}
+
+func (ss *PCMSamples) UnmarshalCBOR(data []byte) (err error) {
+	// Unmarshal tag
+	var t cbor.Tag
+	if err = cbor.Unmarshal(data, &t); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling tag failed: %w", err)
+		return
+	}
+
+	// Unmarshal samples
+	if *ss, err = unmarshalPCMSamplesTag(t); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling samples failed: %w", err)
+		return
+	}
+	return
+}
+
+func unmarshalPCMSamplesTag(t cbor.Tag) (ss PCMSamples, err error) {
+	// Invalid content
+	b, ok := t.Content.([]byte)
+	if !ok {
+		err = fmt.Errorf("astibob: invalid content type %T for tag %d", t.Content, t.Number)
+		return
+	}
+
+	// Get width
+	var width int
+	switch t.Number {
+	case sint16LETag:
+		width = 2
+	case sint32LETag:
+		width = 4
+	default:
+		err = fmt.Errorf("astibob: unsupported tag %d", t.Number)
+		return
+	}
+
+	// Invalid length
+	if len(b)%width != 0 {
+		err = errors.New("astibob: invalid typed array length")
+		return
+	}
+
+	// Read samples
+	ss = make(PCMSamples, len(b)/width)
+	for idx := range ss {
+		if width == 2 {
+			ss[idx] = int(int16(binary.LittleEndian.Uint16(b[idx*width:])))
+		} else {
+			ss[idx] = int(int32(binary.LittleEndian.Uint32(b[idx*width:])))
+		}
+	}
+	return
+}
+
+// WebsocketWriter represents a websocket client such as an astiws client or a WebsocketClient
+type WebsocketWriter interface {
+	WriteText(p []byte) error
+}
+
+// WebsocketBinaryWriter represents a websocket client that can write binary frames such as a WebsocketClient
+type WebsocketBinaryWriter interface {
+	WriteBinary(p []byte) error
+}
+
+// WriteWebsocketMessage writes a message to a websocket client with a specific codec
+func WriteWebsocketMessage(c WebsocketWriter, cd Codec, m *Message) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = cd.Marshal(m); err != nil {
+		err = fmt.Errorf("astibob: marshaling %s message failed: %w", cd.Name(), err)
+		return
+	}
+
+	// Write
+	if err = WriteWebsocket(c, cd, b); err != nil {
+		err = fmt.Errorf("astibob: writing %s message failed: %w", cd.Name(), err)
+		return
+	}
+	return
+}
+
+// WriteWebsocket writes data encoded with a specific codec to a websocket client. JSON data is written in text
+// frames whereas binary data is written in binary frames when the client supports it.
+func WriteWebsocket(c WebsocketWriter, cd Codec, p []byte) error {
+	// Text
+	if cd.Name() == JSONCodecName {
+		return c.WriteText(p)
+	}
+
+	// Binary
+	if bw, ok := c.(WebsocketBinaryWriter); ok {
+		return bw.WriteBinary(p)
+	}
+
+	// astiws clients only write text frames but since both ends of binary connections are Go peers that don't
+	// validate text frames, we can safely use them. Since the codec is picked by looking at the data, readers
+	// don't depend on the frame type either.
+	return c.WriteText(p)
+}
@@ -0,0 +1,163 @@
+package astibob
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNegotiateCodec(t *testing.T) {
+	for _, v := range []struct {
+		e     Codec
+		names []string
+	}{
+		{e: JSONCodec},
+		{e: JSONCodec, names: []string{"unknown"}},
+		{e: JSONCodec, names: []string{JSONCodecName}},
+		{e: CBORCodec, names: []string{JSONCodecName, CBORCodecName}},
+	} {
+		if c := NegotiateCodec(v.names); c != v.e {
+			t.Errorf("%v: expected %s, got %s", v.names, v.e.Name(), c.Name())
+		}
+	}
+}
+
+func TestMessageCodecs(t *testing.T) {
+	// Create message
+	type payload struct {
+		Samples PCMSamples `json:"samples"`
+		Text    string     `json:"text"`
+	}
+	p := payload{Samples: PCMSamples{-32768, 0, 32767}, Text: "text"}
+	m := newMessage(*NewRunnableIdentifier("r", "w1"), NewWorkerIdentifier("w2"), "test")
+	m.ID = 1
+	if err := m.MarshalPayloadWithCodec(CBORCodec, p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loop through codecs
+	for _, c := range []Codec{CBORCodec, JSONCodec} {
+		// Marshal
+		b, err := c.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Unmarshal
+		var o Message
+		if err = UnmarshalMessage(b, &o); err != nil {
+			t.Fatalf("%s: %s", c.Name(), err)
+		}
+		if o.ID != m.ID || o.Name != m.Name || o.From.WorkerName() != "w1" || o.To == nil || o.To.WorkerName() != "w2" {
+			t.Fatalf("%s: expected %+v, got %+v", c.Name(), m, o)
+		}
+
+		// JSON payloads are transcoded
+		if c == JSONCodec && o.PayloadCodec != "" {
+			t.Fatalf("%s: expected JSON payload, got %s", c.Name(), o.PayloadCodec)
+		}
+
+		// Unmarshal payload
+		var op payload
+		if err = o.UnmarshalPayload(&op); err != nil {
+			t.Fatalf("%s: %s", c.Name(), err)
+		}
+		if !reflect.DeepEqual(op, p) {
+			t.Fatalf("%s: expected payload %+v, got %+v", c.Name(), p, op)
+		}
+
+		// Batches
+		if b, err = c.Marshal([]*Message{m, m}); err != nil {
+			t.Fatal(err)
+		}
+		ms, err := UnmarshalMessages(b)
+		if err != nil {
+			t.Fatalf("%s: %s", c.Name(), err)
+		}
+		if len(ms) != 2 || ms[1].Name != m.Name {
+			t.Fatalf("%s: expected 2 messages, got %+v", c.Name(), ms)
+		}
+	}
+}
+
+func TestPCMSamples(t *testing.T) {
+	ss := PCMSamples{-2147483648, -1, 0, 1, 2147483647}
+	b, err := CBORCodec.Marshal(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o PCMSamples
+	if err = CBORCodec.Unmarshal(b, &o); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(o, ss) {
+		t.Fatalf("expected %v, got %v", ss, o)
+	}
+}
+
+func TestUnmarshalMessageWithWhitespace(t *testing.T) {
+	// Message
+	var m Message
+	if err := UnmarshalMessage([]byte(" \n\t{\"name\":\"test\"}"), &m); err != nil {
+		t.Fatalf("unmarshaling message failed: %v", err)
+	}
+	if m.Name != "test" {
+		t.Fatalf("expected test, got %s", m.Name)
+	}
+
+	// Batch
+	ms, err := UnmarshalMessages([]byte("\r\n [{\"name\":\"test\"}]"))
+	if err != nil {
+		t.Fatalf("unmarshaling messages failed: %v", err)
+	}
+	if len(ms) != 1 || ms[0].Name != "test" {
+		t.Fatalf("expected a test message, got %+v", ms)
+	}
+}
+
+type testWebsocketWriter struct{ text bool }
+
+func (w *testWebsocketWriter) WriteText(p []byte) error {
+	w.text = true
+	return nil
+}
+
+type testWebsocketBinaryWriter struct {
+	testWebsocketWriter
+	binary bool
+}
+
+func (w *testWebsocketBinaryWriter) WriteBinary(p []byte) error {
+	w.binary = true
+	return nil
+}
+
+func TestWriteWebsocketMessage(t *testing.T) {
+	// Loop through cases
+	for _, v := range []struct {
+		binary bool
+		cd     Codec
+		name   string
+		w      interface{}
+	}{
+		{cd: JSONCodec, name: "json", w: &testWebsocketBinaryWriter{}},
+		{binary: true, cd: CBORCodec, name: "cbor", w: &testWebsocketBinaryWriter{}},
+		{cd: CBORCodec, name: "cbor without binary frames", w: &testWebsocketWriter{}},
+	} {
+		// Write
+		if err := WriteWebsocketMessage(v.w.(WebsocketWriter), v.cd, &Message{Name: "test"}); err != nil {
+			t.Fatalf("%s: writing message failed: %v", v.name, err)
+		}
+
+		// Check frame type
+		var binary, text bool
+		switch w := v.w.(type) {
+		case *testWebsocketBinaryWriter:
+			binary, text = w.binary, w.text
+		case *testWebsocketWriter:
+			text = w.text
+		}
+		if binary != v.binary || text == v.binary {
+			t.Fatalf("%s: expected binary %v, got binary %v and text %v", v.name, v.binary, binary, text)
+		}
+	}
+}
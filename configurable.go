@@ -0,0 +1,182 @@
+package astibob
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Config field types
+const (
+	ConfigFieldTypeBool   = "bool"
+	ConfigFieldTypeNumber = "number"
+	ConfigFieldTypeString = "string"
+)
+
+// Configurable is implemented by runnables whose config can be updated at runtime.
+// The worker validates configs against the schema before calling ValidateConfig and ApplyConfig with the full config,
+// and persists applied configs so that they survive restarts.
+type Configurable interface {
+	ApplyConfig(c Config) error
+	Config() Config
+	ConfigSchema() ConfigSchema
+	ValidateConfig(c Config) error
+}
+
+// Config represents config values indexed by field name
+type Config map[string]interface{}
+
+// Merge returns a new config containing the config values overridden by the update values
+func (c Config) Merge(u Config) (o Config) {
+	o = make(Config)
+	for k, v := range c {
+		o[k] = v
+	}
+	for k, v := range u {
+		o[k] = v
+	}
+	return
+}
+
+// Bool returns a bool value or false if it doesn't exist
+func (c Config) Bool(name string) bool {
+	v, _ := c[name].(bool)
+	return v
+}
+
+// Float64 returns a number value or 0 if it doesn't exist
+func (c Config) Float64(name string) float64 {
+	v, _ := configNumber(c[name])
+	return v
+}
+
+// String returns a string value or "" if it doesn't exist
+func (c Config) String(name string) string {
+	v, _ := c[name].(string)
+	return v
+}
+
+type ConfigSchema struct {
+	Fields []ConfigField `json:"fields"`
+}
+
+type ConfigField struct {
+	Description string   `json:"description,omitempty"`
+	Label       string   `json:"label"`
+	Max         *float64 `json:"max,omitempty"`
+	Min         *float64 `json:"min,omitempty"`
+	Name        string   `json:"name"`
+	Options     []string `json:"options,omitempty"` // Allowed values of string fields, empty means any value
+	Type        string   `json:"type"`
+}
+
+// Validate checks that the config only contains fields of the schema with valid values
+func (s ConfigSchema) Validate(c Config) (err error) {
+	// Index fields
+	fs := make(map[string]ConfigField)
+	for _, f := range s.Fields {
+		fs[f.Name] = f
+	}
+
+	// Get keys
+	var ks []string
+	for k := range c {
+		ks = append(ks, k)
+	}
+
+	// Sort keys
+	// Errors are easier to read when they're deterministic
+	sort.Strings(ks)
+
+	// Loop through keys
+	for _, k := range ks {
+		// Get field
+		f, ok := fs[k]
+		if !ok {
+			err = fmt.Errorf("astibob: unknown field %s", k)
+			return
+		}
+
+		// Validate value
+		if err = f.validate(c[k]); err != nil {
+			err = fmt.Errorf("astibob: invalid field %s: %w", k, err)
+			return
+		}
+	}
+	return
+}
+
+func (f ConfigField) validate(v interface{}) (err error) {
+	switch f.Type {
+	case ConfigFieldTypeBool:
+		if _, ok := v.(bool); !ok {
+			err = fmt.Errorf("astibob: %v is not a bool", v)
+			return
+		}
+	case ConfigFieldTypeNumber:
+		// Get number
+		n, ok := configNumber(v)
+		if !ok {
+			err = fmt.Errorf("astibob: %v is not a number", v)
+			return
+		}
+
+		// Check boundaries
+		if f.Min != nil && n < *f.Min {
+			err = fmt.Errorf("astibob: %v is lower than %v", n, *f.Min)
+			return
+		}
+		if f.Max != nil && n > *f.Max {
+			err = fmt.Errorf("astibob: %v is greater than %v", n, *f.Max)
+			return
+		}
+	case ConfigFieldTypeString:
+		// Get string
+		s, ok := v.(string)
+		if !ok {
+			err = fmt.Errorf("astibob: %v is not a string", v)
+			return
+		}
+
+		// Check options
+		if len(f.Options) > 0 {
+			var found bool
+			for _, o := range f.Options {
+				if o == s {
+					found = true
+					break
+				}
+			}
+			if !found {
+				err = fmt.Errorf("astibob: %s is not a valid option", s)
+				return
+			}
+		}
+	default:
+		err = fmt.Errorf("astibob: unknown type %s", f.Type)
+		return
+	}
+	return
+}
+
+func configNumber(v interface{}) (f float64, ok bool) {
+	ok = true
+	switch n := v.(type) {
+	case float32:
+		f = float64(n)
+	case float64:
+		f = n
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	case json.Number:
+		var err error
+		if f, err = n.Float64(); err != nil {
+			ok = false
+		}
+	default:
+		ok = false
+	}
+	return
+}
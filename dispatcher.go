@@ -2,23 +2,36 @@ package astibob
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/asticode/go-astikit"
 )
 
+// Queues that haven't been used for that long are garbage collected
+var dispatcherQueueIdleTimeout = time.Minute
+
 type MessageHandler func(m *Message) error
 
 type dispatcherHandler struct {
-	c DispatchConditions
-	h MessageHandler
+	c   DispatchConditions
+	h   MessageHandler
+	off uint32 // Handlers that have been removed may still be in queues, they must not be called
+}
+
+func (h *dispatcherHandler) isOff() bool {
+	return atomic.LoadUint32(&h.off) == 1
 }
 
 type DispatchConditions struct {
 	From  *Identifier
 	Name  *string
 	Names map[string]bool
+	// Bounds the queue of matching messages. Queue options set on the dispatcher take precedence.
+	Queue *QueueOptions
 	To    *Identifier
 }
 
@@ -53,112 +66,457 @@ func (c DispatchConditions) match(m *Message) bool {
 }
 
 type Dispatcher struct {
-	ctx context.Context
-	cs  map[string]*astikit.Chan
-	hs  []dispatcherHandler
-	l   astikit.SeverityLogger
-	mc  *sync.Mutex // Locks cs
-	mh  *sync.Mutex // Locks hs
-	t   astikit.TaskFunc
+	cancel context.CancelFunc
+	ctx    context.Context
+	ds     map[string]uint64 // Number of dropped messages indexed by message name
+	hs     []*dispatcherHandler
+	ims    []MessageMiddleware // Inbound middlewares
+	j      *Journal
+	l      astikit.SeverityLogger
+	md     *sync.Mutex             // Locks ds
+	mh     *sync.Mutex             // Locks hs
+	mm     *sync.Mutex             // Locks ims, j, mms, mt and oms
+	mms    []MessageMiddleware     // Message middlewares
+	mo     *sync.Mutex             // Locks os
+	mq     *sync.Mutex             // Locks qs
+	mt     *Metrics                // Counts dispatched messages and times handlers
+	oms    []MessageMiddleware     // Outbound middlewares
+	os     map[string]QueueOptions // Indexed by message name pattern
+	qs     map[string]*queue       // Indexed by key
+	t      astikit.TaskFunc
 }
 
-func NewDispatcher(ctx context.Context, t astikit.TaskFunc, l astikit.SeverityLogger) *Dispatcher {
-	return &Dispatcher{
-		ctx: ctx,
-		cs:  make(map[string]*astikit.Chan),
-		l:   l,
-		mc:  &sync.Mutex{},
-		mh:  &sync.Mutex{},
-		t:   t,
+func NewDispatcher(ctx context.Context, t astikit.TaskFunc, l astikit.SeverityLogger) (d *Dispatcher) {
+	// Create dispatcher
+	d = &Dispatcher{
+		ds: make(map[string]uint64),
+		l:  l,
+		md: &sync.Mutex{},
+		mh: &sync.Mutex{},
+		mm: &sync.Mutex{},
+		mo: &sync.Mutex{},
+		mq: &sync.Mutex{},
+		os: make(map[string]QueueOptions),
+		qs: make(map[string]*queue),
+		t:  t,
 	}
+
+	// Create context
+	d.ctx, d.cancel = context.WithCancel(ctx)
+
+	// Garbage collect queues
+	t().Do(d.gc)
+	return
 }
 
 func (d *Dispatcher) Close() {
+	// Cancel context
+	d.cancel()
+
 	// Lock
-	d.mc.Lock()
-	defer d.mc.Unlock()
+	d.mq.Lock()
+	defer d.mq.Unlock()
 
-	// Stop chans
-	for _, c := range d.cs {
-		c.Stop()
+	// Stop queues
+	for _, q := range d.qs {
+		q.stop()
 	}
 }
 
-func (d *Dispatcher) Dispatch(m *Message) {
+// Use adds middlewares wrapping handlers. Middlewares are executed in the order they've been added.
+func (d *Dispatcher) Use(ms ...MessageMiddleware) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	d.ims = append(d.ims, ms...)
+}
+
+// UseMessage adds middlewares wrapping the handling of a message by all its handlers, e.g. to rate limit messages
+// whatever the number of their handlers. They're executed once per message, before the middlewares added with Use.
+func (d *Dispatcher) UseMessage(ms ...MessageMiddleware) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	d.mms = append(d.mms, ms...)
+}
+
+// UseOutbound adds middlewares wrapping the dispatch funcs given to runnables
+func (d *Dispatcher) UseOutbound(ms ...MessageMiddleware) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	d.oms = append(d.oms, ms...)
+}
+
+// SetJournal records dispatched messages as inbound entries and messages dispatched through outbound funcs as
+// outbound entries
+func (d *Dispatcher) SetJournal(j *Journal) {
+	d.mm.Lock()
+	defer d.mm.Unlock()
+	d.j = j
+}
+
+// SetMetrics counts dispatched messages, times handlers and exposes queue lengths
+func (d *Dispatcher) SetMetrics(m *Metrics) {
+	// Set metrics
+	d.mm.Lock()
+	d.mt = m
+	d.mm.Unlock()
+
+	// Register collector
+	if err := m.Register(dispatcherCollector{d: d}); err != nil {
+		d.l.Error(fmt.Errorf("astibob: registering dispatcher collector failed: %w", err))
+	}
+}
+
+func (d *Dispatcher) record(direction string, m *Message) {
+	// Get journal and metrics
+	d.mm.Lock()
+	j := d.j
+	mt := d.mt
+	d.mm.Unlock()
+
+	// Count
+	if mt != nil {
+		mt.dispatched.WithLabelValues(m.Name, direction).Inc()
+	}
+
+	// No journal
+	if j == nil {
+		return
+	}
+
+	// Record
+	if err := j.Record(direction, m); err != nil {
+		d.l.Error(fmt.Errorf("astibob: recording message failed: %w", err))
+	}
+}
+
+// Outbound wraps a dispatch func with the outbound middlewares
+func (d *Dispatcher) Outbound(h MessageHandler) DispatchFunc {
+	return func(m *Message) {
+		// Get middlewares
+		d.mm.Lock()
+		ms := d.oms
+		d.mm.Unlock()
+
+		// Record
+		// Middlewares may modify or drop the message but it has been emitted anyway
+		d.record(JournalDirectionOutbound, m)
+
+		// Dispatch
+		if err := chainMessageMiddlewares(h, ms)(m); err != nil {
+			d.l.Error(fmt.Errorf("astibob: dispatching message failed: %w", err))
+		}
+	}
+}
+
+// SetQueueOptions bounds the queues of messages whose name matches the pattern (e.g. "audio_input.*")
+func (d *Dispatcher) SetQueueOptions(pattern string, o QueueOptions) {
+	d.mo.Lock()
+	defer d.mo.Unlock()
+	d.os[pattern] = o
+}
+
+func (d *Dispatcher) queueOptions(name string, hs []*dispatcherHandler) (o QueueOptions) {
+	// Get options set on the dispatcher
+	// When several patterns match, the longest one wins
+	d.mo.Lock()
+	var pattern string
+	var ok bool
+	for p, po := range d.os {
+		if WildcardMatch(p, name) && (!ok || len(p) > len(pattern)) {
+			o, ok, pattern = po, true, p
+		}
+	}
+	d.mo.Unlock()
+	if ok {
+		return
+	}
+
+	// Get options set on the conditions
+	for _, h := range hs {
+		if h.c.Queue != nil {
+			return *h.c.Queue
+		}
+	}
+	return
+}
+
+// DispatcherStats represents the state of the dispatcher queues
+type DispatcherStats struct {
+	Dropped map[string]uint64 // Number of dropped messages indexed by message name
+	Queued  map[string]int    // Number of pending messages indexed by queue key
+}
+
+// Stats returns the dispatcher stats
+func (d *Dispatcher) Stats() (s DispatcherStats) {
+	// Create stats
+	s = DispatcherStats{
+		Dropped: make(map[string]uint64),
+		Queued:  make(map[string]int),
+	}
+
+	// Add dropped
+	d.md.Lock()
+	for n, c := range d.ds {
+		s.Dropped[n] = c
+	}
+	d.md.Unlock()
+
+	// Add queued
+	d.mq.Lock()
+	for k, q := range d.qs {
+		s.Queued[k] = q.len()
+	}
+	d.mq.Unlock()
+	return
+}
+
+func (d *Dispatcher) gc() {
+	// Create ticker
+	t := time.NewTicker(dispatcherQueueIdleTimeout / 2)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case <-t.C:
+			d.gcQueues()
+		}
+	}
+}
+
+func (d *Dispatcher) gcQueues() {
 	// Lock
-	d.mh.Lock()
-	defer d.mh.Unlock()
+	d.mq.Lock()
+	defer d.mq.Unlock()
 
-	// Loop through handlers
-	var c *astikit.Chan
-	for _, h := range d.hs {
-		// No match
-		if !h.c.match(m) {
+	// Loop through queues
+	for k, q := range d.qs {
+		// Queue is still in use
+		if !q.idle(dispatcherQueueIdleTimeout) {
 			continue
 		}
 
-		// No chan
-		if c == nil {
-			// Get message key
-			k := d.key(m)
+		// Log
+		d.l.Debugf("astibob: deleting idle dispatcher queue with key %s", k)
 
-			// Lock
-			d.mc.Lock()
+		// Stop queue
+		q.stop()
 
-			// Get chan
-			var ok bool
-			if c, ok = d.cs[k]; !ok {
-				// Log
-				d.l.Debugf("astibob: creating new dispatcher chan with key %s", k)
+		// Delete queue
+		delete(d.qs, k)
+	}
+}
 
-				// Create chan
-				c = astikit.NewChan(astikit.ChanOptions{ProcessAll: true})
-				d.cs[k] = c
+func (d *Dispatcher) Dispatch(m *Message) {
+	// Record
+	d.record(JournalDirectionInbound, m)
 
-				// Start chan
-				t := d.t()
-				t.Do(func() { c.Start(d.ctx) })
+	// Get matching handlers
+	// Handlers are not locked while queueing since it may block
+	d.mh.Lock()
+	var hs []*dispatcherHandler
+	for _, h := range d.hs {
+		if h.c.match(m) {
+			hs = append(hs, h)
+		}
+	}
+	d.mh.Unlock()
+
+	// No handlers
+	if len(hs) == 0 {
+		return
+	}
+
+	// Add to queue
+	if dropped := d.queue(d.key(m)).add(&queueItem{
+		hs: hs,
+		m:  m,
+	}, d.queueOptions(m.Name, hs)); dropped > 0 {
+		// Log
+		d.l.Debugf("astibob: dropped %d %s message(s)", dropped, m.Name)
+
+		// Update dropped
+		d.md.Lock()
+		d.ds[m.Name] += uint64(dropped)
+		d.md.Unlock()
+	}
+}
+
+func (d *Dispatcher) queue(k string) (q *queue) {
+	// Lock
+	d.mq.Lock()
+	defer d.mq.Unlock()
+
+	// Get queue
+	var ok bool
+	if q, ok = d.qs[k]; !ok {
+		// Log
+		d.l.Debugf("astibob: creating new dispatcher queue with key %s", k)
+
+		// Create queue
+		q = newQueue(d.ctx)
+		d.qs[k] = q
+
+		// Start queue
+		t := d.t()
+		t.Do(func() { q.start(d.handle) })
+	}
+
+	// Make sure the queue is not garbage collected before the message is added
+	q.reserve()
+	return
+}
+
+func (d *Dispatcher) handle(i *queueItem) {
+	// Get middlewares and metrics
+	d.mm.Lock()
+	ims, mms := d.ims, d.mms
+	mt := d.mt
+	d.mm.Unlock()
+
+	// Handle message
+	if err := chainMessageMiddlewares(func(m *Message) error {
+		// Loop through handlers
+		for _, h := range i.hs {
+			// Handler has been removed in the meantime
+			if h.isOff() {
+				continue
 			}
 
-			// Unlock
-			d.mc.Unlock()
+			// Handle message
+			start := time.Now()
+			if err := chainMessageMiddlewares(h.h, ims)(m); err != nil {
+				// Rate limits wrapping handlers only drop the message for those handlers
+				if errors.Is(err, ErrRateLimitExceeded) {
+					d.l.Debugf("astibob: rate limit of message %s has been exceeded for a handler, skipping it", m.Name)
+				} else {
+					d.l.Error(fmt.Errorf("astibob: handling message failed: %w", err))
+				}
+			}
+
+			// Time handler
+			if mt != nil {
+				mt.handled.WithLabelValues(m.Name).Observe(time.Since(start).Seconds())
+			}
 		}
+		return nil
+	}, mms)(i.m); err != nil {
+		// Rate limit has been exceeded
+		if errors.Is(err, ErrRateLimitExceeded) {
+			// Log
+			d.l.Debugf("astibob: rate limit of message %s has been exceeded, dropping it", i.m.Name)
 
-		// Dispatch
-		d.dispatch(c, m, h.h)
+			// Update dropped
+			d.md.Lock()
+			d.ds[i.m.Name]++
+			d.md.Unlock()
+			return
+		}
+		d.l.Error(fmt.Errorf("astibob: handling message failed: %w", err))
 	}
 }
 
-// We don't want one dispatch to delay Cmds and Events, that's why we create specific chans for each of them. For now
+// We don't want one dispatch to delay Cmds and Events, that's why we create specific queues for each of them. For now
 // we're limiting this behavior to Cmds and Events for lack of examples of other cases.
 func (d *Dispatcher) key(m *Message) string {
 	// Message to runnable: Cmds
+	// Identifiers may only have a type, therefore names are retrieved with nil-safe accessors
 	if m.To != nil && m.To.Type == RunnableIdentifierType {
-		return fmt.Sprintf("to.runnable.%s.%s", *m.To.Worker, *m.To.Name)
+		return fmt.Sprintf("to.runnable.%s.%s", m.To.WorkerName(), m.To.RunnableName())
 	}
 
 	// Message from runnable: Events
 	if m.From.Type == RunnableIdentifierType {
-		return fmt.Sprintf("from.runnable.%s.%s", *m.From.Worker, *m.From.Name)
+		return fmt.Sprintf("from.runnable.%s.%s", m.From.WorkerName(), m.From.RunnableName())
 	}
 	return "default"
 }
 
-func (d *Dispatcher) dispatch(c *astikit.Chan, m *Message, h MessageHandler) {
-	// Add to chan
-	c.Add(func() {
-		// Handle message
-		if err := h(m); err != nil {
-			d.l.Error(fmt.Errorf("astibob: handling message failed: %w", err))
-		}
-	})
+// DispatchHandle allows removing a handler added with On
+type DispatchHandle struct {
+	d *Dispatcher
+	h *dispatcherHandler
 }
 
-func (d *Dispatcher) On(c DispatchConditions, h MessageHandler) {
-	d.mh.Lock()
-	defer d.mh.Unlock()
-	d.hs = append(d.hs, dispatcherHandler{
+// On adds a handler that is called for each message matching the conditions. Messages are handled in the order they
+// have been dispatched.
+func (d *Dispatcher) On(c DispatchConditions, h MessageHandler) *DispatchHandle {
+	// Create handler
+	dh := &dispatcherHandler{
 		c: c,
 		h: h,
-	})
+	}
+
+	// Add handler
+	d.mh.Lock()
+	d.hs = append(d.hs, dh)
+	d.mh.Unlock()
+	return &DispatchHandle{
+		d: d,
+		h: dh,
+	}
+}
+
+// Off removes the handler. Messages that have already been dispatched but not handled yet are dropped. It's safe to
+// call it several times.
+func (h *DispatchHandle) Off() {
+	// Make sure the handler is not called anymore
+	if !atomic.CompareAndSwapUint32(&h.h.off, 0, 1) {
+		return
+	}
+
+	// Lock
+	h.d.mh.Lock()
+	defer h.d.mh.Unlock()
+
+	// Remove handler
+	for idx, dh := range h.d.hs {
+		if dh == h.h {
+			h.d.hs = append(h.d.hs[:idx], h.d.hs[idx+1:]...)
+			break
+		}
+	}
+}
+
+// DispatchGroup gathers handlers that are removed together, e.g. the ones of a runnable
+type DispatchGroup struct {
+	d  *Dispatcher
+	hs []*DispatchHandle
+	m  *sync.Mutex // Locks hs
+}
+
+// NewGroup creates a new handler group
+func (d *Dispatcher) NewGroup() *DispatchGroup {
+	return &DispatchGroup{
+		d: d,
+		m: &sync.Mutex{},
+	}
+}
+
+// On adds a handler to the group
+func (g *DispatchGroup) On(c DispatchConditions, h MessageHandler) (dh *DispatchHandle) {
+	// Add handler
+	dh = g.d.On(c, h)
+
+	// Add to group
+	g.m.Lock()
+	g.hs = append(g.hs, dh)
+	g.m.Unlock()
+	return
+}
+
+// Off removes all handlers of the group. The group can still be used afterwards.
+func (g *DispatchGroup) Off() {
+	// Get handlers
+	g.m.Lock()
+	hs := g.hs
+	g.hs = nil
+	g.m.Unlock()
+
+	// Remove handlers
+	for _, h := range hs {
+		h.Off()
+	}
 }
@@ -0,0 +1,250 @@
+package astibob
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astikit"
+)
+
+func newTestDispatcher() (d *Dispatcher, w *astikit.Worker) {
+	w = astikit.NewWorker(astikit.WorkerOptions{})
+	d = NewDispatcher(w.Context(), w.NewTask, astikit.AdaptStdLogger(nil))
+	return
+}
+
+func closeTestDispatcher(d *Dispatcher, w *astikit.Worker) {
+	d.Close()
+	w.Stop()
+}
+
+// waitForDispatcher waits for the messages dispatched so far in the default queue to be handled
+func waitForDispatcher(t *testing.T, d *Dispatcher) {
+	c := make(chan bool)
+	h := d.On(DispatchConditions{Name: astikit.StrPtr("wait")}, func(m *Message) error {
+		close(c)
+		return nil
+	})
+	defer h.Off()
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "wait"))
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("dispatcher is stuck")
+	}
+}
+
+func TestDispatcherRateLimit(t *testing.T) {
+	d, w := newTestDispatcher()
+	defer closeTestDispatcher(d, w)
+
+	// Add handlers
+	m := &sync.Mutex{}
+	hs := make(map[string]int)
+	count := func(n string) MessageHandler {
+		return func(_ *Message) error {
+			m.Lock()
+			hs[n]++
+			m.Unlock()
+			return nil
+		}
+	}
+	d.On(DispatchConditions{Name: astikit.StrPtr("limited")}, count("h1"))
+	d.On(DispatchConditions{Name: astikit.StrPtr("limited")}, count("h2"))
+	d.On(DispatchConditions{Name: astikit.StrPtr("unlimited")}, count("unlimited"))
+
+	// Rate limits can also wrap a specific handler
+	// Buckets are not refilled
+	d.On(DispatchConditions{Name: astikit.StrPtr("unlimited")}, MessageMiddlewareRateLimit(map[string]RateLimit{"unlimited": {Burst: 1}})(count("handler")))
+
+	// Rate limit messages
+	d.UseMessage(MessageMiddlewareRateLimit(map[string]RateLimit{"limit*": {Burst: 2}}))
+
+	// Dispatch
+	for idx := 0; idx < 5; idx++ {
+		d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "limited"))
+		d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "unlimited"))
+	}
+	waitForDispatcher(t, d)
+
+	// Each message takes one token whatever the number of its handlers
+	m.Lock()
+	defer m.Unlock()
+	if e := map[string]int{"h1": 2, "h2": 2, "handler": 1, "unlimited": 5}; !reflect.DeepEqual(hs, e) {
+		t.Fatalf("expected %+v, got %+v", e, hs)
+	}
+
+	// Only messages dropped for all their handlers are counted
+	if s := d.Stats(); s.Dropped["limited"] != 3 || s.Dropped["unlimited"] != 0 {
+		t.Fatalf("expected 3 dropped limited messages, got %+v", s.Dropped)
+	}
+}
+
+func TestRateLimitBucket(t *testing.T) {
+	b := newRateLimitBucket(RateLimit{Rate: 100})
+	if !b.take() {
+		t.Fatal("burst should default to 1")
+	}
+	if b.take() {
+		t.Fatal("bucket should be empty")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !b.take() {
+		t.Fatal("bucket should have been refilled")
+	}
+}
+
+func TestDispatcherKey(t *testing.T) {
+	d, w := newTestDispatcher()
+	defer closeTestDispatcher(d, w)
+	for _, v := range []struct {
+		expected string
+		m        *Message
+	}{
+		{expected: "to.runnable.w.r", m: &Message{To: NewRunnableIdentifier("r", "w")}},
+		{expected: "to.runnable..", m: &Message{To: &Identifier{Type: RunnableIdentifierType}}},
+		{expected: "from.runnable.w.r", m: &Message{From: *NewRunnableIdentifier("r", "w")}},
+		{expected: "from.runnable..", m: &Message{From: Identifier{Type: RunnableIdentifierType}}},
+		{expected: "default", m: &Message{From: *NewIndexIdentifier(), To: &Identifier{Type: UIIdentifierType}}},
+	} {
+		if k := d.key(v.m); k != v.expected {
+			t.Errorf("expected %s, got %s", v.expected, k)
+		}
+	}
+
+	// Messages to type-only identifiers are handled
+	c := make(chan bool, 1)
+	d.On(DispatchConditions{Name: astikit.StrPtr("broadcast")}, func(m *Message) error {
+		c <- true
+		return nil
+	})
+	d.Dispatch(newMessage(Identifier{Type: RunnableIdentifierType}, &Identifier{Type: RunnableIdentifierType}, "broadcast"))
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("message hasn't been handled")
+	}
+}
+
+func TestDispatcherOff(t *testing.T) {
+	d, w := newTestDispatcher()
+	defer closeTestDispatcher(d, w)
+
+	// Add handlers
+	m := &sync.Mutex{}
+	var ns []string
+	on := func(on func(c DispatchConditions, h MessageHandler) *DispatchHandle, name string) *DispatchHandle {
+		return on(DispatchConditions{Name: astikit.StrPtr("test")}, func(*Message) error {
+			m.Lock()
+			defer m.Unlock()
+			ns = append(ns, name)
+			return nil
+		})
+	}
+	h1 := on(d.On, "h1")
+	on(d.On, "h2")
+	g := d.NewGroup()
+	on(g.On, "g1")
+	on(g.On, "g2")
+	dispatch := func(expected []string) {
+		t.Helper()
+		m.Lock()
+		ns = []string{}
+		m.Unlock()
+		d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "test"))
+		waitForDispatcher(t, d)
+		m.Lock()
+		defer m.Unlock()
+		if !reflect.DeepEqual(expected, ns) {
+			t.Fatalf("expected %+v, got %+v", expected, ns)
+		}
+	}
+	dispatch([]string{"h1", "h2", "g1", "g2"})
+
+	// Remove handler
+	h1.Off()
+	h1.Off()
+	dispatch([]string{"h2", "g1", "g2"})
+
+	// Remove group
+	g.Off()
+	dispatch([]string{"h2"})
+
+	// Group can still be used
+	on(g.On, "g3")
+	dispatch([]string{"h2", "g3"})
+
+	// Removed handlers have been cleaned up
+	d.mh.Lock()
+	l := len(d.hs)
+	d.mh.Unlock()
+	if l != 2 {
+		t.Fatalf("expected 2 handlers, got %d", l)
+	}
+}
+
+func TestDispatcherOffPending(t *testing.T) {
+	d, w := newTestDispatcher()
+	defer closeTestDispatcher(d, w)
+
+	// Block the queue
+	block := make(chan bool)
+	d.On(DispatchConditions{Name: astikit.StrPtr("block")}, func(*Message) error {
+		<-block
+		return nil
+	})
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "block"))
+
+	// Messages dispatched before the handler is removed are dropped
+	var called bool
+	h := d.On(DispatchConditions{Name: astikit.StrPtr("test")}, func(*Message) error {
+		called = true
+		return nil
+	})
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "test"))
+	h.Off()
+	close(block)
+	waitForDispatcher(t, d)
+	if called {
+		t.Fatal("removed handler shouldn't be called")
+	}
+}
+
+func TestDispatcherGCQueues(t *testing.T) {
+	d, w := newTestDispatcher()
+	defer closeTestDispatcher(d, w)
+
+	// Dispatch to a runnable
+	c := make(chan bool, 1)
+	d.On(DispatchConditions{Name: astikit.StrPtr("test")}, func(*Message) error {
+		c <- true
+		return nil
+	})
+	d.Dispatch(newMessage(*NewIndexIdentifier(), NewRunnableIdentifier("r", "w"), "test"))
+	select {
+	case <-c:
+	case <-time.After(time.Second):
+		t.Fatal("message hasn't been handled")
+	}
+
+	// Queue is still in use
+	const k = "to.runnable.w.r"
+	d.gcQueues()
+	if _, ok := d.Stats().Queued[k]; !ok {
+		t.Fatal("queue shouldn't be deleted")
+	}
+
+	// Queue is idle
+	d.mq.Lock()
+	q := d.qs[k]
+	d.mq.Unlock()
+	q.m.Lock()
+	q.lastUsed = time.Now().Add(-dispatcherQueueIdleTimeout)
+	q.m.Unlock()
+	d.gcQueues()
+	if _, ok := d.Stats().Queued[k]; ok {
+		t.Fatal("idle queue should be deleted")
+	}
+}
@@ -7,10 +7,12 @@ require (
 	github.com/asticode/go-astideepspeech v0.6.2
 	github.com/asticode/go-astikit v0.2.0
 	github.com/asticode/go-astiws v1.2.0
+	github.com/fxamacker/cbor/v2 v2.5.0
 	github.com/go-audio/audio v1.0.0
 	github.com/go-audio/wav v1.0.0
 	github.com/go-ole/go-ole v1.2.4
 	github.com/gordonklaus/portaudio v0.0.0-20180817120803-00e7307ccd93
 	github.com/gorilla/websocket v1.4.1
 	github.com/julienschmidt/httprouter v1.3.0
+	github.com/prometheus/client_golang v1.2.1
 )
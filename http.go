@@ -1,6 +1,7 @@
 package astibob
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"mime"
@@ -51,3 +52,57 @@ func DirHandle(path string) httprouter.Handle {
 		http.FileServer(http.Dir(path)).ServeHTTP(w, req)
 	}
 }
+
+// ServeHTTP spawns an HTTP server that uses TLS when the options require it
+func ServeHTTP(w *astikit.Worker, o ServerOptions, h http.Handler) {
+	// Create server
+	s := &http.Server{Addr: o.Addr, Handler: h}
+
+	// Get TLS config
+	var err error
+	if s.TLSConfig, err = o.ServerTLSConfig(); err != nil {
+		w.Logger().Error(fmt.Errorf("astibob: getting server tls config failed: %w", err))
+		return
+	}
+
+	// Execute in a task
+	w.NewTask().Do(func() {
+		// Log
+		w.Logger().Infof("astibob: serving on %s://%s", o.HTTPScheme(), o.Addr)
+
+		// Serve
+		var done = make(chan error)
+		go func() {
+			var err error
+			if o.Listener != nil {
+				if s.TLSConfig != nil {
+					err = s.ServeTLS(o.Listener, "", "")
+				} else {
+					err = s.Serve(o.Listener)
+				}
+			} else if s.TLSConfig != nil {
+				err = s.ListenAndServeTLS("", "")
+			} else {
+				err = s.ListenAndServe()
+			}
+			if err != nil {
+				done <- err
+			}
+		}()
+
+		// Wait for context or done to be done
+		select {
+		case <-w.Context().Done():
+		case err := <-done:
+			if err != nil && err != http.ErrServerClosed {
+				w.Logger().Error(fmt.Errorf("astibob: serving failed: %w", err))
+			}
+		}
+
+		// Shutdown
+		w.Logger().Infof("astibob: shutting down server on %s", o.Addr)
+		if err := s.Shutdown(context.Background()); err != nil {
+			w.Logger().Error(fmt.Errorf("astibob: shutting down server on %s failed: %w", o.Addr, err))
+		}
+	})
+}
@@ -0,0 +1,328 @@
+package index
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+// Roles from the least to the most privileged. Each role is granted what less privileged roles are granted.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleTrainer  = "trainer"
+	RoleAdmin    = "admin"
+)
+
+var roleLevels = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleTrainer:  3,
+	RoleAdmin:    4,
+}
+
+type AccessOptions struct {
+	// Evaluated before default rules. The first matching rule wins.
+	Rules []AccessRule `toml:"rules"`
+	// Defaults to 24h
+	SessionTTL time.Duration `toml:"session_ttl"`
+	// Persists worker tokens. Empty means tokens are lost when the index restarts.
+	TokensPath string `toml:"tokens_path"`
+	// When there are no users and no server credentials, everybody is an admin
+	Users []User `toml:"users"`
+}
+
+type User struct {
+	Password string `toml:"password"`
+	Role     string `toml:"role"`
+	Username string `toml:"username"`
+}
+
+// AccessRule grants access to users having at least a role. It either applies to requests or to messages sent by UIs
+// through their websocket.
+type AccessRule struct {
+	Message string `toml:"message"` // Message name pattern (e.g. "runnable.*")
+	Method  string `toml:"method"`  // Empty means any method
+	Path    string `toml:"path"`    // Request path pattern (e.g. "/workers/*/runnables/*/routes/*")
+	Role    string `toml:"role"`
+}
+
+func (r AccessRule) matchRequest(method, path string) bool {
+	return r.Path != "" && (r.Method == "" || r.Method == method) && astibob.WildcardMatch(r.Path, path)
+}
+
+func (r AccessRule) matchMessage(name string) bool {
+	return r.Message != "" && astibob.WildcardMatch(r.Message, name)
+}
+
+// Paths that can be accessed without being logged in
+var publicPaths = []string{
+	"/api/login",
+	"/api/ok",
+	"/logout",
+	"/static/*",
+	"/web/login",
+}
+
+var defaultAccessRules = []AccessRule{
+	// Workers
+	{Path: "/websockets/worker", Role: RoleAdmin},
+	// Audit
+	{Path: "/api/audit", Role: RoleAdmin},
+	{Path: "/web/audit", Role: RoleAdmin},
+	// Tokens
+	{Path: "/api/tokens*", Role: RoleAdmin},
+	{Path: "/web/tokens", Role: RoleAdmin},
+	// Inspector
+	{Path: "/web/inspector", Role: RoleOperator},
+	{Path: "/websockets/inspector", Role: RoleOperator},
+	// Runnables
+	{Method: http.MethodPost, Path: "/api/workers/*/runnables/*/start", Role: RoleOperator},
+	{Method: http.MethodPost, Path: "/api/workers/*/runnables/*/stop", Role: RoleOperator},
+	{Method: http.MethodPost, Path: "/api/messages", Role: RoleOperator},
+	{Method: http.MethodPatch, Path: "/workers/*/runnables/*/config", Role: RoleOperator},
+	// Training is triggered with GET requests
+	{Path: "/workers/*/runnables/*/routes/train*", Role: RoleTrainer},
+	// Runnable routes may have side effects even with GET requests (e.g. calibrating), except for static files
+	{Method: http.MethodGet, Path: "/workers/*/runnables/*/routes/static/*", Role: RoleViewer},
+	{Method: http.MethodGet, Path: "/workers/*/runnables/*/routes/*", Role: RoleOperator},
+	// Reading
+	{Method: http.MethodGet, Path: "*", Role: RoleViewer},
+	// Runnable routes updating data (e.g. deleting speeches)
+	{Path: "/workers/*/runnables/*/routes/*", Role: RoleTrainer},
+	// UI messages
+	{Message: astibob.UIPingMessage, Role: RoleViewer},
+	{Message: astibob.UIRegisterMessage, Role: RoleViewer},
+	{Message: astibob.RunnableConfigUpdateMessage, Role: RoleOperator},
+	{Message: astibob.RunnableStartMessage, Role: RoleOperator},
+	{Message: astibob.RunnableStopMessage, Role: RoleOperator},
+	// Everything else
+	{Message: "*", Role: RoleAdmin},
+	{Path: "*", Role: RoleAdmin},
+}
+
+// Message names of the protocol between the index, workers and UIs. They can't be sent through the REST API since
+// workers trust them when they come from the index.
+var internalMessageNames = []string{
+	"inspector.*",
+	"listenables.*",
+	"ui.*",
+	"worker.*",
+}
+
+// Names of messages UIs send to control runnables
+var indexCommandNames = map[string]bool{
+	astibob.RunnableConfigUpdateMessage: true,
+	astibob.RunnableStartMessage:        true,
+	astibob.RunnableStopMessage:         true,
+}
+
+func isInternalMessage(name string) bool {
+	for _, p := range internalMessageNames {
+		if astibob.WildcardMatch(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	tokenContextKey
+	auditContextKey
+)
+
+// UserFromContext returns the user who has sent the request
+func UserFromContext(ctx context.Context) (u User, ok bool) {
+	u, ok = ctx.Value(userContextKey).(User)
+	return
+}
+
+func checkAccessOptions(o AccessOptions) (err error) {
+	// Loop through users
+	for _, u := range o.Users {
+		if u.Username == "" {
+			err = errors.New("index: user has no username")
+			return
+		}
+		if _, ok := roleLevels[u.Role]; !ok {
+			err = fmt.Errorf("index: invalid role %s for user %s", u.Role, u.Username)
+			return
+		}
+	}
+
+	// Loop through rules
+	for _, r := range o.Rules {
+		if _, ok := roleLevels[r.Role]; !ok {
+			err = fmt.Errorf("index: invalid role %s for rule %+v", r.Role, r)
+			return
+		}
+	}
+	return
+}
+
+// accessEnabled checks whether users need to log in
+func (i *Index) accessEnabled() bool {
+	return len(i.o.Access.Users) > 0 || (i.o.Server.Username != "" && i.o.Server.Password != "")
+}
+
+// checkCredentials returns the user matching the credentials. Server credentials are those of an admin.
+func (i *Index) checkCredentials(username, password string) (u User, ok bool) {
+	// Server credentials
+	if i.o.Server.Username != "" && i.o.Server.Password != "" && secureEqual(username, i.o.Server.Username) &&
+		secureEqual(password, i.o.Server.Password) {
+		return User{Role: RoleAdmin, Username: username}, true
+	}
+
+	// Loop through users
+	for _, cu := range i.o.Access.Users {
+		if secureEqual(username, cu.Username) && secureEqual(password, cu.Password) {
+			cu.Password = ""
+			return cu, true
+		}
+	}
+	return
+}
+
+func secureEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// authenticate returns the user who has sent the request either through basic auth or through a session
+func (i *Index) authenticate(r *http.Request) (u User, ok bool) {
+	// Access is disabled
+	if !i.accessEnabled() {
+		return User{Role: RoleAdmin}, true
+	}
+
+	// Basic auth
+	if username, password, bok := r.BasicAuth(); bok {
+		return i.checkCredentials(username, password)
+	}
+
+	// Session
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		return i.sessionUser(c.Value)
+	}
+	return
+}
+
+func (i *Index) allowedRole(fn func(r AccessRule) bool) string {
+	// Loop through rules
+	for _, rs := range [][]AccessRule{i.o.Access.Rules, defaultAccessRules} {
+		for _, r := range rs {
+			if fn(r) {
+				return r.Role
+			}
+		}
+	}
+	return RoleAdmin
+}
+
+func hasRole(u User, role string) bool {
+	return roleLevels[u.Role] >= roleLevels[role]
+}
+
+func (i *Index) requestRole(r *http.Request) string {
+	return i.allowedRole(func(ar AccessRule) bool { return ar.matchRequest(r.Method, r.URL.Path) })
+}
+
+func (i *Index) messageRole(name string) string {
+	return i.allowedRole(func(ar AccessRule) bool { return ar.matchMessage(name) })
+}
+
+func isPublicPath(path string) bool {
+	for _, p := range publicPaths {
+		if astibob.WildcardMatch(p, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func isWebPath(path string) bool {
+	return path == "/" || strings.Contains(path, "/web/")
+}
+
+// authorize makes sure users are allowed to access what they request
+func (i *Index) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		// Public path
+		if isPublicPath(r.URL.Path) {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		// Workers authenticate with their token
+		if v, ok := bearerToken(r); ok {
+			// Check token
+			t, ok := i.ts.check(v)
+			if !ok {
+				astibob.WriteHTTPError(i.l, rw, http.StatusUnauthorized, errors.New("index: invalid token"))
+				return
+			}
+
+			// Tokens only grant access to the worker websocket
+			if r.URL.Path != "/websockets/worker" {
+				astibob.WriteHTTPError(i.l, rw, http.StatusForbidden, fmt.Errorf("index: %s %s is forbidden for tokens", r.Method, r.URL.Path))
+				return
+			}
+
+			// Serve
+			h.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), tokenContextKey, t)))
+			return
+		}
+
+		// Authenticate
+		u, ok := i.authenticate(r)
+		if !ok {
+			// Users browsing the web interface are sent to the login page
+			if r.Method == http.MethodGet && isWebPath(r.URL.Path) {
+				http.Redirect(rw, r, "/web/login?redirect="+url.QueryEscape(r.URL.RequestURI()), http.StatusFound)
+				return
+			}
+			astibob.WriteHTTPError(i.l, rw, http.StatusUnauthorized, errors.New("index: unauthorized"))
+			return
+		}
+
+		// Authorize
+		role := i.requestRole(r)
+		audited := auditedRequest(r, role)
+		if !hasRole(u, role) {
+			if audited {
+				i.audit(requestAuditEntry(r, u, http.StatusForbidden))
+			}
+			astibob.WriteHTTPError(i.l, rw, http.StatusForbidden, fmt.Errorf("index: %s %s is forbidden for %s", r.Method, r.URL.Path, u.Role))
+			return
+		}
+
+		// Add user to context
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, u))
+
+		// Not audited
+		if !audited {
+			h.ServeHTTP(rw, r)
+			return
+		}
+
+		// Serve and audit
+		srw := &statusResponseWriter{
+			ResponseWriter: rw,
+			code:           http.StatusOK,
+		}
+		d := &AuditEntry{}
+		h.ServeHTTP(srw, r.WithContext(context.WithValue(r.Context(), auditContextKey, d)))
+		e := requestAuditEntry(r, u, srw.code)
+		e.complete(*d)
+		i.audit(e)
+	})
+}
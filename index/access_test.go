@@ -0,0 +1,71 @@
+package index
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestRequestRole(t *testing.T) {
+	i := newTestIndex(t, Options{Access: AccessOptions{Rules: []AccessRule{
+		{Method: http.MethodGet, Path: "/workers/*/runnables/*/routes/speeches*", Role: RoleViewer},
+	}}})
+	defer closeTestIndex(i)
+	for _, v := range []struct {
+		method string
+		path   string
+		role   string
+	}{
+		{method: http.MethodGet, path: "/", role: RoleViewer},
+		{method: http.MethodGet, path: "/api/workers", role: RoleViewer},
+		{method: http.MethodGet, path: "/api/audit", role: RoleAdmin},
+		{method: http.MethodPost, path: "/api/tokens", role: RoleAdmin},
+		{method: http.MethodGet, path: "/websockets/worker", role: RoleAdmin},
+		{method: http.MethodGet, path: "/web/inspector", role: RoleOperator},
+		{method: http.MethodPost, path: "/api/workers/w/runnables/r/start", role: RoleOperator},
+		{method: http.MethodPost, path: "/api/messages", role: RoleOperator},
+		{method: http.MethodGet, path: "/workers/w/runnables/r/config", role: RoleViewer},
+		{method: http.MethodPatch, path: "/workers/w/runnables/r/config", role: RoleOperator},
+		{method: http.MethodGet, path: "/workers/w/runnables/r/web/index", role: RoleViewer},
+		{method: http.MethodGet, path: "/workers/w/runnables/r/routes/static/index.js", role: RoleViewer},
+		{method: http.MethodGet, path: "/workers/w/runnables/r/routes/calibrate", role: RoleOperator},
+		{method: http.MethodGet, path: "/workers/w/runnables/r/routes/train", role: RoleTrainer},
+		{method: http.MethodDelete, path: "/workers/w/runnables/r/routes/speeches/1", role: RoleTrainer},
+		// Custom rules are evaluated first
+		{method: http.MethodGet, path: "/workers/w/runnables/r/routes/speeches/1.wav", role: RoleViewer},
+	} {
+		if role := i.requestRole(httptest.NewRequest(v.method, v.path, nil)); role != v.role {
+			t.Errorf("%s %s: expected %s, got %s", v.method, v.path, v.role, role)
+		}
+	}
+}
+
+func TestMessageRole(t *testing.T) {
+	i := newTestIndex(t, Options{})
+	defer closeTestIndex(i)
+	for n, role := range map[string]string{
+		astibob.UIPingMessage:               RoleViewer,
+		astibob.UIRegisterMessage:           RoleViewer,
+		astibob.RunnableStartMessage:        RoleOperator,
+		astibob.RunnableConfigUpdateMessage: RoleOperator,
+		"text_to_speech.say":                RoleAdmin,
+	} {
+		if r := i.messageRole(n); r != role {
+			t.Errorf("%s: expected %s, got %s", n, role, r)
+		}
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	if !hasRole(User{Role: RoleAdmin}, RoleTrainer) {
+		t.Error("admins should be granted the trainer role")
+	}
+	if hasRole(User{Role: RoleOperator}, RoleTrainer) {
+		t.Error("operators shouldn't be granted the trainer role")
+	}
+	if hasRole(User{Role: "unknown"}, RoleViewer) {
+		t.Error("unknown roles shouldn't be granted anything")
+	}
+}
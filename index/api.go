@@ -0,0 +1,255 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/asticode/go-astibob"
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIMessage is sent to a worker or one of its runnables through the API
+type APIMessage struct {
+	Name     string          `json:"name"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Runnable string          `json:"runnable,omitempty"` // Empty means the message is sent to the worker
+	Worker   string          `json:"worker"`
+}
+
+// APIListenable represents the messages a worker listens to
+type APIListenable struct {
+	astibob.ListenableSubscription
+	Listener string `json:"listener"` // Name of the listening worker
+}
+
+func (i *Index) apiWorker(rw http.ResponseWriter, p httprouter.Params) (w *worker, ok bool) {
+	// Unescape worker
+	name, err := url.QueryUnescape(p.ByName("worker"))
+	if err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: unescaping worker failed: %w", err))
+		return
+	}
+
+	// Get worker
+	i.mw.Lock()
+	w, ok = i.ws[name]
+	i.mw.Unlock()
+
+	// No worker
+	if !ok {
+		astibob.WriteHTTPError(i.l, rw, http.StatusNotFound, fmt.Errorf("index: no %s worker", name))
+		return
+	}
+	return
+}
+
+func (i *Index) apiRunnable(rw http.ResponseWriter, p httprouter.Params) (w *worker, r astibob.RunnableMessage, ok bool) {
+	// Get worker
+	if w, ok = i.apiWorker(rw, p); !ok {
+		return
+	}
+
+	// Unescape runnable
+	name, err := url.QueryUnescape(p.ByName("runnable"))
+	if err != nil {
+		ok = false
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: unescaping runnable failed: %w", err))
+		return
+	}
+
+	// Get runnable
+	w.mr.Lock()
+	r, ok = w.rs[name]
+	w.mr.Unlock()
+
+	// No runnable
+	if !ok {
+		astibob.WriteHTTPError(i.l, rw, http.StatusNotFound, fmt.Errorf("index: no %s runnable on worker %s", name, w.name))
+		return
+	}
+	return
+}
+
+func (i *Index) apiWorkers(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Get workers
+	ws := i.workers("")
+	if ws == nil {
+		ws = []astibob.Worker{}
+	}
+
+	// Write
+	astibob.WriteHTTPData(i.l, rw, ws)
+}
+
+func (i *Index) apiGetWorker(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Get worker
+	w, ok := i.apiWorker(rw, p)
+	if !ok {
+		return
+	}
+
+	// Write
+	astibob.WriteHTTPData(i.l, rw, w.toMessage())
+}
+
+func (i *Index) apiGetRunnable(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Get runnable
+	w, rm, ok := i.apiRunnable(rw, p)
+	if !ok {
+		return
+	}
+
+	// Loop through runnables
+	// Uptimes are computed when creating the worker message
+	for _, r := range w.toMessage().Runnables {
+		if r.Name == rm.Name {
+			astibob.WriteHTTPData(i.l, rw, r)
+			return
+		}
+	}
+	astibob.WriteHTTPError(i.l, rw, http.StatusNotFound, errors.New("index: runnable has disappeared"))
+}
+
+func (i *Index) apiStartRunnable(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	i.apiToggleRunnable(rw, p, true)
+}
+
+func (i *Index) apiStopRunnable(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	i.apiToggleRunnable(rw, p, false)
+}
+
+func (i *Index) apiToggleRunnable(rw http.ResponseWriter, p httprouter.Params, start bool) {
+	// Get runnable
+	w, rm, ok := i.apiRunnable(rw, p)
+	if !ok {
+		return
+	}
+
+	// Check status
+	name := astibob.RunnableStopMessage
+	if start {
+		if !astibob.IsStoppedStatus(rm.Status) {
+			astibob.WriteHTTPError(i.l, rw, http.StatusConflict, fmt.Errorf("index: runnable %s is %s", rm.Name, rm.Status))
+			return
+		}
+		name = astibob.RunnableStartMessage
+	} else if rm.Status != astibob.RunningStatus && rm.Status != astibob.StartingStatus {
+		astibob.WriteHTTPError(i.l, rw, http.StatusConflict, fmt.Errorf("index: runnable %s is %s", rm.Name, rm.Status))
+		return
+	}
+
+	// Marshal payload
+	b, err := json.Marshal(rm.Name)
+	if err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusInternalServerError, fmt.Errorf("index: marshaling payload failed: %w", err))
+		return
+	}
+
+	// Send message
+	i.sendAPIMessage(APIMessage{
+		Name:    name,
+		Payload: b,
+		Worker:  w.name,
+	})
+
+	// Status will be updated once the worker has processed the message
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+func (i *Index) apiSendMessage(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Parse body
+	var m APIMessage
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: parsing message failed: %w", err))
+		return
+	}
+
+	// Invalid message
+	if m.Name == "" {
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, errors.New("index: message has no name"))
+		return
+	}
+
+	// Audit the message rather than the route
+	if d, ok := auditDetailsFromContext(r.Context()); ok {
+		d.Action = m.Name
+		d.Runnable = m.Runnable
+		d.Worker = m.Worker
+	}
+
+	// Internal message
+	if isInternalMessage(m.Name) {
+		astibob.WriteHTTPError(i.l, rw, http.StatusForbidden, fmt.Errorf("index: %s is an internal message", m.Name))
+		return
+	}
+
+	// Check access
+	// Messages are subject to the same rules as those sent by UIs
+	if u, ok := UserFromContext(r.Context()); !ok || !hasRole(u, i.messageRole(m.Name)) {
+		astibob.WriteHTTPError(i.l, rw, http.StatusForbidden, fmt.Errorf("index: %s message is forbidden for %s", m.Name, u.Role))
+		return
+	}
+
+	// Get worker
+	i.mw.Lock()
+	w, ok := i.ws[m.Worker]
+	i.mw.Unlock()
+
+	// No worker
+	if !ok {
+		astibob.WriteHTTPError(i.l, rw, http.StatusNotFound, fmt.Errorf("index: no %s worker", m.Worker))
+		return
+	}
+
+	// No runnable
+	if m.Runnable != "" {
+		w.mr.Lock()
+		_, ok = w.rs[m.Runnable]
+		w.mr.Unlock()
+		if !ok {
+			astibob.WriteHTTPError(i.l, rw, http.StatusNotFound, fmt.Errorf("index: no %s runnable on worker %s", m.Runnable, m.Worker))
+			return
+		}
+	}
+
+	// Send message
+	i.sendAPIMessage(m)
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+func (i *Index) sendAPIMessage(am APIMessage) {
+	// Create message
+	m := astibob.NewMessage()
+	m.From = *astibob.NewIndexIdentifier()
+	m.Name = am.Name
+	m.Payload = am.Payload
+
+	// Add to
+	if am.Runnable != "" {
+		m.To = astibob.NewRunnableIdentifier(am.Runnable, am.Worker)
+	} else {
+		m.To = astibob.NewWorkerIdentifier(am.Worker)
+	}
+
+	// Dispatch
+	i.d.Dispatch(m)
+}
+
+func (i *Index) apiListenables(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Loop through workers
+	ls := []APIListenable{}
+	for _, w := range i.workers("") {
+		for _, l := range w.Listenables {
+			ls = append(ls, APIListenable{
+				ListenableSubscription: l,
+				Listener:               w.Name,
+			})
+		}
+	}
+
+	// Write
+	astibob.WriteHTTPData(i.l, rw, ls)
+}
@@ -0,0 +1,49 @@
+package index
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestIndex(t *testing.T, o Options) *Index {
+	i, err := New(o, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func closeTestIndex(i *Index) {
+	i.Stop()
+	i.Close()
+	i.Wait()
+}
+
+func TestAPISendMessage(t *testing.T) {
+	i := newTestIndex(t, Options{})
+	defer closeTestIndex(i)
+	for _, v := range []struct {
+		body   string
+		role   string
+		status int
+	}{
+		{body: `{"name":"worker.registered","worker":"w"}`, role: RoleAdmin, status: http.StatusForbidden},
+		{body: `{"name":"ui.welcome","worker":"w"}`, role: RoleAdmin, status: http.StatusForbidden},
+		{body: `{"name":"text_to_speech.say","worker":"w"}`, role: RoleOperator, status: http.StatusForbidden},
+		{body: `{"name":"runnable.start","worker":"w"}`, role: RoleViewer, status: http.StatusForbidden},
+		// Allowed messages reach the worker lookup
+		{body: `{"name":"runnable.start","worker":"w"}`, role: RoleOperator, status: http.StatusNotFound},
+		{body: `{"name":"text_to_speech.say","worker":"w"}`, role: RoleAdmin, status: http.StatusNotFound},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(v.body))
+		r = r.WithContext(context.WithValue(r.Context(), userContextKey, User{Role: v.role}))
+		rw := httptest.NewRecorder()
+		i.apiSendMessage(rw, r, nil)
+		if rw.Code != v.status {
+			t.Errorf("%s as %s: expected %d, got %d", v.body, v.role, v.status, rw.Code)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package index
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Audit sources
+const (
+	AuditSourceAPI   = "api"   // REST API
+	AuditSourceRoute = "route" // Runnable routes and configs proxied by the index
+	AuditSourceUI    = "ui"    // Messages sent by UIs through their websocket
+)
+
+// Audit outcomes
+const (
+	AuditOutcomeDispatched = "dispatched" // The message has been sent but whether it has succeeded is not known
+	AuditOutcomeFailure    = "failure"
+	AuditOutcomeSuccess    = "success"
+)
+
+const auditActionLogin = "login"
+
+// Number of latest entries kept in memory. Older entries are only available when the audit log is persisted.
+const auditMaxEntries = 1000
+
+// AuditEntry records an action performed by a user
+type AuditEntry struct {
+	Action   string    `json:"action"` // E.g. "runnable.start" or "DELETE /speeches/1.wav"
+	At       time.Time `json:"at"`
+	Outcome  string    `json:"outcome"`
+	Role     string    `json:"role"`
+	Runnable string    `json:"runnable,omitempty"`
+	Source   string    `json:"source"`
+	Status   int       `json:"status,omitempty"` // HTTP status code
+	User     string    `json:"user"`             // Empty when users don't need to log in
+	Worker   string    `json:"worker,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero values match everything.
+type AuditFilter struct {
+	Action   string // May contain wildcards (e.g. "runnable.*")
+	Limit    int    // Defaults to 100
+	Runnable string
+	Since    time.Time
+	Until    time.Time
+	User     string
+	Worker   string
+}
+
+func (f AuditFilter) match(e AuditEntry) bool {
+	return (f.Action == "" || astibob.WildcardMatch(f.Action, e.Action)) &&
+		(f.Runnable == "" || f.Runnable == e.Runnable) &&
+		(f.Since.IsZero() || !e.At.Before(f.Since)) &&
+		(f.Until.IsZero() || e.At.Before(f.Until)) &&
+		(f.User == "" || f.User == e.User) &&
+		(f.Worker == "" || f.Worker == e.Worker)
+}
+
+// auditLog keeps the latest entries in memory so that most queries don't need to read the file. When a path is
+// provided, entries are appended to it as well and they survive restarts.
+type auditLog struct {
+	es    []AuditEntry
+	f     *os.File
+	m     *sync.Mutex // Locks es, f and older
+	older bool        // Whether the file holds entries older than those kept in memory
+	path  string
+}
+
+func newAuditLog(path string) (a *auditLog, err error) {
+	// Create audit log
+	a = &auditLog{
+		m:    &sync.Mutex{},
+		path: path,
+	}
+
+	// Not persisted
+	if path == "" {
+		return
+	}
+
+	// Load latest entries
+	if err = readAuditEntries(path, func(e AuditEntry) { a.append(e) }); err != nil && !errors.Is(err, os.ErrNotExist) {
+		err = fmt.Errorf("index: reading audit entries failed: %w", err)
+		return
+	}
+
+	// Open
+	if a.f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		err = fmt.Errorf("index: opening %s failed: %w", path, err)
+		return
+	}
+	return
+}
+
+func (a *auditLog) close() error {
+	a.m.Lock()
+	defer a.m.Unlock()
+	if a.f != nil {
+		return a.f.Close()
+	}
+	return nil
+}
+
+// append adds an entry in memory and drops the oldest ones. Assumes the lock is held.
+func (a *auditLog) append(e AuditEntry) {
+	a.es = append(a.es, e)
+	if len(a.es) > auditMaxEntries {
+		a.es = a.es[len(a.es)-auditMaxEntries:]
+		a.older = a.path != ""
+	}
+}
+
+func (a *auditLog) add(e AuditEntry) (err error) {
+	// Lock
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	// Persist
+	if a.f != nil {
+		// Marshal
+		var b []byte
+		if b, err = json.Marshal(e); err != nil {
+			err = fmt.Errorf("index: marshaling failed: %w", err)
+			return
+		}
+
+		// Write
+		if _, err = a.f.Write(append(b, '\n')); err != nil {
+			err = fmt.Errorf("index: writing failed: %w", err)
+			return
+		}
+	}
+
+	// Append
+	a.append(e)
+	return
+}
+
+// query returns entries matching the filter, newest first. The file is only read when entries kept in memory are
+// not enough to fill the limit and older entries may match.
+func (a *auditLog) query(f AuditFilter) (es []AuditEntry, err error) {
+	// Default limit
+	if f.Limit <= 0 {
+		f.Limit = 100
+	}
+
+	// Get entries kept in memory
+	a.m.Lock()
+	all := append([]AuditEntry{}, a.es...)
+	older := a.older
+	a.m.Unlock()
+
+	// Filter
+	es = filterAuditEntries(all, f)
+
+	// Entries kept in memory are enough
+	if !older || len(es) >= f.Limit || (len(all) > 0 && !f.Since.IsZero() && all[0].At.Before(f.Since)) {
+		return
+	}
+
+	// Read all entries
+	all = []AuditEntry{}
+	if err = readAuditEntries(a.path, func(e AuditEntry) { all = append(all, e) }); err != nil {
+		err = fmt.Errorf("index: reading audit entries failed: %w", err)
+		return
+	}
+
+	// Filter
+	es = filterAuditEntries(all, f)
+	return
+}
+
+// filterAuditEntries returns entries matching the filter, newest first
+func filterAuditEntries(all []AuditEntry, f AuditFilter) (es []AuditEntry) {
+	es = []AuditEntry{}
+	for idx := len(all) - 1; idx >= 0 && len(es) < f.Limit; idx-- {
+		if f.match(all[idx]) {
+			es = append(es, all[idx])
+		}
+	}
+	return
+}
+
+func readAuditEntries(path string, fn func(e AuditEntry)) (err error) {
+	// Open
+	var f *os.File
+	if f, err = os.Open(path); err != nil {
+		err = fmt.Errorf("index: opening %s failed: %w", path, err)
+		return
+	}
+	defer f.Close()
+
+	// Loop through lines
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		// Unmarshal
+		var e AuditEntry
+		if err = json.Unmarshal(s.Bytes(), &e); err != nil {
+			err = fmt.Errorf("index: unmarshaling %s failed: %w", s.Bytes(), err)
+			return
+		}
+
+		// Custom
+		fn(e)
+	}
+
+	// Check error
+	if err = s.Err(); err != nil {
+		err = fmt.Errorf("index: scanning %s failed: %w", path, err)
+		return
+	}
+	return
+}
+
+func (i *Index) audit(e AuditEntry) {
+	// Default outcome
+	if e.Outcome == "" {
+		switch {
+		case e.Status >= http.StatusBadRequest:
+			e.Outcome = AuditOutcomeFailure
+		case e.Status == http.StatusAccepted:
+			e.Outcome = AuditOutcomeDispatched
+		default:
+			e.Outcome = AuditOutcomeSuccess
+		}
+	}
+	e.At = time.Now()
+
+	// Add
+	if err := i.a.add(e); err != nil {
+		i.l.Error(fmt.Errorf("index: adding audit entry failed: %w", err))
+	}
+}
+
+// auditedRequest checks whether a request is an action worth auditing. Reading is not, except for runnable routes
+// requiring more than the viewer role, such as launching a training.
+func auditedRequest(r *http.Request, role string) bool {
+	// Websocket connections are not actions: messages sent through them are audited on their own
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		return false
+	}
+	return r.Method != http.MethodGet || (roleLevels[role] > roleLevels[RoleViewer] && strings.HasPrefix(r.URL.Path, "/workers/"))
+}
+
+// requestAuditEntry describes a request as an audit entry
+func requestAuditEntry(r *http.Request, u User, status int) (e AuditEntry) {
+	// Create entry
+	e = AuditEntry{
+		Action: r.Method + " " + r.URL.Path,
+		Role:   u.Role,
+		Source: AuditSourceAPI,
+		Status: status,
+		User:   u.Username,
+	}
+
+	// Get target
+	// Paths look like /api/workers/<worker>/runnables/<runnable>/<action> or /workers/<worker>/runnables/<runnable>/...
+	ps := strings.Split(strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/api"), "/"), "/")
+	if len(ps) < 4 || ps[0] != "workers" || ps[2] != "runnables" {
+		return
+	}
+	e.Worker = ps[1]
+	e.Runnable = ps[3]
+
+	// Get action
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		switch strings.Join(ps[4:], "/") {
+		case "start":
+			e.Action = astibob.RunnableStartMessage
+		case "stop":
+			e.Action = astibob.RunnableStopMessage
+		}
+		return
+	}
+	e.Source = AuditSourceRoute
+	if len(ps) == 5 && ps[4] == "config" {
+		e.Action = astibob.RunnableConfigUpdateMessage
+	} else if len(ps) > 5 && ps[4] == "routes" {
+		e.Action = r.Method + " /" + strings.Join(ps[5:], "/")
+	}
+	return
+}
+
+// auditDetailsFromContext returns the details handlers can fill when the request holds more information than its
+// method and path, such as the message sent through the API
+func auditDetailsFromContext(ctx context.Context) (d *AuditEntry, ok bool) {
+	d, ok = ctx.Value(auditContextKey).(*AuditEntry)
+	return
+}
+
+// complete overrides the entry with the non-empty fields of details
+func (e *AuditEntry) complete(d AuditEntry) {
+	if d.Action != "" {
+		e.Action = d.Action
+	}
+	if d.Runnable != "" {
+		e.Runnable = d.Runnable
+	}
+	if d.Worker != "" {
+		e.Worker = d.Worker
+	}
+}
+
+// messageAuditEntry describes a UI message as an audit entry
+func messageAuditEntry(m *astibob.Message, u User) (e AuditEntry) {
+	// Create entry
+	e = AuditEntry{
+		Action: m.Name,
+		Role:   u.Role,
+		Source: AuditSourceUI,
+		User:   u.Username,
+	}
+
+	// Get target
+	if m.To != nil {
+		switch m.To.Type {
+		case astibob.RunnableIdentifierType:
+			if m.To.Name != nil {
+				e.Runnable = *m.To.Name
+			}
+			if m.To.Worker != nil {
+				e.Worker = *m.To.Worker
+			}
+		case astibob.WorkerIdentifierType:
+			if m.To.Name != nil {
+				e.Worker = *m.To.Name
+			}
+		}
+	}
+
+	// Runnable messages sent to workers hold the runnable in their payload
+	switch m.Name {
+	case astibob.RunnableConfigUpdateMessage:
+		if p, err := astibob.ParseRunnableConfigUpdatePayload(m); err == nil {
+			e.Runnable = p.Runnable
+		}
+	case astibob.RunnableStartMessage, astibob.RunnableStopMessage:
+		if n, err := astibob.ParseRunnableStartPayload(m); err == nil {
+			e.Runnable = n
+		}
+	}
+	return
+}
+
+// statusResponseWriter keeps track of the status code written by handlers
+type statusResponseWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusResponseWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (i *Index) apiAudit(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Create filter
+	q := r.URL.Query()
+	f := AuditFilter{
+		Action:   q.Get("action"),
+		Runnable: q.Get("runnable"),
+		User:     q.Get("user"),
+		Worker:   q.Get("worker"),
+	}
+
+	// Parse limit
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if f.Limit, err = strconv.Atoi(v); err != nil {
+			astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: parsing limit failed: %w", err))
+			return
+		}
+	}
+
+	// Parse times
+	for k, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(k); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: parsing %s failed: %w", k, err))
+				return
+			}
+		}
+	}
+
+	// Query
+	es, err := i.a.query(f)
+	if err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusInternalServerError, fmt.Errorf("index: querying audit log failed: %w", err))
+		return
+	}
+
+	// Write
+	astibob.WriteHTTPData(i.l, rw, es)
+}
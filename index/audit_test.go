@@ -0,0 +1,163 @@
+package index
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+func lastAuditEntry(t *testing.T, i *Index) AuditEntry {
+	t.Helper()
+	es, err := i.a.query(AuditFilter{Limit: 1})
+	if err != nil {
+		t.Fatalf("querying audit log failed: %v", err)
+	}
+	if len(es) == 0 {
+		t.Fatal("audit log is empty")
+	}
+	return es[0]
+}
+
+func TestAuditUIMessage(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{})
+	defer closeTestIndex(i)
+
+	// Loop through cases
+	for _, v := range []struct {
+		outcome string
+		role    string
+	}{
+		{outcome: AuditOutcomeFailure, role: RoleViewer},
+		{outcome: AuditOutcomeDispatched, role: RoleOperator},
+	} {
+		// Handle message
+		i.handleUIMessage(User{Role: v.role, Username: "john"}, []byte(`{"name":"runnable.start","payload":"r","to":{"name":"w","type":"worker"}}`)) //nolint:errcheck
+
+		// Check entry
+		e := lastAuditEntry(t, i)
+		if e.Action != astibob.RunnableStartMessage || e.Outcome != v.outcome || e.Runnable != "r" || e.Source != AuditSourceUI || e.Worker != "w" {
+			t.Errorf("%s: invalid entry %+v", v.role, e)
+		}
+	}
+}
+
+func TestAuditAPIMessage(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{Access: AccessOptions{Users: []User{{Password: "pwd", Role: RoleAdmin, Username: "john"}}}})
+	defer closeTestIndex(i)
+	h := i.authorize(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) { i.apiSendMessage(rw, r, nil) }))
+
+	// Add worker
+	i.mw.Lock()
+	i.ws["w"] = newWorker(astibob.Worker{Name: "w"}, nil)
+	i.mw.Unlock()
+
+	// Loop through cases
+	for _, v := range []struct {
+		outcome string
+		status  int
+		worker  string
+	}{
+		{outcome: AuditOutcomeFailure, status: http.StatusNotFound, worker: "unknown"},
+		{outcome: AuditOutcomeDispatched, status: http.StatusAccepted, worker: "w"},
+	} {
+		// Send message
+		r := httptest.NewRequest(http.MethodPost, "/api/messages", strings.NewReader(`{"name":"text_to_speech.say","worker":"`+v.worker+`"}`))
+		r.SetBasicAuth("john", "pwd")
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+		if rw.Code != v.status {
+			t.Fatalf("%s: expected %d, got %d", v.worker, v.status, rw.Code)
+		}
+
+		// Check entry
+		e := lastAuditEntry(t, i)
+		if e.Action != "text_to_speech.say" || e.Outcome != v.outcome || e.Source != AuditSourceAPI || e.Status != v.status || e.Worker != v.worker {
+			t.Errorf("%s: invalid entry %+v", v.worker, e)
+		}
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	// Create dir
+	dir, err := ioutil.TempDir("", "astibob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	// Loop through cases
+	for _, path := range []string{"", path} {
+		// Open audit log
+		a, err := newAuditLog(path)
+		if err != nil {
+			t.Fatalf("%s: opening audit log failed: %v", path, err)
+		}
+
+		// Add entries
+		at := time.Now()
+		for idx := 0; idx < auditMaxEntries+10; idx++ {
+			if err = a.add(AuditEntry{Action: fmt.Sprintf("a%d", idx), At: at.Add(time.Duration(idx) * time.Second)}); err != nil {
+				t.Fatalf("%s: adding entry failed: %v", path, err)
+			}
+		}
+		if len(a.es) != auditMaxEntries {
+			t.Fatalf("%s: expected %d entries in memory, got %d", path, auditMaxEntries, len(a.es))
+		}
+
+		// Only entries kept in memory are available when the audit log is not persisted
+		es, err := a.query(AuditFilter{Limit: auditMaxEntries + 10})
+		if err != nil {
+			t.Fatalf("%s: querying failed: %v", path, err)
+		}
+		e := auditMaxEntries + 10
+		if path == "" {
+			e = auditMaxEntries
+		}
+		if len(es) != e {
+			t.Fatalf("%s: expected %d entries, got %d", path, e, len(es))
+		}
+		if es[0].Action != fmt.Sprintf("a%d", auditMaxEntries+9) {
+			t.Fatalf("%s: expected newest entry first, got %+v", path, es[0])
+		}
+		if err = a.close(); err != nil {
+			t.Fatalf("%s: closing failed: %v", path, err)
+		}
+	}
+
+	// Queries are served from memory when possible
+	a, err := newAuditLog(path)
+	if err != nil {
+		t.Fatalf("opening audit log failed: %v", err)
+	}
+	defer a.close()
+	if !a.older || len(a.es) != auditMaxEntries || a.es[0].Action != "a10" {
+		t.Fatal("latest entries have not been loaded")
+	}
+	if err = ioutil.WriteFile(path, []byte("invalid\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []AuditFilter{
+		{Limit: 5},
+		{Action: "a11", Since: a.es[0].At.Add(time.Second)},
+	} {
+		if _, err = a.query(f); err != nil {
+			t.Fatalf("%+v: expected entries to be served from memory, got %v", f, err)
+		}
+	}
+
+	// The file is read when older entries are needed
+	if _, err = a.query(AuditFilter{Action: "a5"}); err == nil {
+		t.Fatal("expected the file to be read")
+	}
+}
@@ -0,0 +1,144 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+// Used when Options.History is nil
+var defaultHistory = map[string]int{
+	astibob.RunnableCrashedMessage: 10,
+}
+
+// history keeps the latest events sent to UIs so that they're replayed to UIs registering afterwards
+type history struct {
+	es    map[string][]astibob.HistoryEvent // Indexed by message name
+	m     *sync.Mutex                       // Locks es
+	sizes map[string]int                    // Indexed by message name pattern
+}
+
+func newHistory(sizes map[string]int) *history {
+	if sizes == nil {
+		sizes = defaultHistory
+	}
+	return &history{
+		es:    make(map[string][]astibob.HistoryEvent),
+		m:     &sync.Mutex{},
+		sizes: sizes,
+	}
+}
+
+// size returns the number of events kept for a message name. When several patterns match, the longest one wins.
+func (h *history) size(name string) (size int) {
+	var pattern string
+	var ok bool
+	for p, s := range h.sizes {
+		if astibob.WildcardMatch(p, name) && (!ok || len(p) > len(pattern)) {
+			size, ok, pattern = s, true, p
+		}
+	}
+	return
+}
+
+// patterns returns the message name patterns whose events are kept
+func (h *history) patterns() (ps []string) {
+	for p, s := range h.sizes {
+		if s > 0 {
+			ps = append(ps, p)
+		}
+	}
+	return
+}
+
+func (h *history) kept(name string) bool {
+	for _, p := range h.patterns() {
+		if p == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *history) add(m *astibob.Message) {
+	// Message is not kept
+	size := h.size(m.Name)
+	if size <= 0 {
+		return
+	}
+
+	// Lock
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	// Append
+	es := append(h.es[m.Name], astibob.HistoryEvent{
+		At:      time.Now(),
+		Message: m,
+	})
+	if len(es) > size {
+		es = es[len(es)-size:]
+	}
+	h.es[m.Name] = es
+}
+
+// events returns events whose name matches one of the patterns, oldest first
+func (h *history) events(patterns []string) (es []astibob.HistoryEvent) {
+	// Lock
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	// Loop through message names
+	for n, nes := range h.es {
+		for _, p := range patterns {
+			if astibob.WildcardMatch(p, n) {
+				es = append(es, nes...)
+				break
+			}
+		}
+	}
+
+	// Sort
+	sort.SliceStable(es, func(i, j int) bool { return es[i].At.Before(es[j].At) })
+	return
+}
+
+func (i *Index) recordHistory(m *astibob.Message) (err error) {
+	// Only events sent to all UIs are kept
+	if m.From.Type == astibob.IndexIdentifierType || m.From.Type == astibob.UIIdentifierType || m.To == nil ||
+		m.To.Name != nil {
+		return
+	}
+
+	// Add
+	i.h.add(m)
+	return
+}
+
+func (i *Index) replayHistory(name string, patterns []string) (err error) {
+	// Get events
+	es := i.h.events(patterns)
+
+	// No events
+	if len(es) == 0 {
+		return
+	}
+
+	// Create message
+	var m *astibob.Message
+	if m, err = astibob.NewUIHistoryMessage(
+		*astibob.NewIndexIdentifier(),
+		astibob.NewUIIdentifier(name),
+		es,
+	); err != nil {
+		err = fmt.Errorf("index: creating history message failed: %w", err)
+		return
+	}
+
+	// Dispatch
+	i.d.Dispatch(m)
+	return
+}
@@ -0,0 +1,104 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astikit"
+)
+
+func TestHistory(t *testing.T) {
+	// Sizes
+	h := newHistory(map[string]int{"r.*": 2, "r.text": 3, "r.ignored": 0})
+	for n, e := range map[string]int{"r.event": 2, "r.text": 3, "r.ignored": 0, "other": 0} {
+		if s := h.size(n); s != e {
+			t.Errorf("%s: expected size %d, got %d", n, e, s)
+		}
+	}
+	if s := newHistory(nil).size(astibob.RunnableCrashedMessage); s != defaultHistory[astibob.RunnableCrashedMessage] {
+		t.Errorf("expected default size %d, got %d", defaultHistory[astibob.RunnableCrashedMessage], s)
+	}
+
+	// Events are bounded per message name
+	for _, n := range []string{"r.event", "r.text", "r.event", "r.event", "r.ignored", "r.text"} {
+		h.add(&astibob.Message{Name: n})
+	}
+	if e, g := 2, len(h.events([]string{"r.event"})); g != e {
+		t.Fatalf("expected %d events, got %d", e, g)
+	}
+
+	// Events matching several patterns are only returned once, oldest first
+	var ns []string
+	var at time.Time
+	for _, e := range h.events([]string{"r.*", "r.text"}) {
+		if e.At.Before(at) {
+			t.Fatal("events are not sorted")
+		}
+		at = e.At
+		ns = append(ns, e.Message.Name)
+	}
+	if e := []string{"r.text", "r.event", "r.event", "r.text"}; !reflect.DeepEqual(e, ns) {
+		t.Fatalf("expected %+v, got %+v", e, ns)
+	}
+}
+
+func TestReplayHistory(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{History: map[string]int{"r.text": 2}})
+	defer closeTestIndex(i)
+
+	// Record history messages
+	c := make(chan *astibob.Message, 1)
+	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.UIHistoryMessage)}, func(m *astibob.Message) error {
+		c <- m
+		return nil
+	})
+
+	// Dispatch events
+	for idx, m := range []*astibob.Message{
+		{From: *astibob.NewRunnableIdentifier("r", "w"), Name: "r.text", Payload: []byte(`"1"`), To: &astibob.Identifier{Type: astibob.UIIdentifierType}},
+		{From: *astibob.NewRunnableIdentifier("r", "w"), Name: "r.text", Payload: []byte(`"2"`), To: &astibob.Identifier{Type: astibob.UIIdentifierType}},
+		// Messages sent to a specific UI are not kept
+		{From: *astibob.NewRunnableIdentifier("r", "w"), Name: "r.text", Payload: []byte(`"private"`), To: astibob.NewUIIdentifier("u")},
+		{From: *astibob.NewRunnableIdentifier("r", "w"), Name: "r.text", Payload: []byte(`"3"`), To: &astibob.Identifier{Type: astibob.UIIdentifierType}},
+	} {
+		m.ID = idx
+		if err := i.recordHistory(m); err != nil {
+			t.Fatalf("recording history failed: %v", err)
+		}
+	}
+
+	// Register late UI
+	m := astibob.NewMessage()
+	m.From = *astibob.NewUIIdentifier("u")
+	m.Name = astibob.UIRegisterMessage
+	if err := m.MarshalPayload(astibob.UI{MessageNames: []string{"r.text"}, Name: "u"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.registerUI(m); err != nil {
+		t.Fatalf("registering ui failed: %v", err)
+	}
+
+	// Latest events have been replayed to the UI
+	select {
+	case m := <-c:
+		if m.To == nil || m.To.Name == nil || *m.To.Name != "u" {
+			t.Fatalf("expected history to be sent to ui u, got %+v", m.To)
+		}
+		es, err := astibob.ParseUIHistoryPayload(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ps []string
+		for _, e := range es {
+			ps = append(ps, string(e.Message.Payload))
+		}
+		if e := []string{`"2"`, `"3"`}; !reflect.DeepEqual(e, ps) {
+			t.Fatalf("expected %+v, got %+v", e, ps)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("history hasn't been replayed")
+	}
+}
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"sort"
@@ -12,40 +13,125 @@ import (
 )
 
 type Options struct {
-	Server astibob.ServerOptions `toml:"server"`
+	// Users and what they are allowed to do
+	Access AccessOptions `toml:"access"`
+	// Appends actions performed by users to a JSON lines file so that they survive restarts. The latest 1000 actions
+	// are kept in memory either way, and empty means older actions are lost.
+	AuditPath string `toml:"audit_path"`
+	// Dials connections of HTTP requests sent to workers
+	Dial astibob.DialFunc `toml:"-"`
+	// Number of recent events sent to UIs kept per message name, indexed by message name pattern (e.g.
+	// "speech_to_text.text"). They're replayed to UIs registering afterwards. Nil means only the latest 10
+	// "runnable.crashed" events are kept.
+	History map[string]int `toml:"history"`
+	// Records dispatched messages so that they can be inspected or replayed
+	Journal  astibob.JournalOptions `toml:"journal"`
+	Liveness LivenessOptions        `toml:"liveness"`
+	// Drops messages whose name matches the pattern key (e.g. "speech_to_text.*") when they exceed the rate limit.
+	// Dropped messages are neither handled nor forwarded to UIs or workers.
+	RateLimits map[string]astibob.RateLimit `toml:"rate_limits"`
+	Server     astibob.ServerOptions        `toml:"server"`
+	// Persists the states operators want runnables to be in so that they're restored when workers register. Empty
+	// means desired states are lost when the index restarts.
+	StatePath string `toml:"state_path"`
 }
 
 type Index struct {
-	c  *http.Client
-	d  *astibob.Dispatcher
-	l  astikit.SeverityLogger
-	mu *sync.Mutex // Locks us
-	mw *sync.Mutex // Locks ws
-	o  Options
-	r  *resources
-	t  *astikit.Templater
-	us map[string]map[string]bool // UI message names indexed by message --> ui
-	w  *astikit.Worker
-	ws map[string]*worker // Workers indexed by name
-	wu *astiws.Manager
-	ww *astiws.Manager
+	a   *auditLog
+	c   *http.Client
+	d   *astibob.Dispatcher
+	ds  *desiredStates
+	h   *history
+	j   *astibob.Journal
+	l   astikit.SeverityLogger
+	mi  *sync.Mutex // Locks ni
+	ms  *sync.Mutex // Locks ss
+	mt  *astibob.Metrics
+	mu  *sync.Mutex // Locks us
+	mw  *sync.Mutex // Locks ws and wts
+	ni  int         // Number of connected inspectors
+	o   Options
+	r   *resources
+	sk  []byte             // Secret used to derive worker keys
+	ss  map[string]session // Sessions indexed by id
+	t   *astikit.Templater
+	ts  *tokens
+	us  map[string]map[string]bool // UI message names indexed by message --> ui
+	w   *astikit.Worker
+	wc  *astibob.WebsocketConns // Connections of inspectors, UIs and workers websockets
+	wi  *astiws.Manager
+	ws  map[string]*worker // Workers indexed by name
+	wts map[string]string  // Ids of tokens workers have connected with indexed by worker name
+	wu  *astiws.Manager
+	ww  *astiws.Manager
 }
 
 // New creates a new index
 func New(o Options, l astikit.StdLogger) (i *Index, err error) {
 	// Create index
 	i = &Index{
-		c:  &http.Client{},
-		l:  astikit.AdaptStdLogger(l),
-		mu: &sync.Mutex{},
-		mw: &sync.Mutex{},
-		o:  o,
-		t:  astikit.NewTemplater(),
-		us: make(map[string]map[string]bool),
-		w:  astikit.NewWorker(astikit.WorkerOptions{Logger: l}),
-		ws: make(map[string]*worker),
-		wu: astiws.NewManager(astiws.ManagerConfiguration{}, l),
-		ww: astiws.NewManager(astiws.ManagerConfiguration{}, l),
+		h:   newHistory(o.History),
+		l:   astikit.AdaptStdLogger(l),
+		mi:  &sync.Mutex{},
+		ms:  &sync.Mutex{},
+		mu:  &sync.Mutex{},
+		mw:  &sync.Mutex{},
+		o:   o,
+		ss:  make(map[string]session),
+		t:   astikit.NewTemplater(),
+		us:  make(map[string]map[string]bool),
+		w:   astikit.NewWorker(astikit.WorkerOptions{Logger: l}),
+		wc:  astibob.NewWebsocketConns(),
+		wi:  astiws.NewManager(astiws.ManagerConfiguration{}, l),
+		ws:  make(map[string]*worker),
+		wts: make(map[string]string),
+		wu:  astiws.NewManager(astiws.ManagerConfiguration{}, l),
+		ww:  astiws.NewManager(astiws.ManagerConfiguration{}, l),
+	}
+
+	// Check access options
+	if err = checkAccessOptions(o.Access); err != nil {
+		err = fmt.Errorf("index: checking access options failed: %w", err)
+		return
+	}
+
+	// Create http client
+	// The index uses its own certificate when workers require mutual TLS
+	var c *tls.Config
+	if c, err = astibob.ClientTLSConfig(o.Server); err != nil {
+		err = fmt.Errorf("index: getting client tls config failed: %w", err)
+		return
+	}
+	i.c = &http.Client{Transport: &http.Transport{
+		DialContext:     o.Dial,
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: c,
+	}}
+
+	// Create secret
+	if i.sk, err = astibob.NewSecret(); err != nil {
+		err = fmt.Errorf("index: creating secret failed: %w", err)
+		return
+	}
+
+	// Load tokens
+	if i.ts, err = newTokens(o.Access.TokensPath); err != nil {
+		err = fmt.Errorf("index: loading tokens failed: %w", err)
+		return
+	}
+
+	// Open audit log
+	if i.a, err = newAuditLog(o.AuditPath); err != nil {
+		err = fmt.Errorf("index: opening audit log failed: %w", err)
+		return
+	} else if o.AuditPath == "" {
+		i.l.Infof("index: audit log is not persisted, only the latest %d actions are kept in memory", auditMaxEntries)
+	}
+
+	// Load desired states
+	if i.ds, err = newDesiredStates(o.StatePath); err != nil {
+		err = fmt.Errorf("index: loading desired states failed: %w", err)
+		return
 	}
 
 	// Add resources
@@ -54,6 +140,29 @@ func New(o Options, l astikit.StdLogger) (i *Index, err error) {
 	// Create dispatcher
 	i.d = astibob.NewDispatcher(i.w.Context(), i.w.NewTask, i.l)
 
+	// Make sure a handler panicking doesn't take the process down
+	i.d.Use(astibob.MessageMiddlewareRecover())
+
+	// Set rate limits
+	if len(o.RateLimits) > 0 {
+		i.d.UseMessage(astibob.MessageMiddlewareRateLimit(o.RateLimits))
+	}
+
+	// Create metrics
+	if err = i.newMetrics(); err != nil {
+		err = fmt.Errorf("index: creating metrics failed: %w", err)
+		return
+	}
+
+	// Create journal
+	if o.Journal.Path != "" {
+		if i.j, err = astibob.NewJournal(o.Journal); err != nil {
+			err = fmt.Errorf("index: creating journal failed: %w", err)
+			return
+		}
+		i.d.SetJournal(i.j)
+	}
+
 	// Loop through layouts
 	for _, c := range i.r.layouts() {
 		i.t.AddLayout(c)
@@ -65,21 +174,33 @@ func New(o Options, l astikit.StdLogger) (i *Index, err error) {
 	}
 
 	// Add dispatcher handlers
+	i.d.On(astibob.DispatchConditions{}, i.inspect)
 	i.d.On(astibob.DispatchConditions{Names: map[string]bool{
-		astibob.RunnableCrashedMessage: true,
-		astibob.RunnableStartedMessage: true,
-		astibob.RunnableStoppedMessage: true,
+		astibob.RunnableCrashedMessage:  true,
+		astibob.RunnableStartedMessage:  true,
+		astibob.RunnableStartingMessage: true,
+		astibob.RunnableStoppedMessage:  true,
+		astibob.RunnableStoppingMessage: true,
 	}}, i.updateRunnableStatus)
+	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.RunnableConfigUpdatedMessage)}, i.updateDesiredConfig)
+	i.d.On(astibob.DispatchConditions{Names: map[string]bool{
+		astibob.RunnableStartMessage: true,
+		astibob.RunnableStopMessage:  true,
+	}}, i.updateDesiredRunning)
 	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.UIDisconnectedMessage)}, i.unregisterUI)
 	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.UIPingMessage)}, i.extendUIConnection)
 	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.UIRegisterMessage)}, i.registerUI)
-	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.WorkerDisconnectedMessage)}, i.delWorker)
+	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.WorkerHeartbeatMessage)}, i.handleHeartbeat)
 	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.WorkerRegisterMessage)}, i.addWorker)
 	i.d.On(astibob.DispatchConditions{To: &astibob.Identifier{Types: map[string]bool{
 		astibob.RunnableIdentifierType: true,
 		astibob.WorkerIdentifierType:   true,
 	}}}, i.sendMessageToWorker)
+	i.d.On(astibob.DispatchConditions{To: &astibob.Identifier{Type: astibob.UIIdentifierType}}, i.recordHistory)
 	i.d.On(astibob.DispatchConditions{To: &astibob.Identifier{Type: astibob.UIIdentifierType}}, i.sendMessageToUI)
+
+	// Check liveness
+	i.checkLiveness()
 	return
 }
 
@@ -88,19 +209,22 @@ func (i *Index) Close() error {
 	// Close dispatcher
 	i.d.Close()
 
-	// Close ui clients
-	if i.wu != nil {
-		if err := i.wu.Close(); err != nil {
-			i.l.Error(fmt.Errorf("index: closing ui clients failed: %w", err))
+	// Close journal
+	if i.j != nil {
+		if err := i.j.Close(); err != nil {
+			i.l.Error(fmt.Errorf("index: closing journal failed: %w", err))
 		}
 	}
 
-	// Close worker clients
-	if i.ww != nil {
-		if err := i.ww.Close(); err != nil {
-			i.l.Error(fmt.Errorf("index: closing worker clients failed: %w", err))
+	// Close audit log
+	if i.a != nil {
+		if err := i.a.close(); err != nil {
+			i.l.Error(fmt.Errorf("index: closing audit log failed: %w", err))
 		}
 	}
+
+	// Close inspector, ui and worker websockets
+	i.wc.Close()
 	return nil
 }
 
@@ -109,19 +233,39 @@ func (i *Index) HandleSignals() {
 	i.w.HandleSignals()
 }
 
+// Stop stops the index and its tasks
+func (i *Index) Stop() {
+	i.w.Stop()
+}
+
 // Wait waits for the index to be stopped
 func (i *Index) Wait() {
 	i.w.Wait()
 }
 
-// On makes sure to handle messages with specific conditions
-func (i *Index) On(c astibob.DispatchConditions, h astibob.MessageHandler) {
-	i.d.On(c, h)
+// On makes sure to handle messages with specific conditions. Use the returned handle to remove the handler.
+func (i *Index) On(c astibob.DispatchConditions, h astibob.MessageHandler) *astibob.DispatchHandle {
+	return i.d.On(c, h)
+}
+
+// Use adds middlewares wrapping message handlers
+func (i *Index) Use(ms ...astibob.MessageMiddleware) {
+	i.d.Use(ms...)
+}
+
+// UseMessage adds middlewares wrapping the handling of a message by all its handlers
+func (i *Index) UseMessage(ms ...astibob.MessageMiddleware) {
+	i.d.UseMessage(ms...)
 }
 
-func sendMessage(l astikit.SeverityLogger, m *astibob.Message, label string, wm *astiws.Manager, names ...string) (err error) {
+// NewDispatchGroup creates a group of handlers that can be removed together
+func (i *Index) NewDispatchGroup() *astibob.DispatchGroup {
+	return i.d.NewGroup()
+}
+
+func sendMessage(l astikit.SeverityLogger, m *astibob.Message, label string, wm *astiws.Manager, codecFunc func(name string) astibob.Codec, names ...string) (err error) {
 	// Get clients
-	var cs []*astiws.Client
+	cs := make(map[string]*astiws.Client)
 	if len(names) > 0 {
 		// Loop through names
 		for _, name := range names {
@@ -132,25 +276,31 @@ func sendMessage(l astikit.SeverityLogger, m *astibob.Message, label string, wm
 				return
 			}
 
-			// Append client
-			cs = append(cs, c)
+			// Add client
+			cs[name] = c
 		}
 	} else {
 		// Loop through clients
-		wm.Clients(func(_ interface{}, c *astiws.Client) (err error) {
-			cs = append(cs, c)
+		wm.Clients(func(k interface{}, c *astiws.Client) (err error) {
+			cs[k.(string)] = c
 			return
 		})
 	}
 
 	// Loop through clients
-	for _, c := range cs {
+	for name, c := range cs {
+		// Get codec
+		cd := astibob.JSONCodec
+		if codecFunc != nil {
+			cd = codecFunc(name)
+		}
+
 		// Log
-		l.Debugf("index: sending %s message to %s with client %p", m.Name, label, c)
+		l.Debugf("index: sending %s message to %s with client %p and codec %s", m.Name, label, c, cd.Name())
 
 		// Write
-		if err = c.WriteJSON(m); err != nil {
-			err = fmt.Errorf("index: writing JSON message failed: %w", err)
+		if err = astibob.WriteWebsocketMessage(c, cd, m); err != nil {
+			err = fmt.Errorf("index: writing message failed: %w", err)
 			return
 		}
 	}
@@ -166,10 +316,18 @@ func (i *Index) uiMessageNames() (ms []string) {
 	for n := range i.us {
 		ms = append(ms, n)
 	}
+
+	// Workers send kept events even when no UI has requested them
+	for _, n := range i.h.patterns() {
+		if _, ok := i.us[n]; !ok {
+			ms = append(ms, n)
+		}
+	}
 	return
 }
 
-func (i *Index) workers() (ws []astibob.Worker) {
+// workers returns the workers as seen by a recipient. Worker recipients receive the key they share with each worker.
+func (i *Index) workers(recipient string) (ws []astibob.Worker) {
 	// Lock
 	i.mw.Lock()
 	defer i.mw.Unlock()
@@ -185,8 +343,16 @@ func (i *Index) workers() (ws []astibob.Worker) {
 
 	// Loop through keys
 	for _, k := range ks {
+		// Create worker
+		w := i.ws[k].toMessage()
+
+		// Add key
+		if recipient != "" {
+			w.Key = astibob.DeriveWorkerKey(i.sk, recipient, w.Name)
+		}
+
 		// Append
-		ws = append(ws, i.ws[k].toMessage())
+		ws = append(ws, w)
 	}
 	return
 }
@@ -0,0 +1,147 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astiws"
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+)
+
+func (i *Index) handleInspectorWebsocket(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	if err := i.wc.ServeHTTP(i.wi, rw, r, func(c *astiws.Client) (err error) {
+		// Inspectors only ping the index, therefore any message extends the connection
+		c.SetMessageHandler(func(_ []byte) error { return c.ExtendConnection() })
+
+		// Get name
+		name := uiName(c)
+
+		// Handle disconnect
+		c.SetListener(astiws.EventNameDisconnect, func(_ *astiws.Client, _ string, _ json.RawMessage) (err error) {
+			i.delInspector(name)
+			return
+		})
+
+		// Add inspector
+		i.addInspector(name, c)
+		return
+	}); err != nil {
+		var e *websocket.CloseError
+		if ok := errors.As(err, &e); !ok ||
+			(e.Code != websocket.CloseNoStatusReceived && e.Code != websocket.CloseNormalClosure) {
+			i.l.Error(fmt.Errorf("index: handling inspector websocket failed: %w", err))
+		}
+		return
+	}
+}
+
+func (i *Index) addInspector(name string, c *astiws.Client) {
+	// Register client
+	i.wi.RegisterClient(name, c)
+
+	// Update count
+	i.mi.Lock()
+	i.ni++
+	first := i.ni == 1
+	i.mi.Unlock()
+
+	// Log
+	i.l.Infof("index: inspector %s has connected", name)
+
+	// Workers start mirroring messages once the first inspector has connected
+	if first {
+		i.dispatchInspectorState(true)
+	}
+}
+
+func (i *Index) delInspector(name string) {
+	// Unregister client
+	i.wi.UnregisterClient(name)
+
+	// Update count
+	i.mi.Lock()
+	i.ni--
+	last := i.ni == 0
+	i.mi.Unlock()
+
+	// Log
+	i.l.Infof("index: inspector %s has disconnected", name)
+
+	// Workers stop mirroring messages once the last inspector has disconnected
+	if last {
+		i.dispatchInspectorState(false)
+	}
+}
+
+func (i *Index) inspected() bool {
+	i.mi.Lock()
+	defer i.mi.Unlock()
+	return i.ni > 0
+}
+
+func (i *Index) dispatchInspectorState(inspected bool) {
+	// Create message
+	m, err := astibob.NewInspectorStateMessage(
+		*astibob.NewIndexIdentifier(),
+		&astibob.Identifier{Type: astibob.WorkerIdentifierType},
+		inspected,
+	)
+	if err != nil {
+		i.l.Error(fmt.Errorf("index: creating inspector state message failed: %w", err))
+		return
+	}
+
+	// Dispatch
+	i.d.Dispatch(m)
+}
+
+func (i *Index) inspect(m *astibob.Message) (err error) {
+	// Nobody is inspecting
+	if !i.inspected() {
+		return
+	}
+
+	// Create inspected message
+	im := astibob.InspectedMessage{
+		At:      time.Now(),
+		Message: m,
+		Source:  astibob.InspectedSourceIndex,
+	}
+
+	// Message has been mirrored by a worker
+	if m.Name == astibob.InspectorMirrorMessage {
+		if im.Message, err = astibob.ParseInspectorMirrorPayload(m); err != nil {
+			err = fmt.Errorf("index: parsing message payload failed: %w", err)
+			return
+		}
+		im.Source = astibob.InspectedSourceMirror
+	}
+
+	// Inspectors must not see the keys workers sign their messages with
+	if im.Message, err = astibob.RedactMessage(im.Message); err != nil {
+		err = fmt.Errorf("index: redacting message failed: %w", err)
+		return
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(im); err != nil {
+		err = fmt.Errorf("index: marshaling inspected message failed: %w", err)
+		return
+	}
+
+	// Loop through clients
+	i.wi.Clients(func(k interface{}, c *astiws.Client) error {
+		// Write
+		if err := c.WriteText(b); err != nil {
+			i.l.Error(fmt.Errorf("index: writing inspected message to %s failed: %w", k, err))
+		}
+		return nil
+	})
+	return
+}
@@ -0,0 +1,278 @@
+package index
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astiws"
+)
+
+// Default liveness options
+const (
+	defaultGracePeriod      = 10 * time.Second
+	defaultHeartbeatPeriod  = 5 * time.Second
+	defaultMissedHeartbeats = 3
+)
+
+// LivenessOptions represents how the index detects workers that are hung or gone. Zero values fall back to defaults.
+type LivenessOptions struct {
+	// Delay before an unresponsive worker is considered disconnected, which keeps short network blips from flapping
+	// UIs. Defaults to 10s.
+	GracePeriod time.Duration `toml:"grace_period"`
+	// Period at which workers send heartbeats. Defaults to 5s.
+	HeartbeatPeriod time.Duration `toml:"heartbeat_period"`
+	// Number of heartbeats a worker can miss before being considered unresponsive. Defaults to 3.
+	MissedHeartbeats int `toml:"missed_heartbeats"`
+}
+
+func (i *Index) gracePeriod() time.Duration {
+	if i.o.Liveness.GracePeriod > 0 {
+		return i.o.Liveness.GracePeriod
+	}
+	return defaultGracePeriod
+}
+
+func (i *Index) heartbeatPeriod() time.Duration {
+	if i.o.Liveness.HeartbeatPeriod > 0 {
+		return i.o.Liveness.HeartbeatPeriod
+	}
+	return defaultHeartbeatPeriod
+}
+
+func (i *Index) missedHeartbeats() int {
+	if i.o.Liveness.MissedHeartbeats > 0 {
+		return i.o.Liveness.MissedHeartbeats
+	}
+	return defaultMissedHeartbeats
+}
+
+// checkLiveness periodically checks whether workers are still alive
+func (i *Index) checkLiveness() {
+	// Get check period
+	p := i.heartbeatPeriod()
+	if g := i.gracePeriod(); g < p {
+		p = g
+	}
+
+	// Execute in a task
+	i.w.NewTask().Do(func() {
+		// Create ticker
+		t := time.NewTicker(p / 2)
+		defer t.Stop()
+
+		// Loop
+		for {
+			select {
+			case <-i.w.Context().Done():
+				return
+			case <-t.C:
+				i.checkWorkers()
+			}
+		}
+	})
+}
+
+func (i *Index) checkWorkers() {
+	// Get workers
+	i.mw.Lock()
+	var ws []*worker
+	for _, w := range i.ws {
+		ws = append(ws, w)
+	}
+	i.mw.Unlock()
+
+	// Loop through workers
+	timeout := time.Duration(i.missedHeartbeats()) * i.heartbeatPeriod()
+	for _, w := range ws {
+		// Get state
+		w.mr.Lock()
+		state, seenAt, unresponsiveAt := w.state, w.seenAt, w.unresponsiveAt
+		w.mr.Unlock()
+
+		// Switch on state
+		switch state {
+		case astibob.WorkerStateHealthy:
+			// Heartbeats have been missed
+			// Workers that don't send heartbeats are only considered unresponsive once their connection drops
+			if w.heartbeats && time.Since(seenAt) > timeout {
+				i.setWorkerUnresponsive(w, fmt.Sprintf("no heartbeat has been received for %s", time.Since(seenAt).Round(time.Millisecond)))
+			}
+		case astibob.WorkerStateUnresponsive:
+			// Grace period is over
+			if time.Since(unresponsiveAt) > i.gracePeriod() {
+				i.disconnectWorker(w)
+			}
+		}
+	}
+}
+
+func (i *Index) setWorkerUnresponsive(w *worker, reason string) {
+	// Update state
+	w.mr.Lock()
+	updated := w.state != astibob.WorkerStateUnresponsive
+	if updated {
+		w.state = astibob.WorkerStateUnresponsive
+		w.unresponsiveAt = time.Now()
+	}
+	w.mr.Unlock()
+
+	// Nothing to do
+	if !updated {
+		return
+	}
+
+	// Log
+	i.l.Infof("index: worker %s is unresponsive since %s", w.name, reason)
+
+	// Dispatch
+	i.dispatchWorkerState(w)
+}
+
+func (i *Index) dispatchWorkerState(w *worker) {
+	// Create message
+	m, err := astibob.NewWorkerStateMessage(
+		*astibob.NewIndexIdentifier(),
+		&astibob.Identifier{Type: astibob.UIIdentifierType},
+		w.toMessage(),
+	)
+	if err != nil {
+		i.l.Error(fmt.Errorf("index: creating state message failed: %w", err))
+		return
+	}
+
+	// Dispatch
+	i.d.Dispatch(m)
+}
+
+func (i *Index) handleWorkerConnectionDropped(w *worker) {
+	// Worker has registered again or has been disconnected in the meantime
+	i.mw.Lock()
+	current := i.ws[w.name] == w
+	i.mw.Unlock()
+	if !current {
+		return
+	}
+
+	// Update worker
+	w.mr.Lock()
+	w.dropped = true
+	w.mr.Unlock()
+
+	// Update state
+	// The worker is given the grace period to reconnect before being considered disconnected
+	i.setWorkerUnresponsive(w, "its connection has dropped")
+}
+
+// connectionDropped checks whether a client is the one of a worker whose connection has dropped. Assumes the workers
+// mutex is locked.
+func (i *Index) connectionDropped(name string, c *astiws.Client) bool {
+	// Get worker
+	w, ok := i.ws[name]
+	if !ok || w.ws != c {
+		return false
+	}
+
+	// Lock
+	w.mr.Lock()
+	defer w.mr.Unlock()
+	return w.dropped
+}
+
+// disconnectWorker removes a worker whose grace period is over
+func (i *Index) disconnectWorker(w *worker) {
+	// Lock
+	i.mw.Lock()
+
+	// Worker has registered again in the meantime
+	if i.ws[w.name] != w {
+		i.mw.Unlock()
+		return
+	}
+
+	// Update pool
+	delete(i.ws, w.name)
+	delete(i.wts, w.name)
+
+	// Unregister client
+	if c, ok := i.ww.Client(w.name); ok && c == w.ws {
+		i.ww.UnregisterClient(w.name)
+	}
+
+	// Unlock
+	i.mw.Unlock()
+
+	// Log
+	i.l.Infof("index: worker %s has disconnected", w.name)
+
+	// Close connection
+	// Close blocks until the worker acknowledges it, which a hung worker may never do
+	w.mr.Lock()
+	dropped := w.dropped
+	w.mr.Unlock()
+	if !dropped {
+		go w.ws.Close()
+	}
+
+	// Create disconnected message
+	m, err := astibob.NewWorkerDisconnectedMessage(
+		*astibob.NewIndexIdentifier(),
+		&astibob.Identifier{Types: map[string]bool{
+			astibob.UIIdentifierType:     true,
+			astibob.WorkerIdentifierType: true,
+		}},
+		w.name,
+	)
+	if err != nil {
+		i.l.Error(fmt.Errorf("index: creating disconnected message failed: %w", err))
+		return
+	}
+
+	// Dispatch
+	i.d.Dispatch(m)
+}
+
+func (i *Index) handleHeartbeat(m *astibob.Message) (err error) {
+	// Parse payload
+	var h astibob.Heartbeat
+	if h, err = astibob.ParseWorkerHeartbeatPayload(m); err != nil {
+		err = fmt.Errorf("index: parsing payload failed: %w", err)
+		return
+	}
+
+	// Get worker
+	i.mw.Lock()
+	w, ok := i.ws[m.From.WorkerName()]
+	i.mw.Unlock()
+	if !ok {
+		return
+	}
+
+	// Update worker
+	// Runnable statuses are refreshed in case status messages have been lost
+	w.mr.Lock()
+	rs := make(map[string]astibob.RunnableMessage)
+	for _, r := range h.Runnables {
+		rs[r.Name] = r
+	}
+	h.Runnables = nil
+	w.hb = &h
+	w.rs = rs
+	w.seenAt = time.Now()
+	recovered := w.state == astibob.WorkerStateUnresponsive && !w.dropped
+	if recovered {
+		w.state = astibob.WorkerStateHealthy
+		w.unresponsiveAt = time.Time{}
+	}
+	w.mr.Unlock()
+
+	// Worker has recovered
+	if recovered {
+		// Log
+		i.l.Infof("index: worker %s is healthy again", w.name)
+
+		// Dispatch
+		i.dispatchWorkerState(w)
+	}
+	return
+}
@@ -0,0 +1,39 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestCheckWorkers(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{Liveness: LivenessOptions{HeartbeatPeriod: time.Millisecond, MissedHeartbeats: 1}})
+	defer closeTestIndex(i)
+
+	// Add workers that haven't been seen for a while
+	ws := map[string]*worker{
+		"legacy":    newWorker(astibob.Worker{Name: "legacy"}, nil),
+		"heartbeat": newWorker(astibob.Worker{Heartbeats: true, Name: "heartbeat"}, nil),
+	}
+	i.mw.Lock()
+	for n, w := range ws {
+		w.seenAt = time.Now().Add(-time.Second)
+		i.ws[n] = w
+	}
+	i.mw.Unlock()
+
+	// Check workers
+	i.checkWorkers()
+
+	// Only workers sending heartbeats are checked
+	for n, state := range map[string]string{
+		"legacy":    astibob.WorkerStateHealthy,
+		"heartbeat": astibob.WorkerStateUnresponsive,
+	} {
+		if s := ws[n].toMessage().State; s != state {
+			t.Errorf("%s: expected %s, got %s", n, state, s)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package index
+
+import (
+	"fmt"
+
+	"github.com/asticode/go-astibob"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (i *Index) newMetrics() (err error) {
+	// Create metrics
+	i.mt = astibob.NewMetrics()
+
+	// Update dispatcher
+	i.d.SetMetrics(i.mt)
+
+	// Register collectors
+	if err = i.mt.Register(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Help: "Number of workers connected to the index.",
+			Name: "astibob_index_workers",
+		}, func() float64 {
+			i.mw.Lock()
+			defer i.mw.Unlock()
+			return float64(len(i.ws))
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Help: "Number of workers that have missed heartbeats or whose connection has dropped.",
+			Name: "astibob_index_unresponsive_workers",
+		}, func() float64 {
+			var c int
+			for _, w := range i.workers("") {
+				if w.State == astibob.WorkerStateUnresponsive {
+					c++
+				}
+			}
+			return float64(c)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Help: "Number of UIs connected to the index.",
+			Name: "astibob_index_uis",
+		}, func() float64 { return float64(i.wu.CountClients()) }),
+		astibob.NewRunnableStatusCollector(i.runnableStatuses),
+	); err != nil {
+		err = fmt.Errorf("index: registering collectors failed: %w", err)
+		return
+	}
+	return
+}
+
+func (i *Index) runnableStatuses() (ss map[string]map[string]string) {
+	ss = make(map[string]map[string]string)
+	for _, w := range i.workers("") {
+		ss[w.Name] = make(map[string]string)
+		for _, r := range w.Runnables {
+			ss[w.Name][r.Name] = r.Status
+		}
+	}
+	return
+}
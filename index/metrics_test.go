@@ -0,0 +1,40 @@
+package index
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestMetrics(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{})
+	defer closeTestIndex(i)
+
+	// Add workers
+	i.mw.Lock()
+	i.ws["w1"] = newWorker(astibob.Worker{Name: "w1", Runnables: []astibob.RunnableMessage{{Metadata: astibob.Metadata{Name: "r"}, Status: astibob.RunningStatus}}}, nil)
+	i.ws["w2"] = newWorker(astibob.Worker{Name: "w2"}, nil)
+	i.ws["w2"].state = astibob.WorkerStateUnresponsive
+	i.mw.Unlock()
+
+	// Scrape
+	rw := httptest.NewRecorder()
+	i.mt.Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	s := rw.Body.String()
+
+	// Check
+	for _, l := range []string{
+		`astibob_index_uis 0`,
+		`astibob_index_unresponsive_workers 1`,
+		`astibob_index_workers 2`,
+		`astibob_runnable_status{runnable="r",status="running",worker="w1"} 1`,
+	} {
+		if !strings.Contains(s, "\n"+l+"\n") {
+			t.Errorf("metrics don't contain %s", l)
+		}
+	}
+}
@@ -20,16 +20,26 @@ func newResources(l astikit.SeverityLogger) (r *resources) {
 	}
 
 	// Add layouts
-	r.ls = append(r.ls, string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x7d,0x7d,0xa,0x3c,0x21,0x44,0x4f,0x43,0x54,0x59,0x50,0x45,0x20,0x68,0x74,0x6d,0x6c,0x3e,0xa,0x3c,0x68,0x74,0x6d,0x6c,0x20,0x6c,0x61,0x6e,0x67,0x3d,0x22,0x65,0x6e,0x22,0x3e,0xa,0x3c,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x4d,0x65,0x74,0x61,0x64,0x61,0x74,0x61,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6d,0x65,0x74,0x61,0x20,0x63,0x68,0x61,0x72,0x73,0x65,0x74,0x3d,0x22,0x55,0x54,0x46,0x2d,0x38,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x69,0x74,0x6c,0x65,0x3e,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0x3c,0x2f,0x74,0x69,0x74,0x6c,0x65,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x41,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x61,0x73,0x65,0x20,0x43,0x53,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x62,0x61,0x73,0x65,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x63,0x6f,0x6c,0x6f,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x43,0x53,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa,0x3c,0x2f,0x68,0x65,0x61,0x64,0x3e,0xa,0x3c,0x62,0x6f,0x64,0x79,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x61,0x73,0x65,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x74,0x61,0x62,0x6c,0x65,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x48,0x65,0x61,0x64,0x65,0x72,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x72,0x6f,0x77,0x22,0x20,0x69,0x64,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x6f,0x62,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x62,0x6f,0x62,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x61,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x22,0x3e,0x3c,0x68,0x31,0x3e,0x42,0x6f,0x62,0x3c,0x2f,0x68,0x31,0x3e,0x3c,0x2f,0x61,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x75,0x74,0x74,0x6f,0x6e,0x73,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x4d,0x65,0x6e,0x75,0x20,0x2b,0x20,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x72,0x6f,0x77,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x4d,0x65,0x6e,0x75,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x6d,0x65,0x6e,0x75,0x22,0x20,0x69,0x64,0x3d,0x22,0x6d,0x65,0x6e,0x75,0x22,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x22,0x20,0x69,0x64,0x3d,0x22,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x48,0x54,0x4d,0x4c,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x41,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x2f,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x77,0x73,0x2f,0x61,0x73,0x74,0x69,0x77,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x61,0x73,0x65,0x20,0x4a,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x6d,0x65,0x6e,0x75,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x62,0x61,0x73,0x65,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x4a,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa,0x3c,0x2f,0x62,0x6f,0x64,0x79,0x3e,0xa,0x3c,0x2f,0x68,0x74,0x6d,0x6c,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d, }))
+	r.ls = append(r.ls, string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x7d,0x7d,0xa,0x3c,0x21,0x44,0x4f,0x43,0x54,0x59,0x50,0x45,0x20,0x68,0x74,0x6d,0x6c,0x3e,0xa,0x3c,0x68,0x74,0x6d,0x6c,0x20,0x6c,0x61,0x6e,0x67,0x3d,0x22,0x65,0x6e,0x22,0x3e,0xa,0x3c,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x4d,0x65,0x74,0x61,0x64,0x61,0x74,0x61,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6d,0x65,0x74,0x61,0x20,0x63,0x68,0x61,0x72,0x73,0x65,0x74,0x3d,0x22,0x55,0x54,0x46,0x2d,0x38,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x69,0x74,0x6c,0x65,0x3e,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0x3c,0x2f,0x74,0x69,0x74,0x6c,0x65,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x41,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x61,0x73,0x65,0x20,0x43,0x53,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x62,0x61,0x73,0x65,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x63,0x6f,0x6c,0x6f,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x43,0x53,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa,0x3c,0x2f,0x68,0x65,0x61,0x64,0x3e,0xa,0x3c,0x62,0x6f,0x64,0x79,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x61,0x73,0x65,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x74,0x61,0x62,0x6c,0x65,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x48,0x65,0x61,0x64,0x65,0x72,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x72,0x6f,0x77,0x22,0x20,0x69,0x64,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x6f,0x62,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x62,0x6f,0x62,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x61,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x22,0x3e,0x3c,0x68,0x31,0x3e,0x42,0x6f,0x62,0x3c,0x2f,0x68,0x31,0x3e,0x3c,0x2f,0x61,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x75,0x74,0x74,0x6f,0x6e,0x73,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x61,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x77,0x65,0x62,0x2f,0x61,0x75,0x64,0x69,0x74,0x22,0x3e,0x41,0x75,0x64,0x69,0x74,0x3c,0x2f,0x61,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x61,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x77,0x65,0x62,0x2f,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x22,0x3e,0x49,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x3c,0x2f,0x61,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x61,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x77,0x65,0x62,0x2f,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x22,0x3e,0x54,0x6f,0x6b,0x65,0x6e,0x73,0x3c,0x2f,0x61,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x69,0x66,0x20,0x2e,0x55,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x73,0x70,0x61,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x2d,0x75,0x73,0x65,0x72,0x22,0x3e,0x7b,0x7b,0x20,0x2e,0x55,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x20,0x7d,0x7d,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x61,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x6c,0x6f,0x67,0x6f,0x75,0x74,0x22,0x3e,0x4c,0x6f,0x67,0x6f,0x75,0x74,0x3c,0x2f,0x61,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x4d,0x65,0x6e,0x75,0x20,0x2b,0x20,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x72,0x6f,0x77,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x4d,0x65,0x6e,0x75,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x6d,0x65,0x6e,0x75,0x22,0x20,0x69,0x64,0x3d,0x22,0x6d,0x65,0x6e,0x75,0x22,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x65,0x6c,0x6c,0x22,0x20,0x69,0x64,0x3d,0x22,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x22,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x48,0x54,0x4d,0x4c,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x41,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2f,0x61,0x73,0x74,0x69,0x70,0x72,0x6f,0x67,0x72,0x65,0x73,0x73,0x65,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x2f,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6c,0x69,0x62,0x2f,0x61,0x73,0x74,0x69,0x77,0x73,0x2f,0x61,0x73,0x74,0x69,0x77,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x42,0x61,0x73,0x65,0x20,0x4a,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x6d,0x65,0x6e,0x75,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x62,0x61,0x73,0x65,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0xa,0x20,0x20,0x20,0x20,0x3c,0x21,0x2d,0x2d,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x4a,0x53,0x20,0x2d,0x2d,0x3e,0xa,0x20,0x20,0x20,0x20,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa,0x3c,0x2f,0x62,0x6f,0x64,0x79,0x3e,0xa,0x3c,0x2f,0x68,0x74,0x6d,0x6c,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d, }))
 	
 	// Add static handles
-	r.ss["/css/base.css"] = astibob.ContentHandle("/css/base.css", []byte{ 0x2f,0x2a,0x20,0x62,0x61,0x73,0x65,0x20,0x2a,0x2f,0xa,0xa,0x2a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x78,0x2d,0x73,0x69,0x7a,0x69,0x6e,0x67,0x3a,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x78,0x3b,0xa,0x7d,0xa,0xa,0x68,0x74,0x6d,0x6c,0x2c,0x20,0x62,0x6f,0x64,0x79,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x65,0x63,0x65,0x64,0x66,0x31,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x33,0x33,0x33,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x62,0x6f,0x64,0x79,0x20,0x3e,0x20,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x62,0x6f,0x64,0x79,0x20,0x3e,0x20,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x3e,0x20,0x2e,0x72,0x6f,0x77,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x33,0x30,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x70,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x30,0x20,0x30,0x20,0x32,0x30,0x70,0x78,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x61,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x75,0x6e,0x73,0x65,0x74,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x64,0x65,0x63,0x6f,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x75,0x6e,0x73,0x65,0x74,0x3b,0xa,0x7d,0xa,0xa,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x78,0x2d,0x73,0x68,0x61,0x64,0x6f,0x77,0x3a,0x20,0x30,0x20,0x31,0x70,0x78,0x20,0x30,0x20,0x72,0x67,0x62,0x61,0x28,0x32,0x35,0x35,0x2c,0x20,0x32,0x35,0x35,0x2c,0x20,0x32,0x35,0x35,0x2c,0x20,0x30,0x2e,0x31,0x35,0x29,0x20,0x69,0x6e,0x73,0x65,0x74,0x2c,0x20,0x30,0x20,0x31,0x70,0x78,0x20,0x31,0x70,0x78,0x20,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2e,0x30,0x37,0x35,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x73,0x68,0x61,0x64,0x6f,0x77,0x3a,0x20,0x30,0x20,0x2d,0x31,0x70,0x78,0x20,0x30,0x20,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2e,0x32,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x6d,0x6f,0x7a,0x2d,0x75,0x73,0x65,0x72,0x2d,0x73,0x65,0x6c,0x65,0x63,0x74,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x69,0x6d,0x61,0x67,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x31,0x70,0x78,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x74,0x72,0x61,0x6e,0x73,0x70,0x61,0x72,0x65,0x6e,0x74,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x77,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x34,0x30,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x69,0x6e,0x65,0x2d,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x2e,0x34,0x32,0x38,0x35,0x37,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x6f,0x75,0x74,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x36,0x70,0x78,0x20,0x31,0x32,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x63,0x65,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6d,0x69,0x64,0x64,0x6c,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x68,0x69,0x74,0x65,0x2d,0x73,0x70,0x61,0x63,0x65,0x3a,0x20,0x6e,0x6f,0x77,0x72,0x61,0x70,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x5d,0x2c,0x20,0x73,0x65,0x6c,0x65,0x63,0x74,0x2c,0x20,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x66,0x69,0x6c,0x65,0x22,0x5d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x78,0x2d,0x73,0x68,0x61,0x64,0x6f,0x77,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x31,0x30,0x70,0x78,0x20,0x35,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x5d,0x3a,0x66,0x6f,0x63,0x75,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6f,0x75,0x74,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x74,0x61,0x62,0x6c,0x65,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x72,0x6f,0x77,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x2d,0x72,0x6f,0x77,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x65,0x6c,0x6c,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x2d,0x63,0x65,0x6c,0x6c,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6d,0x69,0x64,0x64,0x6c,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x34,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x31,0x35,0x70,0x78,0x20,0x30,0x20,0x31,0x35,0x70,0x78,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x68,0x31,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x72,0x69,0x67,0x68,0x74,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x69,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x39,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x6d,0x65,0x6e,0x75,0x20,0x2a,0x2f,0xa,0xa,0x23,0x6d,0x65,0x6e,0x75,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x74,0x6f,0x70,0x3b,0xa,0x7d,0xa,0xa,0x23,0x6d,0x65,0x6e,0x75,0x20,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x65,0x37,0x65,0x37,0x65,0x37,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3e,0x20,0x64,0x69,0x76,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x39,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x2a,0x2f,0xa,0xa,0x23,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x74,0x6f,0x70,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x33,0x33,0x33,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x32,0x30,0x70,0x78,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x23,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x3e,0x20,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x2c,0x20,0x64,0x69,0x76,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x3e,0x20,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x67,0x72,0x69,0x64,0x3b,0xa,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x61,0x75,0x74,0x6f,0x2d,0x72,0x6f,0x77,0x73,0x3a,0x20,0x31,0x66,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x2d,0x67,0x61,0x70,0x3a,0x20,0x33,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x72,0x6f,0x77,0x2d,0x67,0x61,0x70,0x3a,0x20,0x33,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x40,0x6d,0x65,0x64,0x69,0x61,0x20,0x73,0x63,0x72,0x65,0x65,0x6e,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x61,0x78,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x32,0x34,0x70,0x78,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x73,0x3a,0x20,0x72,0x65,0x70,0x65,0x61,0x74,0x28,0x31,0x2c,0x20,0x31,0x66,0x72,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0xa,0x40,0x6d,0x65,0x64,0x69,0x61,0x20,0x73,0x63,0x72,0x65,0x65,0x6e,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x69,0x6e,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x32,0x34,0x70,0x78,0x29,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x61,0x78,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x36,0x30,0x30,0x70,0x78,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x73,0x3a,0x20,0x72,0x65,0x70,0x65,0x61,0x74,0x28,0x32,0x2c,0x20,0x31,0x66,0x72,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0xa,0x40,0x6d,0x65,0x64,0x69,0x61,0x20,0x73,0x63,0x72,0x65,0x65,0x6e,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x69,0x6e,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x36,0x30,0x30,0x70,0x78,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x73,0x3a,0x20,0x72,0x65,0x70,0x65,0x61,0x74,0x28,0x33,0x2c,0x20,0x31,0x66,0x72,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x61,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x34,0x37,0x34,0x46,0x35,0x31,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x31,0x32,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x72,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x3b,0xa,0x7d, }, l)
+	r.ss["/css/base.css"] = astibob.ContentHandle("/css/base.css", []byte{ 0x2f,0x2a,0x20,0x62,0x61,0x73,0x65,0x20,0x2a,0x2f,0xa,0xa,0x2a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x78,0x2d,0x73,0x69,0x7a,0x69,0x6e,0x67,0x3a,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x78,0x3b,0xa,0x7d,0xa,0xa,0x68,0x74,0x6d,0x6c,0x2c,0x20,0x62,0x6f,0x64,0x79,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x65,0x63,0x65,0x64,0x66,0x31,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x33,0x33,0x33,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x62,0x6f,0x64,0x79,0x20,0x3e,0x20,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x62,0x6f,0x64,0x79,0x20,0x3e,0x20,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x3e,0x20,0x2e,0x72,0x6f,0x77,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x33,0x30,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x70,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x30,0x20,0x30,0x20,0x32,0x30,0x70,0x78,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x61,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x75,0x6e,0x73,0x65,0x74,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x64,0x65,0x63,0x6f,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x75,0x6e,0x73,0x65,0x74,0x3b,0xa,0x7d,0xa,0xa,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x78,0x2d,0x73,0x68,0x61,0x64,0x6f,0x77,0x3a,0x20,0x30,0x20,0x31,0x70,0x78,0x20,0x30,0x20,0x72,0x67,0x62,0x61,0x28,0x32,0x35,0x35,0x2c,0x20,0x32,0x35,0x35,0x2c,0x20,0x32,0x35,0x35,0x2c,0x20,0x30,0x2e,0x31,0x35,0x29,0x20,0x69,0x6e,0x73,0x65,0x74,0x2c,0x20,0x30,0x20,0x31,0x70,0x78,0x20,0x31,0x70,0x78,0x20,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2e,0x30,0x37,0x35,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x73,0x68,0x61,0x64,0x6f,0x77,0x3a,0x20,0x30,0x20,0x2d,0x31,0x70,0x78,0x20,0x30,0x20,0x72,0x67,0x62,0x61,0x28,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2c,0x20,0x30,0x2e,0x32,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x6d,0x6f,0x7a,0x2d,0x75,0x73,0x65,0x72,0x2d,0x73,0x65,0x6c,0x65,0x63,0x74,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x69,0x6d,0x61,0x67,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x31,0x70,0x78,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x74,0x72,0x61,0x6e,0x73,0x70,0x61,0x72,0x65,0x6e,0x74,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x77,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x34,0x30,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x69,0x6e,0x65,0x2d,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x2e,0x34,0x32,0x38,0x35,0x37,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x6f,0x75,0x74,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x36,0x70,0x78,0x20,0x31,0x32,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x63,0x65,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6d,0x69,0x64,0x64,0x6c,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x68,0x69,0x74,0x65,0x2d,0x73,0x70,0x61,0x63,0x65,0x3a,0x20,0x6e,0x6f,0x77,0x72,0x61,0x70,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x5d,0x2c,0x20,0x73,0x65,0x6c,0x65,0x63,0x74,0x2c,0x20,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x66,0x69,0x6c,0x65,0x22,0x5d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x78,0x2d,0x73,0x68,0x61,0x64,0x6f,0x77,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x31,0x30,0x70,0x78,0x20,0x35,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x5d,0x3a,0x66,0x6f,0x63,0x75,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6f,0x75,0x74,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x74,0x61,0x62,0x6c,0x65,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x72,0x6f,0x77,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x2d,0x72,0x6f,0x77,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x65,0x6c,0x6c,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x2d,0x63,0x65,0x6c,0x6c,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6d,0x69,0x64,0x64,0x6c,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x34,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x31,0x35,0x70,0x78,0x20,0x30,0x20,0x31,0x35,0x70,0x78,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x68,0x31,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x72,0x69,0x67,0x68,0x74,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x61,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x6c,0x65,0x66,0x74,0x3a,0x20,0x31,0x35,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x23,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x3e,0x20,0x2e,0x63,0x65,0x6c,0x6c,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x69,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x39,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x6d,0x65,0x6e,0x75,0x20,0x2a,0x2f,0xa,0xa,0x23,0x6d,0x65,0x6e,0x75,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x74,0x6f,0x70,0x3b,0xa,0x7d,0xa,0xa,0x23,0x6d,0x65,0x6e,0x75,0x20,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x20,0x30,0x2e,0x35,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x65,0x37,0x65,0x37,0x65,0x37,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3e,0x20,0x64,0x69,0x76,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x39,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2d,0x63,0x6f,0x6e,0x66,0x69,0x67,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x39,0x39,0x39,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x31,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x6c,0x65,0x66,0x74,0x3a,0x20,0x35,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2d,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x39,0x39,0x39,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x31,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x2d,0x6c,0x65,0x66,0x74,0x3a,0x20,0x35,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x2a,0x2f,0xa,0xa,0x23,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x74,0x6f,0x70,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x33,0x33,0x33,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x3a,0x20,0x32,0x30,0x70,0x78,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x23,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x3e,0x20,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x2c,0x20,0x64,0x69,0x76,0x3a,0x66,0x69,0x72,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x3e,0x20,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x67,0x72,0x69,0x64,0x3b,0xa,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x61,0x75,0x74,0x6f,0x2d,0x72,0x6f,0x77,0x73,0x3a,0x20,0x31,0x66,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x2d,0x67,0x61,0x70,0x3a,0x20,0x33,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x72,0x6f,0x77,0x2d,0x67,0x61,0x70,0x3a,0x20,0x33,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x40,0x6d,0x65,0x64,0x69,0x61,0x20,0x73,0x63,0x72,0x65,0x65,0x6e,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x61,0x78,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x32,0x34,0x70,0x78,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x73,0x3a,0x20,0x72,0x65,0x70,0x65,0x61,0x74,0x28,0x31,0x2c,0x20,0x31,0x66,0x72,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0xa,0x40,0x6d,0x65,0x64,0x69,0x61,0x20,0x73,0x63,0x72,0x65,0x65,0x6e,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x69,0x6e,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x32,0x34,0x70,0x78,0x29,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x61,0x78,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x36,0x30,0x30,0x70,0x78,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x73,0x3a,0x20,0x72,0x65,0x70,0x65,0x61,0x74,0x28,0x32,0x2c,0x20,0x31,0x66,0x72,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0xa,0x40,0x6d,0x65,0x64,0x69,0x61,0x20,0x73,0x63,0x72,0x65,0x65,0x6e,0x20,0x61,0x6e,0x64,0x20,0x28,0x6d,0x69,0x6e,0x2d,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x36,0x30,0x30,0x70,0x78,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x67,0x72,0x69,0x64,0x2d,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x2d,0x63,0x6f,0x6c,0x75,0x6d,0x6e,0x73,0x3a,0x20,0x72,0x65,0x70,0x65,0x61,0x74,0x28,0x33,0x2c,0x20,0x31,0x66,0x72,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x61,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x34,0x37,0x34,0x46,0x35,0x31,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x31,0x32,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x72,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x3b,0xa,0x7d,0xa,0x2e,0x68,0x65,0x61,0x64,0x65,0x72,0x2d,0x75,0x73,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x6c,0x65,0x66,0x74,0x3a,0x20,0x33,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa, }, l)
 	r.ss["/css/color.css"] = astibob.ContentHandle("/css/color.css", []byte{ 0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x62,0x6f,0x62,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x30,0x33,0x63,0x30,0x65,0x61,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x32,0x66,0x33,0x61,0x34,0x63,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x30,0x30,0x37,0x37,0x61,0x34,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x68,0x65,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x61,0x30,0x61,0x35,0x61,0x38,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x6d,0x65,0x6e,0x75,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x32,0x66,0x33,0x61,0x34,0x63,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x33,0x33,0x37,0x61,0x62,0x37,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x32,0x65,0x36,0x64,0x61,0x34,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x62,0x61,0x63,0x6b,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x32,0x65,0x36,0x64,0x61,0x34,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x33,0x33,0x37,0x61,0x62,0x37,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x69,0x6e,0x66,0x6f,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x62,0x63,0x30,0x64,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x34,0x36,0x62,0x38,0x64,0x61,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x69,0x6e,0x66,0x6f,0x2d,0x62,0x61,0x63,0x6b,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x34,0x36,0x62,0x38,0x64,0x61,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x62,0x63,0x30,0x64,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x63,0x62,0x38,0x35,0x63,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x34,0x63,0x61,0x65,0x34,0x63,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x2d,0x62,0x61,0x63,0x6b,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x34,0x63,0x61,0x65,0x34,0x63,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x63,0x62,0x38,0x35,0x63,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x77,0x61,0x72,0x6e,0x69,0x6e,0x67,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x30,0x61,0x64,0x34,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x65,0x65,0x61,0x32,0x33,0x36,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x77,0x61,0x72,0x6e,0x69,0x6e,0x67,0x2d,0x62,0x61,0x63,0x6b,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x65,0x65,0x61,0x32,0x33,0x36,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x30,0x61,0x64,0x34,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x61,0x6e,0x67,0x65,0x72,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x64,0x39,0x35,0x33,0x34,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x62,0x39,0x32,0x63,0x32,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x61,0x6e,0x67,0x65,0x72,0x2d,0x62,0x61,0x63,0x6b,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x62,0x39,0x32,0x63,0x32,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x64,0x39,0x35,0x33,0x34,0x66,0x3b,0xa,0x7d, }, l)
-	r.ss["/css/toggle.css"] = astibob.ContentHandle("/css/toggle.css", []byte{ 0x2f,0x2a,0x20,0x68,0x74,0x74,0x70,0x73,0x3a,0x2f,0x2f,0x77,0x77,0x77,0x2e,0x77,0x33,0x73,0x63,0x68,0x6f,0x6f,0x6c,0x73,0x2e,0x63,0x6f,0x6d,0x2f,0x68,0x6f,0x77,0x74,0x6f,0x2f,0x68,0x6f,0x77,0x74,0x6f,0x5f,0x63,0x73,0x73,0x5f,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x61,0x73,0x70,0x20,0x2a,0x2f,0xa,0xa,0x2f,0x2a,0x20,0x54,0x68,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x2d,0x20,0x74,0x68,0x65,0x20,0x62,0x6f,0x78,0x20,0x61,0x72,0x6f,0x75,0x6e,0x64,0x20,0x74,0x68,0x65,0x20,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x72,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x36,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x33,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x54,0x68,0x65,0x20,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x64,0x39,0x35,0x33,0x34,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x33,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x3a,0x62,0x65,0x66,0x6f,0x72,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x3a,0x20,0x22,0x22,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x32,0x2e,0x36,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x32,0x2e,0x36,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x30,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x77,0x68,0x69,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x35,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x6f,0x6e,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x63,0x62,0x38,0x35,0x63,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x6f,0x6e,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x3a,0x62,0x65,0x66,0x6f,0x72,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x20,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x58,0x28,0x32,0x2e,0x36,0x65,0x6d,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x6d,0x73,0x2d,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x20,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x58,0x28,0x32,0x2e,0x36,0x65,0x6d,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x20,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x58,0x28,0x32,0x2e,0x36,0x65,0x6d,0x29,0x3b,0xa,0x7d, }, l)
-	r.ss["/js/base.js"] = astibob.ContentHandle("/js/base.js", []byte{ 0x6c,0x65,0x74,0x20,0x62,0x61,0x73,0x65,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x66,0x72,0x6f,0x6d,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x75,0x69,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x72,0x65,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x72,0x65,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x73,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x77,0x73,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x6f,0x6b,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x2e,0x61,0x64,0x64,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x69,0x6e,0x67,0x50,0x65,0x72,0x69,0x6f,0x64,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x2e,0x70,0x69,0x6e,0x67,0x5f,0x70,0x65,0x72,0x69,0x6f,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x53,0x65,0x72,0x76,0x65,0x72,0x20,0x69,0x73,0x20,0x6f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x22,0x29,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x65,0x6e,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x52,0x61,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x6f,0x6c,0x65,0x2e,0x64,0x65,0x62,0x75,0x67,0x28,0x22,0x72,0x65,0x63,0x65,0x69,0x76,0x65,0x64,0x20,0x6d,0x73,0x67,0x22,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x77,0x69,0x74,0x63,0x68,0x20,0x6f,0x6e,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x57,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x66,0x72,0x6f,0x6d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x6e,0x61,0x6d,0x65,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x6e,0x61,0x6d,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6d,0x73,0x20,0x3d,0x20,0x5b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x75,0x73,0x74,0x6f,0x6d,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x6e,0x61,0x6d,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x29,0x20,0x7b,0x20,0x6d,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x6d,0x29,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x6e,0x64,0x20,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x5f,0x6e,0x61,0x6d,0x65,0x73,0x3a,0x20,0x6d,0x73,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x3a,0x20,0x7b,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x6d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x69,0x6e,0x69,0x74,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x50,0x69,0x6e,0x67,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x3a,0x20,0x7b,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x66,0x69,0x6e,0x69,0x73,0x68,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x2e,0x66,0x72,0x6f,0x6d,0x20,0x3d,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x72,0x6f,0x6d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x77,0x73,0x2e,0x73,0x65,0x6e,0x64,0x4a,0x53,0x4f,0x4e,0x28,0x6d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l)
-	r.ss["/js/consts.js"] = astibob.ContentHandle("/js/consts.js", []byte{ 0x6c,0x65,0x74,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x3a,0x20,0x22,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x3a,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x3a,0x20,0x22,0x75,0x69,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x6f,0x70,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x50,0x69,0x6e,0x67,0x3a,0x20,0x22,0x75,0x69,0x2e,0x70,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x3a,0x20,0x22,0x75,0x69,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x57,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x3a,0x20,0x22,0x75,0x69,0x2e,0x77,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x64,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d, }, l)
-	r.ss["/js/menu.js"] = astibob.ContentHandle("/js/menu.js", []byte{ 0x6c,0x65,0x74,0x20,0x6d,0x65,0x6e,0x75,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x30,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x54,0x6f,0x67,0x67,0x6c,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x66,0x72,0x6f,0x6d,0x20,0x6d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x74,0x6f,0x20,0x6d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0xa,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x6d,0x65,0x6e,0x75,0x22,0x29,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x61,0x62,0x6c,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x48,0x54,0x4d,0x4c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x44,0x65,0x6c,0x65,0x74,0x65,0x20,0x66,0x72,0x6f,0x6d,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x6c,0x65,0x74,0x65,0x28,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x2d,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x65,0x6c,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x2b,0x3d,0x20,0x64,0x65,0x6c,0x74,0x61,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0x74,0x65,0x6d,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x41,0x6c,0x6c,0x28,0x22,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x3e,0x20,0x31,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x2c,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x72,0x6f,0x77,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x72,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x63,0x65,0x6c,0x6c,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x20,0x3d,0x20,0x22,0x31,0x30,0x70,0x78,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x61,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x68,0x72,0x65,0x66,0x20,0x3d,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x69,0x74,0x6c,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x63,0x65,0x6c,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x65,0x6c,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x20,0x3d,0x20,0x22,0x63,0x65,0x6c,0x6c,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x20,0x3d,0x20,0x22,0x31,0x31,0x70,0x78,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x20,0x3d,0x20,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x63,0x65,0x6c,0x6c,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x6c,0x61,0x62,0x65,0x6c,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x22,0x20,0x2b,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x43,0x6c,0x61,0x73,0x73,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x27,0x3c,0x73,0x70,0x61,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x73,0x6c,0x69,0x64,0x65,0x72,0x22,0x3e,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0x27,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6d,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x72,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x72,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x6e,0x64,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x6d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x54,0x6f,0x67,0x67,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x20,0x3f,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x20,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x63,0x6c,0x61,0x73,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x22,0x20,0x2b,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x43,0x6c,0x61,0x73,0x73,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x43,0x6c,0x61,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x22,0x20,0x3f,0x20,0x22,0x6f,0x6e,0x22,0x20,0x3a,0x20,0x22,0x6f,0x66,0x66,0x22,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l)
-	r.ss["/js/pages/index.js"] = astibob.ContentHandle("/js/pages/index.js", []byte{ 0x6c,0x65,0x74,0x20,0x69,0x6e,0x64,0x65,0x78,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x30,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x22,0x29,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x20,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x70,0x61,0x6e,0x65,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x70,0x61,0x6e,0x65,0x6c,0x73,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x48,0x54,0x4d,0x4c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x66,0x72,0x6f,0x6d,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x6c,0x65,0x74,0x65,0x28,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x2d,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x65,0x6c,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x2b,0x3d,0x20,0x64,0x65,0x6c,0x74,0x61,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0x74,0x65,0x6d,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x41,0x6c,0x6c,0x28,0x22,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x3e,0x20,0x31,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x2c,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x70,0x61,0x6e,0x65,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x70,0x61,0x6e,0x65,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x6e,0x65,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x70,0x61,0x6e,0x65,0x6c,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6c,0x69,0x6e,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6c,0x69,0x6e,0x6b,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x61,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x69,0x6e,0x6b,0x2e,0x68,0x72,0x65,0x66,0x20,0x3d,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x69,0x6e,0x6b,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x70,0x61,0x6e,0x65,0x6c,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x6c,0x69,0x6e,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x70,0x61,0x6e,0x65,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x6e,0x65,0x6c,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x65,0x6c,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x6e,0x65,0x6c,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x63,0x65,0x6c,0x6c,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0x3b, }, l)
+	r.ss["/css/pages/audit.css"] = astibob.ContentHandle("/css/pages/audit.css", []byte{ 0x2e,0x61,0x75,0x64,0x69,0x74,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x20,0x69,0x6e,0x70,0x75,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x35,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x36,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x61,0x75,0x64,0x69,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6c,0x61,0x70,0x73,0x65,0x3a,0x20,0x63,0x6f,0x6c,0x6c,0x61,0x70,0x73,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x61,0x75,0x64,0x69,0x74,0x20,0x74,0x68,0x2c,0x20,0x2e,0x61,0x75,0x64,0x69,0x74,0x20,0x74,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x35,0x70,0x78,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6c,0x65,0x66,0x74,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x61,0x75,0x64,0x69,0x74,0x2d,0x66,0x61,0x69,0x6c,0x75,0x72,0x65,0x20,0x74,0x64,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x64,0x39,0x35,0x33,0x34,0x66,0x3b,0xa,0x7d,0xa, }, l)
+	r.ss["/css/pages/index.css"] = astibob.ContentHandle("/css/pages/index.css", []byte{ 0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x35,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x35,0x70,0x78,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x2d,0x64,0x61,0x74,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x39,0x39,0x39,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x2d,0x65,0x72,0x72,0x6f,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x64,0x39,0x35,0x33,0x34,0x66,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x20,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x20,0x30,0x2e,0x35,0x3b,0xa,0x7d,0xa, }, l)
+	r.ss["/css/pages/inspector.css"] = astibob.ContentHandle("/css/pages/inspector.css", []byte{ 0x2f,0x2a,0x20,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0x20,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x5d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x35,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x32,0x30,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0x20,0x6c,0x61,0x62,0x65,0x6c,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x30,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x2a,0x2f,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6c,0x61,0x70,0x73,0x65,0x3a,0x20,0x63,0x6f,0x6c,0x6c,0x61,0x70,0x73,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x69,0x7a,0x65,0x3a,0x20,0x31,0x33,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x74,0x68,0x2c,0x20,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x74,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x35,0x70,0x78,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6c,0x65,0x66,0x74,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x74,0x6f,0x70,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x74,0x64,0x3a,0x6c,0x61,0x73,0x74,0x2d,0x63,0x68,0x69,0x6c,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x66,0x61,0x6d,0x69,0x6c,0x79,0x3a,0x20,0x6d,0x6f,0x6e,0x6f,0x73,0x70,0x61,0x63,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x68,0x69,0x74,0x65,0x2d,0x73,0x70,0x61,0x63,0x65,0x3a,0x20,0x70,0x72,0x65,0x2d,0x77,0x72,0x61,0x70,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x64,0x2d,0x62,0x72,0x65,0x61,0x6b,0x3a,0x20,0x62,0x72,0x65,0x61,0x6b,0x2d,0x61,0x6c,0x6c,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x69,0x72,0x72,0x6f,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x6e,0x74,0x2d,0x73,0x74,0x79,0x6c,0x65,0x3a,0x20,0x69,0x74,0x61,0x6c,0x69,0x63,0x3b,0xa,0x7d,0xa, }, l)
+	r.ss["/css/pages/login.css"] = astibob.ContentHandle("/css/pages/login.css", []byte{ 0x2e,0x6c,0x6f,0x67,0x69,0x6e,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x33,0x30,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6c,0x6f,0x67,0x69,0x6e,0x20,0x69,0x6e,0x70,0x75,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x34,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x31,0x30,0x70,0x78,0x20,0x35,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x6c,0x6f,0x67,0x69,0x6e,0x20,0x69,0x6e,0x70,0x75,0x74,0x3a,0x66,0x6f,0x63,0x75,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6f,0x75,0x74,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x7d,0xa, }, l)
+	r.ss["/css/pages/tokens.css"] = astibob.ContentHandle("/css/pages/tokens.css", []byte{ 0x2e,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x61,0x64,0x64,0x20,0x69,0x6e,0x70,0x75,0x74,0x5b,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x5d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x35,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x33,0x30,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x32,0x30,0x70,0x78,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6c,0x6c,0x61,0x70,0x73,0x65,0x3a,0x20,0x63,0x6f,0x6c,0x6c,0x61,0x70,0x73,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x45,0x36,0x36,0x36,0x38,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x20,0x74,0x68,0x2c,0x20,0x2e,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x20,0x74,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x73,0x6f,0x6c,0x69,0x64,0x20,0x31,0x70,0x78,0x20,0x23,0x64,0x65,0x64,0x65,0x65,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x3a,0x20,0x35,0x70,0x78,0x20,0x31,0x30,0x70,0x78,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6c,0x65,0x66,0x74,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x72,0x67,0x69,0x6e,0x2d,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x30,0x3b,0xa,0x7d,0xa, }, l)
+	r.ss["/css/toggle.css"] = astibob.ContentHandle("/css/toggle.css", []byte{ 0x2f,0x2a,0x20,0x68,0x74,0x74,0x70,0x73,0x3a,0x2f,0x2f,0x77,0x77,0x77,0x2e,0x77,0x33,0x73,0x63,0x68,0x6f,0x6f,0x6c,0x73,0x2e,0x63,0x6f,0x6d,0x2f,0x68,0x6f,0x77,0x74,0x6f,0x2f,0x68,0x6f,0x77,0x74,0x6f,0x5f,0x63,0x73,0x73,0x5f,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x61,0x73,0x70,0x20,0x2a,0x2f,0xa,0xa,0x2f,0x2a,0x20,0x54,0x68,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x2d,0x20,0x74,0x68,0x65,0x20,0x62,0x6f,0x78,0x20,0x61,0x72,0x6f,0x75,0x6e,0x64,0x20,0x74,0x68,0x65,0x20,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x72,0x65,0x6c,0x61,0x74,0x69,0x76,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x69,0x6e,0x6c,0x69,0x6e,0x65,0x2d,0x62,0x6c,0x6f,0x63,0x6b,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x36,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x33,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x7d,0xa,0xa,0x2f,0x2a,0x20,0x54,0x68,0x65,0x20,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x2a,0x2f,0xa,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x70,0x6f,0x69,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x72,0x69,0x67,0x68,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x64,0x39,0x35,0x33,0x34,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x33,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x3a,0x62,0x65,0x66,0x6f,0x72,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x3a,0x20,0x22,0x22,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x32,0x2e,0x36,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x32,0x2e,0x36,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x74,0x74,0x6f,0x6d,0x3a,0x20,0x30,0x2e,0x34,0x65,0x6d,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x77,0x68,0x69,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x2e,0x34,0x73,0x3b,0xa,0x20,0x20,0x20,0x20,0x62,0x6f,0x72,0x64,0x65,0x72,0x2d,0x72,0x61,0x64,0x69,0x75,0x73,0x3a,0x20,0x35,0x30,0x25,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x6f,0x6e,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x35,0x63,0x62,0x38,0x35,0x63,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x6f,0x6e,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x3a,0x62,0x65,0x66,0x6f,0x72,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x20,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x58,0x28,0x32,0x2e,0x36,0x65,0x6d,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x2d,0x6d,0x73,0x2d,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x20,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x58,0x28,0x32,0x2e,0x36,0x65,0x6d,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x20,0x74,0x72,0x61,0x6e,0x73,0x6c,0x61,0x74,0x65,0x58,0x28,0x32,0x2e,0x36,0x65,0x6d,0x29,0x3b,0xa,0x7d,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x30,0x61,0x64,0x34,0x65,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x61,0x39,0x34,0x34,0x34,0x32,0x3b,0xa,0x7d,0xa,0xa,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x20,0x2e,0x73,0x6c,0x69,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x39,0x39,0x39,0x3b,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x73,0x6f,0x72,0x3a,0x20,0x6e,0x6f,0x74,0x2d,0x61,0x6c,0x6c,0x6f,0x77,0x65,0x64,0x3b,0xa,0x7d,0xa, }, l)
+	r.ss["/js/base.js"] = astibob.ContentHandle("/js/base.js", []byte{ 0x6c,0x65,0x74,0x20,0x62,0x61,0x73,0x65,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x66,0x72,0x6f,0x6d,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x75,0x69,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x72,0x65,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x72,0x65,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x73,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x77,0x73,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x6f,0x6b,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x2e,0x61,0x64,0x64,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x69,0x6e,0x67,0x50,0x65,0x72,0x69,0x6f,0x64,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x2e,0x70,0x69,0x6e,0x67,0x5f,0x70,0x65,0x72,0x69,0x6f,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x22,0x53,0x65,0x72,0x76,0x65,0x72,0x20,0x69,0x73,0x20,0x6f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x22,0x29,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x65,0x6e,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x52,0x61,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x6f,0x6c,0x65,0x2e,0x64,0x65,0x62,0x75,0x67,0x28,0x22,0x72,0x65,0x63,0x65,0x69,0x76,0x65,0x64,0x20,0x6d,0x73,0x67,0x22,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x77,0x69,0x74,0x63,0x68,0x20,0x6f,0x6e,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x57,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x66,0x72,0x6f,0x6d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x6e,0x61,0x6d,0x65,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x6e,0x61,0x6d,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6d,0x73,0x20,0x3d,0x20,0x5b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x6f,0x6e,0x66,0x69,0x67,0x55,0x70,0x64,0x61,0x74,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x75,0x73,0x74,0x6f,0x6d,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x6e,0x61,0x6d,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x29,0x20,0x7b,0x20,0x6d,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x6d,0x29,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x6e,0x64,0x20,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x5f,0x6e,0x61,0x6d,0x65,0x73,0x3a,0x20,0x6d,0x73,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x3a,0x20,0x7b,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x6d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x69,0x6e,0x69,0x74,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x48,0x69,0x73,0x74,0x6f,0x72,0x79,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x70,0x6c,0x61,0x79,0x65,0x64,0x20,0x65,0x76,0x65,0x6e,0x74,0x73,0x20,0x61,0x72,0x65,0x20,0x6f,0x6e,0x6c,0x79,0x20,0x66,0x6f,0x72,0x77,0x61,0x72,0x64,0x65,0x64,0x20,0x74,0x6f,0x20,0x74,0x68,0x65,0x20,0x70,0x61,0x67,0x65,0x20,0x73,0x69,0x6e,0x63,0x65,0x20,0x74,0x68,0x65,0x20,0x6d,0x65,0x6e,0x75,0x20,0x61,0x6e,0x64,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x73,0x20,0x61,0x72,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x75,0x70,0x20,0x74,0x6f,0x20,0x64,0x61,0x74,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x61,0x74,0x20,0x3d,0x20,0x65,0x2e,0x61,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x72,0x65,0x70,0x6c,0x61,0x79,0x65,0x64,0x20,0x3d,0x20,0x74,0x72,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x65,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x6f,0x6e,0x66,0x69,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x75,0x73,0x74,0x6f,0x6d,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x75,0x69,0x50,0x69,0x6e,0x67,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x3a,0x20,0x7b,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x69,0x6e,0x64,0x65,0x78,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x66,0x69,0x6e,0x69,0x73,0x68,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x65,0x72,0x72,0x6f,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x2e,0x66,0x72,0x6f,0x6d,0x20,0x3d,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x72,0x6f,0x6d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x77,0x73,0x2e,0x73,0x65,0x6e,0x64,0x4a,0x53,0x4f,0x4e,0x28,0x6d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l)
+	r.ss["/js/config.js"] = astibob.ContentHandle("/js/config.js", []byte{ 0x6c,0x65,0x74,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x3a,0x20,0x6e,0x75,0x6c,0x6c,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x6f,0x6e,0x66,0x69,0x67,0x55,0x70,0x64,0x61,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x6f,0x6e,0x66,0x69,0x67,0x20,0x66,0x6f,0x72,0x6d,0x20,0x6f,0x66,0x20,0x74,0x68,0x69,0x73,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x69,0x73,0x20,0x6e,0x6f,0x74,0x20,0x6f,0x70,0x65,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x20,0x3d,0x3d,0x3d,0x20,0x6e,0x75,0x6c,0x6c,0x20,0x7c,0x7c,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x20,0x21,0x3d,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x7c,0x7c,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x21,0x3d,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x76,0x61,0x6c,0x75,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x6f,0x72,0x6d,0xa,0xa,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x2f,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x2f,0x22,0x20,0x2b,0x20,0x65,0x6e,0x63,0x6f,0x64,0x65,0x55,0x52,0x49,0x43,0x6f,0x6d,0x70,0x6f,0x6e,0x65,0x6e,0x74,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x29,0x20,0x2b,0x20,0x22,0x2f,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x2f,0x22,0x20,0x2b,0x20,0x65,0x6e,0x63,0x6f,0x64,0x65,0x55,0x52,0x49,0x43,0x6f,0x6d,0x70,0x6f,0x6e,0x65,0x6e,0x74,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x2b,0x20,0x22,0x2f,0x63,0x6f,0x6e,0x66,0x69,0x67,0x22,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x70,0x65,0x6e,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x75,0x72,0x6c,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0x20,0x66,0x6f,0x72,0x6d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x68,0x6f,0x77,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x68,0x6f,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x69,0x65,0x6c,0x64,0x73,0x3a,0x20,0x5b,0x5d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x74,0x69,0x74,0x6c,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x69,0x74,0x6c,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x65,0x72,0x72,0x6f,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x66,0x69,0x65,0x6c,0x64,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x66,0x69,0x65,0x6c,0x64,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x66,0x29,0x20,0x7b,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x61,0x64,0x64,0x46,0x69,0x65,0x6c,0x64,0x28,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2c,0x20,0x66,0x29,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x74,0x20,0x76,0x61,0x6c,0x75,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x28,0x64,0x61,0x74,0x61,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x66,0x69,0x65,0x6c,0x64,0x2d,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x22,0x53,0x61,0x76,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x75,0x62,0x6d,0x69,0x74,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x73,0x75,0x62,0x6d,0x69,0x74,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x6f,0x6e,0x63,0x6c,0x6f,0x73,0x65,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x20,0x3d,0x20,0x6e,0x75,0x6c,0x6c,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x65,0x74,0x57,0x69,0x64,0x74,0x68,0x28,0x22,0x35,0x30,0x30,0x70,0x78,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x65,0x74,0x43,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x28,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x46,0x69,0x65,0x6c,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2c,0x20,0x66,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6c,0x61,0x62,0x65,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x6c,0x61,0x62,0x65,0x6c,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x6c,0x61,0x62,0x65,0x6c,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x66,0x2e,0x6c,0x61,0x62,0x65,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6c,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x66,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6c,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x69,0x6e,0x70,0x75,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x66,0x2e,0x74,0x79,0x70,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x20,0x26,0x26,0x20,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x65,0x6c,0x65,0x63,0x74,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x66,0x69,0x65,0x6c,0x64,0x2d,0x74,0x65,0x78,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x2e,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6f,0x70,0x74,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x2e,0x76,0x61,0x6c,0x75,0x65,0x20,0x3d,0x20,0x6f,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x70,0x74,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x6f,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6f,0x70,0x74,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x69,0x6e,0x70,0x75,0x74,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x66,0x2e,0x74,0x79,0x70,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x2e,0x62,0x6f,0x6f,0x6c,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x74,0x79,0x70,0x65,0x20,0x3d,0x20,0x22,0x63,0x68,0x65,0x63,0x6b,0x62,0x6f,0x78,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x2e,0x6e,0x75,0x6d,0x62,0x65,0x72,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x66,0x69,0x65,0x6c,0x64,0x2d,0x74,0x65,0x78,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x74,0x79,0x70,0x65,0x20,0x3d,0x20,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x73,0x74,0x65,0x70,0x20,0x3d,0x20,0x22,0x61,0x6e,0x79,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x6d,0x69,0x6e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x69,0x2e,0x6d,0x69,0x6e,0x20,0x3d,0x20,0x66,0x2e,0x6d,0x69,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x6d,0x61,0x78,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x69,0x2e,0x6d,0x61,0x78,0x20,0x3d,0x20,0x66,0x2e,0x6d,0x61,0x78,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x73,0x74,0x69,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2d,0x66,0x69,0x65,0x6c,0x64,0x2d,0x74,0x65,0x78,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x2e,0x74,0x79,0x70,0x65,0x20,0x3d,0x20,0x22,0x74,0x65,0x78,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x69,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x66,0x69,0x65,0x6c,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x66,0x69,0x65,0x6c,0x64,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x6f,0x64,0x65,0x3a,0x20,0x69,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x63,0x68,0x65,0x6d,0x61,0x3a,0x20,0x66,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x65,0x74,0x56,0x61,0x6c,0x75,0x65,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x76,0x61,0x6c,0x75,0x65,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x66,0x69,0x65,0x6c,0x64,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x66,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4e,0x6f,0x20,0x76,0x61,0x6c,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x76,0x61,0x6c,0x75,0x65,0x73,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x74,0x20,0x76,0x61,0x6c,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x74,0x79,0x70,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x2e,0x62,0x6f,0x6f,0x6c,0x29,0x20,0x66,0x2e,0x6e,0x6f,0x64,0x65,0x2e,0x63,0x68,0x65,0x63,0x6b,0x65,0x64,0x20,0x3d,0x20,0x76,0x61,0x6c,0x75,0x65,0x73,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x6c,0x73,0x65,0x20,0x66,0x2e,0x6e,0x6f,0x64,0x65,0x2e,0x76,0x61,0x6c,0x75,0x65,0x20,0x3d,0x20,0x76,0x61,0x6c,0x75,0x65,0x73,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x6e,0x6f,0x6e,0x65,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x66,0x69,0x65,0x6c,0x64,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x20,0x3d,0x20,0x7b,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x69,0x64,0x78,0x20,0x3d,0x20,0x30,0x3b,0x20,0x69,0x64,0x78,0x20,0x3c,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x66,0x69,0x65,0x6c,0x64,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x69,0x64,0x78,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x66,0x69,0x65,0x6c,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x66,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x66,0x69,0x65,0x6c,0x64,0x73,0x5b,0x69,0x64,0x78,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x76,0x61,0x6c,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x74,0x79,0x70,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x2e,0x62,0x6f,0x6f,0x6c,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x66,0x2e,0x6e,0x6f,0x64,0x65,0x2e,0x63,0x68,0x65,0x63,0x6b,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x2e,0x6e,0x75,0x6d,0x62,0x65,0x72,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x70,0x61,0x72,0x73,0x65,0x46,0x6c,0x6f,0x61,0x74,0x28,0x66,0x2e,0x6e,0x6f,0x64,0x65,0x2e,0x76,0x61,0x6c,0x75,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x73,0x4e,0x61,0x4e,0x28,0x63,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x29,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x68,0x6f,0x77,0x45,0x72,0x72,0x6f,0x72,0x28,0x27,0x46,0x69,0x65,0x6c,0x64,0x20,0x22,0x27,0x20,0x2b,0x20,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6c,0x61,0x62,0x65,0x6c,0x20,0x2b,0x20,0x27,0x22,0x20,0x6d,0x75,0x73,0x74,0x20,0x62,0x65,0x20,0x61,0x20,0x6e,0x75,0x6d,0x62,0x65,0x72,0x27,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x5b,0x66,0x2e,0x73,0x63,0x68,0x65,0x6d,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x66,0x2e,0x6e,0x6f,0x64,0x65,0x2e,0x76,0x61,0x6c,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x50,0x41,0x54,0x43,0x48,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x63,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x75,0x72,0x6c,0x28,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0x20,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x68,0x6f,0x77,0x45,0x72,0x72,0x6f,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x6c,0x73,0x65,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x73,0x68,0x6f,0x77,0x45,0x72,0x72,0x6f,0x72,0x28,0x22,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x20,0x65,0x72,0x72,0x6f,0x72,0x22,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x6c,0x6f,0x73,0x65,0x20,0x6d,0x6f,0x64,0x61,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6d,0x6f,0x64,0x61,0x6c,0x65,0x72,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4e,0x6f,0x74,0x69,0x66,0x79,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x28,0x22,0x43,0x6f,0x6e,0x66,0x69,0x67,0x20,0x68,0x61,0x73,0x20,0x62,0x65,0x65,0x6e,0x20,0x73,0x61,0x76,0x65,0x64,0x22,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x68,0x69,0x64,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x68,0x6f,0x77,0x45,0x72,0x72,0x6f,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x65,0x78,0x74,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x74,0x65,0x78,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0xa, }, l)
+	r.ss["/js/consts.js"] = astibob.ContentHandle("/js/consts.js", []byte{ 0x6c,0x65,0x74,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0x20,0x22,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x3a,0x20,0x22,0x73,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x3a,0x20,0x22,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x3a,0x20,0x22,0x73,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x3a,0x20,0x22,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x46,0x69,0x65,0x6c,0x64,0x54,0x79,0x70,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x6f,0x6f,0x6c,0x3a,0x20,0x22,0x62,0x6f,0x6f,0x6c,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x75,0x6d,0x62,0x65,0x72,0x3a,0x20,0x22,0x6e,0x75,0x6d,0x62,0x65,0x72,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x72,0x69,0x6e,0x67,0x3a,0x20,0x22,0x73,0x74,0x72,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x3a,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x3a,0x20,0x22,0x75,0x69,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x6f,0x6e,0x66,0x69,0x67,0x55,0x70,0x64,0x61,0x74,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x6f,0x70,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x65,0x64,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x3a,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x48,0x69,0x73,0x74,0x6f,0x72,0x79,0x3a,0x20,0x22,0x75,0x69,0x2e,0x68,0x69,0x73,0x74,0x6f,0x72,0x79,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x50,0x69,0x6e,0x67,0x3a,0x20,0x22,0x75,0x69,0x2e,0x70,0x69,0x6e,0x67,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x3a,0x20,0x22,0x75,0x69,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x69,0x57,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x3a,0x20,0x22,0x75,0x69,0x2e,0x77,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x64,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x3a,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x73,0x74,0x61,0x74,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x73,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x65,0x61,0x6c,0x74,0x68,0x79,0x3a,0x20,0x22,0x68,0x65,0x61,0x6c,0x74,0x68,0x79,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x3a,0x20,0x22,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d, }, l)
+	r.ss["/js/menu.js"] = astibob.ContentHandle("/js/menu.js", []byte{ 0x6c,0x65,0x74,0x20,0x6d,0x65,0x6e,0x75,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x30,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x54,0x6f,0x67,0x67,0x6c,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x66,0x72,0x6f,0x6d,0x20,0x6d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x70,0x6c,0x61,0x63,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x69,0x6e,0x20,0x6d,0x65,0x6e,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x6d,0x61,0x79,0x20,0x72,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x20,0x61,0x67,0x61,0x69,0x6e,0x20,0x77,0x68,0x69,0x6c,0x65,0x20,0x74,0x68,0x65,0x20,0x69,0x6e,0x64,0x65,0x78,0x20,0x73,0x74,0x69,0x6c,0x6c,0x20,0x77,0x61,0x69,0x74,0x73,0x20,0x66,0x6f,0x72,0x20,0x69,0x74,0x20,0x74,0x6f,0x20,0x72,0x65,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x6e,0x61,0x6d,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0xa,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x6d,0x65,0x6e,0x75,0x22,0x29,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x73,0x2e,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x2b,0x3d,0x20,0x22,0x20,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x22,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x69,0x73,0x20,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x61,0x62,0x6c,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x48,0x54,0x4d,0x4c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x44,0x65,0x6c,0x65,0x74,0x65,0x20,0x66,0x72,0x6f,0x6d,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x6c,0x65,0x74,0x65,0x28,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x2d,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x65,0x6c,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x2b,0x3d,0x20,0x64,0x65,0x6c,0x74,0x61,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0x74,0x65,0x6d,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x41,0x6c,0x6c,0x28,0x22,0x2e,0x6d,0x65,0x6e,0x75,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x3e,0x20,0x31,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x61,0x62,0x6c,0x65,0x2c,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x61,0x62,0x6c,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x61,0x62,0x6c,0x65,0x20,0x7c,0x7c,0x20,0x66,0x61,0x6c,0x73,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x61,0x73,0x74,0x5f,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6c,0x61,0x73,0x74,0x5f,0x65,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x7c,0x7c,0x20,0x30,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x3a,0x20,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x3f,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x29,0x20,0x3a,0x20,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x72,0x6f,0x77,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x72,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x6d,0x6f,0x75,0x73,0x65,0x65,0x6e,0x74,0x65,0x72,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x74,0x69,0x6d,0x65,0x20,0x63,0x68,0x61,0x6e,0x67,0x65,0x73,0x20,0x61,0x6c,0x6c,0x20,0x74,0x68,0x65,0x20,0x74,0x69,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x52,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x28,0x72,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x63,0x65,0x6c,0x6c,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x70,0x61,0x64,0x64,0x69,0x6e,0x67,0x52,0x69,0x67,0x68,0x74,0x20,0x3d,0x20,0x22,0x31,0x30,0x70,0x78,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x61,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x68,0x72,0x65,0x66,0x20,0x3d,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x69,0x74,0x6c,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x6d,0x65,0x6e,0x75,0x2d,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2d,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x52,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x28,0x72,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x72,0x2e,0x63,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x61,0x62,0x6c,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x6d,0x65,0x6e,0x75,0x2d,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2d,0x63,0x6f,0x6e,0x66,0x69,0x67,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x22,0xe2,0x9a,0x99,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x22,0x43,0x6f,0x6e,0x66,0x69,0x67,0x75,0x72,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x63,0x6f,0x6e,0x66,0x69,0x67,0x2e,0x6f,0x70,0x65,0x6e,0x28,0x72,0x29,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x63,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x63,0x65,0x6c,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x65,0x6c,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x20,0x3d,0x20,0x22,0x63,0x65,0x6c,0x6c,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x66,0x6f,0x6e,0x74,0x53,0x69,0x7a,0x65,0x20,0x3d,0x20,0x22,0x31,0x31,0x70,0x78,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x74,0x65,0x78,0x74,0x41,0x6c,0x69,0x67,0x6e,0x20,0x3d,0x20,0x22,0x72,0x69,0x67,0x68,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x63,0x65,0x6c,0x6c,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x6c,0x61,0x62,0x65,0x6c,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x22,0x20,0x2b,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x43,0x6c,0x61,0x73,0x73,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x27,0x3c,0x73,0x70,0x61,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x73,0x6c,0x69,0x64,0x65,0x72,0x22,0x3e,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0x27,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x69,0x73,0x20,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x72,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6d,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x3a,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x72,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x79,0x70,0x65,0x3a,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x72,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0x20,0x7c,0x7c,0x20,0x72,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x65,0x6e,0x64,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x73,0x65,0x6e,0x64,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x6d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x54,0x6f,0x67,0x67,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x6f,0x70,0x70,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x63,0x6c,0x61,0x73,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x6f,0x67,0x67,0x6c,0x65,0x20,0x22,0x20,0x2b,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x43,0x6c,0x61,0x73,0x73,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x20,0x73,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x69,0x73,0x20,0x73,0x74,0x69,0x6c,0x6c,0x20,0x75,0x70,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x21,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x29,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x20,0x3d,0x20,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x7c,0x7c,0x20,0x30,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x69,0x66,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x29,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x5f,0x65,0x72,0x72,0x6f,0x72,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x52,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x52,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x74,0x65,0x78,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x3e,0x20,0x30,0x20,0x3f,0x20,0x22,0xe2,0x86,0xbb,0x20,0x22,0x20,0x2b,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x3a,0x20,0x22,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x2b,0x3d,0x20,0x22,0x5c,0x6e,0x53,0x74,0x61,0x74,0x75,0x73,0x3a,0x20,0x22,0x20,0x2b,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x2b,0x3d,0x20,0x22,0x5c,0x6e,0x53,0x74,0x61,0x72,0x74,0x65,0x64,0x20,0x61,0x74,0x3a,0x20,0x22,0x20,0x2b,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x2e,0x74,0x6f,0x4c,0x6f,0x63,0x61,0x6c,0x65,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x2b,0x3d,0x20,0x22,0x5c,0x6e,0x55,0x70,0x74,0x69,0x6d,0x65,0x3a,0x20,0x22,0x20,0x2b,0x20,0x6d,0x65,0x6e,0x75,0x2e,0x66,0x6f,0x72,0x6d,0x61,0x74,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x29,0x20,0x2d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x73,0x74,0x61,0x72,0x74,0x65,0x64,0x5f,0x61,0x74,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x20,0x3e,0x20,0x30,0x29,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x2b,0x3d,0x20,0x22,0x5c,0x6e,0x52,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0x3a,0x20,0x22,0x20,0x2b,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x72,0x65,0x73,0x74,0x61,0x72,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x5f,0x65,0x72,0x72,0x6f,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x5f,0x65,0x72,0x72,0x6f,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x22,0x29,0x20,0x74,0x69,0x74,0x6c,0x65,0x20,0x2b,0x3d,0x20,0x22,0x5c,0x6e,0x4c,0x61,0x73,0x74,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x22,0x20,0x2b,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6c,0x61,0x73,0x74,0x5f,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x6d,0x61,0x74,0x44,0x75,0x72,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6d,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x73,0x20,0x3d,0x20,0x4d,0x61,0x74,0x68,0x2e,0x6d,0x61,0x78,0x28,0x30,0x2c,0x20,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x6d,0x73,0x20,0x2f,0x20,0x31,0x30,0x30,0x30,0x29,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x64,0x20,0x3d,0x20,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x73,0x20,0x2f,0x20,0x38,0x36,0x34,0x30,0x30,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x68,0x20,0x3d,0x20,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x28,0x73,0x20,0x25,0x20,0x38,0x36,0x34,0x30,0x30,0x29,0x20,0x2f,0x20,0x33,0x36,0x30,0x30,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6d,0x20,0x3d,0x20,0x4d,0x61,0x74,0x68,0x2e,0x66,0x6c,0x6f,0x6f,0x72,0x28,0x28,0x73,0x20,0x25,0x20,0x33,0x36,0x30,0x30,0x29,0x20,0x2f,0x20,0x36,0x30,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x28,0x64,0x20,0x3e,0x20,0x30,0x20,0x3f,0x20,0x64,0x20,0x2b,0x20,0x22,0x64,0x20,0x22,0x20,0x3a,0x20,0x22,0x22,0x29,0x20,0x2b,0x20,0x28,0x68,0x20,0x3e,0x20,0x30,0x20,0x7c,0x7c,0x20,0x64,0x20,0x3e,0x20,0x30,0x20,0x3f,0x20,0x68,0x20,0x2b,0x20,0x22,0x68,0x20,0x22,0x20,0x3a,0x20,0x22,0x22,0x29,0x20,0x2b,0x20,0x6d,0x20,0x2b,0x20,0x22,0x6d,0x20,0x22,0x20,0x2b,0x20,0x28,0x73,0x20,0x25,0x20,0x36,0x30,0x29,0x20,0x2b,0x20,0x22,0x73,0x22,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x43,0x6c,0x61,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x73,0x74,0x61,0x74,0x75,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x6f,0x66,0x66,0x20,0x63,0x72,0x61,0x73,0x68,0x65,0x64,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x6f,0x6e,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x61,0x72,0x74,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x6f,0x6e,0x20,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x73,0x74,0x6f,0x70,0x70,0x69,0x6e,0x67,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x6f,0x66,0x66,0x20,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x53,0x74,0x61,0x74,0x75,0x73,0x65,0x73,0x2e,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x6f,0x66,0x66,0x20,0x75,0x6e,0x6b,0x6e,0x6f,0x77,0x6e,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x6f,0x66,0x66,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l)
+	r.ss["/js/pages/audit.js"] = astibob.ContentHandle("/js/pages/audit.js", []byte{ 0x6c,0x65,0x74,0x20,0x61,0x75,0x64,0x69,0x74,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x61,0x75,0x64,0x69,0x74,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x2e,0x70,0x72,0x65,0x76,0x65,0x6e,0x74,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x75,0x64,0x69,0x74,0x2e,0x6c,0x69,0x73,0x74,0x28,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x62,0x61,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x61,0x75,0x64,0x69,0x74,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x75,0x64,0x69,0x74,0x2e,0x6c,0x69,0x73,0x74,0x28,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x71,0x75,0x65,0x72,0x79,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x74,0x65,0x78,0x74,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x71,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x55,0x52,0x4c,0x53,0x65,0x61,0x72,0x63,0x68,0x50,0x61,0x72,0x61,0x6d,0x73,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x20,0x3d,0x20,0x5b,0x22,0x61,0x63,0x74,0x69,0x6f,0x6e,0x22,0x2c,0x20,0x22,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x22,0x2c,0x20,0x22,0x75,0x73,0x65,0x72,0x22,0x2c,0x20,0x22,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x76,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x61,0x75,0x64,0x69,0x74,0x2d,0x22,0x20,0x2b,0x20,0x6b,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x76,0x20,0x21,0x3d,0x3d,0x20,0x22,0x22,0x29,0x20,0x71,0x2e,0x73,0x65,0x74,0x28,0x6b,0x2c,0x20,0x76,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x74,0x69,0x6d,0x65,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x74,0x69,0x6d,0x65,0x73,0x20,0x3d,0x20,0x5b,0x22,0x73,0x69,0x6e,0x63,0x65,0x22,0x2c,0x20,0x22,0x75,0x6e,0x74,0x69,0x6c,0x22,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x69,0x6d,0x65,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x76,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x61,0x75,0x64,0x69,0x74,0x2d,0x22,0x20,0x2b,0x20,0x6b,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x76,0x20,0x21,0x3d,0x3d,0x20,0x22,0x22,0x29,0x20,0x71,0x2e,0x73,0x65,0x74,0x28,0x6b,0x2c,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x76,0x29,0x2e,0x74,0x6f,0x49,0x53,0x4f,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x71,0x2e,0x74,0x6f,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6c,0x69,0x73,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x61,0x75,0x64,0x69,0x74,0x3f,0x22,0x20,0x2b,0x20,0x61,0x75,0x64,0x69,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x28,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x45,0x6d,0x70,0x74,0x79,0x20,0x74,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x74,0x62,0x6f,0x64,0x79,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x61,0x75,0x64,0x69,0x74,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x22,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x65,0x6e,0x74,0x72,0x69,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x20,0x7b,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x61,0x75,0x64,0x69,0x74,0x2e,0x6e,0x65,0x77,0x52,0x6f,0x77,0x28,0x65,0x29,0x29,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x6f,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x6f,0x77,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x72,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x22,0x20,0x2b,0x20,0x65,0x2e,0x6f,0x75,0x74,0x63,0x6f,0x6d,0x65,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x65,0x6c,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x6f,0x75,0x74,0x63,0x6f,0x6d,0x65,0x20,0x3d,0x20,0x65,0x2e,0x6f,0x75,0x74,0x63,0x6f,0x6d,0x65,0x20,0x2b,0x20,0x28,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x3f,0x20,0x22,0x20,0x28,0x22,0x20,0x2b,0x20,0x65,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x20,0x2b,0x20,0x22,0x29,0x22,0x20,0x3a,0x20,0x22,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x63,0x65,0x6c,0x6c,0x73,0x20,0x3d,0x20,0x5b,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x65,0x2e,0x61,0x74,0x29,0x2e,0x74,0x6f,0x4c,0x6f,0x63,0x61,0x6c,0x65,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x2c,0x20,0x65,0x2e,0x75,0x73,0x65,0x72,0x2c,0x20,0x65,0x2e,0x72,0x6f,0x6c,0x65,0x2c,0x20,0x65,0x2e,0x73,0x6f,0x75,0x72,0x63,0x65,0x2c,0x20,0x65,0x2e,0x61,0x63,0x74,0x69,0x6f,0x6e,0x2c,0x20,0x65,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x65,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x6f,0x75,0x74,0x63,0x6f,0x6d,0x65,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x63,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x64,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x64,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x64,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x63,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x3f,0x20,0x22,0x22,0x20,0x3a,0x20,0x63,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0xa, }, l)
+	r.ss["/js/pages/index.js"] = astibob.ContentHandle("/js/pages/index.js", []byte{ 0x6c,0x65,0x74,0x20,0x69,0x6e,0x64,0x65,0x78,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x30,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x20,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6e,0x69,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x43,0x72,0x61,0x73,0x68,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x43,0x72,0x61,0x73,0x68,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x44,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x52,0x65,0x67,0x69,0x73,0x74,0x65,0x72,0x65,0x64,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x4e,0x61,0x6d,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x6e,0x61,0x6d,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x72,0x65,0x61,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x43,0x72,0x61,0x73,0x68,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x63,0x72,0x61,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x72,0x61,0x73,0x68,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x72,0x61,0x73,0x68,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x64,0x61,0x74,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x70,0x6c,0x61,0x79,0x65,0x64,0x20,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x20,0x68,0x6f,0x6c,0x64,0x20,0x74,0x68,0x65,0x20,0x64,0x61,0x74,0x65,0x20,0x74,0x68,0x65,0x79,0x27,0x76,0x65,0x20,0x62,0x65,0x65,0x6e,0x20,0x73,0x65,0x6e,0x74,0x20,0x61,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x64,0x61,0x74,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x2d,0x64,0x61,0x74,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x61,0x74,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x3f,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x64,0x61,0x74,0x61,0x2e,0x61,0x74,0x29,0x20,0x3a,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x29,0x29,0x2e,0x74,0x6f,0x4c,0x6f,0x63,0x61,0x6c,0x65,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x72,0x61,0x73,0x68,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x64,0x61,0x74,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x2b,0x20,0x22,0x20,0x2f,0x20,0x22,0x20,0x2b,0x20,0x64,0x61,0x74,0x61,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x2b,0x20,0x22,0x3a,0x20,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x72,0x61,0x73,0x68,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x65,0x72,0x72,0x6f,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x73,0x70,0x61,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x2d,0x65,0x72,0x72,0x6f,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x2e,0x65,0x72,0x72,0x6f,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x72,0x61,0x73,0x68,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x65,0x72,0x72,0x6f,0x72,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x50,0x72,0x65,0x70,0x65,0x6e,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6c,0x69,0x73,0x74,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x2d,0x6c,0x69,0x73,0x74,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x69,0x73,0x74,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x42,0x65,0x66,0x6f,0x72,0x65,0x28,0x63,0x72,0x61,0x73,0x68,0x2c,0x20,0x6c,0x69,0x73,0x74,0x2e,0x66,0x69,0x72,0x73,0x74,0x43,0x68,0x69,0x6c,0x64,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x22,0x29,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x22,0x29,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x53,0x74,0x61,0x74,0x65,0x73,0x2e,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x74,0x69,0x74,0x6c,0x65,0x20,0x3d,0x20,0x22,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x69,0x73,0x20,0x75,0x6e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x69,0x76,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x20,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x70,0x61,0x6e,0x65,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x70,0x61,0x6e,0x65,0x6c,0x73,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x20,0x3c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x3b,0x20,0x6b,0x2b,0x2b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x6b,0x5d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x6d,0x6f,0x76,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6e,0x61,0x6d,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x65,0x74,0x63,0x68,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x3d,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x48,0x54,0x4d,0x4c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6d,0x6f,0x76,0x65,0x20,0x66,0x72,0x6f,0x6d,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x6c,0x65,0x74,0x65,0x28,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x5b,0x6e,0x61,0x6d,0x65,0x5d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x28,0x2d,0x31,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x57,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x65,0x6c,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x20,0x63,0x6f,0x75,0x6e,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x2b,0x3d,0x20,0x64,0x65,0x6c,0x74,0x61,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x69,0x64,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0x74,0x65,0x6d,0x73,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x41,0x6c,0x6c,0x28,0x22,0x2e,0x69,0x6e,0x64,0x65,0x78,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x64,0x65,0x78,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x73,0x43,0x6f,0x75,0x6e,0x74,0x20,0x3e,0x20,0x31,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0x20,0x69,0x74,0x65,0x6d,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x61,0x6c,0x72,0x65,0x61,0x64,0x79,0x20,0x65,0x78,0x69,0x73,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x20,0x3d,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x69,0x6e,0x20,0x61,0x6c,0x70,0x68,0x61,0x62,0x65,0x74,0x69,0x63,0x61,0x6c,0x20,0x6f,0x72,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x53,0x6f,0x72,0x74,0x65,0x64,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x70,0x61,0x6e,0x65,0x6c,0x73,0x2c,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2c,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0x20,0x74,0x6f,0x20,0x70,0x6f,0x6f,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x73,0x5b,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x5d,0x20,0x3d,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x65,0x73,0x75,0x6c,0x74,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x68,0x74,0x6d,0x6c,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x74,0x61,0x74,0x75,0x73,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x3a,0x20,0x64,0x61,0x74,0x61,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x5f,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x70,0x61,0x6e,0x65,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x70,0x61,0x6e,0x65,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x6e,0x65,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x70,0x61,0x6e,0x65,0x6c,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x6c,0x69,0x6e,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6c,0x69,0x6e,0x6b,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x61,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x69,0x6e,0x6b,0x2e,0x68,0x72,0x65,0x66,0x20,0x3d,0x20,0x72,0x2e,0x77,0x65,0x62,0x5f,0x68,0x6f,0x6d,0x65,0x70,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x69,0x6e,0x6b,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x70,0x61,0x6e,0x65,0x6c,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x6c,0x69,0x6e,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x65,0x6c,0x73,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x2e,0x68,0x74,0x6d,0x6c,0x2e,0x77,0x72,0x61,0x70,0x70,0x65,0x72,0x20,0x3d,0x20,0x70,0x61,0x6e,0x65,0x6c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x74,0x69,0x74,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x6e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x61,0x6d,0x65,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x6e,0x65,0x6c,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x6e,0x61,0x6d,0x65,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x63,0x65,0x6c,0x6c,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x64,0x69,0x76,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x72,0x2e,0x64,0x65,0x73,0x63,0x72,0x69,0x70,0x74,0x69,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x6e,0x65,0x6c,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x63,0x65,0x6c,0x6c,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0x3b, }, l)
+	r.ss["/js/pages/inspector.js"] = astibob.ContentHandle("/js/pages/inspector.js", []byte{ 0x6c,0x65,0x74,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x74,0x74,0x72,0x69,0x62,0x75,0x74,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x3a,0x20,0x7b,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x78,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x3a,0x20,0x31,0x30,0x30,0x30,0x2c,0xa,0x20,0x20,0x20,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x3a,0x20,0x5b,0x5d,0x2c,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x75,0x73,0x65,0x64,0x3a,0x20,0x66,0x61,0x6c,0x73,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x3a,0x20,0x5b,0x5d,0x2c,0xa,0x20,0x20,0x20,0x20,0x70,0x72,0x65,0x74,0x74,0x79,0x3a,0x20,0x66,0x61,0x6c,0x73,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x6f,0x77,0x73,0x3a,0x20,0x6e,0x65,0x77,0x20,0x4d,0x61,0x70,0x28,0x29,0x2c,0x20,0x2f,0x2f,0x20,0x52,0x6f,0x77,0x73,0x20,0x69,0x6e,0x64,0x65,0x78,0x65,0x64,0x20,0x62,0x79,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x41,0x6c,0x6c,0x28,0x22,0x69,0x6e,0x70,0x75,0x74,0x5b,0x69,0x64,0x5e,0x3d,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x2d,0x5d,0x22,0x29,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x74,0x65,0x6d,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x74,0x65,0x6d,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x69,0x6e,0x70,0x75,0x74,0x22,0x2c,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6f,0x6e,0x46,0x69,0x6c,0x74,0x65,0x72,0x73,0x43,0x68,0x61,0x6e,0x67,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x70,0x72,0x65,0x74,0x74,0x79,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x68,0x61,0x6e,0x67,0x65,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x72,0x65,0x74,0x74,0x79,0x20,0x3d,0x20,0x74,0x68,0x69,0x73,0x2e,0x63,0x68,0x65,0x63,0x6b,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x70,0x61,0x75,0x73,0x65,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x74,0x6f,0x67,0x67,0x6c,0x65,0x50,0x61,0x75,0x73,0x65,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6c,0x65,0x61,0x72,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x63,0x6c,0x65,0x61,0x72,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x65,0x78,0x70,0x6f,0x72,0x74,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x65,0x78,0x70,0x6f,0x72,0x74,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x62,0x61,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x47,0x65,0x74,0x20,0x72,0x65,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x72,0x65,0x66,0x65,0x72,0x65,0x6e,0x63,0x65,0x73,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x28,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x5f,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x57,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x77,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x73,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x57,0x65,0x62,0x53,0x6f,0x63,0x6b,0x65,0x74,0x28,0x77,0x73,0x2e,0x61,0x64,0x64,0x72,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x54,0x68,0x65,0x20,0x69,0x6e,0x64,0x65,0x78,0x20,0x6f,0x6e,0x6c,0x79,0x20,0x6e,0x65,0x65,0x64,0x73,0x20,0x74,0x6f,0x20,0x62,0x65,0x20,0x70,0x69,0x6e,0x67,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x50,0x69,0x6e,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x2e,0x6f,0x6e,0x6f,0x70,0x65,0x6e,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x50,0x69,0x6e,0x67,0x20,0x3d,0x20,0x73,0x65,0x74,0x49,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x73,0x2e,0x73,0x65,0x6e,0x64,0x28,0x22,0x70,0x69,0x6e,0x67,0x22,0x29,0x20,0x7d,0x2c,0x20,0x77,0x73,0x2e,0x70,0x69,0x6e,0x67,0x5f,0x70,0x65,0x72,0x69,0x6f,0x64,0x20,0x2f,0x20,0x31,0x65,0x36,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x2e,0x6f,0x6e,0x63,0x6c,0x6f,0x73,0x65,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6c,0x65,0x61,0x72,0x49,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x28,0x69,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x50,0x69,0x6e,0x67,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x74,0x54,0x69,0x6d,0x65,0x6f,0x75,0x74,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x28,0x77,0x73,0x29,0x20,0x7d,0x2c,0x20,0x31,0x30,0x30,0x30,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x2e,0x6f,0x6e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x76,0x65,0x6e,0x74,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x4a,0x53,0x4f,0x4e,0x2e,0x70,0x61,0x72,0x73,0x65,0x28,0x65,0x76,0x65,0x6e,0x74,0x2e,0x64,0x61,0x74,0x61,0x29,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x61,0x72,0x65,0x20,0x6b,0x65,0x70,0x74,0x20,0x61,0x73,0x69,0x64,0x65,0x20,0x77,0x68,0x69,0x6c,0x65,0x20,0x70,0x61,0x75,0x73,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x75,0x73,0x65,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x2e,0x70,0x75,0x73,0x68,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x20,0x3e,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x61,0x78,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x29,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x2e,0x73,0x68,0x69,0x66,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x61,0x64,0x64,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0xa,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x70,0x70,0x65,0x6e,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x2e,0x70,0x75,0x73,0x68,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4f,0x6e,0x6c,0x79,0x20,0x6b,0x65,0x65,0x70,0x20,0x74,0x68,0x65,0x20,0x6c,0x61,0x74,0x65,0x73,0x74,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x20,0x3e,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x61,0x78,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x29,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x52,0x6f,0x77,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x2e,0x73,0x68,0x69,0x66,0x74,0x28,0x29,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x72,0x6f,0x77,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x64,0x61,0x74,0x61,0x29,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x74,0x62,0x6f,0x64,0x79,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x69,0x6e,0x73,0x65,0x72,0x74,0x42,0x65,0x66,0x6f,0x72,0x65,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6e,0x65,0x77,0x52,0x6f,0x77,0x28,0x64,0x61,0x74,0x61,0x29,0x2c,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x66,0x69,0x72,0x73,0x74,0x43,0x68,0x69,0x6c,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x6d,0x6f,0x76,0x65,0x52,0x6f,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x72,0x6f,0x77,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x6f,0x77,0x73,0x2e,0x67,0x65,0x74,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x72,0x6f,0x77,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x6f,0x77,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x6f,0x77,0x73,0x2e,0x64,0x65,0x6c,0x65,0x74,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x6f,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x6f,0x77,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x72,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x64,0x61,0x74,0x61,0x2e,0x73,0x6f,0x75,0x72,0x63,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x6d,0x69,0x72,0x72,0x6f,0x72,0x22,0x29,0x20,0x74,0x72,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x69,0x72,0x72,0x6f,0x72,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x65,0x6c,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x63,0x65,0x6c,0x6c,0x73,0x20,0x3d,0x20,0x5b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x64,0x61,0x74,0x61,0x2e,0x61,0x74,0x29,0x2e,0x74,0x6f,0x49,0x53,0x4f,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x61,0x2e,0x73,0x6f,0x75,0x72,0x63,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x66,0x72,0x6f,0x6d,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x74,0x6f,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x63,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x64,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x64,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x64,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x63,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x74,0x6f,0x72,0x65,0x20,0x72,0x6f,0x77,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x6f,0x77,0x73,0x2e,0x73,0x65,0x74,0x28,0x64,0x61,0x74,0x61,0x2c,0x20,0x74,0x72,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x6e,0x64,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x45,0x6d,0x70,0x74,0x79,0x20,0x74,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x74,0x62,0x6f,0x64,0x79,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x22,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x6f,0x77,0x73,0x2e,0x63,0x6c,0x65,0x61,0x72,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x66,0x6f,0x72,0x20,0x28,0x6c,0x65,0x74,0x20,0x6b,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x20,0x2d,0x20,0x31,0x3b,0x20,0x6b,0x20,0x3e,0x3d,0x20,0x30,0x3b,0x20,0x6b,0x2d,0x2d,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x5b,0x6b,0x5d,0x29,0x29,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6e,0x65,0x77,0x52,0x6f,0x77,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x5b,0x6b,0x5d,0x29,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x75,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x75,0x6e,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x20,0x2b,0x20,0x22,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x73,0x29,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x20,0x3e,0x20,0x30,0x29,0x20,0x74,0x20,0x2b,0x3d,0x20,0x22,0x2c,0x20,0x22,0x20,0x2b,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x2e,0x6c,0x65,0x6e,0x67,0x74,0x68,0x20,0x2b,0x20,0x22,0x20,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x75,0x6e,0x74,0x22,0x29,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x74,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x69,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x7c,0x7c,0x20,0x69,0x20,0x3d,0x3d,0x3d,0x20,0x6e,0x75,0x6c,0x6c,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x77,0x69,0x74,0x63,0x68,0x20,0x28,0x69,0x2e,0x74,0x79,0x70,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x2b,0x20,0x22,0x2f,0x22,0x20,0x2b,0x20,0x69,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x75,0x69,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x61,0x73,0x65,0x20,0x63,0x6f,0x6e,0x73,0x74,0x73,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x54,0x79,0x70,0x65,0x73,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x69,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x6e,0x61,0x6d,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x69,0x2e,0x74,0x79,0x70,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x70,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x70,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x72,0x65,0x74,0x74,0x79,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x70,0x2c,0x20,0x6e,0x75,0x6c,0x6c,0x2c,0x20,0x32,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x70,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x46,0x69,0x6c,0x74,0x65,0x72,0x73,0xa,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x46,0x69,0x6c,0x74,0x65,0x72,0x73,0x43,0x68,0x61,0x6e,0x67,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x20,0x3d,0x20,0x7b,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x6b,0x73,0x20,0x3d,0x20,0x5b,0x22,0x6e,0x61,0x6d,0x65,0x22,0x2c,0x20,0x22,0x66,0x72,0x6f,0x6d,0x22,0x2c,0x20,0x22,0x74,0x6f,0x22,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6b,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x76,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x2d,0x22,0x20,0x2b,0x20,0x6b,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0x2e,0x74,0x72,0x69,0x6d,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x76,0x20,0x21,0x3d,0x3d,0x20,0x22,0x22,0x29,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x5b,0x6b,0x5d,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x74,0x74,0x65,0x72,0x6e,0x28,0x76,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x6e,0x64,0x65,0x72,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x70,0x61,0x74,0x74,0x65,0x72,0x6e,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x76,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x50,0x61,0x74,0x74,0x65,0x72,0x6e,0x73,0x20,0x6d,0x61,0x79,0x20,0x63,0x6f,0x6e,0x74,0x61,0x69,0x6e,0x20,0x77,0x69,0x6c,0x64,0x63,0x61,0x72,0x64,0x73,0x20,0x28,0x65,0x2e,0x67,0x2e,0x20,0x22,0x61,0x75,0x64,0x69,0x6f,0x5f,0x69,0x6e,0x70,0x75,0x74,0x2e,0x2a,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x6e,0x65,0x77,0x20,0x52,0x65,0x67,0x45,0x78,0x70,0x28,0x22,0x5e,0x22,0x20,0x2b,0x20,0x76,0x2e,0x73,0x70,0x6c,0x69,0x74,0x28,0x22,0x2a,0x22,0x29,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x73,0x2e,0x72,0x65,0x70,0x6c,0x61,0x63,0x65,0x28,0x2f,0x5b,0x2e,0x2b,0x3f,0x5e,0x24,0x7b,0x7d,0x28,0x29,0x7c,0x5b,0x5c,0x5d,0x5c,0x5c,0x5d,0x2f,0x67,0x2c,0x20,0x22,0x5c,0x5c,0x24,0x26,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x2e,0x2a,0x22,0x29,0x20,0x2b,0x20,0x22,0x24,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6d,0x61,0x74,0x63,0x68,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x66,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x6e,0x61,0x6d,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x21,0x66,0x2e,0x6e,0x61,0x6d,0x65,0x2e,0x74,0x65,0x73,0x74,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x6e,0x61,0x6d,0x65,0x29,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x61,0x6c,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x66,0x72,0x6f,0x6d,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x21,0x66,0x2e,0x66,0x72,0x6f,0x6d,0x2e,0x74,0x65,0x73,0x74,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x66,0x72,0x6f,0x6d,0x29,0x29,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x61,0x6c,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x66,0x2e,0x74,0x6f,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x20,0x26,0x26,0x20,0x21,0x66,0x2e,0x74,0x6f,0x2e,0x74,0x65,0x73,0x74,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x69,0x64,0x65,0x6e,0x74,0x69,0x66,0x69,0x65,0x72,0x28,0x64,0x61,0x74,0x61,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x2e,0x74,0x6f,0x29,0x29,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x66,0x61,0x6c,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x72,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0xa,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0xa,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x67,0x67,0x6c,0x65,0x50,0x61,0x75,0x73,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x55,0x70,0x64,0x61,0x74,0x65,0x20,0x73,0x74,0x61,0x74,0x75,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x75,0x73,0x65,0x64,0x20,0x3d,0x20,0x21,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x75,0x73,0x65,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x68,0x69,0x73,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x75,0x73,0x65,0x64,0x20,0x3f,0x20,0x22,0x52,0x65,0x73,0x75,0x6d,0x65,0x22,0x20,0x3a,0x20,0x22,0x50,0x61,0x75,0x73,0x65,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x21,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x61,0x75,0x73,0x65,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x61,0x64,0x64,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x20,0x3d,0x20,0x5b,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x63,0x6c,0x65,0x61,0x72,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x3d,0x20,0x5b,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x70,0x65,0x6e,0x64,0x69,0x6e,0x67,0x20,0x3d,0x20,0x5b,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x72,0x65,0x6e,0x64,0x65,0x72,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x75,0x70,0x64,0x61,0x74,0x65,0x43,0x6f,0x75,0x6e,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x65,0x78,0x70,0x6f,0x72,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x4a,0x53,0x4f,0x4e,0x4c,0x20,0x77,0x69,0x74,0x68,0x20,0x74,0x68,0x65,0x20,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x20,0x6d,0x61,0x74,0x63,0x68,0x69,0x6e,0x67,0x20,0x74,0x68,0x65,0x20,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x6c,0x69,0x6e,0x65,0x73,0x20,0x3d,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x2e,0x66,0x69,0x6c,0x74,0x65,0x72,0x28,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6d,0x61,0x74,0x63,0x68,0x29,0x2e,0x6d,0x61,0x70,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x62,0x6c,0x6f,0x62,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x42,0x6c,0x6f,0x62,0x28,0x5b,0x6c,0x69,0x6e,0x65,0x73,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x22,0x5c,0x6e,0x22,0x29,0x20,0x2b,0x20,0x22,0x5c,0x6e,0x22,0x5d,0x2c,0x20,0x7b,0x74,0x79,0x70,0x65,0x3a,0x20,0x22,0x61,0x70,0x70,0x6c,0x69,0x63,0x61,0x74,0x69,0x6f,0x6e,0x2f,0x78,0x2d,0x6e,0x64,0x6a,0x73,0x6f,0x6e,0x22,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x44,0x6f,0x77,0x6e,0x6c,0x6f,0x61,0x64,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x61,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x61,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x2e,0x68,0x72,0x65,0x66,0x20,0x3d,0x20,0x55,0x52,0x4c,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x4f,0x62,0x6a,0x65,0x63,0x74,0x55,0x52,0x4c,0x28,0x62,0x6c,0x6f,0x62,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x2e,0x64,0x6f,0x77,0x6e,0x6c,0x6f,0x61,0x64,0x20,0x3d,0x20,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x22,0x20,0x2b,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x29,0x2e,0x74,0x6f,0x49,0x53,0x4f,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x20,0x2b,0x20,0x22,0x2e,0x6a,0x73,0x6f,0x6e,0x6c,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x62,0x6f,0x64,0x79,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x2e,0x63,0x6c,0x69,0x63,0x6b,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x2e,0x72,0x65,0x6d,0x6f,0x76,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x55,0x52,0x4c,0x2e,0x72,0x65,0x76,0x6f,0x6b,0x65,0x4f,0x62,0x6a,0x65,0x63,0x74,0x55,0x52,0x4c,0x28,0x61,0x2e,0x68,0x72,0x65,0x66,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0xa, }, l)
+	r.ss["/js/pages/login.js"] = astibob.ContentHandle("/js/pages/login.js", []byte{ 0x6c,0x65,0x74,0x20,0x6c,0x6f,0x67,0x69,0x6e,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x61,0x73,0x74,0x69,0x74,0x6f,0x6f,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6e,0x6f,0x74,0x69,0x66,0x69,0x65,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x6c,0x6f,0x67,0x69,0x6e,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x2e,0x70,0x72,0x65,0x76,0x65,0x6e,0x74,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x6f,0x67,0x69,0x6e,0x2e,0x73,0x75,0x62,0x6d,0x69,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x6c,0x6f,0x67,0x69,0x6e,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x50,0x4f,0x53,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x73,0x73,0x77,0x6f,0x72,0x64,0x3a,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x6c,0x6f,0x67,0x69,0x6e,0x2d,0x70,0x61,0x73,0x73,0x77,0x6f,0x72,0x64,0x22,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x6c,0x6f,0x67,0x69,0x6e,0x2d,0x75,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x22,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6c,0x6f,0x63,0x61,0x74,0x69,0x6f,0x6e,0x2e,0x68,0x72,0x65,0x66,0x20,0x3d,0x20,0x6c,0x6f,0x67,0x69,0x6e,0x2e,0x72,0x65,0x64,0x69,0x72,0x65,0x63,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x64,0x69,0x72,0x65,0x63,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4f,0x6e,0x6c,0x79,0x20,0x72,0x65,0x64,0x69,0x72,0x65,0x63,0x74,0x20,0x74,0x6f,0x20,0x70,0x61,0x74,0x68,0x73,0x20,0x6f,0x66,0x20,0x74,0x68,0x65,0x20,0x69,0x6e,0x64,0x65,0x78,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x42,0x72,0x6f,0x77,0x73,0x65,0x72,0x73,0x20,0x74,0x72,0x65,0x61,0x74,0x20,0x22,0x5c,0x22,0x20,0x61,0x73,0x20,0x22,0x2f,0x22,0x20,0x61,0x6e,0x64,0x20,0x73,0x74,0x72,0x69,0x70,0x20,0x74,0x61,0x62,0x73,0x20,0x61,0x6e,0x64,0x20,0x6e,0x65,0x77,0x20,0x6c,0x69,0x6e,0x65,0x73,0x2c,0x20,0x74,0x68,0x65,0x72,0x65,0x66,0x6f,0x72,0x65,0x20,0x22,0x2f,0x5c,0x65,0x76,0x69,0x6c,0x2e,0x63,0x6f,0x6d,0x22,0x20,0x77,0x6f,0x75,0x6c,0x64,0x20,0x6c,0x65,0x61,0x76,0x65,0x20,0x74,0x68,0x65,0x20,0x69,0x6e,0x64,0x65,0x78,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x72,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x55,0x52,0x4c,0x53,0x65,0x61,0x72,0x63,0x68,0x50,0x61,0x72,0x61,0x6d,0x73,0x28,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6c,0x6f,0x63,0x61,0x74,0x69,0x6f,0x6e,0x2e,0x73,0x65,0x61,0x72,0x63,0x68,0x29,0x2e,0x67,0x65,0x74,0x28,0x22,0x72,0x65,0x64,0x69,0x72,0x65,0x63,0x74,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x72,0x20,0x3d,0x3d,0x3d,0x20,0x6e,0x75,0x6c,0x6c,0x20,0x7c,0x7c,0x20,0x21,0x72,0x2e,0x73,0x74,0x61,0x72,0x74,0x73,0x57,0x69,0x74,0x68,0x28,0x22,0x2f,0x22,0x29,0x20,0x7c,0x7c,0x20,0x2f,0x5b,0x5c,0x5c,0x5c,0x73,0x5d,0x2f,0x2e,0x74,0x65,0x73,0x74,0x28,0x72,0x29,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x2f,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4d,0x61,0x6b,0x65,0x20,0x73,0x75,0x72,0x65,0x20,0x74,0x68,0x65,0x20,0x75,0x72,0x6c,0x20,0x72,0x65,0x73,0x6f,0x6c,0x76,0x65,0x73,0x20,0x74,0x6f,0x20,0x74,0x68,0x65,0x20,0x69,0x6e,0x64,0x65,0x78,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x75,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x79,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x55,0x52,0x4c,0x28,0x72,0x2c,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6c,0x6f,0x63,0x61,0x74,0x69,0x6f,0x6e,0x2e,0x6f,0x72,0x69,0x67,0x69,0x6e,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x20,0x63,0x61,0x74,0x63,0x68,0x20,0x28,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x2f,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x75,0x2e,0x6f,0x72,0x69,0x67,0x69,0x6e,0x20,0x21,0x3d,0x3d,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6c,0x6f,0x63,0x61,0x74,0x69,0x6f,0x6e,0x2e,0x6f,0x72,0x69,0x67,0x69,0x6e,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x22,0x2f,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x75,0x2e,0x70,0x61,0x74,0x68,0x6e,0x61,0x6d,0x65,0x20,0x2b,0x20,0x75,0x2e,0x73,0x65,0x61,0x72,0x63,0x68,0x20,0x2b,0x20,0x75,0x2e,0x68,0x61,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0xa, }, l)
+	r.ss["/js/pages/tokens.js"] = astibob.ContentHandle("/js/pages/tokens.js", []byte{ 0x6c,0x65,0x74,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x48,0x61,0x6e,0x64,0x6c,0x65,0x20,0x73,0x75,0x62,0x6d,0x69,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x61,0x64,0x64,0x22,0x29,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x2e,0x70,0x72,0x65,0x76,0x65,0x6e,0x74,0x44,0x65,0x66,0x61,0x75,0x6c,0x74,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x61,0x64,0x64,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x62,0x61,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x61,0x73,0x65,0x2e,0x69,0x6e,0x69,0x74,0x28,0x7b,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6f,0x6e,0x4c,0x6f,0x61,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x6c,0x69,0x73,0x74,0x28,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6c,0x69,0x73,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x47,0x45,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x45,0x6d,0x70,0x74,0x79,0x20,0x74,0x61,0x62,0x6c,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x74,0x62,0x6f,0x64,0x79,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x22,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x4c,0x6f,0x6f,0x70,0x20,0x74,0x68,0x72,0x6f,0x75,0x67,0x68,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x20,0x7b,0x20,0x74,0x62,0x6f,0x64,0x79,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x6e,0x65,0x77,0x52,0x6f,0x77,0x28,0x74,0x29,0x29,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x63,0x61,0x6c,0x6c,0x62,0x61,0x63,0x6b,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x6e,0x65,0x77,0x52,0x6f,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x72,0x65,0x61,0x74,0x65,0x20,0x72,0x6f,0x77,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x72,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x72,0x22,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x63,0x65,0x6c,0x6c,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x63,0x65,0x6c,0x6c,0x73,0x20,0x3d,0x20,0x5b,0x74,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x2c,0x20,0x74,0x2e,0x69,0x64,0x2c,0x20,0x6e,0x65,0x77,0x20,0x44,0x61,0x74,0x65,0x28,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x5f,0x61,0x74,0x29,0x2e,0x74,0x6f,0x4c,0x6f,0x63,0x61,0x6c,0x65,0x53,0x74,0x72,0x69,0x6e,0x67,0x28,0x29,0x5d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x65,0x6c,0x6c,0x73,0x2e,0x66,0x6f,0x72,0x45,0x61,0x63,0x68,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x63,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x64,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x64,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x64,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x63,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x41,0x64,0x64,0x20,0x72,0x65,0x76,0x6f,0x6b,0x65,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x74,0x64,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x74,0x64,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x3d,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x72,0x65,0x61,0x74,0x65,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x28,0x22,0x62,0x75,0x74,0x74,0x6f,0x6e,0x22,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0x2e,0x63,0x6c,0x61,0x73,0x73,0x4e,0x61,0x6d,0x65,0x20,0x3d,0x20,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x61,0x6e,0x67,0x65,0x72,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x22,0x52,0x65,0x76,0x6f,0x6b,0x65,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x62,0x75,0x74,0x74,0x6f,0x6e,0x2e,0x61,0x64,0x64,0x45,0x76,0x65,0x6e,0x74,0x4c,0x69,0x73,0x74,0x65,0x6e,0x65,0x72,0x28,0x22,0x63,0x6c,0x69,0x63,0x6b,0x22,0x2c,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x72,0x65,0x76,0x6f,0x6b,0x65,0x28,0x74,0x29,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x64,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x62,0x75,0x74,0x74,0x6f,0x6e,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x2e,0x61,0x70,0x70,0x65,0x6e,0x64,0x43,0x68,0x69,0x6c,0x64,0x28,0x74,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0x20,0x74,0x72,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x61,0x64,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x50,0x4f,0x53,0x54,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x7b,0x77,0x6f,0x72,0x6b,0x65,0x72,0x3a,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0x7d,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x53,0x68,0x6f,0x77,0x20,0x74,0x6f,0x6b,0x65,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x2d,0x76,0x61,0x6c,0x75,0x65,0x22,0x29,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x54,0x65,0x78,0x74,0x20,0x3d,0x20,0x64,0x61,0x74,0x61,0x2e,0x72,0x65,0x73,0x70,0x6f,0x6e,0x73,0x65,0x4a,0x53,0x4f,0x4e,0x2e,0x74,0x6f,0x6b,0x65,0x6e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x22,0x29,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x71,0x75,0x65,0x72,0x79,0x53,0x65,0x6c,0x65,0x63,0x74,0x6f,0x72,0x28,0x22,0x23,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x29,0x2e,0x76,0x61,0x6c,0x75,0x65,0x20,0x3d,0x20,0x22,0x22,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x66,0x72,0x65,0x73,0x68,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x6c,0x69,0x73,0x74,0x28,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x72,0x65,0x76,0x6f,0x6b,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x74,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x43,0x6f,0x6e,0x66,0x69,0x72,0x6d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x21,0x63,0x6f,0x6e,0x66,0x69,0x72,0x6d,0x28,0x22,0x52,0x65,0x76,0x6f,0x6b,0x65,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x20,0x22,0x20,0x2b,0x20,0x74,0x2e,0x69,0x64,0x20,0x2b,0x20,0x22,0x20,0x6f,0x66,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x22,0x20,0x2b,0x20,0x74,0x2e,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x2b,0x20,0x22,0x3f,0x20,0x54,0x68,0x65,0x20,0x77,0x6f,0x72,0x6b,0x65,0x72,0x20,0x77,0x69,0x6c,0x6c,0x20,0x62,0x65,0x20,0x64,0x69,0x73,0x63,0x6f,0x6e,0x6e,0x65,0x63,0x74,0x65,0x64,0x2e,0x22,0x29,0x29,0x20,0x72,0x65,0x74,0x75,0x72,0x6e,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x52,0x65,0x76,0x6f,0x6b,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x68,0x6f,0x77,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x75,0x72,0x6c,0x3a,0x20,0x22,0x2f,0x61,0x70,0x69,0x2f,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2f,0x22,0x20,0x2b,0x20,0x65,0x6e,0x63,0x6f,0x64,0x65,0x55,0x52,0x49,0x43,0x6f,0x6d,0x70,0x6f,0x6e,0x65,0x6e,0x74,0x28,0x74,0x2e,0x69,0x64,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6d,0x65,0x74,0x68,0x6f,0x64,0x3a,0x20,0x22,0x44,0x45,0x4c,0x45,0x54,0x45,0x22,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x65,0x72,0x72,0x6f,0x72,0x3a,0x20,0x62,0x61,0x73,0x65,0x2e,0x68,0x74,0x74,0x70,0x45,0x72,0x72,0x6f,0x72,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x6c,0x69,0x73,0x74,0x28,0x62,0x61,0x73,0x65,0x2e,0x66,0x69,0x6e,0x69,0x73,0x68,0x29,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x7d,0xa, }, l)
 	r.ss["/lib/astiloader/astiloader.css"] = astibob.ContentHandle("/lib/astiloader/astiloader.css", []byte{ 0x2e,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x66,0x66,0x66,0x3b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x6e,0x6f,0x6e,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x7a,0x2d,0x69,0x6e,0x64,0x65,0x78,0x3a,0x20,0x31,0x3b,0xa,0x7d,0xa,0x2e,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x2d,0x63,0x6f,0x6c,0x6f,0x72,0x3a,0x20,0x23,0x30,0x30,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x6f,0x70,0x61,0x63,0x69,0x74,0x79,0x3a,0x20,0x30,0x2e,0x37,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0x2e,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x74,0x61,0x62,0x6c,0x65,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x6c,0x65,0x66,0x74,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x70,0x6f,0x73,0x69,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x62,0x73,0x6f,0x6c,0x75,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x70,0x3a,0x20,0x30,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0x2e,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x3a,0x20,0x74,0x61,0x62,0x6c,0x65,0x2d,0x63,0x65,0x6c,0x6c,0x3b,0xa,0x20,0x20,0x20,0x20,0x68,0x65,0x69,0x67,0x68,0x74,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x20,0x20,0x20,0x20,0x74,0x65,0x78,0x74,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x63,0x65,0x6e,0x74,0x65,0x72,0x3b,0xa,0x20,0x20,0x20,0x20,0x76,0x65,0x72,0x74,0x69,0x63,0x61,0x6c,0x2d,0x61,0x6c,0x69,0x67,0x6e,0x3a,0x20,0x6d,0x69,0x64,0x64,0x6c,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x31,0x30,0x30,0x25,0x3b,0xa,0x7d,0xa,0x40,0x6b,0x65,0x79,0x66,0x72,0x61,0x6d,0x65,0x73,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2d,0x73,0x70,0x69,0x6e,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x30,0x25,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x30,0x64,0x65,0x67,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x30,0x64,0x65,0x67,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x74,0x6f,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2d,0x77,0x65,0x62,0x6b,0x69,0x74,0x2d,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x31,0x74,0x75,0x72,0x6e,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x72,0x61,0x6e,0x73,0x66,0x6f,0x72,0x6d,0x3a,0x72,0x6f,0x74,0x61,0x74,0x65,0x28,0x31,0x74,0x75,0x72,0x6e,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0xa,0x2e,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x20,0x69,0x6d,0x67,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x61,0x6e,0x69,0x6d,0x61,0x74,0x69,0x6f,0x6e,0x3a,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2d,0x73,0x70,0x69,0x6e,0x20,0x32,0x73,0x20,0x6c,0x69,0x6e,0x65,0x61,0x72,0x20,0x69,0x6e,0x66,0x69,0x6e,0x69,0x74,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x77,0x69,0x64,0x74,0x68,0x3a,0x20,0x35,0x65,0x6d,0x3b,0xa,0x7d, }, l)
 	r.ss["/lib/astiloader/astiloader.js"] = astibob.ContentHandle("/lib/astiloader/astiloader.js", []byte{ 0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x76,0x61,0x72,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x20,0x3d,0x20,0x7b,0x7d,0x3b,0xa,0x7d,0xa,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x73,0x63,0x72,0x69,0x70,0x74,0x44,0x69,0x72,0x3a,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x53,0x63,0x72,0x69,0x70,0x74,0x2e,0x73,0x72,0x63,0x2e,0x6d,0x61,0x74,0x63,0x68,0x28,0x2f,0x2e,0x2a,0x5c,0x2f,0x2f,0x29,0x2c,0xa,0x20,0x20,0x20,0x20,0x68,0x69,0x64,0x65,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x22,0x29,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x6e,0x6f,0x6e,0x65,0x22,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x62,0x6f,0x64,0x79,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0x20,0x3d,0x20,0x60,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x62,0x61,0x63,0x6b,0x67,0x72,0x6f,0x75,0x6e,0x64,0x22,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x74,0x61,0x62,0x6c,0x65,0x22,0x3e,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x65,0x6e,0x74,0x22,0x3e,0x3c,0x69,0x6d,0x67,0x20,0x73,0x72,0x63,0x3d,0x22,0x60,0x20,0x2b,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x73,0x63,0x72,0x69,0x70,0x74,0x44,0x69,0x72,0x20,0x2b,0x20,0x60,0x2f,0x6c,0x6f,0x61,0x64,0x65,0x72,0x2e,0x70,0x6e,0x67,0x22,0x2f,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x60,0x20,0x2b,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x62,0x6f,0x64,0x79,0x2e,0x69,0x6e,0x6e,0x65,0x72,0x48,0x54,0x4d,0x4c,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x68,0x6f,0x77,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x64,0x6f,0x63,0x75,0x6d,0x65,0x6e,0x74,0x2e,0x67,0x65,0x74,0x45,0x6c,0x65,0x6d,0x65,0x6e,0x74,0x42,0x79,0x49,0x64,0x28,0x22,0x61,0x73,0x74,0x69,0x6c,0x6f,0x61,0x64,0x65,0x72,0x22,0x29,0x2e,0x73,0x74,0x79,0x6c,0x65,0x2e,0x64,0x69,0x73,0x70,0x6c,0x61,0x79,0x20,0x3d,0x20,0x22,0x62,0x6c,0x6f,0x63,0x6b,0x22,0x3b,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d,0x3b, }, l)
 	r.ss["/lib/astiloader/loader.png"] = astibob.ContentHandle("/lib/astiloader/loader.png", []byte{ 0x89,0x50,0x4e,0x47,0xd,0xa,0x1a,0xa,0x0,0x0,0x0,0xd,0x49,0x48,0x44,0x52,0x0,0x0,0x0,0x40,0x0,0x0,0x0,0x40,0x8,0x6,0x0,0x0,0x0,0xaa,0x69,0x71,0xde,0x0,0x0,0x0,0x9,0x70,0x48,0x59,0x73,0x0,0x0,0xb,0x13,0x0,0x0,0xb,0x13,0x1,0x0,0x9a,0x9c,0x18,0x0,0x0,0xa,0x4f,0x69,0x43,0x43,0x50,0x50,0x68,0x6f,0x74,0x6f,0x73,0x68,0x6f,0x70,0x20,0x49,0x43,0x43,0x20,0x70,0x72,0x6f,0x66,0x69,0x6c,0x65,0x0,0x0,0x78,0xda,0x9d,0x53,0x67,0x54,0x53,0xe9,0x16,0x3d,0xf7,0xde,0xf4,0x42,0x4b,0x88,0x80,0x94,0x4b,0x6f,0x52,0x15,0x8,0x20,0x52,0x42,0x8b,0x80,0x14,0x91,0x26,0x2a,0x21,0x9,0x10,0x4a,0x88,0x21,0xa1,0xd9,0x15,0x51,0xc1,0x11,0x45,0x45,0x4,0x1b,0xc8,0xa0,0x88,0x3,0x8e,0x8e,0x80,0x8c,0x15,0x51,0x2c,0xc,0x8a,0xa,0xd8,0x7,0xe4,0x21,0xa2,0x8e,0x83,0xa3,0x88,0x8a,0xca,0xfb,0xe1,0x7b,0xa3,0x6b,0xd6,0xbc,0xf7,0xe6,0xcd,0xfe,0xb5,0xd7,0x3e,0xe7,0xac,0xf3,0x9d,0xb3,0xcf,0x7,0xc0,0x8,0xc,0x96,0x48,0x33,0x51,0x35,0x80,0xc,0xa9,0x42,0x1e,0x11,0xe0,0x83,0xc7,0xc4,0xc6,0xe1,0xe4,0x2e,0x40,0x81,0xa,0x24,0x70,0x0,0x10,0x8,0xb3,0x64,0x21,0x73,0xfd,0x23,0x1,0x0,0xf8,0x7e,0x3c,0x3c,0x2b,0x22,0xc0,0x7,0xbe,0x0,0x1,0x78,0xd3,0xb,0x8,0x0,0xc0,0x4d,0x9b,0xc0,0x30,0x1c,0x87,0xff,0xf,0xea,0x42,0x99,0x5c,0x1,0x80,0x84,0x1,0xc0,0x74,0x91,0x38,0x4b,0x8,0x80,0x14,0x0,0x40,0x7a,0x8e,0x42,0xa6,0x0,0x40,0x46,0x1,0x80,0x9d,0x98,0x26,0x53,0x0,0xa0,0x4,0x0,0x60,0xcb,0x63,0x62,0xe3,0x0,0x50,0x2d,0x0,0x60,0x27,0x7f,0xe6,0xd3,0x0,0x80,0x9d,0xf8,0x99,0x7b,0x1,0x0,0x5b,0x94,0x21,0x15,0x1,0xa0,0x91,0x0,0x20,0x13,0x65,0x88,0x44,0x0,0x68,0x3b,0x0,0xac,0xcf,0x56,0x8a,0x45,0x0,0x58,0x30,0x0,0x14,0x66,0x4b,0xc4,0x39,0x0,0xd8,0x2d,0x0,0x30,0x49,0x57,0x66,0x48,0x0,0xb0,0xb7,0x0,0xc0,0xce,0x10,0xb,0xb2,0x0,0x8,0xc,0x0,0x30,0x51,0x88,0x85,0x29,0x0,0x4,0x7b,0x0,0x60,0xc8,0x23,0x23,0x78,0x0,0x84,0x99,0x0,0x14,0x46,0xf2,0x57,0x3c,0xf1,0x2b,0xae,0x10,0xe7,0x2a,0x0,0x0,0x78,0x99,0xb2,0x3c,0xb9,0x24,0x39,0x45,0x81,0x5b,0x8,0x2d,0x71,0x7,0x57,0x57,0x2e,0x1e,0x28,0xce,0x49,0x17,0x2b,0x14,0x36,0x61,0x2,0x61,0x9a,0x40,0x2e,0xc2,0x79,0x99,0x19,0x32,0x81,0x34,0xf,0xe0,0xf3,0xcc,0x0,0x0,0xa0,0x91,0x15,0x11,0xe0,0x83,0xf3,0xfd,0x78,0xce,0xe,0xae,0xce,0xce,0x36,0x8e,0xb6,0xe,0x5f,0x2d,0xea,0xbf,0x6,0xff,0x22,0x62,0x62,0xe3,0xfe,0xe5,0xcf,0xab,0x70,0x40,0x0,0x0,0xe1,0x74,0x7e,0xd1,0xfe,0x2c,0x2f,0xb3,0x1a,0x80,0x3b,0x6,0x80,0x6d,0xfe,0xa2,0x25,0xee,0x4,0x68,0x5e,0xb,0xa0,0x75,0xf7,0x8b,0x66,0xb2,0xf,0x40,0xb5,0x0,0xa0,0xe9,0xda,0x57,0xf3,0x70,0xf8,0x7e,0x3c,0x3c,0x45,0xa1,0x90,0xb9,0xd9,0xd9,0xe5,0xe4,0xe4,0xd8,0x4a,0xc4,0x42,0x5b,0x61,0xca,0x57,0x7d,0xfe,0x67,0xc2,0x5f,0xc0,0x57,0xfd,0x6c,0xf9,0x7e,0x3c,0xfc,0xf7,0xf5,0xe0,0xbe,0xe2,0x24,0x81,0x32,0x5d,0x81,0x47,0x4,0xf8,0xe0,0xc2,0xcc,0xf4,0x4c,0xa5,0x1c,0xcf,0x92,0x9,0x84,0x62,0xdc,0xe6,0x8f,0x47,0xfc,0xb7,0xb,0xff,0xfc,0x1d,0xd3,0x22,0xc4,0x49,0x62,0xb9,0x58,0x2a,0x14,0xe3,0x51,0x12,0x71,0x8e,0x44,0x9a,0x8c,0xf3,0x32,0xa5,0x22,0x89,0x42,0x92,0x29,0xc5,0x25,0xd2,0xff,0x64,0xe2,0xdf,0x2c,0xfb,0x3,0x3e,0xdf,0x35,0x0,0xb0,0x6a,0x3e,0x1,0x7b,0x91,0x2d,0xa8,0x5d,0x63,0x3,0xf6,0x4b,0x27,0x10,0x58,0x74,0xc0,0xe2,0xf7,0x0,0x0,0xf2,0xbb,0x6f,0xc1,0xd4,0x28,0x8,0x3,0x80,0x68,0x83,0xe1,0xcf,0x77,0xff,0xef,0x3f,0xfd,0x47,0xa0,0x25,0x0,0x80,0x66,0x49,0x92,0x71,0x0,0x0,0x5e,0x44,0x24,0x2e,0x54,0xca,0xb3,0x3f,0xc7,0x8,0x0,0x0,0x44,0xa0,0x81,0x2a,0xb0,0x41,0x1b,0xf4,0xc1,0x18,0x2c,0xc0,0x6,0x1c,0xc1,0x5,0xdc,0xc1,0xb,0xfc,0x60,0x36,0x84,0x42,0x24,0xc4,0xc2,0x42,0x10,0x42,0xa,0x64,0x80,0x1c,0x72,0x60,0x29,0xac,0x82,0x42,0x28,0x86,0xcd,0xb0,0x1d,0x2a,0x60,0x2f,0xd4,0x40,0x1d,0x34,0xc0,0x51,0x68,0x86,0x93,0x70,0xe,0x2e,0xc2,0x55,0xb8,0xe,0x3d,0x70,0xf,0xfa,0x61,0x8,0x9e,0xc1,0x28,0xbc,0x81,0x9,0x4,0x41,0xc8,0x8,0x13,0x61,0x21,0xda,0x88,0x1,0x62,0x8a,0x58,0x23,0x8e,0x8,0x17,0x99,0x85,0xf8,0x21,0xc1,0x48,0x4,0x12,0x8b,0x24,0x20,0xc9,0x88,0x14,0x51,0x22,0x4b,0x91,0x35,0x48,0x31,0x52,0x8a,0x54,0x20,0x55,0x48,0x1d,0xf2,0x3d,0x72,0x2,0x39,0x87,0x5c,0x46,0xba,0x91,0x3b,0xc8,0x0,0x32,0x82,0xfc,0x86,0xbc,0x47,0x31,0x94,0x81,0xb2,0x51,0x3d,0xd4,0xc,0xb5,0x43,0xb9,0xa8,0x37,0x1a,0x84,0x46,0xa2,0xb,0xd0,0x64,0x74,0x31,0x9a,0x8f,0x16,0xa0,0x9b,0xd0,0x72,0xb4,0x1a,0x3d,0x8c,0x36,0xa1,0xe7,0xd0,0xab,0x68,0xf,0xda,0x8f,0x3e,0x43,0xc7,0x30,0xc0,0xe8,0x18,0x7,0x33,0xc4,0x6c,0x30,0x2e,0xc6,0xc3,0x42,0xb1,0x38,0x2c,0x9,0x93,0x63,0xcb,0xb1,0x22,0xac,0xc,0xab,0xc6,0x1a,0xb0,0x56,0xac,0x3,0xbb,0x89,0xf5,0x63,0xcf,0xb1,0x77,0x4,0x12,0x81,0x45,0xc0,0x9,0x36,0x4,0x77,0x42,0x20,0x61,0x1e,0x41,0x48,0x58,0x4c,0x58,0x4e,0xd8,0x48,0xa8,0x20,0x1c,0x24,0x34,0x11,0xda,0x9,0x37,0x9,0x3,0x84,0x51,0xc2,0x27,0x22,0x93,0xa8,0x4b,0xb4,0x26,0xba,0x11,0xf9,0xc4,0x18,0x62,0x32,0x31,0x87,0x58,0x48,0x2c,0x23,0xd6,0x12,0x8f,0x13,0x2f,0x10,0x7b,0x88,0x43,0xc4,0x37,0x24,0x12,0x89,0x43,0x32,0x27,0xb9,0x90,0x2,0x49,0xb1,0xa4,0x54,0xd2,0x12,0xd2,0x46,0xd2,0x6e,0x52,0x23,0xe9,0x2c,0xa9,0x9b,0x34,0x48,0x1a,0x23,0x93,0xc9,0xda,0x64,0x6b,0xb2,0x7,0x39,0x94,0x2c,0x20,0x2b,0xc8,0x85,0xe4,0x9d,0xe4,0xc3,0xe4,0x33,0xe4,0x1b,0xe4,0x21,0xf2,0x5b,0xa,0x9d,0x62,0x40,0x71,0xa4,0xf8,0x53,0xe2,0x28,0x52,0xca,0x6a,0x4a,0x19,0xe5,0x10,0xe5,0x34,0xe5,0x6,0x65,0x98,0x32,0x41,0x55,0xa3,0x9a,0x52,0xdd,0xa8,0xa1,0x54,0x11,0x35,0x8f,0x5a,0x42,0xad,0xa1,0xb6,0x52,0xaf,0x51,0x87,0xa8,0x13,0x34,0x75,0x9a,0x39,0xcd,0x83,0x16,0x49,0x4b,0xa5,0xad,0xa2,0x95,0xd3,0x1a,0x68,0x17,0x68,0xf7,0x69,0xaf,0xe8,0x74,0xba,0x11,0xdd,0x95,0x1e,0x4e,0x97,0xd0,0x57,0xd2,0xcb,0xe9,0x47,0xe8,0x97,0xe8,0x3,0xf4,0x77,0xc,0xd,0x86,0x15,0x83,0xc7,0x88,0x67,0x28,0x19,0x9b,0x18,0x7,0x18,0x67,0x19,0x77,0x18,0xaf,0x98,0x4c,0xa6,0x19,0xd3,0x8b,0x19,0xc7,0x54,0x30,0x37,0x31,0xeb,0x98,0xe7,0x99,0xf,0x99,0x6f,0x55,0x58,0x2a,0xb6,0x2a,0x7c,0x15,0x91,0xca,0xa,0x95,0x4a,0x95,0x26,0x95,0x1b,0x2a,0x2f,0x54,0xa9,0xaa,0xa6,0xaa,0xde,0xaa,0xb,0x55,0xf3,0x55,0xcb,0x54,0x8f,0xa9,0x5e,0x53,0x7d,0xae,0x46,0x55,0x33,0x53,0xe3,0xa9,0x9,0xd4,0x96,0xab,0x55,0xaa,0x9d,0x50,0xeb,0x53,0x1b,0x53,0x67,0xa9,0x3b,0xa8,0x87,0xaa,0x67,0xa8,0x6f,0x54,0x3f,0xa4,0x7e,0x59,0xfd,0x89,0x6,0x59,0xc3,0x4c,0xc3,0x4f,0x43,0xa4,0x51,0xa0,0xb1,0x5f,0xe3,0xbc,0xc6,0x20,0xb,0x63,0x19,0xb3,0x78,0x2c,0x21,0x6b,0xd,0xab,0x86,0x75,0x81,0x35,0xc4,0x26,0xb1,0xcd,0xd9,0x7c,0x76,0x2a,0xbb,0x98,0xfd,0x1d,0xbb,0x8b,0x3d,0xaa,0xa9,0xa1,0x39,0x43,0x33,0x4a,0x33,0x57,0xb3,0x52,0xf3,0x94,0x66,0x3f,0x7,0xe3,0x98,0x71,0xf8,0x9c,0x74,0x4e,0x9,0xe7,0x28,0xa7,0x97,0xf3,0x7e,0x8a,0xde,0x14,0xef,0x29,0xe2,0x29,0x1b,0xa6,0x34,0x4c,0xb9,0x31,0x65,0x5c,0x6b,0xaa,0x96,0x97,0x96,0x58,0xab,0x48,0xab,0x51,0xab,0x47,0xeb,0xbd,0x36,0xae,0xed,0xa7,0x9d,0xa6,0xbd,0x45,0xbb,0x59,0xfb,0x81,0xe,0x41,0xc7,0x4a,0x27,0x5c,0x27,0x47,0x67,0x8f,0xce,0x5,0x9d,0xe7,0x53,0xd9,0x53,0xdd,0xa7,0xa,0xa7,0x16,0x4d,0x3d,0x3a,0xf5,0xae,0x2e,0xaa,0x6b,0xa5,0x1b,0xa1,0xbb,0x44,0x77,0xbf,0x6e,0xa7,0xee,0x98,0x9e,0xbe,0x5e,0x80,0x9e,0x4c,0x6f,0xa7,0xde,0x79,0xbd,0xe7,0xfa,0x1c,0x7d,0x2f,0xfd,0x54,0xfd,0x6d,0xfa,0xa7,0xf5,0x47,0xc,0x58,0x6,0xb3,0xc,0x24,0x6,0xdb,0xc,0xce,0x18,0x3c,0xc5,0x35,0x71,0x6f,0x3c,0x1d,0x2f,0xc7,0xdb,0xf1,0x51,0x43,0x5d,0xc3,0x40,0x43,0xa5,0x61,0x95,0x61,0x97,0xe1,0x84,0x91,0xb9,0xd1,0x3c,0xa3,0xd5,0x46,0x8d,0x46,0xf,0x8c,0x69,0xc6,0x5c,0xe3,0x24,0xe3,0x6d,0xc6,0x6d,0xc6,0xa3,0x26,0x6,0x26,0x21,0x26,0x4b,0x4d,0xea,0x4d,0xee,0x9a,0x52,0x4d,0xb9,0xa6,0x29,0xa6,0x3b,0x4c,0x3b,0x4c,0xc7,0xcd,0xcc,0xcd,0xa2,0xcd,0xd6,0x99,0x35,0x9b,0x3d,0x31,0xd7,0x32,0xe7,0x9b,0xe7,0x9b,0xd7,0x9b,0xdf,0xb7,0x60,0x5a,0x78,0x5a,0x2c,0xb6,0xa8,0xb6,0xb8,0x65,0x49,0xb2,0xe4,0x5a,0xa6,0x59,0xee,0xb6,0xbc,0x6e,0x85,0x5a,0x39,0x59,0xa5,0x58,0x55,0x5a,0x5d,0xb3,0x46,0xad,0x9d,0xad,0x25,0xd6,0xbb,0xad,0xbb,0xa7,0x11,0xa7,0xb9,0x4e,0x93,0x4e,0xab,0x9e,0xd6,0x67,0xc3,0xb0,0xf1,0xb6,0xc9,0xb6,0xa9,0xb7,0x19,0xb0,0xe5,0xd8,0x6,0xdb,0xae,0xb6,0x6d,0xb6,0x7d,0x61,0x67,0x62,0x17,0x67,0xb7,0xc5,0xae,0xc3,0xee,0x93,0xbd,0x93,0x7d,0xba,0x7d,0x8d,0xfd,0x3d,0x7,0xd,0x87,0xd9,0xe,0xab,0x1d,0x5a,0x1d,0x7e,0x73,0xb4,0x72,0x14,0x3a,0x56,0x3a,0xde,0x9a,0xce,0x9c,0xee,0x3f,0x7d,0xc5,0xf4,0x96,0xe9,0x2f,0x67,0x58,0xcf,0x10,0xcf,0xd8,0x33,0xe3,0xb6,0x13,0xcb,0x29,0xc4,0x69,0x9d,0x53,0x9b,0xd3,0x47,0x67,0x17,0x67,0xb9,0x73,0x83,0xf3,0x88,0x8b,0x89,0x4b,0x82,0xcb,0x2e,0x97,0x3e,0x2e,0x9b,0x1b,0xc6,0xdd,0xc8,0xbd,0xe4,0x4a,0x74,0xf5,0x71,0x5d,0xe1,0x7a,0xd2,0xf5,0x9d,0x9b,0xb3,0x9b,0xc2,0xed,0xa8,0xdb,0xaf,0xee,0x36,0xee,0x69,0xee,0x87,0xdc,0x9f,0xcc,0x34,0x9f,0x29,0x9e,0x59,0x33,0x73,0xd0,0xc3,0xc8,0x43,0xe0,0x51,0xe5,0xd1,0x3f,0xb,0x9f,0x95,0x30,0x6b,0xdf,0xac,0x7e,0x4f,0x43,0x4f,0x81,0x67,0xb5,0xe7,0x23,0x2f,0x63,0x2f,0x91,0x57,0xad,0xd7,0xb0,0xb7,0xa5,0x77,0xaa,0xf7,0x61,0xef,0x17,0x3e,0xf6,0x3e,0x72,0x9f,0xe3,0x3e,0xe3,0x3c,0x37,0xde,0x32,0xde,0x59,0x5f,0xcc,0x37,0xc0,0xb7,0xc8,0xb7,0xcb,0x4f,0xc3,0x6f,0x9e,0x5f,0x85,0xdf,0x43,0x7f,0x23,0xff,0x64,0xff,0x7a,0xff,0xd1,0x0,0xa7,0x80,0x25,0x1,0x67,0x3,0x89,0x81,0x41,0x81,0x5b,0x2,0xfb,0xf8,0x7a,0x7c,0x21,0xbf,0x8e,0x3f,0x3a,0xdb,0x65,0xf6,0xb2,0xd9,0xed,0x41,0x8c,0xa0,0xb9,0x41,0x15,0x41,0x8f,0x82,0xad,0x82,0xe5,0xc1,0xad,0x21,0x68,0xc8,0xec,0x90,0xad,0x21,0xf7,0xe7,0x98,0xce,0x91,0xce,0x69,0xe,0x85,0x50,0x7e,0xe8,0xd6,0xd0,0x7,0x61,0xe6,0x61,0x8b,0xc3,0x7e,0xc,0x27,0x85,0x87,0x85,0x57,0x86,0x3f,0x8e,0x70,0x88,0x58,0x1a,0xd1,0x31,0x97,0x35,0x77,0xd1,0xdc,0x43,0x73,0xdf,0x44,0xfa,0x44,0x96,0x44,0xde,0x9b,0x67,0x31,0x4f,0x39,0xaf,0x2d,0x4a,0x35,0x2a,0x3e,0xaa,0x2e,0x6a,0x3c,0xda,0x37,0xba,0x34,0xba,0x3f,0xc6,0x2e,0x66,0x59,0xcc,0xd5,0x58,0x9d,0x58,0x49,0x6c,0x4b,0x1c,0x39,0x2e,0x2a,0xae,0x36,0x6e,0x6c,0xbe,0xdf,0xfc,0xed,0xf3,0x87,0xe2,0x9d,0xe2,0xb,0xe3,0x7b,0x17,0x98,0x2f,0xc8,0x5d,0x70,0x79,0xa1,0xce,0xc2,0xf4,0x85,0xa7,0x16,0xa9,0x2e,0x12,0x2c,0x3a,0x96,0x40,0x4c,0x88,0x4e,0x38,0x94,0xf0,0x41,0x10,0x2a,0xa8,0x16,0x8c,0x25,0xf2,0x13,0x77,0x25,0x8e,0xa,0x79,0xc2,0x1d,0xc2,0x67,0x22,0x2f,0xd1,0x36,0xd1,0x88,0xd8,0x43,0x5c,0x2a,0x1e,0x4e,0xf2,0x48,0x2a,0x4d,0x7a,0x92,0xec,0x91,0xbc,0x35,0x79,0x24,0xc5,0x33,0xa5,0x2c,0xe5,0xb9,0x84,0x27,0xa9,0x90,0xbc,0x4c,0xd,0x4c,0xdd,0x9b,0x3a,0x9e,0x16,0x9a,0x76,0x20,0x6d,0x32,0x3d,0x3a,0xbd,0x31,0x83,0x92,0x91,0x90,0x71,0x42,0xaa,0x21,0x4d,0x93,0xb6,0x67,0xea,0x67,0xe6,0x66,0x76,0xcb,0xac,0x65,0x85,0xb2,0xfe,0xc5,0x6e,0x8b,0xb7,0x2f,0x1e,0x95,0x7,0xc9,0x6b,0xb3,0x90,0xac,0x5,0x59,0x2d,0xa,0xb6,0x42,0xa6,0xe8,0x54,0x5a,0x28,0xd7,0x2a,0x7,0xb2,0x67,0x65,0x57,0x66,0xbf,0xcd,0x89,0xca,0x39,0x96,0xab,0x9e,0x2b,0xcd,0xed,0xcc,0xb3,0xca,0xdb,0x90,0x37,0x9c,0xef,0x9f,0xff,0xed,0x12,0xc2,0x12,0xe1,0x92,0xb6,0xa5,0x86,0x4b,0x57,0x2d,0x1d,0x58,0xe6,0xbd,0xac,0x6a,0x39,0xb2,0x3c,0x71,0x79,0xdb,0xa,0xe3,0x15,0x5,0x2b,0x86,0x56,0x6,0xac,0x3c,0xb8,0x8a,0xb6,0x2a,0x6d,0xd5,0x4f,0xab,0xed,0x57,0x97,0xae,0x7e,0xbd,0x26,0x7a,0x4d,0x6b,0x81,0x5e,0xc1,0xca,0x82,0xc1,0xb5,0x1,0x6b,0xeb,0xb,0x55,0xa,0xe5,0x85,0x7d,0xeb,0xdc,0xd7,0xed,0x5d,0x4f,0x58,0x2f,0x59,0xdf,0xb5,0x61,0xfa,0x86,0x9d,0x1b,0x3e,0x15,0x89,0x8a,0xae,0x14,0xdb,0x17,0x97,0x15,0x7f,0xd8,0x28,0xdc,0x78,0xe5,0x1b,0x87,0x6f,0xca,0xbf,0x99,0xdc,0x94,0xb4,0xa9,0xab,0xc4,0xb9,0x64,0xcf,0x66,0xd2,0x66,0xe9,0xe6,0xde,0x2d,0x9e,0x5b,0xe,0x96,0xaa,0x97,0xe6,0x97,0xe,0x6e,0xd,0xd9,0xda,0xb4,0xd,0xdf,0x56,0xb4,0xed,0xf5,0xf6,0x45,0xdb,0x2f,0x97,0xcd,0x28,0xdb,0xbb,0x83,0xb6,0x43,0xb9,0xa3,0xbf,0x3c,0xb8,0xbc,0x65,0xa7,0xc9,0xce,0xcd,0x3b,0x3f,0x54,0xa4,0x54,0xf4,0x54,0xfa,0x54,0x36,0xee,0xd2,0xdd,0xb5,0x61,0xd7,0xf8,0x6e,0xd1,0xee,0x1b,0x7b,0xbc,0xf6,0x34,0xec,0xd5,0xdb,0x5b,0xbc,0xf7,0xfd,0x3e,0xc9,0xbe,0xdb,0x55,0x1,0x55,0x4d,0xd5,0x66,0xd5,0x65,0xfb,0x49,0xfb,0xb3,0xf7,0x3f,0xae,0x89,0xaa,0xe9,0xf8,0x96,0xfb,0x6d,0x5d,0xad,0x4e,0x6d,0x71,0xed,0xc7,0x3,0xd2,0x3,0xfd,0x7,0x23,0xe,0xb6,0xd7,0xb9,0xd4,0xd5,0x1d,0xd2,0x3d,0x54,0x52,0x8f,0xd6,0x2b,0xeb,0x47,0xe,0xc7,0x1f,0xbe,0xfe,0x9d,0xef,0x77,0x2d,0xd,0x36,0xd,0x55,0x8d,0x9c,0xc6,0xe2,0x23,0x70,0x44,0x79,0xe4,0xe9,0xf7,0x9,0xdf,0xf7,0x1e,0xd,0x3a,0xda,0x76,0x8c,0x7b,0xac,0xe1,0x7,0xd3,0x1f,0x76,0x1d,0x67,0x1d,0x2f,0x6a,0x42,0x9a,0xf2,0x9a,0x46,0x9b,0x53,0x9a,0xfb,0x5b,0x62,0x5b,0xba,0x4f,0xcc,0x3e,0xd1,0xd6,0xea,0xde,0x7a,0xfc,0x47,0xdb,0x1f,0xf,0x9c,0x34,0x3c,0x59,0x79,0x4a,0xf3,0x54,0xc9,0x69,0xda,0xe9,0x82,0xd3,0x93,0x67,0xf2,0xcf,0x8c,0x9d,0x95,0x9d,0x7d,0x7e,0x2e,0xf9,0xdc,0x60,0xdb,0xa2,0xb6,0x7b,0xe7,0x63,0xce,0xdf,0x6a,0xf,0x6f,0xef,0xba,0x10,0x74,0xe1,0xd2,0x45,0xff,0x8b,0xe7,0x3b,0xbc,0x3b,0xce,0x5c,0xf2,0xb8,0x74,0xf2,0xb2,0xdb,0xe5,0x13,0x57,0xb8,0x57,0x9a,0xaf,0x3a,0x5f,0x6d,0xea,0x74,0xea,0x3c,0xfe,0x93,0xd3,0x4f,0xc7,0xbb,0x9c,0xbb,0x9a,0xae,0xb9,0x5c,0x6b,0xb9,0xee,0x7a,0xbd,0xb5,0x7b,0x66,0xf7,0xe9,0x1b,0x9e,0x37,0xce,0xdd,0xf4,0xbd,0x79,0xf1,0x16,0xff,0xd6,0xd5,0x9e,0x39,0x3d,0xdd,0xbd,0xf3,0x7a,0x6f,0xf7,0xc5,0xf7,0xf5,0xdf,0x16,0xdd,0x7e,0x72,0x27,0xfd,0xce,0xcb,0xbb,0xd9,0x77,0x27,0xee,0xad,0xbc,0x4f,0xbc,0x5f,0xf4,0x40,0xed,0x41,0xd9,0x43,0xdd,0x87,0xd5,0x3f,0x5b,0xfe,0xdc,0xd8,0xef,0xdc,0x7f,0x6a,0xc0,0x77,0xa0,0xf3,0xd1,0xdc,0x47,0xf7,0x6,0x85,0x83,0xcf,0xfe,0x91,0xf5,0x8f,0xf,0x43,0x5,0x8f,0x99,0x8f,0xcb,0x86,0xd,0x86,0xeb,0x9e,0x38,0x3e,0x39,0x39,0xe2,0x3f,0x72,0xfd,0xe9,0xfc,0xa7,0x43,0xcf,0x64,0xcf,0x26,0x9e,0x17,0xfe,0xa2,0xfe,0xcb,0xae,0x17,0x16,0x2f,0x7e,0xf8,0xd5,0xeb,0xd7,0xce,0xd1,0x98,0xd1,0xa1,0x97,0xf2,0x97,0x93,0xbf,0x6d,0x7c,0xa5,0xfd,0xea,0xc0,0xeb,0x19,0xaf,0xdb,0xc6,0xc2,0xc6,0x1e,0xbe,0xc9,0x78,0x33,0x31,0x5e,0xf4,0x56,0xfb,0xed,0xc1,0x77,0xdc,0x77,0x1d,0xef,0xa3,0xdf,0xf,0x4f,0xe4,0x7c,0x20,0x7f,0x28,0xff,0x68,0xf9,0xb1,0xf5,0x53,0xd0,0xa7,0xfb,0x93,0x19,0x93,0x93,0xff,0x4,0x3,0x98,0xf3,0xfc,0x63,0x33,0x2d,0xdb,0x0,0x0,0x0,0x20,0x63,0x48,0x52,0x4d,0x0,0x0,0x7a,0x25,0x0,0x0,0x80,0x83,0x0,0x0,0xf9,0xff,0x0,0x0,0x80,0xe9,0x0,0x0,0x75,0x30,0x0,0x0,0xea,0x60,0x0,0x0,0x3a,0x98,0x0,0x0,0x17,0x6f,0x92,0x5f,0xc5,0x46,0x0,0x0,0x3,0x9e,0x49,0x44,0x41,0x54,0x78,0xda,0xec,0x9b,0xcf,0x4b,0x54,0x51,0x14,0xc7,0x3f,0x13,0xa9,0x15,0x18,0x2e,0xac,0x4d,0xc4,0x8,0x21,0x11,0xb5,0x68,0xd5,0x42,0xa3,0x75,0x90,0xba,0xb1,0xc,0xa4,0x7f,0x20,0x4a,0x69,0xd5,0xf,0x5a,0xf9,0x73,0xdb,0xc6,0xa1,0xc0,0x65,0xc1,0x2c,0x62,0x56,0x16,0x45,0xc4,0x4,0x91,0x4,0x15,0xa2,0x65,0x16,0x24,0x82,0x96,0x60,0x21,0xe8,0x8c,0x2e,0xd4,0xc0,0xd3,0xa2,0x23,0xb5,0x98,0xf7,0xe3,0xce,0xcc,0x7d,0xf3,0xe6,0xf9,0xe,0x5c,0x66,0xee,0x3d,0xf7,0xcc,0xbd,0xef,0xfb,0xde,0x3d,0xe7,0x7b,0xcf,0x7d,0x93,0x10,0x11,0x76,0xb3,0xec,0x61,0x97,0x4b,0xc,0x40,0x5,0xc7,0x6e,0x4,0x86,0x81,0x8f,0xc0,0x86,0x96,0x49,0xa0,0x5f,0x75,0xc1,0x88,0x88,0x54,0xa2,0x74,0x8a,0xc8,0xaa,0x38,0x4b,0x4e,0xfb,0x58,0x9f,0x4b,0xa2,0x2,0x4e,0xb0,0x13,0x78,0xc,0x24,0xbc,0xee,0xd,0x70,0x9,0xc8,0xd8,0x9c,0x4c,0xd0,0x0,0x1c,0x2,0x66,0x81,0x83,0x3e,0xfb,0xe7,0x81,0x66,0xe0,0x57,0x54,0x7c,0x40,0x8f,0xc1,0xc5,0xa3,0x7d,0x6f,0x44,0xc9,0x9,0x76,0x14,0x61,0xd3,0x16,0xa5,0x25,0xb0,0x1,0xd4,0x19,0xda,0x6c,0x15,0x61,0x13,0x29,0x1e,0xb0,0x15,0xc6,0x25,0x70,0x16,0x48,0x3,0x3f,0x80,0x4d,0xfd,0x4c,0x6b,0xbb,0x9b,0x7c,0x2d,0x62,0xac,0xb9,0x30,0xf1,0x80,0xbd,0x22,0x92,0x12,0x77,0x49,0x89,0x48,0x8d,0x83,0x7d,0xbf,0x98,0xcb,0xb0,0x4d,0x1e,0x60,0x6a,0x30,0xea,0x73,0xd2,0xa3,0xe,0xf6,0x87,0x95,0xe4,0xf8,0x95,0x9c,0xda,0x84,0x2,0x80,0x56,0xc3,0x3b,0xd7,0xea,0xc2,0x2,0xb7,0x7d,0xd8,0x6f,0x7,0xc1,0x6,0x4d,0x7c,0xc0,0x35,0xc3,0xd5,0x75,0xdd,0xa1,0x3d,0x3,0x74,0x1,0x6b,0x2e,0xb6,0x6b,0x3e,0x59,0x60,0x17,0x30,0xad,0x7e,0x68,0x5a,0xeb,0xd6,0x7c,0xc0,0x92,0xe1,0x13,0xb0,0xe8,0xf1,0x7b,0x8d,0xba,0xbe,0x3f,0x89,0xc8,0x96,0x88,0xac,0x8b,0xc8,0x84,0x88,0xc,0xa8,0xce,0x6b,0x3e,0x17,0x1d,0xc6,0xed,0xb2,0xb5,0x17,0x90,0x30,0xc5,0x6f,0xbd,0xe3,0x27,0xb,0xb4,0x7f,0x6,0x4e,0xd9,0x8,0x83,0x3f,0xd,0x27,0xb8,0x6c,0x99,0x1f,0x34,0x1b,0xb6,0x97,0xc,0xc0,0x2b,0xc3,0x9,0xbe,0xb6,0xc,0xc0,0x37,0xc3,0xf6,0x92,0x1,0x48,0x19,0x4e,0x30,0x65,0x19,0x80,0x3e,0x87,0xf6,0x1,0x9b,0x44,0x68,0xc4,0xa7,0x3,0x1c,0x9,0x28,0xb1,0x72,0x59,0x44,0x66,0xd4,0x89,0xce,0x68,0xdd,0x2a,0x11,0xaa,0x29,0x91,0x9,0x86,0xae,0x14,0xbb,0x1b,0x3c,0xab,0xbc,0xe0,0x9c,0xe6,0xef,0x96,0x75,0xcd,0xa7,0x80,0x37,0xd5,0x94,0x14,0x4d,0xc4,0xe7,0x2,0x71,0x5a,0x3c,0x6,0xc0,0x4d,0x6a,0x81,0x5e,0xe0,0xad,0xf2,0xf3,0x35,0xfd,0xde,0xab,0xba,0xaa,0x17,0x37,0x1f,0x70,0x4,0x78,0x2,0x9c,0x76,0xd0,0x4f,0x6a,0xbe,0x6e,0x31,0x8a,0x4f,0x40,0xad,0xc7,0xc5,0xa3,0xba,0xa7,0x96,0xf9,0x7e,0x31,0xf4,0x38,0x3,0xe4,0xb4,0x64,0x3c,0xa9,0xb1,0x43,0x7c,0xec,0x31,0xd8,0xf5,0xf5,0x84,0x24,0xa6,0x1f,0x17,0x91,0x95,0x2,0xf3,0x5b,0x51,0x9d,0x51,0x3e,0xa0,0xdb,0x0,0xf5,0xee,0x90,0xdc,0xfd,0x61,0xa0,0xa1,0x40,0x7b,0x83,0xea,0x8c,0x7c,0xc0,0xa6,0x81,0x93,0xdb,0x4,0xf6,0x85,0x0,0x80,0x1c,0xce,0x87,0x2e,0xeb,0x40,0xbd,0xad,0x30,0xf8,0x3b,0x8a,0x4e,0x70,0xc2,0x30,0x31,0x11,0x6,0x79,0xe9,0xa2,0x7b,0x61,0xa,0x40,0xda,0x60,0xe0,0x74,0x48,0x0,0xb8,0xb,0xac,0x16,0x68,0x5f,0x55,0x9d,0x51,0x14,0xa8,0x13,0x91,0x49,0x1f,0x11,0x60,0x4a,0xfb,0x12,0xa2,0x48,0x90,0x11,0x91,0xbc,0x96,0x8c,0x5b,0x4,0xf0,0xda,0xd,0x7a,0x11,0xa1,0x29,0xe0,0x42,0xb5,0x13,0x21,0xaf,0xdd,0x60,0x2d,0x70,0x15,0xb8,0x2,0x9c,0xd0,0xb6,0x2f,0xc0,0x23,0xe0,0x3e,0x96,0xcf,0xed,0xe2,0xed,0x70,0xbc,0x1b,0x8c,0x1,0x88,0x1,0x8,0x33,0x0,0x49,0x75,0x84,0xf3,0x4a,0x87,0xe7,0xb5,0x9e,0xac,0x2a,0x4,0x8a,0x8c,0xb7,0xe7,0x35,0xce,0x16,0x92,0xbc,0xea,0x6d,0xc5,0xfa,0xfd,0x22,0xd2,0x27,0x22,0xb3,0x22,0xb2,0xa9,0x9f,0x7d,0xda,0x6e,0xfd,0xfd,0x0,0x44,0xa4,0xc9,0xc7,0x19,0x7f,0x5e,0xfb,0x95,0xfb,0xe2,0xf,0x88,0xc8,0xb8,0xc3,0x98,0xe3,0xaa,0xb7,0x76,0x3c,0xbe,0x23,0x77,0xf0,0x7e,0xd5,0xad,0x1e,0xb8,0x65,0xe1,0x81,0xbd,0xd,0xb4,0x38,0xe8,0x5a,0x80,0x9b,0x41,0xf0,0x80,0x5,0xe0,0xa8,0xcf,0x7e,0xe5,0xf6,0x7,0xb3,0xc0,0x31,0x17,0xfd,0x9c,0x87,0xbe,0x2c,0x0,0xf8,0xcd,0x15,0xd8,0x38,0x1e,0xf7,0x1a,0xdb,0x78,0xcc,0x62,0x96,0x80,0xdf,0x63,0xf2,0x25,0xb,0x4b,0xe0,0xbb,0x87,0xde,0x78,0x5f,0x52,0xc,0x0,0xcf,0x7c,0xf6,0x7b,0xee,0xa1,0x6f,0x7,0xb2,0xfc,0x4b,0xb7,0x67,0xf1,0x7e,0x2b,0xd4,0x6b,0xeb,0xfd,0x30,0x88,0x30,0xd8,0xe4,0x12,0x2,0xfd,0x46,0x81,0x41,0x17,0xdb,0xc1,0x20,0xa3,0x40,0x25,0x78,0x40,0x9b,0x8f,0x3c,0x43,0x7b,0x98,0x79,0xc0,0x4e,0x49,0x8a,0xc8,0x3,0x11,0x59,0xd0,0x89,0x2c,0x68,0x3d,0xe9,0x61,0x97,0xf5,0x1,0x40,0x36,0xec,0xc7,0xe3,0xa5,0x48,0xde,0x29,0x43,0xfb,0x9f,0xac,0x61,0xf6,0x5a,0x7d,0xe4,0x36,0x43,0x89,0xa0,0x6,0xaa,0x4,0x0,0x1f,0x7c,0xf4,0x79,0x1f,0x65,0x0,0xee,0x95,0xa9,0x4f,0xd5,0x2,0x30,0x6,0xc,0xb9,0xe8,0x87,0xb4,0x4f,0xe4,0x73,0x82,0x1d,0xfc,0xfd,0x3f,0xd0,0x19,0xad,0xbf,0xd3,0x3b,0x3f,0x16,0xe4,0x24,0xe2,0xa4,0x68,0x9c,0x12,0x8b,0x1,0xd8,0xdd,0xf2,0x67,0x0,0x7e,0x34,0x3,0x20,0x35,0x88,0xcb,0x41,0x0,0x0,0x0,0x0,0x49,0x45,0x4e,0x44,0xae,0x42,0x60,0x82, }, l)
@@ -46,8 +56,12 @@ func newResources(l astikit.SeverityLogger) (r *resources) {
 	r.ss["/lib/astiws/astiws.js"] = astibob.ContentHandle("/lib/astiws/astiws.js", []byte{ 0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x76,0x61,0x72,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x20,0x3d,0x20,0x7b,0x7d,0x3b,0xa,0x7d,0xa,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x77,0x73,0x20,0x3d,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x69,0x6e,0x69,0x74,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x73,0x65,0x6c,0x66,0x20,0x3d,0x20,0x74,0x68,0x69,0x73,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x21,0x73,0x65,0x6c,0x66,0x2e,0x77,0x69,0x6e,0x64,0x6f,0x77,0x55,0x6e,0x6c,0x6f,0x61,0x64,0x48,0x61,0x6e,0x64,0x6c,0x65,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x77,0x69,0x6e,0x64,0x6f,0x77,0x2e,0x6f,0x6e,0x62,0x65,0x66,0x6f,0x72,0x65,0x75,0x6e,0x6c,0x6f,0x61,0x64,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x68,0x6f,0x77,0x4f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x3d,0x20,0x66,0x61,0x6c,0x73,0x65,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x2e,0x63,0x6c,0x6f,0x73,0x65,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x77,0x69,0x6e,0x64,0x6f,0x77,0x55,0x6e,0x6c,0x6f,0x61,0x64,0x48,0x61,0x6e,0x64,0x6c,0x65,0x64,0x20,0x3d,0x20,0x74,0x72,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x20,0x3d,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x2e,0x65,0x72,0x72,0x6f,0x72,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x74,0x54,0x69,0x6d,0x65,0x6f,0x75,0x74,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x69,0x6e,0x69,0x74,0x28,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0x20,0x31,0x30,0x30,0x30,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x2e,0x73,0x75,0x63,0x63,0x65,0x73,0x73,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x49,0x6e,0x69,0x74,0x20,0x77,0x65,0x62,0x73,0x6f,0x63,0x6b,0x65,0x74,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6f,0x6e,0x73,0x74,0x20,0x71,0x75,0x65,0x72,0x79,0x20,0x3d,0x20,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x61,0x73,0x73,0x69,0x67,0x6e,0x28,0x7b,0x7d,0x2c,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x71,0x75,0x65,0x72,0x79,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x20,0x3d,0x20,0x6e,0x65,0x77,0x20,0x57,0x65,0x62,0x53,0x6f,0x63,0x6b,0x65,0x74,0x28,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x75,0x72,0x6c,0x20,0x2b,0x20,0x22,0x3f,0x22,0x20,0x2b,0x20,0x4f,0x62,0x6a,0x65,0x63,0x74,0x2e,0x6b,0x65,0x79,0x73,0x28,0x71,0x75,0x65,0x72,0x79,0x29,0x2e,0x6d,0x61,0x70,0x28,0x6b,0x20,0x3d,0x3e,0x20,0x65,0x6e,0x63,0x6f,0x64,0x65,0x55,0x52,0x49,0x43,0x6f,0x6d,0x70,0x6f,0x6e,0x65,0x6e,0x74,0x28,0x6b,0x29,0x20,0x2b,0x20,0x27,0x3d,0x27,0x20,0x2b,0x20,0x65,0x6e,0x63,0x6f,0x64,0x65,0x55,0x52,0x49,0x43,0x6f,0x6d,0x70,0x6f,0x6e,0x65,0x6e,0x74,0x28,0x71,0x75,0x65,0x72,0x79,0x5b,0x6b,0x5d,0x29,0x29,0x2e,0x6a,0x6f,0x69,0x6e,0x28,0x27,0x26,0x27,0x29,0x29,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x2f,0x2f,0x20,0x44,0x65,0x63,0x6c,0x61,0x72,0x65,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x73,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x69,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x50,0x69,0x6e,0x67,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x2e,0x6f,0x6e,0x63,0x6c,0x6f,0x73,0x65,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x73,0x65,0x6c,0x66,0x2e,0x73,0x68,0x6f,0x77,0x4f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x68,0x6f,0x77,0x4f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x3d,0x20,0x66,0x61,0x6c,0x73,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x63,0x6c,0x65,0x61,0x72,0x49,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x28,0x69,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x50,0x69,0x6e,0x67,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x74,0x54,0x69,0x6d,0x65,0x6f,0x75,0x74,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x69,0x6e,0x69,0x74,0x28,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0x2c,0x20,0x31,0x30,0x30,0x30,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x2e,0x6f,0x6e,0x6f,0x70,0x65,0x6e,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x68,0x6f,0x77,0x4f,0x66,0x66,0x6c,0x69,0x6e,0x65,0x4d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x3d,0x20,0x74,0x72,0x75,0x65,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x69,0x6e,0x67,0x50,0x65,0x72,0x69,0x6f,0x64,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0x20,0x3d,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0x20,0x3d,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x73,0x65,0x6c,0x66,0x29,0x20,0x7b,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x65,0x6e,0x64,0x28,0x22,0x70,0x69,0x6e,0x67,0x22,0x29,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x50,0x69,0x6e,0x67,0x20,0x3d,0x20,0x73,0x65,0x74,0x49,0x6e,0x74,0x65,0x72,0x76,0x61,0x6c,0x28,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x29,0x20,0x7b,0x20,0x70,0x69,0x6e,0x67,0x46,0x75,0x6e,0x63,0x28,0x73,0x65,0x6c,0x66,0x29,0x20,0x7d,0x2c,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x70,0x69,0x6e,0x67,0x50,0x65,0x72,0x69,0x6f,0x64,0x20,0x2f,0x20,0x31,0x65,0x36,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x70,0x65,0x6e,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6f,0x70,0x65,0x6e,0x28,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x73,0x65,0x6c,0x66,0x2e,0x73,0x2e,0x6f,0x6e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x3d,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x76,0x65,0x6e,0x74,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x65,0x74,0x20,0x64,0x61,0x74,0x61,0x20,0x3d,0x20,0x4a,0x53,0x4f,0x4e,0x2e,0x70,0x61,0x72,0x73,0x65,0x28,0x65,0x76,0x65,0x6e,0x74,0x2e,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x28,0x64,0x61,0x74,0x61,0x2e,0x65,0x76,0x65,0x6e,0x74,0x5f,0x6e,0x61,0x6d,0x65,0x2c,0x20,0x64,0x61,0x74,0x61,0x2e,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x66,0x20,0x28,0x74,0x79,0x70,0x65,0x6f,0x66,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x52,0x61,0x77,0x20,0x21,0x3d,0x3d,0x20,0x22,0x75,0x6e,0x64,0x65,0x66,0x69,0x6e,0x65,0x64,0x22,0x29,0x20,0x6f,0x70,0x74,0x69,0x6f,0x6e,0x73,0x2e,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x52,0x61,0x77,0x28,0x64,0x61,0x74,0x61,0x29,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x7d,0xa,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x73,0x74,0x69,0x63,0x6f,0x64,0x65,0x2e,0x74,0x6f,0x6f,0x6c,0x73,0x2e,0x73,0x65,0x6e,0x64,0x48,0x74,0x74,0x70,0x28,0x6f,0x6b,0x52,0x65,0x71,0x75,0x65,0x73,0x74,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x65,0x6e,0x64,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x65,0x76,0x65,0x6e,0x74,0x5f,0x6e,0x61,0x6d,0x65,0x2c,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x65,0x6e,0x64,0x4a,0x53,0x4f,0x4e,0x28,0x7b,0x65,0x76,0x65,0x6e,0x74,0x5f,0x6e,0x61,0x6d,0x65,0x3a,0x20,0x65,0x76,0x65,0x6e,0x74,0x5f,0x6e,0x61,0x6d,0x65,0x2c,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3a,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x7d,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0x2c,0xa,0x20,0x20,0x20,0x20,0x73,0x65,0x6e,0x64,0x4a,0x53,0x4f,0x4e,0x3a,0x20,0x66,0x75,0x6e,0x63,0x74,0x69,0x6f,0x6e,0x28,0x64,0x61,0x74,0x61,0x29,0x20,0x7b,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x68,0x69,0x73,0x2e,0x73,0x2e,0x73,0x65,0x6e,0x64,0x28,0x4a,0x53,0x4f,0x4e,0x2e,0x73,0x74,0x72,0x69,0x6e,0x67,0x69,0x66,0x79,0x28,0x64,0x61,0x74,0x61,0x29,0x29,0xa,0x20,0x20,0x20,0x20,0x7d,0xa,0x7d, }, l)
 	
 	// Add templates
+	r.ts["/audit.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x41,0x75,0x64,0x69,0x74,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x61,0x75,0x64,0x69,0x74,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0x41,0x75,0x64,0x69,0x74,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x66,0x6f,0x72,0x6d,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x73,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x75,0x73,0x65,0x72,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x55,0x73,0x65,0x72,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x57,0x6f,0x72,0x6b,0x65,0x72,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x61,0x63,0x74,0x69,0x6f,0x6e,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x41,0x63,0x74,0x69,0x6f,0x6e,0x20,0x28,0x65,0x2e,0x67,0x2e,0x20,0x72,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x2e,0x2a,0x29,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x64,0x61,0x74,0x65,0x74,0x69,0x6d,0x65,0x2d,0x6c,0x6f,0x63,0x61,0x6c,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x73,0x69,0x6e,0x63,0x65,0x22,0x20,0x74,0x69,0x74,0x6c,0x65,0x3d,0x22,0x53,0x69,0x6e,0x63,0x65,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x64,0x61,0x74,0x65,0x74,0x69,0x6d,0x65,0x2d,0x6c,0x6f,0x63,0x61,0x6c,0x22,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x2d,0x75,0x6e,0x74,0x69,0x6c,0x22,0x20,0x74,0x69,0x74,0x6c,0x65,0x3d,0x22,0x55,0x6e,0x74,0x69,0x6c,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0x3e,0x46,0x69,0x6c,0x74,0x65,0x72,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x66,0x6f,0x72,0x6d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x61,0x62,0x6c,0x65,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x41,0x74,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x55,0x73,0x65,0x72,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x52,0x6f,0x6c,0x65,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x53,0x6f,0x75,0x72,0x63,0x65,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x41,0x63,0x74,0x69,0x6f,0x6e,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x52,0x75,0x6e,0x6e,0x61,0x62,0x6c,0x65,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x4f,0x75,0x74,0x63,0x6f,0x6d,0x65,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x62,0x6f,0x64,0x79,0x20,0x69,0x64,0x3d,0x22,0x61,0x75,0x64,0x69,0x74,0x22,0x3e,0x3c,0x2f,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x2f,0x6a,0x61,0x76,0x61,0x73,0x63,0x72,0x69,0x70,0x74,0x22,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x61,0x75,0x64,0x69,0x74,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x61,0x75,0x64,0x69,0x74,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa, })
 	r.ts["/errors/404.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x50,0x61,0x67,0x65,0x20,0x6e,0x6f,0x74,0x20,0x66,0x6f,0x75,0x6e,0x64,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x54,0x4f,0x44,0x4f,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d, })
-	r.ts["/index.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x57,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x20,0x6f,0x6e,0x20,0x42,0x6f,0x62,0x27,0x73,0x20,0x77,0x65,0x62,0x20,0x69,0x6e,0x74,0x65,0x72,0x66,0x61,0x63,0x65,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x2f,0x6a,0x61,0x76,0x61,0x73,0x63,0x72,0x69,0x70,0x74,0x22,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa, })
+	r.ts["/index.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x57,0x65,0x6c,0x63,0x6f,0x6d,0x65,0x20,0x6f,0x6e,0x20,0x42,0x6f,0x62,0x27,0x73,0x20,0x77,0x65,0x62,0x20,0x69,0x6e,0x74,0x65,0x72,0x66,0x61,0x63,0x65,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x69,0x6e,0x64,0x65,0x78,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x69,0x6e,0x64,0x65,0x78,0x2d,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x22,0x20,0x69,0x64,0x3d,0x22,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0x52,0x65,0x63,0x65,0x6e,0x74,0x20,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x69,0x64,0x3d,0x22,0x63,0x72,0x61,0x73,0x68,0x65,0x73,0x2d,0x6c,0x69,0x73,0x74,0x22,0x3e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x2f,0x6a,0x61,0x76,0x61,0x73,0x63,0x72,0x69,0x70,0x74,0x22,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x69,0x6e,0x64,0x65,0x78,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x64,0x65,0x78,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa, })
+	r.ts["/inspector.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x49,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0x49,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x6e,0x74,0x72,0x6f,0x6c,0x73,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x2d,0x6e,0x61,0x6d,0x65,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x4e,0x61,0x6d,0x65,0x20,0x28,0x65,0x2e,0x67,0x2e,0x20,0x61,0x75,0x64,0x69,0x6f,0x5f,0x69,0x6e,0x70,0x75,0x74,0x2e,0x2a,0x29,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x2d,0x66,0x72,0x6f,0x6d,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x46,0x72,0x6f,0x6d,0x20,0x28,0x65,0x2e,0x67,0x2e,0x20,0x6b,0x69,0x74,0x63,0x68,0x65,0x6e,0x2f,0x2a,0x29,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x66,0x69,0x6c,0x74,0x65,0x72,0x2d,0x74,0x6f,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x54,0x6f,0x20,0x28,0x65,0x2e,0x67,0x2e,0x20,0x6b,0x69,0x74,0x63,0x68,0x65,0x6e,0x29,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x6c,0x61,0x62,0x65,0x6c,0x3e,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x63,0x68,0x65,0x63,0x6b,0x62,0x6f,0x78,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x70,0x72,0x65,0x74,0x74,0x79,0x22,0x2f,0x3e,0x20,0x50,0x72,0x65,0x74,0x74,0x79,0x2d,0x70,0x72,0x69,0x6e,0x74,0x20,0x70,0x61,0x79,0x6c,0x6f,0x61,0x64,0x73,0x3c,0x2f,0x6c,0x61,0x62,0x65,0x6c,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x70,0x61,0x75,0x73,0x65,0x22,0x3e,0x50,0x61,0x75,0x73,0x65,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x62,0x61,0x63,0x6b,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6c,0x65,0x61,0x72,0x22,0x3e,0x43,0x6c,0x65,0x61,0x72,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x69,0x6e,0x66,0x6f,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x65,0x78,0x70,0x6f,0x72,0x74,0x22,0x3e,0x45,0x78,0x70,0x6f,0x72,0x74,0x20,0x4a,0x53,0x4f,0x4e,0x4c,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x73,0x70,0x61,0x6e,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x63,0x6f,0x75,0x6e,0x74,0x22,0x3e,0x3c,0x2f,0x73,0x70,0x61,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x61,0x62,0x6c,0x65,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x41,0x74,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x53,0x6f,0x75,0x72,0x63,0x65,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x46,0x72,0x6f,0x6d,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x54,0x6f,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x4e,0x61,0x6d,0x65,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x50,0x61,0x79,0x6c,0x6f,0x61,0x64,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x62,0x6f,0x64,0x79,0x20,0x69,0x64,0x3d,0x22,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2d,0x6d,0x65,0x73,0x73,0x61,0x67,0x65,0x73,0x22,0x3e,0x3c,0x2f,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x2f,0x6a,0x61,0x76,0x61,0x73,0x63,0x72,0x69,0x70,0x74,0x22,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x69,0x6e,0x73,0x70,0x65,0x63,0x74,0x6f,0x72,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa, })
+	r.ts["/login.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x4c,0x6f,0x67,0x69,0x6e,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x6c,0x6f,0x67,0x69,0x6e,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0x4c,0x6f,0x67,0x69,0x6e,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x66,0x6f,0x72,0x6d,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x6c,0x6f,0x67,0x69,0x6e,0x22,0x20,0x69,0x64,0x3d,0x22,0x6c,0x6f,0x67,0x69,0x6e,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x6c,0x6f,0x67,0x69,0x6e,0x2d,0x75,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x55,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x22,0x20,0x61,0x75,0x74,0x6f,0x63,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x3d,0x22,0x75,0x73,0x65,0x72,0x6e,0x61,0x6d,0x65,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x70,0x61,0x73,0x73,0x77,0x6f,0x72,0x64,0x22,0x20,0x69,0x64,0x3d,0x22,0x6c,0x6f,0x67,0x69,0x6e,0x2d,0x70,0x61,0x73,0x73,0x77,0x6f,0x72,0x64,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x50,0x61,0x73,0x73,0x77,0x6f,0x72,0x64,0x22,0x20,0x61,0x75,0x74,0x6f,0x63,0x6f,0x6d,0x70,0x6c,0x65,0x74,0x65,0x3d,0x22,0x63,0x75,0x72,0x72,0x65,0x6e,0x74,0x2d,0x70,0x61,0x73,0x73,0x77,0x6f,0x72,0x64,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0x3e,0x4c,0x6f,0x67,0x20,0x69,0x6e,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x66,0x6f,0x72,0x6d,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x2f,0x6a,0x61,0x76,0x61,0x73,0x63,0x72,0x69,0x70,0x74,0x22,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x6c,0x6f,0x67,0x69,0x6e,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x6c,0x6f,0x67,0x69,0x6e,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa, })
+	r.ts["/tokens.html"] = string([]byte{ 0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x74,0x69,0x74,0x6c,0x65,0x22,0x20,0x7d,0x7d,0x54,0x6f,0x6b,0x65,0x6e,0x73,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x63,0x73,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x6c,0x69,0x6e,0x6b,0x20,0x72,0x65,0x6c,0x3d,0x22,0x73,0x74,0x79,0x6c,0x65,0x73,0x68,0x65,0x65,0x74,0x22,0x20,0x68,0x72,0x65,0x66,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x63,0x73,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x63,0x73,0x73,0x22,0x2f,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x68,0x74,0x6d,0x6c,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x68,0x65,0x61,0x64,0x65,0x72,0x22,0x3e,0x54,0x6f,0x6b,0x65,0x6e,0x73,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x66,0x6f,0x72,0x6d,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x61,0x64,0x64,0x22,0x20,0x69,0x64,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x61,0x64,0x64,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x69,0x6e,0x70,0x75,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x22,0x20,0x69,0x64,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x77,0x6f,0x72,0x6b,0x65,0x72,0x22,0x20,0x70,0x6c,0x61,0x63,0x65,0x68,0x6f,0x6c,0x64,0x65,0x72,0x3d,0x22,0x57,0x6f,0x72,0x6b,0x65,0x72,0x20,0x6e,0x61,0x6d,0x65,0x22,0x2f,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x62,0x75,0x74,0x74,0x6f,0x6e,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x63,0x6f,0x6c,0x6f,0x72,0x2d,0x64,0x65,0x66,0x61,0x75,0x6c,0x74,0x2d,0x66,0x72,0x6f,0x6e,0x74,0x22,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x73,0x75,0x62,0x6d,0x69,0x74,0x22,0x3e,0x43,0x72,0x65,0x61,0x74,0x65,0x3c,0x2f,0x62,0x75,0x74,0x74,0x6f,0x6e,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x66,0x6f,0x72,0x6d,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x64,0x69,0x76,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x22,0x20,0x69,0x64,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x43,0x6f,0x70,0x79,0x20,0x74,0x68,0x65,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x20,0x6e,0x6f,0x77,0x2c,0x20,0x69,0x74,0x20,0x77,0x6f,0x6e,0x27,0x74,0x20,0x62,0x65,0x20,0x73,0x68,0x6f,0x77,0x6e,0x20,0x61,0x67,0x61,0x69,0x6e,0x3a,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x70,0x72,0x65,0x20,0x69,0x64,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2d,0x63,0x72,0x65,0x61,0x74,0x65,0x64,0x2d,0x76,0x61,0x6c,0x75,0x65,0x22,0x3e,0x3c,0x2f,0x70,0x72,0x65,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x64,0x69,0x76,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x74,0x61,0x62,0x6c,0x65,0x20,0x63,0x6c,0x61,0x73,0x73,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x22,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x57,0x6f,0x72,0x6b,0x65,0x72,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x49,0x44,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x43,0x72,0x65,0x61,0x74,0x65,0x64,0x20,0x61,0x74,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x68,0x3e,0x3c,0x2f,0x74,0x68,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x72,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x68,0x65,0x61,0x64,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x3c,0x74,0x62,0x6f,0x64,0x79,0x20,0x69,0x64,0x3d,0x22,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x22,0x3e,0x3c,0x2f,0x74,0x62,0x6f,0x64,0x79,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x74,0x61,0x62,0x6c,0x65,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x64,0x65,0x66,0x69,0x6e,0x65,0x20,0x22,0x6a,0x73,0x22,0x20,0x7d,0x7d,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x20,0x74,0x79,0x70,0x65,0x3d,0x22,0x74,0x65,0x78,0x74,0x2f,0x6a,0x61,0x76,0x61,0x73,0x63,0x72,0x69,0x70,0x74,0x22,0x20,0x73,0x72,0x63,0x3d,0x22,0x2f,0x73,0x74,0x61,0x74,0x69,0x63,0x2f,0x6a,0x73,0x2f,0x70,0x61,0x67,0x65,0x73,0x2f,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x6a,0x73,0x22,0x3e,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x3c,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x20,0x74,0x6f,0x6b,0x65,0x6e,0x73,0x2e,0x69,0x6e,0x69,0x74,0x28,0x29,0x3b,0xa,0x20,0x20,0x20,0x20,0x3c,0x2f,0x73,0x63,0x72,0x69,0x70,0x74,0x3e,0xa,0x7b,0x7b,0x20,0x65,0x6e,0x64,0x20,0x7d,0x7d,0xa,0x7b,0x7b,0x20,0x74,0x65,0x6d,0x70,0x6c,0x61,0x74,0x65,0x20,0x22,0x62,0x61,0x73,0x65,0x22,0x20,0x2e,0x20,0x7d,0x7d,0xa, })
 	
 	return
 }
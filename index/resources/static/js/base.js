@@ -38,11 +38,15 @@ let base = {
 
                                 // Get message names
                                 let ms = [
+                                    consts.messageNames.runnableConfigUpdated,
                                     consts.messageNames.runnableCrashed,
                                     consts.messageNames.runnableStarted,
+                                    consts.messageNames.runnableStarting,
                                     consts.messageNames.runnableStopped,
+                                    consts.messageNames.runnableStopping,
                                     consts.messageNames.workerDisconnected,
                                     consts.messageNames.workerRegistered,
+                                    consts.messageNames.workerState,
                                 ]
 
                                 // Add custom message names
@@ -70,11 +74,25 @@ let base = {
                                     base.finish()
                                 }
                                 break
+                            case consts.messageNames.uiHistory:
+                                // Replayed events are only forwarded to the page since the menu and configs are
+                                // already up to date
+                                if (typeof options.onMessage !== "undefined") {
+                                    data.payload.forEach(function(e) {
+                                        e.message.at = e.at
+                                        e.message.replayed = true
+                                        options.onMessage(e.message)
+                                    })
+                                }
+                                return
                         }
 
                         // Menu
                         menu.onMessage(data)
 
+                        // Config
+                        config.onMessage(data)
+
                         // Custom callback
                         if (typeof options.onMessage !== "undefined") options.onMessage(data)
                     },
@@ -0,0 +1,193 @@
+let config = {
+    // Attributes
+    current: null,
+
+    // Websocket
+
+    onMessage: function(data) {
+        switch (data.name) {
+            case consts.messageNames.runnableConfigUpdated:
+                // Config form of this runnable is not open
+                if (config.current === null || config.current.worker_name !== data.from.worker || config.current.name !== data.from.name) return
+
+                // Update values
+                config.setValues(data.payload)
+                break
+        }
+    },
+
+    // Form
+
+    url: function(runnable) {
+        return "/workers/" + encodeURIComponent(runnable.worker_name) + "/runnables/" + encodeURIComponent(runnable.name) + "/config"
+    },
+    open: function(runnable) {
+        // Get config
+        asticode.loader.show()
+        asticode.tools.sendHttp({
+            method: "GET",
+            url: config.url(runnable),
+            error: base.httpError,
+            success: function(data) {
+                // Show form
+                config.show(runnable, data.responseJSON)
+
+                // Finish
+                asticode.loader.hide()
+            },
+        })
+    },
+    show: function(runnable, data) {
+        // Create current
+        config.current = {
+            fields: [],
+            name: runnable.name,
+            worker_name: runnable.worker_name,
+        }
+
+        // Create wrapper
+        let wrapper = document.createElement("div")
+
+        // Create title
+        let title = document.createElement("div")
+        title.className = "astimodaler-title"
+        title.innerText = runnable.name
+        wrapper.appendChild(title)
+
+        // Create error
+        config.current.error = document.createElement("div")
+        config.current.error.className = "astimodaler-error"
+        wrapper.appendChild(config.current.error)
+
+        // Loop through fields
+        data.schema.fields.forEach(function(f) { config.addField(wrapper, f) })
+
+        // Set values
+        config.setValues(data.config)
+
+        // Create submit
+        let submit = document.createElement("div")
+        submit.className = "astimodaler-field-submit"
+        submit.innerText = "Save"
+        submit.addEventListener("click", config.submit)
+        wrapper.appendChild(submit)
+
+        // Show modal
+        asticode.modaler.onclose = function() { config.current = null }
+        asticode.modaler.setWidth("500px")
+        asticode.modaler.setContent(wrapper)
+        asticode.modaler.show()
+    },
+    addField: function(wrapper, f) {
+        // Create label
+        let l = document.createElement("label")
+        l.className = "astimodaler-label"
+        l.innerText = f.label
+        if (typeof f.description !== "undefined") l.title = f.description
+        wrapper.appendChild(l)
+
+        // Create input
+        let i
+        if (f.type === consts.configFieldTypes.string && typeof f.options !== "undefined") {
+            i = document.createElement("select")
+            i.className = "astimodaler-field-text"
+            f.options.forEach(function(o) {
+                let opt = document.createElement("option")
+                opt.value = o
+                opt.innerText = o
+                i.appendChild(opt)
+            })
+        } else {
+            i = document.createElement("input")
+            switch (f.type) {
+                case consts.configFieldTypes.bool:
+                    i.type = "checkbox"
+                    break
+                case consts.configFieldTypes.number:
+                    i.className = "astimodaler-field-text"
+                    i.type = "number"
+                    i.step = "any"
+                    if (typeof f.min !== "undefined") i.min = f.min
+                    if (typeof f.max !== "undefined") i.max = f.max
+                    break
+                default:
+                    i.className = "astimodaler-field-text"
+                    i.type = "text"
+            }
+        }
+        wrapper.appendChild(i)
+
+        // Append field
+        config.current.fields.push({
+            node: i,
+            schema: f,
+        })
+    },
+    setValues: function(values) {
+        config.current.fields.forEach(function(f) {
+            // No value
+            if (typeof values[f.schema.name] === "undefined") return
+
+            // Set value
+            if (f.schema.type === consts.configFieldTypes.bool) f.node.checked = values[f.schema.name]
+            else f.node.value = values[f.schema.name]
+        })
+    },
+    submit: function() {
+        // Hide error
+        config.current.error.style.display = "none"
+
+        // Loop through fields
+        let c = {}
+        for (let idx = 0; idx < config.current.fields.length; idx++) {
+            // Get field
+            const f = config.current.fields[idx]
+
+            // Get value
+            switch (f.schema.type) {
+                case consts.configFieldTypes.bool:
+                    c[f.schema.name] = f.node.checked
+                    break
+                case consts.configFieldTypes.number:
+                    c[f.schema.name] = parseFloat(f.node.value)
+                    if (isNaN(c[f.schema.name])) {
+                        config.showError('Field "' + f.schema.label + '" must be a number')
+                        return
+                    }
+                    break
+                default:
+                    c[f.schema.name] = f.node.value
+            }
+        }
+
+        // Update config
+        asticode.loader.show()
+        asticode.tools.sendHttp({
+            method: "PATCH",
+            payload: JSON.stringify(c),
+            url: config.url(config.current),
+            error: function(data) {
+                // Show error
+                if (typeof data.responseJSON !== "undefined" && typeof data.responseJSON.message !== "undefined") config.showError(data.responseJSON.message)
+                else config.showError("unknown error")
+
+                // Finish
+                asticode.loader.hide()
+            },
+            success: function() {
+                // Close modal
+                asticode.modaler.close()
+
+                // Notify
+                asticode.notifier.success("Config has been saved")
+
+                // Finish
+                asticode.loader.hide()
+            },
+        })
+    },
+    showError: function(text) {
+        config.current.error.innerText = text
+        config.current.error.style.display = "block"
+    },
+}
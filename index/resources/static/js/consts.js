@@ -1,7 +1,16 @@
 let consts = {
     runnableStatuses: {
+        crashed: "crashed",
         running: "running",
+        starting: "starting",
         stopped: "stopped",
+        stopping: "stopping",
+        unknown: "unknown",
+    },
+    configFieldTypes: {
+        bool: "bool",
+        number: "number",
+        string: "string",
     },
     identifierTypes: {
         runnable: "runnable",
@@ -10,15 +19,24 @@ let consts = {
         worker: "worker",
     },
     messageNames: {
+        runnableConfigUpdated: "runnable.config.updated",
         runnableCrashed: "runnable.crashed",
         runnableStart: "runnable.start",
         runnableStarted: "runnable.started",
+        runnableStarting: "runnable.starting",
         runnableStop: "runnable.stop",
         runnableStopped: "runnable.stopped",
+        runnableStopping: "runnable.stopping",
+        uiHistory: "ui.history",
         uiPing: "ui.ping",
         uiRegister: "ui.register",
         uiWelcome: "ui.welcome",
         workerDisconnected: "worker.disconnected",
         workerRegistered: "worker.registered",
+        workerState: "worker.state",
+    },
+    workerStates: {
+        healthy: "healthy",
+        unresponsive: "unresponsive",
     },
 }
\ No newline at end of file
@@ -20,7 +20,9 @@ let menu = {
         switch (data.name) {
             case consts.messageNames.runnableCrashed:
             case consts.messageNames.runnableStarted:
+            case consts.messageNames.runnableStarting:
             case consts.messageNames.runnableStopped:
+            case consts.messageNames.runnableStopping:
                 // Update toggle
                 menu.updateToggle(data)
                 break
@@ -29,7 +31,10 @@ let menu = {
                 menu.removeWorker(data.payload)
                 break
             case consts.messageNames.workerRegistered:
-                // Add worker to menu
+            case consts.messageNames.workerState:
+                // Replace worker in menu
+                // A worker may register again while the index still waits for it to reconnect
+                menu.removeWorker(data.payload.name)
                 menu.addWorker(data.payload)
                 break
         }
@@ -66,6 +71,10 @@ let menu = {
         // Create wrapper
         r.html.wrapper = document.createElement("div")
         r.html.wrapper.className = "menu-worker"
+        if (data.state === consts.workerStates.unresponsive) {
+            r.html.wrapper.className += " unresponsive"
+            r.html.wrapper.title = "Worker is unresponsive"
+        }
 
         // Create name
         let name = document.createElement("div")
@@ -135,9 +144,13 @@ let menu = {
     newRunnable: function(worker, data) {
         // Create results
         let r = {
+            configurable: data.configurable || false,
             description: data.description,
             html: {},
+            last_error: data.last_error,
             name: data.name,
+            restarts: data.restarts || 0,
+            started_at: typeof data.started_at !== "undefined" ? new Date(data.started_at) : undefined,
             status: data.status,
             web_homepage: data.web_homepage,
             worker_name: worker.name,
@@ -147,6 +160,10 @@ let menu = {
         r.html.wrapper = document.createElement("div")
         r.html.wrapper.className = "row"
         r.html.wrapper.title = r.description
+        r.html.wrapper.addEventListener("mouseenter", function() {
+            // Uptime changes all the time
+            menu.updateRestarts(r)
+        })
 
         // Create name
         let name = document.createElement("div")
@@ -166,6 +183,22 @@ let menu = {
         }
         name.appendChild(title)
 
+        // Create restarts
+        r.html.restarts = document.createElement("span")
+        r.html.restarts.className = "menu-runnable-restarts"
+        name.appendChild(r.html.restarts)
+        menu.updateRestarts(r)
+
+        // Create config
+        if (r.configurable) {
+            let c = document.createElement("span")
+            c.className = "menu-runnable-config"
+            c.innerText = "⚙"
+            c.title = "Configure"
+            c.addEventListener("click", function() { config.open(r) })
+            name.appendChild(c)
+        }
+
         // Create toggle cell
         let cell = document.createElement("div")
         cell.class = "cell"
@@ -178,6 +211,9 @@ let menu = {
         r.html.toggle.className = "toggle " + menu.toggleClass(data.status)
         r.html.toggle.innerHTML = '<span class="slider"></span>'
         r.html.toggle.addEventListener("click", function() {
+            // Worker is unresponsive
+            if (r.status === consts.runnableStatuses.unknown) return
+
             // Create message
             let m = {
                 to: {
@@ -188,7 +224,7 @@ let menu = {
             }
 
             // Add name
-            if (r.status === consts.runnableStatuses.stopped) {
+            if (r.status === consts.runnableStatuses.stopped || r.status === consts.runnableStatuses.crashed) {
                 m.name = consts.messageNames.runnableStart
             } else {
                 m.name = consts.messageNames.runnableStop
@@ -212,14 +248,75 @@ let menu = {
             // Runnable exists
             if (typeof runnable !== "undefined") {
                 // Update status
-                runnable.status = (data.name === consts.messageNames.runnableStarted ? consts.runnableStatuses.running : consts.runnableStatuses.stopped)
+                switch (data.name) {
+                    case consts.messageNames.runnableCrashed:
+                        runnable.status = consts.runnableStatuses.crashed
+                        break
+                    case consts.messageNames.runnableStarted:
+                        runnable.status = consts.runnableStatuses.running
+                        break
+                    case consts.messageNames.runnableStarting:
+                        runnable.status = consts.runnableStatuses.starting
+                        break
+                    case consts.messageNames.runnableStopping:
+                        runnable.status = consts.runnableStatuses.stopping
+                        break
+                    default:
+                        runnable.status = consts.runnableStatuses.stopped
+                }
 
                 // Update class
                 runnable.html.toggle.className = "toggle " + menu.toggleClass(runnable.status)
+
+                // Update restarts
+                // A stopping runnable is still up
+                if (data.name !== consts.messageNames.runnableStopping) runnable.started_at = undefined
+                if (typeof data.payload !== "undefined") {
+                    if (data.name === consts.messageNames.runnableStarted) {
+                        runnable.restarts = data.payload.restarts || 0
+                        runnable.started_at = new Date(data.payload.started_at)
+                    } else if (data.name === consts.messageNames.runnableCrashed) runnable.last_error = data.payload.error
+                }
+                menu.updateRestarts(runnable)
             }
         }
     },
+    updateRestarts: function(runnable) {
+        // Update text
+        runnable.html.restarts.innerText = runnable.restarts > 0 ? "↻ " + runnable.restarts : ""
+
+        // Update title
+        let title = runnable.description
+        title += "\nStatus: " + runnable.status
+        if (typeof runnable.started_at !== "undefined") {
+            title += "\nStarted at: " + runnable.started_at.toLocaleString()
+            title += "\nUptime: " + menu.formatDuration(new Date() - runnable.started_at)
+        }
+        if (runnable.restarts > 0) title += "\nRestarts: " + runnable.restarts
+        if (typeof runnable.last_error !== "undefined" && runnable.last_error !== "") title += "\nLast error: " + runnable.last_error
+        runnable.html.wrapper.title = title
+    },
+    formatDuration: function(ms) {
+        let s = Math.max(0, Math.floor(ms / 1000))
+        let d = Math.floor(s / 86400)
+        let h = Math.floor((s % 86400) / 3600)
+        let m = Math.floor((s % 3600) / 60)
+        return (d > 0 ? d + "d " : "") + (h > 0 || d > 0 ? h + "h " : "") + m + "m " + (s % 60) + "s"
+    },
     toggleClass: function(status) {
-        return status === "running" ? "on" : "off"
+        switch (status) {
+            case consts.runnableStatuses.crashed:
+                return "off crashed"
+            case consts.runnableStatuses.running:
+                return "on"
+            case consts.runnableStatuses.starting:
+                return "on pending"
+            case consts.runnableStatuses.stopping:
+                return "off pending"
+            case consts.runnableStatuses.unknown:
+                return "off unknown"
+            default:
+                return "off"
+        }
     }
 }
\ No newline at end of file
@@ -0,0 +1,66 @@
+let audit = {
+    init: function() {
+        // Handle submit
+        document.querySelector("#audit-filters").addEventListener("submit", function(e) {
+            e.preventDefault()
+            asticode.loader.show()
+            audit.list(base.finish)
+        })
+
+        // Init base
+        base.init({onLoad: audit.onLoad})
+    },
+    onLoad: function() {
+        audit.list(base.finish)
+    },
+    query: function() {
+        // Loop through text filters
+        let q = new URLSearchParams()
+        const filters = ["action", "runnable", "user", "worker"]
+        filters.forEach(function(k) {
+            const v = document.querySelector("#audit-" + k).value
+            if (v !== "") q.set(k, v)
+        })
+
+        // Loop through time filters
+        const times = ["since", "until"]
+        times.forEach(function(k) {
+            const v = document.querySelector("#audit-" + k).value
+            if (v !== "") q.set(k, new Date(v).toISOString())
+        })
+        return q.toString()
+    },
+    list: function(callback) {
+        asticode.tools.sendHttp({
+            url: "/api/audit?" + audit.query(),
+            method: "GET",
+            error: base.httpError,
+            success: function(data) {
+                // Empty table
+                const tbody = document.querySelector("#audit")
+                tbody.innerHTML = ""
+
+                // Loop through entries
+                data.responseJSON.forEach(function(e) { tbody.appendChild(audit.newRow(e)) })
+
+                // Callback
+                if (typeof callback !== "undefined") callback()
+            },
+        })
+    },
+    newRow: function(e) {
+        // Create row
+        let tr = document.createElement("tr")
+        tr.className = "audit-" + e.outcome
+
+        // Add cells
+        const outcome = e.outcome + (e.status ? " (" + e.status + ")" : "")
+        const cells = [new Date(e.at).toLocaleString(), e.user, e.role, e.source, e.action, e.worker, e.runnable, outcome]
+        cells.forEach(function(c) {
+            let td = document.createElement("td")
+            td.innerText = typeof c === "undefined" ? "" : c
+            tr.appendChild(td)
+        })
+        return tr
+    },
+}
@@ -21,14 +21,49 @@ let index = {
     },
     onMessage: function(data) {
         switch (data.name) {
+            case consts.messageNames.runnableCrashed:
+                index.addCrash(data)
+                break
             case consts.messageNames.workerDisconnected:
                 index.removeWorker(data.payload)
                 break
             case consts.messageNames.workerRegistered:
+            case consts.messageNames.workerState:
+                index.removeWorker(data.payload.name)
                 index.addWorker(data.payload)
                 break
         }
     },
+    addCrash: function(data) {
+        // Create crash
+        let crash = document.createElement("div")
+        crash.className = "index-crash"
+
+        // Add date
+        // Replayed crashes hold the date they've been sent at
+        let date = document.createElement("span")
+        date.className = "index-crash-date"
+        date.innerText = (typeof data.at !== "undefined" ? new Date(data.at) : new Date()).toLocaleString()
+        crash.appendChild(date)
+
+        // Add runnable
+        let runnable = document.createElement("span")
+        runnable.innerText = data.from.worker + " / " + data.from.name + ": "
+        crash.appendChild(runnable)
+
+        // Add error
+        let error = document.createElement("span")
+        error.className = "index-crash-error"
+        error.innerText = data.payload.error
+        crash.appendChild(error)
+
+        // Prepend
+        let list = document.querySelector("#crashes-list")
+        list.insertBefore(crash, list.firstChild)
+
+        // Show
+        document.querySelector("#crashes").style.display = "block"
+    },
     addWorker: function(data) {
         // Worker already exists
         if (typeof index.workers[data.name] !== "undefined") {
@@ -57,6 +92,10 @@ let index = {
 
         // Create wrapper
         r.html.wrapper = document.createElement("div")
+        if (data.state === consts.workerStates.unresponsive) {
+            r.html.wrapper.className = "index-worker-unresponsive"
+            r.html.wrapper.title = "Worker is unresponsive"
+        }
 
         // Create name
         let name = document.createElement("div")
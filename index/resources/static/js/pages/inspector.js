@@ -0,0 +1,216 @@
+let inspector = {
+    // Attributes
+    filters: {},
+    maxMessages: 1000,
+    messages: [],
+    paused: false,
+    pending: [],
+    pretty: false,
+    rows: new Map(), // Rows indexed by message
+
+    // Init
+
+    init: function() {
+        // Handle controls
+        document.querySelectorAll("input[id^=inspector-filter-]").forEach(function(item) {
+            item.addEventListener("input", inspector.onFiltersChange)
+        })
+        document.querySelector("#inspector-pretty").addEventListener("change", function() {
+            inspector.pretty = this.checked
+            inspector.render()
+        })
+        document.querySelector("#inspector-pause").addEventListener("click", inspector.togglePause)
+        document.querySelector("#inspector-clear").addEventListener("click", inspector.clear)
+        document.querySelector("#inspector-export").addEventListener("click", inspector.export)
+
+        // Init base
+        base.init({onLoad: inspector.onLoad})
+    },
+    onLoad: function() {
+        // Get references
+        asticode.tools.sendHttp({
+            url: "/api/references",
+            method: "GET",
+            error: base.httpError,
+            success: function(data) {
+                inspector.connect(data.responseJSON.inspector_websocket)
+                base.finish()
+            },
+        })
+    },
+
+    // Websocket
+
+    connect: function(ws) {
+        // Create websocket
+        const s = new WebSocket(ws.addr)
+
+        // The index only needs to be pinged
+        let intervalPing
+        s.onopen = function() {
+            intervalPing = setInterval(function() { s.send("ping") }, ws.ping_period / 1e6)
+        }
+        s.onclose = function() {
+            clearInterval(intervalPing)
+            setTimeout(function() { inspector.connect(ws) }, 1000)
+        }
+        s.onmessage = function(event) {
+            inspector.onMessage(JSON.parse(event.data))
+        }
+    },
+    onMessage: function(data) {
+        // Messages are kept aside while paused
+        if (inspector.paused) {
+            inspector.pending.push(data)
+            if (inspector.pending.length > inspector.maxMessages) inspector.pending.shift()
+            inspector.updateCount()
+            return
+        }
+
+        // Add message
+        inspector.addMessage(data)
+        inspector.updateCount()
+    },
+
+    // Messages
+
+    addMessage: function(data) {
+        // Append
+        inspector.messages.push(data)
+
+        // Only keep the latest messages
+        if (inspector.messages.length > inspector.maxMessages) inspector.removeRow(inspector.messages.shift())
+
+        // Add row
+        if (inspector.match(data)) {
+            const tbody = document.querySelector("#inspector-messages")
+            tbody.insertBefore(inspector.newRow(data), tbody.firstChild)
+        }
+    },
+    removeRow: function(data) {
+        const row = inspector.rows.get(data)
+        if (typeof row !== "undefined") {
+            row.remove()
+            inspector.rows.delete(data)
+        }
+    },
+    newRow: function(data) {
+        // Create row
+        let tr = document.createElement("tr")
+        if (data.source === "mirror") tr.className = "inspector-mirror"
+
+        // Add cells
+        const cells = [
+            new Date(data.at).toISOString(),
+            data.source,
+            inspector.identifier(data.message.from),
+            inspector.identifier(data.message.to),
+            data.message.name,
+            inspector.payload(data.message.payload),
+        ]
+        cells.forEach(function(c) {
+            let td = document.createElement("td")
+            td.innerText = c
+            tr.appendChild(td)
+        })
+
+        // Store row
+        inspector.rows.set(data, tr)
+        return tr
+    },
+    render: function() {
+        // Empty table
+        const tbody = document.querySelector("#inspector-messages")
+        tbody.innerHTML = ""
+        inspector.rows.clear()
+
+        // Loop through messages
+        for (let k = inspector.messages.length - 1; k >= 0; k--) {
+            if (inspector.match(inspector.messages[k])) tbody.appendChild(inspector.newRow(inspector.messages[k]))
+        }
+    },
+    updateCount: function() {
+        let t = inspector.messages.length + " message(s)"
+        if (inspector.pending.length > 0) t += ", " + inspector.pending.length + " pending"
+        document.querySelector("#inspector-count").innerText = t
+    },
+    identifier: function(i) {
+        if (typeof i === "undefined" || i === null) return ""
+        switch (i.type) {
+            case consts.identifierTypes.runnable:
+                return i.worker + "/" + i.name
+            case consts.identifierTypes.ui:
+            case consts.identifierTypes.worker:
+                if (typeof i.name !== "undefined") return i.name
+        }
+        return i.type
+    },
+    payload: function(p) {
+        if (typeof p === "undefined") return ""
+        if (inspector.pretty) return JSON.stringify(p, null, 2)
+        return JSON.stringify(p)
+    },
+
+    // Filters
+
+    onFiltersChange: function() {
+        // Update filters
+        inspector.filters = {}
+        const ks = ["name", "from", "to"]
+        ks.forEach(function(k) {
+            const v = document.querySelector("#inspector-filter-" + k).value.trim()
+            if (v !== "") inspector.filters[k] = inspector.pattern(v)
+        })
+
+        // Render
+        inspector.render()
+    },
+    pattern: function(v) {
+        // Patterns may contain wildcards (e.g. "audio_input.*")
+        return new RegExp("^" + v.split("*").map(function(s) {
+            return s.replace(/[.+?^${}()|[\]\\]/g, "\\$&")
+        }).join(".*") + "$")
+    },
+    match: function(data) {
+        const f = inspector.filters
+        if (typeof f.name !== "undefined" && !f.name.test(data.message.name)) return false
+        if (typeof f.from !== "undefined" && !f.from.test(inspector.identifier(data.message.from))) return false
+        if (typeof f.to !== "undefined" && !f.to.test(inspector.identifier(data.message.to))) return false
+        return true
+    },
+
+    // Controls
+
+    togglePause: function() {
+        // Update status
+        inspector.paused = !inspector.paused
+        this.innerText = inspector.paused ? "Resume" : "Pause"
+
+        // Add pending messages
+        if (!inspector.paused) {
+            inspector.pending.forEach(function(data) { inspector.addMessage(data) })
+            inspector.pending = []
+            inspector.updateCount()
+        }
+    },
+    clear: function() {
+        inspector.messages = []
+        inspector.pending = []
+        inspector.render()
+        inspector.updateCount()
+    },
+    export: function() {
+        // Create JSONL with the messages matching the filters
+        const lines = inspector.messages.filter(inspector.match).map(function(data) { return JSON.stringify(data) })
+        const blob = new Blob([lines.join("\n") + "\n"], {type: "application/x-ndjson"})
+
+        // Download
+        let a = document.createElement("a")
+        a.href = URL.createObjectURL(blob)
+        a.download = "inspector-" + new Date().toISOString() + ".jsonl"
+        document.body.appendChild(a)
+        a.click()
+        a.remove()
+        URL.revokeObjectURL(a.href)
+    },
+}
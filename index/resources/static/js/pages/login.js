@@ -0,0 +1,44 @@
+let login = {
+    init: function() {
+        // Init astitools
+        asticode.loader.init()
+        asticode.notifier.init()
+
+        // Handle submit
+        document.querySelector("#login").addEventListener("submit", function(e) {
+            e.preventDefault()
+            login.submit()
+        })
+    },
+    submit: function() {
+        asticode.loader.show()
+        asticode.tools.sendHttp({
+            url: "/api/login",
+            method: "POST",
+            payload: JSON.stringify({
+                password: document.querySelector("#login-password").value,
+                username: document.querySelector("#login-username").value,
+            }),
+            error: base.httpError,
+            success: function() {
+                window.location.href = login.redirect()
+            },
+        })
+    },
+    redirect: function() {
+        // Only redirect to paths of the index
+        // Browsers treat "\" as "/" and strip tabs and new lines, therefore "/\evil.com" would leave the index
+        const r = new URLSearchParams(window.location.search).get("redirect")
+        if (r === null || !r.startsWith("/") || /[\\\s]/.test(r)) return "/"
+
+        // Make sure the url resolves to the index
+        let u
+        try {
+            u = new URL(r, window.location.origin)
+        } catch (e) {
+            return "/"
+        }
+        if (u.origin !== window.location.origin) return "/"
+        return u.pathname + u.search + u.hash
+    },
+}
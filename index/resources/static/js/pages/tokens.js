@@ -0,0 +1,86 @@
+let tokens = {
+    init: function() {
+        // Handle submit
+        document.querySelector("#tokens-add").addEventListener("submit", function(e) {
+            e.preventDefault()
+            tokens.add()
+        })
+
+        // Init base
+        base.init({onLoad: tokens.onLoad})
+    },
+    onLoad: function() {
+        tokens.list(base.finish)
+    },
+    list: function(callback) {
+        asticode.tools.sendHttp({
+            url: "/api/tokens",
+            method: "GET",
+            error: base.httpError,
+            success: function(data) {
+                // Empty table
+                const tbody = document.querySelector("#tokens")
+                tbody.innerHTML = ""
+
+                // Loop through tokens
+                data.responseJSON.forEach(function(t) { tbody.appendChild(tokens.newRow(t)) })
+
+                // Callback
+                if (typeof callback !== "undefined") callback()
+            },
+        })
+    },
+    newRow: function(t) {
+        // Create row
+        let tr = document.createElement("tr")
+
+        // Add cells
+        const cells = [t.worker, t.id, new Date(t.created_at).toLocaleString()]
+        cells.forEach(function(c) {
+            let td = document.createElement("td")
+            td.innerText = c
+            tr.appendChild(td)
+        })
+
+        // Add revoke button
+        let td = document.createElement("td")
+        let button = document.createElement("button")
+        button.className = "color-danger-front"
+        button.innerText = "Revoke"
+        button.addEventListener("click", function() { tokens.revoke(t) })
+        td.appendChild(button)
+        tr.appendChild(td)
+        return tr
+    },
+    add: function() {
+        asticode.loader.show()
+        asticode.tools.sendHttp({
+            url: "/api/tokens",
+            method: "POST",
+            payload: JSON.stringify({worker: document.querySelector("#tokens-worker").value}),
+            error: base.httpError,
+            success: function(data) {
+                // Show token
+                document.querySelector("#tokens-created-value").innerText = data.responseJSON.token
+                document.querySelector("#tokens-created").style.display = "block"
+                document.querySelector("#tokens-worker").value = ""
+
+                // Refresh
+                tokens.list(base.finish)
+            },
+        })
+    },
+    revoke: function(t) {
+        // Confirm
+        if (!confirm("Revoke token " + t.id + " of worker " + t.worker + "? The worker will be disconnected.")) return
+
+        // Revoke
+        asticode.loader.show()
+        asticode.tools.sendHttp({
+            url: "/api/tokens/" + encodeURIComponent(t.id),
+            method: "DELETE",
+            error: base.httpError,
+            success: function() { tokens.list(base.finish) },
+        })
+    },
+}
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -50,14 +51,45 @@ func (i *Index) updateRunnableStatus(m *astibob.Message) (err error) {
 	}
 
 	// Update status
-	if m.Name == astibob.RunnableStartedMessage {
+	switch m.Name {
+	case astibob.RunnableCrashedMessage:
+		// Parse payload
+		var c astibob.RunnableCrashed
+		if c, err = astibob.ParseRunnableCrashedPayload(m); err != nil {
+			err = fmt.Errorf("index: parsing crashed payload failed: %w", err)
+			return
+		}
+
+		// Update runnable
+		r.LastError = c.Error
+		r.StartedAt = nil
+		r.Status = astibob.CrashedStatus
+	case astibob.RunnableStartedMessage:
+		// Parse payload
+		var s astibob.RunnableStarted
+		if s, err = astibob.ParseRunnableStartedPayload(m); err != nil {
+			err = fmt.Errorf("index: parsing started payload failed: %w", err)
+			return
+		}
+
+		// Update runnable
+		r.Restarts = s.Restarts
+		r.StartedAt = &s.StartedAt
 		r.Status = astibob.RunningStatus
-	} else {
+	case astibob.RunnableStartingMessage:
+		r.StartedAt = nil
+		r.Status = astibob.StartingStatus
+	case astibob.RunnableStoppingMessage:
+		r.Status = astibob.StoppingStatus
+	default:
+		r.StartedAt = nil
 		r.Status = astibob.StoppedStatus
 	}
 
 	// Update runnable
+	w.mr.Lock()
 	w.rs[*m.From.Name] = r
+	w.mr.Unlock()
 	return
 }
 
@@ -103,8 +135,19 @@ func (i *Index) sendRequestToRunnable(rw http.ResponseWriter, p httprouter.Param
 	// Create url
 	u := w.addr + "/" + filepath.Join("runnables", runnable, path)
 
+	// Read body
+	// The body is part of the signature
+	var b []byte
+	if body != nil {
+		if b, err = ioutil.ReadAll(body); err != nil {
+			rw.WriteHeader(http.StatusInternalServerError)
+			i.l.Error(fmt.Errorf("index: reading body failed: %w", err))
+			return
+		}
+	}
+
 	// Create request
-	r, err := http.NewRequest(method, u, body)
+	r, err := http.NewRequest(method, u, bytes.NewReader(b))
 	if err != nil {
 		rw.WriteHeader(http.StatusInternalServerError)
 		i.l.Error(fmt.Errorf("index: creating %s request to %s failed: %w", method, u, err))
@@ -112,12 +155,23 @@ func (i *Index) sendRequestToRunnable(rw http.ResponseWriter, p httprouter.Param
 	}
 
 	// Add headers
+	// Session cookies are only meant for the index
 	if header != nil {
 		for k := range header {
-			r.Header.Set(k, header.Get(k))
+			if k != "Cookie" {
+				r.Header.Set(k, header.Get(k))
+			}
 		}
 	}
 
+	// Sign
+	// Workers only accept some requests, such as config updates, from the index
+	if err = astibob.SignRequest(r, astibob.IndexIdentifierType, astibob.DeriveIndexKey(i.sk, worker), b); err != nil {
+		rw.WriteHeader(http.StatusInternalServerError)
+		i.l.Error(fmt.Errorf("index: signing %s request to %s failed: %w", method, u, err))
+		return
+	}
+
 	// Log
 	i.l.Debugf("index: sending %s request to %s", method, u)
 
@@ -135,36 +189,44 @@ func (i *Index) sendRequestToRunnable(rw http.ResponseWriter, p httprouter.Param
 }
 
 func (i *Index) runnableRoutes(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	i.sendRequestToRunnable(
-		rw,
-		p,
-		r.Method,
-		"/routes"+p.ByName("path"),
-		r.Body,
-		r.Header,
-		func(_, _, url string, resp *http.Response) {
-			// Copy header
-			for k := range resp.Header {
-				rw.Header().Set(k, resp.Header.Get(k))
-			}
+	i.sendRequestToRunnable(rw, p, r.Method, "/routes"+p.ByName("path"), r.Body, r.Header, i.copyResponse(rw))
+}
 
-			// Copy status code
-			rw.WriteHeader(resp.StatusCode)
+func (i *Index) runnableConfig(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	i.sendRequestToRunnable(rw, p, r.Method, "/config", r.Body, r.Header, i.copyResponse(rw))
+}
 
-			// Copy body
-			if _, err := io.Copy(rw, resp.Body); err != nil {
-				i.l.Error(fmt.Errorf("index: copying response body of %s failed: %w", url, err))
-				return
-			}
-		},
-	)
+func (i *Index) copyResponse(rw http.ResponseWriter) func(worker, runnable, url string, resp *http.Response) {
+	return func(_, _, url string, resp *http.Response) {
+		// Copy header
+		for k := range resp.Header {
+			rw.Header().Set(k, resp.Header.Get(k))
+		}
+
+		// Copy status code
+		rw.WriteHeader(resp.StatusCode)
+
+		// Copy body
+		if _, err := io.Copy(rw, resp.Body); err != nil {
+			i.l.Error(fmt.Errorf("index: copying response body of %s failed: %w", url, err))
+			return
+		}
+	}
 }
 
 type TemplateData struct {
 	Runnable string
+	Username string // Empty when users don't need to log in
 	Worker   string
 }
 
+func newTemplateData(r *http.Request) (d TemplateData) {
+	if u, ok := UserFromContext(r.Context()); ok {
+		d.Username = u.Username
+	}
+	return
+}
+
 func (i *Index) runnableWeb(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	// We need the template from the runnable, not the executed result itself.
 	// Indeed in order to execute the template we need the layouts, which the workers don't have.
@@ -196,10 +258,10 @@ func (i *Index) runnableWeb(rw http.ResponseWriter, r *http.Request, p httproute
 			rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
 
 			// Execute template
-			if err = t.Execute(rw, TemplateData{
-				Runnable: runnable,
-				Worker:   worker,
-			}); err != nil {
+			d := newTemplateData(r)
+			d.Runnable = runnable
+			d.Worker = worker
+			if err = t.Execute(rw, d); err != nil {
 				rw.WriteHeader(http.StatusInternalServerError)
 				i.l.Error(fmt.Errorf("index: executing template %s failed: %w", url, err))
 				return
@@ -3,6 +3,7 @@ package index
 import (
 	"net/http"
 
+	"github.com/asticode/go-astibob"
 	"github.com/asticode/go-astikit"
 	"github.com/julienschmidt/httprouter"
 )
@@ -20,12 +21,29 @@ func (i *Index) Serve() {
 	// Web
 	r.GET("/", i.homepage)
 	r.GET("/web/*page", i.web)
+	r.GET("/logout", i.logout)
 
 	// API
+	r.GET("/api/audit", i.apiAudit)
 	r.GET("/api/ok", i.ok)
 	r.GET("/api/references", i.references)
+	r.GET("/api/listenables", i.apiListenables)
+	r.POST("/api/login", i.login)
+	r.POST("/api/messages", i.apiSendMessage)
+	r.GET("/api/tokens", i.apiTokens)
+	r.POST("/api/tokens", i.apiAddToken)
+	r.DELETE("/api/tokens/:token", i.apiDeleteToken)
+	r.GET("/api/workers", i.apiWorkers)
+	r.GET("/api/workers/:worker", i.apiGetWorker)
+	r.GET("/api/workers/:worker/runnables/:runnable", i.apiGetRunnable)
+	r.POST("/api/workers/:worker/runnables/:runnable/start", i.apiStartRunnable)
+	r.POST("/api/workers/:worker/runnables/:runnable/stop", i.apiStopRunnable)
+
+	// Metrics
+	r.Handler(http.MethodGet, "/metrics", i.mt.Handler())
 
 	// Websockets
+	r.GET("/websockets/inspector", i.handleInspectorWebsocket)
 	r.GET("/websockets/ui", i.handleUIWebsocket)
 	r.GET("/websockets/worker", i.handleWorkerWebsocket)
 
@@ -33,17 +51,16 @@ func (i *Index) Serve() {
 	for _, m := range []string{http.MethodDelete, http.MethodGet, http.MethodPatch, http.MethodPost} {
 		r.Handle(m, "/workers/:worker/runnables/:runnable/routes/*path", i.runnableRoutes)
 	}
+	r.GET("/workers/:worker/runnables/:runnable/config", i.runnableConfig)
+	r.PATCH("/workers/:worker/runnables/:runnable/config", i.runnableConfig)
 	r.GET("/workers/:worker/runnables/:runnable/web/*path", i.runnableWeb)
 
 	// Chain middlewares
-	h := astikit.ChainHTTPMiddlewares(r, astikit.HTTPMiddlewareBasicAuth(i.o.Server.Username, i.o.Server.Password))
+	h := astikit.ChainHTTPMiddlewares(r, i.authorize)
 	h = astikit.ChainHTTPMiddlewaresWithPrefix(h, []string{"/api/"}, astikit.HTTPMiddlewareContentType("application/json"))
 
 	// Serve
-	astikit.ServeHTTP(i.w, astikit.ServeHTTPOptions{
-		Addr:    i.o.Server.Addr,
-		Handler: h,
-	})
+	astibob.ServeHTTP(i.w, i.o.Server, h)
 }
 
 func (i *Index) ok(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {}
@@ -0,0 +1,171 @@
+package index
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/julienschmidt/httprouter"
+)
+
+const sessionCookieName = "astibob_session"
+
+type session struct {
+	expiresAt time.Time
+	u         User
+}
+
+// APILogin is sent to log in
+type APILogin struct {
+	Password string `json:"password"`
+	Username string `json:"username"`
+}
+
+// APIUser is the user who has logged in
+type APIUser struct {
+	Role     string `json:"role"`
+	Username string `json:"username"`
+}
+
+func (i *Index) sessionTTL() time.Duration {
+	if i.o.Access.SessionTTL > 0 {
+		return i.o.Access.SessionTTL
+	}
+	return 24 * time.Hour
+}
+
+func (i *Index) newSession(u User) (id string, s session, err error) {
+	// Create id
+	var b []byte
+	if b, err = astibob.NewSecret(); err != nil {
+		err = fmt.Errorf("index: creating secret failed: %w", err)
+		return
+	}
+	id = base64.RawURLEncoding.EncodeToString(b)
+
+	// Create session
+	s = session{
+		expiresAt: time.Now().Add(i.sessionTTL()),
+		u:         u,
+	}
+
+	// Lock
+	i.ms.Lock()
+	defer i.ms.Unlock()
+
+	// Remove expired sessions
+	now := time.Now()
+	for k, v := range i.ss {
+		if now.After(v.expiresAt) {
+			delete(i.ss, k)
+		}
+	}
+
+	// Store session
+	i.ss[id] = s
+	return
+}
+
+func (i *Index) sessionUser(id string) (u User, ok bool) {
+	// Lock
+	i.ms.Lock()
+	defer i.ms.Unlock()
+
+	// Get session
+	var s session
+	if s, ok = i.ss[id]; !ok {
+		return
+	}
+
+	// Session has expired
+	if time.Now().After(s.expiresAt) {
+		delete(i.ss, id)
+		ok = false
+		return
+	}
+	u = s.u
+	return
+}
+
+func (i *Index) delSession(id string) {
+	i.ms.Lock()
+	defer i.ms.Unlock()
+	delete(i.ss, id)
+}
+
+func (i *Index) login(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Parse body
+	var l APILogin
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: parsing login failed: %w", err))
+		return
+	}
+
+	// Check credentials
+	u, ok := i.checkCredentials(l.Username, l.Password)
+	if !ok {
+		i.audit(AuditEntry{
+			Action: auditActionLogin,
+			Source: AuditSourceAPI,
+			Status: http.StatusUnauthorized,
+			User:   l.Username,
+		})
+		astibob.WriteHTTPError(i.l, rw, http.StatusUnauthorized, errors.New("index: invalid credentials"))
+		return
+	}
+
+	// Create session
+	id, s, err := i.newSession(u)
+	if err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusInternalServerError, fmt.Errorf("index: creating session failed: %w", err))
+		return
+	}
+
+	// Set cookie
+	http.SetCookie(rw, &http.Cookie{
+		Expires:  s.expiresAt,
+		HttpOnly: true,
+		Name:     sessionCookieName,
+		Path:     "/",
+		SameSite: http.SameSiteStrictMode,
+		Secure:   i.o.Server.UseTLS(),
+		Value:    id,
+	})
+
+	// Log
+	i.l.Infof("index: user %s has logged in", u.Username)
+	i.audit(AuditEntry{
+		Action: auditActionLogin,
+		Role:   u.Role,
+		Source: AuditSourceAPI,
+		Status: http.StatusOK,
+		User:   u.Username,
+	})
+
+	// Write
+	astibob.WriteHTTPData(i.l, rw, APIUser{
+		Role:     u.Role,
+		Username: u.Username,
+	})
+}
+
+func (i *Index) logout(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Delete session
+	if c, err := r.Cookie(sessionCookieName); err == nil {
+		i.delSession(c.Value)
+	}
+
+	// Delete cookie
+	http.SetCookie(rw, &http.Cookie{
+		MaxAge: -1,
+		Name:   sessionCookieName,
+		Path:   "/",
+	})
+
+	// Redirect
+	http.Redirect(rw, r, "/web/login", http.StatusFound)
+}
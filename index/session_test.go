@@ -0,0 +1,49 @@
+package index
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestLogin(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{Server: astibob.ServerOptions{Password: "p", Username: "u"}})
+	defer closeTestIndex(i)
+
+	// Invalid credentials
+	rw := httptest.NewRecorder()
+	i.login(rw, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"password":"invalid","username":"u"}`)), nil)
+	if rw.Code != http.StatusUnauthorized {
+		t.Fatalf("expected %d, got %d", http.StatusUnauthorized, rw.Code)
+	}
+	if l := len(rw.Result().Cookies()); l != 0 {
+		t.Fatalf("expected no cookie, got %d", l)
+	}
+
+	// Valid credentials
+	rw = httptest.NewRecorder()
+	i.login(rw, httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"password":"p","username":"u"}`)), nil)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rw.Code)
+	}
+
+	// Session cookie is not sent with cross-site requests
+	cs := rw.Result().Cookies()
+	if len(cs) != 1 {
+		t.Fatalf("expected 1 cookie, got %d", len(cs))
+	}
+	if c := cs[0]; c.Name != sessionCookieName || !c.HttpOnly || c.SameSite != http.SameSiteStrictMode {
+		t.Fatalf("expected a strict http only session cookie, got %+v", c)
+	}
+
+	// Session authenticates requests
+	r := httptest.NewRequest(http.MethodGet, "/api/workers", nil)
+	r.AddCookie(cs[0])
+	if u, ok := i.authenticate(r); !ok || u.Username != "u" || u.Role != RoleAdmin {
+		t.Fatalf("expected admin u to be authenticated, got %+v", u)
+	}
+}
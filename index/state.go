@@ -0,0 +1,267 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"github.com/asticode/go-astibob"
+)
+
+// DesiredRunnable is the state operators want a runnable to be in
+type DesiredRunnable struct {
+	Config  astibob.Config `json:"config,omitempty"`
+	Running *bool          `json:"running,omitempty"` // Nil means operators have neither started nor stopped the runnable
+}
+
+// desiredStates keeps track of desired runnable states and persists them when a path is provided
+type desiredStates struct {
+	m    *sync.Mutex                            // Locks rs
+	path string                                 // Empty means desired states are not persisted
+	rs   map[string]map[string]*DesiredRunnable // Indexed by worker --> runnable
+}
+
+func newDesiredStates(path string) (s *desiredStates, err error) {
+	// Create desired states
+	s = &desiredStates{
+		m:    &sync.Mutex{},
+		path: path,
+		rs:   make(map[string]map[string]*DesiredRunnable),
+	}
+
+	// Nothing to load
+	if path == "" {
+		return
+	}
+
+	// Read
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		} else {
+			err = fmt.Errorf("index: reading %s failed: %w", path, err)
+		}
+		return
+	}
+
+	// Unmarshal
+	if err = json.Unmarshal(b, &s.rs); err != nil {
+		err = fmt.Errorf("index: unmarshaling %s failed: %w", path, err)
+		return
+	}
+	return
+}
+
+func (s *desiredStates) worker(name string) (rs map[string]DesiredRunnable) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Loop through runnables
+	rs = make(map[string]DesiredRunnable)
+	for n, r := range s.rs[name] {
+		rs[n] = *r
+	}
+	return
+}
+
+// update updates the desired state of a runnable and persists desired states if it has changed
+func (s *desiredStates) update(worker, runnable string, fn func(r *DesiredRunnable)) (err error) {
+	// Lock
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	// Get runnable
+	if _, ok := s.rs[worker]; !ok {
+		s.rs[worker] = make(map[string]*DesiredRunnable)
+	}
+	r, ok := s.rs[worker][runnable]
+	if !ok {
+		r = &DesiredRunnable{}
+		s.rs[worker][runnable] = r
+	}
+
+	// Update
+	o := *r
+	fn(r)
+
+	// Nothing has changed
+	if ok && reflect.DeepEqual(o, *r) {
+		return
+	}
+
+	// Save
+	if err = s.save(); err != nil {
+		err = fmt.Errorf("index: saving desired states failed: %w", err)
+		return
+	}
+	return
+}
+
+// save writes desired states to a temporary file first so that a crash doesn't leave a truncated file behind.
+// Assumes the mutex is locked.
+func (s *desiredStates) save() (err error) {
+	// Nothing to persist
+	if s.path == "" {
+		return
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.MarshalIndent(s.rs, "", "  "); err != nil {
+		err = fmt.Errorf("index: marshaling failed: %w", err)
+		return
+	}
+
+	// Make sure the dir exists
+	if err = os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		err = fmt.Errorf("index: mkdirall %s failed: %w", filepath.Dir(s.path), err)
+		return
+	}
+
+	// Write
+	tmp := s.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		err = fmt.Errorf("index: writing %s failed: %w", tmp, err)
+		return
+	}
+
+	// Rename
+	if err = os.Rename(tmp, s.path); err != nil {
+		err = fmt.Errorf("index: renaming %s to %s failed: %w", tmp, s.path, err)
+		return
+	}
+	return
+}
+
+func (i *Index) updateDesiredRunning(m *astibob.Message) (err error) {
+	// Only operators' choices are persisted. Messages dispatched by the index are either operators' choices sent
+	// through the API or reconciliations.
+	if m.From.Type != astibob.IndexIdentifierType && m.From.Type != astibob.UIIdentifierType {
+		return
+	}
+
+	// Get worker
+	var worker string
+	if m.To != nil {
+		worker = m.To.WorkerName()
+	}
+	if worker == "" {
+		err = errors.New("index: no to worker")
+		return
+	}
+
+	// Parse payload
+	var name string
+	running := m.Name == astibob.RunnableStartMessage
+	if running {
+		name, err = astibob.ParseRunnableStartPayload(m)
+	} else {
+		name, err = astibob.ParseRunnableStopPayload(m)
+	}
+	if err != nil {
+		err = fmt.Errorf("index: parsing payload failed: %w", err)
+		return
+	}
+
+	// Update
+	if err = i.ds.update(worker, name, func(r *DesiredRunnable) { r.Running = &running }); err != nil {
+		err = fmt.Errorf("index: updating desired state failed: %w", err)
+		return
+	}
+	return
+}
+
+func (i *Index) updateDesiredConfig(m *astibob.Message) (err error) {
+	// Check from
+	if m.From.Name == nil || m.From.Worker == nil {
+		err = errors.New("index: invalid from")
+		return
+	}
+
+	// Parse payload
+	var c astibob.Config
+	if c, err = astibob.ParseRunnableConfigUpdatedPayload(m); err != nil {
+		err = fmt.Errorf("index: parsing payload failed: %w", err)
+		return
+	}
+
+	// Update
+	if err = i.ds.update(*m.From.Worker, *m.From.Name, func(r *DesiredRunnable) { r.Config = c }); err != nil {
+		err = fmt.Errorf("index: updating desired state failed: %w", err)
+		return
+	}
+	return
+}
+
+// reconcile sends messages to a worker that has just registered so that its runnables match their desired state
+func (i *Index) reconcile(w astibob.Worker) {
+	// Get desired runnables
+	drs := i.ds.worker(w.Name)
+	if len(drs) == 0 {
+		return
+	}
+
+	// Loop through runnables
+	for _, r := range w.Runnables {
+		// Get desired runnable
+		dr, ok := drs[r.Name]
+		if !ok {
+			continue
+		}
+
+		// Restore config
+		if r.Configurable && len(dr.Config) > 0 {
+			m, err := astibob.NewRunnableConfigUpdateMessage(
+				*astibob.NewIndexIdentifier(),
+				astibob.NewWorkerIdentifier(w.Name),
+				astibob.RunnableConfigUpdate{
+					Config:   dr.Config,
+					Runnable: r.Name,
+				},
+			)
+			if err != nil {
+				i.l.Error(fmt.Errorf("index: creating config update message failed: %w", err))
+			} else {
+				i.l.Infof("index: restoring config of runnable %s on worker %s", r.Name, w.Name)
+				i.d.Dispatch(m)
+			}
+		}
+
+		// Get name
+		var name string
+		if dr.Running != nil {
+			if *dr.Running && astibob.IsStoppedStatus(r.Status) {
+				name = astibob.RunnableStartMessage
+			} else if !*dr.Running && (r.Status == astibob.RunningStatus || r.Status == astibob.StartingStatus) {
+				name = astibob.RunnableStopMessage
+			}
+		}
+
+		// Nothing to do
+		if name == "" {
+			continue
+		}
+
+		// Log
+		i.l.Infof("index: sending %s message to runnable %s on worker %s to match its desired state", name, r.Name, w.Name)
+
+		// Send message
+		b, err := json.Marshal(r.Name)
+		if err != nil {
+			i.l.Error(fmt.Errorf("index: marshaling payload failed: %w", err))
+			continue
+		}
+		i.sendAPIMessage(APIMessage{
+			Name:    name,
+			Payload: b,
+			Worker:  w.Name,
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astikit"
+)
+
+func newTestRunnableMessage(t *testing.T, name, runnable string) *astibob.Message {
+	m := astibob.NewMessage()
+	m.From = *astibob.NewUIIdentifier("u")
+	m.Name = name
+	m.To = astibob.NewWorkerIdentifier("w")
+	if err := m.MarshalPayload(runnable); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestReconcile(t *testing.T) {
+	// Create temporary dir
+	dir, err := ioutil.TempDir("", "astibob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "state.json")
+
+	// Create index
+	i := newTestIndex(t, Options{StatePath: path})
+	defer closeTestIndex(i)
+
+	// Update desired states
+	for _, m := range []*astibob.Message{
+		newTestRunnableMessage(t, astibob.RunnableStartMessage, "started"),
+		newTestRunnableMessage(t, astibob.RunnableStopMessage, "stopped"),
+		newTestRunnableMessage(t, astibob.RunnableStartMessage, "running"),
+	} {
+		if err = i.updateDesiredRunning(m); err != nil {
+			t.Fatalf("updating desired running failed: %v", err)
+		}
+	}
+	m, err := astibob.NewRunnableConfigUpdatedMessage(*astibob.NewRunnableIdentifier("configurable", "w"), nil, astibob.Config{"k": "v"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = i.updateDesiredConfig(m); err != nil {
+		t.Fatalf("updating desired config failed: %v", err)
+	}
+
+	// Messages sent by workers are not operators' choices
+	m = newTestRunnableMessage(t, astibob.RunnableStopMessage, "started")
+	m.From = *astibob.NewWorkerIdentifier("w")
+	if err = i.updateDesiredRunning(m); err != nil {
+		t.Fatalf("updating desired running failed: %v", err)
+	}
+
+	// Desired states have been persisted
+	s, err := newDesiredStates(path)
+	if err != nil {
+		t.Fatalf("loading desired states failed: %v", err)
+	}
+	yes, no := true, false
+	if e, g := map[string]DesiredRunnable{
+		"configurable": {Config: astibob.Config{"k": "v"}},
+		"running":      {Running: &yes},
+		"started":      {Running: &yes},
+		"stopped":      {Running: &no},
+	}, s.worker("w"); !reflect.DeepEqual(e, g) {
+		t.Fatalf("expected %+v, got %+v", e, g)
+	}
+
+	// Record dispatched messages
+	c := make(chan string, 10)
+	for _, n := range []string{astibob.RunnableConfigUpdateMessage, astibob.RunnableStartMessage, astibob.RunnableStopMessage} {
+		i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(n)}, func(m *astibob.Message) error {
+			// Get runnable
+			var r string
+			if m.Name == astibob.RunnableConfigUpdateMessage {
+				u, err := astibob.ParseRunnableConfigUpdatePayload(m)
+				if err != nil {
+					return err
+				}
+				r = u.Runnable
+			} else if err := m.UnmarshalPayload(&r); err != nil {
+				return err
+			}
+			c <- m.Name + " " + r
+			return nil
+		})
+	}
+
+	// Reconcile
+	i.reconcile(astibob.Worker{Name: "w", Runnables: []astibob.RunnableMessage{
+		{Configurable: true, Metadata: astibob.Metadata{Name: "configurable"}, Status: astibob.StoppedStatus},
+		{Metadata: astibob.Metadata{Name: "running"}, Status: astibob.RunningStatus},
+		{Metadata: astibob.Metadata{Name: "started"}, Status: astibob.CrashedStatus},
+		{Metadata: astibob.Metadata{Name: "stopped"}, Status: astibob.RunningStatus},
+		{Metadata: astibob.Metadata{Name: "unknown"}, Status: astibob.StoppedStatus},
+	}})
+
+	// Only runnables that don't match their desired state have been updated
+	var ms []string
+	for len(ms) < 3 {
+		select {
+		case m := <-c:
+			ms = append(ms, m)
+		case <-time.After(time.Second):
+			t.Fatalf("messages haven't been dispatched, got %+v", ms)
+		}
+	}
+	if e := []string{
+		astibob.RunnableConfigUpdateMessage + " configurable",
+		astibob.RunnableStartMessage + " started",
+		astibob.RunnableStopMessage + " stopped",
+	}; !reflect.DeepEqual(e, ms) {
+		t.Fatalf("expected %+v, got %+v", e, ms)
+	}
+	select {
+	case m := <-c:
+		t.Fatalf("unexpected message %s", m)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
@@ -0,0 +1,343 @@
+package index
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astiws"
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIToken binds a token to a worker name. The token itself is only returned when it's created.
+type APIToken struct {
+	CreatedAt time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	Token     string    `json:"token,omitempty"`
+	Worker    string    `json:"worker"`
+}
+
+type token struct {
+	CreatedAt time.Time `json:"created_at"`
+	Hash      []byte    `json:"hash"` // Only the hash of the secret is stored
+	ID        string    `json:"id"`
+	Worker    string    `json:"worker"`
+}
+
+func (t token) toAPI() APIToken {
+	return APIToken{
+		CreatedAt: t.CreatedAt,
+		ID:        t.ID,
+		Worker:    t.Worker,
+	}
+}
+
+func tokenFromContext(ctx context.Context) (t token, ok bool) {
+	t, ok = ctx.Value(tokenContextKey).(token)
+	return
+}
+
+// tokens keeps track of worker tokens and persists them when a path is provided
+type tokens struct {
+	m    *sync.Mutex // Locks ts
+	path string      // Empty means tokens are not persisted
+	ts   map[string]token
+}
+
+func newTokens(path string) (ts *tokens, err error) {
+	// Create tokens
+	ts = &tokens{
+		m:    &sync.Mutex{},
+		path: path,
+		ts:   make(map[string]token),
+	}
+
+	// Nothing to load
+	if path == "" {
+		return
+	}
+
+	// Read
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+		} else {
+			err = fmt.Errorf("index: reading %s failed: %w", path, err)
+		}
+		return
+	}
+
+	// Unmarshal
+	var s []token
+	if err = json.Unmarshal(b, &s); err != nil {
+		err = fmt.Errorf("index: unmarshaling %s failed: %w", path, err)
+		return
+	}
+
+	// Index tokens
+	for _, t := range s {
+		ts.ts[t.ID] = t
+	}
+	return
+}
+
+func hashTokenSecret(secret string) []byte {
+	h := sha256.Sum256([]byte(secret))
+	return h[:]
+}
+
+// add creates a token for a worker. Tokens are formatted as <id>.<secret>.
+func (ts *tokens) add(worker string) (t token, v string, err error) {
+	// Create id
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		err = fmt.Errorf("index: reading random bytes failed: %w", err)
+		return
+	}
+
+	// Create secret
+	var s []byte
+	if s, err = astibob.NewSecret(); err != nil {
+		err = fmt.Errorf("index: creating secret failed: %w", err)
+		return
+	}
+	secret := base64.RawURLEncoding.EncodeToString(s)
+
+	// Create token
+	t = token{
+		CreatedAt: time.Now(),
+		Hash:      hashTokenSecret(secret),
+		ID:        hex.EncodeToString(id),
+		Worker:    worker,
+	}
+	v = t.ID + "." + secret
+
+	// Lock
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	// Store token
+	ts.ts[t.ID] = t
+
+	// Save
+	if err = ts.save(); err != nil {
+		delete(ts.ts, t.ID)
+		err = fmt.Errorf("index: saving tokens failed: %w", err)
+		return
+	}
+	return
+}
+
+func (ts *tokens) del(id string) (t token, ok bool, err error) {
+	// Lock
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	// Get token
+	if t, ok = ts.ts[id]; !ok {
+		return
+	}
+
+	// Delete token
+	delete(ts.ts, id)
+
+	// Save
+	if err = ts.save(); err != nil {
+		ts.ts[id] = t
+		err = fmt.Errorf("index: saving tokens failed: %w", err)
+		return
+	}
+	return
+}
+
+func (ts *tokens) check(v string) (t token, ok bool) {
+	// Split
+	ps := strings.SplitN(v, ".", 2)
+	if len(ps) != 2 {
+		return
+	}
+
+	// Get token
+	ts.m.Lock()
+	t, ok = ts.ts[ps[0]]
+	ts.m.Unlock()
+	if !ok {
+		return
+	}
+
+	// Check secret
+	ok = subtle.ConstantTimeCompare(t.Hash, hashTokenSecret(ps[1])) == 1
+	return
+}
+
+func (ts *tokens) list() (o []APIToken) {
+	// Lock
+	ts.m.Lock()
+	defer ts.m.Unlock()
+
+	// Loop through tokens
+	o = []APIToken{}
+	for _, t := range ts.ts {
+		o = append(o, t.toAPI())
+	}
+
+	// Sort
+	sort.Slice(o, func(i, j int) bool {
+		if o[i].Worker != o[j].Worker {
+			return o[i].Worker < o[j].Worker
+		}
+		return o[i].CreatedAt.Before(o[j].CreatedAt)
+	})
+	return
+}
+
+// save writes tokens to a temporary file first so that a crash doesn't leave a truncated file behind. Assumes the
+// mutex is locked.
+func (ts *tokens) save() (err error) {
+	// Nothing to persist
+	if ts.path == "" {
+		return
+	}
+
+	// Get tokens
+	var s []token
+	for _, t := range ts.ts {
+		s = append(s, t)
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.MarshalIndent(s, "", "  "); err != nil {
+		err = fmt.Errorf("index: marshaling failed: %w", err)
+		return
+	}
+
+	// Make sure the dir exists
+	if err = os.MkdirAll(filepath.Dir(ts.path), 0755); err != nil {
+		err = fmt.Errorf("index: mkdirall %s failed: %w", filepath.Dir(ts.path), err)
+		return
+	}
+
+	// Write
+	// Tokens are secrets
+	tmp := ts.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		err = fmt.Errorf("index: writing %s failed: %w", tmp, err)
+		return
+	}
+
+	// Rename
+	if err = os.Rename(tmp, ts.path); err != nil {
+		err = fmt.Errorf("index: renaming %s to %s failed: %w", tmp, ts.path, err)
+		return
+	}
+	return
+}
+
+func bearerToken(r *http.Request) (v string, ok bool) {
+	const prefix = "Bearer "
+	if h := r.Header.Get("Authorization"); strings.HasPrefix(h, prefix) {
+		return strings.TrimPrefix(h, prefix), true
+	}
+	return
+}
+
+func (i *Index) apiTokens(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	astibob.WriteHTTPData(i.l, rw, i.ts.list())
+}
+
+func (i *Index) apiAddToken(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Parse body
+	var b APIToken
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, fmt.Errorf("index: parsing token failed: %w", err))
+		return
+	}
+
+	// Invalid worker
+	if b.Worker == "" {
+		astibob.WriteHTTPError(i.l, rw, http.StatusBadRequest, errors.New("index: token has no worker"))
+		return
+	}
+
+	// Add token
+	t, v, err := i.ts.add(b.Worker)
+	if err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusInternalServerError, fmt.Errorf("index: adding token failed: %w", err))
+		return
+	}
+
+	// Log
+	i.l.Infof("index: token %s has been created for worker %s", t.ID, t.Worker)
+
+	// Write
+	o := t.toAPI()
+	o.Token = v
+	rw.WriteHeader(http.StatusCreated)
+	astibob.WriteHTTPData(i.l, rw, o)
+}
+
+func (i *Index) apiDeleteToken(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Delete token
+	t, ok, err := i.ts.del(p.ByName("token"))
+	if err != nil {
+		astibob.WriteHTTPError(i.l, rw, http.StatusInternalServerError, fmt.Errorf("index: deleting token failed: %w", err))
+		return
+	} else if !ok {
+		astibob.WriteHTTPError(i.l, rw, http.StatusNotFound, fmt.Errorf("index: no %s token", p.ByName("token")))
+		return
+	}
+
+	// Log
+	i.l.Infof("index: token %s of worker %s has been revoked", t.ID, t.Worker)
+
+	// Disconnect workers using the token
+	i.disconnectToken(t.ID)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (i *Index) disconnectToken(id string) {
+	// Get workers
+	var ns []string
+	i.mw.Lock()
+	for n, tid := range i.wts {
+		if tid == id {
+			ns = append(ns, n)
+		}
+	}
+	i.mw.Unlock()
+
+	// Loop through workers
+	for _, n := range ns {
+		// Get client
+		c, ok := i.ww.Client(n)
+		if !ok {
+			continue
+		}
+
+		// Close
+		// astiws clients wait for the worker to acknowledge the close frame, we don't want to block the caller
+		i.l.Infof("index: disconnecting worker %s since its token has been revoked", n)
+		go func(n string, c *astiws.Client) {
+			if err := c.Close(); err != nil {
+				i.l.Error(fmt.Errorf("index: closing client of worker %s failed: %w", n, err))
+			}
+		}(n, c)
+	}
+}
@@ -0,0 +1,53 @@
+package index
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astiws"
+	"github.com/gorilla/websocket"
+)
+
+func TestDisconnectToken(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{})
+	defer closeTestIndex(i)
+
+	// Create server
+	registered := make(chan bool)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		i.ww.ServeHTTP(rw, r, func(c *astiws.Client) error { //nolint:errcheck
+			i.ww.RegisterClient("w", c)
+			close(registered)
+			return nil
+		})
+	}))
+	defer s.Close()
+
+	// Connect worker
+	// It never reads, therefore it never acknowledges close frames
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(s.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dialing failed: %v", err)
+	}
+	defer conn.Close()
+	<-registered
+	i.mw.Lock()
+	i.wts["w"] = "t"
+	i.mw.Unlock()
+
+	// Disconnect token
+	done := make(chan bool)
+	go func() {
+		i.disconnectToken("t")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("disconnecting token is blocked by the worker")
+	}
+}
@@ -19,9 +19,12 @@ func uiName(c *astiws.Client) string {
 }
 
 func (i *Index) handleUIWebsocket(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if err := i.wu.ServeHTTP(rw, r, func(c *astiws.Client) (err error) {
+	// Get user
+	u, _ := UserFromContext(r.Context())
+
+	if err := i.wc.ServeHTTP(i.wu, rw, r, func(c *astiws.Client) (err error) {
 		// Set message handler
-		c.SetMessageHandler(i.handleUIMessage)
+		c.SetMessageHandler(func(p []byte) error { return i.handleUIMessage(u, p) })
 
 		// Contrary to workers, UI can't provide proper unique names therefore we need to come up with one when it
 		// connects and send it right away for future messages
@@ -58,7 +61,7 @@ func (i *Index) handleUIWebsocket(rw http.ResponseWriter, r *http.Request, p htt
 			astibob.NewUIIdentifier(name),
 			astibob.WelcomeUI{
 				Name:    name,
-				Workers: i.workers(),
+				Workers: i.workers(""),
 			},
 		); err != nil {
 			err = fmt.Errorf("index: creating welcome message failed: %w", err)
@@ -78,7 +81,7 @@ func (i *Index) handleUIWebsocket(rw http.ResponseWriter, r *http.Request, p htt
 	}
 }
 
-func (i *Index) handleUIMessage(p []byte) (err error) {
+func (i *Index) handleUIMessage(u User, p []byte) (err error) {
 	// Log
 	i.l.Debugf("index: handling ui message %s", p)
 
@@ -89,6 +92,33 @@ func (i *Index) handleUIMessage(p []byte) (err error) {
 		return
 	}
 
+	// Check access
+	// Messages requiring more than the viewer role are actions and are audited
+	role := i.messageRole(m.Name)
+	audited := roleLevels[role] > roleLevels[RoleViewer]
+	if !hasRole(u, role) {
+		if audited {
+			e := messageAuditEntry(m, u)
+			e.Outcome = AuditOutcomeFailure
+			i.audit(e)
+		}
+		err = fmt.Errorf("index: %s message is forbidden for %s", m.Name, u.Role)
+		return
+	}
+
+	// Audit
+	// UIs don't wait for the message to be handled, therefore its outcome is not known
+	if audited {
+		e := messageAuditEntry(m, u)
+		e.Outcome = AuditOutcomeDispatched
+		i.audit(e)
+	}
+
+	// Workers only accept runnable commands from the index, which relays them once it has authorized and audited them
+	if indexCommandNames[m.Name] {
+		m.From = *astibob.NewIndexIdentifier()
+	}
+
 	// Dispatch
 	i.d.Dispatch(m)
 	return
@@ -109,24 +139,37 @@ func (i *Index) sendMessageToUI(m *astibob.Message) (err error) {
 		// Lock
 		i.mu.Lock()
 
+		// Loop through requested message names
+		// UIs may request message name patterns (e.g. "audio_input.*")
+		ns := make(map[string]bool)
+		for mn, us := range i.us {
+			// Message name doesn't match
+			if mn != m.Name && !astibob.WildcardMatch(mn, m.Name) {
+				continue
+			}
+
+			// Get names
+			for n := range us {
+				ns[n] = true
+			}
+		}
+
+		// Unlock
+		i.mu.Unlock()
+
 		// No UI has requested this message
-		us, ok := i.us[m.Name]
-		if !ok {
-			i.mu.Unlock()
+		if len(ns) == 0 {
 			return
 		}
 
 		// Get names
-		for n := range us {
+		for n := range ns {
 			names = append(names, n)
 		}
-
-		// Unlock
-		i.mu.Unlock()
 	}
 
 	// Send message
-	if err = sendMessage(i.l, m, "ui", i.wu, names...); err != nil {
+	if err = sendMessage(i.l, m, "ui", i.wu, nil, names...); err != nil {
 		err = fmt.Errorf("index: sending message failed: %w", err)
 		return
 	}
@@ -168,6 +211,12 @@ func (i *Index) registerUI(m *astibob.Message) (err error) {
 	// Log
 	i.l.Infof("index: ui %s has registered", *m.From.Name)
 
+	// Replay history
+	if err = i.replayHistory(u.Name, u.MessageNames); err != nil {
+		err = fmt.Errorf("index: replaying history failed: %w", err)
+		return
+	}
+
 	// Create message
 	if m, err = astibob.NewUIMessageNamesAddMessage(
 		*astibob.NewIndexIdentifier(),
@@ -203,8 +252,10 @@ func (i *Index) unregisterUI(m *astibob.Message) (err error) {
 			// Remove key
 			delete(i.us, n)
 
-			// Append
-			ns = append(ns, n)
+			// Workers must keep sending kept events
+			if !i.h.kept(n) {
+				ns = append(ns, n)
+			}
 		}
 	}
 	i.mu.Unlock()
@@ -264,7 +315,7 @@ func (i *Index) web(rw http.ResponseWriter, r *http.Request, p httprouter.Params
 	}
 
 	// Get template data
-	data, code := i.templateData(name)
+	data, code := i.templateData(r, name)
 
 	// Set content type
 	rw.Header().Set("Content-Type", "text/html; charset=UTF-8")
@@ -282,7 +333,8 @@ func (i *Index) web(rw http.ResponseWriter, r *http.Request, p httprouter.Params
 	}
 }
 
-func (i *Index) templateData(name string) (data interface{}, code int) {
+func (i *Index) templateData(r *http.Request, name string) (data TemplateData, code int) {
+	data = newTemplateData(r)
 	code = http.StatusOK
 	switch name {
 	case "/errors/404.html":
@@ -292,7 +344,8 @@ func (i *Index) templateData(name string) (data interface{}, code int) {
 }
 
 type APIReferences struct {
-	Websocket APIWebsocket `json:"websocket"`
+	InspectorWebsocket APIWebsocket `json:"inspector_websocket"`
+	Websocket          APIWebsocket `json:"websocket"`
 }
 
 type APIWebsocket struct {
@@ -301,8 +354,14 @@ type APIWebsocket struct {
 }
 
 func (i *Index) references(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	astibob.WriteHTTPData(i.l, rw, APIReferences{Websocket: APIWebsocket{
-		Addr:       "ws://" + i.o.Server.Addr + "/websockets/ui",
-		PingPeriod: astiws.PingPeriod,
-	}})
+	astibob.WriteHTTPData(i.l, rw, APIReferences{
+		InspectorWebsocket: APIWebsocket{
+			Addr:       i.o.Server.WebsocketScheme() + "://" + i.o.Server.Addr + "/websockets/inspector",
+			PingPeriod: astiws.PingPeriod,
+		},
+		Websocket: APIWebsocket{
+			Addr:       i.o.Server.WebsocketScheme() + "://" + i.o.Server.Addr + "/websockets/ui",
+			PingPeriod: astiws.PingPeriod,
+		},
+	})
 }
@@ -0,0 +1,78 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astikit"
+)
+
+func TestHandleUIMessage(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{})
+	defer closeTestIndex(i)
+
+	// Record dispatched messages
+	c := make(chan *astibob.Message, 2)
+	for _, n := range []string{astibob.RunnableStartMessage, "r.say"} {
+		i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(n)}, func(m *astibob.Message) error {
+			c <- m
+			return nil
+		})
+	}
+
+	// Loop through messages
+	for n, typ := range map[string]string{
+		// Workers only accept runnable commands from the index
+		astibob.RunnableStartMessage: astibob.IndexIdentifierType,
+		"r.say":                      astibob.UIIdentifierType,
+	} {
+		// Handle
+		if err := i.handleUIMessage(User{Role: RoleAdmin}, []byte(`{"from":{"name":"u","type":"ui"},"name":"`+n+`","payload":"r","to":{"name":"w","type":"worker"}}`)); err != nil {
+			t.Fatalf("%s: handling ui message failed: %v", n, err)
+		}
+
+		// Check from
+		select {
+		case m := <-c:
+			if m.From.Type != typ {
+				t.Errorf("%s: expected from %s, got %s", n, typ, m.From.Type)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s: message hasn't been dispatched", n)
+		}
+	}
+}
+
+func TestUIMessageRateLimit(t *testing.T) {
+	// Create index
+	i := newTestIndex(t, Options{RateLimits: map[string]astibob.RateLimit{"r.*": {Burst: 1}}})
+	defer closeTestIndex(i)
+
+	// Record dispatched messages
+	c := make(chan *astibob.Message, 3)
+	i.d.On(astibob.DispatchConditions{Name: astikit.StrPtr("r.say")}, func(m *astibob.Message) error {
+		c <- m
+		return nil
+	})
+
+	// Handle messages
+	for idx := 0; idx < 3; idx++ {
+		if err := i.handleUIMessage(User{Role: RoleAdmin}, []byte(`{"from":{"name":"u","type":"ui"},"name":"r.say","payload":"r","to":{"name":"w","type":"worker"}}`)); err != nil {
+			t.Fatalf("handling ui message failed: %v", err)
+		}
+	}
+
+	// Only the first message is handled, the other ones are counted as dropped
+	<-c
+	for idx := 0; idx < 100 && i.d.Stats().Dropped["r.say"] < 2; idx++ {
+		time.Sleep(time.Millisecond)
+	}
+	if d := i.d.Stats().Dropped["r.say"]; d != 2 {
+		t.Fatalf("expected 2 dropped messages, got %d", d)
+	}
+	if len(c) > 0 {
+		t.Fatalf("expected 1 handled message, got %d", len(c)+1)
+	}
+}
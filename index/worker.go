@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"sort"
 	"sync"
+	"time"
 
 	"github.com/asticode/go-astibob"
 	"github.com/asticode/go-astiws"
@@ -15,21 +16,36 @@ import (
 )
 
 type worker struct {
-	addr string
-	mr   *sync.Mutex // Locks rs
-	name string
-	rs   map[string]astibob.RunnableMessage
-	ws   *astiws.Client
+	addr           string
+	c              astibob.Codec
+	codecs         []string
+	dropped        bool // Whether the connection has dropped
+	hb             *astibob.Heartbeat
+	heartbeats     bool // Whether the worker sends heartbeats
+	ls             []astibob.ListenableSubscription
+	mr             *sync.Mutex // Locks dropped, hb, rs, seenAt, state and unresponsiveAt
+	name           string
+	rs             map[string]astibob.RunnableMessage
+	seenAt         time.Time // Last time the worker has registered or sent a heartbeat
+	state          string
+	unresponsiveAt time.Time
+	ws             *astiws.Client
 }
 
 func newWorker(i astibob.Worker, ws *astiws.Client) (w *worker) {
 	// Create
 	w = &worker{
-		addr: i.Addr,
-		mr:   &sync.Mutex{},
-		name: i.Name,
-		rs:   make(map[string]astibob.RunnableMessage),
-		ws:   ws,
+		addr:       i.Addr,
+		c:          astibob.NegotiateCodec(i.Codecs),
+		codecs:     i.Codecs,
+		heartbeats: i.Heartbeats,
+		ls:         i.Listenables,
+		mr:         &sync.Mutex{},
+		name:       i.Name,
+		rs:         make(map[string]astibob.RunnableMessage),
+		seenAt:     time.Now(),
+		state:      astibob.WorkerStateHealthy,
+		ws:         ws,
 	}
 
 	// Loop through runnables
@@ -46,8 +62,13 @@ func (w *worker) toMessage() (o astibob.Worker) {
 
 	// Create worker
 	o = astibob.Worker{
-		Addr: w.addr,
-		Name: w.name,
+		Addr:        w.addr,
+		Codecs:      w.codecs,
+		Heartbeat:   w.hb,
+		Heartbeats:  w.heartbeats,
+		Listenables: w.ls,
+		Name:        w.name,
+		State:       w.state,
 	}
 
 	// Get keys
@@ -61,15 +82,38 @@ func (w *worker) toMessage() (o astibob.Worker) {
 
 	// Loop through keys
 	for _, k := range ks {
+		// Get runnable
+		r := w.rs[k]
+
+		// Statuses of unresponsive workers can't be trusted
+		if w.state == astibob.WorkerStateUnresponsive {
+			r.StartedAt = nil
+			r.Status = astibob.UnknownStatus
+			r.Uptime = 0
+		}
+
+		// Add uptime
+		if r.Status == astibob.RunningStatus && r.StartedAt != nil {
+			r.Uptime = time.Since(*r.StartedAt)
+		}
+
 		// Append
-		o.Runnables = append(o.Runnables, w.rs[k])
+		o.Runnables = append(o.Runnables, r)
 	}
 	return
 }
 
 func (i *Index) handleWorkerWebsocket(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
-	if err := i.ww.ServeHTTP(rw, r, func(c *astiws.Client) error {
-		c.SetMessageHandler(i.handleWorkerMessage(c))
+	// Get token
+	t, hasToken := tokenFromContext(r.Context())
+
+	if err := i.wc.ServeHTTP(i.ww, rw, r, func(c *astiws.Client) error {
+		// Workers connecting with a token can only register with the name the token is bound to
+		var tp *token
+		if hasToken {
+			tp = &t
+		}
+		c.SetMessageHandler(i.handleWorkerMessage(c, tp))
 		return nil
 	}); err != nil {
 		var e *websocket.CloseError
@@ -80,21 +124,34 @@ func (i *Index) handleWorkerWebsocket(rw http.ResponseWriter, r *http.Request, p
 	}
 }
 
-func (i *Index) handleWorkerMessage(c *astiws.Client) astiws.MessageHandler {
+func (i *Index) handleWorkerMessage(c *astiws.Client, t *token) astiws.MessageHandler {
+	// Name the worker has registered with
+	var name string
 	return func(p []byte) (err error) {
 		// Log
 		i.l.Debugf("index: handling worker message %s", p)
 
 		// Unmarshal
 		m := astibob.NewMessage()
-		if err = json.Unmarshal(p, m); err != nil {
+		if err = astibob.UnmarshalMessage(p, m); err != nil {
 			err = fmt.Errorf("index: unmarshaling failed: %w", err)
 			return
 		}
 
 		// When the worker registers, we need to register the client
-		if m.Name == astibob.WorkerRegisterMessage && m.From.Name != nil {
-			i.ww.RegisterClient(*m.From.Name, c)
+		if m.Name == astibob.WorkerRegisterMessage && m.From.Name != nil && name == "" {
+			// Register client
+			if err = i.registerWorkerClient(c, t, *m.From.Name); err != nil {
+				// Close blocks until the read loop, which is executing this handler, is done
+				go c.Close()
+				err = fmt.Errorf("index: registering worker client failed: %w", err)
+				return
+			}
+			name = *m.From.Name
+		} else if name == "" || m.From.WorkerName() != name {
+			// Workers can only send messages once registered and on their own behalf
+			err = fmt.Errorf("index: worker %s can't send %s message from %s", name, m.Name, m.From.WorkerName())
+			return
 		}
 
 		// Dispatch
@@ -123,13 +180,43 @@ func (i *Index) sendMessageToWorker(m *astibob.Message) (err error) {
 	}
 
 	// Send message
-	if err = sendMessage(i.l, m, "worker", i.ww, names...); err != nil {
+	if err = sendMessage(i.l, m, "worker", i.ww, i.workerCodec, names...); err != nil {
 		err = fmt.Errorf("index: sending message failed: %w", err)
 		return
 	}
 	return
 }
 
+func (i *Index) registerWorkerClient(c *astiws.Client, t *token, name string) (err error) {
+	// Token is bound to another worker
+	if t != nil && t.Worker != name {
+		err = fmt.Errorf("index: token %s is bound to worker %s, not %s", t.ID, t.Worker, name)
+		return
+	}
+
+	// Lock
+	i.mw.Lock()
+	defer i.mw.Unlock()
+
+	// A worker with the same name is already connected
+	// A worker whose connection has dropped can register again during its grace period
+	if oc, ok := i.ww.Client(name); ok && oc != c && !i.connectionDropped(name, oc) {
+		err = fmt.Errorf("index: worker %s is already connected", name)
+		return
+	}
+
+	// Register client
+	i.ww.RegisterClient(name, c)
+
+	// Store token
+	if t != nil {
+		i.wts[name] = t.ID
+	} else {
+		delete(i.wts, name)
+	}
+	return
+}
+
 func (i *Index) addWorker(m *astibob.Message) (err error) {
 	// Parse payload
 	var mw astibob.Worker
@@ -138,6 +225,9 @@ func (i *Index) addWorker(m *astibob.Message) (err error) {
 		return
 	}
 
+	// Keys are only distributed by the index
+	mw.Key = nil
+
 	// Retrieve client
 	c, ok := i.ww.Client(mw.Name)
 	if !ok {
@@ -155,22 +245,8 @@ func (i *Index) addWorker(m *astibob.Message) (err error) {
 
 	// Handle disconnect
 	c.SetListener(astiws.EventNameDisconnect, func(_ *astiws.Client, _ string, _ json.RawMessage) (err error) {
-		// Create disconnected message
-		var m *astibob.Message
-		if m, err = astibob.NewWorkerDisconnectedMessage(
-			*astibob.NewIndexIdentifier(),
-			&astibob.Identifier{Types: map[string]bool{
-				astibob.UIIdentifierType:     true,
-				astibob.WorkerIdentifierType: true,
-			}},
-			w.name,
-		); err != nil {
-			err = fmt.Errorf("astibob: creating disconnected message failed: %w", err)
-			return
-		}
-
-		// Dispatch
-		i.d.Dispatch(m)
+		// The manager may be locked while its clients are closing, which is why this is executed in a task
+		i.w.NewTask().Do(func() { i.handleWorkerConnectionDropped(w) })
 		return
 	})
 
@@ -182,8 +258,12 @@ func (i *Index) addWorker(m *astibob.Message) (err error) {
 		*astibob.NewIndexIdentifier(),
 		astibob.NewWorkerIdentifier(w.name),
 		astibob.WelcomeWorker{
-			UIMessageNames: i.uiMessageNames(),
-			Workers:        i.workers(),
+			Codec:           w.c.Name(),
+			HeartbeatPeriod: i.heartbeatPeriod(),
+			IndexKey:        astibob.DeriveIndexKey(i.sk, w.name),
+			Inspected:       i.inspected(),
+			UIMessageNames:  i.uiMessageNames(),
+			Workers:         i.workers(w.name),
 		},
 	); err != nil {
 		err = fmt.Errorf("index: creating welcome message failed: %w", err)
@@ -193,13 +273,10 @@ func (i *Index) addWorker(m *astibob.Message) (err error) {
 	// Dispatch
 	i.d.Dispatch(m)
 
-	// Create registered message
+	// Create registered message for uis
 	if m, err = astibob.NewWorkerRegisteredMessage(
 		*astibob.NewIndexIdentifier(),
-		&astibob.Identifier{Types: map[string]bool{
-			astibob.UIIdentifierType:     true,
-			astibob.WorkerIdentifierType: true,
-		}},
+		&astibob.Identifier{Type: astibob.UIIdentifierType},
 		mw,
 	); err != nil {
 		err = fmt.Errorf("index: creating registered message failed: %w", err)
@@ -208,26 +285,45 @@ func (i *Index) addWorker(m *astibob.Message) (err error) {
 
 	// Dispatch
 	i.d.Dispatch(m)
-	return
-}
 
-func (i *Index) delWorker(m *astibob.Message) (err error) {
-	// Parse payload
-	var name string
-	if name, err = astibob.ParseWorkerDisconnectedPayload(m); err != nil {
-		err = fmt.Errorf("index: parsing message payload failed: %w", err)
-		return
-	}
+	// Loop through other workers
+	// Each worker receives the key it shares with the new worker therefore they can't share the same message
+	for _, ow := range i.workers(w.name) {
+		// Same worker
+		if ow.Name == w.name {
+			continue
+		}
 
-	// Update pool
-	i.mw.Lock()
-	delete(i.ws, name)
-	i.mw.Unlock()
+		// Create registered message
+		rw := mw
+		rw.Key = ow.Key
+		if m, err = astibob.NewWorkerRegisteredMessage(
+			*astibob.NewIndexIdentifier(),
+			astibob.NewWorkerIdentifier(ow.Name),
+			rw,
+		); err != nil {
+			err = fmt.Errorf("index: creating registered message failed: %w", err)
+			return
+		}
 
-	// Unregister client
-	i.ww.UnregisterClient(name)
+		// Dispatch
+		i.d.Dispatch(m)
+	}
 
-	// Log
-	i.l.Infof("index: worker %s has disconnected", name)
+	// Make sure runnables match their desired state
+	i.reconcile(mw)
 	return
 }
+
+func (i *Index) workerCodec(name string) astibob.Codec {
+	// Lock
+	i.mw.Lock()
+	defer i.mw.Unlock()
+
+	// Get worker
+	w, ok := i.ws[name]
+	if !ok {
+		return astibob.JSONCodec
+	}
+	return w.c
+}
@@ -0,0 +1,329 @@
+package astibob
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Journal directions
+const (
+	// Messages dispatched locally, whether they've been received or emitted
+	JournalDirectionInbound = "in"
+	// Messages emitted by local runnables, before they're cloned for their recipients
+	JournalDirectionOutbound = "out"
+)
+
+// JournalEntry is written as one JSON line per message
+type JournalEntry struct {
+	At        time.Time `json:"at"`
+	Direction string    `json:"direction"`
+	Message   *Message  `json:"message"`
+}
+
+type JournalOptions struct {
+	MaxFiles int   `toml:"max_files"` // Number of rotated files kept. Defaults to 5.
+	MaxSize  int64 `toml:"max_size"`  // In bytes. 0 means the file is never rotated.
+	// Empty means messages are not journaled. Rotated files are suffixed with .1 (newest) to .<max_files> (oldest).
+	Path string `toml:"path"`
+}
+
+// Journal records messages to a rotating file
+type Journal struct {
+	f    *os.File
+	m    *sync.Mutex // Locks f and size
+	o    JournalOptions
+	size int64
+}
+
+// NewJournal opens the journal file and appends messages to it
+func NewJournal(o JournalOptions) (j *Journal, err error) {
+	// Default options
+	if o.MaxFiles <= 0 {
+		o.MaxFiles = 5
+	}
+
+	// Create journal
+	j = &Journal{
+		m: &sync.Mutex{},
+		o: o,
+	}
+
+	// Open
+	if err = j.open(); err != nil {
+		err = fmt.Errorf("astibob: opening journal failed: %w", err)
+		return
+	}
+	return
+}
+
+func (j *Journal) open() (err error) {
+	// Open file
+	// Payloads may be sensitive
+	if j.f, err = os.OpenFile(j.o.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600); err != nil {
+		err = fmt.Errorf("astibob: opening %s failed: %w", j.o.Path, err)
+		return
+	}
+
+	// Get size
+	var fi os.FileInfo
+	if fi, err = j.f.Stat(); err != nil {
+		err = fmt.Errorf("astibob: stating %s failed: %w", j.o.Path, err)
+		return
+	}
+	j.size = fi.Size()
+	return
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.m.Lock()
+	defer j.m.Unlock()
+	if j.f == nil {
+		return nil
+	}
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Record appends a message to the journal
+func (j *Journal) Record(direction string, m *Message) (err error) {
+	// Worker keys are never written to disk
+	if m, err = RedactMessage(m); err != nil {
+		err = fmt.Errorf("astibob: redacting message failed: %w", err)
+		return
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(JournalEntry{
+		At:        time.Now(),
+		Direction: direction,
+		Message:   m,
+	}); err != nil {
+		err = fmt.Errorf("astibob: marshaling journal entry failed: %w", err)
+		return
+	}
+	b = append(b, '\n')
+
+	// Lock
+	j.m.Lock()
+	defer j.m.Unlock()
+
+	// Journal is closed
+	if j.f == nil {
+		return
+	}
+
+	// Rotate
+	if j.o.MaxSize > 0 && j.size > 0 && j.size+int64(len(b)) > j.o.MaxSize {
+		if err = j.rotate(); err != nil {
+			err = fmt.Errorf("astibob: rotating journal failed: %w", err)
+			return
+		}
+	}
+
+	// Write
+	var n int
+	n, err = j.f.Write(b)
+	j.size += int64(n)
+	if err != nil {
+		err = fmt.Errorf("astibob: writing to %s failed: %w", j.o.Path, err)
+		return
+	}
+	return
+}
+
+func (j *Journal) rotate() (err error) {
+	// Close file
+	if err = j.f.Close(); err != nil {
+		err = fmt.Errorf("astibob: closing %s failed: %w", j.o.Path, err)
+		return
+	}
+	j.f = nil
+
+	// Shift rotated files
+	// The oldest file is overwritten
+	for idx := j.o.MaxFiles - 1; idx >= 0; idx-- {
+		src := journalFilePath(j.o.Path, idx)
+		if err = os.Rename(src, journalFilePath(j.o.Path, idx+1)); err != nil && !os.IsNotExist(err) {
+			err = fmt.Errorf("astibob: renaming %s failed: %w", src, err)
+			return
+		}
+		err = nil
+	}
+
+	// Open file
+	if err = j.open(); err != nil {
+		err = fmt.Errorf("astibob: opening journal failed: %w", err)
+		return
+	}
+	return
+}
+
+func journalFilePath(path string, idx int) string {
+	if idx == 0 {
+		return path
+	}
+	return path + "." + strconv.Itoa(idx)
+}
+
+// JournalFilePaths returns the paths of the existing files of a journal from the oldest to the newest
+func JournalFilePaths(path string) (ps []string, err error) {
+	// Find the oldest rotated file
+	var idx int
+	for {
+		if _, err = os.Stat(journalFilePath(path, idx+1)); err != nil {
+			if os.IsNotExist(err) {
+				err = nil
+				break
+			}
+			err = fmt.Errorf("astibob: stating %s failed: %w", journalFilePath(path, idx+1), err)
+			return
+		}
+		idx++
+	}
+
+	// Loop through files
+	for ; idx >= 0; idx-- {
+		if _, err = os.Stat(journalFilePath(path, idx)); err != nil {
+			if os.IsNotExist(err) {
+				err = nil
+				continue
+			}
+			err = fmt.Errorf("astibob: stating %s failed: %w", journalFilePath(path, idx), err)
+			return
+		}
+		ps = append(ps, journalFilePath(path, idx))
+	}
+	return
+}
+
+// JournalFilter selects journal entries. Zero values match everything.
+type JournalFilter struct {
+	Direction string
+	From      string   // Runnable name pattern (e.g. "audio_*")
+	Names     []string // Message name patterns (e.g. "audio_input.*")
+	Since     time.Time
+	Until     time.Time
+	Worker    string // Worker name pattern of the sender
+}
+
+// Match checks whether the entry is selected by the filter
+func (f JournalFilter) Match(e JournalEntry) bool {
+	// Check direction
+	if f.Direction != "" && f.Direction != e.Direction {
+		return false
+	}
+
+	// Check time
+	if !f.Since.IsZero() && e.At.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.At.After(f.Until) {
+		return false
+	}
+
+	// Check from
+	if f.From != "" && (e.Message.From.Name == nil || !WildcardMatch(f.From, *e.Message.From.Name)) {
+		return false
+	}
+	if f.Worker != "" && !WildcardMatch(f.Worker, e.Message.From.WorkerName()) {
+		return false
+	}
+
+	// Check names
+	if len(f.Names) > 0 {
+		var found bool
+		for _, n := range f.Names {
+			if WildcardMatch(n, e.Message.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// JournalReader reads the entries of a journal and its rotated files in order
+type JournalReader struct {
+	d  *json.Decoder
+	f  JournalFilter
+	fs []*os.File
+}
+
+// NewJournalReader opens the files of a journal. Only entries matching the filter are returned.
+func NewJournalReader(path string, f JournalFilter) (r *JournalReader, err error) {
+	// Create reader
+	r = &JournalReader{f: f}
+
+	// Get paths
+	var ps []string
+	if ps, err = JournalFilePaths(path); err != nil {
+		err = fmt.Errorf("astibob: getting journal file paths failed: %w", err)
+		return
+	}
+
+	// No files
+	if len(ps) == 0 {
+		err = fmt.Errorf("astibob: no journal found at %s", path)
+		return
+	}
+
+	// Open files
+	var rs []io.Reader
+	for _, p := range ps {
+		var f *os.File
+		if f, err = os.Open(p); err != nil {
+			r.Close()
+			err = fmt.Errorf("astibob: opening %s failed: %w", p, err)
+			return
+		}
+		r.fs = append(r.fs, f)
+		rs = append(rs, f)
+	}
+
+	// Create decoder
+	r.d = json.NewDecoder(io.MultiReader(rs...))
+	return
+}
+
+// Close closes the journal files
+func (r *JournalReader) Close() {
+	for _, f := range r.fs {
+		f.Close()
+	}
+}
+
+// Next returns the next matching entry or io.EOF once there are no entries left
+func (r *JournalReader) Next() (e JournalEntry, err error) {
+	for {
+		// Decode
+		e = JournalEntry{}
+		if err = r.d.Decode(&e); err != nil {
+			if !errors.Is(err, io.EOF) {
+				err = fmt.Errorf("astibob: decoding journal entry failed: %w", err)
+			}
+			return
+		}
+
+		// Invalid entry
+		if e.Message == nil {
+			continue
+		}
+
+		// Check filter
+		if r.f.Match(e) {
+			return
+		}
+	}
+}
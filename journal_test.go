@@ -0,0 +1,84 @@
+package astibob
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	// Create dir
+	dir, err := ioutil.TempDir("", "astibob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Create journal
+	p := filepath.Join(dir, "journal.jsonl")
+	j, err := NewJournal(JournalOptions{MaxFiles: 2, MaxSize: 400, Path: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Record messages
+	for idx := 0; idx < 5; idx++ {
+		m := newMessage(*NewIndexIdentifier(), NewWorkerIdentifier("w1"), WorkerRegisteredMessage)
+		if err = m.MarshalPayload(Worker{Key: []byte("secret key"), Name: "w2"}); err != nil {
+			t.Fatal(err)
+		}
+		if err = j.Record(JournalDirectionInbound, m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	j.Close()
+
+	// Journal is only readable by its owner
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("expected mode 0600, got %s", fi.Mode().Perm())
+	}
+
+	// Files have been rotated
+	ps, err := JournalFilePaths(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 3 {
+		t.Fatalf("expected 3 files, got %v", ps)
+	}
+
+	// Read entries
+	r, err := NewJournalReader(p, JournalFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var count int
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		count++
+
+		// Keys are never written to disk
+		w, err := ParseWorkerRegisteredPayload(e.Message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Key != nil {
+			t.Fatalf("expected no key, got %q", w.Key)
+		}
+	}
+	if count == 0 {
+		t.Fatal("expected entries")
+	}
+}
@@ -3,8 +3,11 @@ package astibob
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/asticode/go-astikit"
+	"github.com/fxamacker/cbor/v2"
 )
 
 // Identifier types
@@ -15,40 +18,189 @@ const (
 	WorkerIdentifierType   = "worker"
 )
 
+// Index states
+const (
+	IndexStateConnected    = "connected"
+	IndexStateConnecting   = "connecting"
+	IndexStateDisconnected = "disconnected"
+)
+
+// Worker states as seen by the index
+const (
+	WorkerStateHealthy      = "healthy"
+	WorkerStateUnresponsive = "unresponsive" // Heartbeats have been missed or the connection has dropped
+)
+
+// Inspected message sources
+const (
+	InspectedSourceIndex  = "index"  // Message has been dispatched by the index
+	InspectedSourceMirror = "mirror" // Message has been sent from a worker to another and mirrored to the index
+)
+
 // Message names
 const (
-	ListenablesRegisterMessage  = "listenables.register"
-	RunnableCrashedMessage      = "runnable.crashed"
-	RunnableDoneMessage         = "runnable.done"
-	RunnableStartMessage        = "runnable.start"
-	RunnableStartedMessage      = "runnable.started"
-	RunnableStopMessage         = "runnable.stop"
-	RunnableStoppedMessage      = "runnable.stopped"
-	UIDisconnectedMessage       = "ui.disconnected"
-	UIMessageNamesAddMessage    = "ui.message.names.add"
-	UIMessageNamesDeleteMessage = "ui.message.names.delete"
-	UIPingMessage               = "ui.ping"
-	UIRegisterMessage           = "ui.register"
-	UIWelcomeMessage            = "ui.welcome"
-	WorkerDisconnectedMessage   = "worker.disconnected"
-	WorkerRegisterMessage       = "worker.register"
-	WorkerRegisteredMessage     = "worker.registered"
-	WorkerWelcomeMessage        = "worker.welcome"
+	InspectorMirrorMessage       = "inspector.mirror"
+	InspectorStateMessage        = "inspector.state"
+	ListenablesRegisterMessage   = "listenables.register"
+	RunnableConfigUpdateMessage  = "runnable.config.update"
+	RunnableConfigUpdatedMessage = "runnable.config.updated"
+	RunnableCrashedMessage       = "runnable.crashed"
+	RunnableDoneMessage          = "runnable.done"
+	RunnableStartMessage         = "runnable.start"
+	RunnableStartedMessage       = "runnable.started"
+	RunnableStartingMessage      = "runnable.starting"
+	RunnableStopMessage          = "runnable.stop"
+	RunnableStoppedMessage       = "runnable.stopped"
+	RunnableStoppingMessage      = "runnable.stopping"
+	UIDisconnectedMessage        = "ui.disconnected"
+	UIHistoryMessage             = "ui.history"
+	UIMessageNamesAddMessage     = "ui.message.names.add"
+	UIMessageNamesDeleteMessage  = "ui.message.names.delete"
+	UIPingMessage                = "ui.ping"
+	UIRegisterMessage            = "ui.register"
+	UIWelcomeMessage             = "ui.welcome"
+	WorkerDisconnectedMessage    = "worker.disconnected"
+	WorkerHeartbeatMessage       = "worker.heartbeat"
+	WorkerIndexStateMessage      = "worker.index.state"
+	WorkerRegisterMessage        = "worker.register"
+	WorkerRegisteredMessage      = "worker.registered"
+	WorkerStateMessage           = "worker.state"
+	WorkerWelcomeMessage         = "worker.welcome"
 )
 
 type Message struct {
-	From    Identifier      `json:"from"`
-	ID      int             `json:"id,omitempty"`
-	Name    string          `json:"name"`
-	Payload json.RawMessage `json:"payload,omitempty"`
-	To      *Identifier     `json:"to,omitempty"`
+	From         Identifier
+	ID           int
+	Name         string
+	Payload      []byte // Encoded with PayloadCodec
+	PayloadCodec string // Empty means JSON
+	Sequence     uint64 // Set by worker channels so that peers can ignore messages sent twice
+	To           *Identifier
+}
+
+type jsonMessage struct {
+	From     Identifier      `json:"from"`
+	ID       int             `json:"id,omitempty"`
+	Name     string          `json:"name"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Sequence uint64          `json:"sequence,omitempty"`
+	To       *Identifier     `json:"to,omitempty"`
+}
+
+type cborMessage struct {
+	From         Identifier  `cbor:"from"`
+	ID           int         `cbor:"id,omitempty"`
+	Name         string      `cbor:"name"`
+	Payload      []byte      `cbor:"payload,omitempty"`
+	PayloadCodec string      `cbor:"payload_codec,omitempty"`
+	Sequence     uint64      `cbor:"sequence,omitempty"`
+	To           *Identifier `cbor:"to,omitempty"`
+}
+
+func (m Message) MarshalJSON() (b []byte, err error) {
+	// Create message
+	o := jsonMessage{
+		From:     m.From,
+		ID:       m.ID,
+		Name:     m.Name,
+		Sequence: m.Sequence,
+		To:       m.To,
+	}
+
+	// Transcode payload
+	if o.Payload, err = transcodeToJSON(m.payloadCodec(), m.Payload); err != nil {
+		err = fmt.Errorf("astibob: transcoding payload failed: %w", err)
+		return
+	}
+	return json.Marshal(o)
+}
+
+func (m *Message) UnmarshalJSON(b []byte) (err error) {
+	// Unmarshal
+	var i jsonMessage
+	if err = json.Unmarshal(b, &i); err != nil {
+		return
+	}
+
+	// Update message
+	*m = Message{
+		From:     i.From,
+		ID:       i.ID,
+		Name:     i.Name,
+		Payload:  i.Payload,
+		Sequence: i.Sequence,
+		To:       i.To,
+	}
+	return
+}
+
+func (m Message) MarshalCBOR() ([]byte, error) {
+	return cbor.Marshal(cborMessage(m))
+}
+
+func (m *Message) UnmarshalCBOR(b []byte) (err error) {
+	// Unmarshal
+	var i cborMessage
+	if err = cbor.Unmarshal(b, &i); err != nil {
+		return
+	}
+
+	// Update message
+	*m = Message(i)
+	return
+}
+
+func (m *Message) payloadCodec() Codec {
+	if c, ok := CodecByName(m.PayloadCodec); ok {
+		return c
+	}
+	return JSONCodec
+}
+
+// MarshalPayload marshals the payload with the JSON codec
+func (m *Message) MarshalPayload(v interface{}) error {
+	return m.MarshalPayloadWithCodec(JSONCodec, v)
+}
+
+// MarshalPayloadWithCodec marshals the payload with a specific codec
+func (m *Message) MarshalPayloadWithCodec(c Codec, v interface{}) (err error) {
+	// Marshal
+	if m.Payload, err = c.Marshal(v); err != nil {
+		err = fmt.Errorf("astibob: marshaling %s payload failed: %w", c.Name(), err)
+		return
+	}
+
+	// Update codec
+	m.PayloadCodec = ""
+	if c.Name() != JSONCodecName {
+		m.PayloadCodec = c.Name()
+	}
+	return
+}
+
+// UnmarshalPayload unmarshals the payload with the codec it has been encoded with
+func (m *Message) UnmarshalPayload(v interface{}) (err error) {
+	// Get codec
+	c, ok := CodecByName(m.PayloadCodec)
+	if !ok {
+		err = fmt.Errorf("astibob: unknown payload codec %s", m.PayloadCodec)
+		return
+	}
+
+	// Unmarshal
+	if err = c.Unmarshal(m.Payload, v); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling %s payload failed: %w", c.Name(), err)
+		return
+	}
+	return
 }
 
 func (m *Message) Clone() (o *Message) {
 	// Create message
 	o = &Message{
-		From: *m.From.Clone(),
-		Name: m.Name,
+		From:         *m.From.Clone(),
+		Name:         m.Name,
+		PayloadCodec: m.PayloadCodec,
 	}
 
 	// Clone to
@@ -58,12 +210,66 @@ func (m *Message) Clone() (o *Message) {
 
 	// Clone payload
 	if len(m.Payload) > 0 {
-		o.Payload = make(json.RawMessage, len(m.Payload))
+		o.Payload = make([]byte, len(m.Payload))
 		copy(o.Payload, m.Payload)
 	}
 	return
 }
 
+// RedactMessage returns a copy of the message without the worker keys its payload may hold, so that it can be shown
+// to inspectors or written to disk. Other messages are returned as is.
+func RedactMessage(m *Message) (o *Message, err error) {
+	// Get payload
+	var v interface{}
+	switch m.Name {
+	case WorkerRegisteredMessage:
+		// Parse payload
+		var w Worker
+		if w, err = ParseWorkerRegisteredPayload(m); err != nil {
+			err = fmt.Errorf("astibob: parsing payload failed: %w", err)
+			return
+		}
+
+		// Redact
+		w.Key = nil
+		v = w
+	case WorkerWelcomeMessage:
+		// Parse payload
+		var w WelcomeWorker
+		if w, err = ParseWorkerWelcomePayload(m); err != nil {
+			err = fmt.Errorf("astibob: parsing payload failed: %w", err)
+			return
+		}
+
+		// Redact
+		w.IndexKey = nil
+		for idx := range w.Workers {
+			w.Workers[idx].Key = nil
+		}
+		v = w
+	default:
+		return m, nil
+	}
+
+	// Get codec
+	c, ok := CodecByName(m.PayloadCodec)
+	if !ok {
+		err = fmt.Errorf("astibob: unknown payload codec %s", m.PayloadCodec)
+		return
+	}
+
+	// Clone
+	o = m.Clone()
+	o.ID = m.ID
+
+	// Marshal payload
+	if err = o.MarshalPayloadWithCodec(c, v); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
 type Identifier struct {
 	Name   *string         `json:"name,omitempty"`
 	Type   string          `json:"type,omitempty"`
@@ -121,19 +327,62 @@ func (i Identifier) Clone() (o *Identifier) {
 	return
 }
 
+// When matching, Name and Worker may contain wildcards (e.g. "mic-*" or "kitchen-?")
 func (i *Identifier) match(id Identifier) bool {
 	// Check type
 	if !strOrMapMatch(astikit.StrPtr(i.Type), astikit.StrPtr(id.Type), i.Types, id.Types) {
 		return false
 	}
 
+	// Check name
+	if i.Name != nil && (id.Name == nil || !WildcardMatch(*i.Name, *id.Name)) {
+		return false
+	}
+
 	// Check worker
-	if i.Worker != nil && (id.Worker == nil || *i.Worker != *id.Worker) {
+	if i.Worker != nil && (id.Worker == nil || !WildcardMatch(*i.Worker, *id.Worker)) {
 		return false
 	}
 	return true
 }
 
+// WildcardMatch checks whether a name matches a pattern where "*" matches any sequence of characters and "?" matches
+// any single character
+func WildcardMatch(pattern, name string) bool {
+	// No wildcards
+	if !strings.ContainsAny(pattern, "*?") {
+		return pattern == name
+	}
+
+	// Loop through name
+	p, n := []rune(pattern), []rune(name)
+	var ip, in int
+	star, mark := -1, 0
+	for in < len(n) {
+		if ip < len(p) && (p[ip] == '?' || (p[ip] != '*' && p[ip] == n[in])) {
+			ip++
+			in++
+		} else if ip < len(p) && p[ip] == '*' {
+			star = ip
+			mark = in
+			ip++
+		} else if star != -1 {
+			// Let the last star absorb one more character
+			ip = star + 1
+			mark++
+			in = mark
+		} else {
+			return false
+		}
+	}
+
+	// Only trailing stars may remain
+	for ip < len(p) && p[ip] == '*' {
+		ip++
+	}
+	return ip == len(p)
+}
+
 func strOrMapMatch(srcStr, dstStr *string, srcMap, dstMap map[string]bool) bool {
 	if srcMap != nil {
 		if dstMap != nil {
@@ -164,6 +413,14 @@ func strOrMapMatch(srcStr, dstStr *string, srcMap, dstMap map[string]bool) bool
 	return true
 }
 
+// RunnableName returns the name of the runnable or an empty string if the identifier is not a runnable identifier
+func (i Identifier) RunnableName() string {
+	if i.Type == RunnableIdentifierType && i.Name != nil {
+		return *i.Name
+	}
+	return ""
+}
+
 func (i Identifier) WorkerName() string {
 	switch i.Type {
 	case RunnableIdentifierType:
@@ -189,20 +446,49 @@ type UI struct {
 }
 
 type WelcomeWorker struct {
+	Codec string `json:"codec,omitempty"` // Codec the index uses to communicate with the worker
+	// Period at which the index expects heartbeats. Zero means the index doesn't expect any.
+	HeartbeatPeriod time.Duration `json:"heartbeat_period,omitempty"`
+	// Key the index signs its requests to the worker with
+	IndexKey       []byte   `json:"index_key,omitempty"`
+	Inspected      bool     `json:"inspected,omitempty"` // Whether inspectors are connected to the index
 	UIMessageNames []string `json:"ui_message_names,omitempty"`
 	Workers        []Worker `json:"workers,omitempty"`
 }
 
 type Worker struct {
-	Addr      string            `json:"addr,omitempty"`
-	Name      string            `json:"name"`
-	Runnables []RunnableMessage `json:"runnables,omitempty"`
+	Addr      string     `json:"addr,omitempty"`
+	Codecs    []string   `json:"codecs,omitempty"`    // Codecs the worker supports in order of preference
+	Heartbeat *Heartbeat `json:"heartbeat,omitempty"` // Latest heartbeat received by the index, without runnables
+	// Whether the worker sends heartbeats. Workers that don't, such as older ones, are not checked for liveness.
+	Heartbeats bool   `json:"heartbeats,omitempty"`
+	Key        []byte `json:"key,omitempty"` // Key shared with the recipient to sign worker-to-worker messages
+	// Messages the worker listens to
+	Listenables []ListenableSubscription `json:"listenables,omitempty"`
+	Name        string                   `json:"name"`
+	Runnables   []RunnableMessage        `json:"runnables,omitempty"`
+	State       string                   `json:"state,omitempty"` // Only set by the index
+}
+
+// Heartbeat is sent periodically by workers so that the index can tell hung workers apart from healthy ones. It
+// goes through the worker dispatcher like any other message, which therefore needs to be responsive.
+type Heartbeat struct {
+	Goroutines     int               `json:"goroutines"`
+	HeapAlloc      uint64            `json:"heap_alloc"`      // Bytes of allocated heap objects
+	QueuedMessages int               `json:"queued_messages"` // Messages waiting in the dispatcher queues
+	Runnables      []RunnableMessage `json:"runnables,omitempty"`
+	SentAt         time.Time         `json:"sent_at"`
 }
 
 type RunnableMessage struct {
 	Metadata
-	Status      string `json:"status"`
-	WebHomepage string `json:"web_homepage,omitempty"`
+	Configurable bool          `json:"configurable,omitempty"`
+	LastError    string        `json:"last_error,omitempty"`
+	Restarts     int           `json:"restarts,omitempty"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	Status       string        `json:"status"`
+	Uptime       time.Duration `json:"uptime,omitempty"` // Only set for running runnables
+	WebHomepage  string        `json:"web_homepage,omitempty"`
 }
 
 type Metadata struct {
@@ -211,17 +497,81 @@ type Metadata struct {
 }
 
 type Error struct {
+	Code    string `json:"code,omitempty"`
 	Message string `json:"message"`
 }
 
+func NewError(code, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+func (e *Error) Error() string {
+	if e.Code != "" {
+		return e.Code + ": " + e.Message
+	}
+	return e.Message
+}
+
 type Listenables struct {
 	Names    []string `json:"names"`
 	Runnable string   `json:"runnable"`
 }
 
+// ListenableSubscription represents the messages a worker listens to. Runnable and Worker may contain wildcards.
+type ListenableSubscription struct {
+	Names    []string `json:"names"`
+	Runnable string   `json:"runnable"`
+	Worker   string   `json:"worker"`
+}
+
 type RunnableDone struct {
-	ID      int  `json:"id"`
-	Success bool `json:"success"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      int             `json:"id"`
+	Reply   json.RawMessage `json:"reply,omitempty"`
+	Success bool            `json:"success"`
+}
+
+// RunnableConfig is what the worker exposes about a configurable runnable
+type RunnableConfig struct {
+	Config Config       `json:"config"`
+	Schema ConfigSchema `json:"schema"`
+}
+
+// RunnableConfigUpdate asks a worker to update the config of one of its runnables. Missing fields keep their value.
+type RunnableConfigUpdate struct {
+	Config   Config `json:"config"`
+	Runnable string `json:"runnable"`
+}
+
+type RunnableCrashed struct {
+	Error string `json:"error"`
+	Stack string `json:"stack,omitempty"` // Only set when the runnable has panicked
+}
+
+type RunnableStarted struct {
+	Restarts  int       `json:"restarts,omitempty"` // Number of times the runnable has been restarted by its supervisor
+	StartedAt time.Time `json:"started_at"`
+}
+
+// InspectedMessage is sent to inspectors
+type InspectedMessage struct {
+	At      time.Time `json:"at"`
+	Message *Message  `json:"message"`
+	Source  string    `json:"source"`
+}
+
+// HistoryEvent is an event kept by the index and replayed to UIs registering afterwards
+type HistoryEvent struct {
+	At      time.Time `json:"at"`
+	Message *Message  `json:"message"`
+}
+
+type IndexState struct {
+	Error string `json:"error,omitempty"`
+	State string `json:"state"`
 }
 
 func NewMessage() *Message {
@@ -236,12 +586,53 @@ func newMessage(from Identifier, to *Identifier, name string) *Message {
 	return m
 }
 
+func NewInspectorMirrorMessage(from Identifier, to *Identifier, mirrored *Message) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, InspectorMirrorMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(mirrored); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseInspectorMirrorPayload(m *Message) (mirrored *Message, err error) {
+	mirrored = NewMessage()
+	if err = m.UnmarshalPayload(mirrored); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewInspectorStateMessage(from Identifier, to *Identifier, inspected bool) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, InspectorStateMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(inspected); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseInspectorStatePayload(m *Message) (inspected bool, err error) {
+	if err = m.UnmarshalPayload(&inspected); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
 func NewListenablesRegisterMessage(from Identifier, to *Identifier, l Listenables) (m *Message, err error) {
 	// Create message
 	m = newMessage(from, to, ListenablesRegisterMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(l); err != nil {
+	if err = m.MarshalPayload(l); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -249,7 +640,7 @@ func NewListenablesRegisterMessage(from Identifier, to *Identifier, l Listenable
 }
 
 func ParseListenablesRegisterPayload(m *Message) (l Listenables, err error) {
-	if err = json.Unmarshal(m.Payload, &l); err != nil {
+	if err = m.UnmarshalPayload(&l); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -257,7 +648,7 @@ func ParseListenablesRegisterPayload(m *Message) (l Listenables, err error) {
 }
 
 func ParseRunnableStartPayload(m *Message) (name string, err error) {
-	if err = json.Unmarshal(m.Payload, &name); err != nil {
+	if err = m.UnmarshalPayload(&name); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -265,15 +656,71 @@ func ParseRunnableStartPayload(m *Message) (name string, err error) {
 }
 
 func ParseRunnableStopPayload(m *Message) (name string, err error) {
-	if err = json.Unmarshal(m.Payload, &name); err != nil {
+	if err = m.UnmarshalPayload(&name); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewRunnableConfigUpdateMessage(from Identifier, to *Identifier, u RunnableConfigUpdate) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, RunnableConfigUpdateMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(u); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseRunnableConfigUpdatePayload(m *Message) (u RunnableConfigUpdate, err error) {
+	if err = m.UnmarshalPayload(&u); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewRunnableConfigUpdatedMessage(from Identifier, to *Identifier, c Config) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, RunnableConfigUpdatedMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(c); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseRunnableConfigUpdatedPayload(m *Message) (c Config, err error) {
+	if err = m.UnmarshalPayload(&c); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
 	return
 }
 
-func NewRunnableCrashedMessage(from Identifier, to *Identifier) *Message {
-	return newMessage(from, to, RunnableCrashedMessage)
+func NewRunnableCrashedMessage(from Identifier, to *Identifier, c RunnableCrashed) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, RunnableCrashedMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(c); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseRunnableCrashedPayload(m *Message) (c RunnableCrashed, err error) {
+	if err = m.UnmarshalPayload(&c); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
 }
 
 func NewRunnableDoneMessage(to *Identifier, d RunnableDone) (m *Message, err error) {
@@ -281,7 +728,7 @@ func NewRunnableDoneMessage(to *Identifier, d RunnableDone) (m *Message, err err
 	m = newMessage(Identifier{}, to, RunnableDoneMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(d); err != nil {
+	if err = m.MarshalPayload(d); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -289,27 +736,51 @@ func NewRunnableDoneMessage(to *Identifier, d RunnableDone) (m *Message, err err
 }
 
 func ParseRunnableDonePayload(m *Message) (d RunnableDone, err error) {
-	if err = json.Unmarshal(m.Payload, &d); err != nil {
+	if err = m.UnmarshalPayload(&d); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
 	return
 }
 
-func NewRunnableStartedMessage(from Identifier, to *Identifier) *Message {
-	return newMessage(from, to, RunnableStartedMessage)
+func NewRunnableStartedMessage(from Identifier, to *Identifier, s RunnableStarted) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, RunnableStartedMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(s); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseRunnableStartedPayload(m *Message) (s RunnableStarted, err error) {
+	if err = m.UnmarshalPayload(&s); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewRunnableStartingMessage(from Identifier, to *Identifier) *Message {
+	return newMessage(from, to, RunnableStartingMessage)
 }
 
 func NewRunnableStoppedMessage(from Identifier, to *Identifier) *Message {
 	return newMessage(from, to, RunnableStoppedMessage)
 }
 
+func NewRunnableStoppingMessage(from Identifier, to *Identifier) *Message {
+	return newMessage(from, to, RunnableStoppingMessage)
+}
+
 func NewUIDisconnectedMessage(from Identifier, to *Identifier, name string) (m *Message, err error) {
 	// Create message
 	m = newMessage(from, to, UIDisconnectedMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(name); err != nil {
+	if err = m.MarshalPayload(name); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -317,7 +788,7 @@ func NewUIDisconnectedMessage(from Identifier, to *Identifier, name string) (m *
 }
 
 func ParseUIDisconnectedPayload(m *Message) (name string, err error) {
-	if err = json.Unmarshal(m.Payload, &name); err != nil {
+	if err = m.UnmarshalPayload(&name); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -329,7 +800,7 @@ func NewUIMessageNamesAddMessage(from Identifier, to *Identifier, names []string
 	m = newMessage(from, to, UIMessageNamesAddMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(names); err != nil {
+	if err = m.MarshalPayload(names); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -337,7 +808,7 @@ func NewUIMessageNamesAddMessage(from Identifier, to *Identifier, names []string
 }
 
 func ParseUIMessageNamesAddPayload(m *Message) (names []string, err error) {
-	if err = json.Unmarshal(m.Payload, &names); err != nil {
+	if err = m.UnmarshalPayload(&names); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -349,7 +820,7 @@ func NewUIMessageNamesDeleteMessage(from Identifier, to *Identifier, names []str
 	m = newMessage(from, to, UIMessageNamesDeleteMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(names); err != nil {
+	if err = m.MarshalPayload(names); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -357,7 +828,7 @@ func NewUIMessageNamesDeleteMessage(from Identifier, to *Identifier, names []str
 }
 
 func ParseUIMessageNamesDeletePayload(m *Message) (names []string, err error) {
-	if err = json.Unmarshal(m.Payload, &names); err != nil {
+	if err = m.UnmarshalPayload(&names); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -365,7 +836,27 @@ func ParseUIMessageNamesDeletePayload(m *Message) (names []string, err error) {
 }
 
 func ParseUIRegisterPayload(m *Message) (u UI, err error) {
-	if err = json.Unmarshal(m.Payload, &u); err != nil {
+	if err = m.UnmarshalPayload(&u); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewUIHistoryMessage(from Identifier, to *Identifier, es []HistoryEvent) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, UIHistoryMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(es); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseUIHistoryPayload(m *Message) (es []HistoryEvent, err error) {
+	if err = m.UnmarshalPayload(&es); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -377,7 +868,7 @@ func NewUIWelcomeMessage(from Identifier, to *Identifier, w WelcomeUI) (m *Messa
 	m = newMessage(from, to, UIWelcomeMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(w); err != nil {
+	if err = m.MarshalPayload(w); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -389,7 +880,7 @@ func NewWorkerDisconnectedMessage(from Identifier, to *Identifier, worker string
 	m = newMessage(from, to, WorkerDisconnectedMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(worker); err != nil {
+	if err = m.MarshalPayload(worker); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -397,7 +888,47 @@ func NewWorkerDisconnectedMessage(from Identifier, to *Identifier, worker string
 }
 
 func ParseWorkerDisconnectedPayload(m *Message) (worker string, err error) {
-	if err = json.Unmarshal(m.Payload, &worker); err != nil {
+	if err = m.UnmarshalPayload(&worker); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewWorkerHeartbeatMessage(from Identifier, to *Identifier, h Heartbeat) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, WorkerHeartbeatMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(h); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseWorkerHeartbeatPayload(m *Message) (h Heartbeat, err error) {
+	if err = m.UnmarshalPayload(&h); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewWorkerIndexStateMessage(from Identifier, to *Identifier, s IndexState) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, WorkerIndexStateMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(s); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseWorkerIndexStatePayload(m *Message) (s IndexState, err error) {
+	if err = m.UnmarshalPayload(&s); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -409,7 +940,7 @@ func NewWorkerRegisterMessage(from Identifier, to *Identifier, w Worker) (m *Mes
 	m = newMessage(from, to, WorkerRegisterMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(w); err != nil {
+	if err = m.MarshalPayload(w); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -417,7 +948,7 @@ func NewWorkerRegisterMessage(from Identifier, to *Identifier, w Worker) (m *Mes
 }
 
 func ParseWorkerRegisterPayload(m *Message) (w Worker, err error) {
-	if err = json.Unmarshal(m.Payload, &w); err != nil {
+	if err = m.UnmarshalPayload(&w); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -429,7 +960,7 @@ func NewWorkerRegisteredMessage(from Identifier, to *Identifier, w Worker) (m *M
 	m = newMessage(from, to, WorkerRegisteredMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(w); err != nil {
+	if err = m.MarshalPayload(w); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -437,7 +968,27 @@ func NewWorkerRegisteredMessage(from Identifier, to *Identifier, w Worker) (m *M
 }
 
 func ParseWorkerRegisteredPayload(m *Message) (w Worker, err error) {
-	if err = json.Unmarshal(m.Payload, &w); err != nil {
+	if err = m.UnmarshalPayload(&w); err != nil {
+		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
+		return
+	}
+	return
+}
+
+func NewWorkerStateMessage(from Identifier, to *Identifier, w Worker) (m *Message, err error) {
+	// Create message
+	m = newMessage(from, to, WorkerStateMessage)
+
+	// Marshal payload
+	if err = m.MarshalPayload(w); err != nil {
+		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
+		return
+	}
+	return
+}
+
+func ParseWorkerStatePayload(m *Message) (w Worker, err error) {
+	if err = m.UnmarshalPayload(&w); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
@@ -449,7 +1000,7 @@ func NewWorkerWelcomeMessage(from Identifier, to *Identifier, w WelcomeWorker) (
 	m = newMessage(from, to, WorkerWelcomeMessage)
 
 	// Marshal payload
-	if m.Payload, err = json.Marshal(w); err != nil {
+	if err = m.MarshalPayload(w); err != nil {
 		err = fmt.Errorf("astibob: marshaling payload failed: %w", err)
 		return
 	}
@@ -457,7 +1008,7 @@ func NewWorkerWelcomeMessage(from Identifier, to *Identifier, w WelcomeWorker) (
 }
 
 func ParseWorkerWelcomePayload(m *Message) (w WelcomeWorker, err error) {
-	if err = json.Unmarshal(m.Payload, &w); err != nil {
+	if err = m.UnmarshalPayload(&w); err != nil {
 		err = fmt.Errorf("astibob: unmarshaling failed: %w", err)
 		return
 	}
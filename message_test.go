@@ -0,0 +1,108 @@
+package astibob
+
+import (
+	"testing"
+
+	"github.com/asticode/go-astikit"
+)
+
+func TestRedactMessage(t *testing.T) {
+	// Loop through codecs
+	for _, c := range []Codec{CBORCodec, JSONCodec} {
+		// Registered
+		m := newMessage(*NewIndexIdentifier(), NewWorkerIdentifier("w1"), WorkerRegisteredMessage)
+		if err := m.MarshalPayloadWithCodec(c, Worker{Key: []byte("key"), Name: "w2"}); err != nil {
+			t.Fatal(err)
+		}
+		o, err := RedactMessage(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w, err := ParseWorkerRegisteredPayload(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w.Key != nil || w.Name != "w2" {
+			t.Fatalf("%s: expected redacted w2, got %+v", c.Name(), w)
+		}
+		if o.PayloadCodec != m.PayloadCodec {
+			t.Fatalf("%s: expected payload codec %q, got %q", c.Name(), m.PayloadCodec, o.PayloadCodec)
+		}
+
+		// Original message is untouched
+		if w, _ = ParseWorkerRegisteredPayload(m); string(w.Key) != "key" {
+			t.Fatalf("%s: original message has been modified", c.Name())
+		}
+
+		// Welcome
+		m = newMessage(*NewIndexIdentifier(), NewWorkerIdentifier("w1"), WorkerWelcomeMessage)
+		if err = m.MarshalPayloadWithCodec(c, WelcomeWorker{IndexKey: []byte("key"), Workers: []Worker{{Key: []byte("key"), Name: "w2"}}}); err != nil {
+			t.Fatal(err)
+		}
+		if o, err = RedactMessage(m); err != nil {
+			t.Fatal(err)
+		}
+		wl, err := ParseWorkerWelcomePayload(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if wl.IndexKey != nil || len(wl.Workers) != 1 || wl.Workers[0].Key != nil {
+			t.Fatalf("%s: expected redacted keys, got %+v", c.Name(), wl)
+		}
+	}
+
+	// Other messages are returned as is
+	m := newMessage(*NewIndexIdentifier(), nil, RunnableStartMessage)
+	if o, err := RedactMessage(m); err != nil || o != m {
+		t.Fatalf("expected same message, got %p (%v)", o, err)
+	}
+}
+
+func TestWildcardMatch(t *testing.T) {
+	for _, v := range []struct {
+		e       bool
+		name    string
+		pattern string
+	}{
+		{e: true, name: "audio_input.samples", pattern: "audio_input.samples"},
+		{e: false, name: "audio_input.samples", pattern: "audio_input.sample"},
+		{e: true, name: "audio_input.samples", pattern: "audio_input.*"},
+		{e: true, name: "audio_input.", pattern: "audio_input.*"},
+		{e: false, name: "audio_output.samples", pattern: "audio_input.*"},
+		{e: true, name: "anything", pattern: "*"},
+		{e: true, name: "", pattern: "*"},
+		{e: true, name: "mic-1", pattern: "mic-?"},
+		{e: false, name: "mic-12", pattern: "mic-?"},
+		{e: true, name: "kitchen/mic-12", pattern: "*/mic-*"},
+		{e: true, name: "a.b.c.d", pattern: "a.*.d"},
+		{e: false, name: "a.b.c.e", pattern: "a.*.d"},
+		{e: true, name: "aaab", pattern: "*a*b"},
+		{e: false, name: "aaa", pattern: "*a*b"},
+		{e: true, name: "été", pattern: "?t?"},
+	} {
+		if r := WildcardMatch(v.pattern, v.name); r != v.e {
+			t.Errorf("%q with %q: expected %v, got %v", v.name, v.pattern, v.e, r)
+		}
+	}
+}
+
+func TestDispatchConditionsWildcards(t *testing.T) {
+	c := DispatchConditions{From: &Identifier{
+		Name:   astikit.StrPtr("mic-*"),
+		Type:   RunnableIdentifierType,
+		Worker: astikit.StrPtr("kitchen-*"),
+	}}
+	for _, v := range []struct {
+		e    bool
+		from *Identifier
+	}{
+		{e: true, from: NewRunnableIdentifier("mic-1", "kitchen-1")},
+		{e: false, from: NewRunnableIdentifier("speaker-1", "kitchen-1")},
+		{e: false, from: NewRunnableIdentifier("mic-1", "bedroom-1")},
+		{e: false, from: NewWorkerIdentifier("kitchen-1")},
+	} {
+		if r := c.match(newMessage(*v.from, nil, "test")); r != v.e {
+			t.Errorf("%+v: expected %v, got %v", v.from, v.e, r)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package astibob
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var runnableStatuses = []string{CrashedStatus, RunningStatus, StartingStatus, StoppedStatus, StoppingStatus, UnknownStatus}
+
+var (
+	dispatcherDroppedDesc = prometheus.NewDesc(
+		"astibob_dispatcher_dropped_messages_total",
+		"Number of messages dropped by bounded dispatcher queues or rate limits.",
+		[]string{"name"}, nil,
+	)
+	dispatcherQueuedDesc = prometheus.NewDesc(
+		"astibob_dispatcher_queue_length",
+		"Number of messages waiting in dispatcher queues.",
+		[]string{"key"}, nil,
+	)
+	runnableStatusDesc = prometheus.NewDesc(
+		"astibob_runnable_status",
+		"Whether a runnable is in a status (1) or not (0).",
+		[]string{"worker", "runnable", "status"}, nil,
+	)
+)
+
+// Metrics gathers the Prometheus metrics of an index or a worker. Each of them has its own registry so that several
+// of them can live in the same process.
+type Metrics struct {
+	dispatched *prometheus.CounterVec
+	handled    *prometheus.HistogramVec
+	r          *prometheus.Registry
+}
+
+// NewMetrics creates metrics including Go runtime and process metrics
+func NewMetrics() (m *Metrics) {
+	// Create metrics
+	m = &Metrics{
+		dispatched: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Help: "Number of dispatched messages. Inbound messages are dispatched to handlers, outbound messages are emitted by runnables.",
+			Name: "astibob_dispatched_messages_total",
+		}, []string{"name", "direction"}),
+		handled: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10),
+			Help:    "Duration of message handlers in seconds.",
+			Name:    "astibob_handler_duration_seconds",
+		}, []string{"name"}),
+		r: prometheus.NewRegistry(),
+	}
+
+	// Register collectors
+	m.r.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.dispatched,
+		m.handled,
+	)
+	return
+}
+
+// Register adds collectors to the metrics
+func (m *Metrics) Register(cs ...prometheus.Collector) (err error) {
+	for _, c := range cs {
+		if err = m.r.Register(c); err != nil {
+			err = fmt.Errorf("astibob: registering collector failed: %w", err)
+			return
+		}
+	}
+	return
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.r, promhttp.HandlerOpts{})
+}
+
+type dispatcherCollector struct {
+	d *Dispatcher
+}
+
+func (c dispatcherCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dispatcherDroppedDesc
+	ch <- dispatcherQueuedDesc
+}
+
+func (c dispatcherCollector) Collect(ch chan<- prometheus.Metric) {
+	// Get stats
+	s := c.d.Stats()
+
+	// Loop through dropped messages
+	for n, v := range s.Dropped {
+		ch <- prometheus.MustNewConstMetric(dispatcherDroppedDesc, prometheus.CounterValue, float64(v), n)
+	}
+
+	// Loop through queues
+	for k, v := range s.Queued {
+		ch <- prometheus.MustNewConstMetric(dispatcherQueuedDesc, prometheus.GaugeValue, float64(v), k)
+	}
+}
+
+// RunnableStatusesFunc returns runnable statuses indexed by worker --> runnable
+type RunnableStatusesFunc func() map[string]map[string]string
+
+type runnableStatusCollector struct {
+	fn RunnableStatusesFunc
+}
+
+// NewRunnableStatusCollector exposes runnable statuses as one gauge per status
+func NewRunnableStatusCollector(fn RunnableStatusesFunc) prometheus.Collector {
+	return runnableStatusCollector{fn: fn}
+}
+
+func (c runnableStatusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- runnableStatusDesc
+}
+
+func (c runnableStatusCollector) Collect(ch chan<- prometheus.Metric) {
+	// Loop through workers
+	for w, rs := range c.fn() {
+		// Loop through runnables
+		for r, status := range rs {
+			// Loop through statuses
+			for _, s := range runnableStatuses {
+				var v float64
+				if s == status {
+					v = 1
+				}
+				ch <- prometheus.MustNewConstMetric(runnableStatusDesc, prometheus.GaugeValue, v, w, r, s)
+			}
+		}
+	}
+}
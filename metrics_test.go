@@ -0,0 +1,90 @@
+package astibob
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astikit"
+)
+
+// scrapeMetrics returns the metrics in the Prometheus exposition format
+func scrapeMetrics(t *testing.T, h http.Handler) string {
+	t.Helper()
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	b, err := ioutil.ReadAll(rw.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func checkMetrics(t *testing.T, h http.Handler, lines ...string) {
+	t.Helper()
+	s := scrapeMetrics(t, h)
+	for _, l := range lines {
+		if !strings.Contains(s, "\n"+l+"\n") {
+			t.Errorf("metrics don't contain %s", l)
+		}
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	d, w := newTestDispatcher()
+	defer closeTestDispatcher(d, w)
+	mt := NewMetrics()
+	d.SetMetrics(mt)
+
+	// Block the queue
+	block := make(chan bool)
+	d.On(DispatchConditions{Name: astikit.StrPtr("block")}, func(*Message) error {
+		<-block
+		return nil
+	})
+	d.On(DispatchConditions{Names: map[string]bool{"limited": true, "test": true}}, func(*Message) error { return nil })
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "block"))
+	for idx := 0; idx < 100 && d.Stats().Queued["default"] > 0; idx++ {
+		time.Sleep(time.Millisecond)
+	}
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "test"))
+
+	// Queue lengths
+	checkMetrics(t, mt.Handler(), `astibob_dispatcher_queue_length{key="default"} 1`)
+
+	// Unblock
+	close(block)
+	waitForDispatcher(t, d)
+
+	// Rate limits
+	d.UseMessage(MessageMiddlewareRateLimit(map[string]RateLimit{"limited": {Burst: 1}}))
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "limited"))
+	d.Dispatch(newMessage(*NewIndexIdentifier(), nil, "limited"))
+	waitForDispatcher(t, d)
+
+	// Outbound messages
+	d.Outbound(func(*Message) error { return nil })(newMessage(*NewIndexIdentifier(), nil, "out"))
+
+	// Runnable statuses
+	if err := mt.Register(NewRunnableStatusCollector(func() map[string]map[string]string {
+		return map[string]map[string]string{"w": {"r": RunningStatus}}
+	})); err != nil {
+		t.Fatal(err)
+	}
+
+	// Check
+	checkMetrics(t, mt.Handler(),
+		`astibob_dispatched_messages_total{direction="in",name="test"} 1`,
+		`astibob_dispatched_messages_total{direction="in",name="limited"} 2`,
+		`astibob_dispatched_messages_total{direction="out",name="out"} 1`,
+		`astibob_dispatcher_dropped_messages_total{name="limited"} 1`,
+		`astibob_dispatcher_queue_length{key="default"} 0`,
+		`astibob_handler_duration_seconds_count{name="test"} 1`,
+		`astibob_handler_duration_seconds_count{name="limited"} 1`,
+		`astibob_runnable_status{runnable="r",status="running",worker="w"} 1`,
+		`astibob_runnable_status{runnable="r",status="stopped",worker="w"} 0`,
+	)
+}
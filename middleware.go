@@ -0,0 +1,77 @@
+package astibob
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/asticode/go-astikit"
+)
+
+// MessageMiddleware wraps a message handler to add cross-cutting behaviors such as logging or panic recovery
+type MessageMiddleware func(h MessageHandler) MessageHandler
+
+// chainMessageMiddlewares wraps the handler so that the first middleware is executed first
+func chainMessageMiddlewares(h MessageHandler, ms []MessageMiddleware) MessageHandler {
+	for idx := len(ms) - 1; idx >= 0; idx-- {
+		h = ms[idx](h)
+	}
+	return h
+}
+
+// MessageMiddlewareRecover turns handler panics into *PanicError errors
+func MessageMiddlewareRecover() MessageMiddleware {
+	return func(h MessageHandler) MessageHandler {
+		return func(m *Message) (err error) {
+			// Recover from panics
+			defer func() {
+				if v := recover(); v != nil {
+					err = &PanicError{
+						Stack: string(debug.Stack()),
+						Value: v,
+					}
+				}
+			}()
+
+			// Handle
+			return h(m)
+		}
+	}
+}
+
+// MessageMiddlewareSlowHandler logs handlers taking longer than the threshold
+func MessageMiddlewareSlowHandler(threshold time.Duration, l astikit.StdLogger) MessageMiddleware {
+	sl := astikit.AdaptStdLogger(l)
+	return func(h MessageHandler) MessageHandler {
+		return func(m *Message) error {
+			// Handle
+			n := time.Now()
+			err := h(m)
+
+			// Handler is slow
+			if d := time.Since(n); d > threshold {
+				sl.Infof("astibob: handling message %s took %s", m.Name, d)
+			}
+			return err
+		}
+	}
+}
+
+// MessageMiddlewareRateLimit drops messages exceeding the rate limit of their name and returns ErrRateLimitExceeded
+// instead. Limits are indexed by message name pattern (e.g. "audio_input.*") and each message name has its own bucket.
+// Buckets are shared by the handlers the middleware wraps, therefore add it with UseMessage for messages to be counted
+// once whatever the number of their handlers.
+func MessageMiddlewareRateLimit(ls map[string]RateLimit) MessageMiddleware {
+	l := newRateLimiter(ls)
+	return func(h MessageHandler) MessageHandler {
+		return func(m *Message) error {
+			// Rate limit has been exceeded
+			if !l.allowed(m.Name) {
+				return fmt.Errorf("astibob: dropping message %s: %w", m.Name, ErrRateLimitExceeded)
+			}
+
+			// Handle
+			return h(m)
+		}
+	}
+}
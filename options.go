@@ -1,7 +1,152 @@
 package astibob
 
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+)
+
 type ServerOptions struct {
-	Addr     string `toml:"addr"`
-	Password string `toml:"password"`
+	Addr string `toml:"addr"`
+	// Servers require client certificates signed by this CA whereas clients verify servers with it
+	CACert string `toml:"ca_cert"`
+	Cert   string `toml:"cert"`
+	Key    string `toml:"key"`
+	// Serves on this listener instead of listening on Addr, which is still used to reach the server. Useful to serve
+	// in memory.
+	Listener net.Listener `toml:"-"`
+	Password string       `toml:"password"`
+	// Enables TLS when none of the files above is needed, e.g. to connect to a server with a publicly trusted certificate
+	TLS      bool   `toml:"tls"`
 	Username string `toml:"username"`
 }
+
+// DialFunc dials connections to servers
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// UseTLS indicates whether TLS is in use
+func (o ServerOptions) UseTLS() bool {
+	return o.TLS || o.Cert != "" || o.CACert != ""
+}
+
+// HTTPScheme returns the HTTP scheme in use
+func (o ServerOptions) HTTPScheme() string {
+	if o.UseTLS() {
+		return "https"
+	}
+	return "http"
+}
+
+// WebsocketScheme returns the websocket scheme in use
+func (o ServerOptions) WebsocketScheme() string {
+	if o.UseTLS() {
+		return "wss"
+	}
+	return "ws"
+}
+
+// ServerTLSConfig returns the TLS configuration used to serve or nil if TLS is not in use
+func (o ServerOptions) ServerTLSConfig() (c *tls.Config, err error) {
+	// TLS is not in use
+	if !o.UseTLS() {
+		return
+	}
+
+	// No certificate
+	if o.Cert == "" || o.Key == "" {
+		err = errors.New("astibob: serving with TLS requires a cert and a key")
+		return
+	}
+
+	// Load certificate
+	var crt tls.Certificate
+	if crt, err = tls.LoadX509KeyPair(o.Cert, o.Key); err != nil {
+		err = fmt.Errorf("astibob: loading key pair failed: %w", err)
+		return
+	}
+
+	// Create config
+	c = &tls.Config{Certificates: []tls.Certificate{crt}}
+
+	// Mutual TLS
+	if o.CACert != "" {
+		if c.ClientCAs, err = loadCertPool(o.CACert); err != nil {
+			err = fmt.Errorf("astibob: loading cert pool failed: %w", err)
+			return
+		}
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return
+}
+
+// ClientTLSConfig returns the TLS configuration used to connect to servers configured with any of the provided
+// options or nil if none of them uses TLS. CAs are all trusted and certificates are presented to servers requiring them.
+func ClientTLSConfig(os ...ServerOptions) (c *tls.Config, err error) {
+	for _, o := range os {
+		// TLS is not in use
+		if !o.UseTLS() {
+			continue
+		}
+
+		// Create config
+		if c == nil {
+			c = &tls.Config{}
+		}
+
+		// Add CA
+		if o.CACert != "" {
+			// Create pool
+			// We start from the system pool so that servers with publicly trusted certificates are still verified
+			if c.RootCAs == nil {
+				if c.RootCAs, err = x509.SystemCertPool(); err != nil {
+					c.RootCAs = x509.NewCertPool()
+				}
+			}
+
+			// Append
+			if err = appendCertPool(c.RootCAs, o.CACert); err != nil {
+				err = fmt.Errorf("astibob: appending to cert pool failed: %w", err)
+				return
+			}
+		}
+
+		// Add certificate
+		if o.Cert != "" && o.Key != "" {
+			var crt tls.Certificate
+			if crt, err = tls.LoadX509KeyPair(o.Cert, o.Key); err != nil {
+				err = fmt.Errorf("astibob: loading key pair failed: %w", err)
+				return
+			}
+			c.Certificates = append(c.Certificates, crt)
+		}
+	}
+	return
+}
+
+func loadCertPool(path string) (p *x509.CertPool, err error) {
+	p = x509.NewCertPool()
+	if err = appendCertPool(p, path); err != nil {
+		return
+	}
+	return
+}
+
+func appendCertPool(p *x509.CertPool, path string) (err error) {
+	// Read file
+	var b []byte
+	if b, err = ioutil.ReadFile(path); err != nil {
+		err = fmt.Errorf("astibob: reading %s failed: %w", path, err)
+		return
+	}
+
+	// Append
+	if !p.AppendCertsFromPEM(b) {
+		err = fmt.Errorf("astibob: no certificate found in %s", path)
+		return
+	}
+	return
+}
@@ -0,0 +1,210 @@
+package astibob
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Queue policies
+const (
+	// Dispatching waits for the queue to have room. Handlers must not dispatch messages using this policy to their own
+	// queue since they would wait for themselves.
+	QueuePolicyBlock = "block"
+	// The pending message with the same name that has been queued last is replaced by the new one
+	QueuePolicyCoalesce = "coalesce"
+	// The new message is dropped
+	QueuePolicyDropNewest = "drop-newest"
+	// The oldest pending message with the same name is dropped
+	QueuePolicyDropOldest = "drop-oldest"
+)
+
+// QueueOptions represents how many messages with the same name can be pending in a dispatcher queue and what happens
+// when there are too many of them
+type QueueOptions struct {
+	Capacity int    `toml:"capacity"` // 0 means unbounded
+	Policy   string `toml:"policy"`   // Defaults to block
+	// Only used by the block policy. Once it's reached the new message is dropped. 0 means forever.
+	Timeout time.Duration `toml:"timeout"`
+}
+
+type queueItem struct {
+	hs []*dispatcherHandler
+	m  *Message
+}
+
+// queue processes messages in order in its own goroutine. Unlike astikit.Chan it can be bounded.
+type queue struct {
+	c        *sync.Cond
+	cancel   context.CancelFunc
+	ctx      context.Context
+	is       []*queueItem
+	lastUsed time.Time
+	m        *sync.Mutex    // Locks all attributes
+	ns       map[string]int // Number of pending items indexed by message name
+	pending  int            // Number of items that have been reserved or queued but not processed yet
+	stopped  bool
+}
+
+func newQueue(ctx context.Context) (q *queue) {
+	q = &queue{
+		lastUsed: time.Now(),
+		m:        &sync.Mutex{},
+		ns:       make(map[string]int),
+	}
+	q.c = sync.NewCond(q.m)
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	return
+}
+
+// start processes items until the queue is stopped. Items queued before it's stopped are all processed.
+func (q *queue) start(fn func(i *queueItem)) {
+	// Handle context
+	go func() {
+		// Wait for context to be done
+		<-q.ctx.Done()
+
+		// Update status
+		q.m.Lock()
+		q.stopped = true
+		q.c.Broadcast()
+		q.m.Unlock()
+	}()
+
+	// Loop
+	for {
+		// Wait for an item
+		q.m.Lock()
+		for len(q.is) == 0 && !q.stopped {
+			q.c.Wait()
+		}
+
+		// Queue is stopped and empty
+		if len(q.is) == 0 {
+			q.m.Unlock()
+			return
+		}
+
+		// Dequeue
+		i := q.is[0]
+		q.is = q.is[1:]
+		q.ns[i.m.Name]--
+		if q.ns[i.m.Name] == 0 {
+			delete(q.ns, i.m.Name)
+		}
+
+		// Let blocked producers know there's room
+		q.c.Broadcast()
+		q.m.Unlock()
+
+		// Process
+		fn(i)
+
+		// Update
+		q.m.Lock()
+		q.pending--
+		q.lastUsed = time.Now()
+		q.m.Unlock()
+	}
+}
+
+func (q *queue) stop() {
+	q.cancel()
+}
+
+// reserve makes sure the queue is not garbage collected before an item is added
+func (q *queue) reserve() {
+	q.m.Lock()
+	defer q.m.Unlock()
+	q.pending++
+	q.lastUsed = time.Now()
+}
+
+// idle indicates whether the queue has been unused for longer than the timeout
+func (q *queue) idle(timeout time.Duration) bool {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return q.pending == 0 && time.Since(q.lastUsed) >= timeout
+}
+
+func (q *queue) len() int {
+	q.m.Lock()
+	defer q.m.Unlock()
+	return len(q.is)
+}
+
+// add adds a reserved item to the queue and returns the number of messages that have been dropped
+func (q *queue) add(i *queueItem, o QueueOptions) (dropped int) {
+	// Lock
+	q.m.Lock()
+	defer q.m.Unlock()
+
+	// Queue is full
+	if o.Capacity > 0 && q.ns[i.m.Name] >= o.Capacity {
+		switch o.Policy {
+		case QueuePolicyCoalesce:
+			// Replace the last pending item with the same name
+			for idx := len(q.is) - 1; idx >= 0; idx-- {
+				if q.is[idx].m.Name == i.m.Name {
+					q.is[idx] = i
+					break
+				}
+			}
+			q.pending--
+			return 1
+		case QueuePolicyDropNewest:
+			q.pending--
+			return 1
+		case QueuePolicyDropOldest:
+			// Remove the first pending item with the same name
+			for idx := range q.is {
+				if q.is[idx].m.Name == i.m.Name {
+					q.is = append(q.is[:idx], q.is[idx+1:]...)
+					q.ns[i.m.Name]--
+					q.pending--
+					dropped = 1
+					break
+				}
+			}
+		default:
+			// Wake up once the timeout is reached
+			var deadline time.Time
+			if o.Timeout > 0 {
+				deadline = time.Now().Add(o.Timeout)
+				t := time.AfterFunc(o.Timeout, func() {
+					q.m.Lock()
+					q.c.Broadcast()
+					q.m.Unlock()
+				})
+				defer t.Stop()
+			}
+
+			// Wait for room
+			for q.ns[i.m.Name] >= o.Capacity && !q.stopped {
+				// Timeout has been reached
+				if !deadline.IsZero() && !time.Now().Before(deadline) {
+					break
+				}
+				q.c.Wait()
+			}
+
+			// Queue is still full
+			if q.ns[i.m.Name] >= o.Capacity {
+				q.pending--
+				return 1
+			}
+		}
+	}
+
+	// Queue is stopped
+	if q.stopped {
+		q.pending--
+		return dropped + 1
+	}
+
+	// Add item
+	q.is = append(q.is, i)
+	q.ns[i.m.Name]++
+	q.c.Broadcast()
+	return
+}
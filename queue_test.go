@@ -0,0 +1,83 @@
+package astibob
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func addTestQueueItem(q *queue, name string, id int, o QueueOptions) int {
+	q.reserve()
+	m := newMessage(*NewIndexIdentifier(), nil, name)
+	m.ID = id
+	return q.add(&queueItem{m: m}, o)
+}
+
+func queueIDs(q *queue) (ids []int) {
+	for _, i := range q.is {
+		ids = append(ids, i.m.ID)
+	}
+	return
+}
+
+func TestQueuePolicies(t *testing.T) {
+	for _, v := range []struct {
+		dropped int
+		ids     []int
+		policy  string
+	}{
+		{dropped: 1, ids: []int{1, 2, 3}, policy: QueuePolicyDropNewest},
+		{dropped: 1, ids: []int{2, 3, 4}, policy: QueuePolicyDropOldest},
+		{dropped: 1, ids: []int{1, 4, 3}, policy: QueuePolicyCoalesce},
+	} {
+		// Create queue
+		q := newQueue(context.Background())
+		o := QueueOptions{Capacity: 2, Policy: v.policy}
+
+		// Add items
+		// Capacity is per message name
+		var dropped int
+		dropped += addTestQueueItem(q, "a", 1, o)
+		dropped += addTestQueueItem(q, "a", 2, o)
+		dropped += addTestQueueItem(q, "b", 3, o)
+		dropped += addTestQueueItem(q, "a", 4, o)
+
+		// Check
+		if dropped != v.dropped {
+			t.Errorf("%s: expected %d dropped, got %d", v.policy, v.dropped, dropped)
+		}
+		if ids := queueIDs(q); len(ids) != len(v.ids) || ids[0] != v.ids[0] || ids[1] != v.ids[1] || ids[2] != v.ids[2] {
+			t.Errorf("%s: expected %v, got %v", v.policy, v.ids, ids)
+		}
+		if q.pending != len(v.ids) {
+			t.Errorf("%s: expected %d pending, got %d", v.policy, len(v.ids), q.pending)
+		}
+	}
+}
+
+func TestQueuePolicyBlock(t *testing.T) {
+	// Create queue
+	q := newQueue(context.Background())
+	o := QueueOptions{Capacity: 1, Timeout: 20 * time.Millisecond}
+	addTestQueueItem(q, "a", 1, o)
+
+	// Timeout is reached
+	if dropped := addTestQueueItem(q, "a", 2, o); dropped != 1 {
+		t.Fatalf("expected 1 dropped, got %d", dropped)
+	}
+
+	// Room is made while blocking
+	c := make(chan int)
+	go func() { c <- addTestQueueItem(q, "a", 3, QueueOptions{Capacity: 1}) }()
+	time.Sleep(10 * time.Millisecond)
+	go q.start(func(*queueItem) {})
+	select {
+	case dropped := <-c:
+		if dropped != 0 {
+			t.Fatalf("expected 0 dropped, got %d", dropped)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("producer is still blocked")
+	}
+	q.stop()
+}
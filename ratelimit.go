@@ -0,0 +1,91 @@
+package astibob
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrRateLimitExceeded is returned by rate limit middlewares when they drop a message. Dispatchers count those messages
+// as dropped.
+var ErrRateLimitExceeded = errors.New("astibob: rate limit exceeded")
+
+// RateLimit represents the number of messages per second allowed for a message name. Burst is the number of messages
+// that can be handled at once and defaults to 1.
+type RateLimit struct {
+	Burst int     `toml:"burst"`
+	Rate  float64 `toml:"rate"`
+}
+
+// rateLimiter keeps a bucket per message name
+type rateLimiter struct {
+	bs map[string]*rateLimitBucket // Indexed by message name
+	ls map[string]RateLimit        // Indexed by message name pattern
+	m  *sync.Mutex                 // Locks bs
+}
+
+func newRateLimiter(ls map[string]RateLimit) *rateLimiter {
+	return &rateLimiter{
+		bs: make(map[string]*rateLimitBucket),
+		ls: ls,
+		m:  &sync.Mutex{},
+	}
+}
+
+func (l *rateLimiter) allowed(name string) bool {
+	// Lock
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	// Get bucket
+	b, ok := l.bs[name]
+	if !ok {
+		// Get limit
+		// When several patterns match, the longest one wins
+		var pattern string
+		for p, pl := range l.ls {
+			if WildcardMatch(p, name) && (b == nil || len(p) > len(pattern)) {
+				b, pattern = newRateLimitBucket(pl), p
+			}
+		}
+		l.bs[name] = b
+	}
+	return b == nil || b.take()
+}
+
+// rateLimitBucket is a token bucket
+type rateLimitBucket struct {
+	l      RateLimit
+	last   time.Time
+	tokens float64
+}
+
+func newRateLimitBucket(l RateLimit) *rateLimitBucket {
+	if l.Burst <= 0 {
+		l.Burst = 1
+	}
+	return &rateLimitBucket{
+		l:      l,
+		last:   time.Now(),
+		tokens: float64(l.Burst),
+	}
+}
+
+func (b *rateLimitBucket) take() bool {
+	// Refill
+	n := time.Now()
+	b.tokens += n.Sub(b.last).Seconds() * b.l.Rate
+	if b.tokens > float64(b.l.Burst) {
+		b.tokens = float64(b.l.Burst)
+	}
+	b.last = n
+
+	// No tokens
+	if b.tokens < 1 {
+		return false
+	}
+
+	// Take token
+	b.tokens--
+	return true
+}
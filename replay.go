@@ -0,0 +1,123 @@
+package astibob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/asticode/go-astikit"
+)
+
+type ReplayOptions struct {
+	Filter JournalFilter
+	Path   string // Path of the journal
+	// 1 replays messages in real time, 2 twice as fast, etc. 0 replays messages as fast as possible.
+	Speed float64
+}
+
+// Replay reads the journal and calls the callback for each matching entry, respecting the delays between entries
+// according to the speed
+func Replay(ctx context.Context, o ReplayOptions, fn func(e JournalEntry) error) (err error) {
+	// Create reader
+	var r *JournalReader
+	if r, err = NewJournalReader(o.Path, o.Filter); err != nil {
+		err = fmt.Errorf("astibob: creating journal reader failed: %w", err)
+		return
+	}
+	defer r.Close()
+
+	// Loop
+	var first time.Time
+	var start time.Time
+	for {
+		// Context is done
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			return
+		}
+
+		// Next entry
+		var e JournalEntry
+		if e, err = r.Next(); err != nil {
+			if errors.Is(err, io.EOF) {
+				err = nil
+			} else {
+				err = fmt.Errorf("astibob: getting next journal entry failed: %w", err)
+			}
+			return
+		}
+
+		// Wait
+		if o.Speed > 0 {
+			if first.IsZero() {
+				first, start = e.At, time.Now()
+			} else if d := time.Duration(float64(e.At.Sub(first))/o.Speed) - time.Since(start); d > 0 {
+				astikit.Sleep(ctx, d)
+				if ctx.Err() != nil {
+					err = ctx.Err()
+					return
+				}
+			}
+		}
+
+		// Callback
+		if err = fn(e); err != nil {
+			err = fmt.Errorf("astibob: callback failed: %w", err)
+			return
+		}
+	}
+}
+
+// ReplayRunnable dispatches messages emitted by a runnable in a journal as if it were that runnable. Register it
+// under the name of the original runnable so that its listeners (e.g. speech_to_text listening to audio_input) can't
+// tell the difference.
+type ReplayRunnable struct {
+	*BaseRunnable
+	o ReplayOptions
+}
+
+// NewReplayRunnable creates a runnable replaying the messages emitted by the runnable with the same name, unless the
+// filter says otherwise
+func NewReplayRunnable(name string, o ReplayOptions, l astikit.StdLogger) (r *ReplayRunnable) {
+	// Default filter
+	if o.Filter.Direction == "" {
+		o.Filter.Direction = JournalDirectionOutbound
+	}
+	if o.Filter.From == "" {
+		o.Filter.From = name
+	}
+
+	// Create runnable
+	r = &ReplayRunnable{o: o}
+
+	// Create base runnable
+	r.BaseRunnable = NewBaseRunnable(BaseRunnableOptions{
+		Logger: l,
+		Metadata: Metadata{
+			Description: "Replays messages of " + o.Filter.From + " from " + o.Path,
+			Name:        name,
+		},
+		OnStart: r.onStart,
+	})
+	return
+}
+
+func (r *ReplayRunnable) onStart(ctx context.Context) (err error) {
+	// Replay
+	if err = Replay(ctx, r.o, func(e JournalEntry) error {
+		// Clone message
+		// From is set by the worker
+		m := e.Message.Clone()
+		m.From = Identifier{}
+
+		// Dispatch
+		r.Dispatch(m)
+		return nil
+	}); err != nil && !errors.Is(err, context.Canceled) {
+		err = fmt.Errorf("astibob: replaying failed: %w", err)
+		return
+	}
+	return
+}
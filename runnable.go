@@ -2,7 +2,10 @@ package astibob
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"runtime/debug"
 	"sync"
 
 	"github.com/asticode/go-astikit"
@@ -10,15 +13,25 @@ import (
 
 // Statuses
 const (
-	RunningStatus = "running"
-	StoppedStatus = "stopped"
+	CrashedStatus  = "crashed"
+	RunningStatus  = "running"
+	StartingStatus = "starting"
+	StoppedStatus  = "stopped"
+	StoppingStatus = "stopping"
+	UnknownStatus  = "unknown" // Only reported by the index when the worker is unresponsive
 )
 
+// IsStoppedStatus checks whether a status means the runnable is not running and can be started
+func IsStoppedStatus(status string) bool {
+	return status == StoppedStatus || status == CrashedStatus
+}
+
 type Runnable interface {
 	Metadata() Metadata
 	OnMessage(m *Message) error
 	SetDispatchFunc(f DispatchFunc)
 	SetRootCtx(ctx context.Context)
+	SetStatusFunc(f StatusFunc)
 	SetTaskFunc(f astikit.TaskFunc)
 	Start(ctx context.Context) error
 	Status() string
@@ -27,36 +40,61 @@ type Runnable interface {
 
 type DispatchFunc func(m *Message)
 
+// StatusFunc is called each time the status of a runnable changes, in the order of the transitions. err is only set
+// when the runnable has crashed.
+type StatusFunc func(status string, err error)
+
 type BaseRunnableOptions struct {
-	Logger    astikit.StdLogger
-	Metadata  Metadata
+	Logger   astikit.StdLogger
+	Metadata Metadata
+	// Executed before OnStart. The runnable is only running once it has succeeded, therefore setup that may fail,
+	// such as opening a device, should happen there.
+	OnInit    func(ctx context.Context) error
 	OnMessage func(m *Message) error
-	OnStart   func(ctx context.Context) error
+	// Handles messages expecting a reply. Returning an *Error sends a structured error back to the requester.
+	OnRequest func(m *Message) (reply interface{}, err error)
+	// Executed once the runnable is running, until it's stopped
+	OnStart func(ctx context.Context) error
 }
 
 type BaseRunnable struct {
 	dispatchFunc DispatchFunc
 	l            astikit.SeverityLogger
+	ms           *sync.Mutex // Locks notifying, ns, startCancel, status and statusFunc
+	notifying    bool        // Whether a goroutine is executing the status func
+	ns           []statusNotification
 	o            BaseRunnableOptions
-	oStart       *sync.Once
-	oStop        *sync.Once
 	rootCtx      context.Context
 	startCancel  context.CancelFunc
-	startCtx     context.Context
 	status       string
+	statusFunc   StatusFunc
 	taskFunc     astikit.TaskFunc
 }
 
+type statusNotification struct {
+	err    error
+	status string
+}
+
 func NewBaseRunnable(o BaseRunnableOptions) *BaseRunnable {
 	return &BaseRunnable{
 		l:      astikit.AdaptStdLogger(o.Logger),
+		ms:     &sync.Mutex{},
 		o:      o,
-		oStart: &sync.Once{},
-		oStop:  &sync.Once{},
 		status: StoppedStatus,
 	}
 }
 
+// PanicError is returned when a runnable has panicked
+type PanicError struct {
+	Stack string
+	Value interface{}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("astibob: panic: %v", e.Value)
+}
+
 func (r *BaseRunnable) Dispatch(m *Message) {
 	if r.dispatchFunc != nil {
 		r.dispatchFunc(m)
@@ -69,24 +107,18 @@ func (r *BaseRunnable) NewTask() *astikit.Task { return r.taskFunc() }
 
 func (r *BaseRunnable) OnMessage(m *Message) (err error) {
 	// We need to send a done message
+	var reply interface{}
 	if m.ID > 0 {
-		defer func() {
-			// Create message
-			m, err := NewRunnableDoneMessage(&Identifier{
-				Name: astikit.StrPtr(m.From.WorkerName()),
-				Type: WorkerIdentifierType,
-			}, RunnableDone{
-				ID:      m.ID,
-				Success: err == nil,
-			})
-			if err != nil {
-				r.l.Error(fmt.Errorf("astibob: creating runnable done message failed: %w", err))
-				return
-			}
+		defer func() { r.dispatchDone(m, reply, err) }()
+	}
 
-			// Dispatch
-			r.Dispatch(m)
-		}()
+	// Custom request
+	if r.o.OnRequest != nil && (m.ID > 0 || r.o.OnMessage == nil) {
+		if reply, err = r.o.OnRequest(m); err != nil {
+			err = fmt.Errorf("astibob: custom request handling failed: %w", err)
+			return
+		}
+		return
 	}
 
 	// Custom
@@ -99,57 +131,211 @@ func (r *BaseRunnable) OnMessage(m *Message) (err error) {
 	return
 }
 
+func (r *BaseRunnable) dispatchDone(m *Message, reply interface{}, err error) {
+	// Create done
+	d := RunnableDone{
+		ID:      m.ID,
+		Success: err == nil,
+	}
+
+	// Add error
+	if err != nil {
+		var e *Error
+		if errors.As(err, &e) {
+			d.Error = e
+		} else {
+			d.Error = &Error{Message: err.Error()}
+		}
+	} else if reply != nil {
+		// Marshal reply
+		var rerr error
+		if d.Reply, rerr = json.Marshal(reply); rerr != nil {
+			r.l.Error(fmt.Errorf("astibob: marshaling reply failed: %w", rerr))
+			d.Error = &Error{Message: "astibob: marshaling reply failed"}
+			d.Success = false
+		}
+	}
+
+	// Create message
+	dm, err := NewRunnableDoneMessage(&Identifier{
+		Name: astikit.StrPtr(m.From.WorkerName()),
+		Type: WorkerIdentifierType,
+	}, d)
+	if err != nil {
+		r.l.Error(fmt.Errorf("astibob: creating runnable done message failed: %w", err))
+		return
+	}
+
+	// Dispatch
+	r.Dispatch(dm)
+}
+
 func (r *BaseRunnable) RootCtx() context.Context { return r.rootCtx }
 
 func (r *BaseRunnable) SetDispatchFunc(f DispatchFunc) { r.dispatchFunc = f }
 
 func (r *BaseRunnable) SetRootCtx(ctx context.Context) { r.rootCtx = ctx }
 
+func (r *BaseRunnable) SetStatusFunc(f StatusFunc) {
+	r.ms.Lock()
+	defer r.ms.Unlock()
+	r.statusFunc = f
+}
+
 func (r *BaseRunnable) SetTaskFunc(f astikit.TaskFunc) { r.taskFunc = f }
 
-func (r *BaseRunnable) Status() string { return r.status }
+func (r *BaseRunnable) Status() string {
+	r.ms.Lock()
+	defer r.ms.Unlock()
+	return r.status
+}
+
+// transition updates the status if the current status is one of the expected ones. Assumes ms is locked.
+func (r *BaseRunnable) transition(to string, from ...string) (err error) {
+	for _, f := range from {
+		if r.status == f {
+			r.status = to
+			return
+		}
+	}
+	return fmt.Errorf("astibob: invalid transition from %s to %s", r.status, to)
+}
+
+// unlockAndNotify queues a notification of the current status and unlocks ms. Notifications are executed by one
+// goroutine at a time, without ms being locked, so that the status func receives them in the order of the
+// transitions and can read the status. Assumes ms is locked.
+func (r *BaseRunnable) unlockAndNotify(err error) {
+	// Queue notification
+	r.ns = append(r.ns, statusNotification{
+		err:    err,
+		status: r.status,
+	})
+
+	// Another goroutine is notifying and will handle this notification as well
+	if r.notifying {
+		r.ms.Unlock()
+		return
+	}
+	r.notifying = true
+
+	// Loop
+	for {
+		// Get notification
+		if len(r.ns) == 0 {
+			r.notifying = false
+			r.ms.Unlock()
+			return
+		}
+		n, fn := r.ns[0], r.statusFunc
+		r.ns = r.ns[1:]
+		r.ms.Unlock()
+
+		// Notify
+		if fn != nil {
+			fn(n.status, n.err)
+		}
+
+		// Lock
+		r.ms.Lock()
+	}
+}
 
 func (r *BaseRunnable) Start(ctx context.Context) (err error) {
-	// Make sure it's started only once
-	r.oStart.Do(func() {
-		// Create context
-		r.startCtx, r.startCancel = context.WithCancel(ctx)
+	// Update status
+	r.ms.Lock()
+	if err = r.transition(StartingStatus, StoppedStatus, CrashedStatus); err != nil {
+		r.ms.Unlock()
+		return
+	}
+
+	// Create context
+	startCtx, startCancel := context.WithCancel(ctx)
+	r.startCancel = startCancel
+	r.unlockAndNotify(nil)
+
+	// Make sure to release the context
+	defer startCancel()
 
-		// Reset once
-		r.oStop = &sync.Once{}
+	// Init
+	if r.o.OnInit != nil {
+		if err = r.safe(startCtx, r.o.OnInit); err != nil {
+			err = fmt.Errorf("astibob: OnInit failed: %w", err)
+		}
+	}
 
+	// Start
+	if err == nil {
 		// Update status
-		r.status = RunningStatus
+		// The runnable may have been stopped in the meantime, OnStart is still executed so that it can release what
+		// OnInit has set up
+		r.ms.Lock()
+		if err := r.transition(RunningStatus, StartingStatus); err != nil {
+			r.ms.Unlock()
+		} else {
+			r.unlockAndNotify(nil)
+		}
 
 		// Start
 		if r.o.OnStart != nil {
-			if err = r.o.OnStart(r.startCtx); err != nil {
+			if err = r.safe(startCtx, r.o.OnStart); err != nil {
 				err = fmt.Errorf("astibob: OnStart failed: %w", err)
 			}
 		} else {
-			<-r.startCtx.Done()
+			<-startCtx.Done()
 		}
+	}
 
-		// Check context
-		if r.startCtx.Err() != nil {
-			err = r.startCtx.Err()
-		}
+	// Check context
+	// A runnable failing while it's being stopped has still crashed
+	if err == nil && startCtx.Err() != nil {
+		err = startCtx.Err()
+	}
 
-		// Update status
+	// Update status
+	r.ms.Lock()
+	var crashErr error
+	if err != nil && !errors.Is(err, context.Canceled) {
+		r.status = CrashedStatus
+		crashErr = err
+	} else {
 		r.status = StoppedStatus
-	})
+	}
+	r.startCancel = nil
+	r.unlockAndNotify(crashErr)
 	return
 }
 
-func (r *BaseRunnable) Stop() {
-	// Make sure it's stopped only once
-	r.oStop.Do(func() {
-		// Cancel context
-		if r.startCancel != nil {
-			r.startCancel()
+// safe executes a custom func and turns its panics into *PanicError errors
+func (r *BaseRunnable) safe(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	// Recover from panics
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{
+				Stack: string(debug.Stack()),
+				Value: v,
+			}
 		}
+	}()
 
-		// Reset once
-		r.oStart = &sync.Once{}
-	})
+	// Execute
+	return fn(ctx)
+}
+
+func (r *BaseRunnable) Stop() {
+	// Lock
+	r.ms.Lock()
+
+	// Update status
+	if err := r.transition(StoppingStatus, StartingStatus, RunningStatus); err != nil {
+		r.ms.Unlock()
+		return
+	}
+
+	// Cancel context
+	if r.startCancel != nil {
+		r.startCancel()
+	}
+
+	// Notify
+	r.unlockAndNotify(nil)
 }
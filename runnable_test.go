@@ -0,0 +1,182 @@
+package astibob
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// startTestRunnable starts the runnable in a goroutine and returns a chan receiving Start's error
+func startTestRunnable(r *BaseRunnable) chan error {
+	c := make(chan error, 1)
+	go func() { c <- r.Start(context.Background()) }()
+	return c
+}
+
+func waitForTestRunnable(t *testing.T, c chan error) error {
+	t.Helper()
+	select {
+	case err := <-c:
+		return err
+	case <-time.After(time.Second):
+		t.Fatal("runnable hasn't stopped")
+	}
+	return nil
+}
+
+func waitForTestRunnableStatus(t *testing.T, r *BaseRunnable, status string) {
+	t.Helper()
+	for idx := 0; idx < 100; idx++ {
+		if r.Status() == status {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %s, got %s", status, r.Status())
+}
+
+func TestBaseRunnableStart(t *testing.T) {
+	// Runnable is only running once it has been initialized
+	initDone := make(chan bool)
+	started := make(chan bool)
+	r := NewBaseRunnable(BaseRunnableOptions{
+		OnInit: func(ctx context.Context) error {
+			<-initDone
+			return nil
+		},
+		OnStart: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return nil
+		},
+	})
+	c := startTestRunnable(r)
+	waitForTestRunnableStatus(t, r, StartingStatus)
+
+	// Runnable can't be started twice
+	if err := r.Start(context.Background()); err == nil {
+		t.Fatal("starting a runnable twice should fail")
+	}
+
+	// Init is done
+	close(initDone)
+	<-started
+	if s := r.Status(); s != RunningStatus {
+		t.Fatalf("expected %s, got %s", RunningStatus, s)
+	}
+
+	// Stop
+	r.Stop()
+	if err := waitForTestRunnable(t, c); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if s := r.Status(); s != StoppedStatus {
+		t.Fatalf("expected %s, got %s", StoppedStatus, s)
+	}
+
+	// Stopped runnables can't be stopped
+	r.Stop()
+	if s := r.Status(); s != StoppedStatus {
+		t.Fatalf("expected %s, got %s", StoppedStatus, s)
+	}
+}
+
+func TestBaseRunnableCrash(t *testing.T) {
+	e := errors.New("test")
+	for n, o := range map[string]BaseRunnableOptions{
+		"init fails": {
+			OnInit: func(ctx context.Context) error { return e },
+			OnStart: func(ctx context.Context) error {
+				t.Error("OnStart shouldn't be executed when OnInit fails")
+				return nil
+			},
+		},
+		"start fails": {OnStart: func(ctx context.Context) error { return e }},
+	} {
+		r := NewBaseRunnable(o)
+		if err := waitForTestRunnable(t, startTestRunnable(r)); !errors.Is(err, e) {
+			t.Fatalf("%s: expected %v, got %v", n, e, err)
+		}
+		if s := r.Status(); s != CrashedStatus {
+			t.Fatalf("%s: expected %s, got %s", n, CrashedStatus, s)
+		}
+	}
+
+	// Panic
+	r := NewBaseRunnable(BaseRunnableOptions{OnStart: func(ctx context.Context) error { panic("test") }})
+	var pe *PanicError
+	if err := waitForTestRunnable(t, startTestRunnable(r)); !errors.As(err, &pe) || pe.Stack == "" {
+		t.Fatalf("expected panic error with a stack, got %v", err)
+	}
+
+	// Error returned while stopping is kept
+	started := make(chan bool)
+	r = NewBaseRunnable(BaseRunnableOptions{OnStart: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return e
+	}})
+	c := startTestRunnable(r)
+	<-started
+	r.Stop()
+	if err := waitForTestRunnable(t, c); !errors.Is(err, e) {
+		t.Fatalf("expected %v, got %v", e, err)
+	}
+	if s := r.Status(); s != CrashedStatus {
+		t.Fatalf("expected %s, got %s", CrashedStatus, s)
+	}
+
+	// Crashed runnables can be started again
+	r = NewBaseRunnable(BaseRunnableOptions{OnStart: func(ctx context.Context) error { return e }})
+	for idx := 0; idx < 2; idx++ {
+		if err := waitForTestRunnable(t, startTestRunnable(r)); !errors.Is(err, e) {
+			t.Fatalf("expected %v, got %v", e, err)
+		}
+	}
+}
+
+func TestBaseRunnableStatusFunc(t *testing.T) {
+	// Create runnable
+	var ss []string
+	var errs []error
+	started := make(chan bool)
+	r := NewBaseRunnable(BaseRunnableOptions{OnStart: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}})
+	r.SetStatusFunc(func(status string, err error) {
+		// Status func can read the status
+		r.Status()
+		ss = append(ss, status)
+		errs = append(errs, err)
+	})
+
+	// Start and stop
+	c := startTestRunnable(r)
+	<-started
+	r.Stop()
+	waitForTestRunnable(t, c)
+	if e := []string{StartingStatus, RunningStatus, StoppingStatus, StoppedStatus}; !reflect.DeepEqual(ss, e) {
+		t.Fatalf("expected %v, got %v", e, ss)
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	}
+
+	// Init fails
+	ss, errs = []string{}, []error{}
+	e := errors.New("test")
+	r.o = BaseRunnableOptions{OnInit: func(ctx context.Context) error { return e }}
+	waitForTestRunnable(t, startTestRunnable(r))
+	if e := []string{StartingStatus, CrashedStatus}; !reflect.DeepEqual(ss, e) {
+		t.Fatalf("expected %v, got %v", e, ss)
+	}
+	if errs[0] != nil || !errors.Is(errs[1], e) {
+		t.Fatalf("expected crash error only, got %v", errs)
+	}
+}
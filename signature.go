@@ -0,0 +1,171 @@
+package astibob
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Signature headers
+const (
+	NonceHeader     = "X-Astibob-Nonce"
+	SignatureHeader = "X-Astibob-Signature"
+	TimestampHeader = "X-Astibob-Timestamp"
+	WorkerHeader    = "X-Astibob-Worker"
+)
+
+// Max difference between the signature timestamp and now
+const signatureMaxSkew = 5 * time.Minute
+
+// NewSecret creates a random secret
+func NewSecret() (s []byte, err error) {
+	s = make([]byte, 32)
+	if _, err = rand.Read(s); err != nil {
+		err = fmt.Errorf("astibob: reading random bytes failed: %w", err)
+		return
+	}
+	return
+}
+
+// DeriveWorkerKey derives the key shared by 2 workers from a secret only the index knows. The key is the same whatever
+// the order of the workers.
+func DeriveWorkerKey(secret []byte, worker1, worker2 string) []byte {
+	// Sort workers
+	if worker1 > worker2 {
+		worker1, worker2 = worker2, worker1
+	}
+
+	// Hash
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(worker1)) //nolint:errcheck
+	h.Write([]byte{0})       //nolint:errcheck
+	h.Write([]byte(worker2)) //nolint:errcheck
+	return h.Sum(nil)
+}
+
+// DeriveIndexKey derives the key the index signs its requests to a worker with. It never matches a key shared by 2
+// workers.
+func DeriveIndexKey(secret []byte, worker string) []byte {
+	// Derive index secret
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(IndexIdentifierType)) //nolint:errcheck
+
+	// Hash
+	h = hmac.New(sha256.New, h.Sum(nil))
+	h.Write([]byte(worker)) //nolint:errcheck
+	return h.Sum(nil)
+}
+
+// SignRequest adds the headers proving that the request has been sent by a specific worker
+func SignRequest(r *http.Request, worker string, key, body []byte) error {
+	return SignHeader(r.Header, r.Method, r.URL.Path, worker, key, body)
+}
+
+// SignHeader adds the headers proving that a request that can't be built directly, such as a websocket handshake, has
+// been sent by a specific worker
+func SignHeader(h http.Header, method, path, worker string, key, body []byte) (err error) {
+	// Create nonce
+	n := make([]byte, 16)
+	if _, err = rand.Read(n); err != nil {
+		err = fmt.Errorf("astibob: reading random bytes failed: %w", err)
+		return
+	}
+
+	// Set headers
+	h.Set(NonceHeader, hex.EncodeToString(n))
+	h.Set(TimestampHeader, strconv.FormatInt(time.Now().Unix(), 10))
+	h.Set(WorkerHeader, worker)
+	h.Set(SignatureHeader, base64.StdEncoding.EncodeToString(signature(key, method, path, h, body)))
+	return
+}
+
+func signature(key []byte, method, path string, h http.Header, body []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	for _, v := range []string{method, path, h.Get(WorkerHeader), h.Get(TimestampHeader), h.Get(NonceHeader)} {
+		m.Write([]byte(v)) //nolint:errcheck
+		m.Write([]byte{0}) //nolint:errcheck
+	}
+	m.Write(body) //nolint:errcheck
+	return m.Sum(nil)
+}
+
+// SignatureVerifier verifies signed requests and rejects the ones it has already seen
+type SignatureVerifier struct {
+	m  *sync.Mutex          // Locks ns
+	ns map[string]time.Time // Expiration times indexed by nonce
+}
+
+// NewSignatureVerifier creates a new signature verifier
+func NewSignatureVerifier() *SignatureVerifier {
+	return &SignatureVerifier{
+		m:  &sync.Mutex{},
+		ns: make(map[string]time.Time),
+	}
+}
+
+// Verify verifies the request signature and returns the name of the worker that has sent it
+func (v *SignatureVerifier) Verify(r *http.Request, body []byte, keyFunc func(worker string) ([]byte, bool)) (worker string, err error) {
+	// Get key
+	worker = r.Header.Get(WorkerHeader)
+	key, ok := keyFunc(worker)
+	if !ok {
+		err = fmt.Errorf("astibob: no key for worker %s", worker)
+		return
+	}
+
+	// Check timestamp
+	var t int64
+	if t, err = strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64); err != nil {
+		err = fmt.Errorf("astibob: parsing timestamp failed: %w", err)
+		return
+	}
+	now := time.Now()
+	if d := now.Sub(time.Unix(t, 0)); d > signatureMaxSkew || d < -signatureMaxSkew {
+		err = errors.New("astibob: timestamp is too far from now")
+		return
+	}
+
+	// Check signature
+	var s []byte
+	if s, err = base64.StdEncoding.DecodeString(r.Header.Get(SignatureHeader)); err != nil {
+		err = fmt.Errorf("astibob: decoding signature failed: %w", err)
+		return
+	}
+	if !hmac.Equal(s, signature(key, r.Method, r.URL.Path, r.Header, body)) {
+		err = errors.New("astibob: invalid signature")
+		return
+	}
+
+	// Lock
+	v.m.Lock()
+	defer v.m.Unlock()
+
+	// Remove expired nonces
+	for n, e := range v.ns {
+		if now.After(e) {
+			delete(v.ns, n)
+		}
+	}
+
+	// Check nonce
+	// Nonces only need to be remembered as long as their timestamp is valid
+	n := r.Header.Get(NonceHeader)
+	if n == "" {
+		err = errors.New("astibob: no nonce")
+		return
+	}
+	if _, ok := v.ns[n]; ok {
+		err = errors.New("astibob: nonce has already been used")
+		return
+	}
+	v.ns[n] = time.Unix(t, 0).Add(signatureMaxSkew)
+	return
+}
@@ -0,0 +1,89 @@
+package astibob
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeriveWorkerKey(t *testing.T) {
+	s1, s2 := []byte("secret1"), []byte("secret2")
+	if !bytes.Equal(DeriveWorkerKey(s1, "w1", "w2"), DeriveWorkerKey(s1, "w2", "w1")) {
+		t.Error("keys should be the same whatever the order of the workers")
+	}
+	if bytes.Equal(DeriveWorkerKey(s1, "w1", "w2"), DeriveWorkerKey(s2, "w1", "w2")) {
+		t.Error("keys should depend on the secret")
+	}
+	if bytes.Equal(DeriveWorkerKey(s1, "w1", "w2"), DeriveWorkerKey(s1, "w1", "w3")) {
+		t.Error("keys should depend on the workers")
+	}
+	if bytes.Equal(DeriveIndexKey(s1, "w1"), DeriveWorkerKey(s1, IndexIdentifierType, "w1")) {
+		t.Error("index keys shouldn't match worker keys")
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	// Create verifier
+	v := NewSignatureVerifier()
+	key := []byte("key")
+	keyFunc := func(worker string) ([]byte, bool) {
+		if worker != "w1" {
+			return nil, false
+		}
+		return key, true
+	}
+
+	// Create signed request
+	body := []byte("body")
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewReader(body))
+		if err := SignRequest(r, "w1", key, body); err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	// Valid
+	r := newRequest()
+	if w, err := v.Verify(r, body, keyFunc); err != nil || w != "w1" {
+		t.Fatalf("expected w1, got %q (%v)", w, err)
+	}
+
+	// Replayed
+	if _, err := v.Verify(r, body, keyFunc); err == nil {
+		t.Error("replayed request should be rejected")
+	}
+
+	// Invalid
+	for n, fn := range map[string]func(r *http.Request) []byte{
+		"body has been modified": func(r *http.Request) []byte { return []byte("other body") },
+		"method has been modified": func(r *http.Request) []byte {
+			r.Method = http.MethodPut
+			return body
+		},
+		"path has been modified": func(r *http.Request) []byte {
+			r.URL.Path = "/api/other"
+			return body
+		},
+		"worker has been modified": func(r *http.Request) []byte {
+			r.Header.Set(WorkerHeader, "w2")
+			return body
+		},
+		"timestamp is too old": func(r *http.Request) []byte {
+			r.Header.Set(TimestampHeader, strconv.FormatInt(time.Now().Add(-2*signatureMaxSkew).Unix(), 10))
+			return body
+		},
+		"signature is missing": func(r *http.Request) []byte {
+			r.Header.Del(SignatureHeader)
+			return body
+		},
+	} {
+		r := newRequest()
+		if _, err := v.Verify(r, fn(r), keyFunc); err == nil {
+			t.Errorf("%s: request should be rejected", n)
+		}
+	}
+}
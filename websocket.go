@@ -0,0 +1,359 @@
+package astibob
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astikit"
+	"github.com/asticode/go-astiws"
+	"github.com/gorilla/websocket"
+)
+
+// Connections are closed when no pong has been received for that long
+const websocketPingWait = astiws.PingPeriod * 10 / 9
+
+// NewWebsocketDialer creates a websocket dialer with a specific TLS config and dial func. Nil values fall back to
+// gorilla's defaults.
+func NewWebsocketDialer(c *tls.Config, dial DialFunc) *websocket.Dialer {
+	d := *websocket.DefaultDialer
+	d.NetDialContext = dial
+	d.TLSClientConfig = c
+	return &d
+}
+
+// WebsocketClient dials websockets with its own dialer, which astiws clients can't do since they all share gorilla's
+// default dialer. It pings the same way astiws clients do, therefore it can connect to astiws managers.
+type WebsocketClient struct {
+	c  *websocket.Conn
+	d  *websocket.Dialer
+	h  astiws.MessageHandler
+	l  astikit.SeverityLogger
+	mc *sync.Mutex   // Locks c and rd
+	mh *sync.Mutex   // Locks h
+	mw *sync.Mutex   // Serializes writes
+	rd chan struct{} // Closed once the connection being read is closed
+}
+
+// NewWebsocketClient creates a new websocket client. A nil dialer falls back to gorilla's default dialer.
+func NewWebsocketClient(d *websocket.Dialer, l astikit.StdLogger) *WebsocketClient {
+	if d == nil {
+		d = websocket.DefaultDialer
+	}
+	return &WebsocketClient{
+		d:  d,
+		l:  astikit.AdaptStdLogger(l),
+		mc: &sync.Mutex{},
+		mh: &sync.Mutex{},
+		mw: &sync.Mutex{},
+	}
+}
+
+func (c *WebsocketClient) conn() *websocket.Conn {
+	c.mc.Lock()
+	defer c.mc.Unlock()
+	return c.c
+}
+
+// SetMessageHandler sets the handler called for each message read
+func (c *WebsocketClient) SetMessageHandler(h astiws.MessageHandler) {
+	c.mh.Lock()
+	defer c.mh.Unlock()
+	c.h = h
+}
+
+// DialWithHeaders dials an addr with specific headers. The previous connection, if any, is closed.
+func (c *WebsocketClient) DialWithHeaders(addr string, h http.Header) (err error) {
+	// Make sure the previous connection is closed
+	c.mc.Lock()
+	if c.c != nil {
+		c.c.Close()
+		c.c = nil
+	}
+	c.mc.Unlock()
+
+	// Dial
+	c.l.Debugf("astibob: dialing %s", addr)
+	var conn *websocket.Conn
+	if conn, _, err = c.d.Dial(addr, h); err != nil {
+		err = fmt.Errorf("astibob: dialing %s failed: %w", addr, err)
+		return
+	}
+
+	// Update conn
+	c.mc.Lock()
+	c.c = conn
+	c.mc.Unlock()
+	return
+}
+
+// Read reads messages until the connection is closed
+func (c *WebsocketClient) Read() (err error) {
+	// Get conn
+	c.mc.Lock()
+	conn := c.c
+	if conn == nil {
+		c.mc.Unlock()
+		err = errors.New("astibob: websocket is not connected")
+		return
+	}
+	rd := make(chan struct{})
+	c.rd = rd
+	c.mc.Unlock()
+
+	// Make sure the connection is properly closed
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		conn.Close()
+		c.mc.Lock()
+		if c.c == conn {
+			c.c = nil
+			c.rd = nil
+		}
+		c.mc.Unlock()
+		close(rd)
+	}()
+
+	// Extend connection
+	if err = conn.SetReadDeadline(time.Now().Add(websocketPingWait)); err != nil {
+		err = fmt.Errorf("astibob: extending connection failed: %w", err)
+		return
+	}
+
+	// Handle pongs
+	conn.SetPongHandler(func(string) error { return conn.SetReadDeadline(time.Now().Add(websocketPingWait)) })
+
+	// Send pings
+	go c.ping(ctx)
+
+	// Loop
+	for {
+		// Read message
+		var p []byte
+		if _, p, err = conn.ReadMessage(); err != nil {
+			err = fmt.Errorf("astibob: reading message failed: %w", err)
+			return
+		}
+
+		// Get handler
+		c.mh.Lock()
+		h := c.h
+		c.mh.Unlock()
+
+		// No handler
+		if h == nil {
+			continue
+		}
+
+		// Handle message
+		if err = h(p); err != nil {
+			c.l.Error(fmt.Errorf("astibob: handling message failed: %w", err))
+			continue
+		}
+	}
+}
+
+func (c *WebsocketClient) ping(ctx context.Context) {
+	// Create ticker
+	t := time.NewTicker(astiws.PingPeriod)
+	defer t.Stop()
+
+	// Loop
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := c.write(websocket.PingMessage, nil); err != nil {
+				c.l.Error(fmt.Errorf("astibob: sending ping message failed: %w", err))
+			}
+		}
+	}
+}
+
+// WriteJSON writes a JSON message
+func (c *WebsocketClient) WriteJSON(v interface{}) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = json.Marshal(v); err != nil {
+		err = fmt.Errorf("astibob: marshaling message failed: %w", err)
+		return
+	}
+
+	// Write
+	return c.WriteText(b)
+}
+
+// WriteBinary writes a binary message
+func (c *WebsocketClient) WriteBinary(p []byte) (err error) {
+	if err = c.write(websocket.BinaryMessage, p); err != nil {
+		err = fmt.Errorf("astibob: writing message failed: %w", err)
+		return
+	}
+	return
+}
+
+// WriteText writes a text message
+func (c *WebsocketClient) WriteText(p []byte) (err error) {
+	if err = c.write(websocket.TextMessage, p); err != nil {
+		err = fmt.Errorf("astibob: writing message failed: %w", err)
+		return
+	}
+	return
+}
+
+func (c *WebsocketClient) write(messageType int, p []byte) error {
+	// Get conn
+	conn := c.conn()
+	if conn == nil {
+		return errors.New("astibob: websocket is not connected")
+	}
+
+	// Write
+	c.mw.Lock()
+	defer c.mw.Unlock()
+	return conn.WriteMessage(messageType, p)
+}
+
+// Close sends a close frame and waits for the peer to acknowledge it if the connection is being read
+func (c *WebsocketClient) Close() (err error) {
+	// Get conn
+	c.mc.Lock()
+	conn, rd := c.c, c.rd
+	c.mc.Unlock()
+	if conn == nil {
+		return
+	}
+
+	// Send a close frame
+	if err = c.write(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")); err != nil {
+		err = fmt.Errorf("astibob: sending close frame failed: %w", err)
+		return
+	}
+
+	// Connections that are not read are closed right away
+	if rd == nil {
+		conn.Close()
+		return
+	}
+
+	// Wait for the connection to be really closed
+	<-rd
+	return
+}
+
+// WebsocketConns keeps track of the connections of websockets served by astiws managers so that they can be closed.
+// astiws clients can't be closed safely until their read loop has started, which happens after they've been adapted,
+// therefore their connections are closed instead.
+type WebsocketConns struct {
+	closed bool
+	cs     map[net.Conn]bool
+	m      *sync.Mutex // Locks closed and cs
+	wg     *sync.WaitGroup
+}
+
+func NewWebsocketConns() *WebsocketConns {
+	return &WebsocketConns{
+		cs: make(map[net.Conn]bool),
+		m:  &sync.Mutex{},
+		wg: &sync.WaitGroup{},
+	}
+}
+
+// ServeHTTP serves a websocket with the manager and keeps track of its connection until it's done
+func (cs *WebsocketConns) ServeHTTP(m *astiws.Manager, rw http.ResponseWriter, r *http.Request, a astiws.ClientAdapter) (err error) {
+	// Keep track of the hijacked connection
+	hrw := &hijackResponseWriter{ResponseWriter: rw}
+
+	// Serve
+	var added bool
+	err = m.ServeHTTP(hrw, r, func(c *astiws.Client) (err error) {
+		// Add connection
+		if err = cs.add(hrw.c); err != nil {
+			hrw.c.Close()
+			return
+		}
+		added = true
+
+		// Adapt
+		return a(c)
+	})
+
+	// Delete connection
+	if added {
+		// astiws doesn't close the connection if the adapter has failed
+		hrw.c.Close()
+		cs.del(hrw.c)
+	}
+	return
+}
+
+func (cs *WebsocketConns) add(c net.Conn) error {
+	// Lock
+	cs.m.Lock()
+	defer cs.m.Unlock()
+
+	// Connections are closed
+	if cs.closed {
+		return errors.New("astibob: websocket connections are closed")
+	}
+
+	// Add
+	cs.cs[c] = true
+	cs.wg.Add(1)
+	return nil
+}
+
+func (cs *WebsocketConns) del(c net.Conn) {
+	// Delete
+	cs.m.Lock()
+	delete(cs.cs, c)
+	cs.m.Unlock()
+
+	// Done
+	cs.wg.Done()
+}
+
+// Close closes connections and waits for their websockets to be done. Websockets served afterwards are refused.
+func (cs *WebsocketConns) Close() {
+	// Close connections
+	cs.m.Lock()
+	cs.closed = true
+	for c := range cs.cs {
+		c.Close()
+	}
+	cs.m.Unlock()
+
+	// Wait
+	cs.wg.Wait()
+}
+
+// hijackResponseWriter keeps track of the connection hijacked when upgrading to websocket
+type hijackResponseWriter struct {
+	http.ResponseWriter
+	c net.Conn
+}
+
+func (w *hijackResponseWriter) Hijack() (c net.Conn, b *bufio.ReadWriter, err error) {
+	// Response writer can't be hijacked
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		err = errors.New("astibob: response writer can't be hijacked")
+		return
+	}
+
+	// Hijack
+	if c, b, err = h.Hijack(); err != nil {
+		return
+	}
+	w.c = c
+	return
+}
@@ -0,0 +1,63 @@
+package astibob
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astiws"
+)
+
+func TestWebsocketConns(t *testing.T) {
+	// Create server
+	cs := NewWebsocketConns()
+	m := astiws.NewManager(astiws.ManagerConfiguration{}, nil)
+	served := make(chan error, 2)
+	adapted := make(chan bool, 2)
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		served <- cs.ServeHTTP(m, rw, r, func(c *astiws.Client) error {
+			adapted <- true
+			return nil
+		})
+	}))
+	defer s.Close()
+	addr := "ws" + strings.TrimPrefix(s.URL, "http")
+
+	// Connect
+	c := NewWebsocketClient(nil, nil)
+	if err := c.DialWithHeaders(addr, nil); err != nil {
+		t.Fatalf("dialing failed: %v", err)
+	}
+	read := make(chan error, 1)
+	go func() { read <- c.Read() }()
+	<-adapted
+
+	// Close connections
+	cs.Close()
+	for n, ch := range map[string]chan error{"server": served, "client": read} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("%s websocket is still open", n)
+		}
+	}
+
+	// Websockets are refused once connections are closed
+	c = NewWebsocketClient(nil, nil)
+	if err := c.DialWithHeaders(addr, nil); err != nil {
+		t.Fatalf("dialing failed: %v", err)
+	}
+	select {
+	case err := <-served:
+		if err == nil {
+			t.Fatal("websocket should have been refused")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("websocket hasn't been refused")
+	}
+	if len(adapted) > 0 {
+		t.Fatal("refused websocket shouldn't be adapted")
+	}
+}
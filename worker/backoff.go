@@ -0,0 +1,56 @@
+package worker
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Default backoffs
+const (
+	defaultMaxBackoff = 30 * time.Second
+	defaultMinBackoff = 500 * time.Millisecond
+)
+
+type backoff struct {
+	d   time.Duration
+	max time.Duration
+	min time.Duration
+}
+
+func newBackoff(min, max time.Duration) (b *backoff) {
+	// Create backoff
+	b = &backoff{
+		max: max,
+		min: min,
+	}
+
+	// Default values
+	if b.min <= 0 {
+		b.min = defaultMinBackoff
+	}
+	if b.max <= 0 {
+		b.max = defaultMaxBackoff
+	}
+	if b.max < b.min {
+		b.max = b.min
+	}
+	return
+}
+
+// next returns the next delay with jitter so that workers don't all retry at the same time, e.g. when the index
+// restarts
+func (b *backoff) next() time.Duration {
+	// Double delay
+	if b.d == 0 {
+		b.d = b.min
+	} else if b.d *= 2; b.d > b.max {
+		b.d = b.max
+	}
+
+	// Add jitter
+	return b.d/2 + time.Duration(rand.Int63n(int64(b.d/2)+1))
+}
+
+func (b *backoff) reset() {
+	b.d = 0
+}
@@ -0,0 +1,33 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	// Default values
+	b := newBackoff(0, 0)
+	if b.min != defaultMinBackoff || b.max != defaultMaxBackoff {
+		t.Fatalf("expected %s/%s, got %s/%s", defaultMinBackoff, defaultMaxBackoff, b.min, b.max)
+	}
+	b = newBackoff(time.Second, time.Millisecond)
+	if b.max != time.Second {
+		t.Fatalf("expected max %s, got %s", time.Second, b.max)
+	}
+
+	// Delays double until the max and have jitter
+	b = newBackoff(100*time.Millisecond, 400*time.Millisecond)
+	for _, d := range []time.Duration{100, 200, 400, 400} {
+		d *= time.Millisecond
+		if n := b.next(); n < d/2 || n > d {
+			t.Fatalf("expected delay between %s and %s, got %s", d/2, d, n)
+		}
+	}
+
+	// Reset
+	b.reset()
+	if n := b.next(); n < 50*time.Millisecond || n > 100*time.Millisecond {
+		t.Fatalf("expected delay between 50ms and 100ms, got %s", n)
+	}
+}
@@ -0,0 +1,454 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astikit"
+	"github.com/gorilla/websocket"
+)
+
+// Max number of messages sent in one websocket frame
+const maxChannelBatchSize = 64
+
+// Max number of messages waiting to be sent to a worker. Oldest messages are dropped beyond that.
+const maxChannelQueueSize = 10000
+
+// channel is a long-lived connection to another worker. Messages are queued and sent in order by a single goroutine,
+// batched whenever several of them are waiting, and sent through the HTTP API while the websocket is down.
+// Messages are only dequeued once they've been delivered and are retried with a backoff otherwise. Since a batch
+// may have been partially delivered before failing, each message has a sequence so that peers can ignore the ones
+// they've already received.
+type channel struct {
+	addr      string
+	c         astibob.Codec
+	cancel    context.CancelFunc
+	closed    bool
+	connected bool
+	ctx       context.Context
+	cw        *astibob.WebsocketClient
+	done      chan struct{} // Closed once pending messages have been handed over
+	inflight  int           // Number of messages at the head of q being written
+	key       []byte
+	mc        *sync.Mutex // Locks connected
+	mq        *sync.Mutex // Locks closed, inflight, next, q and seq
+	name      string
+	next      *channel // Channel replacing this one
+	q         []*astibob.Message
+	qc        chan bool
+	ready     <-chan struct{} // Closed once the previous channel has handed its pending messages over
+	seq       uint64
+	w         *Worker
+}
+
+// newChannel creates a channel to another worker. If it replaces a previous channel, e.g. because the worker's
+// address or key has changed, the previous channel is closed and hands its pending messages over.
+func (w *Worker) newChannel(name, addr string, c astibob.Codec, key []byte, prev *channel) (ch *channel) {
+	// Create channel
+	ch = &channel{
+		addr: addr,
+		c:    c,
+		cw:   astibob.NewWebsocketClient(w.wd, w.sl),
+		done: make(chan struct{}),
+		key:  key,
+		mc:   &sync.Mutex{},
+		mq:   &sync.Mutex{},
+		name: name,
+		qc:   make(chan bool, 1),
+		// Sequences must keep increasing even if the worker restarts
+		seq: uint64(time.Now().UnixNano()),
+		w:   w,
+	}
+
+	// Create context
+	ch.ctx, ch.cancel = context.WithCancel(w.w.Context())
+
+	// Replace previous channel
+	if prev != nil {
+		// Forward new messages
+		prev.mq.Lock()
+		prev.next = ch
+		ch.seq = prev.seq
+		prev.mq.Unlock()
+
+		// Close previous channel
+		prev.close()
+		ch.ready = prev.done
+	} else {
+		r := make(chan struct{})
+		close(r)
+		ch.ready = r
+	}
+
+	// Execute in a task
+	w.w.NewTask().Do(func() {
+		// Connect
+		go ch.connect()
+
+		// Write
+		ch.write()
+
+		// Close websocket
+		if err := ch.cw.Close(); err != nil {
+			w.l.Error(fmt.Errorf("worker: closing channel to worker %s failed: %w", name, err))
+		}
+
+		// Hand pending messages over
+		ch.handOver()
+	})
+	return
+}
+
+func (ch *channel) close() {
+	// Workers don't have a channel to themselves
+	if ch == nil {
+		return
+	}
+	ch.cancel()
+}
+
+func (ch *channel) send(m *astibob.Message) {
+	// Lock
+	ch.mq.Lock()
+
+	// Channel has been replaced
+	if next := ch.next; next != nil {
+		ch.mq.Unlock()
+		next.send(m)
+		return
+	}
+
+	// Channel has been closed
+	if ch.closed {
+		ch.mq.Unlock()
+		ch.drop(1)
+		return
+	}
+
+	// Enqueue
+	// The same message may be sent to several workers, therefore the sequence is set on a copy
+	ch.seq++
+	c := *m
+	c.Sequence = ch.seq
+	ch.q = append(ch.q, &c)
+
+	// Drop oldest messages that are not being written
+	n := ch.trim()
+
+	// Unlock
+	ch.mq.Unlock()
+
+	// Count dropped messages
+	if n > 0 {
+		ch.drop(n)
+	}
+
+	// Notify
+	ch.notify()
+}
+
+// trim must be called with mq locked
+func (ch *channel) trim() (n int) {
+	for len(ch.q) > maxChannelQueueSize && len(ch.q) > ch.inflight {
+		ch.q = append(ch.q[:ch.inflight], ch.q[ch.inflight+1:]...)
+		n++
+	}
+	return
+}
+
+func (ch *channel) notify() {
+	select {
+	case ch.qc <- true:
+	default:
+	}
+}
+
+func (ch *channel) drop(n int) {
+	ch.w.cd.WithLabelValues(ch.name).Add(float64(n))
+	ch.w.l.Debugf("worker: dropped %d message(s) to worker %s", n, ch.name)
+}
+
+func (ch *channel) handOver() {
+	// Wait for the previous channel to hand its pending messages over
+	<-ch.ready
+
+	// Get pending messages
+	ch.mq.Lock()
+	ch.closed = true
+	next, q := ch.next, ch.q
+	ch.q = nil
+	ch.mq.Unlock()
+
+	// Signal
+	defer close(ch.done)
+
+	// No messages
+	if len(q) == 0 {
+		return
+	}
+
+	// No channel replaces this one
+	if next == nil {
+		ch.drop(len(q))
+		return
+	}
+
+	// Prepend pending messages since they've been sent before the ones of the next channel
+	next.mq.Lock()
+	next.q = append(q, next.q...)
+	n := next.trim()
+	next.mq.Unlock()
+
+	// Count dropped messages
+	if n > 0 {
+		next.drop(n)
+	}
+
+	// Notify
+	next.notify()
+}
+
+func (ch *channel) isConnected() bool {
+	ch.mc.Lock()
+	defer ch.mc.Unlock()
+	return ch.connected
+}
+
+func (ch *channel) setConnected(connected bool) {
+	ch.mc.Lock()
+	defer ch.mc.Unlock()
+	ch.connected = connected
+}
+
+func (ch *channel) connect() {
+	// Create backoff
+	b := newBackoff(ch.w.o.Reconnect.MinBackoff, ch.w.o.Reconnect.MaxBackoff)
+
+	// Websocket addr follows the http addr scheme
+	const path = "/websockets/worker"
+	addr := "ws" + strings.TrimPrefix(ch.addr, "http") + path
+
+	for {
+		// Check context error
+		if ch.ctx.Err() != nil {
+			return
+		}
+
+		// Sign handshake
+		// Once the handshake is verified, the peer trusts the connection
+		h := make(http.Header)
+		if err := astibob.SignHeader(h, http.MethodGet, path, ch.w.name, ch.key, nil); err != nil {
+			ch.w.l.Error(fmt.Errorf("worker: signing handshake to worker %s failed: %w", ch.name, err))
+			astikit.Sleep(ch.ctx, b.next()) //nolint:errcheck
+			continue
+		}
+
+		// Dial
+		if err := ch.cw.DialWithHeaders(addr, h); err != nil {
+			ch.w.l.Debugf("worker: dialing worker %s failed, messages will be sent through http: %s", ch.name, err)
+		} else if ch.ctx.Err() != nil {
+			// Channel has been closed while dialing
+			ch.cw.Close() //nolint:errcheck
+			return
+		} else {
+			// We're connected
+			ch.w.l.Debugf("worker: channel to worker %s is connected", ch.name)
+			b.reset()
+			ch.setConnected(true)
+
+			// Read
+			// Peers never write on this connection but reading is required to handle pings and closing
+			err = ch.cw.Read()
+			ch.setConnected(false)
+			var e *websocket.CloseError
+			if ok := errors.As(err, &e); !ok || e.Code != websocket.CloseNormalClosure {
+				ch.w.l.Debugf("worker: reading channel to worker %s failed: %s", ch.name, err)
+			}
+		}
+
+		// Sleep
+		astikit.Sleep(ch.ctx, b.next()) //nolint:errcheck
+	}
+}
+
+func (ch *channel) write() {
+	// Wait for the previous channel to hand its pending messages over
+	select {
+	case <-ch.ready:
+	case <-ch.ctx.Done():
+		return
+	}
+
+	// Create backoff
+	b := newBackoff(ch.w.o.Reconnect.MinBackoff, ch.w.o.Reconnect.MaxBackoff)
+
+	for {
+		// Wait for messages
+		select {
+		case <-ch.qc:
+		case <-ch.ctx.Done():
+			return
+		}
+
+		// Loop through batches
+		for {
+			// Peek
+			ch.mq.Lock()
+			n := len(ch.q)
+			if n > maxChannelBatchSize {
+				n = maxChannelBatchSize
+			}
+			ms := make([]*astibob.Message, n)
+			copy(ms, ch.q[:n])
+			ch.inflight = n
+			ch.mq.Unlock()
+
+			// No messages
+			if len(ms) == 0 {
+				break
+			}
+
+			// Write
+			n, err := ch.writeBatch(ms)
+
+			// Dequeue delivered messages
+			ch.mq.Lock()
+			ch.q = ch.q[n:]
+			ch.inflight = 0
+			ch.mq.Unlock()
+
+			// Write failed
+			if err != nil {
+				// Log
+				ch.w.l.Error(fmt.Errorf("worker: writing to channel of worker %s failed, retrying: %w", ch.name, err))
+
+				// Sleep
+				if err = astikit.Sleep(ch.ctx, b.next()); err != nil {
+					return
+				}
+				continue
+			}
+
+			// Reset backoff
+			b.reset()
+		}
+	}
+}
+
+// writeBatch returns the number of messages that have been delivered
+func (ch *channel) writeBatch(ms []*astibob.Message) (n int, err error) {
+	// Write to websocket
+	if ch.isConnected() {
+		if err = ch.writeWebsocket(ms); err == nil {
+			n = len(ms)
+			return
+		}
+		ch.w.l.Debugf("worker: writing to websocket of worker %s failed, falling back to http: %s", ch.name, err)
+	}
+
+	// Loop through messages
+	for _, m := range ms {
+		if err = ch.writeHTTP(m); err != nil {
+			ch.w.pf.WithLabelValues(ch.name).Inc()
+			err = fmt.Errorf("worker: sending message %s failed: %w", m.Name, err)
+			return
+		}
+		n++
+	}
+	return
+}
+
+func (ch *channel) writeWebsocket(ms []*astibob.Message) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = ch.c.Marshal(ms); err != nil {
+		err = fmt.Errorf("worker: marshaling %s messages failed: %w", ch.c.Name(), err)
+		return
+	}
+
+	// Write
+	if err = astibob.WriteWebsocket(ch.cw, ch.c, b); err != nil {
+		err = fmt.Errorf("worker: writing %s messages failed: %w", ch.c.Name(), err)
+		return
+	}
+	return
+}
+
+func (ch *channel) writeHTTP(m *astibob.Message) (err error) {
+	// Marshal
+	var b []byte
+	if b, err = ch.c.Marshal(m); err != nil {
+		err = fmt.Errorf("worker: marshaling %s message failed: %w", ch.c.Name(), err)
+		return
+	}
+
+	// Send request
+	if err = ch.w.sendRequestToWorker(ch.ctx, http.MethodPost, fmt.Sprintf("%s/api/messages", ch.addr), ch.c.ContentType(), ch.key, b); err != nil {
+		err = fmt.Errorf("worker: sending request failed: %w", err)
+		return
+	}
+	return
+}
+
+// Number of sequences remembered per worker. Messages may be received out of order when a worker falls back from
+// the websocket to the HTTP API, therefore a window is used rather than only the last sequence.
+const sequencesWindow = 4096
+
+type sequences struct {
+	max  uint64
+	seen map[uint64]bool
+}
+
+func newSequences() *sequences {
+	return &sequences{seen: make(map[uint64]bool)}
+}
+
+// add returns false if the sequence has already been received
+func (s *sequences) add(seq uint64) bool {
+	// Messages without sequence are always accepted
+	if seq == 0 {
+		return true
+	}
+
+	// Too old or already received
+	if (s.max > sequencesWindow && seq <= s.max-sequencesWindow) || s.seen[seq] {
+		return false
+	}
+
+	// Add
+	s.seen[seq] = true
+	if seq > s.max {
+		s.max = seq
+	}
+
+	// Forget old sequences
+	if len(s.seen) > 2*sequencesWindow {
+		for k := range s.seen {
+			if s.max > sequencesWindow && k <= s.max-sequencesWindow {
+				delete(s.seen, k)
+			}
+		}
+	}
+	return true
+}
+
+// receivedMessage returns false if the message has already been received from that worker
+func (w *Worker) receivedMessage(name string, m *astibob.Message) bool {
+	// Lock
+	w.mq.Lock()
+	defer w.mq.Unlock()
+
+	// Get sequences
+	s, ok := w.qs[name]
+	if !ok {
+		s = newSequences()
+		w.qs[name] = s
+	}
+	return s.add(m.Sequence)
+}
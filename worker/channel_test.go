@@ -0,0 +1,215 @@
+package worker
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type channelReceiver struct {
+	fails int // Number of requests failing before messages are handled
+	m     *sync.Mutex
+	ns    []string
+	s     *httptest.Server
+	w     *Worker
+}
+
+func newChannelReceiver(key []byte, fails int) (r *channelReceiver) {
+	// Create receiver
+	r = &channelReceiver{
+		fails: fails,
+		m:     &sync.Mutex{},
+		w:     New("r", Options{}, nil),
+	}
+	r.w.ws["w"] = newWorker(astibob.Worker{Key: key, Name: "w"})
+
+	// Record messages
+	r.w.On(astibob.DispatchConditions{}, func(m *astibob.Message) error {
+		if !strings.HasPrefix(m.Name, "test.") {
+			return nil
+		}
+		r.m.Lock()
+		defer r.m.Unlock()
+		r.ns = append(r.ns, m.Name)
+		return nil
+	})
+
+	// Create server
+	// Websockets are not handled so that messages are sent through the HTTP API
+	r.s = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/api/messages" {
+			rw.WriteHeader(http.StatusNotFound)
+			return
+		}
+		r.m.Lock()
+		fail := r.fails > 0
+		if fail {
+			r.fails--
+		}
+		r.m.Unlock()
+		if fail {
+			rw.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		r.w.handleWorkerMessage(rw, req, nil)
+	}))
+	return
+}
+
+func (r *channelReceiver) close() {
+	r.s.Close()
+	r.w.Close()
+}
+
+func (r *channelReceiver) wait(t *testing.T, expected []string) {
+	for i := 0; i < 200; i++ {
+		r.m.Lock()
+		ns := append([]string{}, r.ns...)
+		r.m.Unlock()
+		if len(ns) >= len(expected) {
+			if !reflect.DeepEqual(expected, ns) {
+				t.Fatalf("expected %+v, got %+v", expected, ns)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("messages %+v have not been received", expected)
+}
+
+func newChannelMessage(name string) *astibob.Message {
+	return &astibob.Message{From: *astibob.NewRunnableIdentifier("r", "w"), Name: name}
+}
+
+func TestChannelRetry(t *testing.T) {
+	// Create receiver
+	key := []byte("key")
+	r := newChannelReceiver(key, 2)
+	defer r.close()
+
+	// Create sender
+	w := New("w", Options{Reconnect: ReconnectOptions{MaxBackoff: 10 * time.Millisecond, MinBackoff: time.Millisecond}}, nil)
+	defer w.Close()
+	ch := w.newChannel("r", r.s.URL, astibob.JSONCodec, key, nil)
+	defer ch.close()
+
+	// Failed messages are retried in order
+	m := newChannelMessage("test.1")
+	ch.send(m)
+	ch.send(newChannelMessage("test.2"))
+	r.wait(t, []string{"test.1", "test.2"})
+	if f := testutil.ToFloat64(w.pf.WithLabelValues("r")); f != 2 {
+		t.Fatalf("expected 2 post failures, got %v", f)
+	}
+	if f := testutil.ToFloat64(w.cd.WithLabelValues("r")); f != 0 {
+		t.Fatalf("expected no dropped messages, got %v", f)
+	}
+
+	// Shared messages are not updated
+	if m.Sequence != 0 {
+		t.Fatalf("expected no sequence, got %d", m.Sequence)
+	}
+}
+
+func TestChannelHandOver(t *testing.T) {
+	// Create receiver
+	key := []byte("key")
+	r := newChannelReceiver(key, 0)
+	defer r.close()
+
+	// Create sender with a channel to an unreachable address
+	w := New("w", Options{Reconnect: ReconnectOptions{MaxBackoff: 10 * time.Millisecond, MinBackoff: time.Millisecond}}, nil)
+	defer w.Close()
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	ch1 := w.newChannel("r", s.URL, astibob.JSONCodec, key, nil)
+	ch1.send(newChannelMessage("test.1"))
+	ch1.send(newChannelMessage("test.2"))
+
+	// Replace channel
+	ch2 := w.newChannel("r", r.s.URL, astibob.JSONCodec, key, ch1)
+	defer ch2.close()
+
+	// Messages sent to the previous channel are forwarded
+	ch1.send(newChannelMessage("test.3"))
+	ch2.send(newChannelMessage("test.4"))
+
+	// Pending messages have been handed over in order
+	r.wait(t, []string{"test.1", "test.2", "test.3", "test.4"})
+	if f := testutil.ToFloat64(w.cd.WithLabelValues("r")); f != 0 {
+		t.Fatalf("expected no dropped messages, got %v", f)
+	}
+}
+
+func TestChannelDrop(t *testing.T) {
+	// Create sender with a channel to an unreachable address
+	w := New("w", Options{Reconnect: ReconnectOptions{MaxBackoff: 10 * time.Millisecond, MinBackoff: time.Millisecond}}, nil)
+	defer w.Close()
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+	ch := w.newChannel("r", s.URL, astibob.JSONCodec, []byte("key"), nil)
+
+	// Queue is full
+	for i := 0; i < maxChannelQueueSize+2; i++ {
+		ch.send(newChannelMessage(fmt.Sprintf("test.%d", i)))
+	}
+	if f := testutil.ToFloat64(w.cd.WithLabelValues("r")); f != 2 {
+		t.Fatalf("expected 2 dropped messages, got %v", f)
+	}
+
+	// Pending messages are dropped when the channel is closed without being replaced
+	ch.close()
+	<-ch.done
+	if f := testutil.ToFloat64(w.cd.WithLabelValues("r")); f != maxChannelQueueSize+2 {
+		t.Fatalf("expected %d dropped messages, got %v", maxChannelQueueSize+2, f)
+	}
+
+	// Messages sent to a closed channel are dropped
+	ch.send(newChannelMessage("test.closed"))
+	if f := testutil.ToFloat64(w.cd.WithLabelValues("r")); f != maxChannelQueueSize+3 {
+		t.Fatalf("expected %d dropped messages, got %v", maxChannelQueueSize+3, f)
+	}
+}
+
+func TestChannelDuplicates(t *testing.T) {
+	// Create receiver
+	key := []byte("key")
+	r := newChannelReceiver(key, 0)
+	defer r.close()
+
+	// Send messages twice or out of order
+	for _, seq := range []uint64{2, 2, 1, 3, 1, 0, 0} {
+		m := newChannelMessage(fmt.Sprintf("test.%d", seq))
+		m.Sequence = seq
+		b, err := astibob.JSONCodec.Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/api/messages", bytes.NewReader(b))
+		if err = astibob.SignRequest(req, "w", key, b); err != nil {
+			t.Fatal(err)
+		}
+		r.w.handleWorkerMessage(httptest.NewRecorder(), req, nil)
+	}
+
+	// Duplicates have been ignored
+	r.wait(t, []string{"test.2", "test.1", "test.3", "test.0", "test.0"})
+
+	// Too old sequences are ignored
+	s := newSequences()
+	if !s.add(sequencesWindow + 10) {
+		t.Fatal("sequence should be accepted")
+	}
+	if s.add(5) {
+		t.Fatal("too old sequence should be ignored")
+	}
+}
@@ -0,0 +1,267 @@
+package worker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/asticode/go-astibob"
+	"github.com/julienschmidt/httprouter"
+)
+
+// errInvalidConfig is returned when a config is rejected by the schema or the runnable
+var errInvalidConfig = errors.New("worker: invalid config")
+
+func (w *Worker) configurable(name string) (c astibob.Configurable, err error) {
+	// Fetch runnable
+	w.mr.Lock()
+	r, ok := w.rs[name]
+	w.mr.Unlock()
+
+	// No runnable
+	if !ok {
+		err = fmt.Errorf("worker: no %s runnable", name)
+		return
+	}
+
+	// Not configurable
+	if c, ok = r.(astibob.Configurable); !ok {
+		err = fmt.Errorf("worker: runnable %s is not configurable", name)
+		return
+	}
+	return
+}
+
+func (w *Worker) configPath(name string) string {
+	return filepath.Join(w.o.ConfigsDirPath, name+".json")
+}
+
+// loadRunnableConfig applies the config that has been persisted for a runnable, if any
+func (w *Worker) loadRunnableConfig(name string) (err error) {
+	// Configs are not persisted
+	if w.o.ConfigsDirPath == "" {
+		return
+	}
+
+	// Read file
+	var b []byte
+	if b, err = ioutil.ReadFile(w.configPath(name)); err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		} else {
+			err = fmt.Errorf("worker: reading %s failed: %w", w.configPath(name), err)
+		}
+		return
+	}
+
+	// Unmarshal
+	var c astibob.Config
+	if err = json.Unmarshal(b, &c); err != nil {
+		err = fmt.Errorf("worker: unmarshaling %s failed: %w", w.configPath(name), err)
+		return
+	}
+
+	// Apply
+	if _, err = w.applyRunnableConfig(name, c); err != nil {
+		err = fmt.Errorf("worker: applying config failed: %w", err)
+		return
+	}
+
+	// Log
+	w.l.Infof("worker: loaded config of runnable %s", name)
+	return
+}
+
+func (w *Worker) saveRunnableConfig(name string, c astibob.Config) (err error) {
+	// Configs are not persisted
+	if w.o.ConfigsDirPath == "" {
+		return
+	}
+
+	// Make sure the dir exists
+	if err = os.MkdirAll(w.o.ConfigsDirPath, 0755); err != nil {
+		err = fmt.Errorf("worker: mkdirall %s failed: %w", w.o.ConfigsDirPath, err)
+		return
+	}
+
+	// Marshal
+	var b []byte
+	if b, err = json.MarshalIndent(c, "", "  "); err != nil {
+		err = fmt.Errorf("worker: marshaling failed: %w", err)
+		return
+	}
+
+	// Write to a temporary file first so that a crash never leaves a truncated config behind
+	p := w.configPath(name)
+	if err = ioutil.WriteFile(p+".tmp", b, 0644); err != nil {
+		err = fmt.Errorf("worker: writing %s failed: %w", p+".tmp", err)
+		return
+	}
+
+	// Rename
+	if err = os.Rename(p+".tmp", p); err != nil {
+		err = fmt.Errorf("worker: renaming %s into %s failed: %w", p+".tmp", p, err)
+		return
+	}
+	return
+}
+
+// applyRunnableConfig merges the update with the current config, validates the result and applies it
+func (w *Worker) applyRunnableConfig(name string, u astibob.Config) (c astibob.Config, err error) {
+	// Get configurable
+	var r astibob.Configurable
+	if r, err = w.configurable(name); err != nil {
+		return
+	}
+
+	// Lock
+	// Configs are merged with the current config which must not change in the meantime
+	w.mg.Lock()
+	defer w.mg.Unlock()
+
+	// Merge
+	c = r.Config().Merge(u)
+
+	// Validate
+	if err = r.ConfigSchema().Validate(c); err != nil {
+		err = fmt.Errorf("%w: %s", errInvalidConfig, err)
+		return
+	}
+	if err = r.ValidateConfig(c); err != nil {
+		err = fmt.Errorf("%w: %s", errInvalidConfig, err)
+		return
+	}
+
+	// Apply
+	if err = r.ApplyConfig(c); err != nil {
+		err = fmt.Errorf("worker: applying config failed: %w", err)
+		return
+	}
+	return
+}
+
+func (w *Worker) updateRunnableConfig(name string, u astibob.Config) (c astibob.Config, err error) {
+	// Apply
+	if c, err = w.applyRunnableConfig(name, u); err != nil {
+		return
+	}
+
+	// Log
+	w.l.Infof("worker: updated config of runnable %s", name)
+
+	// Save
+	if err = w.saveRunnableConfig(name, c); err != nil {
+		err = fmt.Errorf("worker: saving config failed: %w", err)
+		return
+	}
+
+	// Create updated message
+	var m *astibob.Message
+	if m, err = astibob.NewRunnableConfigUpdatedMessage(*w.runnableIdentifier(name), &astibob.Identifier{Types: map[string]bool{
+		astibob.UIIdentifierType:     true,
+		astibob.WorkerIdentifierType: true,
+	}}, c); err != nil {
+		err = fmt.Errorf("worker: creating config updated message failed: %w", err)
+		return
+	}
+
+	// Dispatch
+	w.d.Dispatch(m)
+	return
+}
+
+func (w *Worker) updateRunnableConfigFromMessage(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
+	// Parse payload
+	var u astibob.RunnableConfigUpdate
+	if u, err = astibob.ParseRunnableConfigUpdatePayload(m); err != nil {
+		err = fmt.Errorf("worker: parsing config update payload failed: %w", err)
+		return
+	}
+
+	// Update config
+	if _, err = w.updateRunnableConfig(u.Runnable, u.Config); err != nil {
+		err = fmt.Errorf("worker: updating config of runnable %s failed: %w", u.Runnable, err)
+		return
+	}
+	return
+}
+
+// UpdateRunnableConfig updates the config of a runnable of the worker. Missing fields keep their value.
+func (w *Worker) UpdateRunnableConfig(name string, u astibob.Config) (err error) {
+	if _, err = w.updateRunnableConfig(name, u); err != nil {
+		err = fmt.Errorf("worker: updating config of runnable %s failed: %w", name, err)
+		return
+	}
+	return
+}
+
+func (w *Worker) getRunnableConfig(name string) httprouter.Handle {
+	return func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// Set content type
+		rw.Header().Set("Content-Type", "application/json")
+
+		// Get configurable
+		c, err := w.configurable(name)
+		if err != nil {
+			astibob.WriteHTTPError(w.l, rw, http.StatusNotFound, err)
+			return
+		}
+
+		// Write
+		astibob.WriteHTTPData(w.l, rw, astibob.RunnableConfig{
+			Config: c.Config(),
+			Schema: c.ConfigSchema(),
+		})
+	}
+}
+
+func (w *Worker) patchRunnableConfig(name string) httprouter.Handle {
+	return func(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// Set content type
+		rw.Header().Set("Content-Type", "application/json")
+
+		// Read body
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			astibob.WriteHTTPError(w.l, rw, http.StatusInternalServerError, fmt.Errorf("worker: reading body failed: %w", err))
+			return
+		}
+
+		// Verify signature
+		// Configs can only be updated through the index, which checks the user's role
+		if _, err = w.sv.Verify(r, b, w.indexKey); err != nil {
+			astibob.WriteHTTPError(w.l, rw, http.StatusUnauthorized, fmt.Errorf("worker: verifying signature failed: %w", err))
+			return
+		}
+
+		// Parse body
+		var u astibob.Config
+		if err = json.Unmarshal(b, &u); err != nil {
+			astibob.WriteHTTPError(w.l, rw, http.StatusBadRequest, fmt.Errorf("worker: parsing config payload failed: %w", err))
+			return
+		}
+
+		// Update config
+		c, err := w.updateRunnableConfig(name, u)
+		if err != nil {
+			code := http.StatusInternalServerError
+			if errors.Is(err, errInvalidConfig) {
+				code = http.StatusBadRequest
+			}
+			astibob.WriteHTTPError(w.l, rw, code, fmt.Errorf("worker: updating config of runnable %s failed: %w", name, err))
+			return
+		}
+
+		// Write
+		astibob.WriteHTTPData(w.l, rw, c)
+	}
+}
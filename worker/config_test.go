@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+)
+
+type configurableRunnable struct {
+	*astibob.BaseRunnable
+	c astibob.Config
+}
+
+func newConfigurableRunnable(name string) *configurableRunnable {
+	return &configurableRunnable{
+		BaseRunnable: astibob.NewBaseRunnable(astibob.BaseRunnableOptions{Metadata: astibob.Metadata{Name: name}}),
+		c:            astibob.Config{"value": "default"},
+	}
+}
+
+func (r *configurableRunnable) ApplyConfig(c astibob.Config) error {
+	r.c = c
+	return nil
+}
+
+func (r *configurableRunnable) Config() astibob.Config { return r.c }
+
+func (r *configurableRunnable) ConfigSchema() astibob.ConfigSchema {
+	return astibob.ConfigSchema{Fields: []astibob.ConfigField{{Label: "Value", Name: "value", Type: astibob.ConfigFieldTypeString}}}
+}
+
+func (r *configurableRunnable) ValidateConfig(c astibob.Config) error { return nil }
+
+func TestPatchRunnableConfig(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+	r := newConfigurableRunnable("r")
+	w.RegisterRunnables(Runnable{Runnable: r})
+	w.ik = []byte("index key")
+
+	// Loop through cases
+	body := []byte(`{"value":"updated"}`)
+	for _, v := range []struct {
+		code   int
+		key    []byte
+		name   string
+		sender string
+	}{
+		{code: http.StatusUnauthorized, name: "unsigned"},
+		{code: http.StatusUnauthorized, key: []byte("other key"), name: "invalid key", sender: astibob.IndexIdentifierType},
+		{code: http.StatusUnauthorized, key: []byte("index key"), name: "not the index", sender: "w2"},
+		{code: http.StatusOK, key: []byte("index key"), name: "signed by the index", sender: astibob.IndexIdentifierType},
+	} {
+		// Create request
+		req := httptest.NewRequest(http.MethodPatch, "/runnables/r/config", bytes.NewReader(body))
+		if v.key != nil {
+			if err := astibob.SignRequest(req, v.sender, v.key, body); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		// Handle
+		rw := httptest.NewRecorder()
+		w.patchRunnableConfig("r")(rw, req, nil)
+		if rw.Code != v.code {
+			t.Fatalf("%s: expected %d, got %d", v.name, v.code, rw.Code)
+		}
+
+		// Check config
+		if e := v.code == http.StatusOK; (r.c["value"] == "updated") != e {
+			t.Fatalf("%s: expected config to be updated: %v, got %+v", v.name, e, r.c)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+// startHeartbeats sends heartbeats to the index periodically until the connection drops
+func (w *Worker) startHeartbeats(period time.Duration) {
+	// Stop previous heartbeats
+	w.stopHeartbeats()
+
+	// The index doesn't expect heartbeats
+	if period <= 0 {
+		return
+	}
+
+	// Create context
+	ctx, cancel := context.WithCancel(w.w.Context())
+	w.mh.Lock()
+	w.hc = cancel
+	w.mh.Unlock()
+
+	// Execute in a task
+	w.w.NewTask().Do(func() {
+		// Create ticker
+		t := time.NewTicker(period)
+		defer t.Stop()
+
+		// Loop
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				w.sendHeartbeat()
+			}
+		}
+	})
+}
+
+func (w *Worker) stopHeartbeats() {
+	// Lock
+	w.mh.Lock()
+	defer w.mh.Unlock()
+
+	// Stop heartbeats
+	if w.hc != nil {
+		w.hc()
+		w.hc = nil
+	}
+}
+
+func (w *Worker) sendHeartbeat() {
+	// Get memory stats
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	// Create heartbeat
+	h := astibob.Heartbeat{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  ms.HeapAlloc,
+		Runnables:  w.runnableMessages(),
+		SentAt:     time.Now(),
+	}
+
+	// Add queued messages
+	for _, v := range w.d.Stats().Queued {
+		h.QueuedMessages += v
+	}
+
+	// Create message
+	m, err := astibob.NewWorkerHeartbeatMessage(*w.workerIdentifier(), &astibob.Identifier{Type: astibob.IndexIdentifierType}, h)
+	if err != nil {
+		w.l.Error(fmt.Errorf("worker: creating heartbeat message failed: %w", err))
+		return
+	}
+
+	// Dispatch
+	// Heartbeats go through the dispatcher so that a stuck dispatcher stops them
+	w.d.Dispatch(m)
+}
@@ -1,46 +1,155 @@
 package worker
 
 import (
+	"bytes"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
 	"sort"
+	"time"
 
 	"github.com/asticode/go-astibob"
-	"github.com/asticode/go-astiws"
+	"github.com/asticode/go-astikit"
 	"github.com/gorilla/websocket"
 )
 
-// Register registers the worker to the index
+// Register registers the worker to the index and reconnects whenever the connection drops
 func (w *Worker) RegisterToIndex() {
 	// Create headers
 	h := make(http.Header)
-	if w.o.Index.Password != "" && w.o.Index.Username != "" {
+	if w.o.Token != "" {
+		h.Set("Authorization", "Bearer "+w.o.Token)
+	} else if w.o.Index.Password != "" && w.o.Index.Username != "" {
 		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(w.o.Index.Username+":"+w.o.Index.Password)))
 	}
 
-	// Dial and read
-	w.cw.DialAndRead(w.w, astiws.DialAndReadOptions{
-		Addr:   "ws://" + w.o.Index.Addr + "/websockets/worker",
-		Header: h,
-		OnDial: w.sendRegister,
-		OnReadError: func(err error) {
-			var e *websocket.CloseError
-			if ok := errors.As(err, &e); ok && e.Code == websocket.CloseNormalClosure {
-				w.l.Info("worker: worker has disconnected from index")
-			} else {
-				w.l.Error(fmt.Errorf("worker: reading websocket failed: %w", err))
-			}
-		},
+	// Execute in a task
+	w.w.NewTask().Do(func() {
+		// Connect
+		go w.connectToIndex(w.o.Index.WebsocketScheme()+"://"+w.o.Index.Addr+"/websockets/worker", h)
+
+		// Wait for context to be done
+		<-w.w.Context().Done()
 	})
 }
 
+func (w *Worker) connectToIndex(addr string, h http.Header) {
+	// Create backoff
+	b := newBackoff(w.o.Reconnect.MinBackoff, w.o.Reconnect.MaxBackoff)
+
+	for {
+		// Check context error
+		if w.w.Context().Err() != nil {
+			return
+		}
+
+		// Dial
+		w.l.Infof("worker: dialing index at %s", addr)
+		w.dispatchIndexState(astibob.IndexStateConnecting, nil)
+		if err := w.cw.DialWithHeaders(addr, h); err != nil {
+			w.l.Error(fmt.Errorf("worker: dialing index failed: %w", err))
+			w.waitBeforeReconnecting(b, err)
+			continue
+		}
+
+		// Register
+		// Runnable statuses are read at that point and listenables are replayed to all workers once the index welcomes
+		// us, so that the index and the other workers catch up on whatever happened while we were disconnected
+		if err := w.sendRegister(); err != nil {
+			w.l.Error(fmt.Errorf("worker: sending register failed: %w", err))
+			w.waitBeforeReconnecting(b, err)
+			continue
+		}
+
+		// We're connected
+		b.reset()
+		w.dispatchIndexState(astibob.IndexStateConnected, nil)
+
+		// Read
+		err := w.cw.Read()
+
+		// Stop heartbeats
+		w.stopHeartbeats()
+		var e *websocket.CloseError
+		if ok := errors.As(err, &e); ok && e.Code == websocket.CloseNormalClosure {
+			w.l.Info("worker: worker has disconnected from index")
+		} else {
+			w.l.Error(fmt.Errorf("worker: reading websocket failed: %w", err))
+		}
+		w.waitBeforeReconnecting(b, err)
+	}
+}
+
+func (w *Worker) waitBeforeReconnecting(b *backoff, err error) {
+	// Context is done
+	if w.w.Context().Err() != nil {
+		return
+	}
+
+	// Dispatch
+	w.dispatchIndexState(astibob.IndexStateDisconnected, err)
+
+	// Sleep
+	d := b.next()
+	w.l.Infof("worker: reconnecting to index in %s", d)
+	astikit.Sleep(w.w.Context(), d) //nolint:errcheck
+}
+
+// dispatchIndexState dispatches the index connection state locally so that handlers added through On can react to it
+func (w *Worker) dispatchIndexState(state string, err error) {
+	// Create state
+	s := astibob.IndexState{State: state}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	// Create message
+	m, err := astibob.NewWorkerIndexStateMessage(*w.workerIdentifier(), w.workerIdentifier(), s)
+	if err != nil {
+		w.l.Error(fmt.Errorf("worker: creating index state message failed: %w", err))
+		return
+	}
+
+	// Dispatch
+	w.d.Dispatch(m)
+}
+
 func (w *Worker) sendRegister() (err error) {
-	// Get runnable keys
+	// Until the index welcomes us, we don't know which codecs it supports
+	w.mc.Lock()
+	w.c = astibob.JSONCodec
+	w.mc.Unlock()
+
+	// Create register message
+	var m *astibob.Message
+	if m, err = astibob.NewWorkerRegisterMessage(*w.workerIdentifier(), &astibob.Identifier{
+		Type: astibob.IndexIdentifierType,
+	}, astibob.Worker{
+		Addr:        w.o.Server.HTTPScheme() + "://" + w.o.Server.Addr,
+		Codecs:      astibob.SupportedCodecs,
+		Heartbeats:  true,
+		Listenables: w.listenableSubscriptions(),
+		Name:        w.name,
+		Runnables:   w.runnableMessages(),
+	}); err != nil {
+		err = fmt.Errorf("worker: creating register message failed: %w", err)
+		return
+	}
+
+	// Dispatch
+	w.d.Dispatch(m)
+	return
+}
+
+// runnableMessages returns the runnables sorted by name, as sent to the index
+func (w *Worker) runnableMessages() (rs []astibob.RunnableMessage) {
+	// Lock
 	w.mr.Lock()
+	defer w.mr.Unlock()
+
+	// Get keys
 	var ks []string
 	for k := range w.rs {
 		ks = append(ks, k)
@@ -50,17 +159,29 @@ func (w *Worker) sendRegister() (err error) {
 	sort.Strings(ks)
 
 	// Loop through keys
-	var rs []astibob.RunnableMessage
 	for _, k := range ks {
 		// Get runnable
 		r := w.rs[k]
+		s := w.ss[k]
 
 		// Create runnable message
 		rm := astibob.RunnableMessage{
-			Metadata: r.Metadata(),
-			Status:   r.Status(),
+			LastError: s.lastError,
+			Metadata:  r.Metadata(),
+			Restarts:  s.restarts,
+			Status:    r.Status(),
+		}
+
+		// Add start time
+		if rm.Status == astibob.RunningStatus {
+			startedAt := s.startedAt
+			rm.StartedAt = &startedAt
+			rm.Uptime = time.Since(startedAt)
 		}
 
+		// Add configurable
+		_, rm.Configurable = r.(astibob.Configurable)
+
 		// Add web homepage
 		if o, ok := r.(astibob.Operatable); ok && len(o.Templates()) > 0 {
 			rm.WebHomepage = fmt.Sprintf("/workers/%s/runnables/%s/web/index", url.QueryEscape(w.name), url.QueryEscape(r.Metadata().Name))
@@ -69,27 +190,15 @@ func (w *Worker) sendRegister() (err error) {
 		// Append runnable
 		rs = append(rs, rm)
 	}
-	w.mr.Unlock()
-
-	// Create register message
-	var m *astibob.Message
-	if m, err = astibob.NewWorkerRegisterMessage(*w.workerIdentifier(), &astibob.Identifier{
-		Type: astibob.IndexIdentifierType,
-	}, astibob.Worker{
-		Addr:      "http://" + w.o.Server.Addr,
-		Name:      w.name,
-		Runnables: rs,
-	}); err != nil {
-		err = fmt.Errorf("worker: creating register message failed: %w", err)
-		return
-	}
-
-	// Dispatch
-	w.d.Dispatch(m)
 	return
 }
 
 func (w *Worker) finishRegistration(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var wl astibob.WelcomeWorker
 	if wl, err = astibob.ParseWorkerWelcomePayload(m); err != nil {
@@ -97,6 +206,28 @@ func (w *Worker) finishRegistration(m *astibob.Message) (err error) {
 		return
 	}
 
+	// Update codec
+	// Indexes that don't support codec negotiation only understand JSON
+	c, ok := astibob.CodecByName(wl.Codec)
+	if !ok {
+		err = fmt.Errorf("worker: unknown codec %s", wl.Codec)
+		return
+	}
+	w.mc.Lock()
+	w.c = c
+	w.mc.Unlock()
+
+	// Update index key
+	w.mk.Lock()
+	w.ik = wl.IndexKey
+	w.mk.Unlock()
+
+	// Update inspected
+	w.setInspected(wl.Inspected)
+
+	// Start heartbeats
+	w.startHeartbeats(wl.HeartbeatPeriod)
+
 	// Reset and add ui message names
 	w.mu.Lock()
 	w.us = make(map[string]bool)
@@ -122,8 +253,19 @@ func (w *Worker) finishRegistration(m *astibob.Message) (err error) {
 	}
 	w.mo.Unlock()
 
-	// Reset workers
-	w.resetWorkers()
+	// Remove workers that are gone
+	// Remaining workers are updated below which keeps their channels open
+	w.mw.Lock()
+	var ns []string
+	for n := range w.ws {
+		if _, ok := iws[n]; !ok {
+			ns = append(ns, n)
+		}
+	}
+	w.mw.Unlock()
+	for _, n := range ns {
+		w.delWorker(n)
+	}
 
 	// Loop through workers
 	for _, mw := range wl.Workers {
@@ -142,13 +284,23 @@ func (w *Worker) finishRegistration(m *astibob.Message) (err error) {
 	return
 }
 
+// checkIndexMessage makes sure a message has been sent by the index. Peers can't send messages on behalf of the
+// index since they're only allowed to send messages from themselves, and index messages are rejected when they come
+// from peers.
+func checkIndexMessage(m *astibob.Message) error {
+	if m.From.Type != astibob.IndexIdentifierType {
+		return fmt.Errorf("worker: message %s has been sent by %s instead of the index", m.Name, m.From.Type)
+	}
+	return nil
+}
+
 func (w *Worker) handleIndexMessage(p []byte) (err error) {
 	// Log
 	w.l.Debugf("worker: handling index message %s", p)
 
 	// Unmarshal
 	m := astibob.NewMessage()
-	if err = json.Unmarshal(p, m); err != nil {
+	if err = astibob.UnmarshalMessage(p, m); err != nil {
 		err = fmt.Errorf("worker: unmarshaling failed: %w", err)
 		return
 	}
@@ -168,14 +320,29 @@ func (w *Worker) sendMessageToIndex(m *astibob.Message) (err error) {
 	w.l.Debugf("worker: sending %s message to index", m.Name)
 
 	// Write
-	if err = w.cw.WriteJSON(m); err != nil {
-		err = fmt.Errorf("worker: writing JSON message failed: %w", err)
+	if err = w.writeToIndex(m); err != nil {
+		err = fmt.Errorf("worker: writing message failed: %w", err)
 		return
 	}
 	return
 }
 
+func (w *Worker) writeToIndex(m *astibob.Message) error {
+	// Get codec
+	w.mc.Lock()
+	c := w.c
+	w.mc.Unlock()
+
+	// Write
+	return astibob.WriteWebsocketMessage(w.cw, c, m)
+}
+
 func (w *Worker) registerWorker(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var mw astibob.Worker
 	if mw, err = astibob.ParseWorkerRegisteredPayload(m); err != nil {
@@ -204,6 +371,11 @@ func (w *Worker) resetWorkers() {
 	w.mw.Lock()
 	defer w.mw.Unlock()
 
+	// Close channels
+	for _, mw := range w.ws {
+		mw.ch.close()
+	}
+
 	// Reset
 	w.ws = make(map[string]*worker)
 }
@@ -216,11 +388,34 @@ func (w *Worker) addWorker(m astibob.Worker) {
 	// Create worker
 	nw := newWorker(m)
 
+	// No channel is needed to communicate with itself
+	if nw.name != w.name {
+		// Reuse the previous channel when possible
+		if pw, ok := w.ws[nw.name]; ok && pw.addr == nw.addr && pw.c == nw.c && bytes.Equal(pw.key, nw.key) {
+			nw.ch = pw.ch
+		} else {
+			// Get previous channel
+			// It hands its pending messages over to the new channel
+			var prev *channel
+			if ok {
+				prev = pw.ch
+			}
+
+			// Create channel
+			nw.ch = w.newChannel(nw.name, nw.addr, nw.c, nw.key, prev)
+		}
+	}
+
 	// Update pool
 	w.ws[nw.name] = nw
 }
 
 func (w *Worker) unregisterWorker(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var name string
 	if name, err = astibob.ParseWorkerDisconnectedPayload(m); err != nil {
@@ -236,6 +431,9 @@ func (w *Worker) unregisterWorker(m *astibob.Message) (err error) {
 	// Delete worker
 	w.delWorker(name)
 
+	// Fail pending requests
+	w.failRequests(name, fmt.Sprintf("worker: worker %s has disconnected", name))
+
 	// Update listenables
 	w.mo.Lock()
 	for r := range w.ols {
@@ -250,6 +448,11 @@ func (w *Worker) delWorker(name string) {
 	w.mw.Lock()
 	defer w.mw.Unlock()
 
+	// Close channel
+	if mw, ok := w.ws[name]; ok {
+		mw.ch.close()
+	}
+
 	// Update pool
 	delete(w.ws, name)
 }
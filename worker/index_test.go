@@ -0,0 +1,147 @@
+package worker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astikit"
+	"github.com/gorilla/websocket"
+)
+
+func TestConnectToIndex(t *testing.T) {
+	// Create index that disconnects workers once they've registered
+	m := &sync.Mutex{}
+	var registers int
+	u := websocket.Upgrader{}
+	s := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		c, err := u.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if _, b, err := c.ReadMessage(); err == nil && bytes.Contains(b, []byte(astibob.WorkerRegisterMessage)) {
+			m.Lock()
+			registers++
+			m.Unlock()
+		}
+		c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")) //nolint:errcheck
+	}))
+	defer s.Close()
+
+	// Create worker
+	w := New("w", Options{Reconnect: ReconnectOptions{MaxBackoff: 5 * time.Millisecond, MinBackoff: time.Millisecond}}, nil)
+	defer w.Close()
+
+	// Record index states
+	ss := make(chan astibob.IndexState, 100)
+	w.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.WorkerIndexStateMessage)}, func(m *astibob.Message) error {
+		s, err := astibob.ParseWorkerIndexStatePayload(m)
+		ss <- s
+		return err
+	})
+
+	// Connect
+	done := make(chan bool)
+	go func() {
+		w.connectToIndex("ws"+strings.TrimPrefix(s.URL, "http"), make(http.Header))
+		close(done)
+	}()
+
+	// Wait for the worker to have reconnected
+	var states []string
+	for len(states) < 5 {
+		select {
+		case s := <-ss:
+			states = append(states, s.State)
+			if s.State == astibob.IndexStateDisconnected && s.Error == "" {
+				t.Error("disconnected state should have an error")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("worker hasn't reconnected, states are %+v", states)
+		}
+	}
+	if e := []string{
+		astibob.IndexStateConnecting,
+		astibob.IndexStateConnected,
+		astibob.IndexStateDisconnected,
+		astibob.IndexStateConnecting,
+		astibob.IndexStateConnected,
+	}; !reflect.DeepEqual(e, states) {
+		t.Fatalf("expected %+v, got %+v", e, states)
+	}
+
+	// Stop
+	w.Stop()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker hasn't stopped reconnecting")
+	}
+
+	// Worker has registered on each connection
+	for i := 0; i < 100; i++ {
+		m.Lock()
+		n := registers
+		m.Unlock()
+		if n >= 2 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("worker hasn't registered again after reconnecting")
+}
+
+func TestConnectToIndexUnreachable(t *testing.T) {
+	// Create unreachable index
+	s := httptest.NewServer(http.NotFoundHandler())
+	s.Close()
+
+	// Create worker
+	w := New("w", Options{Reconnect: ReconnectOptions{MaxBackoff: 5 * time.Millisecond, MinBackoff: time.Millisecond}}, nil)
+	defer w.Close()
+
+	// Record index states
+	ss := make(chan astibob.IndexState, 100)
+	w.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.WorkerIndexStateMessage)}, func(m *astibob.Message) error {
+		s, err := astibob.ParseWorkerIndexStatePayload(m)
+		ss <- s
+		return err
+	})
+
+	// Connect
+	done := make(chan bool)
+	go func() {
+		w.connectToIndex("ws"+strings.TrimPrefix(s.URL, "http"), make(http.Header))
+		close(done)
+	}()
+	defer func() {
+		w.Stop()
+		<-done
+	}()
+
+	// Worker keeps on retrying
+	var states []string
+	for len(states) < 4 {
+		select {
+		case s := <-ss:
+			states = append(states, s.State)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("worker hasn't retried, states are %+v", states)
+		}
+	}
+	if e := []string{
+		astibob.IndexStateConnecting,
+		astibob.IndexStateDisconnected,
+		astibob.IndexStateConnecting,
+		astibob.IndexStateDisconnected,
+	}; !reflect.DeepEqual(e, states) {
+		t.Fatalf("expected %+v, got %+v", e, states)
+	}
+}
@@ -0,0 +1,59 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/asticode/go-astibob"
+)
+
+func (w *Worker) updateInspected(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
+	// Parse payload
+	var inspected bool
+	if inspected, err = astibob.ParseInspectorStatePayload(m); err != nil {
+		err = fmt.Errorf("worker: parsing message payload failed: %w", err)
+		return
+	}
+
+	// Update
+	w.setInspected(inspected)
+	return
+}
+
+func (w *Worker) setInspected(inspected bool) {
+	w.mn.Lock()
+	defer w.mn.Unlock()
+	w.in = inspected
+}
+
+func (w *Worker) inspected() bool {
+	w.mn.Lock()
+	defer w.mn.Unlock()
+	return w.in
+}
+
+// mirrorMessage sends a copy of a worker-to-worker message to the index so that inspectors can see it. Messages are
+// only mirrored when enabled in the options and while inspectors are connected.
+func (w *Worker) mirrorMessage(m *astibob.Message) {
+	// Mirroring is disabled or nobody is inspecting
+	if !w.o.Mirror || !w.inspected() {
+		return
+	}
+
+	// Create message
+	mm, err := astibob.NewInspectorMirrorMessage(*w.workerIdentifier(), astibob.NewIndexIdentifier(), m)
+	if err != nil {
+		w.l.Error(fmt.Errorf("worker: creating inspector mirror message failed: %w", err))
+		return
+	}
+
+	// Write
+	if err = w.writeToIndex(mm); err != nil {
+		w.l.Error(fmt.Errorf("worker: writing inspector mirror message failed: %w", err))
+		return
+	}
+}
@@ -3,14 +3,15 @@ package worker
 import (
 	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/asticode/go-astibob"
 )
 
 type Listenable struct {
 	Listenable astibob.Listenable
-	Runnable   string
-	Worker     string
+	Runnable   string // May contain wildcards (e.g. "mic-*")
+	Worker     string // May contain wildcards (e.g. "kitchen-*")
 }
 
 func (w *Worker) RegisterListenables(ls ...Listenable) {
@@ -53,18 +54,74 @@ func (w *Worker) RegisterListenables(ls ...Listenable) {
 	}
 }
 
+// listenableSubscriptions returns the messages the worker listens to, sorted by worker and runnable
+func (w *Worker) listenableSubscriptions() (ss []astibob.ListenableSubscription) {
+	// Lock
+	w.ml.Lock()
+	defer w.ml.Unlock()
+
+	// Loop through workers
+	for wp, rs := range w.ls {
+		// Loop through runnables
+		for rp, ns := range rs {
+			// Create subscription
+			s := astibob.ListenableSubscription{
+				Runnable: rp,
+				Worker:   wp,
+			}
+
+			// Add names
+			for n := range ns {
+				s.Names = append(s.Names, n)
+			}
+			sort.Strings(s.Names)
+
+			// Append
+			ss = append(ss, s)
+		}
+	}
+
+	// Sort
+	sort.Slice(ss, func(i, j int) bool {
+		if ss[i].Worker != ss[j].Worker {
+			return ss[i].Worker < ss[j].Worker
+		}
+		return ss[i].Runnable < ss[j].Runnable
+	})
+	return
+}
+
 func (w *Worker) sendRegisterListenables(worker string) (err error) {
 	// Lock
 	w.ml.Lock()
 	defer w.ml.Unlock()
 
-	// No listenables for this worker
-	if _, ok := w.ls[worker]; !ok {
-		return
+	// Loop through workers
+	// Listenables may have been registered with a worker pattern, therefore we merge message names of all matching
+	// workers
+	rs := make(map[string]map[string]bool)
+	for wp, ls := range w.ls {
+		// Worker doesn't match
+		if !astibob.WildcardMatch(wp, worker) {
+			continue
+		}
+
+		// Loop through runnables
+		for r, ns := range ls {
+			// Add runnable key
+			if _, ok := rs[r]; !ok {
+				rs[r] = make(map[string]bool)
+			}
+
+			// Add message name keys
+			for n := range ns {
+				rs[r][n] = true
+			}
+		}
 	}
 
 	// Loop through runnables
-	for r, ns := range w.ls[worker] {
+	for r, ns := range rs {
 		// Loop through message names
 		var p []string
 		for n := range ns {
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"fmt"
+
+	"github.com/asticode/go-astibob"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func (w *Worker) newMetrics() {
+	// Create metrics
+	w.mt = astibob.NewMetrics()
+	w.cd = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Help: "Number of messages to other workers that have been dropped before being delivered.",
+		Name: "astibob_worker_channel_dropped_messages_total",
+	}, []string{"worker"})
+	w.pf = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Help: "Number of messages that couldn't be posted to other workers.",
+		Name: "astibob_worker_post_failures_total",
+	}, []string{"worker"})
+
+	// Update dispatcher
+	w.d.SetMetrics(w.mt)
+
+	// Register collectors
+	if err := w.mt.Register(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Help: "Number of other workers connected to the index.",
+			Name: "astibob_worker_peers",
+		}, w.countPeers),
+		astibob.NewRunnableStatusCollector(w.runnableStatuses),
+		w.cd,
+		w.pf,
+	); err != nil {
+		w.l.Error(fmt.Errorf("worker: registering collectors failed: %w", err))
+	}
+}
+
+func (w *Worker) countPeers() (n float64) {
+	w.mw.Lock()
+	defer w.mw.Unlock()
+	for name := range w.ws {
+		if name != w.name {
+			n++
+		}
+	}
+	return
+}
+
+func (w *Worker) runnableStatuses() map[string]map[string]string {
+	// Lock
+	w.mr.Lock()
+	defer w.mr.Unlock()
+
+	// Loop through runnables
+	ss := make(map[string]string)
+	for n, r := range w.rs {
+		ss[n] = r.Status()
+	}
+	return map[string]map[string]string{w.name: ss}
+}
+
+func (w *Worker) registerRunnableMetrics(r astibob.Runnable) {
+	// Runnable doesn't expose metrics
+	c, ok := r.(prometheus.Collector)
+	if !ok {
+		return
+	}
+
+	// Register
+	if err := w.mt.Register(c); err != nil {
+		w.l.Error(fmt.Errorf("worker: registering metrics of runnable %s failed: %w", r.Metadata().Name, err))
+	}
+}
@@ -0,0 +1,36 @@
+package worker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestMetrics(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+	w.ws["w"] = newWorker(astibob.Worker{Name: "w"})
+	w.ws["p"] = newWorker(astibob.Worker{Name: "p"})
+	w.RegisterRunnables(Runnable{Runnable: newConfigurableRunnable("r")})
+	w.pf.WithLabelValues("p").Inc()
+
+	// Scrape
+	rw := httptest.NewRecorder()
+	w.mt.Handler().ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	s := rw.Body.String()
+
+	// Check
+	for _, l := range []string{
+		`astibob_runnable_status{runnable="r",status="stopped",worker="w"} 1`,
+		`astibob_worker_peers 1`,
+		`astibob_worker_post_failures_total{worker="p"} 1`,
+	} {
+		if !strings.Contains(s, "\n"+l+"\n") {
+			t.Errorf("metrics don't contain %s", l)
+		}
+	}
+}
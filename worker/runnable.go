@@ -5,12 +5,15 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/asticode/go-astibob"
+	"github.com/asticode/go-astikit"
 )
 
 type Runnable struct {
 	AutoStart bool
+	Restart   RestartOptions
 	Runnable  astibob.Runnable
 }
 
@@ -20,6 +23,7 @@ func (w *Worker) RegisterRunnables(rs ...Runnable) {
 		// Add to pool
 		w.mr.Lock()
 		w.rs[r.Runnable.Metadata().Name] = r.Runnable
+		w.ss[r.Runnable.Metadata().Name] = newSupervisor(r.Restart)
 		w.mr.Unlock()
 
 		// Set dispatch func
@@ -28,15 +32,28 @@ func (w *Worker) RegisterRunnables(rs ...Runnable) {
 		// Set root context
 		r.Runnable.SetRootCtx(w.w.Context())
 
+		// Set status func
+		r.Runnable.SetStatusFunc(w.statusFunc(r.Runnable.Metadata().Name))
+
 		// Set task func
 		r.Runnable.SetTaskFunc(w.w.NewTask)
 
 		// Add dispatch handlers
 		w.d.On(astibob.DispatchConditions{To: w.runnableIdentifier(r.Runnable.Metadata().Name)}, r.Runnable.OnMessage)
 
+		// Register metrics
+		w.registerRunnableMetrics(r.Runnable)
+
 		// Log
 		w.l.Infof("worker: registered runnable %s", r.Runnable.Metadata().Name)
 
+		// Load config
+		if _, ok := r.Runnable.(astibob.Configurable); ok {
+			if err := w.loadRunnableConfig(r.Runnable.Metadata().Name); err != nil {
+				w.l.Error(fmt.Errorf("worker: loading config of runnable %s failed: %w", r.Runnable.Metadata().Name, err))
+			}
+		}
+
 		// Auto start
 		if r.AutoStart {
 			// Start runnable
@@ -48,10 +65,7 @@ func (w *Worker) RegisterRunnables(rs ...Runnable) {
 }
 
 func (w *Worker) dispatchFunc(name string) astibob.DispatchFunc {
-	return func(m *astibob.Message) {
-		// Set from
-		m.From = *w.runnableIdentifier(name)
-
+	fn := w.d.Outbound(func(m *astibob.Message) error {
 		// Create messages
 		var ms []*astibob.Message
 		if m.To != nil && m.To.Types != nil {
@@ -73,6 +87,69 @@ func (w *Worker) dispatchFunc(name string) astibob.DispatchFunc {
 		for _, m := range ms {
 			w.d.Dispatch(m)
 		}
+		return nil
+	})
+	return func(m *astibob.Message) {
+		// Set from
+		// Outbound middlewares and the journal need to know who's emitting the message
+		m.From = *w.runnableIdentifier(name)
+
+		// Dispatch
+		fn(m)
+	}
+}
+
+func (w *Worker) statusFunc(name string) astibob.StatusFunc {
+	return func(status string, err error) {
+		// Create message
+		var m *astibob.Message
+		var merr error
+		to := &astibob.Identifier{Types: map[string]bool{
+			astibob.UIIdentifierType:     true,
+			astibob.WorkerIdentifierType: true,
+		}}
+		switch status {
+		case astibob.CrashedStatus:
+			// Add stack
+			c := astibob.RunnableCrashed{Error: err.Error()}
+			var e *astibob.PanicError
+			if errors.As(err, &e) {
+				c.Stack = e.Stack
+			}
+
+			// Create crashed message
+			m, merr = astibob.NewRunnableCrashedMessage(*w.runnableIdentifier(name), to, c)
+			w.l.Infof("worker: runnable %s has crashed", name)
+		case astibob.RunningStatus:
+			// Get supervisor
+			w.mr.Lock()
+			var rs astibob.RunnableStarted
+			if s, ok := w.ss[name]; ok {
+				rs.Restarts = s.restarts
+				rs.StartedAt = s.startedAt
+			}
+			w.mr.Unlock()
+
+			// Create started message
+			m, merr = astibob.NewRunnableStartedMessage(*w.runnableIdentifier(name), to, rs)
+			w.l.Infof("worker: runnable %s has started", name)
+		case astibob.StartingStatus:
+			m = astibob.NewRunnableStartingMessage(*w.runnableIdentifier(name), to)
+		case astibob.StoppedStatus:
+			m = astibob.NewRunnableStoppedMessage(*w.runnableIdentifier(name), to)
+			w.l.Infof("worker: runnable %s has stopped", name)
+		case astibob.StoppingStatus:
+			m = astibob.NewRunnableStoppingMessage(*w.runnableIdentifier(name), to)
+		default:
+			return
+		}
+
+		// Dispatch
+		if merr != nil {
+			w.l.Error(fmt.Errorf("worker: creating %s message failed: %w", status, merr))
+			return
+		}
+		w.d.Dispatch(m)
 	}
 }
 
@@ -81,21 +158,29 @@ func (w *Worker) cloneMessageForWorkers(runnable string, i *astibob.Message) (ms
 	w.mo.Lock()
 	defer w.mo.Unlock()
 
-	// Get listenables by workers
-	wls, ok := w.ols[runnable]
+	// Loop through runnables
+	// Other workers may have registered listenables with a runnable pattern
+	ws := make(map[string]bool)
+	for rp, wls := range w.ols {
+		// Runnable doesn't match
+		if !astibob.WildcardMatch(rp, runnable) {
+			continue
+		}
 
-	// No listenables for this runnable
-	if !ok {
-		return
-	}
+		// Loop through workers
+		for n, ls := range wls {
+			// No listenable for this worker
+			if _, ok := ls[i.Name]; !ok {
+				continue
+			}
 
-	// Loop through workers
-	for n, ls := range wls {
-		// No listenable for this worker
-		if _, ok := ls[i.Name]; !ok {
-			continue
+			// Add worker
+			ws[n] = true
 		}
+	}
 
+	// Loop through workers
+	for n := range ws {
 		// Append
 		m := i.Clone()
 		m.To = astibob.NewWorkerIdentifier(n)
@@ -105,6 +190,11 @@ func (w *Worker) cloneMessageForWorkers(runnable string, i *astibob.Message) (ms
 }
 
 func (w *Worker) startRunnableFromMessage(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var name string
 	if name, err = astibob.ParseRunnableStartPayload(m); err != nil {
@@ -121,35 +211,57 @@ func (w *Worker) startRunnableFromMessage(m *astibob.Message) (err error) {
 }
 
 func (w *Worker) startRunnable(name string) (err error) {
-	// Fetch runnable
+	// Reset supervisor
+	// Starting a runnable on purpose cancels any pending restart
 	w.mr.Lock()
-	r, ok := w.rs[name]
+	if s, ok := w.ss[name]; ok {
+		s.reset()
+	}
 	w.mr.Unlock()
 
+	// Run
+	return w.runRunnable(name)
+}
+
+func (w *Worker) runRunnable(name string) (err error) {
+	// Lock
+	// Checking the status and starting the runnable must be atomic
+	w.mr.Lock()
+
+	// Fetch runnable
+	r, ok := w.rs[name]
+	s := w.ss[name]
+
 	// No runnable
 	if !ok {
+		w.mr.Unlock()
 		err = fmt.Errorf("worker: no %s runnable", name)
 		return
 	}
 
+	// Runnable has already been started
+	// Its status may not have been updated yet
+	if s.running {
+		w.mr.Unlock()
+		err = fmt.Errorf("worker: runnable %s has already been started", name)
+		return
+	}
+
 	// Check status
-	if r.Status() == astibob.RunningStatus {
-		err = fmt.Errorf("worker: runnable %s is already running", name)
+	if status := r.Status(); !astibob.IsStoppedStatus(status) {
+		w.mr.Unlock()
+		err = fmt.Errorf("worker: runnable %s is %s", name, status)
 		return
 	}
 
+	// Update supervisor
+	s.running = true
+	s.startedAt = time.Now()
+	w.mr.Unlock()
+
 	// Log
 	w.l.Infof("worker: starting runnable %s", name)
 
-	// Create started message
-	m := astibob.NewRunnableStartedMessage(*w.runnableIdentifier(name), &astibob.Identifier{Types: map[string]bool{
-		astibob.UIIdentifierType:     true,
-		astibob.WorkerIdentifierType: true,
-	}})
-
-	// Dispatch
-	w.d.Dispatch(m)
-
 	// Create new task
 	t := w.w.NewTask()
 
@@ -159,32 +271,81 @@ func (w *Worker) startRunnable(name string) (err error) {
 		defer t.Done()
 
 		// Start the runnable
-		if err := r.Start(w.w.Context()); err != nil && !errors.Is(err, context.Canceled) {
+		err := r.Start(w.w.Context())
+		if err != nil && !errors.Is(err, context.Canceled) {
 			w.l.Error(fmt.Errorf("worker: starting runnable %s failed: %w", r.Metadata().Name, err))
-		}
-
-		// Create message
-		if err == nil || errors.Is(err, context.Canceled) {
-			m = astibob.NewRunnableStoppedMessage(*w.runnableIdentifier(name), &astibob.Identifier{Types: map[string]bool{
-				astibob.UIIdentifierType:     true,
-				astibob.WorkerIdentifierType: true,
-			}})
-			w.l.Infof("worker: runnable %s has stopped", name)
 		} else {
-			m = astibob.NewRunnableCrashedMessage(*w.runnableIdentifier(name), &astibob.Identifier{Types: map[string]bool{
-				astibob.UIIdentifierType:     true,
-				astibob.WorkerIdentifierType: true,
-			}})
-			w.l.Infof("worker: runnable %s has crashed", name)
+			err = nil
 		}
 
-		// Dispatch
-		w.d.Dispatch(m)
+		// Update supervisor
+		// Status messages are dispatched by the status func
+		w.mr.Lock()
+		s.running = false
+		ranFor := time.Since(s.startedAt)
+		w.mr.Unlock()
+
+		// Restart
+		w.restartRunnable(name, ranFor, err)
 	}()
 	return
 }
 
+func (w *Worker) restartRunnable(name string, ranFor time.Duration, err error) {
+	// Lock
+	w.mr.Lock()
+
+	// Get supervisor
+	s, ok := w.ss[name]
+	if !ok {
+		w.mr.Unlock()
+		return
+	}
+
+	// Get delay
+	d, ok := s.next(ranFor, err, w.w.Context().Err() != nil)
+	if !ok {
+		if s.exhausted() {
+			w.l.Infof("worker: runnable %s has reached its max retries", name)
+		}
+		w.mr.Unlock()
+		return
+	}
+
+	// Create context
+	// It's canceled when the runnable is started or stopped on purpose in the meantime
+	ctx, cancel := context.WithCancel(w.w.Context())
+	s.cancel = cancel
+	w.mr.Unlock()
+
+	// Make sure to release the context
+	defer cancel()
+
+	// Log
+	w.l.Infof("worker: restarting runnable %s in %s", name, d)
+
+	// Sleep
+	if astikit.Sleep(ctx, d) != nil {
+		return
+	}
+
+	// Update restarts
+	w.mr.Lock()
+	s.restarts++
+	w.mr.Unlock()
+
+	// Run
+	if err := w.runRunnable(name); err != nil {
+		w.l.Error(fmt.Errorf("worker: restarting runnable %s failed: %w", name, err))
+	}
+}
+
 func (w *Worker) stopRunnableFromMessage(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var name string
 	if name, err = astibob.ParseRunnableStopPayload(m); err != nil {
@@ -212,9 +373,14 @@ func (w *Worker) stopRunnable(name string) (err error) {
 		return
 	}
 
+	// Stopping a runnable on purpose cancels any pending restart
+	w.mr.Lock()
+	w.ss[name].stop()
+	w.mr.Unlock()
+
 	// Check status
-	if r.Status() == astibob.StoppedStatus {
-		err = fmt.Errorf("worker: runnable %s is already stopped", name)
+	if status := r.Status(); status != astibob.RunningStatus && status != astibob.StartingStatus {
+		err = fmt.Errorf("worker: runnable %s is %s", name, status)
 		return
 	}
 
@@ -226,28 +392,38 @@ func (w *Worker) stopRunnable(name string) (err error) {
 	return
 }
 
+// OnDone is called with a failure if the runnable hasn't replied within that long, unless MessageOptions.Timeout or
+// Options.RequestTimeout are set
+const defaultRequestTimeout = time.Minute
+
 type MessageOptions struct {
-	OnDone   OnDone
+	OnDone   OnDone // Ignored by Request
 	Message  Message
 	Runnable string
-	Worker   string
+	// Time after which OnDone is called with a failure. Defaults to Options.RequestTimeout. Ignored by Request, which
+	// relies on its context instead.
+	Timeout time.Duration
+	Worker  string
 }
 
 type OnDone func(success bool) error
 
 type Message struct {
+	Codec   astibob.Codec // Defaults to JSON
 	Name    string
 	Payload interface{}
 }
 
-func (w *Worker) SendMessage(o MessageOptions) (err error) {
-	// Create message
-	m := astibob.NewMessage()
+type request struct {
+	fn       func(from astibob.Identifier, d astibob.RunnableDone) error
+	runnable string
+	t        *time.Timer // Nil if the request doesn't time out
+	worker   string
+}
 
-	// Default worker
-	if o.Worker == "" {
-		o.Worker = w.name
-	}
+func (w *Worker) newRunnableMessage(o MessageOptions) (m *astibob.Message, err error) {
+	// Create message
+	m = astibob.NewMessage()
 
 	// Set basic info
 	m.From = *w.workerIdentifier()
@@ -256,31 +432,262 @@ func (w *Worker) SendMessage(o MessageOptions) (err error) {
 
 	// Marshal payload
 	if o.Message.Payload != nil {
-		if m.Payload, err = json.Marshal(o.Message.Payload); err != nil {
+		// Get codec
+		c := o.Message.Codec
+		if c == nil {
+			c = astibob.JSONCodec
+		}
+
+		// Marshal
+		if err = m.MarshalPayloadWithCodec(c, o.Message.Payload); err != nil {
 			err = fmt.Errorf("worker: marshaling payload failed: %w", err)
 			return
 		}
 	}
+	return
+}
+
+func (w *Worker) SendMessage(o MessageOptions) (err error) {
+	// Default worker
+	if o.Worker == "" {
+		o.Worker = w.name
+	}
+
+	// Create message
+	var m *astibob.Message
+	if m, err = w.newRunnableMessage(o); err != nil {
+		err = fmt.Errorf("worker: creating message failed: %w", err)
+		return
+	}
 
 	// On done
 	if o.OnDone != nil {
-		// Set id
-		w.mi.Lock()
-		w.id++
-		m.ID = w.id
-		w.mi.Unlock()
+		m.ID = w.addRequest(o.Worker, o.Runnable, w.requestTimeout(o), func(_ astibob.Identifier, d astibob.RunnableDone) error {
+			return o.OnDone(d.Success)
+		})
+	}
+
+	// Dispatch
+	w.d.Dispatch(m)
+	return
+}
 
-		// Add callback
-		w.md.Lock()
-		w.ds[m.ID] = o.OnDone
-		w.md.Unlock()
+// Request sends a message to a runnable and waits for its reply.
+// The reply message has the same name as the request, comes from the runnable and contains the payload the runnable
+// has replied with, encoded with the codec of the request. If the runnable has replied with an error, it is returned
+// as an *astibob.Error.
+func (w *Worker) Request(ctx context.Context, o MessageOptions) (r *astibob.Message, err error) {
+	// Default worker
+	if o.Worker == "" {
+		o.Worker = w.name
+	}
+
+	// Check worker
+	if o.Worker != w.name {
+		w.mw.Lock()
+		_, ok := w.ws[o.Worker]
+		w.mw.Unlock()
+		if !ok {
+			err = fmt.Errorf("worker: worker %s doesn't exist", o.Worker)
+			return
+		}
 	}
 
+	// Create message
+	var m *astibob.Message
+	if m, err = w.newRunnableMessage(o); err != nil {
+		err = fmt.Errorf("worker: creating message failed: %w", err)
+		return
+	}
+
+	// Add request
+	type reply struct {
+		d    astibob.RunnableDone
+		from astibob.Identifier
+	}
+	c := make(chan reply, 1)
+	m.ID = w.addRequest(o.Worker, o.Runnable, 0, func(from astibob.Identifier, d astibob.RunnableDone) error {
+		c <- reply{
+			d:    d,
+			from: from,
+		}
+		return nil
+	})
+
+	// Make sure to clean up the request if we stop waiting for it
+	defer w.delRequest(m.ID)
+
 	// Dispatch
 	w.d.Dispatch(m)
+
+	// Wait for reply
+	var rp reply
+	select {
+	case <-ctx.Done():
+		err = fmt.Errorf("worker: waiting for reply to %s failed: %w", m.Name, ctx.Err())
+		return
+	case rp = <-c:
+	}
+
+	// Runnable has replied with an error
+	if !rp.d.Success {
+		if rp.d.Error != nil {
+			err = rp.d.Error
+		} else {
+			err = fmt.Errorf("worker: request %s failed", m.Name)
+		}
+		return
+	}
+
+	// Create reply
+	r = astibob.NewMessage()
+	r.From = rp.from
+	r.Name = m.Name
+	r.To = w.workerIdentifier()
+
+	// Marshal reply
+	// Runnables reply in JSON, which is transcoded to the codec the request has been sent with so that the reply can
+	// be unmarshaled the same way
+	if len(rp.d.Reply) > 0 {
+		// Get codec
+		c := o.Message.Codec
+		if c == nil {
+			c = astibob.JSONCodec
+		}
+
+		// Get value
+		var v interface{} = rp.d.Reply
+		if c.Name() != astibob.JSONCodecName {
+			if err = json.Unmarshal(rp.d.Reply, &v); err != nil {
+				err = fmt.Errorf("worker: unmarshaling reply to %s failed: %w", m.Name, err)
+				return
+			}
+		}
+
+		// Marshal
+		if err = r.MarshalPayloadWithCodec(c, v); err != nil {
+			err = fmt.Errorf("worker: marshaling reply to %s failed: %w", m.Name, err)
+			return
+		}
+	}
+	return
+}
+
+func (w *Worker) requestTimeout(o MessageOptions) time.Duration {
+	if o.Timeout > 0 {
+		return o.Timeout
+	}
+	if w.o.RequestTimeout > 0 {
+		return w.o.RequestTimeout
+	}
+	return defaultRequestTimeout
+}
+
+// addRequest adds a pending request. If timeout is > 0, the request fails once it has expired.
+func (w *Worker) addRequest(worker, runnable string, timeout time.Duration, fn func(from astibob.Identifier, d astibob.RunnableDone) error) (id int) {
+	// Get id
+	w.mi.Lock()
+	w.id++
+	id = w.id
+	w.mi.Unlock()
+
+	// Create request
+	r := request{
+		fn:       fn,
+		runnable: runnable,
+		worker:   worker,
+	}
+
+	// Lock
+	w.md.Lock()
+	defer w.md.Unlock()
+
+	// Time out
+	// The timer can't fire before the request is added since it needs the lock
+	if timeout > 0 {
+		r.t = time.AfterFunc(timeout, func() { w.timeoutRequest(id, timeout) })
+	}
+
+	// Add request
+	w.ds[id] = r
+	return
+}
+
+func (w *Worker) timeoutRequest(id int, timeout time.Duration) {
+	// Get request
+	r, ok := w.delRequest(id)
+
+	// Request is already done
+	if !ok {
+		return
+	}
+
+	// On done
+	if err := r.fn(*astibob.NewWorkerIdentifier(r.worker), astibob.RunnableDone{
+		Error: &astibob.Error{Message: fmt.Sprintf("worker: request timed out after %s", timeout)},
+		ID:    id,
+	}); err != nil {
+		w.l.Error(fmt.Errorf("worker: on done failed: %w", err))
+	}
+}
+
+func (w *Worker) delRequest(id int) (r request, ok bool) {
+	// Lock
+	w.md.Lock()
+	defer w.md.Unlock()
+
+	// Get request
+	if r, ok = w.ds[id]; !ok {
+		return
+	}
+
+	// Delete request
+	delete(w.ds, id)
+
+	// Stop timer
+	if r.t != nil {
+		r.t.Stop()
+	}
 	return
 }
 
+// failRequests fails pending requests sent to a specific worker or to all workers if the worker is empty
+func (w *Worker) failRequests(worker string, reason string) {
+	// Get requests
+	w.md.Lock()
+	var rs []request
+	var ids []int
+	for id, r := range w.ds {
+		// Invalid worker
+		if worker != "" && r.worker != worker {
+			continue
+		}
+
+		// Delete request
+		delete(w.ds, id)
+
+		// Stop timer
+		if r.t != nil {
+			r.t.Stop()
+		}
+
+		// Append
+		ids = append(ids, id)
+		rs = append(rs, r)
+	}
+	w.md.Unlock()
+
+	// Loop through requests
+	for idx, r := range rs {
+		if err := r.fn(*astibob.NewWorkerIdentifier(r.worker), astibob.RunnableDone{
+			Error: &astibob.Error{Message: reason},
+			ID:    ids[idx],
+		}); err != nil {
+			w.l.Error(fmt.Errorf("worker: on done failed: %w", err))
+		}
+	}
+}
+
 func (w *Worker) doneMessage(m *astibob.Message) (err error) {
 	// Parse payload
 	var d astibob.RunnableDone
@@ -289,18 +696,24 @@ func (w *Worker) doneMessage(m *astibob.Message) (err error) {
 		return
 	}
 
-	// Get callback
+	// Only the runnable the request has been sent to can complete it
 	w.md.Lock()
-	c, ok := w.ds[d.ID]
+	r, ok := w.ds[d.ID]
 	w.md.Unlock()
+	if ok && (m.From.Type != astibob.RunnableIdentifierType || m.From.WorkerName() != r.worker ||
+		m.From.RunnableName() != r.runnable) {
+		err = fmt.Errorf("worker: request %d has been sent to runnable %s of worker %s, not to runnable %s of worker %s",
+			d.ID, r.runnable, r.worker, m.From.RunnableName(), m.From.WorkerName())
+		return
+	}
 
-	// No callback
-	if !ok {
+	// Get request
+	if r, ok = w.delRequest(d.ID); !ok {
 		return
 	}
 
 	// On done
-	if err = c(d.Success); err != nil {
+	if err = r.fn(m.From, d); err != nil {
 		err = fmt.Errorf("worker: on done failed: %w", err)
 		return
 	}
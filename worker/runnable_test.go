@@ -0,0 +1,247 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	// Create worker
+	w := New("w", Options{RequestTimeout: 10 * time.Millisecond}, nil)
+	defer w.Close()
+
+	// Timeouts
+	for _, v := range []struct {
+		expected time.Duration
+		o        MessageOptions
+	}{
+		{expected: 10 * time.Millisecond},
+		{expected: time.Second, o: MessageOptions{Timeout: time.Second}},
+	} {
+		if d := w.requestTimeout(v.o); d != v.expected {
+			t.Fatalf("expected %s, got %s", v.expected, d)
+		}
+	}
+	w2 := New("w2", Options{}, nil)
+	defer w2.Close()
+	if d := w2.requestTimeout(MessageOptions{}); d != defaultRequestTimeout {
+		t.Fatalf("expected %s, got %s", defaultRequestTimeout, d)
+	}
+
+	// Runnable never replies
+	c := make(chan bool, 1)
+	if err := w.SendMessage(MessageOptions{
+		Message:  Message{Name: "test.message"},
+		OnDone:   func(success bool) error { c <- success; return nil },
+		Runnable: "r",
+	}); err != nil {
+		t.Fatalf("sending message failed: %v", err)
+	}
+	select {
+	case success := <-c:
+		if success {
+			t.Fatal("timed out request shouldn't succeed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("request hasn't timed out")
+	}
+	w.md.Lock()
+	l := len(w.ds)
+	w.md.Unlock()
+	if l != 0 {
+		t.Fatalf("expected no pending request, got %d", l)
+	}
+
+	// Runnable replies before the timeout
+	called := make(chan bool, 2)
+	id := w.addRequest("w", "r", 10*time.Millisecond, func(from astibob.Identifier, d astibob.RunnableDone) error {
+		called <- d.Success
+		return nil
+	})
+	m := astibob.NewMessage()
+	m.From = *astibob.NewRunnableIdentifier("r", "w")
+	if err := m.MarshalPayload(astibob.RunnableDone{ID: id, Success: true}); err != nil {
+		t.Fatalf("marshaling payload failed: %v", err)
+	}
+	if err := w.doneMessage(m); err != nil {
+		t.Fatalf("handling done message failed: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(called) != 1 || !<-called {
+		t.Fatal("on done should only be called once with a success")
+	}
+}
+
+func TestRunRunnable(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+
+	// Listen to status messages
+	c := make(chan string, 10)
+	w.d.On(astibob.DispatchConditions{Names: map[string]bool{
+		astibob.RunnableCrashedMessage:  true,
+		astibob.RunnableStartedMessage:  true,
+		astibob.RunnableStartingMessage: true,
+		astibob.RunnableStoppedMessage:  true,
+		astibob.RunnableStoppingMessage: true,
+	}}, func(m *astibob.Message) error {
+		c <- m.Name
+		return nil
+	})
+	expect := func(names ...string) {
+		t.Helper()
+		for _, n := range names {
+			select {
+			case m := <-c:
+				if m != n {
+					t.Fatalf("expected %s, got %s", n, m)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s hasn't been dispatched", n)
+			}
+		}
+	}
+
+	// Register runnable
+	var initErr error
+	initDone := make(chan bool)
+	w.RegisterRunnables(Runnable{Runnable: astibob.NewBaseRunnable(astibob.BaseRunnableOptions{
+		Metadata: astibob.Metadata{Name: "r"},
+		OnInit: func(ctx context.Context) error {
+			<-initDone
+			return initErr
+		},
+		OnStart: func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		},
+	})})
+
+	// Concurrent starts
+	errs := make(chan error, 2)
+	for idx := 0; idx < 2; idx++ {
+		go func() { errs <- w.startRunnable("r") }()
+	}
+	if err1, err2 := <-errs, <-errs; (err1 == nil) == (err2 == nil) {
+		t.Fatalf("expected exactly one start to fail, got %v and %v", err1, err2)
+	}
+
+	// Started is only dispatched once the runnable has been initialized
+	expect(astibob.RunnableStartingMessage)
+	select {
+	case m := <-c:
+		t.Fatalf("expected no message before init is done, got %s", m)
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(initDone)
+	expect(astibob.RunnableStartedMessage)
+
+	// Stop
+	if err := w.stopRunnable("r"); err != nil {
+		t.Fatalf("stopping runnable failed: %v", err)
+	}
+	expect(astibob.RunnableStoppingMessage, astibob.RunnableStoppedMessage)
+
+	// Init fails
+	initErr = errors.New("test")
+	if err := w.startRunnable("r"); err != nil {
+		t.Fatalf("starting runnable failed: %v", err)
+	}
+	expect(astibob.RunnableStartingMessage, astibob.RunnableCrashedMessage)
+}
+
+func TestDoneMessage(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+
+	// Add request
+	called := make(chan bool, 1)
+	id := w.addRequest("p", "r", 0, func(from astibob.Identifier, d astibob.RunnableDone) error {
+		called <- d.Success
+		return nil
+	})
+
+	// Only the runnable the request has been sent to can complete it
+	for _, from := range []*astibob.Identifier{
+		astibob.NewRunnableIdentifier("other", "p"),
+		astibob.NewRunnableIdentifier("r", "other"),
+		astibob.NewWorkerIdentifier("p"),
+		astibob.NewIndexIdentifier(),
+		astibob.NewRunnableIdentifier("r", "p"),
+	} {
+		m, err := astibob.NewRunnableDoneMessage(nil, astibob.RunnableDone{ID: id, Success: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.From = *from
+		err = w.doneMessage(m)
+		if legit := from.WorkerName() == "p" && from.RunnableName() == "r" && from.Type == astibob.RunnableIdentifierType; legit {
+			if err != nil {
+				t.Fatalf("handling done message failed: %v", err)
+			}
+		} else if err == nil {
+			t.Fatalf("done message from %+v should be rejected", from)
+		}
+	}
+	select {
+	case success := <-called:
+		if !success {
+			t.Fatal("request should succeed")
+		}
+	default:
+		t.Fatal("on done hasn't been called")
+	}
+}
+
+func TestRequest(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+
+	// Register runnable
+	w.RegisterRunnables(Runnable{Runnable: astibob.NewBaseRunnable(astibob.BaseRunnableOptions{
+		Metadata: astibob.Metadata{Name: "r"},
+		OnRequest: func(m *astibob.Message) (interface{}, error) {
+			var s string
+			if err := m.UnmarshalPayload(&s); err != nil {
+				return nil, err
+			}
+			return map[string]string{"reply": s}, nil
+		},
+	})})
+
+	// Loop through codecs
+	for _, c := range []astibob.Codec{astibob.JSONCodec, astibob.CBORCodec} {
+		// Request
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		r, err := w.Request(ctx, MessageOptions{
+			Message:  Message{Codec: c, Name: "r.request", Payload: c.Name()},
+			Runnable: "r",
+		})
+		cancel()
+		if err != nil {
+			t.Fatalf("%s: request failed: %v", c.Name(), err)
+		}
+
+		// Reply has been sent by the runnable with the codec of the request
+		if r.From.WorkerName() != "w" || r.From.RunnableName() != "r" {
+			t.Fatalf("%s: expected reply from runnable r, got %+v", c.Name(), r.From)
+		}
+		if e := map[string]string{astibob.CBORCodecName: astibob.CBORCodecName}[c.Name()]; r.PayloadCodec != e {
+			t.Fatalf("%s: expected payload codec %q, got %q", c.Name(), e, r.PayloadCodec)
+		}
+		var v map[string]string
+		if err = r.UnmarshalPayload(&v); err != nil {
+			t.Fatalf("%s: unmarshaling reply failed: %v", c.Name(), err)
+		}
+		if v["reply"] != c.Name() {
+			t.Fatalf("%s: expected reply %s, got %+v", c.Name(), c.Name(), v)
+		}
+	}
+}
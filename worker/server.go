@@ -1,12 +1,15 @@
 package worker
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 
 	"github.com/asticode/go-astibob"
 	"github.com/asticode/go-astikit"
+	"github.com/asticode/go-astiws"
+	"github.com/gorilla/websocket"
 	"github.com/julienschmidt/httprouter"
 )
 
@@ -17,10 +20,18 @@ func (w *Worker) Serve() {
 	// Add routes
 	r.GET("/api/ok", w.ok)
 	r.POST("/api/messages", w.handleWorkerMessage)
+	r.GET("/websockets/worker", w.handleWorkerWebsocket)
+	r.Handler(http.MethodGet, "/metrics", w.mt.Handler())
 
 	// Loop through runnables
 	w.mr.Lock()
 	for _, rn := range w.rs {
+		// Add config routes
+		if _, ok := rn.(astibob.Configurable); ok {
+			r.GET(fmt.Sprintf("/runnables/%s/config", rn.Metadata().Name), w.getRunnableConfig(rn.Metadata().Name))
+			r.PATCH(fmt.Sprintf("/runnables/%s/config", rn.Metadata().Name), w.patchRunnableConfig(rn.Metadata().Name))
+		}
+
 		// Not operatable
 		o, ok := rn.(astibob.Operatable)
 		if !ok {
@@ -45,22 +56,46 @@ func (w *Worker) Serve() {
 	h := astikit.ChainHTTPMiddlewaresWithPrefix(r, []string{"/api/"}, astikit.HTTPMiddlewareContentType("application/json"))
 
 	// Serve
-	astikit.ServeHTTP(w.w, astikit.ServeHTTPOptions{
-		Addr:    w.o.Server.Addr,
-		Handler: h,
-	})
+	astibob.ServeHTTP(w.w, w.o.Server, h)
 }
 
 func (w *Worker) ok(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {}
 
 func (w *Worker) handleWorkerMessage(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Read body
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		astibob.WriteHTTPError(w.l, rw, http.StatusInternalServerError, fmt.Errorf("worker: reading body failed: %w", err))
+		return
+	}
+
+	// Verify signature
+	var name string
+	if name, err = w.sv.Verify(r, b, w.workerKey); err != nil {
+		astibob.WriteHTTPError(w.l, rw, http.StatusUnauthorized, fmt.Errorf("worker: verifying signature failed: %w", err))
+		return
+	}
+
 	// Unmarshal
+	// Peers send messages with the codec they've negotiated with this worker, which we can detect from the content
 	var m astibob.Message
-	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+	if err = astibob.UnmarshalMessage(b, &m); err != nil {
 		astibob.WriteHTTPError(w.l, rw, http.StatusInternalServerError, fmt.Errorf("worker: unmarshaling failed: %w", err))
 		return
 	}
 
+	// Invalid message
+	if err = checkWorkerMessage(name, &m); err != nil {
+		astibob.WriteHTTPError(w.l, rw, http.StatusForbidden, err)
+		return
+	}
+
+	// Message has already been received
+	if !w.receivedMessage(name, &m) {
+		w.l.Debugf("worker: ignoring duplicate worker message %s", m.Name)
+		return
+	}
+
 	// Log
 	w.l.Debugf("worker: handling worker message %s", m.Name)
 
@@ -68,6 +103,92 @@ func (w *Worker) handleWorkerMessage(rw http.ResponseWriter, r *http.Request, p
 	w.d.Dispatch(&m)
 }
 
+func (w *Worker) handleWorkerWebsocket(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	// Verify signature
+	name, err := w.sv.Verify(r, nil, w.workerKey)
+	if err != nil {
+		astibob.WriteHTTPError(w.l, rw, http.StatusUnauthorized, fmt.Errorf("worker: verifying signature failed: %w", err))
+		return
+	}
+
+	// Serve
+	if err = w.wc.ServeHTTP(w.ww, rw, r, func(c *astiws.Client) error {
+		// Set message handler
+		c.SetMessageHandler(w.handleWorkerMessages(name))
+		return nil
+	}); err != nil {
+		var e *websocket.CloseError
+		if ok := errors.As(err, &e); !ok || e.Code != websocket.CloseNormalClosure {
+			w.l.Error(fmt.Errorf("worker: handling worker websocket failed: %w", err))
+		}
+		return
+	}
+}
+
+func (w *Worker) handleWorkerMessages(name string) astiws.MessageHandler {
+	return func(p []byte) (err error) {
+		// Unmarshal
+		var ms []*astibob.Message
+		if ms, err = astibob.UnmarshalMessages(p); err != nil {
+			err = fmt.Errorf("worker: unmarshaling failed: %w", err)
+			return
+		}
+
+		// Loop through messages
+		for _, m := range ms {
+			// Invalid message
+			if err = checkWorkerMessage(name, m); err != nil {
+				return
+			}
+		}
+
+		// Loop through messages
+		for _, m := range ms {
+			// Message has already been received
+			if !w.receivedMessage(name, m) {
+				w.l.Debugf("worker: ignoring duplicate worker message %s", m.Name)
+				continue
+			}
+
+			// Log
+			w.l.Debugf("worker: handling worker message %s", m.Name)
+
+			// Dispatch
+			w.d.Dispatch(m)
+		}
+		return
+	}
+}
+
+// Names of messages workers only accept from the index. Peers sending them are rejected since they would otherwise
+// be able to rewrite the workers list, replace the index key or control runnables without being authorized.
+var indexOnlyMessageNames = []string{
+	"index.*",
+	"inspector.*",
+	astibob.RunnableConfigUpdateMessage,
+	astibob.RunnableStartMessage,
+	astibob.RunnableStopMessage,
+	"ui.*",
+	"worker.*",
+}
+
+// checkWorkerMessage makes sure a worker doesn't send messages on behalf of someone else or messages only the index
+// can send
+func checkWorkerMessage(name string, m *astibob.Message) error {
+	// Invalid from
+	if fw := m.From.WorkerName(); fw != name {
+		return fmt.Errorf("worker: message %s from %s has been sent by worker %s", m.Name, fw, name)
+	}
+
+	// Index message
+	for _, p := range indexOnlyMessageNames {
+		if astibob.WildcardMatch(p, m.Name) {
+			return fmt.Errorf("worker: message %s can only be sent by the index, not by worker %s", m.Name, name)
+		}
+	}
+	return nil
+}
+
 func (w *Worker) template(c []byte) httprouter.Handle {
 	return func(rw http.ResponseWriter, req *http.Request, p httprouter.Params) {
 		// Write
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asticode/go-astibob"
+)
+
+func newTestMessage(from astibob.Identifier, to *astibob.Identifier, name string, payload interface{}) (m *astibob.Message, err error) {
+	m = astibob.NewMessage()
+	m.From = from
+	m.Name = name
+	m.To = to
+	err = m.MarshalPayload(payload)
+	return
+}
+
+func TestHandleWorkerMessage(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+	key := []byte("peer key")
+	w.ws["p"] = newWorker(astibob.Worker{Key: key, Name: "p"})
+
+	// Loop through cases
+	for _, v := range []struct {
+		code int
+		m    *astibob.Message
+		name string
+	}{
+		{code: http.StatusOK, m: &astibob.Message{From: *astibob.NewRunnableIdentifier("r", "p"), Name: "r.event"}, name: "runnable message"},
+		{code: http.StatusOK, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.ListenablesRegisterMessage}, name: "listenables"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewIndexIdentifier(), Name: "r.event"}, name: "on behalf of the index"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.WorkerWelcomeMessage}, name: "welcome"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.WorkerRegisteredMessage}, name: "registered"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.WorkerDisconnectedMessage}, name: "disconnected"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.InspectorStateMessage}, name: "inspector"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.UIMessageNamesAddMessage}, name: "ui"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.RunnableStartMessage}, name: "start"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.RunnableStopMessage}, name: "stop"},
+		{code: http.StatusForbidden, m: &astibob.Message{From: *astibob.NewWorkerIdentifier("p"), Name: astibob.RunnableConfigUpdateMessage}, name: "config update"},
+	} {
+		// Create request
+		b, err := astibob.JSONCodec.Marshal(v.m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/messages", bytes.NewReader(b))
+		if err = astibob.SignRequest(req, "p", key, b); err != nil {
+			t.Fatal(err)
+		}
+
+		// Handle
+		rw := httptest.NewRecorder()
+		w.handleWorkerMessage(rw, req, nil)
+		if rw.Code != v.code {
+			t.Errorf("%s: expected %d, got %d", v.name, v.code, rw.Code)
+		}
+	}
+}
+
+func TestIndexMessages(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+	w.ik = []byte("index key")
+	w.ws["p"] = newWorker(astibob.Worker{Key: []byte("peer key"), Name: "p"})
+	r := newConfigurableRunnable("r")
+	w.RegisterRunnables(Runnable{Runnable: r})
+
+	// Loop through messages forged by a peer
+	from := *astibob.NewWorkerIdentifier("p")
+	to := astibob.NewWorkerIdentifier("w")
+	for _, v := range []struct {
+		h  astibob.MessageHandler
+		fn func() (*astibob.Message, error)
+	}{
+		{h: w.finishRegistration, fn: func() (*astibob.Message, error) {
+			return astibob.NewWorkerWelcomeMessage(from, to, astibob.WelcomeWorker{Codec: astibob.JSONCodecName, IndexKey: []byte("forged")})
+		}},
+		{h: w.registerWorker, fn: func() (*astibob.Message, error) {
+			return astibob.NewWorkerRegisteredMessage(from, to, astibob.Worker{Key: []byte("forged"), Name: "p"})
+		}},
+		{h: w.unregisterWorker, fn: func() (*astibob.Message, error) { return astibob.NewWorkerDisconnectedMessage(from, to, "p") }},
+		{h: w.updateInspected, fn: func() (*astibob.Message, error) { return astibob.NewInspectorStateMessage(from, to, true) }},
+		{h: w.addUIMessageNames, fn: func() (*astibob.Message, error) {
+			return astibob.NewUIMessageNamesAddMessage(from, to, []string{"forged"})
+		}},
+		{h: w.startRunnableFromMessage, fn: func() (*astibob.Message, error) {
+			return newTestMessage(from, to, astibob.RunnableStartMessage, "r")
+		}},
+		{h: w.stopRunnableFromMessage, fn: func() (*astibob.Message, error) {
+			return newTestMessage(from, to, astibob.RunnableStopMessage, "r")
+		}},
+		{h: w.updateRunnableConfigFromMessage, fn: func() (*astibob.Message, error) {
+			return astibob.NewRunnableConfigUpdateMessage(from, to, astibob.RunnableConfigUpdate{Config: astibob.Config{"value": "forged"}, Runnable: "r"})
+		}},
+	} {
+		// Create message
+		m, err := v.fn()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Handle
+		if err = v.h(m); err == nil {
+			t.Errorf("%s: forged message should be rejected", m.Name)
+		}
+	}
+
+	// Nothing has changed
+	if string(w.ik) != "index key" {
+		t.Error("index key has been replaced")
+	}
+	if p, ok := w.ws["p"]; !ok || string(p.key) != "peer key" {
+		t.Error("peer has been replaced or removed")
+	}
+	if w.inspected() || w.us["forged"] {
+		t.Error("index state has been updated")
+	}
+	if r.Status() != astibob.StoppedStatus || r.c["value"] != "default" {
+		t.Error("runnable has been updated")
+	}
+}
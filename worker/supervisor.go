@@ -0,0 +1,108 @@
+package worker
+
+import (
+	"context"
+	"time"
+)
+
+// Restart policies
+const (
+	RestartPolicyAlways    = "always"
+	RestartPolicyNever     = "never"
+	RestartPolicyOnFailure = "on-failure"
+)
+
+// RestartOptions represents the way a runnable is restarted once it has stopped on its own. Runnables stopped on
+// purpose are never restarted.
+type RestartOptions struct {
+	MaxBackoff time.Duration
+	MaxRetries int // 0 means unlimited
+	MinBackoff time.Duration
+	Policy     string // Defaults to never
+	// Once the runnable has run for that long, retries and backoff are reset. 0 means never.
+	ResetWindow time.Duration
+}
+
+// supervisor keeps track of a runnable restarts. It's locked by the worker's runnables mutex.
+type supervisor struct {
+	b         *backoff
+	cancel    context.CancelFunc // Cancels the pending restart
+	lastError string
+	o         RestartOptions
+	restarts  int  // Total number of restarts
+	retries   int  // Number of restarts since the last reset
+	running   bool // Whether the runnable has been started and its Start method hasn't returned yet
+	startedAt time.Time
+	stopped   bool
+}
+
+func newSupervisor(o RestartOptions) *supervisor {
+	return &supervisor{
+		b: newBackoff(o.MinBackoff, o.MaxBackoff),
+		o: o,
+	}
+}
+
+// reset is called when the runnable is started on purpose
+func (s *supervisor) reset() {
+	s.cancelRestart()
+	s.b.reset()
+	s.retries = 0
+	s.stopped = false
+}
+
+// stop is called when the runnable is stopped on purpose
+func (s *supervisor) stop() {
+	s.cancelRestart()
+	s.stopped = true
+}
+
+func (s *supervisor) cancelRestart() {
+	if s.cancel != nil {
+		s.cancel()
+		s.cancel = nil
+	}
+}
+
+// next records the runnable has stopped and returns the delay before restarting it, if it needs to be restarted
+func (s *supervisor) next(ranFor time.Duration, err error, closing bool) (d time.Duration, ok bool) {
+	// Update last error
+	if err != nil {
+		s.lastError = err.Error()
+	}
+
+	// Runnable has been stopped on purpose or worker is closing
+	if s.stopped || closing {
+		return
+	}
+
+	// Check policy
+	switch s.o.Policy {
+	case RestartPolicyAlways:
+	case RestartPolicyOnFailure:
+		if err == nil {
+			return
+		}
+	default:
+		return
+	}
+
+	// Reset retries
+	if s.o.ResetWindow > 0 && ranFor >= s.o.ResetWindow {
+		s.b.reset()
+		s.retries = 0
+	}
+
+	// Max retries has been reached
+	if s.exhausted() {
+		return
+	}
+
+	// Update retries
+	s.retries++
+	return s.b.next(), true
+}
+
+func (s *supervisor) exhausted() bool {
+	return s.o.MaxRetries > 0 && s.retries >= s.o.MaxRetries
+}
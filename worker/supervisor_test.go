@@ -0,0 +1,125 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/asticode/go-astibob"
+)
+
+func TestSupervisor(t *testing.T) {
+	errTest := errors.New("test")
+	for _, v := range []struct {
+		closing  bool
+		err      error
+		expected bool
+		name     string
+		o        RestartOptions
+		stopped  bool
+	}{
+		{name: "never"},
+		{name: "unknown policy", o: RestartOptions{Policy: "unknown"}, err: errTest},
+		{expected: true, name: "always without error", o: RestartOptions{Policy: RestartPolicyAlways}},
+		{expected: true, name: "always with error", o: RestartOptions{Policy: RestartPolicyAlways}, err: errTest},
+		{name: "on failure without error", o: RestartOptions{Policy: RestartPolicyOnFailure}},
+		{expected: true, name: "on failure with error", o: RestartOptions{Policy: RestartPolicyOnFailure}, err: errTest},
+		{name: "stopped on purpose", o: RestartOptions{Policy: RestartPolicyAlways}, stopped: true},
+		{name: "closing", o: RestartOptions{Policy: RestartPolicyAlways}, closing: true},
+	} {
+		s := newSupervisor(v.o)
+		if v.stopped {
+			s.stop()
+		}
+		if _, ok := s.next(0, v.err, v.closing); ok != v.expected {
+			t.Errorf("%s: expected %v, got %v", v.name, v.expected, ok)
+		}
+		if v.err != nil && s.lastError != v.err.Error() {
+			t.Errorf("%s: expected last error %s, got %s", v.name, v.err, s.lastError)
+		}
+	}
+
+	// Max retries
+	s := newSupervisor(RestartOptions{MaxRetries: 2, Policy: RestartPolicyAlways})
+	for idx, expected := range []bool{true, true, false} {
+		if _, ok := s.next(0, nil, false); ok != expected {
+			t.Fatalf("retry #%d: expected %v, got %v", idx+1, expected, ok)
+		}
+	}
+	if !s.exhausted() {
+		t.Fatal("supervisor should be exhausted")
+	}
+
+	// Starting on purpose resets retries
+	s.reset()
+	if _, ok := s.next(0, nil, false); !ok {
+		t.Fatal("supervisor should restart after a reset")
+	}
+
+	// Reset window
+	s = newSupervisor(RestartOptions{MaxBackoff: 4 * time.Second, MaxRetries: 1, MinBackoff: time.Second, Policy: RestartPolicyAlways, ResetWindow: time.Minute})
+	if _, ok := s.next(time.Second, nil, false); !ok {
+		t.Fatal("supervisor should restart")
+	}
+	if _, ok := s.next(time.Second, nil, false); ok {
+		t.Fatal("supervisor shouldn't restart before the reset window")
+	}
+	d, ok := s.next(time.Minute, nil, false)
+	if !ok {
+		t.Fatal("supervisor should restart after the reset window")
+	}
+	if d > time.Second {
+		t.Fatalf("expected backoff to be reset, got %s", d)
+	}
+}
+
+func TestRestartRunnable(t *testing.T) {
+	// Create worker
+	w := New("w", Options{}, nil)
+	defer w.Close()
+
+	// Register runnable that keeps crashing
+	starts := make(chan bool, 10)
+	w.RegisterRunnables(Runnable{
+		Restart: RestartOptions{MaxBackoff: 2 * time.Millisecond, MaxRetries: 2, MinBackoff: time.Millisecond, Policy: RestartPolicyOnFailure},
+		Runnable: astibob.NewBaseRunnable(astibob.BaseRunnableOptions{
+			Metadata: astibob.Metadata{Name: "r"},
+			OnStart: func(ctx context.Context) error {
+				starts <- true
+				return errors.New("test")
+			},
+		}),
+	})
+
+	// Start
+	if err := w.startRunnable("r"); err != nil {
+		t.Fatalf("starting runnable failed: %v", err)
+	}
+
+	// Runnable is restarted until max retries is reached
+	for idx := 0; idx < 3; idx++ {
+		select {
+		case <-starts:
+		case <-time.After(time.Second):
+			t.Fatalf("runnable hasn't been started %d time(s)", idx+1)
+		}
+	}
+	select {
+	case <-starts:
+		t.Fatal("runnable shouldn't be restarted once max retries is reached")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Restarts and last error are kept
+	w.mr.Lock()
+	s := w.ss["r"]
+	restarts, lastError := s.restarts, s.lastError
+	w.mr.Unlock()
+	if restarts != 2 {
+		t.Fatalf("expected 2 restarts, got %d", restarts)
+	}
+	if e := "astibob: OnStart failed: test"; lastError != e {
+		t.Fatalf("expected last error %s, got %s", e, lastError)
+	}
+}
@@ -6,7 +6,22 @@ import (
 	"github.com/asticode/go-astibob"
 )
 
+// The index keeps track of runnable statuses and configs even when no UI is connected
+var indexMessageNames = map[string]bool{
+	astibob.RunnableConfigUpdatedMessage: true,
+	astibob.RunnableCrashedMessage:       true,
+	astibob.RunnableStartedMessage:       true,
+	astibob.RunnableStartingMessage:      true,
+	astibob.RunnableStoppedMessage:       true,
+	astibob.RunnableStoppingMessage:      true,
+}
+
 func (w *Worker) addUIMessageNames(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var names []string
 	if names, err = astibob.ParseUIMessageNamesAddPayload(m); err != nil {
@@ -24,6 +39,11 @@ func (w *Worker) addUIMessageNames(m *astibob.Message) (err error) {
 }
 
 func (w *Worker) deleteUIMessageNames(m *astibob.Message) (err error) {
+	// Invalid sender
+	if err = checkIndexMessage(m); err != nil {
+		return
+	}
+
 	// Parse payload
 	var names []string
 	if names, err = astibob.ParseUIMessageNamesDeletePayload(m); err != nil {
@@ -40,6 +60,27 @@ func (w *Worker) deleteUIMessageNames(m *astibob.Message) (err error) {
 	return
 }
 
+// uiMessageRequested checks whether a UI requested the message. UIs may request message name patterns (e.g.
+// "audio_input.*").
+func (w *Worker) uiMessageRequested(name string) bool {
+	// Lock
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// Exact match
+	if _, ok := w.us[name]; ok {
+		return true
+	}
+
+	// Loop through patterns
+	for n := range w.us {
+		if astibob.WildcardMatch(n, name) {
+			return true
+		}
+	}
+	return false
+}
+
 func (w *Worker) sendMessageToUI(m *astibob.Message) (err error) {
 	// Only send message from current worker
 	if m.From.WorkerName() != w.name {
@@ -47,19 +88,16 @@ func (w *Worker) sendMessageToUI(m *astibob.Message) (err error) {
 	}
 
 	// No UI requested this message
-	w.mu.Lock()
-	if _, ok := w.us[m.Name]; !ok {
-		w.mu.Unlock()
+	if !indexMessageNames[m.Name] && !w.uiMessageRequested(m.Name) {
 		return
 	}
-	w.mu.Unlock()
 
 	// Log
 	w.l.Debugf("worker: sending %s message to ui", m.Name)
 
 	// Write
-	if err = w.cw.WriteJSON(m); err != nil {
-		err = fmt.Errorf("worker: writing JSON message failed: %w", err)
+	if err = w.writeToIndex(m); err != nil {
+		err = fmt.Errorf("worker: writing message failed: %w", err)
 		return
 	}
 	return
@@ -2,80 +2,197 @@ package worker
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/asticode/go-astibob"
 	"github.com/asticode/go-astikit"
 	"github.com/asticode/go-astiws"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Options struct {
-	Index  astibob.ServerOptions `toml:"index"`
-	Server astibob.ServerOptions `toml:"server"`
+	// Configs of configurable runnables are persisted in this dir. Empty means configs are lost on restart.
+	ConfigsDirPath string `toml:"configs_dir_path"`
+	// Dials connections of HTTP requests and websockets
+	Dial  astibob.DialFunc      `toml:"-"`
+	Index astibob.ServerOptions `toml:"index"`
+	// Records dispatched messages so that they can be inspected or replayed
+	Journal astibob.JournalOptions `toml:"journal"`
+	// Mirrors worker-to-worker messages to the index while inspectors are connected
+	Mirror bool `toml:"mirror"`
+	// Bounds the dispatcher queues of messages whose name matches the pattern key (e.g. "audio_input.*")
+	Queues map[string]astibob.QueueOptions `toml:"queues"`
+	// Drops messages whose name matches the pattern key when they exceed the rate limit
+	RateLimits map[string]astibob.RateLimit `toml:"rate_limits"`
+	Reconnect  ReconnectOptions             `toml:"reconnect"`
+	// OnDone callbacks of SendMessage are called with a failure if the runnable hasn't replied within that long.
+	// Defaults to 1 minute.
+	RequestTimeout time.Duration         `toml:"request_timeout"`
+	Server         astibob.ServerOptions `toml:"server"`
+	// Token bound to the worker name, created by an admin through the index. It takes precedence over index
+	// credentials.
+	Token string `toml:"token"`
+}
+
+// ReconnectOptions represents the backoff used when the connection to the index drops. Zero values fall back to
+// defaults.
+type ReconnectOptions struct {
+	MaxBackoff time.Duration `toml:"max_backoff"`
+	MinBackoff time.Duration `toml:"min_backoff"`
 }
 
 type Worker struct {
+	c    astibob.Codec          // Codec used to communicate with the index
+	cd   *prometheus.CounterVec // Messages dropped by channels indexed by worker
 	ch   *http.Client
-	cw   *astiws.Client
+	cw   *astibob.WebsocketClient
 	d    *astibob.Dispatcher
-	ds   map[int]OnDone // On done callbacks indexed by message id
+	ds   map[int]request    // Pending requests indexed by message id
+	hc   context.CancelFunc // Stops heartbeats
 	id   int
+	ik   []byte // Key the index signs its requests with
+	in   bool   // Whether inspectors are connected to the index
+	j    *astibob.Journal
 	l    astikit.SeverityLogger
 	ls   map[string]map[string]map[string]bool // Worker's listenables indexed by worker --> runnable --> message
+	mc   *sync.Mutex                           // Locks c
 	md   *sync.Mutex                           // Locks ds
+	mg   *sync.Mutex                           // Serializes config updates
+	mh   *sync.Mutex                           // Locks hc
 	mi   *sync.Mutex                           // Locks id
+	mk   *sync.Mutex                           // Locks ik
 	ml   *sync.Mutex                           // Locks ls
+	mn   *sync.Mutex                           // Locks in
 	mo   *sync.Mutex                           // Locks ols
-	mr   *sync.Mutex                           // Locks rs
+	mq   *sync.Mutex                           // Locks qs
+	mr   *sync.Mutex                           // Locks rs and ss
+	mt   *astibob.Metrics                      // Exposed at /metrics
 	mu   *sync.Mutex                           // Locks us
 	mw   *sync.Mutex                           // Locks ws
 	name string
 	o    Options
 	ols  map[string]map[string]map[string]bool // Other workers listenables indexed by runnable --> worker --> message
+	pf   *prometheus.CounterVec                // Failed posts to other workers indexed by worker
+	qs   map[string]*sequences                 // Sequences received from other workers indexed by worker
 	rs   map[string]astibob.Runnable
+	sl   astikit.StdLogger
+	ss   map[string]*supervisor // Supervisors indexed by runnable name
+	sv   *astibob.SignatureVerifier
 	us   map[string]bool // UI messages names indexed by message
 	w    *astikit.Worker
+	wc   *astibob.WebsocketConns // Connections of other workers websockets
+	wd   *websocket.Dialer       // Shared by the index websocket client and channels
 	ws   map[string]*worker
+	ww   *astiws.Manager
 }
 
 // New creates a new worker
 func New(name string, o Options, l astikit.StdLogger) (w *Worker) {
 	// Create worker
 	w = &Worker{
+		c:    astibob.JSONCodec,
 		ch:   &http.Client{},
-		cw:   astiws.NewClient(astiws.ClientConfiguration{}, l),
-		ds:   make(map[int]OnDone),
+		ds:   make(map[int]request),
 		l:    astikit.AdaptStdLogger(l),
 		ls:   make(map[string]map[string]map[string]bool),
+		mc:   &sync.Mutex{},
 		md:   &sync.Mutex{},
+		mg:   &sync.Mutex{},
+		mh:   &sync.Mutex{},
 		mi:   &sync.Mutex{},
+		mk:   &sync.Mutex{},
 		ml:   &sync.Mutex{},
+		mn:   &sync.Mutex{},
 		mo:   &sync.Mutex{},
+		mq:   &sync.Mutex{},
 		mr:   &sync.Mutex{},
 		mu:   &sync.Mutex{},
 		mw:   &sync.Mutex{},
 		name: name,
 		o:    o,
 		ols:  make(map[string]map[string]map[string]bool),
+		qs:   make(map[string]*sequences),
 		rs:   make(map[string]astibob.Runnable),
+		sl:   l,
+		ss:   make(map[string]*supervisor),
+		sv:   astibob.NewSignatureVerifier(),
 		us:   make(map[string]bool),
 		w:    astikit.NewWorker(astikit.WorkerOptions{Logger: l}),
+		wc:   astibob.NewWebsocketConns(),
 		ws:   make(map[string]*worker),
+		ww:   astiws.NewManager(astiws.ManagerConfiguration{}, l),
+	}
+
+	// Configure TLS
+	// Peers present the worker's server certificate when they require mutual TLS
+	c, err := astibob.ClientTLSConfig(o.Index, o.Server)
+	if err != nil {
+		w.l.Error(fmt.Errorf("worker: getting client tls config failed: %w", err))
+	}
+
+	// Configure http client
+	if c != nil || o.Dial != nil {
+		w.ch.Transport = &http.Transport{
+			DialContext:     o.Dial,
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: c,
+		}
 	}
 
+	// Create websocket dialer
+	w.wd = astibob.NewWebsocketDialer(c, o.Dial)
+
+	// Create index websocket client
+	w.cw = astibob.NewWebsocketClient(w.wd, l)
+
 	// Create dispatcher
 	w.d = astibob.NewDispatcher(w.w.Context(), w.w.NewTask, w.l)
 
+	// Make sure a handler panicking doesn't take the process down
+	w.d.Use(astibob.MessageMiddlewareRecover())
+
+	// Create metrics
+	w.newMetrics()
+
+	// Set queue options
+	for p, qo := range o.Queues {
+		w.d.SetQueueOptions(p, qo)
+	}
+
+	// Set rate limits
+	if len(o.RateLimits) > 0 {
+		w.d.UseMessage(astibob.MessageMiddlewareRateLimit(o.RateLimits))
+	}
+
+	// Create journal
+	if o.Journal.Path != "" {
+		if w.j, err = astibob.NewJournal(o.Journal); err != nil {
+			w.l.Error(fmt.Errorf("worker: creating journal failed: %w", err))
+		} else {
+			w.d.SetJournal(w.j)
+		}
+	}
+
 	// Add websocket message handler
 	w.cw.SetMessageHandler(w.handleIndexMessage)
 
 	// Add dispatcher handlers
+	w.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.InspectorStateMessage)}, w.updateInspected)
 	w.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.ListenablesRegisterMessage)}, w.registerListenables)
-	w.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.RunnableDoneMessage)}, w.doneMessage)
+	w.d.On(astibob.DispatchConditions{
+		Name: astikit.StrPtr(astibob.RunnableDoneMessage),
+		To:   w.workerIdentifier(),
+	}, w.doneMessage)
+	w.d.On(astibob.DispatchConditions{
+		Name: astikit.StrPtr(astibob.RunnableConfigUpdateMessage),
+		To:   w.workerIdentifier(),
+	}, w.updateRunnableConfigFromMessage)
 	w.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.RunnableStartMessage)}, w.startRunnableFromMessage)
 	w.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.RunnableStopMessage)}, w.stopRunnableFromMessage)
 	w.d.On(astibob.DispatchConditions{Name: astikit.StrPtr(astibob.UIMessageNamesAddMessage)}, w.addUIMessageNames)
@@ -97,21 +214,67 @@ func (w *Worker) HandleSignals() {
 	w.w.HandleSignals()
 }
 
+// Stop stops the worker and its tasks
+func (w *Worker) Stop() {
+	w.w.Stop()
+}
+
 // Wait waits for the index to be stopped
 func (w *Worker) Wait() {
 	w.w.Wait()
 }
 
-// On makes sure to handle messages with specific conditions
-func (w *Worker) On(c astibob.DispatchConditions, h astibob.MessageHandler) {
-	w.d.On(c, h)
+// On makes sure to handle messages with specific conditions. Use the returned handle to remove the handler.
+func (w *Worker) On(c astibob.DispatchConditions, h astibob.MessageHandler) *astibob.DispatchHandle {
+	return w.d.On(c, h)
+}
+
+// DispatcherStats returns the state of the dispatcher queues, including the number of dropped messages
+func (w *Worker) DispatcherStats() astibob.DispatcherStats {
+	return w.d.Stats()
+}
+
+// Use adds middlewares wrapping message handlers
+func (w *Worker) Use(ms ...astibob.MessageMiddleware) {
+	w.d.Use(ms...)
+}
+
+// UseMessage adds middlewares wrapping the handling of a message by all its handlers
+func (w *Worker) UseMessage(ms ...astibob.MessageMiddleware) {
+	w.d.UseMessage(ms...)
+}
+
+// UseOutbound adds middlewares wrapping messages dispatched by runnables
+func (w *Worker) UseOutbound(ms ...astibob.MessageMiddleware) {
+	w.d.UseOutbound(ms...)
+}
+
+// NewDispatchGroup creates a group of handlers that can be removed together
+func (w *Worker) NewDispatchGroup() *astibob.DispatchGroup {
+	return w.d.NewGroup()
 }
 
 // Close closes the worker properly
 func (w *Worker) Close() error {
+	// Fail pending requests
+	w.failRequests("", "worker: worker is closing")
+
 	// Close dispatcher
 	w.d.Close()
 
+	// Close journal
+	if w.j != nil {
+		if err := w.j.Close(); err != nil {
+			w.l.Error(fmt.Errorf("worker: closing journal failed: %w", err))
+		}
+	}
+
+	// Close channels
+	w.resetWorkers()
+
+	// Close other workers websockets
+	w.wc.Close()
+
 	// Close client
 	if w.cw != nil {
 		if err := w.cw.Close(); err != nil {
@@ -121,6 +284,31 @@ func (w *Worker) Close() error {
 	return nil
 }
 
+func (w *Worker) workerKey(name string) ([]byte, bool) {
+	// Lock
+	w.mw.Lock()
+	defer w.mw.Unlock()
+
+	// Get worker
+	mw, ok := w.ws[name]
+	if !ok || len(mw.key) == 0 {
+		return nil, false
+	}
+	return mw.key, true
+}
+
+func (w *Worker) indexKey(name string) ([]byte, bool) {
+	// Lock
+	w.mk.Lock()
+	defer w.mk.Unlock()
+
+	// Only the index can send those requests
+	if name != astibob.IndexIdentifierType || len(w.ik) == 0 {
+		return nil, false
+	}
+	return w.ik, true
+}
+
 func (w *Worker) workerIdentifier() *astibob.Identifier {
 	return astibob.NewWorkerIdentifier(w.name)
 }
@@ -131,6 +319,9 @@ func (w *Worker) runnableIdentifier(name string) *astibob.Identifier {
 
 type worker struct {
 	addr string
+	c    astibob.Codec
+	ch   *channel
+	key  []byte      // Key shared with the worker to sign messages
 	mr   *sync.Mutex // Locks rs
 	name string
 	rs   map[string]astibob.RunnableMessage
@@ -140,6 +331,8 @@ func newWorker(i astibob.Worker) (w *worker) {
 	// Create
 	w = &worker{
 		addr: i.Addr,
+		c:    astibob.NegotiateCodec(i.Codecs),
+		key:  i.Key,
 		mr:   &sync.Mutex{},
 		name: i.Name,
 		rs:   make(map[string]astibob.RunnableMessage),
@@ -207,35 +400,39 @@ func (w *Worker) sendMessageToWorker(m *astibob.Message) (err error) {
 		w.mw.Unlock()
 	}
 
+	// Mirror
+	if len(ws) > 0 {
+		w.mirrorMessage(m)
+	}
+
 	// Loop through workers
 	for _, mw := range ws {
 		// Log
 		w.l.Debugf("worker: sending message %s to worker %s", m.Name, mw.name)
 
-		// Marshal
-		var b []byte
-		if b, err = json.Marshal(m); err != nil {
-			err = fmt.Errorf("worker: marshaling failed: %w", err)
-			return
-		}
-
-		// Send request
-		if err = w.sendRequestToWorker(http.MethodPost, fmt.Sprintf("%s/api/messages", mw.addr), bytes.NewReader(b)); err != nil {
-			err = fmt.Errorf("worker: sending request to worker %s failed: %w", mw.name, err)
-			return
-		}
+		// Send
+		mw.ch.send(m)
 	}
 	return
 }
 
-func (w *Worker) sendRequestToWorker(method, url string, body io.Reader) (err error) {
+func (w *Worker) sendRequestToWorker(ctx context.Context, method, url, contentType string, key, body []byte) (err error) {
 	// Create request
 	var req *http.Request
-	if req, err = http.NewRequest(method, url, body); err != nil {
+	if req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body)); err != nil {
 		err = fmt.Errorf("worker: creating request failed: %w", err)
 		return
 	}
 
+	// Set content type
+	req.Header.Set("Content-Type", contentType)
+
+	// Sign
+	if err = astibob.SignRequest(req, w.name, key, body); err != nil {
+		err = fmt.Errorf("worker: signing request failed: %w", err)
+		return
+	}
+
 	// Send request
 	var resp *http.Response
 	if resp, err = w.ch.Do(req); err != nil {